@@ -0,0 +1,198 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/controller/parser"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/utils"
+	"github.com/Algo2147483647/ray/engine/utils/hdrio"
+	"gonum.org/v1/gonum/mat"
+)
+
+// ParseLights builds the scene's infinite and delta lights. Infinite lights
+// live at infinity and delta lights are sampled along straight shadow rays in
+// three-dimensional Euclidean space, so other geometries and dimensions
+// reject them.
+func ParseLights(script *parser.Script, g geometry.Geometry, dimension int) ([]light.Infinite, []light.Delta, error) {
+	if script == nil || len(script.Lights) == 0 {
+		return nil, nil, nil
+	}
+	if geometry.Get(g).Kind() != geometry.EuclideanKind || dimension != 3 {
+		return nil, nil, fmt.Errorf("lights require 3D euclidean geometry, got %s in dimension %d", geometry.Get(g).Name(), dimension)
+	}
+
+	var infinite []light.Infinite
+	var delta []light.Delta
+	var parseErrors []error
+	for idx, def := range script.Lights {
+		parsedInfinite, parsedDelta, err := parseLight(def)
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Errorf("light[%d]: %w", idx, err))
+			continue
+		}
+		infinite = append(infinite, parsedInfinite...)
+		delta = append(delta, parsedDelta...)
+	}
+	if len(parseErrors) > 0 {
+		return nil, nil, errors.Join(parseErrors...)
+	}
+	return infinite, delta, nil
+}
+
+// parseLight returns the lights one script entry describes.
+func parseLight(def map[string]interface{}) ([]light.Infinite, []light.Delta, error) {
+	lightType, err := utils.RequiredStringField(def, "type")
+	if err != nil {
+		return nil, nil, err
+	}
+	switch lightType {
+	case "point", "spot", "directional", "beam":
+		parsed, err := parseDeltaLight(lightType, def)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, []light.Delta{parsed}, nil
+	default:
+		parsed, err := parseInfiniteLight(lightType, def)
+		return parsed, nil, err
+	}
+}
+
+// parseInfiniteLight returns the lights one script entry describes; a
+// daylight entry yields its sky and its sun.
+func parseInfiniteLight(lightType string, def map[string]interface{}) ([]light.Infinite, error) {
+	switch lightType {
+	case "constant_sky":
+		radiance, err := requiredSpectralParameterField(def, "radiance")
+		if err != nil {
+			return nil, err
+		}
+		return []light.Infinite{light.NewConstantSky(radiance)}, nil
+	case "environment_map":
+		path, err := utils.RequiredStringField(def, "file")
+		if err != nil {
+			return nil, err
+		}
+		scale, err := optionalLightRange(def, "scale", 1, 0, math.MaxFloat64)
+		if err != nil {
+			return nil, err
+		}
+		image, err := hdrio.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return []light.Infinite{light.NewEnvironmentMap(image, scale)}, nil
+	case "daylight":
+		return parseDaylight(def)
+	default:
+		return nil, fmt.Errorf("unsupported light type %q", lightType)
+	}
+}
+
+func parseDaylight(def map[string]interface{}) ([]light.Infinite, error) {
+	elevation, err := utils.RequiredFloat64Field(def, "sun_elevation")
+	if err != nil {
+		return nil, err
+	}
+	if !(elevation >= 0 && elevation <= 90) {
+		return nil, fmt.Errorf("field %q must be in [0, 90], got %v", "sun_elevation", elevation)
+	}
+	daylight := light.Daylight{SunElevation: elevation}
+	fields := []struct {
+		key                        string
+		target                     *float64
+		fallback, minimum, maximum float64
+	}{
+		{"sun_azimuth", &daylight.SunAzimuth, 0, -360, 360},
+		{"turbidity", &daylight.Turbidity, 3, light.MinTurbidity, light.MaxTurbidity},
+		{"ground_albedo", &daylight.GroundAlbedo, 0.3, 0, 1},
+		{"sun_angular_diameter", &daylight.SunAngularDiameter, light.DefaultSunAngularDiameter, 0.1, 20},
+		{"scale", &daylight.Scale, 1, 0, math.MaxFloat64},
+	}
+	for _, field := range fields {
+		if *field.target, err = optionalLightRange(def, field.key, field.fallback, field.minimum, field.maximum); err != nil {
+			return nil, err
+		}
+	}
+	withSun, ok, err := utils.OptionalBoolField(def, "sun")
+	if err != nil {
+		return nil, err
+	}
+
+	lights := []light.Infinite{light.NewPreethamSky(daylight)}
+	if !ok || withSun {
+		lights = append(lights, light.NewSun(daylight))
+	}
+	return lights, nil
+}
+
+// parseDeltaLight builds a point, spot, directional or beam light. Positional
+// lights take a spectral intensity, the others a spectral irradiance.
+func parseDeltaLight(lightType string, def map[string]interface{}) (light.Delta, error) {
+	var position, direction *mat.VecDense
+	var err error
+	if lightType != "directional" {
+		if position, err = utils.RequiredVec(def, "position", 3); err != nil {
+			return nil, err
+		}
+	}
+	if lightType != "point" {
+		if direction, err = utils.RequiredNonZeroVec(def, "direction", 3); err != nil {
+			return nil, err
+		}
+	}
+	quantity := "irradiance"
+	if lightType == "point" || lightType == "spot" {
+		quantity = "intensity"
+	}
+	value, err := requiredSpectralParameterField(def, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	switch lightType {
+	case "point":
+		return light.NewPoint(position, value), nil
+	case "spot":
+		coneAngle, err := optionalLightRange(def, "cone_angle", 30, 0, 90)
+		if err != nil {
+			return nil, err
+		}
+		if coneAngle == 0 {
+			return nil, fmt.Errorf("field %q must be > 0", "cone_angle")
+		}
+		falloffStart, err := optionalLightRange(def, "falloff_start", math.Max(0, coneAngle-5), 0, coneAngle)
+		if err != nil {
+			return nil, err
+		}
+		return light.NewSpot(position, direction, value, coneAngle, falloffStart), nil
+	case "directional":
+		return light.NewDirectional(direction, value), nil
+	default:
+		radius, err := utils.RequiredPositiveFloat(def, "radius")
+		if err != nil {
+			return nil, err
+		}
+		return light.NewBeam(position, direction, radius, value), nil
+	}
+}
+
+// optionalLightRange reads an optional number that must lie in
+// [minimum, maximum].
+func optionalLightRange(def map[string]interface{}, key string, fallback, minimum, maximum float64) (float64, error) {
+	value, ok, err := utils.OptionalFloat64Field(def, key)
+	if err != nil || !ok {
+		return fallback, err
+	}
+	if math.IsNaN(value) || value < minimum || value > maximum {
+		if maximum == math.MaxFloat64 {
+			return 0, fmt.Errorf("field %q must be finite and >= %v, got %v", key, minimum, value)
+		}
+		return 0, fmt.Errorf("field %q must be in [%v, %v], got %v", key, minimum, maximum, value)
+	}
+	return value, nil
+}
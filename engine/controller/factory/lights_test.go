@@ -0,0 +1,192 @@
+package factory
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/controller/parser"
+	"github.com/Algo2147483647/ray/engine/model"
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestLoadSceneFromScriptParsesInfiniteLights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sky.pfm")
+	// A 2x1 little-endian colour PFM: one black texel and one white texel.
+	pfm := []byte("PF\n2 1\n-1.0\n")
+	for _, value := range []float32{0, 0, 0, 1, 1, 1} {
+		pfm = binary.LittleEndian.AppendUint32(pfm, math.Float32bits(value))
+	}
+	if err := os.WriteFile(path, pfm, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scene := model.NewScene()
+	script := &parser.Script{
+		Renders: []parser.RenderScript{{Dimension: 3}},
+		Lights: []map[string]interface{}{
+			{"type": "constant_sky", "radiance": []interface{}{0.1, 0.2, 0.3}},
+			{"type": "environment_map", "file": path, "scale": 2.0},
+		},
+	}
+	if err := LoadSceneFromScript(script, scene); err != nil {
+		t.Fatalf("LoadSceneFromScript failed: %v", err)
+	}
+	if len(scene.ObjectTree.InfiniteLights) != 2 {
+		t.Fatalf("expected 2 infinite lights, got %d", len(scene.ObjectTree.InfiniteLights))
+	}
+	env, ok := scene.ObjectTree.InfiniteLights[1].(*light.EnvironmentMap)
+	if !ok {
+		t.Fatalf("expected an environment map, got %T", scene.ObjectTree.InfiniteLights[1])
+	}
+	// The second column covers azimuths in [π, 2π).
+	if radiance := env.Radiance(nil, mat.NewVecDense(3, []float64{0, -1, 0})); radiance.RGB[1] != 2 {
+		t.Fatalf("expected the scaled white texel, got %v", radiance)
+	}
+}
+
+func TestParseLightsExpandsDaylightIntoSkyAndSun(t *testing.T) {
+	script := &parser.Script{Lights: []map[string]interface{}{
+		{"type": "daylight", "sun_elevation": 35.0, "sun_azimuth": 120.0, "turbidity": 4.0},
+		{"type": "daylight", "sun_elevation": 10.0, "sun": false, "ground_albedo": 0.0},
+	}}
+	lights, _, err := ParseLights(script, nil, 3)
+	if err != nil {
+		t.Fatalf("ParseLights failed: %v", err)
+	}
+	if len(lights) != 3 {
+		t.Fatalf("expected sky, sun and sky, got %d lights", len(lights))
+	}
+	if _, ok := lights[0].(*light.PreethamSky); !ok {
+		t.Fatalf("expected a Preetham sky first, got %T", lights[0])
+	}
+	if _, ok := lights[1].(*light.Sun); !ok {
+		t.Fatalf("expected the sun second, got %T", lights[1])
+	}
+	if _, ok := lights[2].(*light.PreethamSky); !ok {
+		t.Fatalf("expected a sky without sun last, got %T", lights[2])
+	}
+}
+
+func TestLoadSceneFromScriptParsesDeltaLights(t *testing.T) {
+	scene := model.NewScene()
+	script := &parser.Script{
+		Renders: []parser.RenderScript{{Dimension: 3}},
+		Lights: []map[string]interface{}{
+			{"type": "point", "position": []interface{}{0.0, 0.0, 2.0}, "intensity": []interface{}{4.0, 4.0, 4.0}},
+			{
+				"type": "spot", "position": []interface{}{0.0, 0.0, 2.0}, "direction": []interface{}{0.0, 0.0, -1.0},
+				"intensity":  map[string]interface{}{"type": "blackbody", "temperature": 3200.0, "scale": 2.0},
+				"cone_angle": 25.0,
+			},
+			{"type": "directional", "direction": []interface{}{0.0, 1.0, -1.0}, "irradiance": []interface{}{1.5, 1.5, 1.5}},
+			{
+				"type": "beam", "position": []interface{}{-1.0, 0.0, 0.5}, "direction": []interface{}{1.0, 0.0, 0.0},
+				"radius": 0.1, "irradiance": []interface{}{2.0, 0.0, 0.0},
+			},
+		},
+	}
+	if err := LoadSceneFromScript(script, scene); err != nil {
+		t.Fatalf("LoadSceneFromScript failed: %v", err)
+	}
+	lights := scene.ObjectTree.DeltaLights
+	if len(lights) != 4 || len(scene.ObjectTree.InfiniteLights) != 0 {
+		t.Fatalf("expected 4 delta lights and no infinite light, got %d and %d", len(lights), len(scene.ObjectTree.InfiniteLights))
+	}
+	point := mat.NewVecDense(3, []float64{0, 0, 0})
+	incident, ok := lights[0].Incident(nil, point)
+	if !ok || incident.Irradiance.RGB[0] != 1 || incident.Distance != 2 {
+		t.Fatalf("expected 4/2² from the point light at distance 2, got %v", incident)
+	}
+	directional, ok := lights[2].(*light.Directional)
+	if !ok || math.Abs(directional.Direction.AtVec(1)-math.Sqrt(0.5)) > 1e-12 {
+		t.Fatalf("expected a normalized directional light, got %#v", lights[2])
+	}
+	if _, ok := lights[3].Incident(nil, mat.NewVecDense(3, []float64{0, 0.2, 0.5})); ok {
+		t.Fatal("a point beside the beam should receive no light")
+	}
+}
+
+func TestLoadSceneFromScriptRejectsInvalidLights(t *testing.T) {
+	cases := []struct {
+		name   string
+		script *parser.Script
+		want   string
+	}{
+		{
+			name: "unknown type",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights:  []map[string]interface{}{{"type": "ies"}},
+			},
+			want: `unsupported light type "ies"`,
+		},
+		{
+			name: "spot falloff outside cone",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights: []map[string]interface{}{{
+					"type": "spot", "position": []interface{}{0.0, 0.0, 1.0}, "direction": []interface{}{0.0, 0.0, -1.0},
+					"intensity": []interface{}{1.0, 1.0, 1.0}, "cone_angle": 20.0, "falloff_start": 25.0,
+				}},
+			},
+			want: `"falloff_start" must be in [0, 20]`,
+		},
+		{
+			name: "beam without radius",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights: []map[string]interface{}{{
+					"type": "beam", "position": []interface{}{0.0, 0.0, 1.0}, "direction": []interface{}{0.0, 0.0, -1.0},
+					"irradiance": []interface{}{1.0, 1.0, 1.0},
+				}},
+			},
+			want: `"radius"`,
+		},
+		{
+			name: "missing file",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights:  []map[string]interface{}{{"type": "environment_map", "file": "missing.hdr"}},
+			},
+			want: "missing.hdr",
+		},
+		{
+			name: "sun below horizon",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights:  []map[string]interface{}{{"type": "daylight", "sun_elevation": -3.0}},
+			},
+			want: `"sun_elevation" must be in [0, 90]`,
+		},
+		{
+			name: "turbidity",
+			script: &parser.Script{
+				Renders: []parser.RenderScript{{Dimension: 3}},
+				Lights:  []map[string]interface{}{{"type": "daylight", "sun_elevation": 30.0, "turbidity": 20.0}},
+			},
+			want: `"turbidity" must be in [1.7, 10]`,
+		},
+		{
+			name: "non-euclidean",
+			script: &parser.Script{
+				Renders:  []parser.RenderScript{{Dimension: 3}},
+				Geometry: &parser.GeometryScript{Type: "klein"},
+				Lights:   []map[string]interface{}{{"type": "constant_sky", "radiance": []interface{}{1.0, 1.0, 1.0}}},
+			},
+			want: "3D euclidean",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := LoadSceneFromScript(tc.script, model.NewScene())
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
 	"github.com/Algo2147483647/ray/engine/utils"
+	"github.com/Algo2147483647/ray/engine/utils/eemio"
+	"github.com/Algo2147483647/ray/engine/utils/iesio"
 )
 
 func ParseMaterials(script *parser.Script) (map[string]*material.Material, error) {
@@ -148,6 +150,20 @@ func parseSurface(def map[string]interface{}) (bsdf.BSDF, error) {
 		}
 		return bsdf.NewSingle(bxdf.NewSpecularReflectionParameter(reflectance)), nil
 
+	case "linear_polarizer":
+		transmittance, _, err := optionalSpectralParameterField(def, "transmittance", spectrum_parameter.NewConstantParameter(1))
+		if err != nil {
+			return nil, err
+		}
+		axisAngle, _, err := utils.OptionalFloat64Field(def, "axis_angle")
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(axisAngle) || math.IsInf(axisAngle, 0) {
+			return nil, fmt.Errorf("axis_angle must be finite")
+		}
+		return bsdf.NewSingle(bxdf.NewLinearPolarizerParameter(transmittance, axisAngle*math.Pi/180)), nil
+
 	case "specular_dielectric":
 		reflectance, _, err := optionalSpectralParameterField(def, "reflectance", spectrum_parameter.NewConstantParameter(1))
 		if err != nil {
@@ -272,11 +288,70 @@ func parseSurface(def map[string]interface{}) (bsdf.BSDF, error) {
 		alpha := roughness * roughness
 		return bsdf.NewSingle(bxdf.NewRoughDielectricTransmissionParameter(transmittance, etaOutside, insideIOR, alpha)), nil
 
+	case "fluorescent":
+		reflectance, _, err := optionalSpectralParameterField(def, "reflectance", spectrum_parameter.NewConstantParameter(0))
+		if err != nil {
+			return nil, err
+		}
+		reradiationDef, ok, err := utils.OptionalMapField(def, "reradiation")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("reradiation is required")
+		}
+		reradiation, err := parseReradiationMatrix(reradiationDef)
+		if err != nil {
+			return nil, fmt.Errorf("reradiation: %w", err)
+		}
+		return bsdf.NewSingle(bxdf.NewFluorescentParameter(reflectance, reradiation)), nil
+
 	default:
 		return nil, fmt.Errorf("unsupported surface type %q", surfaceType)
 	}
 }
 
+// parseReradiationMatrix reads an excitation-emission matrix from the CSV or
+// JSON file named by file, or from inline excitation_nm, emission_nm and
+// values fields.
+func parseReradiationMatrix(def map[string]interface{}) (*bxdf.ReradiationMatrix, error) {
+	path, ok, err := utils.OptionalStringField(def, "file")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		matrix, err := eemio.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		result, err := bxdf.NewReradiationMatrix(matrix.Excitation, matrix.Emission, matrix.Values)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", path, err)
+		}
+		return result, nil
+	}
+
+	excitation, err := utils.RequiredFloat64SliceField(def, "excitation_nm")
+	if err != nil {
+		return nil, err
+	}
+	emissionNM, err := utils.RequiredFloat64SliceField(def, "emission_nm")
+	if err != nil {
+		return nil, err
+	}
+	rawValues, ok := def["values"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("values must be an array of rows")
+	}
+	values := make([][]float64, len(rawValues))
+	for i, rawRow := range rawValues {
+		if values[i], err = utils.ToFloat64Slice(rawRow); err != nil {
+			return nil, fmt.Errorf("values[%d]: %w", i, err)
+		}
+	}
+	return bxdf.NewReradiationMatrix(excitation, emissionNM, values)
+}
+
 func parseCylindricalGridCutoutSurface(def map[string]interface{}) (bsdf.BSDF, error) {
 	lineSurface, err := parseGridLineSurface(def)
 	if err != nil {
@@ -401,13 +476,17 @@ func parseEmission(def map[string]interface{}) (emission.Emitter, error) {
 		_, hasRadiance := def["radiance"]
 		_, hasColor := def["color"]
 		_, hasExitance := def["exitance"]
-		if hasExitance && (hasRadiance || hasColor) {
-			return nil, fmt.Errorf("radiance/color and exitance are mutually exclusive")
+		_, hasIntensity := def["intensity"]
+		if countTrue(hasRadiance || hasColor, hasExitance, hasIntensity) > 1 {
+			return nil, fmt.Errorf("radiance/color, exitance and intensity are mutually exclusive")
 		}
 		var strength optics.SpectralParameter
 		if hasExitance {
 			strength, err = requiredSpectralParameterField(def, "exitance")
 			quantity = emission.TotalExitance
+		} else if hasIntensity {
+			strength, err = requiredSpectralParameterField(def, "intensity")
+			quantity = emission.LuminousIntensity
 		} else {
 			strength, err = requiredEmissionRadianceField(def)
 		}
@@ -429,9 +508,22 @@ func parseEmission(def map[string]interface{}) (emission.Emitter, error) {
 	if err != nil {
 		return nil, err
 	}
+	if photometric, ok := distribution.(emission.Photometric); quantity == emission.LuminousIntensity && (!ok || photometric.PeakIntensity() <= 0) {
+		return nil, fmt.Errorf("intensity requires a photometric distribution such as ies")
+	}
 	return emission.NewSurfaceEmitter(field, distribution, quantity), nil
 }
 
+func countTrue(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
+
 func parseEmissionDistribution(def map[string]interface{}) (emission.AngularDistribution, error) {
 	distributionDef, ok, err := utils.OptionalMapField(def, "distribution")
 	if err != nil {
@@ -491,6 +583,23 @@ func parseEmissionDistribution(def map[string]interface{}) (emission.AngularDist
 			return nil, fmt.Errorf("distribution: %w", err)
 		}
 		return result, nil
+	case "ies":
+		if _, ok := distributionDef["sidedness"]; ok {
+			return nil, fmt.Errorf("ies distribution takes its sides from the profile, not sidedness")
+		}
+		path, err := utils.RequiredStringField(distributionDef, "file")
+		if err != nil {
+			return nil, fmt.Errorf("distribution: %w", err)
+		}
+		profile, err := iesio.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("distribution: %w", err)
+		}
+		result, err := emission.NewIESDistribution(profile)
+		if err != nil {
+			return nil, fmt.Errorf("distribution %q: %w", path, err)
+		}
+		return result, nil
 	default:
 		return nil, fmt.Errorf("unsupported emission distribution type %q", distributionType)
 	}
@@ -2,11 +2,14 @@ package factory
 
 import (
 	"math"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/Algo2147483647/ray/engine/controller/parser"
 	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model"
 	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
 	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
 	"github.com/Algo2147483647/ray/engine/model/material/emission"
@@ -46,6 +49,108 @@ func TestParseCosinePowerEmission(t *testing.T) {
 	}
 }
 
+func TestParseIESEmission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "downlight.ies")
+	profile := "IESNA:LM-63-2002\nTILT=NONE\n1 1000 1 3 1 1 2 0 0 0\n1 1 20\n0 45 90\n0\n300 150 0\n"
+	if err := os.WriteFile(path, []byte(profile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := &parser.Script{Materials: []map[string]interface{}{
+		{
+			"id": "downlight",
+			"emission": map[string]interface{}{
+				"type":         "constant",
+				"radiance":     []interface{}{2.0, 2.0, 2.0},
+				"distribution": map[string]interface{}{"type": "ies", "file": path},
+			},
+		},
+	}}
+	materials, err := ParseMaterials(script)
+	if err != nil {
+		t.Fatalf("ParseMaterials failed: %v", err)
+	}
+	emitter := materials["downlight"].Emission.(emission.SurfaceEmitter)
+	if _, ok := emitter.Distribution.(*emission.Tabulated); !ok {
+		t.Fatalf("expected Tabulated, got %T", emitter.Distribution)
+	}
+	ctx := bxdf.ShadingContext{GeometricNormal: maths.NewDirection(0, 0, 1)}
+	// The peak candela along the nadir receives the full radiance; elsewhere
+	// the candela is spread over the projected area.
+	if got := emitter.Eval(ctx, maths.NewDirection(0, 0, 1)).MaxComponent(); math.Abs(got-2) > 1e-12 {
+		t.Fatalf("nadir radiance = %g, want 2", got)
+	}
+	halfway := maths.NewDirection(math.Sqrt(0.5), 0, math.Sqrt(0.5))
+	if got := emitter.Eval(ctx, halfway).MaxComponent(); math.Abs(got-math.Sqrt2) > 1e-12 {
+		t.Fatalf("45° radiance = %g, want √2", got)
+	}
+	if got := emitter.Eval(ctx, maths.NewDirection(0, 0, -1)).MaxComponent(); got != 0 {
+		t.Fatalf("zenith radiance = %g, want 0", got)
+	}
+
+	script.Materials[0]["emission"].(map[string]interface{})["distribution"] = map[string]interface{}{
+		"type": "ies", "file": path, "sidedness": "front",
+	}
+	if _, err := ParseMaterials(script); err == nil || !strings.Contains(err.Error(), "sidedness") {
+		t.Fatalf("error = %v, want a sidedness error", err)
+	}
+}
+
+func TestIntensityEmissionReproducesTheProfileCandela(t *testing.T) {
+	dir := t.TempDir()
+	script := &parser.Script{Renders: []parser.RenderScript{{Dimension: 3}}}
+	for i, multiplier := range []string{"1", "100"} {
+		// 1000 cd at the nadir falling linearly to the horizon, times the
+		// candela multiplier.
+		path := filepath.Join(dir, multiplier+".ies")
+		profile := "IESNA:LM-63-2002\nTILT=NONE\n1 1000 " + multiplier + " 2 1 1 2 0 0 0\n1 1 20\n0 90\n0\n1000 0\n"
+		if err := os.WriteFile(path, []byte(profile), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		id := "luminaire-" + multiplier
+		script.Materials = append(script.Materials, map[string]interface{}{
+			"id": id,
+			"emission": map[string]interface{}{
+				"type":         "constant",
+				"intensity":    []interface{}{1.0, 1.0, 1.0},
+				"distribution": map[string]interface{}{"type": "ies", "file": path},
+			},
+		})
+		script.Objects = append(script.Objects, map[string]interface{}{
+			"shape": "circle", "material_id": id, "r": 0.5,
+			"center": []interface{}{float64(i), 0.0, 2.0}, "normal": []interface{}{0.0, 0.0, -1.0},
+		})
+	}
+	scene := model.NewScene()
+	if err := LoadSceneFromScript(script, scene); err != nil {
+		t.Fatalf("LoadSceneFromScript failed: %v", err)
+	}
+
+	ctx := bxdf.ShadingContext{GeometricNormal: maths.NewDirection(0, 0, 1)}
+	area := math.Pi / 4
+	for i, multiplier := range []float64{1, 100} {
+		emitter := scene.ObjectTree.Objects[i].Material.Emission.(emission.SurfaceEmitter)
+		if emitter.Area != area {
+			t.Fatalf("emitter area = %g, want %g", emitter.Area, area)
+		}
+		for _, theta := range []float64{0, math.Pi / 6, math.Pi / 3} {
+			wo := maths.NewDirection(math.Sin(theta), 0, math.Cos(theta))
+			got := emitter.Eval(ctx, wo).MaxComponent() * area * math.Cos(theta)
+			if want := multiplier * 1000 * (1 - 2*theta/math.Pi); math.Abs(got-want) > 1e-9*want {
+				t.Fatalf("multiplier %g: intensity at θ = %g is %g cd, want %g", multiplier, theta, got, want)
+			}
+		}
+		flux := multiplier * 2 * math.Pi * 1000 * (1 - 2/math.Pi)
+		if got := emitter.ExitanceEstimate(ctx).MaxComponent() * area; math.Abs(got-flux) > 1e-4*flux {
+			t.Fatalf("multiplier %g: emitted flux = %g lm, want %g", multiplier, got, flux)
+		}
+	}
+
+	script.Materials[0]["emission"].(map[string]interface{})["distribution"] = map[string]interface{}{"type": "uniform"}
+	if _, err := ParseMaterials(script); err == nil || !strings.Contains(err.Error(), "photometric") {
+		t.Fatalf("error = %v, want a photometric distribution error", err)
+	}
+}
+
 func TestParseEmissionRejectsAmbiguousOrInvalidDirection(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -296,3 +401,46 @@ func TestParseCylindricalGridCutout(t *testing.T) {
 		t.Fatal("expected point away from meridians and rings to be a cutout gap")
 	}
 }
+
+func TestParseFluorescentSurfaceFromFileOrInline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "highlighter.csv")
+	table := "# excitation \\ emission\nnm, 500, 600\n400, 0, 0.02\n450, 0, 0.01\n"
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inline := map[string]interface{}{
+		"excitation_nm": []interface{}{400.0, 450.0},
+		"emission_nm":   []interface{}{500.0, 600.0},
+		"values":        []interface{}{[]interface{}{0.0, 0.02}, []interface{}{0.0, 0.01}},
+	}
+	for name, reradiation := range map[string]map[string]interface{}{
+		"file":   {"file": path},
+		"inline": inline,
+	} {
+		script := &parser.Script{Materials: []map[string]interface{}{{
+			"id":      "ink",
+			"surface": map[string]interface{}{"type": "fluorescent", "reflectance": []interface{}{0.2, 0.2, 0.2}, "reradiation": reradiation},
+		}}}
+		materials, err := ParseMaterials(script)
+		if err != nil {
+			t.Fatalf("%s: ParseMaterials failed: %v", name, err)
+		}
+		fluorescent, ok := materials["ink"].Surface.(bsdf.Single).BxDF.(bxdf.Fluorescent)
+		if !ok {
+			t.Fatalf("%s: expected Fluorescent, got %T", name, materials["ink"].Surface)
+		}
+		// The trapezoid between 0.02 and 0.01 over 50 nm.
+		if got := fluorescent.Reradiation.ColumnIntegral(600); math.Abs(got-0.75) > 1e-12 {
+			t.Fatalf("%s: column integral at 600 nm = %g, want 0.75", name, got)
+		}
+	}
+
+	inline["emission_nm"] = []interface{}{600.0, 500.0}
+	script := &parser.Script{Materials: []map[string]interface{}{{
+		"id":      "ink",
+		"surface": map[string]interface{}{"type": "fluorescent", "reradiation": inline},
+	}}}
+	if _, err := ParseMaterials(script); err == nil || !strings.Contains(err.Error(), "increasing") {
+		t.Fatalf("error = %v, want an increasing-wavelength error", err)
+	}
+}
@@ -2,6 +2,8 @@ package factory
 
 import (
 	"fmt"
+	"math"
+
 	"github.com/Algo2147483647/ray/engine/controller/parser"
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"github.com/Algo2147483647/ray/engine/utils"
@@ -24,7 +26,7 @@ func ParseMediaRegistry(script *parser.Script) (*medium.Registry, error) {
 		if !ok {
 			mediumType = "homogeneous"
 		}
-		if mediumType != "homogeneous" {
+		if mediumType != "homogeneous" && mediumType != "heterogeneous" {
 			return nil, fmt.Errorf("%s: unsupported medium type %q", context, mediumType)
 		}
 
@@ -41,11 +43,35 @@ func ParseMediaRegistry(script *parser.Script) (*medium.Registry, error) {
 			return nil, fmt.Errorf("%s sigma_s: %w", context, err)
 		}
 
-		if _, err := registry.RegisterHomogeneousWithCoefficients(
+		phase, err := parseMediumPhase(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", context, err)
+		}
+
+		if mediumType == "heterogeneous" {
+			density, err := parseMediumDensity(def)
+			if err != nil {
+				return nil, fmt.Errorf("%s density: %w", context, err)
+			}
+			if _, err := registry.RegisterHeterogeneous(
+				name,
+				etaModel,
+				spectralCoefficient{parameter: sigmaA},
+				spectralCoefficient{parameter: sigmaS},
+				phase,
+				density,
+			); err != nil {
+				return nil, fmt.Errorf("%s: %w", context, err)
+			}
+			continue
+		}
+
+		if _, err := registry.RegisterHomogeneousWithPhase(
 			name,
 			etaModel,
 			spectralCoefficient{parameter: sigmaA},
 			spectralCoefficient{parameter: sigmaS},
+			phase,
 		); err != nil {
 			return nil, fmt.Errorf("%s: %w", context, err)
 		}
@@ -160,6 +186,39 @@ func parseMediumIORModel(def map[string]interface{}) (medium.Model, error) {
 	}
 }
 
+func parseMediumPhase(def map[string]interface{}) (medium.PhaseFunction, error) {
+	phaseDef, ok, err := utils.OptionalMapField(def, "phase")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return medium.NewIsotropic(), nil
+	}
+
+	phaseType, err := utils.RequiredStringField(phaseDef, "type")
+	if err != nil {
+		return nil, fmt.Errorf("phase: %w", err)
+	}
+	switch phaseType {
+	case "isotropic":
+		return medium.NewIsotropic(), nil
+	case "henyey_greenstein":
+		g, ok, err := utils.OptionalFloat64Field(phaseDef, "g")
+		if err != nil {
+			return nil, fmt.Errorf("phase: %w", err)
+		}
+		if !ok {
+			g = 0
+		}
+		if math.IsNaN(g) || g <= -1 || g >= 1 {
+			return nil, fmt.Errorf("phase g must be in (-1, 1)")
+		}
+		return medium.NewHenyeyGreenstein(g), nil
+	default:
+		return nil, fmt.Errorf("unsupported phase type %q", phaseType)
+	}
+}
+
 type spectralCoefficient struct {
 	parameter optics.SpectralParameter
 }
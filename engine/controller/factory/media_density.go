@@ -0,0 +1,168 @@
+package factory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/utils"
+	"github.com/Algo2147483647/ray/engine/utils/binaryio"
+	"gonum.org/v1/gonum/mat"
+)
+
+// parseMediumDensity reads the density field of a heterogeneous medium:
+//
+//	{"type": "expr", "expr": "...", "constants": {...}, "max_density": 1, "bounds": {...}}
+//	{"type": "grid", "file": "cloud.raw", "resolution": [nx, ny, nz], "format": "float32", "bounds": {...}}
+//
+// Grid files hold nx*ny*nz little-endian values, x fastest, then y, then z.
+func parseMediumDensity(def map[string]interface{}) (medium.DensityField, error) {
+	densityDef, ok, err := utils.OptionalMapField(def, "density")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("field %q is required", "density")
+	}
+	densityType, err := utils.RequiredStringField(densityDef, "type")
+	if err != nil {
+		return nil, err
+	}
+	bounds, err := parseMediumDensityBounds(densityDef)
+	if err != nil {
+		return nil, err
+	}
+
+	switch densityType {
+	case "expr":
+		return parseExprDensity(densityDef, bounds)
+	case "grid":
+		return parseGridDensity(densityDef, bounds)
+	default:
+		return nil, fmt.Errorf("unsupported density type %q", densityType)
+	}
+}
+
+func parseMediumDensityBounds(densityDef map[string]interface{}) (medium.Bounds, error) {
+	boundsDef, ok, err := utils.OptionalMapField(densityDef, "bounds")
+	if err != nil {
+		return medium.Bounds{}, err
+	}
+	if !ok {
+		return medium.Bounds{}, fmt.Errorf("field %q is required", "bounds")
+	}
+	minimum, err := utils.RequiredFloat64SliceField(boundsDef, "min", 3)
+	if err != nil {
+		return medium.Bounds{}, fmt.Errorf("bounds: %w", err)
+	}
+	maximum, err := utils.RequiredFloat64SliceField(boundsDef, "max", 3)
+	if err != nil {
+		return medium.Bounds{}, fmt.Errorf("bounds: %w", err)
+	}
+	var bounds medium.Bounds
+	copy(bounds.Min[:], minimum)
+	copy(bounds.Max[:], maximum)
+	return bounds, nil
+}
+
+func parseExprDensity(densityDef map[string]interface{}, bounds medium.Bounds) (medium.DensityField, error) {
+	source, err := utils.RequiredStringField(densityDef, "expr")
+	if err != nil {
+		return nil, err
+	}
+	constants, err := parseImplicitExprConstants(densityDef)
+	if err != nil {
+		return nil, err
+	}
+	program, err := compileImplicitExprProgram("expr", source, constants)
+	if err != nil {
+		return nil, err
+	}
+	maxDensity, err := utils.RequiredFloat64Field(densityDef, "max_density")
+	if err != nil {
+		return nil, err
+	}
+
+	pool := newExprEnvPool(constants, "x", "y", "z")
+	evaluate := func(point *mat.VecDense) float64 {
+		env := pool.get(point.AtVec(0), point.AtVec(1), point.AtVec(2))
+		value := runImplicitExprProgram(program, env)
+		pool.put(env)
+		return value
+	}
+	return medium.NewExpressionDensity(evaluate, maxDensity, bounds)
+}
+
+// maxDensityGridCells bounds the cells of a density grid, so a malformed
+// resolution cannot overflow the cell count or exhaust memory.
+const maxDensityGridCells = 1 << 28
+
+func parseGridDensity(densityDef map[string]interface{}, bounds medium.Bounds) (medium.DensityField, error) {
+	filePath, err := utils.RequiredStringField(densityDef, "file")
+	if err != nil {
+		return nil, err
+	}
+	rawResolution, err := utils.RequiredFloat64SliceField(densityDef, "resolution", 3)
+	if err != nil {
+		return nil, err
+	}
+	var resolution [3]int
+	count := 1
+	for axis, value := range rawResolution {
+		if value < 1 || value != math.Trunc(value) || value > math.MaxInt32 {
+			return nil, fmt.Errorf("resolution[%d] must be a positive integer", axis)
+		}
+		resolution[axis] = int(value)
+		if count > maxDensityGridCells/resolution[axis] {
+			return nil, fmt.Errorf("resolution %v exceeds %d grid cells", rawResolution, maxDensityGridCells)
+		}
+		count *= resolution[axis]
+	}
+	format, ok, err := utils.OptionalStringField(densityDef, "format")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		format = "float32"
+	}
+
+	values, err := readDensityGridFile(filePath, format, count)
+	if err != nil {
+		return nil, err
+	}
+	return medium.NewGridDensity(resolution, values, bounds)
+}
+
+func readDensityGridFile(filePath, format string, count int) ([]float64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open density grid %q: %w", filePath, err)
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	values := make([]float64, count)
+	switch format {
+	case "float32":
+		raw := make([]float32, count)
+		if err := binary.Read(r, binary.LittleEndian, raw); err != nil {
+			return nil, fmt.Errorf("read density grid %q: %w", filePath, err)
+		}
+		for i, value := range raw {
+			values[i] = float64(value)
+		}
+	case "float64":
+		if err := binaryio.ReadFloat64s(r, binary.LittleEndian, values, make([]byte, 64*1024)); err != nil {
+			return nil, fmt.Errorf("read density grid %q: %w", filePath, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported density grid format %q", format)
+	}
+	if err := binaryio.RequireEOF(r); err != nil {
+		return nil, fmt.Errorf("read density grid %q: %w", filePath, err)
+	}
+	return values, nil
+}
@@ -1,10 +1,16 @@
 package factory
 
 import (
+	"encoding/binary"
 	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Algo2147483647/ray/engine/controller/parser"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"gonum.org/v1/gonum/mat"
 )
 
 type mediaTestWavelengthContext struct {
@@ -89,3 +95,128 @@ func TestParseMediaRegistryEvaluatesSampledAbsorptionAtWavelength(t *testing.T)
 		t.Fatalf("expected interpolated sampled sigma_a of 0.3, got %+v", sigmaA)
 	}
 }
+
+func TestParseMediaRegistryPhaseFunction(t *testing.T) {
+	script := &parser.Script{
+		Media: map[string]map[string]interface{}{
+			"haze": {
+				"sigma_s": []interface{}{0.1, 0.1, 0.1},
+				"phase": map[string]interface{}{
+					"type": "henyey_greenstein",
+					"g":    0.6,
+				},
+			},
+			"smoke": {
+				"sigma_s": []interface{}{0.2, 0.2, 0.2},
+			},
+		},
+	}
+
+	registry, err := ParseMediaRegistry(script)
+	if err != nil {
+		t.Fatalf("ParseMediaRegistry failed: %v", err)
+	}
+	hazeID, _ := registry.ID("haze")
+	hg, ok := registry.Phase(hazeID).(medium.HenyeyGreenstein)
+	if !ok || math.Abs(hg.G-0.6) > 1e-12 {
+		t.Fatalf("expected Henyey-Greenstein phase with g=0.6, got %#v", registry.Phase(hazeID))
+	}
+	smokeID, _ := registry.ID("smoke")
+	if _, ok := registry.Phase(smokeID).(medium.Isotropic); !ok {
+		t.Fatalf("expected isotropic default phase, got %#v", registry.Phase(smokeID))
+	}
+
+	script.Media["haze"]["phase"] = map[string]interface{}{"type": "henyey_greenstein", "g": 1.0}
+	if _, err := ParseMediaRegistry(script); err == nil {
+		t.Fatal("expected |g| >= 1 to be rejected")
+	}
+}
+
+func TestParseMediaRegistryHeterogeneousExpressionDensity(t *testing.T) {
+	script := &parser.Script{
+		Media: map[string]map[string]interface{}{
+			"plume": {
+				"type":    "heterogeneous",
+				"sigma_s": []interface{}{1.0, 1.0, 1.0},
+				"density": map[string]interface{}{
+					"type":        "expr",
+					"expr":        "k * z",
+					"constants":   map[string]interface{}{"k": 2.0},
+					"max_density": 2.0,
+					"bounds": map[string]interface{}{
+						"min": []interface{}{-1.0, -1.0, 0.0},
+						"max": []interface{}{1.0, 1.0, 1.0},
+					},
+				},
+			},
+		},
+	}
+
+	registry, err := ParseMediaRegistry(script)
+	if err != nil {
+		t.Fatalf("ParseMediaRegistry failed: %v", err)
+	}
+	id, _ := registry.ID("plume")
+	density := registry.Density(id)
+	if density == nil {
+		t.Fatal("expected a density field")
+	}
+	if got := density.Density(mat.NewVecDense(3, []float64{0, 0, 0.25})); math.Abs(got-0.5) > 1e-12 {
+		t.Fatalf("density = %g, want 0.5", got)
+	}
+	if got := density.Density(mat.NewVecDense(3, []float64{0, 0, 2})); got != 0 {
+		t.Fatalf("density outside bounds = %g, want 0", got)
+	}
+
+	delete(script.Media["plume"]["density"].(map[string]interface{}), "max_density")
+	if _, err := ParseMediaRegistry(script); err == nil {
+		t.Fatal("expected a missing max_density to be rejected")
+	}
+}
+
+func TestParseMediaRegistryHeterogeneousGridDensity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloud.raw")
+	values := []float32{0, 1, 2, 3, 4, 5, 6, 7}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := binary.Write(file, binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	densityDef := map[string]interface{}{
+		"type":       "grid",
+		"file":       path,
+		"resolution": []interface{}{2.0, 2.0, 2.0},
+		"bounds": map[string]interface{}{
+			"min": []interface{}{0.0, 0.0, 0.0},
+			"max": []interface{}{2.0, 2.0, 2.0},
+		},
+	}
+	script := &parser.Script{
+		Media: map[string]map[string]interface{}{
+			"cloud": {"type": "heterogeneous", "density": densityDef},
+		},
+	}
+	registry, err := ParseMediaRegistry(script)
+	if err != nil {
+		t.Fatalf("ParseMediaRegistry failed: %v", err)
+	}
+	id, _ := registry.ID("cloud")
+	// Voxel (1, 0, 1) has its center at (1.5, 0.5, 1.5) and stores value 5.
+	if got := registry.Density(id).Density(mat.NewVecDense(3, []float64{1.5, 0.5, 1.5})); math.Abs(got-5) > 1e-12 {
+		t.Fatalf("grid density = %g, want 5", got)
+	}
+
+	densityDef["resolution"] = []interface{}{2.0, 2.0, 3.0}
+	if _, err := ParseMediaRegistry(script); err == nil {
+		t.Fatal("expected a truncated grid file to be rejected")
+	}
+
+	densityDef["resolution"] = []interface{}{65536.0, 65536.0, 65536.0}
+	if _, err := ParseMediaRegistry(script); err == nil || !strings.Contains(err.Error(), "grid cells") {
+		t.Fatalf("expected an oversized grid resolution to be rejected, got %v", err)
+	}
+}
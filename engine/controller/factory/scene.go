@@ -10,7 +10,10 @@ import (
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
 	"github.com/Algo2147483647/ray/engine/model"
 	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
+	modelmaterial "github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
 	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/shape"
 	"github.com/Algo2147483647/ray/engine/utils"
 )
 
@@ -79,7 +82,8 @@ func LoadSceneFromScript(script *parser.Script, scene *model.Scene) error {
 
 	for idx, item := range script.Objects {
 		objectLabel := fmt.Sprintf("object[%d]", idx)
-		if objectID, ok, err := utils.OptionalStringField(item, "id"); err == nil && ok && objectID != "" {
+		objectID, ok, err := utils.OptionalStringField(item, "id")
+		if err == nil && ok && objectID != "" {
 			objectLabel = fmt.Sprintf("object[%d] id=%q", idx, objectID)
 		} else if err != nil {
 			parseErrors = append(parseErrors, fmt.Errorf("%s: %w", objectLabel, err))
@@ -112,8 +116,15 @@ func LoadSceneFromScript(script *parser.Script, scene *model.Scene) error {
 			continue
 		}
 
+		material, err = bindEmissionArea(material, shapes)
+		if err != nil {
+			parseErrors = append(parseErrors, fmt.Errorf("%s: %w", objectLabel, err))
+			continue
+		}
+
 		for _, shape := range shapes {
 			scene.ObjectTree.AddObject(&object.Object{
+				ID:             objectID,
 				Shape:          shape,
 				Material:       material,
 				MediumBoundary: mediumBoundary,
@@ -121,6 +132,13 @@ func LoadSceneFromScript(script *parser.Script, scene *model.Scene) error {
 		}
 	}
 
+	infiniteLights, deltaLights, err := ParseLights(script, scene.Geometry, dimension)
+	if err != nil {
+		parseErrors = append(parseErrors, err)
+	}
+	scene.ObjectTree.InfiniteLights = infiniteLights
+	scene.ObjectTree.DeltaLights = deltaLights
+
 	cameras, err := ParseCameras(script)
 	if err != nil {
 		parseErrors = append(parseErrors, err)
@@ -136,6 +154,28 @@ func LoadSceneFromScript(script *parser.Script, scene *model.Scene) error {
 	return nil
 }
 
+// bindEmissionArea gives a luminous-intensity emitter the surface area of the
+// object it lights, since the luminaire's flux spreads over all its shapes.
+// Other materials are shared between objects unchanged.
+func bindEmissionArea(material *modelmaterial.Material, shapes []shape.Shape) (*modelmaterial.Material, error) {
+	emitter, ok := material.Emission.(emission.SurfaceEmitter)
+	if !ok || emitter.Quantity != emission.LuminousIntensity {
+		return material, nil
+	}
+	area := 0.0
+	for _, s := range shapes {
+		if sampler, ok := s.(shape.SurfaceSampler); ok {
+			area += sampler.SurfaceArea()
+		}
+	}
+	if !(area > 0) || math.IsInf(area, 0) {
+		return nil, fmt.Errorf("intensity emission needs a shape with a finite surface area")
+	}
+	bound := *material
+	bound.Emission = emitter.WithArea(area)
+	return &bound, nil
+}
+
 func renderDimension(renders []parser.RenderScript) (int, error) {
 	dimension := 3
 	for i, render := range renders {
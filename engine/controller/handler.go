@@ -1,10 +1,16 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"time"
 
 	"github.com/Algo2147483647/ray/engine/controller/parser"
+	"github.com/Algo2147483647/ray/engine/event"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"github.com/Algo2147483647/ray/engine/model"
 	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/ray_tracing"
@@ -12,6 +18,8 @@ import (
 
 type Handler struct {
 	err        error
+	ctx        context.Context
+	Events     event.Sink
 	Scene      *model.Scene
 	Script     *parser.Script
 	ScriptPath string
@@ -21,24 +29,51 @@ type Handler struct {
 
 func NewHandler() *Handler {
 	return &Handler{
-		Scene: model.NewScene(),
+		ctx:    context.Background(),
+		Events: event.NewTextSink(os.Stdout),
+		Scene:  model.NewScene(),
 	}
 }
 
 func Run(args []string) int {
+	return RunWithEvents(args, nil)
+}
+
+// RunWithEvents is Run reporting to events instead of the sink the --events
+// flag selects, when events is not nil.
+func RunWithEvents(args []string, events event.Sink) int {
+	// The first interrupt stops the render at its next tile or pass and saves
+	// the partial Film; a second one ends the process as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	h := NewHandler().
-		ParseArgs(args).
-		LoadScript().
-		Renders()
+		WithContext(ctx).
+		ParseArgs(args)
+	if events != nil {
+		h.Events = events
+	}
+	h.LoadScript().Renders()
 	if h.err != nil {
-		fmt.Printf("Error: %v\n", h.err)
+		event.Error(h.Events, h.err)
 		return 1
 	}
 
-	fmt.Println("Ray tracing completed successfully")
+	h.Events.Emit(event.Event{Kind: event.KindDone})
 	return 0
 }
 
+// WithContext makes ctx stop the renders; a stopped render still saves its
+// partial Film, and the renders after it are skipped.
+func (h *Handler) WithContext(ctx context.Context) *Handler {
+	h.ctx = ctx
+	return h
+}
+
 func (h *Handler) Renders() *Handler {
 	if h.err != nil {
 		return h
@@ -50,7 +85,7 @@ func (h *Handler) Renders() *Handler {
 	}
 
 	for idx, render := range h.Script.Renders {
-		fmt.Printf("Starting render job %d/%d\n", idx+1, len(h.Script.Renders))
+		h.Events.Emit(event.Event{Kind: event.KindJobStart, Job: idx + 1, Jobs: len(h.Script.Renders)})
 
 		context := mergeRenderContext(defaultRenderContext(), renderScriptContext(render))
 		h.ConfigureRenderContext(context).
@@ -59,6 +94,10 @@ func (h *Handler) Renders() *Handler {
 		if h.err != nil {
 			return h
 		}
+		if err := h.ctx.Err(); err != nil {
+			h.err = fmt.Errorf("render interrupted: %w", err)
+			return h
+		}
 	}
 	return h
 }
@@ -80,7 +119,7 @@ func (h *Handler) Render() *Handler {
 	}
 	film.Reset()
 
-	fmt.Printf("Starting rendering (integrator: %s)...\n", h.Context.Integrator)
+	h.Events.Emit(event.Event{Kind: event.KindRenderStart, Integrator: h.Context.Integrator})
 	start := time.Now()
 
 	var err error
@@ -92,21 +131,67 @@ func (h *Handler) Render() *Handler {
 		return h
 	}
 	renderHandler.ThreadNum = h.Context.ThreadNum
+	renderHandler.Seed = h.Context.Seed
+	renderHandler.SamplerKind, err = sampler.ParseKind(h.Context.Sampler)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	renderHandler.Filter, err = camera.ParseFilterKind(h.Context.Filter)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	renderHandler.FilterRadius = h.Context.FilterRadius
+	renderHandler.AOVs = nil
+	for _, name := range h.Context.AOVs {
+		kind, err := camera.ParseAOVKind(name)
+		if err != nil {
+			h.err = err
+			return h
+		}
+		renderHandler.AOVs = append(renderHandler.AOVs, kind)
+	}
+	renderHandler.AORadius = h.Context.AORadius
+	renderHandler.AdaptiveRelativeError = h.Context.AdaptiveRelativeError
+	renderHandler.AdaptiveMinSamples = h.Context.AdaptiveMinSamples
+	renderHandler.AdaptiveMaxSamples = h.Context.AdaptiveMaxSamples
+	renderHandler.PathGuiding = h.Context.PathGuiding
+	renderHandler.PathGuidingTrainingSamples = h.Context.PathGuidingTrainingSamples
+	renderHandler.Polarized = h.Context.Polarized
 	renderHandler.SpectrumMode = renderSpectrumMode(h.Context.SpectrumMode)
 	renderHandler.WavelengthSamples = h.Context.WavelengthSamples
 	renderHandler.BDPTFallbackPolicy = ray_tracing.BDPTFallbackPolicy(h.Context.BDPTFallbackPolicy)
+	renderHandler.SPPMPhotonsPerPass = h.Context.SPPMPhotonsPerPass
+	renderHandler.SPPMInitialRadius = h.Context.SPPMInitialRadius
+	renderHandler.PSSMLTSeed = h.Context.PSSMLTSeed
+	renderHandler.PSSMLTChains = h.Context.PSSMLTChains
+	renderHandler.PSSMLTBootstrapSamples = h.Context.PSSMLTBootstrapSamples
+	renderHandler.PSSMLTLargeStepProbability = h.Context.PSSMLTLargeStepProbability
+	renderHandler.VCMInitialRadius = h.Context.VCMInitialRadius
+	renderHandler.TimeBudget = h.Context.TimeBudget
+	renderHandler.Events = h.Events
 	renderHandler.SceneGeometry = h.Scene.Geometry
 	renderHandler.MaxArc = h.Scene.MaxArc
-	if err := renderHandler.TraceScene(
+	err = renderHandler.TraceSceneContext(
+		h.ctx,
 		h.Camera,
 		h.Scene.ObjectTree,
 		h.Context.Samples,
-	); err != nil {
+	)
+	if err != nil && !errors.Is(err, h.ctx.Err()) {
 		h.err = err
 		return h
 	}
-
-	fmt.Printf("Rendering completed in %v\n", time.Since(start))
+	// A stopped Film is normalized and counts its samples, so it is saved
+	// like a finished one.
+	h.Events.Emit(event.Event{
+		Kind:       event.KindRenderEnd,
+		Integrator: string(renderHandler.LastEffectiveIntegrator),
+		Samples:    film.Samples,
+		Elapsed:    time.Since(start),
+		Stopped:    err != nil,
+	})
 	return h
 }
 
@@ -120,6 +205,7 @@ func (h *Handler) SaveFilm(filename string) *Handler {
 		h.err = err
 		return h
 	}
+	h.Events.Emit(event.Event{Kind: event.KindFilmSave, Path: filename})
 
 	return h
 }
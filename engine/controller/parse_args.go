@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"github.com/Algo2147483647/ray/engine/controller/factory"
 	"github.com/Algo2147483647/ray/engine/controller/parser"
+	"github.com/Algo2147483647/ray/engine/event"
 	"io"
+	"os"
 )
 
 func (h *Handler) ParseArgs(args []string) *Handler {
@@ -18,12 +20,20 @@ func (h *Handler) ParseArgs(args []string) *Handler {
 	flagSet := flag.NewFlagSet("ray", flag.ContinueOnError)
 	flagSet.SetOutput(io.Discard)
 	flagSet.Var(&scriptPaths, "script", "path to a canonical scene script")
+	events := flagSet.String("events", event.FormatText, "event output: text, json, or silent")
 
 	if err := flagSet.Parse(args); err != nil {
 		h.err = err
 		return h
 	}
 
+	sink, err := event.NewSink(*events, os.Stdout)
+	if err != nil {
+		h.err = err
+		return h
+	}
+	h.Events = sink
+
 	scriptPaths = append(scriptPaths, flagSet.Args()...)
 	if len(scriptPaths) == 0 {
 		scriptPaths = append(scriptPaths, defaultScriptPath)
@@ -41,7 +51,7 @@ func (h *Handler) LoadScript() *Handler {
 		return h
 	}
 
-	fmt.Printf("Loading scene from: %s\n", h.ScriptPath)
+	h.Events.Emit(event.Event{Kind: event.KindSceneLoad, Path: h.ScriptPath})
 
 	script, err := parser.ReadScriptFile(h.ScriptPath)
 	if err != nil {
@@ -8,6 +8,7 @@ type Script struct {
 	Materials []map[string]interface{}          `json:"materials"`
 	Media     map[string]map[string]interface{} `json:"media"`
 	Objects   []map[string]interface{}          `json:"objects"`
+	Lights    []map[string]interface{}          `json:"lights"`
 	Cameras   []CameraScript                    `json:"cameras"`
 	Geometry  *GeometryScript                   `json:"geometry"`
 	Renders   []RenderScript                    `json:"renders"`
@@ -24,14 +25,34 @@ type CameraScript struct {
 }
 
 type RenderScript struct {
-	Integrator         string `json:"integrator"`
-	BDPTFallbackPolicy string `json:"bdpt_fallback_policy,omitempty"`
-	Dimension          int    `json:"dimension"`
-	Samples            int64  `json:"samples"`
-	ThreadNum          int    `json:"thread_num"`
-	CameraID           string `json:"camera_id"`
-	SpectrumMode       string `json:"spectrum_mode"`
-	WavelengthSamples  int    `json:"wavelength_samples"`
+	Integrator                 string   `json:"integrator"`
+	BDPTFallbackPolicy         string   `json:"bdpt_fallback_policy,omitempty"`
+	Dimension                  int      `json:"dimension"`
+	Samples                    int64    `json:"samples"`
+	Seed                       uint64   `json:"seed,omitempty"`
+	Sampler                    string   `json:"sampler,omitempty"`
+	Filter                     string   `json:"filter,omitempty"`
+	FilterRadius               float64  `json:"filter_radius,omitempty"`
+	AOVs                       []string `json:"aovs,omitempty"`
+	AORadius                   float64  `json:"ao_radius,omitempty"`
+	AdaptiveRelativeError      float64  `json:"adaptive_relative_error,omitempty"`
+	AdaptiveMinSamples         int64    `json:"adaptive_min_samples,omitempty"`
+	AdaptiveMaxSamples         int64    `json:"adaptive_max_samples,omitempty"`
+	PathGuiding                bool     `json:"path_guiding,omitempty"`
+	PathGuidingTrainingSamples int64    `json:"path_guiding_training_samples,omitempty"` // 0 ⇒ a quarter of samples
+	Polarized                  bool     `json:"polarized,omitempty"`
+	ThreadNum                  int      `json:"thread_num"`
+	CameraID                   string   `json:"camera_id"`
+	SpectrumMode               string   `json:"spectrum_mode"`
+	WavelengthSamples          int      `json:"wavelength_samples"`
+	SPPMPhotonsPerPass         int64    `json:"sppm_photons_per_pass,omitempty"`
+	SPPMInitialRadius          float64  `json:"sppm_initial_radius,omitempty"`
+	PSSMLTSeed                 uint64   `json:"pssmlt_seed,omitempty"`
+	PSSMLTChains               int64    `json:"pssmlt_chains,omitempty"`
+	PSSMLTBootstrapSamples     int64    `json:"pssmlt_bootstrap_samples,omitempty"`
+	PSSMLTLargeStepProbability float64  `json:"pssmlt_large_step_probability,omitempty"`
+	VCMInitialRadius           float64  `json:"vcm_initial_radius,omitempty"`
+	TimeBudget                 float64  `json:"time_budget,omitempty"` // seconds to keep adding sample passes; 0 ⇒ one pass
 }
 
 type GeometryScript struct {
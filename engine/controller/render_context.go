@@ -15,15 +15,35 @@ const (
 )
 
 type RenderContext struct {
-	Integrator         string
-	BDPTFallbackPolicy string
-	Dimension          int
-	CameraID           string
-	ThreadNum          int
-	Samples            int64
-	OutputFilm         string
-	SpectrumMode       string
-	WavelengthSamples  int
+	Integrator                 string
+	BDPTFallbackPolicy         string
+	Dimension                  int
+	CameraID                   string
+	ThreadNum                  int
+	Samples                    int64
+	Seed                       uint64
+	Sampler                    string
+	Filter                     string
+	FilterRadius               float64
+	AOVs                       []string
+	AORadius                   float64
+	AdaptiveRelativeError      float64
+	AdaptiveMinSamples         int64
+	AdaptiveMaxSamples         int64
+	PathGuiding                bool
+	PathGuidingTrainingSamples int64
+	Polarized                  bool
+	OutputFilm                 string
+	SpectrumMode               string
+	WavelengthSamples          int
+	SPPMPhotonsPerPass         int64
+	SPPMInitialRadius          float64
+	PSSMLTSeed                 uint64
+	PSSMLTChains               int64
+	PSSMLTBootstrapSamples     int64
+	PSSMLTLargeStepProbability float64
+	VCMInitialRadius           float64
+	TimeBudget                 float64
 }
 
 func defaultRenderContext() RenderContext {
@@ -39,14 +59,34 @@ func defaultRenderContext() RenderContext {
 
 func renderScriptContext(render parser.RenderScript) RenderContext {
 	return RenderContext{
-		Integrator:         render.Integrator,
-		BDPTFallbackPolicy: render.BDPTFallbackPolicy,
-		Dimension:          render.Dimension,
-		CameraID:           render.CameraID,
-		ThreadNum:          render.ThreadNum,
-		Samples:            render.Samples,
-		SpectrumMode:       render.SpectrumMode,
-		WavelengthSamples:  render.WavelengthSamples,
+		Integrator:                 render.Integrator,
+		BDPTFallbackPolicy:         render.BDPTFallbackPolicy,
+		Dimension:                  render.Dimension,
+		CameraID:                   render.CameraID,
+		ThreadNum:                  render.ThreadNum,
+		Samples:                    render.Samples,
+		Seed:                       render.Seed,
+		Sampler:                    render.Sampler,
+		Filter:                     render.Filter,
+		FilterRadius:               render.FilterRadius,
+		AOVs:                       render.AOVs,
+		AORadius:                   render.AORadius,
+		AdaptiveRelativeError:      render.AdaptiveRelativeError,
+		AdaptiveMinSamples:         render.AdaptiveMinSamples,
+		AdaptiveMaxSamples:         render.AdaptiveMaxSamples,
+		PathGuiding:                render.PathGuiding,
+		PathGuidingTrainingSamples: render.PathGuidingTrainingSamples,
+		Polarized:                  render.Polarized,
+		SpectrumMode:               render.SpectrumMode,
+		WavelengthSamples:          render.WavelengthSamples,
+		SPPMPhotonsPerPass:         render.SPPMPhotonsPerPass,
+		SPPMInitialRadius:          render.SPPMInitialRadius,
+		PSSMLTSeed:                 render.PSSMLTSeed,
+		PSSMLTChains:               render.PSSMLTChains,
+		PSSMLTBootstrapSamples:     render.PSSMLTBootstrapSamples,
+		PSSMLTLargeStepProbability: render.PSSMLTLargeStepProbability,
+		VCMInitialRadius:           render.VCMInitialRadius,
+		TimeBudget:                 render.TimeBudget,
 	}
 }
 
@@ -71,12 +111,72 @@ func mergeRenderContext(base, override RenderContext) RenderContext {
 	if override.Samples > 0 {
 		base.Samples = override.Samples
 	}
+	if override.Seed > 0 {
+		base.Seed = override.Seed
+	}
+	if override.Sampler != "" {
+		base.Sampler = override.Sampler
+	}
+	if override.Filter != "" {
+		base.Filter = override.Filter
+	}
+	if override.FilterRadius > 0 {
+		base.FilterRadius = override.FilterRadius
+	}
+	if len(override.AOVs) > 0 {
+		base.AOVs = override.AOVs
+	}
+	if override.AORadius > 0 {
+		base.AORadius = override.AORadius
+	}
+	if override.AdaptiveRelativeError > 0 {
+		base.AdaptiveRelativeError = override.AdaptiveRelativeError
+	}
+	if override.AdaptiveMinSamples > 0 {
+		base.AdaptiveMinSamples = override.AdaptiveMinSamples
+	}
+	if override.AdaptiveMaxSamples > 0 {
+		base.AdaptiveMaxSamples = override.AdaptiveMaxSamples
+	}
+	if override.PathGuiding {
+		base.PathGuiding = true
+	}
+	if override.PathGuidingTrainingSamples > 0 {
+		base.PathGuidingTrainingSamples = override.PathGuidingTrainingSamples
+	}
+	if override.Polarized {
+		base.Polarized = true
+	}
 	if override.SpectrumMode != "" {
 		base.SpectrumMode = override.SpectrumMode
 	}
 	if override.WavelengthSamples > 0 {
 		base.WavelengthSamples = override.WavelengthSamples
 	}
+	if override.SPPMPhotonsPerPass > 0 {
+		base.SPPMPhotonsPerPass = override.SPPMPhotonsPerPass
+	}
+	if override.SPPMInitialRadius > 0 {
+		base.SPPMInitialRadius = override.SPPMInitialRadius
+	}
+	if override.PSSMLTSeed > 0 {
+		base.PSSMLTSeed = override.PSSMLTSeed
+	}
+	if override.PSSMLTChains > 0 {
+		base.PSSMLTChains = override.PSSMLTChains
+	}
+	if override.PSSMLTBootstrapSamples > 0 {
+		base.PSSMLTBootstrapSamples = override.PSSMLTBootstrapSamples
+	}
+	if override.PSSMLTLargeStepProbability > 0 {
+		base.PSSMLTLargeStepProbability = override.PSSMLTLargeStepProbability
+	}
+	if override.VCMInitialRadius > 0 {
+		base.VCMInitialRadius = override.VCMInitialRadius
+	}
+	if override.TimeBudget > 0 {
+		base.TimeBudget = override.TimeBudget
+	}
 	return base
 }
 
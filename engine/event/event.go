@@ -0,0 +1,99 @@
+// Package event reports what a render is doing. The controller, the render
+// drivers and Studio describe their progress as Events and hand them to a
+// Sink, which prints them for a terminal, encodes them for other programs,
+// or drops them.
+package event
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Kind is the serialized name of an Event.
+type Kind string
+
+const (
+	KindSceneLoad   Kind = "scene_load"   // Path is the scene script
+	KindJobStart    Kind = "job_start"    // Job of Jobs
+	KindRenderStart Kind = "render_start" // Integrator as configured
+	KindProgress    Kind = "progress"     // Completed of Total Unit in Stage
+	KindProgressEnd Kind = "progress_end" // Stage finished or stopped at Completed
+	KindPassEnd     Kind = "pass_end"     // time-budget Pass merged; Samples so far
+	KindFallback    Kind = "fallback"     // Requested ran as Integrator because of Message
+	KindWarning     Kind = "warning"
+	KindRenderEnd   Kind = "render_end" // Samples in Elapsed; Stopped when cut short
+	KindFilmSave    Kind = "film_save"  // Path is the saved Film
+	KindInfo        Kind = "info"
+	KindError       Kind = "error"
+	KindDone        Kind = "done"
+)
+
+// Event is one report. Only the fields its Kind documents are set.
+type Event struct {
+	Kind       Kind          `json:"kind"`
+	Time       time.Time     `json:"time"`
+	Job        int           `json:"job,omitempty"`
+	Jobs       int           `json:"jobs,omitempty"`
+	Pass       int           `json:"pass,omitempty"`
+	Integrator string        `json:"integrator,omitempty"`
+	Requested  string        `json:"requested,omitempty"`
+	Stage      string        `json:"stage,omitempty"`
+	Unit       string        `json:"unit,omitempty"`
+	Completed  int64         `json:"completed,omitempty"`
+	Total      int64         `json:"total,omitempty"`
+	Samples    int64         `json:"samples,omitempty"`
+	Elapsed    time.Duration `json:"elapsed_ns,omitempty"`
+	Stopped    bool          `json:"stopped,omitempty"`
+	Path       string        `json:"path,omitempty"`
+	Message    string        `json:"message,omitempty"`
+}
+
+// Sink receives Events. Emit may be called from several goroutines at once.
+type Sink interface {
+	Emit(Event)
+}
+
+// SinkFunc adapts a function to a Sink. The function must be safe for
+// concurrent calls.
+type SinkFunc func(Event)
+
+func (f SinkFunc) Emit(e Event) { f(e) }
+
+// Discard drops every Event.
+var Discard Sink = discard{}
+
+type discard struct{}
+
+func (discard) Emit(Event) {}
+
+// Sink formats accepted by NewSink.
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatSilent = "silent"
+)
+
+// NewSink returns the Sink of format writing to w; "" is text.
+func NewSink(format string, w io.Writer) (Sink, error) {
+	switch format {
+	case "", FormatText:
+		return NewTextSink(w), nil
+	case FormatJSON:
+		return NewJSONSink(w), nil
+	case FormatSilent:
+		return Discard, nil
+	default:
+		return nil, fmt.Errorf("unsupported event format %q", format)
+	}
+}
+
+// Infof emits an info Event with a formatted message.
+func Infof(sink Sink, format string, args ...any) {
+	sink.Emit(Event{Kind: KindInfo, Message: fmt.Sprintf(format, args...)})
+}
+
+// Error emits an error Event for err.
+func Error(sink Sink, err error) {
+	sink.Emit(Event{Kind: KindError, Message: err.Error()})
+}
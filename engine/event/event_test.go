@@ -0,0 +1,63 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextSinkEndsProgressLineBeforeOtherEvents(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewTextSink(&out)
+	sink.Emit(Event{Kind: KindJobStart, Job: 1, Jobs: 2})
+	sink.Emit(Event{Kind: KindProgress, Stage: "Rendering", Unit: "pixels", Completed: 16, Total: 64})
+	sink.Emit(Event{Kind: KindWarning, Message: "no light"})
+	sink.Emit(Event{Kind: KindProgressEnd, Stage: "Rendering", Unit: "pixels", Completed: 64, Total: 64, Elapsed: 2 * time.Second})
+
+	want := "Starting render job 1/2\n" +
+		"\rRendering: 16/64 pixels (25.00%) Time: 0s\n" +
+		"Warning: no light\n" +
+		"\rRendering complete: 64/64 pixels (100.00%) Time: 2s\n"
+	if got := out.String(); got != want {
+		t.Fatalf("text output = %q, want %q", got, want)
+	}
+}
+
+func TestJSONSinkWritesOneStampedEventPerLine(t *testing.T) {
+	var out bytes.Buffer
+	sink, err := NewSink(FormatJSON, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Emit(Event{Kind: KindFallback, Requested: "bdpt", Integrator: "path", Message: "unsupported emitter"})
+	sink.Emit(Event{Kind: KindRenderEnd, Samples: 16, Elapsed: time.Second})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("JSON output has %d lines, want 2: %q", len(lines), out.String())
+	}
+	var fallback, end Event
+	if err := json.Unmarshal([]byte(lines[0]), &fallback); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &end); err != nil {
+		t.Fatal(err)
+	}
+	if fallback.Kind != KindFallback || fallback.Requested != "bdpt" || fallback.Integrator != "path" || fallback.Time.IsZero() {
+		t.Fatalf("decoded fallback = %+v", fallback)
+	}
+	if end.Samples != 16 || end.Elapsed != time.Second {
+		t.Fatalf("decoded render end = %+v", end)
+	}
+}
+
+func TestNewSinkRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewSink("xml", &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an unknown event format to be rejected")
+	}
+	if sink, err := NewSink(FormatSilent, nil); err != nil || sink != Discard {
+		t.Fatalf("silent sink = %v, %v", sink, err)
+	}
+}
@@ -0,0 +1,30 @@
+package event
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonSink writes every Event as one line of JSON.
+type jsonSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewJSONSink returns a Sink that writes JSON lines to w, stamping Events
+// without a time with the current one.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{encoder: json.NewEncoder(w)}
+}
+
+func (s *jsonSink) Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// A failed write cannot be reported anywhere better than the writer.
+	_ = s.encoder.Encode(e)
+}
@@ -0,0 +1,84 @@
+package event
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// textSink prints Events as terminal lines. Progress redraws one line with a
+// carriage return, which a later Event ends first.
+type textSink struct {
+	lock     sync.Mutex
+	w        io.Writer
+	midLine  bool
+	progress string
+}
+
+// NewTextSink returns a Sink that prints human-readable lines to w.
+func NewTextSink(w io.Writer) Sink {
+	return &textSink{w: w}
+}
+
+func (s *textSink) Emit(e Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if e.Kind == KindProgress {
+		fmt.Fprintf(s.w, "\r%s: %d/%d %s (%.2f%%) Time: %v", e.Stage, e.Completed, e.Total, e.Unit, percent(e), e.Elapsed.Round(time.Second))
+		s.midLine = true
+		return
+	}
+	if s.midLine && e.Kind != KindProgressEnd {
+		fmt.Fprintln(s.w)
+	}
+	s.midLine = false
+	if line := textLine(e); line != "" {
+		fmt.Fprintln(s.w, line)
+	}
+}
+
+func textLine(e Event) string {
+	switch e.Kind {
+	case KindSceneLoad:
+		return fmt.Sprintf("Loading scene from: %s", e.Path)
+	case KindJobStart:
+		return fmt.Sprintf("Starting render job %d/%d", e.Job, e.Jobs)
+	case KindRenderStart:
+		return fmt.Sprintf("Starting rendering (integrator: %s)...", e.Integrator)
+	case KindProgressEnd:
+		state := "complete"
+		if e.Completed < e.Total {
+			state = "stopped"
+		}
+		return fmt.Sprintf("\r%s %s: %d/%d %s (%.2f%%) Time: %v", e.Stage, state, e.Completed, e.Total, e.Unit, percent(e), e.Elapsed.Round(time.Second))
+	case KindPassEnd:
+		return fmt.Sprintf("Time budget pass %d merged: %d samples", e.Pass, e.Samples)
+	case KindFallback:
+		return fmt.Sprintf("Falling back from %s to %s: %s", e.Requested, e.Integrator, e.Message)
+	case KindWarning:
+		return "Warning: " + e.Message
+	case KindRenderEnd:
+		if e.Stopped {
+			return fmt.Sprintf("Rendering stopped after %v with %d samples", e.Elapsed, e.Samples)
+		}
+		return fmt.Sprintf("Rendering completed in %v (%d samples)", e.Elapsed, e.Samples)
+	case KindFilmSave:
+		return fmt.Sprintf("Saved Film: %s", e.Path)
+	case KindInfo:
+		return e.Message
+	case KindError:
+		return "Error: " + e.Message
+	case KindDone:
+		return "Ray tracing completed successfully"
+	default:
+		return ""
+	}
+}
+
+func percent(e Event) float64 {
+	if e.Total <= 0 {
+		return 100
+	}
+	return 100 * float64(e.Completed) / float64(e.Total)
+}
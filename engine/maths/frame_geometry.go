@@ -10,29 +10,46 @@ import (
 // n must be an intrinsic tangent-space normal vector (an ambient gradient
 // should first be converted with Geometry.IntrinsicNormal).
 func NewFrameFromNormalInGeometry(g geometry.Geometry, p, n *mat.VecDense) (Frame, bool) {
+	var frame Frame
+	if !frame.SetFromNormalInGeometry(g, p, n) {
+		return Frame{}, false
+	}
+	return frame, true
+}
+
+// SetFromNormalInGeometry rebuilds f as NewFrameFromNormalInGeometry would,
+// reusing the vectors f already holds when their dimension matches. The
+// previous vectors of f are overwritten, so nothing, including p and n, may
+// still refer to them. On failure f is left in an unspecified state.
+func (f *Frame) SetFromNormalInGeometry(g geometry.Geometry, p, n *mat.VecDense) bool {
 	g = geometry.Get(g)
 	if p == nil || n == nil || p.Len() != n.Len() || n.Len() < 2 {
-		return Frame{}, false
+		return false
 	}
 
-	projected := mat.NewVecDense(n.Len(), nil)
+	dim := n.Len()
+	projected := reuseVector(f.Normal, dim)
 	g.ProjectTangent(p, n, projected)
 	if !normalizeVectorInGeometry(g, p, projected) {
-		return Frame{}, false
+		return false
 	}
 
-	dim := n.Len()
 	tangentCount := dim - 1
 	if g.Kind() == geometry.SphericalKind {
 		tangentCount--
 	}
 	if tangentCount < 1 {
-		return Frame{}, false
+		return false
 	}
 
-	tangents := make([]*mat.VecDense, 0, tangentCount)
+	tangents := f.Tangents[:0]
 	for axis := 0; axis < dim && len(tangents) < tangentCount; axis++ {
-		candidate := mat.NewVecDense(dim, nil)
+		var candidate *mat.VecDense
+		if len(tangents) < cap(tangents) {
+			candidate = reuseVector(tangents[:len(tangents)+1][len(tangents)], dim)
+		} else {
+			candidate = mat.NewVecDense(dim, nil)
+		}
 		candidate.SetVec(axis, 1)
 		g.ProjectTangent(p, candidate, candidate)
 		subtractGeometryProjection(g, p, candidate, projected)
@@ -45,25 +62,29 @@ func NewFrameFromNormalInGeometry(g geometry.Geometry, p, n *mat.VecDense) (Fram
 		tangents = append(tangents, candidate)
 	}
 	if len(tangents) != tangentCount {
-		return Frame{}, false
+		return false
 	}
 
-	var tangent, bitangent *mat.VecDense
-	if len(tangents) > 0 {
-		tangent = tangents[0]
-	}
+	f.Geometry = g
+	f.Point = reuseVector(f.Point, dim)
+	f.Point.CopyVec(p)
+	f.Tangent, f.Bitangent = tangents[0], nil
 	if len(tangents) > 1 {
-		bitangent = tangents[1]
+		f.Bitangent = tangents[1]
 	}
+	f.Normal = projected
+	f.Tangents = tangents
+	return true
+}
 
-	return Frame{
-		Geometry:  g,
-		Point:     mat.VecDenseCopyOf(p),
-		Tangent:   tangent,
-		Bitangent: bitangent,
-		Normal:    projected,
-		Tangents:  tangents,
-	}, true
+// reuseVector returns v zeroed, or a new zero vector when v is nil or does
+// not have dim components.
+func reuseVector(v *mat.VecDense, dim int) *mat.VecDense {
+	if v == nil || v.Len() != dim {
+		return mat.NewVecDense(dim, nil)
+	}
+	v.Zero()
+	return v
 }
 
 func subtractGeometryProjection(g geometry.Geometry, p, v, basis *mat.VecDense) {
@@ -141,3 +141,29 @@ func assertNear(t *testing.T, got, want float64) {
 		t.Fatalf("got %g, want %g", got, want)
 	}
 }
+
+func TestSetFrameFromNormalInGeometryReusesVectors(t *testing.T) {
+	g := geometry.Klein()
+	frame, ok := NewFrameFromNormalInGeometry(g, mat.NewVecDense(3, []float64{0.1, 0, 0}), mat.NewVecDense(3, []float64{0, 0, 1}))
+	if !ok {
+		t.Fatal("expected Klein metric frame")
+	}
+	normal, tangents := frame.Normal, append([]*mat.VecDense(nil), frame.Tangents...)
+
+	p := mat.NewVecDense(3, []float64{0.6, 0.2, 0.1})
+	n := g.IntrinsicNormal(p, mat.NewVecDense(3, []float64{1, 2, -0.5}), mat.NewVecDense(3, nil))
+	want, _ := NewFrameFromNormalInGeometry(g, p, n)
+	if !frame.SetFromNormalInGeometry(g, p, n) {
+		t.Fatal("expected the frame to be rebuilt")
+	}
+	if frame.Normal != normal || frame.Tangents[0] != tangents[0] || frame.Tangents[1] != tangents[1] {
+		t.Fatal("rebuilding the frame allocated new vectors")
+	}
+	assertVecNear(t, frame.Point, want.Point)
+	assertVecNear(t, frame.Normal, want.Normal)
+	assertVecNear(t, frame.Tangent, want.Tangent)
+	assertVecNear(t, frame.Bitangent, want.Bitangent)
+	if allocs := testing.AllocsPerRun(10, func() { frame.SetFromNormalInGeometry(g, p, n) }); allocs != 0 {
+		t.Fatalf("rebuilding the frame made %g allocations, want 0", allocs)
+	}
+}
@@ -0,0 +1,114 @@
+package sampler
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+)
+
+// blueNoiseSize is the side of the tileable blue-noise texture.
+const blueNoiseSize = 64
+
+// blueNoiseSigma is the width of the void-and-cluster energy filter in texels.
+const blueNoiseSigma = 1.5
+
+var (
+	blueNoiseOnce  sync.Once
+	blueNoiseTable []float64
+)
+
+// blueNoise returns the tile value at (x, y), wrapped toroidally. The values
+// are the ranks (k+0.5)/N of a void-and-cluster dither array, so they are
+// uniformly distributed over [0, 1) while neighboring texels differ strongly.
+func blueNoise(x, y int) float64 {
+	blueNoiseOnce.Do(func() { blueNoiseTable = voidAndCluster(blueNoiseSize, blueNoiseSigma) })
+	x = ((x % blueNoiseSize) + blueNoiseSize) % blueNoiseSize
+	y = ((y % blueNoiseSize) + blueNoiseSize) % blueNoiseSize
+	return blueNoiseTable[y*blueNoiseSize+x]
+}
+
+// voidAndCluster builds a size x size dither array with Ulichney's algorithm.
+// A Gaussian-filtered energy locates the tightest cluster of set texels and
+// the largest void between them; texels are ranked by removing clusters from
+// a relaxed initial pattern and then filling voids until the array is full.
+func voidAndCluster(size int, sigma float64) []float64 {
+	n := size * size
+	kernel := make([]float64, n)
+	for dy := range size {
+		for dx := range size {
+			wx, wy := float64(min(dx, size-dx)), float64(min(dy, size-dy))
+			kernel[dy*size+dx] = math.Exp(-(wx*wx + wy*wy) / (2 * sigma * sigma))
+		}
+	}
+	energy := make([]float64, n)
+	set := make([]bool, n)
+	toggle := func(texel int, on bool) {
+		set[texel] = on
+		sign := 1.0
+		if !on {
+			sign = -1
+		}
+		tx, ty := texel%size, texel/size
+		for y := range size {
+			row := ((y - ty + size) % size) * size
+			for x := range size {
+				energy[y*size+x] += sign * kernel[row+(x-tx+size)%size]
+			}
+		}
+	}
+	extreme := func(want bool, largest bool) int {
+		best := -1
+		for texel := range n {
+			if set[texel] != want {
+				continue
+			}
+			if best < 0 || (largest && energy[texel] > energy[best]) || (!largest && energy[texel] < energy[best]) {
+				best = texel
+			}
+		}
+		return best
+	}
+
+	// A fixed generator keeps the tile identical across runs.
+	rng := rand.New(rand.NewPCG(0x626c7565, 0x6e6f697365))
+	initial := n / 10
+	for placed := 0; placed < initial; {
+		if texel := rng.IntN(n); !set[texel] {
+			toggle(texel, true)
+			placed++
+		}
+	}
+	// Relax the pattern by moving the tightest cluster into the largest void
+	// until the move is a no-op.
+	for range n {
+		cluster := extreme(true, true)
+		toggle(cluster, false)
+		void := extreme(false, false)
+		toggle(void, true)
+		if void == cluster {
+			break
+		}
+	}
+
+	ranks := make([]int, n)
+	prototype := append([]bool(nil), set...)
+	prototypeEnergy := append([]float64(nil), energy...)
+	for rank := initial - 1; rank >= 0; rank-- {
+		cluster := extreme(true, true)
+		toggle(cluster, false)
+		ranks[cluster] = rank
+	}
+	copy(set, prototype)
+	copy(energy, prototypeEnergy)
+	for rank := initial; rank < n; rank++ {
+		void := extreme(false, false)
+		toggle(void, true)
+		ranks[void] = rank
+	}
+
+	values := make([]float64, n)
+	for texel, rank := range ranks {
+		values[texel] = (float64(rank) + 0.5) / float64(n)
+	}
+	return values
+}
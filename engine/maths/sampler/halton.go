@@ -0,0 +1,76 @@
+package sampler
+
+import "math"
+
+// haltonDimensions is the number of dimensions with a prime base. Deeper
+// dimensions, which only long paths reach, fall back to independent numbers.
+const haltonDimensions = 1024
+
+// haltonPrimes holds the first haltonDimensions primes, the bases of the
+// successive dimensions.
+var haltonPrimes = func() []uint64 {
+	primes := make([]uint64, 0, haltonDimensions)
+	for candidate := uint64(2); len(primes) < haltonDimensions; candidate++ {
+		prime := true
+		for _, p := range primes {
+			if p*p > candidate {
+				break
+			}
+			if candidate%p == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			primes = append(primes, candidate)
+		}
+	}
+	return primes
+}()
+
+// Halton draws dimension d from the radical inverse of the sample index in
+// base prime(d). Each pixel Owen scrambles the digits with its own seed, so
+// every pixel sees a differently randomized copy of the stratified sequence.
+type Halton struct {
+	seed      uint64
+	pixel     uint64
+	index     uint64
+	dimension uint64
+}
+
+func (s *Halton) StartPixelSample(pixel int, index int64) {
+	s.pixel = uint64(pixel)
+	s.index = uint64(index)
+	s.dimension = 0
+}
+
+func (s *Halton) Float64() float64 {
+	d := s.dimension
+	s.dimension++
+	if d >= haltonDimensions {
+		return hashFloat64(s.seed, s.pixel, d, s.index)
+	}
+	return scrambledRadicalInverse(haltonPrimes[d], s.index, Hash(s.seed, s.pixel, d))
+}
+
+// scrambledRadicalInverse mirrors the base-b digits of index around the radix
+// point, permuting every digit with an affine map digit*k+c mod b chosen by
+// the digits before it. Because b is prime the map is a bijection, so the
+// scramble keeps the stratification of the plain radical inverse.
+func scrambledRadicalInverse(base, index, key uint64) float64 {
+	invBase := 1 / float64(base)
+	invBaseM := 1.0
+	result := 0.0
+	prefix := key
+	for 1-float64(base-1)*invBaseM < 1 {
+		digit := index % base
+		index /= base
+		h := Hash(prefix)
+		k := 1 + h%(base-1)
+		c := (h >> 32) % base
+		invBaseM *= invBase
+		result += float64((digit*k+c)%base) * invBaseM
+		prefix = Hash(prefix, digit)
+	}
+	return math.Min(result, oneMinusEpsilon)
+}
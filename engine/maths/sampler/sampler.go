@@ -0,0 +1,124 @@
+// Package sampler supplies the uniform random numbers consumed by rendering.
+// A sampler is positioned at a sample of a pixel before use, so the numbers a
+// sample sees depend only on the seed, the pixel, and the sample index, and
+// not on which worker traces the sample or in which order.
+//
+// Successive Float64 calls after StartPixelSample are successive dimensions of
+// the sample. Low-discrepancy samplers stratify every dimension over the
+// samples of a pixel and pair dimensions 2k and 2k+1, so a Sample2D drawn with
+// two consecutive calls starting at an even dimension is stratified in the
+// plane. Callers pad a lone one-dimensional draw with an unused call to keep
+// the pairs that follow aligned.
+package sampler
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// Sampler is a stream of uniform numbers in [0, 1). A sampler is owned by one
+// goroutine; concurrent workers create their own.
+type Sampler interface {
+	// StartPixelSample restarts the stream at dimension 0 of sample index of
+	// pixel.
+	StartPixelSample(pixel int, index int64)
+	Float64() float64
+}
+
+// Kind is the serialized name of a sampler.
+type Kind string
+
+const (
+	KindIndependent    Kind = "independent"
+	KindStratified     Kind = "stratified"
+	KindHalton         Kind = "halton"
+	KindSobol          Kind = "sobol"
+	KindBlueNoiseSobol Kind = "blue_noise_sobol"
+)
+
+// ParseKind accepts the canonical sampler names; empty selects independent.
+func ParseKind(value string) (Kind, error) {
+	switch Kind(value) {
+	case "", KindIndependent:
+		return KindIndependent, nil
+	case KindStratified, KindHalton, KindSobol, KindBlueNoiseSobol:
+		return Kind(value), nil
+	default:
+		return "", fmt.Errorf("unsupported sampler %q", value)
+	}
+}
+
+// Options configures a sampler for one render.
+type Options struct {
+	Seed uint64
+	// SamplesPerPixel is the number of sample indices a pixel receives. The
+	// stratified sampler divides every dimension into this many strata.
+	SamplesPerPixel int64
+	// Width is the Film width, which places linear pixel indices on the
+	// blue-noise tile. Zero treats pixels as a single row.
+	Width int
+}
+
+// New returns a sampler of kind positioned at sample 0 of pixel 0. Unknown
+// kinds, which ParseKind rejects, fall back to independent sampling.
+func New(kind Kind, options Options) Sampler {
+	var s Sampler
+	switch kind {
+	case KindStratified:
+		s = &Stratified{seed: options.Seed, strata: max(options.SamplesPerPixel, 1)}
+	case KindHalton:
+		s = &Halton{seed: options.Seed}
+	case KindSobol:
+		s = &Sobol{seed: options.Seed}
+	case KindBlueNoiseSobol:
+		s = &BlueNoiseSobol{seed: options.Seed, width: options.Width}
+	default:
+		return NewIndependent(options.Seed)
+	}
+	s.StartPixelSample(0, 0)
+	return s
+}
+
+// Independent draws uncorrelated numbers from a PCG generator reseeded for
+// every pixel sample.
+type Independent struct {
+	seed uint64
+	pcg  *rand.PCG
+	rng  *rand.Rand
+}
+
+// NewIndependent returns a sampler positioned at sample 0 of pixel 0.
+func NewIndependent(seed uint64) *Independent {
+	s := &Independent{seed: seed, pcg: rand.NewPCG(0, 0)}
+	s.rng = rand.New(s.pcg)
+	s.StartPixelSample(0, 0)
+	return s
+}
+
+func (s *Independent) StartPixelSample(pixel int, index int64) {
+	s.pcg.Seed(Hash(s.seed, uint64(pixel)), Hash(uint64(index)))
+}
+
+func (s *Independent) Float64() float64 { return s.rng.Float64() }
+
+// Hash combines values into a well-mixed 64-bit key with the SplitMix64
+// finalizer. It derives seeds for independent streams, such as the light and
+// camera subpaths of one sample, from a single scene seed.
+func Hash(values ...uint64) uint64 {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, value := range values {
+		h = mix(h ^ mix(value+0x9e3779b97f4a7c15))
+	}
+	return h
+}
+
+func mix(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// hashFloat64 maps a key to [0, 1).
+func hashFloat64(values ...uint64) float64 {
+	return float64(Hash(values...)>>11) * 0x1p-53
+}
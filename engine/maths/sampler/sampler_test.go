@@ -0,0 +1,180 @@
+package sampler
+
+import "testing"
+
+func draw(s Sampler, pixel int, index int64) []float64 {
+	s.StartPixelSample(pixel, index)
+	values := make([]float64, 8)
+	for i := range values {
+		values[i] = s.Float64()
+	}
+	return values
+}
+
+func TestIndependentRestartsPixelSample(t *testing.T) {
+	s := NewIndependent(42)
+	first := draw(s, 3, 5)
+	draw(s, 4, 5)
+	again := draw(NewIndependent(42), 3, 5)
+	for i := range first {
+		if value := draw(s, 3, 5)[i]; value != first[i] || again[i] != first[i] {
+			t.Fatalf("value %d = %g and %g after restart, want %g", i, value, again[i], first[i])
+		}
+		if first[i] < 0 || first[i] >= 1 {
+			t.Fatalf("value %d = %g outside [0, 1)", i, first[i])
+		}
+	}
+}
+
+func TestIndependentStreamsDifferByKey(t *testing.T) {
+	reference := draw(NewIndependent(1), 0, 0)
+	for name, values := range map[string][]float64{
+		"seed":   draw(NewIndependent(2), 0, 0),
+		"pixel":  draw(NewIndependent(1), 1, 0),
+		"sample": draw(NewIndependent(1), 0, 1),
+	} {
+		same := true
+		for i := range values {
+			same = same && values[i] == reference[i]
+		}
+		if same {
+			t.Fatalf("changing the %s left the stream unchanged", name)
+		}
+	}
+}
+
+func TestHashSeparatesPermutedKeys(t *testing.T) {
+	if Hash(1, 2) == Hash(2, 1) || Hash(0) == Hash(0, 0) {
+		t.Fatal("hash collides for reordered or extended keys")
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	if kind, err := ParseKind(""); err != nil || kind != KindIndependent {
+		t.Fatalf("ParseKind(\"\") = %q, %v; want independent", kind, err)
+	}
+	for _, kind := range []Kind{KindIndependent, KindStratified, KindHalton, KindSobol, KindBlueNoiseSobol} {
+		if parsed, err := ParseKind(string(kind)); err != nil || parsed != kind {
+			t.Fatalf("ParseKind(%q) = %q, %v", kind, parsed, err)
+		}
+	}
+	if _, err := ParseKind("owen"); err == nil {
+		t.Fatal("ParseKind accepted an unknown sampler")
+	}
+}
+
+func TestSamplersAreDeterministicAndInRange(t *testing.T) {
+	for _, kind := range []Kind{KindIndependent, KindStratified, KindHalton, KindSobol, KindBlueNoiseSobol} {
+		options := Options{Seed: 9, SamplesPerPixel: 16, Width: 8}
+		s, again := New(kind, options), New(kind, options)
+		for pixel := range 4 {
+			for index := range int64(16) {
+				first, second := draw(s, pixel, index), draw(again, pixel, index)
+				for i := range first {
+					if first[i] != second[i] {
+						t.Fatalf("%s: pixel %d sample %d value %d differs between samplers", kind, pixel, index, i)
+					}
+					if first[i] < 0 || first[i] >= 1 {
+						t.Fatalf("%s: value %g outside [0, 1)", kind, first[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+// strataOccupied reports whether the first n samples of pixel put exactly one
+// value of every dimension in each of n equal intervals.
+func strataOccupied(s Sampler, pixel int, n int) bool {
+	counts := make([][]int, 8)
+	for i := range counts {
+		counts[i] = make([]int, n)
+	}
+	for index := range int64(n) {
+		for i, value := range draw(s, pixel, index) {
+			counts[i][int(value*float64(n))]++
+		}
+	}
+	for _, dimension := range counts {
+		for _, count := range dimension {
+			if count != 1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestLowDiscrepancySamplersStratifyEveryDimension(t *testing.T) {
+	// The blue-noise shift moves the strata with the points, so only the
+	// unshifted samplers are checked against fixed intervals.
+	for _, kind := range []Kind{KindStratified, KindSobol} {
+		s := New(kind, Options{Seed: 3, SamplesPerPixel: 16, Width: 4})
+		for pixel := range 3 {
+			if !strataOccupied(s, pixel, 16) {
+				t.Fatalf("%s: pixel %d does not stratify 16 samples", kind, pixel)
+			}
+		}
+	}
+	// Base 2 and base 3 stratify the first two Halton dimensions; check the
+	// first over 16 samples and the second over 9.
+	s := New(KindHalton, Options{Seed: 3})
+	for _, check := range []struct{ dimension, n int }{{0, 16}, {1, 9}} {
+		counts := make([]int, check.n)
+		for index := range int64(check.n) {
+			counts[int(draw(s, 2, index)[check.dimension]*float64(check.n))]++
+		}
+		for stratum, count := range counts {
+			if count != 1 {
+				t.Fatalf("halton dimension %d stratum %d holds %d samples", check.dimension, stratum, count)
+			}
+		}
+	}
+}
+
+func TestSobolPairsFormElementaryNets(t *testing.T) {
+	// Sixteen points of a (0,2)-sequence put one point in every elementary
+	// interval of area 1/16: 16x1, 8x2, 4x4, 2x8 and 1x16 grids.
+	s := New(KindSobol, Options{Seed: 5})
+	for pair := range 3 {
+		points := make([][2]float64, 16)
+		for index := range points {
+			values := draw(s, 1, int64(index))
+			points[index] = [2]float64{values[2*pair], values[2*pair+1]}
+		}
+		for bits := 0; bits <= 4; bits++ {
+			nx, ny := 1<<bits, 16>>bits
+			seen := make(map[[2]int]bool)
+			for _, p := range points {
+				cell := [2]int{int(p[0] * float64(nx)), int(p[1] * float64(ny))}
+				if seen[cell] {
+					t.Fatalf("pair %d: two points in cell %v of the %dx%d grid", pair, cell, nx, ny)
+				}
+				seen[cell] = true
+			}
+		}
+	}
+}
+
+func TestBlueNoiseTileIsHighFrequency(t *testing.T) {
+	ranks := make(map[float64]bool)
+	neighbor := 0.0
+	for y := range blueNoiseSize {
+		for x := range blueNoiseSize {
+			value := blueNoise(x, y)
+			ranks[value] = true
+			d := value - blueNoise(x+1, y)
+			neighbor += d * d
+		}
+	}
+	if len(ranks) != blueNoiseSize*blueNoiseSize {
+		t.Fatalf("tile holds %d distinct values, want %d", len(ranks), blueNoiseSize*blueNoiseSize)
+	}
+	// Uncorrelated uniform neighbors differ by 1/6 in mean square.
+	if neighbor /= blueNoiseSize * blueNoiseSize; neighbor <= 1.0/6 {
+		t.Fatalf("mean squared neighbor difference %g, want above white noise", neighbor)
+	}
+	if blueNoise(-1, -blueNoiseSize) != blueNoise(blueNoiseSize-1, 0) {
+		t.Fatal("tile does not wrap toroidally")
+	}
+}
@@ -0,0 +1,54 @@
+package sampler
+
+import "math/bits"
+
+// oneMinusEpsilon is the largest float64 below one.
+const oneMinusEpsilon = 0x1.fffffffffffffp-1
+
+// nestedUniformScramble applies an Owen scramble to the bits of x: every bit
+// is flipped by a hash of the bits above it (Burley 2020). Applied to a point
+// it randomizes a digital net while keeping its stratification; applied to a
+// sample index it shuffles the samples within every power-of-two block.
+func nestedUniformScramble(x, seed uint32) uint32 {
+	return bits.Reverse32(laineKarrasPermutation(bits.Reverse32(x), seed))
+}
+
+// laineKarrasPermutation propagates every bit of x only toward higher bits,
+// which on reversed bits makes each flip depend on the more significant bits.
+func laineKarrasPermutation(x, seed uint32) uint32 {
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return x
+}
+
+// permutationElement returns the position of i in a pseudo-random permutation
+// of [0, n) chosen by seed. It walks a bijection of the enclosing power-of-two
+// range until the image falls inside [0, n).
+func permutationElement(i, n uint32, seed uint64) uint32 {
+	if n <= 1 {
+		return 0
+	}
+	mask := uint32(1)<<bits.Len32(n-1) - 1
+	shift := uint(bits.Len32(mask)+1) / 2
+	key := uint32(seed) | 1
+	offset := uint32(seed >> 32)
+	for {
+		i ^= offset
+		i = (i * 0xe170893d) & mask
+		i ^= i >> shift
+		i = (i * key) & mask
+		i = (i + offset>>16) & mask
+		i ^= i >> shift
+		if i < n {
+			return i
+		}
+	}
+}
+
+// fixedToFloat64 maps a 32-bit binary fraction to [0, 1).
+func fixedToFloat64(x uint32) float64 {
+	return min(float64(x)*0x1p-32, oneMinusEpsilon)
+}
@@ -0,0 +1,97 @@
+package sampler
+
+// sobolMatrices holds the generator matrices of the first two Sobol
+// dimensions as 32 column vectors: the van der Corput sequence, and the
+// dimension with primitive polynomial x+1, whose direction numbers follow
+// m_k = m_{k-1} xor 2 m_{k-1}. Together they form a (0,2)-sequence in base 2,
+// so every power-of-two prefix stratifies all elementary intervals of the
+// unit square.
+var sobolMatrices = func() [2][32]uint32 {
+	var matrices [2][32]uint32
+	m := uint32(1)
+	for k := range 32 {
+		matrices[0][k] = 1 << (31 - k)
+		matrices[1][k] = m << (31 - k)
+		m ^= m << 1
+	}
+	return matrices
+}()
+
+// sobolSample evaluates dimension (0 or 1) of the Sobol point at index.
+func sobolSample(index uint32, dimension int) uint32 {
+	result := uint32(0)
+	for k := 0; index != 0; k, index = k+1, index>>1 {
+		if index&1 != 0 {
+			result ^= sobolMatrices[dimension][k]
+		}
+	}
+	return result
+}
+
+// Sobol draws dimension pairs from the two-dimensional Sobol sequence with
+// padding (Burley 2020). Each pair shuffles the sample indices and Owen
+// scrambles the points with its own seed, so pairs are decorrelated from each
+// other and from other pixels while each stays a stratified (0,2)-sequence.
+type Sobol struct {
+	seed      uint64
+	pixel     uint64
+	index     uint32
+	dimension uint64
+}
+
+func (s *Sobol) StartPixelSample(pixel int, index int64) {
+	s.pixel = uint64(pixel)
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+func (s *Sobol) Float64() float64 {
+	pair, component := s.dimension/2, s.dimension%2
+	s.dimension++
+	point := sobolPadded(s.index, pair, component, Hash(s.seed, s.pixel))
+	return fixedToFloat64(point)
+}
+
+// sobolPadded is the scrambled component of dimension pair under key.
+func sobolPadded(index uint32, pair, component, key uint64) uint32 {
+	shuffled := nestedUniformScramble(index, uint32(Hash(key, pair)))
+	point := sobolSample(shuffled, int(component))
+	return nestedUniformScramble(point, uint32(Hash(key, pair, component+1)))
+}
+
+// BlueNoiseSobol shares one padded Sobol sequence between all pixels and
+// toroidally shifts each pixel's points by a value of a blue-noise tile
+// (Georgiev and Fajardo 2016). Every pixel keeps a stratified, uniformly
+// distributed sample set, while the errors of neighboring pixels are
+// anticorrelated and show up as high-frequency noise.
+type BlueNoiseSobol struct {
+	seed      uint64
+	width     int
+	x, y      int
+	index     uint32
+	dimension uint64
+}
+
+func (s *BlueNoiseSobol) StartPixelSample(pixel int, index int64) {
+	s.x, s.y = pixel, 0
+	if s.width > 0 {
+		s.x, s.y = pixel%s.width, pixel/s.width
+	}
+	s.index = uint32(index)
+	s.dimension = 0
+}
+
+func (s *BlueNoiseSobol) Float64() float64 {
+	pair, component := s.dimension/2, s.dimension%2
+	s.dimension++
+	point := fixedToFloat64(sobolPadded(s.index, pair, component, s.seed))
+	// Every dimension reads the tile at its own offset, so the shifts of
+	// different dimensions are independent.
+	offset := Hash(s.seed, pair, component)
+	shift := blueNoise(s.x+int(offset%blueNoiseSize), s.y+int((offset>>32)%blueNoiseSize))
+	value := point + shift
+	if value >= 1 {
+		value--
+	}
+	return min(value, oneMinusEpsilon)
+}
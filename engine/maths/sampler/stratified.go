@@ -0,0 +1,31 @@
+package sampler
+
+// Stratified splits every dimension into one stratum per sample of a pixel and
+// assigns the strata to sample indices by an independent random permutation
+// per dimension, a Latin hypercube over the samples of the pixel. Indices past
+// the stratum count start a new, independently permuted round.
+type Stratified struct {
+	seed      uint64
+	strata    int64
+	pixel     uint64
+	index     int64
+	dimension uint64
+}
+
+func (s *Stratified) StartPixelSample(pixel int, index int64) {
+	s.pixel = uint64(pixel)
+	s.index = index
+	s.dimension = 0
+}
+
+func (s *Stratified) Float64() float64 {
+	d := s.dimension
+	s.dimension++
+	round, j := s.index/s.strata, s.index%s.strata
+	stratum := int64(j)
+	if s.strata < 1<<32 {
+		stratum = int64(permutationElement(uint32(j), uint32(s.strata), Hash(s.seed, s.pixel, d, uint64(round))))
+	}
+	jitter := hashFloat64(s.seed, s.pixel, d, uint64(s.index))
+	return min((float64(stratum)+jitter)/float64(s.strata), oneMinusEpsilon)
+}
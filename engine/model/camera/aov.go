@@ -0,0 +1,114 @@
+package camera
+
+import "fmt"
+
+// AOVKind is the serialized name of an arbitrary output variable, a per-pixel
+// channel recorded next to the spectral radiance.
+type AOVKind string
+
+const (
+	AOVDepth           AOVKind = "depth"
+	AOVGeometricNormal AOVKind = "geometric_normal"
+	AOVShadingNormal   AOVKind = "shading_normal"
+	AOVUV              AOVKind = "uv"
+	AOVAlbedo          AOVKind = "albedo"
+	AOVObjectID        AOVKind = "object_id"
+	AOVMaterialID      AOVKind = "material_id"
+	AOVSampleCount     AOVKind = "sample_count"
+	AOVVariance        AOVKind = "variance"
+	AOVStokes          AOVKind = "stokes"
+)
+
+// maxAOVComponents bounds the components of a normal channel, one per axis
+// of the scene space.
+const maxAOVComponents = 16
+
+// ParseAOVKind accepts the canonical channel names.
+func ParseAOVKind(value string) (AOVKind, error) {
+	switch kind := AOVKind(value); kind {
+	case AOVDepth, AOVGeometricNormal, AOVShadingNormal, AOVUV, AOVAlbedo,
+		AOVObjectID, AOVMaterialID, AOVSampleCount, AOVVariance, AOVStokes:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unsupported AOV %q", value)
+	}
+}
+
+// AOVComponents is the number of values a channel stores per pixel in a scene
+// of dimension axes whose Film has spectralBins bins. Albedo is a reflectance
+// spectrum over the Film bins, and Stokes holds S0..S3 for each bin in turn.
+func AOVComponents(kind AOVKind, dimension, spectralBins int) int {
+	switch kind {
+	case AOVGeometricNormal, AOVShadingNormal:
+		return dimension
+	case AOVUV:
+		return 2
+	case AOVAlbedo:
+		return spectralBins
+	case AOVStokes:
+		return 4 * spectralBins
+	default:
+		return 1
+	}
+}
+
+// IsIDAOV reports whether a channel holds indices into a Film's ID tables
+// rather than an average.
+func IsIDAOV(kind AOVKind) bool {
+	return kind == AOVObjectID || kind == AOVMaterialID
+}
+
+// AOV is one channel of a Film. Data holds Components values per pixel,
+// pixel-major. Channels other than IDs, sample counts, and variances are
+// means over the camera samples of a pixel, where samples that hit nothing
+// contribute zero. ID channels hold the index, into Film.ObjectIDs or
+// Film.MaterialIDs, of the ID hit by most camera samples, and -1 when that
+// is the background or an object without an ID. The variance channel
+// estimates the variance of the pixel's radiance, summed over the spectral
+// bins, from the spread of its camera samples. The Stokes channel is the
+// pixel's spectral radiance as Stokes vectors, whose S0 matches the Film
+// bins; S1..S3 are zero unless the render was polarized.
+type AOV struct {
+	Kind       AOVKind   `json:"kind"`
+	Components int       `json:"components"`
+	Data       []float64 `json:"data"`
+}
+
+// Pixel is the slice of a channel holding the values of pixel.
+func (a *AOV) Pixel(pixel int) []float64 {
+	return a.Data[pixel*a.Components : (pixel+1)*a.Components]
+}
+
+// AOV returns the channel of kind, or nil when the Film does not record it.
+func (f *Film) AOV(kind AOVKind) *AOV {
+	if f == nil {
+		return nil
+	}
+	for i := range f.AOVs {
+		if f.AOVs[i].Kind == kind {
+			return &f.AOVs[i]
+		}
+	}
+	return nil
+}
+
+// AddAOV appends a zeroed channel of kind and returns it.
+func (f *Film) AddAOV(kind AOVKind, components int) *AOV {
+	f.AOVs = append(f.AOVs, AOV{
+		Kind:       kind,
+		Components: components,
+		Data:       make([]float64, f.ElementCount()*components),
+	})
+	return &f.AOVs[len(f.AOVs)-1]
+}
+
+// validAOVComponents reports whether components fits kind on a Film with
+// spectralBins bins.
+func validAOVComponents(kind AOVKind, components, spectralBins int) bool {
+	switch kind {
+	case AOVGeometricNormal, AOVShadingNormal:
+		return components >= 1 && components <= maxAOVComponents
+	default:
+		return components == AOVComponents(kind, 0, spectralBins)
+	}
+}
@@ -3,6 +3,7 @@ package camera
 import (
 	"math"
 
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 	"gonum.org/v1/gonum/mat"
 )
@@ -11,8 +12,13 @@ type Camera struct {
 	Film *Film
 }
 
+// RayCamera generates primary rays. GenerateRay jitters uniformly inside the
+// pixel at index; GenerateRayAt traces the ray through a continuous raster
+// position chosen by the caller, such as one drawn from a reconstruction
+// filter. Pixel centers lie on integer raster coordinates.
 type RayCamera interface {
-	GenerateRay(res *renderray.Ray, index ...int) *renderray.Ray
+	GenerateRay(res *renderray.Ray, s sampler.Sampler, index ...int) *renderray.Ray
+	GenerateRayAt(res *renderray.Ray, raster []float64) *renderray.Ray
 	GetFilm() *Film
 }
 
@@ -20,6 +26,15 @@ func (c Camera) GetFilm() *Film {
 	return c.Film
 }
 
+// jitteredRaster draws a uniform raster position inside the pixel at index.
+func jitteredRaster(s sampler.Sampler, index []int) []float64 {
+	raster := make([]float64, len(index))
+	for i, value := range index {
+		raster[i] = float64(value) + s.Float64() - 0.5
+	}
+	return raster
+}
+
 // FilmProjection describes the pinhole-camera mapping of a scene point.
 // Jacobian converts an area density at the point into a box-filtered pixel
 // density; callers multiply it by abs(dot(surfaceNormal, ToCamera)).
@@ -61,6 +76,13 @@ type BidirectionalCamera interface {
 	PDFDirection(direction *mat.VecDense) float64
 }
 
+// PolarizingCamera is implemented by cameras whose film has a horizontal
+// axis, along which polarized renders measure linear polarization.
+type PolarizingCamera interface {
+	RayCamera
+	FilmHorizontal() *mat.VecDense
+}
+
 type CameraType string
 
 const (
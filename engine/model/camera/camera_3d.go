@@ -3,10 +3,10 @@ package camera
 import (
 	"fmt"
 	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 	"gonum.org/v1/gonum/mat"
 	"math"
-	"math/rand/v2"
 )
 
 type Camera3D struct {
@@ -46,7 +46,13 @@ func (c *Camera3D) Prepare() error {
 	return nil
 }
 
-func (c *Camera3D) GenerateRay(res *renderray.Ray, index ...int) *renderray.Ray {
+func (c *Camera3D) GenerateRay(res *renderray.Ray, s sampler.Sampler, index ...int) *renderray.Ray {
+	return c.GenerateRayAt(res, jitteredRaster(s, index[:2]))
+}
+
+// GenerateRayAt is the inverse of ProjectPoint: it traces the ray through the
+// continuous raster position whose pixel centers lie on integer coordinates.
+func (c *Camera3D) GenerateRayAt(res *renderray.Ray, raster []float64) *renderray.Ray {
 	if res == nil {
 		res = &renderray.Ray{}
 	}
@@ -57,13 +63,13 @@ func (c *Camera3D) GenerateRay(res *renderray.Ray, index ...int) *renderray.Ray
 			panic(err)
 		}
 	}
-	width, height := c.Film.Shape[0], c.Film.Shape[1]
+	return c.generateRayAt(res, raster[0], raster[1])
+}
 
-	var (
-		row, col = index[0], index[1]
-		u        = 2*(float64(row)+rand.Float64())/float64(width) - 1
-		v        = 2*(float64(col)+rand.Float64())/float64(height) - 1
-	)
+func (c *Camera3D) generateRayAt(res *renderray.Ray, x, y float64) *renderray.Ray {
+	width, height := c.Film.Shape[0], c.Film.Shape[1]
+	u := 2*(x+0.5)/float64(width) - 1
+	v := 2*(y+0.5)/float64(height) - 1
 
 	res.Origin.CloneFromVec(c.Position)
 	res.Direction.CloneFromVec(c.orthonormalCoordinates[0])
@@ -74,6 +80,16 @@ func (c *Camera3D) GenerateRay(res *renderray.Ray, index ...int) *renderray.Ray
 	return res
 }
 
+// FilmHorizontal is the direction of increasing raster x.
+func (c *Camera3D) FilmHorizontal() *mat.VecDense {
+	if !c.prepared {
+		if err := c.Prepare(); err != nil {
+			panic(err)
+		}
+	}
+	return c.orthonormalCoordinates[1]
+}
+
 func (c *Camera3D) Endpoint() *mat.VecDense {
 	if c == nil || c.Position == nil || c.Ortho {
 		return nil
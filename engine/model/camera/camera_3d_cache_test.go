@@ -1,6 +1,7 @@
 package camera
 
 import (
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"gonum.org/v1/gonum/mat"
 	"math"
 	"testing"
@@ -27,7 +28,7 @@ func TestCamera3DPrepareCachesDerivedData(t *testing.T) {
 
 	cachedRight := camera.orthonormalCoordinates[1]
 	camera.Film = NewFilm(100, 50)
-	ray := camera.GenerateRay(nil, 5, 5)
+	ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 5, 5)
 	if ray == nil {
 		t.Fatal("expected ray to be generated")
 	}
@@ -46,11 +47,11 @@ func TestCamera3DGenerateRayUsesFilmDimensions(t *testing.T) {
 		t.Fatalf("Prepare returned error: %v", err)
 	}
 	camera.Film = NewFilm(100, 50)
-	if ray := camera.GenerateRay(nil, 50, 25); ray == nil {
+	if ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 50, 25); ray == nil {
 		t.Fatal("expected ray from first film")
 	}
 	camera.Film = NewFilm(200, 100)
-	if ray := camera.GenerateRay(nil, 100, 50); ray == nil {
+	if ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 100, 50); ray == nil {
 		t.Fatal("expected ray from second film")
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -121,7 +122,7 @@ func TestCamera3DGenerateRayProjectPointRoundTripWithWorldUp(t *testing.T) {
 	for _, pixel := range [][2]int{{0, 0}, {79, 0}, {0, 79}, {79, 79}, {40, 40}, {17, 63}} {
 		x, y := pixel[0], pixel[1]
 		for sample := 0; sample < 16; sample++ {
-			ray := camera.GenerateRay(nil, x, y)
+			ray := camera.GenerateRay(nil, sampler.NewIndependent(0), x, y)
 			point := mat.VecDenseCopyOf(ray.Origin)
 			point.AddScaledVec(point, 3, ray.Direction)
 			projection, ok := camera.ProjectPoint(point)
@@ -137,6 +138,27 @@ func TestCamera3DGenerateRayProjectPointRoundTripWithWorldUp(t *testing.T) {
 	}
 }
 
+func TestCamera3DGenerateRayAtInvertsProjectPoint(t *testing.T) {
+	camera := &Camera3D{
+		Position:     mat.NewVecDense(3, []float64{1, 2, 3}),
+		Coordinates:  testCameraCoordinates([]float64{0, 1, -0.3}, []float64{0, 0, 1}),
+		FieldOfViews: []float64{50, 40},
+	}
+	camera.Film = NewFilm(64, 48)
+	for _, raster := range [][]float64{{-0.4, -0.4}, {31.5, 23.5}, {12.25, 40.75}, {63.4, 47.4}} {
+		ray := camera.GenerateRayAt(nil, raster)
+		point := mat.VecDenseCopyOf(ray.Origin)
+		point.AddScaledVec(point, 2, ray.Direction)
+		projection, ok := camera.ProjectPoint(point)
+		if !ok {
+			t.Fatalf("ray through raster %v did not project", raster)
+		}
+		if math.Abs(projection.Position[0]-raster[0]) > 1e-9 || math.Abs(projection.Position[1]-raster[1]) > 1e-9 {
+			t.Fatalf("raster %v projected back to %v", raster, projection.Position)
+		}
+	}
+}
+
 func testCameraCoordinates(direction, up []float64) []*mat.VecDense {
 	forward := mat.NewVecDense(3, direction)
 	right := maths.Cross2(forward, mat.NewVecDense(3, up))
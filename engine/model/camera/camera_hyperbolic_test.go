@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -34,7 +35,7 @@ func TestHyperbolicCameraGenerateRayUsesKleinUnitDirection(t *testing.T) {
 	camera.FieldOfViews = []float64{70, 70}
 
 	camera.Film = NewFilm(64, 64)
-	ray := camera.GenerateRay(nil, 32, 32)
+	ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 32, 32)
 
 	if ray.Geometry != geometry.Klein() {
 		t.Fatal("expected generated ray to carry Klein geometry")
@@ -3,10 +3,10 @@ package camera
 import (
 	"fmt"
 	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 	"gonum.org/v1/gonum/mat"
 	"math"
-	"math/rand/v2"
 )
 
 type CameraNDim struct {
@@ -48,7 +48,13 @@ func (c *CameraNDim) Prepare() error {
 	return nil
 }
 
-func (c *CameraNDim) GenerateRay(res *renderray.Ray, x ...int) *renderray.Ray {
+func (c *CameraNDim) GenerateRay(res *renderray.Ray, s sampler.Sampler, x ...int) *renderray.Ray {
+	return c.GenerateRayAt(res, jitteredRaster(s, x))
+}
+
+// GenerateRayAt traces the ray through a continuous raster position whose
+// pixel centers lie on integer coordinates.
+func (c *CameraNDim) GenerateRayAt(res *renderray.Ray, raster []float64) *renderray.Ray {
 	if res == nil {
 		res = &renderray.Ray{}
 	}
@@ -61,22 +67,22 @@ func (c *CameraNDim) GenerateRay(res *renderray.Ray, x ...int) *renderray.Ray {
 		panic(fmt.Errorf("film dimensions must match camera field of views"))
 	}
 
-	u := make([]float64, len(x))
-	for i := 0; i < len(x); i++ {
-		u[i] = 2*(float64(x[i])+rand.Float64())/float64(c.Film.Shape[i]) - 1
+	u := make([]float64, len(raster))
+	for i := range raster {
+		u[i] = 2*(raster[i]+0.5)/float64(c.Film.Shape[i]) - 1
 	}
 
 	res.Origin.CloneFromVec(c.Position)
 	res.Direction.CloneFromVec(c.orthonormalCoordinates[0])
 	if c.Ortho {
-		for i := 0; i < len(x); i++ {
+		for i := range u {
 			res.Origin.AddScaledVec(res.Origin, u[i]*c.fovTangents[i], c.orthonormalCoordinates[i+1])
 		}
 		maths.Normalize(res.Direction)
 		return res
 	}
 
-	for i := 0; i < len(x); i++ {
+	for i := range u {
 		res.Direction.AddScaledVec(res.Direction, u[i]*c.fovTangents[i], c.orthonormalCoordinates[i+1])
 	}
 	maths.Normalize(res.Direction)
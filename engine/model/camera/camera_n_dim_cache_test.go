@@ -1,6 +1,7 @@
 package camera
 
 import (
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"gonum.org/v1/gonum/mat"
 	"math"
 	"testing"
@@ -34,7 +35,7 @@ func TestCameraNDimPrepareCachesDerivedData(t *testing.T) {
 	cachedTangents := camera.fovTangents
 
 	camera.Film = NewFilm(10, 10, 10)
-	ray := camera.GenerateRay(nil, 5, 5, 5)
+	ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 5, 5, 5)
 	if ray == nil {
 		t.Fatal("expected ray to be generated")
 	}
@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"github.com/Algo2147483647/ray/engine/model/material/medium"
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"gonum.org/v1/gonum/mat"
@@ -20,7 +21,7 @@ func TestCameraNDimGenerateRay3D(t *testing.T) {
 	camera.FieldOfViews = []float64{90, 90}
 
 	camera.Film = NewFilm(100, 100)
-	ray := camera.GenerateRay(nil, 50, 50)
+	ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 50, 50)
 	if ray == nil {
 		t.Fatal("expected ray to be generated")
 	}
@@ -55,7 +56,7 @@ func TestCameraNDimGenerateRay4D(t *testing.T) {
 	camera.FieldOfViews = []float64{90, 90, 90}
 
 	camera.Film = NewFilm(10, 10, 10)
-	ray := camera.GenerateRay(nil, 5, 5, 5)
+	ray := camera.GenerateRay(nil, sampler.NewIndependent(0), 5, 5, 5)
 	if ray == nil {
 		t.Fatal("expected ray to be generated")
 	}
@@ -84,8 +85,8 @@ func TestCameraNDimOrthoKeepsDirectionAndMovesOrigin(t *testing.T) {
 
 	film := NewFilm(10, 10, 10)
 	camera.Film = film
-	rayA := camera.GenerateRay(nil, 0, 0, 0)
-	rayB := camera.GenerateRay(nil, 9, 9, 9)
+	rayA := camera.GenerateRay(nil, sampler.NewIndependent(0), 0, 0, 0)
+	rayB := camera.GenerateRay(nil, sampler.NewIndependent(0), 9, 9, 9)
 
 	assertVecApprox(t, rayA.Direction, rayB.Direction, 1e-12)
 	assertVecApprox(t, rayA.Direction, mat.NewVecDense(4, []float64{1, 0, 0, 0}), 1e-12)
@@ -113,7 +114,7 @@ func TestCameraNDimGenerateRayResetsReusedRayMediumState(t *testing.T) {
 	ray.SetSpectralWavelength(610)
 
 	camera.Film = NewFilm(100, 100)
-	camera.GenerateRay(ray, 50, 50)
+	camera.GenerateRay(ray, sampler.NewIndependent(0), 50, 50)
 
 	if got := ray.MediumStack.Current(); got != medium.MediumAir {
 		t.Fatalf("expected GenerateRay to reset medium stack to air, got %v", got)
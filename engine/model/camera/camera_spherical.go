@@ -3,10 +3,10 @@ package camera
 import (
 	"fmt"
 	"math"
-	"math/rand/v2"
 
 	"github.com/Algo2147483647/ray/engine/maths"
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 	"gonum.org/v1/gonum/mat"
 )
@@ -93,7 +93,13 @@ func orthogonalInTangent(p, a, b *mat.VecDense) *mat.VecDense {
 	return nil
 }
 
-func (c *SphericalCamera) GenerateRay(res *renderray.Ray, index ...int) *renderray.Ray {
+func (c *SphericalCamera) GenerateRay(res *renderray.Ray, s sampler.Sampler, index ...int) *renderray.Ray {
+	return c.GenerateRayAt(res, jitteredRaster(s, index[:2]))
+}
+
+// GenerateRayAt traces the ray through a continuous raster position whose
+// pixel centers lie on integer coordinates.
+func (c *SphericalCamera) GenerateRayAt(res *renderray.Ray, raster []float64) *renderray.Ray {
 	if res == nil {
 		res = &renderray.Ray{}
 	}
@@ -105,9 +111,8 @@ func (c *SphericalCamera) GenerateRay(res *renderray.Ray, index ...int) *renderr
 	}
 	width, height := c.Film.Shape[0], c.Film.Shape[1]
 
-	row, col := index[0], index[1]
-	u := 2*(float64(row)+rand.Float64())/float64(width) - 1
-	v := 2*(float64(col)+rand.Float64())/float64(height) - 1
+	u := 2*(raster[0]+0.5)/float64(width) - 1
+	v := 2*(raster[1]+0.5)/float64(height) - 1
 
 	if res.Origin.Len() != 4 {
 		res.Origin = mat.NewVecDense(4, nil)
@@ -19,6 +19,11 @@ type Film struct {
 	OutputFilm       string                  `json:"output_film,omitempty"`
 	PixelWindows     []PixelWindow           `json:"pixel_windows,omitempty"`
 	Samples          int64                   `json:"samples"`
+	PixelSamples     []int64                 `json:"pixel_samples,omitempty"`  // per-pixel counts under adaptive sampling; nil ⇒ every pixel has Samples
+	FilterWeights    []float64               `json:"filter_weights,omitempty"` // per-pixel sums of camera-sample filter weights; nil ⇒ the sample counts
+	AOVs             []AOV                   `json:"aovs,omitempty"`           // arbitrary output variables recorded by the pixel driver
+	ObjectIDs        []string                `json:"object_ids,omitempty"`     // script object ids indexed by the object_id channel
+	MaterialIDs      []string                `json:"material_ids,omitempty"`   // script material ids indexed by the material_id channel
 	SpectralBinCount int                     `json:"spectral_bin_count,omitempty"`
 	SpectralBins     []maths.Tensor[float64] `json:"spectral_bins"`
 	SpectralMinNM    float64                 `json:"spectral_min_nm"`
@@ -28,6 +33,8 @@ type Film struct {
 type SpectralSample struct {
 	WavelengthNM float64
 	Value        float64
+	Polarization [3]float64 // S1..S3 of the Stokes vector whose S0 is Value; zero for unpolarized transport
+	Weight       float64    // reconstruction-filter weight of the camera sample
 }
 
 func NewFilm(shape ...int) *Film {
@@ -40,6 +47,11 @@ func (f *Film) Init(shape ...int) *Film {
 	}
 	f.Shape = append(f.Shape[:0], shape...)
 	f.Samples = 0
+	f.PixelSamples = nil
+	f.FilterWeights = nil
+	f.AOVs = nil
+	f.ObjectIDs = nil
+	f.MaterialIDs = nil
 	f.SpectralBinCount = 0
 	f.SpectralBins = nil
 	f.SpectralMinNM = 0
@@ -53,6 +65,11 @@ func (f *Film) Reset() {
 		return
 	}
 	f.Samples = 0
+	f.PixelSamples = nil
+	f.FilterWeights = nil
+	f.AOVs = nil
+	f.ObjectIDs = nil
+	f.MaterialIDs = nil
 	for i := range f.SpectralBins {
 		clear(f.SpectralBins[i].Data)
 	}
@@ -72,6 +89,29 @@ func (f *Film) ElementCount() int {
 	return count
 }
 
+// PixelSampleCount is the number of samples averaged into pixel.
+func (f *Film) PixelSampleCount(pixel int) int64 {
+	if f == nil {
+		return 0
+	}
+	if f.PixelSamples != nil {
+		return f.PixelSamples[pixel]
+	}
+	return f.Samples
+}
+
+// PixelWeight is the total reconstruction-filter weight of the samples
+// averaged into pixel, the weight the pixel carries when Films are merged.
+func (f *Film) PixelWeight(pixel int) float64 {
+	if f == nil {
+		return 0
+	}
+	if f.FilterWeights != nil {
+		return f.FilterWeights[pixel]
+	}
+	return float64(f.PixelSampleCount(pixel))
+}
+
 func (f *Film) InitSpectralBins(count int, minNM, maxNM float64) {
 	if f == nil || count <= 0 || f.ElementCount() == 0 || minNM <= 0 || maxNM <= minNM {
 		if f != nil {
@@ -15,10 +15,13 @@ import (
 var filmFileMagic = [8]byte{'R', 'A', 'Y', 'F', 'I', 'L', 'M', 0}
 
 const (
-	filmFileVersion     uint32 = 3
+	filmFileVersion     uint32 = 6
 	filmFloatChunkBytes        = 1 << 20
 	maxFilmRank         uint32 = 16
 	maxFilmSpectralBins uint32 = 4096
+	maxFilmAOVs         uint32 = 64
+	maxFilmIDs          uint32 = 1 << 20
+	maxFilmStringBytes  uint32 = 1 << 12
 )
 
 var filmByteOrder = binary.LittleEndian
@@ -36,13 +39,36 @@ type filmSpectrumHeader struct {
 	MaxNM    float64
 }
 
+// filmSampleHeader follows the spectrum header. A non-zero PerPixel appends
+// one int64 sample count per pixel after the spectral planes, and a non-zero
+// FilterWeights then appends one float64 filter-weight sum per pixel.
+type filmSampleHeader struct {
+	PerPixel      uint32
+	FilterWeights uint32
+}
+
+// filmAOVHeader follows the sample header. After the filter weights come
+// AOVs channels, each a name, a uint32 component count, and that many float64
+// values per pixel, then the object and the material ID tables. Names and IDs
+// are a uint32 byte length followed by the bytes.
+type filmAOVHeader struct {
+	AOVs        uint32
+	ObjectIDs   uint32
+	MaterialIDs uint32
+}
+
 type filmFileMetadata struct {
-	Samples      int64
-	Shape        []int
-	BinCount     int
-	MinNM        float64
-	MaxNM        float64
-	ElementCount int
+	Samples       int64
+	PerPixel      bool
+	FilterWeights bool
+	AOVs          int
+	ObjectIDs     int
+	MaterialIDs   int
+	Shape         []int
+	BinCount      int
+	MinNM         float64
+	MaxNM         float64
+	ElementCount  int
 }
 
 func (f *Film) SaveToFile(filename string) error {
@@ -84,6 +110,11 @@ func (f *Film) LoadFromFile(filename string) error {
 	// Commit only after the complete file has been decoded successfully.
 	f.Shape = loaded.Shape
 	f.Samples = loaded.Samples
+	f.PixelSamples = loaded.PixelSamples
+	f.FilterWeights = loaded.FilterWeights
+	f.AOVs = loaded.AOVs
+	f.ObjectIDs = loaded.ObjectIDs
+	f.MaterialIDs = loaded.MaterialIDs
 	f.SpectralBinCount = loaded.SpectralBinCount
 	f.SpectralBins = loaded.SpectralBins
 	f.SpectralMinNM = loaded.SpectralMinNM
@@ -118,6 +149,24 @@ func writeFilm(w io.Writer, film *Film, metadata filmFileMetadata) error {
 	if err := binary.Write(w, filmByteOrder, spectrum); err != nil {
 		return fmt.Errorf("spectrum header: %w", err)
 	}
+	sampleHeader := filmSampleHeader{}
+	if metadata.PerPixel {
+		sampleHeader.PerPixel = 1
+	}
+	if metadata.FilterWeights {
+		sampleHeader.FilterWeights = 1
+	}
+	if err := binary.Write(w, filmByteOrder, sampleHeader); err != nil {
+		return fmt.Errorf("sample header: %w", err)
+	}
+	aovHeader := filmAOVHeader{
+		AOVs:        uint32(metadata.AOVs),
+		ObjectIDs:   uint32(metadata.ObjectIDs),
+		MaterialIDs: uint32(metadata.MaterialIDs),
+	}
+	if err := binary.Write(w, filmByteOrder, aovHeader); err != nil {
+		return fmt.Errorf("AOV header: %w", err)
+	}
 
 	buffer := make([]byte, filmFloatChunkBytes)
 	for bin := range film.SpectralBins {
@@ -125,6 +174,38 @@ func writeFilm(w io.Writer, film *Film, metadata filmFileMetadata) error {
 			return fmt.Errorf("spectral plane %d: %w", bin, err)
 		}
 	}
+	if metadata.PerPixel {
+		if err := binaryio.WriteInt64s(w, filmByteOrder, film.PixelSamples, buffer); err != nil {
+			return fmt.Errorf("pixel sample counts: %w", err)
+		}
+	}
+	if metadata.FilterWeights {
+		if err := binaryio.WriteFloat64s(w, filmByteOrder, film.FilterWeights, buffer); err != nil {
+			return fmt.Errorf("filter weights: %w", err)
+		}
+	}
+	for i := range film.AOVs {
+		aov := &film.AOVs[i]
+		if err := writeFilmString(w, string(aov.Kind)); err != nil {
+			return fmt.Errorf("AOV %d name: %w", i, err)
+		}
+		if err := binary.Write(w, filmByteOrder, uint32(aov.Components)); err != nil {
+			return fmt.Errorf("AOV %q components: %w", aov.Kind, err)
+		}
+		if err := binaryio.WriteFloat64s(w, filmByteOrder, aov.Data, buffer); err != nil {
+			return fmt.Errorf("AOV %q: %w", aov.Kind, err)
+		}
+	}
+	for _, id := range film.ObjectIDs {
+		if err := writeFilmString(w, id); err != nil {
+			return fmt.Errorf("object IDs: %w", err)
+		}
+	}
+	for _, id := range film.MaterialIDs {
+		if err := writeFilmString(w, id); err != nil {
+			return fmt.Errorf("material IDs: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -149,6 +230,31 @@ func readFilm(r io.Reader) (*Film, error) {
 			return nil, fmt.Errorf("spectral plane %d: %w", bin, err)
 		}
 	}
+	if metadata.PerPixel {
+		film.PixelSamples = make([]int64, metadata.ElementCount)
+		if err := binaryio.ReadInt64s(r, filmByteOrder, film.PixelSamples, buffer); err != nil {
+			return nil, fmt.Errorf("pixel sample counts: %w", err)
+		}
+		for pixel, count := range film.PixelSamples {
+			if count < 0 {
+				return nil, fmt.Errorf("invalid sample count %d at pixel %d", count, pixel)
+			}
+		}
+	}
+	if metadata.FilterWeights {
+		film.FilterWeights = make([]float64, metadata.ElementCount)
+		if err := binaryio.ReadFloat64s(r, filmByteOrder, film.FilterWeights, buffer); err != nil {
+			return nil, fmt.Errorf("filter weights: %w", err)
+		}
+		for pixel, weight := range film.FilterWeights {
+			if math.IsNaN(weight) || math.IsInf(weight, 0) {
+				return nil, fmt.Errorf("invalid filter weight %v at pixel %d", weight, pixel)
+			}
+		}
+	}
+	if err := readFilmAOVs(r, film, metadata, buffer); err != nil {
+		return nil, err
+	}
 	if err := binaryio.RequireEOF(r); err != nil {
 		return nil, err
 	}
@@ -183,12 +289,34 @@ func readFilmMetadata(r io.Reader) (filmFileMetadata, error) {
 	if err := binary.Read(r, filmByteOrder, &spectrum); err != nil {
 		return filmFileMetadata{}, fmt.Errorf("spectrum header: %w", err)
 	}
+	var sampleHeader filmSampleHeader
+	if err := binary.Read(r, filmByteOrder, &sampleHeader); err != nil {
+		return filmFileMetadata{}, fmt.Errorf("sample header: %w", err)
+	}
+	if sampleHeader.PerPixel > 1 {
+		return filmFileMetadata{}, fmt.Errorf("invalid per-pixel sample flag %d", sampleHeader.PerPixel)
+	}
+	if sampleHeader.FilterWeights > 1 {
+		return filmFileMetadata{}, fmt.Errorf("invalid filter-weight flag %d", sampleHeader.FilterWeights)
+	}
+	var aovHeader filmAOVHeader
+	if err := binary.Read(r, filmByteOrder, &aovHeader); err != nil {
+		return filmFileMetadata{}, fmt.Errorf("AOV header: %w", err)
+	}
+	if aovHeader.AOVs > maxFilmAOVs || aovHeader.ObjectIDs > maxFilmIDs || aovHeader.MaterialIDs > maxFilmIDs {
+		return filmFileMetadata{}, fmt.Errorf("invalid AOV header %+v", aovHeader)
+	}
 	metadata := filmFileMetadata{
-		Samples:  header.Samples,
-		Shape:    shape,
-		BinCount: int(spectrum.BinCount),
-		MinNM:    spectrum.MinNM,
-		MaxNM:    spectrum.MaxNM,
+		Samples:       header.Samples,
+		PerPixel:      sampleHeader.PerPixel != 0,
+		FilterWeights: sampleHeader.FilterWeights != 0,
+		AOVs:          int(aovHeader.AOVs),
+		ObjectIDs:     int(aovHeader.ObjectIDs),
+		MaterialIDs:   int(aovHeader.MaterialIDs),
+		Shape:         shape,
+		BinCount:      int(spectrum.BinCount),
+		MinNM:         spectrum.MinNM,
+		MaxNM:         spectrum.MaxNM,
 	}
 	if err := metadata.validate(); err != nil {
 		return filmFileMetadata{}, err
@@ -201,11 +329,16 @@ func metadataForFilm(film *Film) (filmFileMetadata, error) {
 		return filmFileMetadata{}, fmt.Errorf("cannot save a nil Film")
 	}
 	metadata := filmFileMetadata{
-		Samples:  film.Samples,
-		Shape:    film.Shape,
-		BinCount: len(film.SpectralBins),
-		MinNM:    film.SpectralMinNM,
-		MaxNM:    film.SpectralMaxNM,
+		Samples:       film.Samples,
+		PerPixel:      film.PixelSamples != nil,
+		FilterWeights: film.FilterWeights != nil,
+		AOVs:          len(film.AOVs),
+		ObjectIDs:     len(film.ObjectIDs),
+		MaterialIDs:   len(film.MaterialIDs),
+		Shape:         film.Shape,
+		BinCount:      len(film.SpectralBins),
+		MinNM:         film.SpectralMinNM,
+		MaxNM:         film.SpectralMaxNM,
 	}
 	if err := metadata.validate(); err != nil {
 		return filmFileMetadata{}, err
@@ -216,9 +349,142 @@ func metadataForFilm(film *Film) (filmFileMetadata, error) {
 			return filmFileMetadata{}, fmt.Errorf("spectral plane %d does not match Film shape %v", bin, metadata.Shape)
 		}
 	}
+	if metadata.PerPixel && len(film.PixelSamples) != metadata.ElementCount {
+		return filmFileMetadata{}, fmt.Errorf("pixel sample counts do not match Film shape %v", metadata.Shape)
+	}
+	if metadata.FilterWeights && len(film.FilterWeights) != metadata.ElementCount {
+		return filmFileMetadata{}, fmt.Errorf("filter weights do not match Film shape %v", metadata.Shape)
+	}
+	if metadata.AOVs > int(maxFilmAOVs) || metadata.ObjectIDs > int(maxFilmIDs) || metadata.MaterialIDs > int(maxFilmIDs) {
+		return filmFileMetadata{}, fmt.Errorf("too many AOVs or IDs")
+	}
+	for i := range film.AOVs {
+		aov := &film.AOVs[i]
+		if err := validateAOVLayout(aov.Kind, aov.Components, metadata); err != nil {
+			return filmFileMetadata{}, err
+		}
+		if len(aov.Data) != metadata.ElementCount*aov.Components {
+			return filmFileMetadata{}, fmt.Errorf("AOV %q does not match Film shape %v", aov.Kind, metadata.Shape)
+		}
+		if film.AOV(aov.Kind) != aov {
+			return filmFileMetadata{}, fmt.Errorf("duplicate AOV %q", aov.Kind)
+		}
+	}
+	for _, id := range slices.Concat(film.ObjectIDs, film.MaterialIDs) {
+		if len(id) > int(maxFilmStringBytes) {
+			return filmFileMetadata{}, fmt.Errorf("ID of %d bytes exceeds %d", len(id), maxFilmStringBytes)
+		}
+	}
 	return metadata, nil
 }
 
+// readFilmAOVs reads the channels and ID tables that follow the filter
+// weights and checks every value against its channel.
+func readFilmAOVs(r io.Reader, film *Film, metadata filmFileMetadata, buffer []byte) error {
+	for i := range metadata.AOVs {
+		name, err := readFilmString(r)
+		if err != nil {
+			return fmt.Errorf("AOV %d name: %w", i, err)
+		}
+		kind, err := ParseAOVKind(name)
+		if err != nil {
+			return err
+		}
+		if film.AOV(kind) != nil {
+			return fmt.Errorf("duplicate AOV %q", kind)
+		}
+		var components uint32
+		if err := binary.Read(r, filmByteOrder, &components); err != nil {
+			return fmt.Errorf("AOV %q components: %w", kind, err)
+		}
+		if err := validateAOVLayout(kind, int(components), metadata); err != nil {
+			return err
+		}
+		aov := film.AddAOV(kind, int(components))
+		if err := binaryio.ReadFloat64s(r, filmByteOrder, aov.Data, buffer); err != nil {
+			return fmt.Errorf("AOV %q: %w", kind, err)
+		}
+	}
+	var err error
+	if film.ObjectIDs, err = readFilmStrings(r, metadata.ObjectIDs); err != nil {
+		return fmt.Errorf("object IDs: %w", err)
+	}
+	if film.MaterialIDs, err = readFilmStrings(r, metadata.MaterialIDs); err != nil {
+		return fmt.Errorf("material IDs: %w", err)
+	}
+
+	for i := range film.AOVs {
+		aov := &film.AOVs[i]
+		ids := -1
+		switch aov.Kind {
+		case AOVObjectID:
+			ids = len(film.ObjectIDs)
+		case AOVMaterialID:
+			ids = len(film.MaterialIDs)
+		}
+		for index, value := range aov.Data {
+			valid := !math.IsNaN(value) && !math.IsInf(value, 0)
+			if ids >= 0 {
+				valid = value == math.Trunc(value) && value >= -1 && value < float64(ids)
+			} else if aov.Kind == AOVSampleCount || aov.Kind == AOVVariance {
+				valid = valid && value >= 0
+			}
+			if !valid {
+				return fmt.Errorf("invalid AOV %q value %v at pixel %d", aov.Kind, value, index/aov.Components)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAOVLayout(kind AOVKind, components int, metadata filmFileMetadata) error {
+	if !validAOVComponents(kind, components, metadata.BinCount) {
+		return fmt.Errorf("invalid component count %d for AOV %q", components, kind)
+	}
+	if _, err := checkedPayloadBytes(metadata.ElementCount, components); err != nil {
+		return fmt.Errorf("AOV %q: %w", kind, err)
+	}
+	return nil
+}
+
+func writeFilmString(w io.Writer, value string) error {
+	if err := binary.Write(w, filmByteOrder, uint32(len(value))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, value)
+	return err
+}
+
+func readFilmString(r io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, filmByteOrder, &length); err != nil {
+		return "", err
+	}
+	if length > maxFilmStringBytes {
+		return "", fmt.Errorf("string of %d bytes exceeds %d", length, maxFilmStringBytes)
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func readFilmStrings(r io.Reader, count int) ([]string, error) {
+	if count == 0 {
+		return nil, nil
+	}
+	values := make([]string, 0, min(count, 1024))
+	for range count {
+		value, err := readFilmString(r)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
 func (metadata *filmFileMetadata) validate() error {
 	if metadata.Samples < 0 {
 		return fmt.Errorf("invalid sample count %d", metadata.Samples)
@@ -0,0 +1,166 @@
+package camera
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+)
+
+// Clone returns a deep copy of f.
+func (f *Film) Clone() *Film {
+	if f == nil {
+		return nil
+	}
+	clone := *f
+	clone.Shape = slices.Clone(f.Shape)
+	clone.PixelWindows = slices.Clone(f.PixelWindows)
+	clone.PixelSamples = slices.Clone(f.PixelSamples)
+	clone.FilterWeights = slices.Clone(f.FilterWeights)
+	clone.ObjectIDs = slices.Clone(f.ObjectIDs)
+	clone.MaterialIDs = slices.Clone(f.MaterialIDs)
+	clone.AOVs = slices.Clone(f.AOVs)
+	for i := range clone.AOVs {
+		clone.AOVs[i].Data = slices.Clone(f.AOVs[i].Data)
+	}
+	if f.SpectralBins != nil {
+		clone.SpectralBins = make([]maths.Tensor[float64], len(f.SpectralBins))
+		for i, bin := range f.SpectralBins {
+			clone.SpectralBins[i] = maths.Tensor[float64]{
+				Data:   slices.Clone(bin.Data),
+				Shape:  slices.Clone(bin.Shape),
+				Stride: slices.Clone(bin.Stride),
+				Offset: bin.Offset,
+			}
+		}
+	}
+	return &clone
+}
+
+// Merge folds the samples of update into f, as if one render had taken the
+// samples of both.
+func (f *Film) Merge(update *Film) error {
+	return f.MergePixels(update, nil)
+}
+
+// MergePixels is Merge restricted to pixels; pixels outside keep the values
+// of f. A nil pixels merges every pixel.
+func (f *Film) MergePixels(update *Film, pixels []int) error {
+	if f == nil || update == nil {
+		return fmt.Errorf("merge films: nil film")
+	}
+	if !slices.Equal(f.Shape, update.Shape) {
+		return fmt.Errorf("merge films: dimension of a and b is not matched")
+	}
+	if !compatibleSpectralBins(f, update) {
+		return fmt.Errorf("merge films: spectral layouts do not match")
+	}
+	if !compatibleAOVs(f, update) {
+		return fmt.Errorf("merge films: AOV layouts do not match")
+	}
+
+	totalSamples := f.Samples + update.Samples
+	perPixel := f.PixelSamples != nil || update.PixelSamples != nil
+	if totalSamples == 0 && !perPixel {
+		return nil
+	}
+
+	if pixels == nil {
+		pixels = make([]int, f.ElementCount())
+		for pixel := range pixels {
+			pixels[pixel] = pixel
+		}
+	}
+	// Adaptive Films weight every pixel by its own sample count, and the
+	// merged counts stay per pixel. Films reconstructed with a non-box
+	// filter weight pixels by their filter-weight sums instead, and the
+	// merged sums stay per pixel too.
+	var counts []int64
+	if perPixel {
+		counts = make([]int64, f.ElementCount())
+		for pixel := range counts {
+			counts[pixel] = f.PixelSampleCount(pixel)
+		}
+	}
+	var weights []float64
+	if f.FilterWeights != nil || update.FilterWeights != nil {
+		weights = make([]float64, f.ElementCount())
+		for pixel := range weights {
+			weights[pixel] = f.PixelWeight(pixel)
+		}
+	}
+	for _, pixel := range pixels {
+		baseSamples, updateSamples := f.PixelSampleCount(pixel), update.PixelSampleCount(pixel)
+		baseWeight, updateWeight := f.PixelWeight(pixel), update.PixelWeight(pixel)
+		pixelWeight := baseWeight + updateWeight
+		if perPixel {
+			counts[pixel] = baseSamples + updateSamples
+		}
+		if weights != nil {
+			weights[pixel] = pixelWeight
+		}
+		mergePixelAOVs(f, update, pixel, baseSamples, updateSamples)
+		if pixelWeight == 0 {
+			continue
+		}
+		for bin := range f.SpectralBins {
+			f.SpectralBins[bin].Data[pixel] = (f.SpectralBins[bin].Data[pixel]*baseWeight + update.SpectralBins[bin].Data[pixel]*updateWeight) / pixelWeight
+		}
+	}
+	f.Samples = totalSamples
+	f.PixelSamples = counts
+	f.FilterWeights = weights
+	return nil
+}
+
+func compatibleSpectralBins(base, update *Film) bool {
+	return len(base.SpectralBins) > 0 &&
+		len(base.SpectralBins) == len(update.SpectralBins) &&
+		base.SpectralMinNM == update.SpectralMinNM &&
+		base.SpectralMaxNM == update.SpectralMaxNM
+}
+
+// compatibleAOVs reports whether two Films record the same channels in the
+// same order under the same ID tables.
+func compatibleAOVs(base, update *Film) bool {
+	if len(base.AOVs) != len(update.AOVs) ||
+		!slices.Equal(base.ObjectIDs, update.ObjectIDs) ||
+		!slices.Equal(base.MaterialIDs, update.MaterialIDs) {
+		return false
+	}
+	for i := range base.AOVs {
+		if base.AOVs[i].Kind != update.AOVs[i].Kind || base.AOVs[i].Components != update.AOVs[i].Components {
+			return false
+		}
+	}
+	return true
+}
+
+// mergePixelAOVs merges the AOVs of update into base at pixel. Means are
+// weighted by the camera samples behind them, sample counts add, variances
+// combine as those of a sample-weighted mean, and an ID comes from the Film
+// with more samples at the pixel, base on a tie.
+func mergePixelAOVs(base, update *Film, pixel int, baseSamples, updateSamples int64) {
+	total := baseSamples + updateSamples
+	for i := range base.AOVs {
+		kind := base.AOVs[i].Kind
+		baseValues, updateValues := base.AOVs[i].Pixel(pixel), update.AOVs[i].Pixel(pixel)
+		switch {
+		case kind == AOVSampleCount:
+			baseValues[0] += updateValues[0]
+		case kind == AOVVariance:
+			if total > 0 {
+				a, b := float64(baseSamples), float64(updateSamples)
+				baseValues[0] = (a*a*baseValues[0] + b*b*updateValues[0]) / float64(total*total)
+			}
+		case IsIDAOV(kind):
+			if updateSamples > baseSamples {
+				baseValues[0] = updateValues[0]
+			}
+		case total > 0:
+			for c := range baseValues {
+				baseValues[c] = (baseValues[c]*float64(baseSamples) + updateValues[c]*float64(updateSamples)) / float64(total)
+			}
+		}
+	}
+}
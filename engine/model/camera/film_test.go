@@ -5,6 +5,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 )
 
@@ -21,7 +22,7 @@ func TestSpectralFilmRecordsSamples(t *testing.T) {
 	}
 }
 
-func TestSpectralFilmV3RoundTrip(t *testing.T) {
+func TestSpectralFilmRoundTrip(t *testing.T) {
 	film := NewFilm(3, 2)
 	film.Samples = 17
 	film.InitSpectralBins(5, 380, 750)
@@ -50,17 +51,98 @@ func TestSpectralFilmV3RoundTrip(t *testing.T) {
 	}
 }
 
-func TestSpectralFilmRejectsOldVersion(t *testing.T) {
-	path := filepath.Join(t.TempDir(), "old.bin")
-	data := append([]byte(nil), filmFileMagic[:]...)
-	version := make([]byte, 4)
-	binary.LittleEndian.PutUint32(version, 2)
-	data = append(data, version...)
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+func TestSpectralFilmRoundTripsPixelSampleCountsAndWeights(t *testing.T) {
+	film := NewFilm(3, 1)
+	film.Samples = 64
+	film.PixelSamples = []int64{8, 64, 24}
+	film.FilterWeights = []float64{7.75, 64.5, -0.25}
+	film.InitSpectralBins(2, 380, 750)
+	path := filepath.Join(t.TempDir(), "adaptive.bin")
+	if err := film.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewFilm()
+	if err := loaded.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for pixel, want := range film.PixelSamples {
+		if got := loaded.PixelSampleCount(pixel); got != want {
+			t.Fatalf("pixel %d count = %d, want %d", pixel, got, want)
+		}
+		if got, want := loaded.PixelWeight(pixel), film.FilterWeights[pixel]; got != want {
+			t.Fatalf("pixel %d weight = %g, want %g", pixel, got, want)
+		}
+	}
+
+	film.PixelSamples = film.PixelSamples[:2]
+	if err := film.SaveToFile(path); err == nil {
+		t.Fatal("expected counts that do not match the shape to be rejected")
+	}
+	film.PixelSamples = nil
+	film.FilterWeights = film.FilterWeights[:1]
+	if err := film.SaveToFile(path); err == nil {
+		t.Fatal("expected weights that do not match the shape to be rejected")
+	}
+}
+
+func TestSpectralFilmRoundTripsAOVs(t *testing.T) {
+	film := NewFilm(2, 1)
+	film.InitSpectralBins(3, 380, 750)
+	copy(film.AddAOV(AOVDepth, 1).Data, []float64{2.5, 0})
+	copy(film.AddAOV(AOVShadingNormal, 3).Data, []float64{0, 0, -1, 0, 1, 0})
+	copy(film.AddAOV(AOVAlbedo, 3).Data, []float64{0.1, 0.2, 0.3, 0, 0, 0})
+	copy(film.AddAOV(AOVObjectID, 1).Data, []float64{1, -1})
+	film.ObjectIDs = []string{"floor", "teapot"}
+	path := filepath.Join(t.TempDir(), "aov.bin")
+	if err := film.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewFilm()
+	if err := loaded.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.AOVs) != len(film.AOVs) || !slices.Equal(loaded.ObjectIDs, film.ObjectIDs) || loaded.MaterialIDs != nil {
+		t.Fatalf("loaded AOVs %+v with IDs %v, %v", loaded.AOVs, loaded.ObjectIDs, loaded.MaterialIDs)
+	}
+	for i, want := range film.AOVs {
+		got := loaded.AOVs[i]
+		if got.Kind != want.Kind || got.Components != want.Components || !slices.Equal(got.Data, want.Data) {
+			t.Fatalf("AOV %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	film.AOV(AOVObjectID).Data[1] = 2
+	if err := film.SaveToFile(path); err != nil {
 		t.Fatal(err)
 	}
 	if err := NewFilm().LoadFromFile(path); err == nil {
-		t.Fatal("expected v2 Film to be rejected")
+		t.Fatal("expected an object ID outside the ID table to be rejected")
+	}
+	film.AOV(AOVObjectID).Data[1] = -1
+	film.AddAOV(AOVAlbedo, 2)
+	if err := film.SaveToFile(path); err == nil {
+		t.Fatal("expected a repeated AOV to be rejected")
+	}
+	film.AOVs = film.AOVs[:len(film.AOVs)-1]
+	film.AOV(AOVAlbedo).Components = 2
+	if err := film.SaveToFile(path); err == nil {
+		t.Fatal("expected an albedo that does not match the spectral bins to be rejected")
+	}
+}
+
+func TestSpectralFilmRejectsOldVersion(t *testing.T) {
+	for _, old := range []uint32{2, 3, 4, 5} {
+		path := filepath.Join(t.TempDir(), "old.bin")
+		data := append([]byte(nil), filmFileMagic[:]...)
+		version := make([]byte, 4)
+		binary.LittleEndian.PutUint32(version, old)
+		data = append(data, version...)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewFilm().LoadFromFile(path); err == nil {
+			t.Fatalf("expected v%d Film to be rejected", old)
+		}
 	}
 }
 
@@ -147,3 +229,35 @@ func TestFilmResetPreservesSpectralConfiguration(t *testing.T) {
 		}
 	}
 }
+
+func TestFilmMergeOfCloneKeepsTheMeanAndAddsSamples(t *testing.T) {
+	film := NewFilm(2, 1)
+	film.InitSpectralBins(2, 400, 700)
+	film.AddAOV(AOVDepth, 1)
+	film.Samples = 4
+	film.PixelSamples = []int64{4, 0}
+	film.SpectralBins[1].Data[0] = 3
+	film.AOV(AOVDepth).Pixel(0)[0] = 2
+
+	clone := film.Clone()
+	if err := film.Merge(clone); err != nil {
+		t.Fatal(err)
+	}
+	if film.Samples != 8 || !slices.Equal(film.PixelSamples, []int64{8, 0}) {
+		t.Fatalf("merged counts = %d, %v; want 8, [8 0]", film.Samples, film.PixelSamples)
+	}
+	if got := film.SpectralBins[1].Data[0]; got != 3 {
+		t.Fatalf("merged radiance = %g, want the mean 3", got)
+	}
+	if got := film.AOV(AOVDepth).Pixel(0)[0]; got != 2 {
+		t.Fatalf("merged depth = %g, want the mean 2", got)
+	}
+	if clone.Samples != 4 || clone.PixelSamples[0] != 4 {
+		t.Fatalf("merging changed the clone: %+v", clone)
+	}
+
+	clone.AOVs = nil
+	if err := film.Merge(clone); err == nil {
+		t.Fatal("expected Films with different AOVs to be rejected")
+	}
+}
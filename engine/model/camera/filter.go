@@ -0,0 +1,240 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FilterKind is the serialized name of a pixel reconstruction filter.
+type FilterKind string
+
+const (
+	FilterBox      FilterKind = "box"
+	FilterTriangle FilterKind = "triangle"
+	FilterGaussian FilterKind = "gaussian"
+	FilterMitchell FilterKind = "mitchell"
+	FilterLanczos  FilterKind = "lanczos"
+)
+
+const (
+	// MaxFilterRadius bounds the support, and so the pixels a splat touches.
+	MaxFilterRadius = 16
+	// filterTableSize is the number of cells of the tabulated sampling
+	// density over the support of one axis.
+	filterTableSize = 256
+	// filterIntegrationSteps is the midpoint-rule resolution of the filter
+	// integral over one axis.
+	filterIntegrationSteps = 4096
+)
+
+// ParseFilterKind accepts the canonical filter names; empty selects box.
+func ParseFilterKind(value string) (FilterKind, error) {
+	switch FilterKind(value) {
+	case "", FilterBox:
+		return FilterBox, nil
+	case FilterTriangle, FilterGaussian, FilterMitchell, FilterLanczos:
+		return FilterKind(value), nil
+	default:
+		return "", fmt.Errorf("unsupported filter %q", value)
+	}
+}
+
+// DefaultFilterRadius is the radius, in pixels, a filter has when none is
+// configured. The box default reproduces one pixel's footprint.
+func DefaultFilterRadius(kind FilterKind) float64 {
+	switch kind {
+	case FilterTriangle:
+		return 1
+	case FilterGaussian:
+		return 1.5
+	case FilterMitchell:
+		return 2
+	case FilterLanczos:
+		return 3
+	default:
+		return 0.5
+	}
+}
+
+// Filter is a separable pixel reconstruction filter. Offsets are in raster
+// units from a pixel center, the support of every axis is [-radius, radius),
+// and Evaluate is normalized to unit integral, so a filtered pixel is the
+// filter-weighted mean of the radiance around it.
+//
+// Camera samples importance sample the filter around their pixel and carry
+// the weight f/p. Box and triangle filters are sampled exactly and always
+// weigh 1; the others sample a tabulated |f| whose weights vary slightly, and
+// Mitchell and Lanczos weights turn negative in their negative lobes. Splats
+// land on every pixel whose support contains them, weighted by Evaluate.
+type Filter struct {
+	kind     FilterKind
+	radius   float64
+	integral float64   // Integral of profile over one axis.
+	cdf      []float64 // Cumulative |profile| of the sampling table; nil when sampled exactly.
+}
+
+// NewFilter validates kind and radius, where a zero radius selects the
+// default of kind, and tabulates the filter for sampling.
+func NewFilter(kind FilterKind, radius float64) (*Filter, error) {
+	kind, err := ParseFilterKind(string(kind))
+	if err != nil {
+		return nil, err
+	}
+	if radius == 0 {
+		radius = DefaultFilterRadius(kind)
+	}
+	if !(radius > 0) || radius > MaxFilterRadius {
+		return nil, fmt.Errorf("filter radius %v must be in (0, %d]", radius, MaxFilterRadius)
+	}
+
+	f := &Filter{kind: kind, radius: radius}
+	switch kind {
+	case FilterBox:
+		f.integral = 2 * radius
+		return f, nil
+	case FilterTriangle:
+		f.integral = radius
+		return f, nil
+	}
+
+	step := 2 * radius / filterIntegrationSteps
+	for i := range filterIntegrationSteps {
+		f.integral += f.profile(-radius+(float64(i)+0.5)*step) * step
+	}
+	cell := 2 * radius / filterTableSize
+	f.cdf = make([]float64, filterTableSize+1)
+	for i := range filterTableSize {
+		f.cdf[i+1] = f.cdf[i] + math.Abs(f.profile(-radius+(float64(i)+0.5)*cell))*cell
+	}
+	if !(f.integral > 0) || !(f.cdf[filterTableSize] > 0) {
+		return nil, fmt.Errorf("filter %q with radius %v has no positive mass", kind, radius)
+	}
+	return f, nil
+}
+
+// BoxFilter is the one-pixel box filter, the reconstruction of a render that
+// configures none.
+func BoxFilter() *Filter {
+	return &Filter{kind: FilterBox, radius: 0.5, integral: 1}
+}
+
+func (f *Filter) Kind() FilterKind { return f.kind }
+
+func (f *Filter) Radius() float64 { return f.radius }
+
+// UnitWeights reports whether every camera sample weighs exactly 1, so a
+// pixel's weight sum equals its sample count.
+func (f *Filter) UnitWeights() bool {
+	return f.cdf == nil
+}
+
+// profile is the unnormalized filter along one axis.
+func (f *Filter) profile(x float64) float64 {
+	if x < -f.radius || x >= f.radius {
+		return 0
+	}
+	switch f.kind {
+	case FilterTriangle:
+		return 1 - math.Abs(x)/f.radius
+	case FilterGaussian:
+		// Three standard deviations span the radius; subtracting the value at
+		// the radius makes the filter fall to zero at its edge.
+		sigma := f.radius / 3
+		return max(0, gaussian(x, sigma)-gaussian(f.radius, sigma))
+	case FilterMitchell:
+		return mitchellNetravali(2*x/f.radius, 1.0/3, 1.0/3)
+	case FilterLanczos:
+		return sinc(x) * sinc(x/f.radius)
+	default:
+		return 1
+	}
+}
+
+// Evaluate is the normalized filter at an offset from a pixel center.
+func (f *Filter) Evaluate(offset ...float64) float64 {
+	value := 1.0
+	for _, x := range offset {
+		value *= f.profile(x) / f.integral
+	}
+	return value
+}
+
+// Sample maps a uniform number to an offset along one axis and returns the
+// weight f/(p·integral) of the offset, whose expectation is 1.
+func (f *Filter) Sample(u float64) (offset, weight float64) {
+	switch {
+	case f.kind == FilterBox:
+		return u*2*f.radius - f.radius, 1
+	case f.kind == FilterTriangle:
+		if u < 0.5 {
+			return f.radius * (math.Sqrt(2*u) - 1), 1
+		}
+		return f.radius * (1 - math.Sqrt(2-2*u)), 1
+	}
+
+	total := f.cdf[filterTableSize]
+	target := u * total
+	cell := min(sort.Search(filterTableSize, func(i int) bool { return f.cdf[i+1] > target }), filterTableSize-1)
+	mass := f.cdf[cell+1] - f.cdf[cell]
+	width := 2 * f.radius / filterTableSize
+	t := 0.5
+	if mass > 0 {
+		t = (target - f.cdf[cell]) / mass
+	}
+	offset = min(-f.radius+(float64(cell)+t)*width, math.Nextafter(f.radius, 0))
+	pdf := mass / width / total
+	if pdf <= 0 {
+		return offset, 0
+	}
+	return offset, f.profile(offset) / (pdf * f.integral)
+}
+
+// Splat calls add for every pixel of a width x height Film whose filter
+// support contains the continuous raster position (x, y), with the filter
+// weight at the pixel. For the box filter this is the pixel PixelIndex
+// returns. Pixel centers lie on integer coordinates.
+func (f *Filter) Splat(x, y float64, width, height int, add func(pixel int, weight float64)) {
+	if width <= 0 || height <= 0 || math.IsNaN(x) || math.IsNaN(y) ||
+		math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return
+	}
+	// Pixel p covers x when x-p lies in [-radius, radius).
+	minX, maxX := max(int(math.Floor(x-f.radius))+1, 0), min(int(math.Floor(x+f.radius)), width-1)
+	minY, maxY := max(int(math.Floor(y-f.radius))+1, 0), min(int(math.Floor(y+f.radius)), height-1)
+	for py := minY; py <= maxY; py++ {
+		wy := f.Evaluate(y - float64(py))
+		if wy == 0 {
+			continue
+		}
+		for px := minX; px <= maxX; px++ {
+			if weight := wy * f.Evaluate(x-float64(px)); weight != 0 {
+				add(py*width+px, weight)
+			}
+		}
+	}
+}
+
+func gaussian(x, sigma float64) float64 {
+	return math.Exp(-x * x / (2 * sigma * sigma))
+}
+
+// mitchellNetravali is the cubic of Mitchell and Netravali (1988) on [-2, 2].
+func mitchellNetravali(x, b, c float64) float64 {
+	x = math.Abs(x)
+	switch {
+	case x < 1:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	case x < 2:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	default:
+		return 0
+	}
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,125 @@
+package camera
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+var allFilterKinds = []FilterKind{FilterBox, FilterTriangle, FilterGaussian, FilterMitchell, FilterLanczos}
+
+func TestParseFilterKind(t *testing.T) {
+	if kind, err := ParseFilterKind(""); err != nil || kind != FilterBox {
+		t.Fatalf("empty filter = %q, %v; want box", kind, err)
+	}
+	for _, kind := range allFilterKinds {
+		if parsed, err := ParseFilterKind(string(kind)); err != nil || parsed != kind {
+			t.Fatalf("ParseFilterKind(%q) = %q, %v", kind, parsed, err)
+		}
+	}
+	if _, err := ParseFilterKind("sinc"); err == nil {
+		t.Fatal("expected unknown filter to be rejected")
+	}
+}
+
+func TestNewFilterValidatesRadius(t *testing.T) {
+	for _, radius := range []float64{-1, math.NaN(), math.Inf(1), MaxFilterRadius + 1} {
+		if _, err := NewFilter(FilterGaussian, radius); err == nil {
+			t.Fatalf("expected radius %v to be rejected", radius)
+		}
+	}
+	filter, err := NewFilter(FilterMitchell, 0)
+	if err != nil || filter.Radius() != DefaultFilterRadius(FilterMitchell) {
+		t.Fatalf("default Mitchell radius = %v, %v", filter, err)
+	}
+}
+
+func TestFilterIsNormalized(t *testing.T) {
+	for _, kind := range allFilterKinds {
+		filter, err := NewFilter(kind, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const steps = 2000
+		step := 2 * filter.Radius() / steps
+		integral := 0.0
+		for i := range steps {
+			integral += filter.Evaluate(-filter.Radius()+(float64(i)+0.5)*step) * step
+		}
+		if math.Abs(integral-1) > 1e-3 {
+			t.Fatalf("%s integral = %g, want 1", kind, integral)
+		}
+	}
+}
+
+// The importance-sampled estimator E[w g(x)] must equal the filtered value
+// of g, the integral of g against the normalized filter.
+func TestFilterSamplingIsUnbiased(t *testing.T) {
+	g := func(x float64) float64 { return 1 + x + 0.5*x*x }
+	for _, kind := range allFilterKinds {
+		filter, err := NewFilter(kind, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const steps = 4000
+		step := 2 * filter.Radius() / steps
+		want := 0.0
+		for i := range steps {
+			x := -filter.Radius() + (float64(i)+0.5)*step
+			want += filter.Evaluate(x) * g(x) * step
+		}
+
+		rng := rand.New(rand.NewPCG(1, 2))
+		const samples = 200000
+		got := 0.0
+		for range samples {
+			offset, weight := filter.Sample(rng.Float64())
+			if offset < -filter.Radius() || offset >= filter.Radius() {
+				t.Fatalf("%s offset %g outside radius %g", kind, offset, filter.Radius())
+			}
+			if filter.UnitWeights() && weight != 1 {
+				t.Fatalf("%s weight = %g, want exactly 1", kind, weight)
+			}
+			got += weight * g(offset)
+		}
+		got /= samples
+		if math.Abs(got-want) > 0.01*math.Abs(want) {
+			t.Fatalf("%s filtered estimate = %g, want %g", kind, got, want)
+		}
+	}
+}
+
+func TestBoxFilterSplatsToPixelIndex(t *testing.T) {
+	filter := BoxFilter()
+	rng := rand.New(rand.NewPCG(3, 4))
+	for range 1000 {
+		x, y := rng.Float64()*6-1, rng.Float64()*5-1
+		want, ok := PixelIndex(x, y, 4, 3)
+		calls := 0
+		filter.Splat(x, y, 4, 3, func(pixel int, weight float64) {
+			calls++
+			if !ok || pixel != want || weight != 1 {
+				t.Fatalf("splat at (%g, %g) reached pixel %d with weight %g; PixelIndex = %d, %v", x, y, pixel, weight, want, ok)
+			}
+		})
+		if ok && calls != 1 {
+			t.Fatalf("splat at (%g, %g) reached %d pixels, want 1", x, y, calls)
+		}
+	}
+}
+
+func TestFilterSplatWeightsSumToOneInsideFilm(t *testing.T) {
+	for _, kind := range allFilterKinds {
+		filter, err := NewFilter(kind, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0.0
+		filter.Splat(10.3, 9.8, 20, 20, func(_ int, weight float64) { total += weight })
+		// A discrete sum of the filter is only close to its integral; the
+		// truncated Gaussian and the sincs deviate by a few percent.
+		if math.Abs(total-1) > 0.05 {
+			t.Fatalf("%s splat weights sum to %g, want about 1", kind, total)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+// Tabulated spectra share a 10 nm grid over the engine's wavelength range.
+const (
+	daylightGridStart = 380.0
+	daylightGridStep  = 10.0
+	daylightGridSize  = 38
+)
+
+// daylightGrid is a spectrum tabulated on the daylight grid.
+type daylightGrid [daylightGridSize]float64
+
+// CIE daylight components S0, S1 and S2 (CIE 15:2004, table T.2). A daylight
+// spectrum of chromaticity (x, y) is S0 + M1 S1 + M2 S2.
+var (
+	daylightS0 = daylightGrid{
+		63.4, 65.8, 94.8, 104.8, 105.9, 96.8, 113.9, 125.6, 125.5, 121.3,
+		121.3, 113.5, 113.1, 110.8, 106.5, 108.8, 105.3, 104.4, 100.0, 96.0,
+		95.1, 89.1, 90.5, 90.3, 88.4, 84.0, 85.1, 81.9, 82.6, 84.9,
+		81.3, 71.9, 74.3, 76.4, 63.3, 71.7, 77.0, 65.2,
+	}
+	daylightS1 = daylightGrid{
+		38.5, 35.0, 43.4, 46.3, 43.9, 37.1, 36.7, 35.9, 32.6, 27.9,
+		24.3, 20.1, 16.2, 13.2, 8.6, 6.1, 4.2, 1.9, 0.0, -1.6,
+		-3.5, -3.5, -5.8, -7.2, -8.6, -9.5, -10.9, -10.7, -12.0, -14.0,
+		-13.6, -12.0, -13.3, -12.9, -10.6, -11.6, -12.2, -10.2,
+	}
+	daylightS2 = daylightGrid{
+		3.0, 1.2, -1.1, -0.5, -0.7, -1.2, -2.6, -2.9, -2.8, -2.6,
+		-2.6, -1.8, -1.5, -1.3, -1.2, -1.0, -0.5, -0.3, 0.0, 0.2,
+		0.5, 2.1, 3.2, 4.1, 4.7, 5.1, 6.7, 7.3, 8.6, 9.8,
+		10.2, 8.3, 9.6, 8.5, 7.0, 7.6, 8.0, 6.7,
+	}
+)
+
+// extraterrestrialSun is the solar spectral radiance above the atmosphere
+// used by Preetham, Shirley and Smits (1999), in 100 W·m⁻²·sr⁻¹·nm⁻¹.
+var extraterrestrialSun = daylightGrid{
+	165.5, 162.3, 211.2, 258.8, 258.2, 242.3, 267.6, 296.6, 305.4, 300.6,
+	306.6, 288.3, 287.1, 278.2, 271.0, 272.3, 263.6, 255.0, 250.6, 253.1,
+	253.5, 251.3, 246.3, 241.7, 236.8, 232.1, 228.2, 223.4, 219.7, 215.3,
+	211.0, 207.3, 202.4, 198.7, 194.3, 190.7, 186.3, 182.6,
+}
+
+// at interpolates linearly and holds the end values outside the grid.
+func (g *daylightGrid) at(wavelengthNM float64) float64 {
+	t := (wavelengthNM - daylightGridStart) / daylightGridStep
+	if t <= 0 {
+		return g[0]
+	}
+	if t >= float64(len(g)-1) {
+		return g[len(g)-1]
+	}
+	i := int(t)
+	t -= float64(i)
+	return g[i]*(1-t) + g[i+1]*t
+}
+
+// daylightLuminance holds 683 ∫ S_k ȳ dλ for S0, S1 and S2, so a daylight
+// spectrum c (S0 + M1 S1 + M2 S2) has luminance c times their combination.
+var daylightLuminance = [3]float64{
+	luminance(daylightS0.at),
+	luminance(daylightS1.at),
+	luminance(daylightS2.at),
+}
+
+// daylightXYZ holds the engine-normalized XYZ of S0, S1 and S2.
+var daylightXYZ = [3]optics.XYZ{
+	spectrumXYZ(daylightS0.at),
+	spectrumXYZ(daylightS1.at),
+	spectrumXYZ(daylightS2.at),
+}
+
+const spectrumIntegrationSteps = 370
+
+// luminance is the photometric luminance 683 ∫ L ȳ dλ, in cd/m², of a
+// spectral radiance in W·m⁻²·sr⁻¹·nm⁻¹.
+func luminance(radiance func(wavelengthNM float64) float64) float64 {
+	step := (optics.WavelengthMax - optics.WavelengthMin) / spectrumIntegrationSteps
+	sum := 0.0
+	for i := 0; i < spectrumIntegrationSteps; i++ {
+		wavelength := optics.WavelengthMin + (float64(i)+0.5)*step
+		sum += radiance(wavelength) * optics.WavelengthToXYZ(wavelength)[1]
+	}
+	return 683 * sum * step
+}
+
+// spectrumXYZ is the XYZ the film assigns to a spectrum, normalized like
+// optics.SampledSpectrumToLinearSRGB so a constant spectrum has Y = 1.
+func spectrumXYZ(value func(wavelengthNM float64) float64) optics.XYZ {
+	step := (optics.WavelengthMax - optics.WavelengthMin) / spectrumIntegrationSteps
+	var xyz optics.XYZ
+	for i := 0; i < spectrumIntegrationSteps; i++ {
+		wavelength := optics.WavelengthMin + (float64(i)+0.5)*step
+		xyz = xyz.Add(optics.SpectralPowerToXYZ(wavelength, optics.UniformWavelengthPDF(), value(wavelength)))
+	}
+	return xyz.MulScalar(1.0 / spectrumIntegrationSteps)
+}
+
+// xyzToRGBRadiance converts a film XYZ to the linear sRGB radiance of RGB
+// contexts, dropping the negative lobes outside the gamut.
+func xyzToRGBRadiance(xyz optics.XYZ) optics.Spectrum {
+	r, g, b := optics.XYZToLinearSRGB(xyz[0], xyz[1], xyz[2])
+	return optics.NewRGBSpectrum(math.Max(0, r), math.Max(0, g), math.Max(0, b))
+}
+
+// evalSpectrum evaluates value at the wavelengths ctx traces, or returns rgb
+// for an RGB context.
+func evalSpectrum(ctx optics.WavelengthContext, value func(wavelengthNM float64) float64, rgb func() optics.Spectrum) optics.Spectrum {
+	if ctx != nil {
+		if wavelengths := ctx.SpectralWavelengthsNM(); len(wavelengths) > 0 {
+			values := make([]float64, len(wavelengths))
+			for i, wavelength := range wavelengths {
+				values[i] = value(wavelength)
+			}
+			return optics.NewSampledSpectrum(values)
+		}
+		if wavelength := ctx.SpectralWavelengthNM(); wavelength > 0 {
+			return optics.NewSampledSpectrum([]float64{value(wavelength)})
+		}
+	}
+	return rgb()
+}
@@ -0,0 +1,323 @@
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Delta is a light concentrated at a point or along a single direction. No
+// ray can hit one, so integrators reach it only by sampling it. Directions
+// are unit world-space vectors.
+type Delta interface {
+	// Incident is the light arriving at point, if any does.
+	Incident(ctx optics.WavelengthContext, point *mat.VecDense) (Incident, bool)
+	// SampleEmission samples a ray leaving the light. Lights without a
+	// position aim their rays at the disk of scene that faces them.
+	SampleEmission(ctx optics.WavelengthContext, u maths.Sample2D, scene Sphere) (Emission, bool)
+	// EmissionPDF is the density with which SampleEmission sends a ray
+	// through point, per unit area perpendicular to that ray.
+	EmissionPDF(point *mat.VecDense, scene Sphere) float64
+	// FixedDirection reports whether every ray of the light is parallel.
+	FixedDirection() bool
+}
+
+// Incident is the light a Delta light sends to a point: the direction toward
+// the light, the distance to it, infinite for a directional light, and the
+// irradiance on a surface facing it.
+type Incident struct {
+	Direction  *mat.VecDense
+	Distance   float64
+	Irradiance optics.Spectrum
+}
+
+// Emission is a ray leaving a Delta light. Weight is the power the ray
+// carries divided by the density of sampling it.
+type Emission struct {
+	Origin    *mat.VecDense
+	Direction *mat.VecDense
+	Weight    optics.Spectrum
+}
+
+// Sphere bounds the scene for lights that illuminate it from outside.
+type Sphere struct {
+	Center [3]float64
+	Radius float64
+}
+
+// Valid reports whether s has a finite, positive radius.
+func (s Sphere) Valid() bool {
+	return s.Radius > 0 && !math.IsInf(s.Radius, 0) && !math.IsNaN(s.Radius)
+}
+
+// Point emits its intensity, in W·sr⁻¹ per unit of the spectral parameter,
+// equally in every direction from Position.
+type Point struct {
+	Position  *mat.VecDense
+	Intensity optics.SpectralParameter
+}
+
+func NewPoint(position *mat.VecDense, intensity optics.SpectralParameter) *Point {
+	return &Point{Position: position, Intensity: intensity}
+}
+
+func (p *Point) Incident(ctx optics.WavelengthContext, point *mat.VecDense) (Incident, bool) {
+	direction, distance, ok := toward(point, p.Position)
+	if !ok {
+		return Incident{}, false
+	}
+	return Incident{
+		Direction:  direction,
+		Distance:   distance,
+		Irradiance: p.Intensity.Eval(ctx).MulScalar(1 / (distance * distance)),
+	}, true
+}
+
+func (p *Point) SampleEmission(ctx optics.WavelengthContext, u maths.Sample2D, _ Sphere) (Emission, bool) {
+	z := 1 - 2*u.U
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u.V
+	return Emission{
+		Origin:    mat.VecDenseCopyOf(p.Position),
+		Direction: mat.NewVecDense(3, []float64{r * math.Cos(phi), r * math.Sin(phi), z}),
+		Weight:    p.Intensity.Eval(ctx).MulScalar(4 * math.Pi),
+	}, true
+}
+
+func (p *Point) EmissionPDF(point *mat.VecDense, _ Sphere) float64 {
+	_, distance, ok := toward(point, p.Position)
+	if !ok {
+		return 0
+	}
+	return 1 / (4 * math.Pi * distance * distance)
+}
+
+func (p *Point) FixedDirection() bool { return false }
+
+// Spot is a point light restricted to a cone around Direction. Its intensity
+// falls off smoothly from the full value inside the falloff angle to zero at
+// the cone angle.
+type Spot struct {
+	Position  *mat.VecDense
+	Direction *mat.VecDense
+	Intensity optics.SpectralParameter
+
+	cosCone, cosFalloff float64
+}
+
+// NewSpot builds a spot light. coneAngle and falloffStart are half-angles in
+// degrees, with falloffStart no larger than coneAngle.
+func NewSpot(position, direction *mat.VecDense, intensity optics.SpectralParameter, coneAngle, falloffStart float64) *Spot {
+	axis := mat.VecDenseCopyOf(direction)
+	axis.ScaleVec(1/mat.Norm(axis, 2), axis)
+	return &Spot{
+		Position: position, Direction: axis, Intensity: intensity,
+		cosCone:    math.Cos(coneAngle * math.Pi / 180),
+		cosFalloff: math.Cos(math.Min(falloffStart, coneAngle) * math.Pi / 180),
+	}
+}
+
+func (s *Spot) Incident(ctx optics.WavelengthContext, point *mat.VecDense) (Incident, bool) {
+	direction, distance, ok := toward(point, s.Position)
+	if !ok {
+		return Incident{}, false
+	}
+	falloff := s.falloff(-mat.Dot(direction, s.Direction))
+	if falloff <= 0 {
+		return Incident{}, false
+	}
+	return Incident{
+		Direction:  direction,
+		Distance:   distance,
+		Irradiance: s.Intensity.Eval(ctx).MulScalar(falloff / (distance * distance)),
+	}, true
+}
+
+func (s *Spot) SampleEmission(ctx optics.WavelengthContext, u maths.Sample2D, _ Sphere) (Emission, bool) {
+	frame, ok := maths.NewFrameFromNormal(s.Direction)
+	if !ok {
+		return Emission{}, false
+	}
+	cosTheta := 1 - u.U*(1-s.cosCone)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u.V
+	falloff := s.falloff(cosTheta)
+	if falloff <= 0 {
+		return Emission{}, false
+	}
+	return Emission{
+		Origin:    mat.VecDenseCopyOf(s.Position),
+		Direction: frame.LocalToWorld(maths.NewDirection(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta)),
+		Weight:    s.Intensity.Eval(ctx).MulScalar(falloff / s.conePDF()),
+	}, true
+}
+
+func (s *Spot) EmissionPDF(point *mat.VecDense, _ Sphere) float64 {
+	direction, distance, ok := toward(point, s.Position)
+	if !ok || -mat.Dot(direction, s.Direction) < s.cosCone {
+		return 0
+	}
+	return s.conePDF() / (distance * distance)
+}
+
+func (s *Spot) FixedDirection() bool { return false }
+
+// falloff is the fraction of the intensity emitted at cosTheta from the axis.
+func (s *Spot) falloff(cosTheta float64) float64 {
+	if cosTheta < s.cosCone {
+		return 0
+	}
+	if cosTheta >= s.cosFalloff {
+		return 1
+	}
+	t := (cosTheta - s.cosCone) / (s.cosFalloff - s.cosCone)
+	return t * t * (3 - 2*t)
+}
+
+func (s *Spot) conePDF() float64 {
+	return 1 / (2 * math.Pi * (1 - s.cosCone))
+}
+
+// Directional lights the whole scene from infinitely far away along
+// Direction, with the given irradiance on a surface facing it.
+type Directional struct {
+	Direction  *mat.VecDense
+	Irradiance optics.SpectralParameter
+}
+
+func NewDirectional(direction *mat.VecDense, irradiance optics.SpectralParameter) *Directional {
+	d := mat.VecDenseCopyOf(direction)
+	d.ScaleVec(1/mat.Norm(d, 2), d)
+	return &Directional{Direction: d, Irradiance: irradiance}
+}
+
+func (d *Directional) Incident(ctx optics.WavelengthContext, _ *mat.VecDense) (Incident, bool) {
+	return Incident{
+		Direction:  reversed(d.Direction),
+		Distance:   math.Inf(1),
+		Irradiance: d.Irradiance.Eval(ctx),
+	}, true
+}
+
+// SampleEmission starts rays on the disk of scene that faces the light, one
+// radius in front of the scene's center.
+func (d *Directional) SampleEmission(ctx optics.WavelengthContext, u maths.Sample2D, scene Sphere) (Emission, bool) {
+	if !scene.Valid() {
+		return Emission{}, false
+	}
+	origin, ok := diskPoint(d.Direction, mat.NewVecDense(3, scene.Center[:]), -scene.Radius, scene.Radius, u)
+	if !ok {
+		return Emission{}, false
+	}
+	return Emission{
+		Origin:    origin,
+		Direction: mat.VecDenseCopyOf(d.Direction),
+		Weight:    d.Irradiance.Eval(ctx).MulScalar(math.Pi * scene.Radius * scene.Radius),
+	}, true
+}
+
+func (d *Directional) EmissionPDF(_ *mat.VecDense, scene Sphere) float64 {
+	if !scene.Valid() {
+		return 0
+	}
+	return 1 / (math.Pi * scene.Radius * scene.Radius)
+}
+
+func (d *Directional) FixedDirection() bool { return true }
+
+// Beam is a collimated beam: parallel rays of the given irradiance leave the
+// disk of Radius around Position along Direction.
+type Beam struct {
+	Position   *mat.VecDense
+	Direction  *mat.VecDense
+	Radius     float64
+	Irradiance optics.SpectralParameter
+}
+
+func NewBeam(position, direction *mat.VecDense, radius float64, irradiance optics.SpectralParameter) *Beam {
+	d := mat.VecDenseCopyOf(direction)
+	d.ScaleVec(1/mat.Norm(d, 2), d)
+	return &Beam{Position: position, Direction: d, Radius: radius, Irradiance: irradiance}
+}
+
+func (b *Beam) Incident(ctx optics.WavelengthContext, point *mat.VecDense) (Incident, bool) {
+	distance, ok := b.covers(point)
+	if !ok {
+		return Incident{}, false
+	}
+	return Incident{
+		Direction:  reversed(b.Direction),
+		Distance:   distance,
+		Irradiance: b.Irradiance.Eval(ctx),
+	}, true
+}
+
+func (b *Beam) SampleEmission(ctx optics.WavelengthContext, u maths.Sample2D, _ Sphere) (Emission, bool) {
+	origin, ok := diskPoint(b.Direction, b.Position, 0, b.Radius, u)
+	if !ok {
+		return Emission{}, false
+	}
+	return Emission{
+		Origin:    origin,
+		Direction: mat.VecDenseCopyOf(b.Direction),
+		Weight:    b.Irradiance.Eval(ctx).MulScalar(math.Pi * b.Radius * b.Radius),
+	}, true
+}
+
+func (b *Beam) EmissionPDF(point *mat.VecDense, _ Sphere) float64 {
+	if _, ok := b.covers(point); !ok {
+		return 0
+	}
+	return 1 / (math.Pi * b.Radius * b.Radius)
+}
+
+func (b *Beam) FixedDirection() bool { return true }
+
+// covers reports whether point lies in the beam, and how far it is from the
+// emitting disk.
+func (b *Beam) covers(point *mat.VecDense) (float64, bool) {
+	if point == nil || point.Len() != 3 {
+		return 0, false
+	}
+	offset := mat.NewVecDense(3, nil)
+	offset.SubVec(point, b.Position)
+	along := mat.Dot(offset, b.Direction)
+	across2 := mat.Dot(offset, offset) - along*along
+	return along, along > 0 && across2 <= b.Radius*b.Radius
+}
+
+// toward returns the unit direction and distance from point to position.
+func toward(point, position *mat.VecDense) (*mat.VecDense, float64, bool) {
+	if point == nil || point.Len() != position.Len() {
+		return nil, 0, false
+	}
+	direction := mat.NewVecDense(position.Len(), nil)
+	direction.SubVec(position, point)
+	distance := mat.Norm(direction, 2)
+	if distance <= 0 || math.IsInf(distance, 0) || math.IsNaN(distance) {
+		return nil, 0, false
+	}
+	direction.ScaleVec(1/distance, direction)
+	return direction, distance, true
+}
+
+func reversed(v *mat.VecDense) *mat.VecDense {
+	r := mat.VecDenseCopyOf(v)
+	r.ScaleVec(-1, r)
+	return r
+}
+
+// diskPoint samples the disk of radius perpendicular to axis whose center
+// lies offset along axis from center.
+func diskPoint(axis, center *mat.VecDense, offset, radius float64, u maths.Sample2D) (*mat.VecDense, bool) {
+	frame, ok := maths.NewFrameFromNormal(axis)
+	if !ok {
+		return nil, false
+	}
+	r, phi := radius*math.Sqrt(u.U), 2*math.Pi*u.V
+	point := frame.LocalToWorld(maths.NewDirection(r*math.Cos(phi), r*math.Sin(phi), offset))
+	point.AddVec(point, center)
+	return point, true
+}
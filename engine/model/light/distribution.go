@@ -0,0 +1,114 @@
+package light
+
+import "sort"
+
+// Distribution1D is a piecewise-constant density on [0, 1] with one bucket
+// per function value.
+type Distribution1D struct {
+	function []float64
+	cdf      []float64
+	integral float64
+}
+
+// NewDistribution1D builds the distribution proportional to function, whose
+// values must be non-negative. An all-zero function has zero integral and is
+// sampled uniformly, so callers can still draw from it.
+func NewDistribution1D(function []float64) Distribution1D {
+	n := len(function)
+	d := Distribution1D{function: append([]float64(nil), function...), cdf: make([]float64, n+1)}
+	for i, value := range function {
+		d.cdf[i+1] = d.cdf[i] + value/float64(n)
+	}
+	d.integral = d.cdf[n]
+	for i := 1; i <= n; i++ {
+		if d.integral > 0 {
+			d.cdf[i] /= d.integral
+		} else {
+			d.cdf[i] = float64(i) / float64(n)
+		}
+	}
+	return d
+}
+
+// Len is the number of buckets.
+func (d Distribution1D) Len() int { return len(d.function) }
+
+// Integral is the integral of the function over [0, 1].
+func (d Distribution1D) Integral() float64 { return d.integral }
+
+// Sample maps u in [0, 1) to a point x in [0, 1) and returns the density at
+// x and the bucket that contains it.
+func (d Distribution1D) Sample(u float64) (x, pdf float64, index int) {
+	n := len(d.function)
+	index = sort.Search(n, func(i int) bool { return d.cdf[i+1] > u })
+	if index >= n {
+		index = n - 1
+	}
+	offset := u - d.cdf[index]
+	if width := d.cdf[index+1] - d.cdf[index]; width > 0 {
+		offset /= width
+	}
+	return (float64(index) + offset) / float64(n), d.PDF(index), index
+}
+
+// PDF is the density of bucket index with respect to x.
+func (d Distribution1D) PDF(index int) float64 {
+	if index < 0 || index >= len(d.function) {
+		return 0
+	}
+	if d.integral <= 0 {
+		return 1
+	}
+	return d.function[index] / d.integral
+}
+
+// Distribution2D is a piecewise-constant density on [0, 1]² sampled as a
+// marginal over rows (v) followed by the conditional row (u).
+type Distribution2D struct {
+	conditional []Distribution1D
+	marginal    Distribution1D
+}
+
+// NewDistribution2D builds the distribution proportional to a width×height
+// function stored row-major.
+func NewDistribution2D(function []float64, width, height int) Distribution2D {
+	d := Distribution2D{conditional: make([]Distribution1D, height)}
+	rows := make([]float64, height)
+	for v := 0; v < height; v++ {
+		d.conditional[v] = NewDistribution1D(function[v*width : (v+1)*width])
+		rows[v] = d.conditional[v].Integral()
+	}
+	d.marginal = NewDistribution1D(rows)
+	return d
+}
+
+// Integral is the integral of the function over [0, 1]².
+func (d Distribution2D) Integral() float64 { return d.marginal.Integral() }
+
+// Sample maps u to a point (x, y) in [0, 1)² and returns its density.
+func (d Distribution2D) Sample(u, v float64) (x, y, pdf float64) {
+	y, pdfY, row := d.marginal.Sample(v)
+	x, pdfX, _ := d.conditional[row].Sample(u)
+	return x, y, pdfX * pdfY
+}
+
+// PDF is the density at (x, y) in [0, 1]².
+func (d Distribution2D) PDF(x, y float64) float64 {
+	row := bucket(y, d.marginal.Len())
+	column := bucket(x, d.conditional[row].Len())
+	if d.marginal.Integral() <= 0 {
+		return 0
+	}
+	return d.conditional[row].function[column] / d.marginal.Integral()
+}
+
+func bucket(x float64, n int) int {
+	i := int(x * float64(n))
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
@@ -0,0 +1,89 @@
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/utils/hdrio"
+	"gonum.org/v1/gonum/mat"
+)
+
+// EnvironmentMap is an equirectangular HDR image wrapped around the scene
+// with +z up: the top row looks along +z, the bottom row along -z, and the
+// columns sweep the azimuth atan2(y, x) from 0 to 2π. Each texel is a
+// constant-radiance patch, and directions are importance-sampled by texel
+// brightness times the solid angle it covers.
+type EnvironmentMap struct {
+	image        *hdrio.Image
+	scale        float64
+	distribution Distribution2D
+}
+
+// NewEnvironmentMap wraps image scaled by scale.
+func NewEnvironmentMap(image *hdrio.Image, scale float64) *EnvironmentMap {
+	width, height := image.Width, image.Height
+	weights := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		sinTheta := math.Sin(math.Pi * (float64(y) + 0.5) / float64(height))
+		for x := 0; x < width; x++ {
+			rgb := image.At(x, y)
+			if weight := (rgb[0] + rgb[1] + rgb[2]) / 3 * sinTheta; weight > 0 && !math.IsInf(weight, 0) {
+				weights[y*width+x] = weight
+			}
+		}
+	}
+	return &EnvironmentMap{image: image, scale: scale, distribution: NewDistribution2D(weights, width, height)}
+}
+
+func (m *EnvironmentMap) Radiance(ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum {
+	u, v := equirectUV(direction)
+	return m.texel(ctx, u, v)
+}
+
+func (m *EnvironmentMap) Sample(ctx optics.WavelengthContext, sample maths.Sample2D) (Sample, bool) {
+	if m.distribution.Integral() <= 0 {
+		return Sample{}, false
+	}
+	u, v, pdfUV := m.distribution.Sample(sample.U, sample.V)
+	theta, phi := math.Pi*v, 2*math.Pi*u
+	sinTheta := math.Sin(theta)
+	if pdfUV <= 0 || sinTheta <= 0 {
+		return Sample{}, false
+	}
+	direction := mat.NewVecDense(3, []float64{sinTheta * math.Cos(phi), sinTheta * math.Sin(phi), math.Cos(theta)})
+	return Sample{
+		Direction: direction,
+		Radiance:  m.texel(ctx, u, v),
+		PDF:       pdfUV / (2 * math.Pi * math.Pi * sinTheta),
+	}, true
+}
+
+func (m *EnvironmentMap) PDF(direction *mat.VecDense) float64 {
+	u, v := equirectUV(direction)
+	sinTheta := math.Sin(math.Pi * v)
+	if sinTheta <= 0 {
+		return 0
+	}
+	return m.distribution.PDF(u, v) / (2 * math.Pi * math.Pi * sinTheta)
+}
+
+func (m *EnvironmentMap) texel(ctx optics.WavelengthContext, u, v float64) optics.Spectrum {
+	rgb := m.image.At(bucket(u, m.image.Width), bucket(v, m.image.Height))
+	return upliftRadiance(optics.NewRGBSpectrum(rgb[0], rgb[1], rgb[2]).MulScalar(m.scale), ctx)
+}
+
+// equirectUV maps a direction to image coordinates in [0, 1]², with v = 0 at
+// the top row.
+func equirectUV(direction *mat.VecDense) (u, v float64) {
+	x, y, z := direction.AtVec(0), direction.AtVec(1), direction.AtVec(2)
+	norm := math.Sqrt(x*x + y*y + z*z)
+	if norm <= 0 {
+		return 0, 0
+	}
+	phi := math.Atan2(y, x)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return phi / (2 * math.Pi), math.Acos(math.Max(-1, math.Min(1, z/norm))) / math.Pi
+}
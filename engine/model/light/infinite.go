@@ -0,0 +1,78 @@
+// Package light holds the emitters that are not attached to scene surfaces.
+// Area lights stay on object materials; an Infinite light surrounds the
+// scene and is reached by every ray that escapes it, and a Delta light sits
+// at a point or shines along one direction.
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Infinite is a light at infinite distance. Directions are unit world-space
+// vectors pointing from the scene toward the light, and densities are with
+// respect to solid angle.
+type Infinite interface {
+	// Radiance is the radiance arriving along -direction.
+	Radiance(ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum
+	Sample(ctx optics.WavelengthContext, u maths.Sample2D) (Sample, bool)
+	PDF(direction *mat.VecDense) float64
+}
+
+// Sample is a direction drawn from an Infinite light.
+type Sample struct {
+	Direction *mat.VecDense
+	Radiance  optics.Spectrum
+	PDF       float64
+}
+
+// ConstantSky emits the same radiance from every direction.
+type ConstantSky struct {
+	Spectrum optics.SpectralParameter
+}
+
+func NewConstantSky(radiance optics.SpectralParameter) *ConstantSky {
+	return &ConstantSky{Spectrum: radiance}
+}
+
+func (s *ConstantSky) Radiance(ctx optics.WavelengthContext, _ *mat.VecDense) optics.Spectrum {
+	return s.Spectrum.Eval(ctx)
+}
+
+func (s *ConstantSky) Sample(ctx optics.WavelengthContext, u maths.Sample2D) (Sample, bool) {
+	z := 1 - 2*u.U
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * u.V
+	direction := mat.NewVecDense(3, []float64{r * math.Cos(phi), r * math.Sin(phi), z})
+	return Sample{Direction: direction, Radiance: s.Radiance(ctx, direction), PDF: 1 / (4 * math.Pi)}, true
+}
+
+func (s *ConstantSky) PDF(*mat.VecDense) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+// SumRadiance is the radiance all of lights send along -direction.
+func SumRadiance(lights []Infinite, ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum {
+	var radiance optics.Spectrum
+	for _, infinite := range lights {
+		radiance = radiance.Add(infinite.Radiance(ctx, direction))
+	}
+	return radiance
+}
+
+// upliftRadiance turns an RGB radiance into the spectral samples requested by
+// ctx. Unlike reflectance parameters, emitted RGB is not clamped.
+func upliftRadiance(rgb optics.Spectrum, ctx optics.WavelengthContext) optics.Spectrum {
+	if ctx != nil {
+		if wavelengths := ctx.SpectralWavelengthsNM(); len(wavelengths) > 0 {
+			return rgb.UpliftRGBToSampled(wavelengths)
+		}
+		if wavelength := ctx.SpectralWavelengthNM(); wavelength > 0 {
+			return rgb.UpliftRGBToSampled([]float64{wavelength})
+		}
+	}
+	return rgb
+}
@@ -0,0 +1,302 @@
+package light
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
+	"github.com/Algo2147483647/ray/engine/utils/hdrio"
+	"gonum.org/v1/gonum/mat"
+)
+
+type wavelengths []float64
+
+func (w wavelengths) SpectralWavelengthNM() float64 {
+	if len(w) == 0 {
+		return 0
+	}
+	return w[0]
+}
+func (w wavelengths) SpectralWavelengthsNM() []float64 { return w }
+
+func testImage(width, height int, value func(x, y int) [3]float32) *hdrio.Image {
+	img := &hdrio.Image{Width: width, Height: height, Pixels: make([]float32, 3*width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rgb := value(x, y)
+			copy(img.Pixels[3*(y*width+x):], rgb[:])
+		}
+	}
+	return img
+}
+
+func TestDistribution2DSamplesMatchTheirPDF(t *testing.T) {
+	function := []float64{0, 1, 2, 3, 0, 0, 5, 1, 4, 0, 0, 2}
+	d := NewDistribution2D(function, 4, 3)
+	sum := 0.0
+	for _, value := range function {
+		sum += value
+	}
+	if want := sum / 12; math.Abs(d.Integral()-want) > 1e-12 {
+		t.Fatalf("integral = %g, want %g", d.Integral(), want)
+	}
+	for i := 0; i < 64; i++ {
+		for j := 0; j < 64; j++ {
+			x, y, pdf := d.Sample((float64(i)+0.5)/64, (float64(j)+0.5)/64)
+			if pdf <= 0 {
+				t.Fatalf("sample (%g, %g) has density %g", x, y, pdf)
+			}
+			if want := d.PDF(x, y); math.Abs(pdf-want) > 1e-12 {
+				t.Fatalf("sample (%g, %g) density %g, want %g", x, y, pdf, want)
+			}
+		}
+	}
+}
+
+func TestEnvironmentMapSamplesAgreeWithPDFAndRadiance(t *testing.T) {
+	img := testImage(16, 8, func(x, y int) [3]float32 {
+		if x == 3 && y == 2 {
+			return [3]float32{50, 40, 30}
+		}
+		return [3]float32{0.1 * float32(y+1), 0.2, 0.05 * float32(x)}
+	})
+	env := NewEnvironmentMap(img, 2)
+
+	for i := 0; i < 200; i++ {
+		u := maths.Sample2D{U: math.Mod(float64(i)*0.6180339887, 1), V: (float64(i) + 0.5) / 200}
+		sample, ok := env.Sample(nil, u)
+		if !ok {
+			t.Fatalf("sample %d failed", i)
+		}
+		if want := env.PDF(sample.Direction); math.Abs(sample.PDF-want) > 1e-9*want {
+			t.Fatalf("sample %d density %g, want %g", i, sample.PDF, want)
+		}
+		if want := env.Radiance(nil, sample.Direction); !sample.Radiance.AlmostEqual(want, 1e-9) {
+			t.Fatalf("sample %d radiance %v, want %v", i, sample.Radiance, want)
+		}
+	}
+}
+
+func TestEnvironmentMapPDFIntegratesToOne(t *testing.T) {
+	img := testImage(8, 4, func(x, y int) [3]float32 { return [3]float32{float32(x + 1), float32(y), 1} })
+	env := NewEnvironmentMap(img, 1)
+
+	// Midpoint quadrature over (θ, φ) with dω = sinθ dθ dφ.
+	const n = 400
+	total := 0.0
+	for i := 0; i < n; i++ {
+		theta := math.Pi * (float64(i) + 0.5) / n
+		for j := 0; j < n; j++ {
+			phi := 2 * math.Pi * (float64(j) + 0.5) / n
+			direction := mat.NewVecDense(3, []float64{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)})
+			total += env.PDF(direction) * math.Sin(theta) * (math.Pi / n) * (2 * math.Pi / n)
+		}
+	}
+	if math.Abs(total-1) > 1e-3 {
+		t.Fatalf("PDF integrates to %g, want 1", total)
+	}
+}
+
+func TestEnvironmentMapMapsTopRowToPositiveZ(t *testing.T) {
+	img := testImage(4, 2, func(_, y int) [3]float32 {
+		if y == 0 {
+			return [3]float32{1, 1, 1}
+		}
+		return [3]float32{}
+	})
+	env := NewEnvironmentMap(img, 3)
+	up := env.Radiance(nil, mat.NewVecDense(3, []float64{0, 0.1, 1}))
+	down := env.Radiance(nil, mat.NewVecDense(3, []float64{0, 0.1, -1}))
+	if up.RGB[0] != 3 || !down.IsZero() {
+		t.Fatalf("up = %v, down = %v; want the scaled top row above", up, down)
+	}
+	for i := 0; i < 50; i++ {
+		sample, ok := env.Sample(nil, maths.Sample2D{U: (float64(i) + 0.5) / 50, V: (float64(i) + 0.5) / 50})
+		if !ok || sample.Direction.AtVec(2) < 0 {
+			t.Fatalf("sample %d = %v, want the bright upper hemisphere", i, sample.Direction)
+		}
+	}
+}
+
+func TestInfiniteLightsUpliftRGBForSpectralContexts(t *testing.T) {
+	img := testImage(1, 1, func(_, _ int) [3]float32 { return [3]float32{4, 4, 4} })
+	env := NewEnvironmentMap(img, 1)
+	direction := mat.NewVecDense(3, []float64{1, 0, 0})
+
+	spectral := env.Radiance(wavelengths{550}, direction)
+	if !spectral.HasSamples() || spectral.SampleCount() != 1 {
+		t.Fatalf("spectral radiance = %v, want one sampled value", spectral)
+	}
+	if want := optics.ConstantSpectrum(4).RGBPowerAtWavelength(550); math.Abs(spectral.Sample(0)-want) > 1e-12 {
+		t.Fatalf("uplifted radiance = %g, want %g", spectral.Sample(0), want)
+	}
+	if rgb := env.Radiance(nil, direction); rgb.HasSamples() || rgb.RGB[1] != 4 {
+		t.Fatalf("RGB radiance = %v, want 4", rgb)
+	}
+
+	sky := NewConstantSky(spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(0.5)))
+	sample, ok := sky.Sample(wavelengths{600}, maths.Sample2D{U: 0.3, V: 0.7})
+	if !ok || !sample.Radiance.HasSamples() || math.Abs(sample.PDF-1/(4*math.Pi)) > 1e-15 {
+		t.Fatalf("sky sample = %+v", sample)
+	}
+	if norm := mat.Norm(sample.Direction, 2); math.Abs(norm-1) > 1e-12 {
+		t.Fatalf("sky direction norm = %g, want 1", norm)
+	}
+}
+
+func testDaylight() Daylight {
+	return Daylight{SunElevation: 40, SunAzimuth: 30, Turbidity: 3, GroundAlbedo: 0.3, Scale: 1}
+}
+
+func TestPreethamSkyMatchesZenithLuminanceAndIsBlue(t *testing.T) {
+	sky := NewPreethamSky(testDaylight())
+	up := mat.NewVecDense(3, []float64{0, 0, 1})
+	zenith := luminance(func(wavelength float64) float64 {
+		return sky.Radiance(wavelengths{wavelength}, up).Sample(0)
+	})
+	if zenith < 4000 || zenith > 10000 || math.Abs(zenith-sky.zenith[0]) > 1e-2*sky.zenith[0] {
+		t.Fatalf("zenith luminance %g cd/m², model %g cd/m²", zenith, sky.zenith[0])
+	}
+	if rgb := sky.Radiance(nil, up); !(rgb.RGB[2] > rgb.RGB[1] && rgb.RGB[1] > rgb.RGB[0]) {
+		t.Fatalf("zenith RGB %v is not blue", rgb)
+	}
+}
+
+func TestPreethamSkySamplesAgreeWithPDFAndRadiance(t *testing.T) {
+	sky := NewPreethamSky(testDaylight())
+	for i := 0; i < 200; i++ {
+		u := maths.Sample2D{U: math.Mod(float64(i)*0.6180339887, 1), V: (float64(i) + 0.5) / 200}
+		sample, ok := sky.Sample(wavelengths{480, 620}, u)
+		if !ok {
+			t.Fatalf("sample %d failed", i)
+		}
+		if want := sky.PDF(sample.Direction); math.Abs(sample.PDF-want) > 1e-9*want {
+			t.Fatalf("sample %d density %g, want %g", i, sample.PDF, want)
+		}
+		if want := sky.Radiance(wavelengths{480, 620}, sample.Direction); !sample.Radiance.AlmostEqual(want, 1e-9) {
+			t.Fatalf("sample %d radiance %v, want %v", i, sample.Radiance, want)
+		}
+	}
+}
+
+func TestPreethamSkyGroundReflectsSkyAndSun(t *testing.T) {
+	daylight := testDaylight()
+	sky, sun := NewPreethamSky(daylight), NewSun(daylight)
+	const wavelength = 550
+	at := func(light Infinite, direction *mat.VecDense) float64 {
+		return light.Radiance(wavelengths{wavelength}, direction).Sample(0)
+	}
+
+	// Irradiance on the ground from the upper hemisphere, by a quadrature
+	// finer than the one the sky uses, plus the sun's disc.
+	const n = 200
+	irradiance := 0.0
+	for i := 0; i < n/2; i++ {
+		theta := math.Pi * (float64(i) + 0.5) / n
+		for j := 0; j < n; j++ {
+			phi := 2 * math.Pi * (float64(j) + 0.5) / n
+			direction := mat.NewVecDense(3, []float64{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)})
+			irradiance += at(sky, direction) * math.Cos(theta) * math.Sin(theta) * (math.Pi / n) * (2 * math.Pi / n)
+		}
+	}
+	irradiance += at(sun, sun.direction) * 2 * math.Pi * (1 - sun.cosMax) * sun.direction.AtVec(2)
+
+	ground := at(sky, mat.NewVecDense(3, []float64{0.3, 0.2, -1}))
+	if want := daylight.GroundAlbedo * irradiance / math.Pi; math.Abs(ground-want) > 0.02*want {
+		t.Fatalf("ground radiance %g, want %g", ground, want)
+	}
+	if below := NewPreethamSky(Daylight{SunElevation: 40, Turbidity: 3, Scale: 1}).Radiance(nil, mat.NewVecDense(3, []float64{0, 0, -1})); !below.IsZero() {
+		t.Fatalf("black ground radiance = %v", below)
+	}
+}
+
+func TestSunDiscKeepsIrradianceAcrossSizes(t *testing.T) {
+	daylight := Daylight{SunElevation: 90, Turbidity: 2, Scale: 1}
+	sun := NewSun(daylight)
+	irradiance := func(s *Sun) float64 {
+		return s.Radiance(wavelengths{550}, s.direction).Sample(0) * 2 * math.Pi * (1 - s.cosMax)
+	}
+	// Clear-sky direct normal irradiance near 550 nm is about 1.4 W·m⁻²·nm⁻¹.
+	if e := irradiance(sun); e < 1.1 || e > 1.7 {
+		t.Fatalf("solar irradiance at 550 nm = %g W/m²/nm", e)
+	}
+	daylight.SunAngularDiameter = 5
+	if wide := irradiance(NewSun(daylight)); math.Abs(wide-irradiance(sun)) > 1e-9*wide {
+		t.Fatalf("wide disc irradiance %g, want %g", wide, irradiance(sun))
+	}
+
+	for i := 0; i < 50; i++ {
+		sample, ok := sun.Sample(nil, maths.Sample2D{U: (float64(i) + 0.5) / 50, V: math.Mod(float64(i)*0.618, 1)})
+		if !ok || sample.PDF != sun.PDF(sample.Direction) || sample.Radiance.IsZero() {
+			t.Fatalf("sample %d = %+v outside the disc", i, sample)
+		}
+	}
+	if off := mat.NewVecDense(3, []float64{0.1, 0, 1}); !sun.Radiance(nil, off).IsZero() || sun.PDF(off) != 0 {
+		t.Fatal("sun radiates outside its disc")
+	}
+	if _, ok := NewSun(Daylight{SunElevation: -5, Turbidity: 3, Scale: 1}).Sample(nil, maths.Sample2D{U: 0.5, V: 0.5}); ok {
+		t.Fatal("a sun below the horizon was sampled")
+	}
+}
+
+func TestDeltaLightEmissionAgreesWithIncidentLight(t *testing.T) {
+	value := spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(2))
+	position := mat.NewVecDense(3, []float64{0.5, -1, 2})
+	axis := mat.NewVecDense(3, []float64{0, 0.6, -0.8})
+	scene := Sphere{Center: [3]float64{0, 0, 0}, Radius: 4}
+	lights := map[string]Delta{
+		"point":       NewPoint(position, value),
+		"spot":        NewSpot(position, axis, value, 40, 25),
+		"directional": NewDirectional(axis, value),
+		"beam":        NewBeam(position, axis, 0.3, value),
+	}
+	for name, delta := range lights {
+		for i := 0; i < 64; i++ {
+			u := maths.Sample2D{U: (float64(i%8) + 0.5) / 8, V: (float64(i/8) + 0.5) / 8}
+			emitted, ok := delta.SampleEmission(nil, u, scene)
+			if !ok {
+				t.Fatalf("%s: sample %d failed", name, i)
+			}
+			// Weight times the density through a point is the irradiance
+			// the light delivers there.
+			point := mat.VecDenseCopyOf(emitted.Origin)
+			point.AddScaledVec(point, 1.5, emitted.Direction)
+			incident, ok := delta.Incident(nil, point)
+			if !ok {
+				t.Fatalf("%s: point on emitted ray %d receives no light", name, i)
+			}
+			want := emitted.Weight.MulScalar(delta.EmissionPDF(point, scene))
+			if math.Abs(incident.Irradiance.MaxComponent()-want.MaxComponent()) > 1e-9*want.MaxComponent() {
+				t.Fatalf("%s: irradiance %v, emission implies %v", name, incident.Irradiance, want)
+			}
+			if mat.Dot(incident.Direction, emitted.Direction) > -1+1e-9 {
+				t.Fatalf("%s: incident direction does not face the emitted ray", name)
+			}
+		}
+	}
+}
+
+func TestSpotFallsOffSmoothlyToItsCone(t *testing.T) {
+	spot := NewSpot(mat.NewVecDense(3, []float64{0, 0, 0}), mat.NewVecDense(3, []float64{0, 0, -1}),
+		spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1)), 30, 20)
+	previous := math.Inf(1)
+	for degrees := 0.0; degrees <= 35; degrees += 1 {
+		angle := degrees * math.Pi / 180
+		point := mat.NewVecDense(3, []float64{math.Sin(angle), 0, -math.Cos(angle)})
+		irradiance := 0.0
+		if incident, ok := spot.Incident(nil, point); ok {
+			irradiance = incident.Irradiance.MaxComponent()
+		}
+		switch {
+		case degrees <= 20 && math.Abs(irradiance-1) > 1e-12:
+			t.Fatalf("irradiance %g at %g degrees, want the full intensity", irradiance, degrees)
+		case degrees >= 30 && irradiance != 0:
+			t.Fatalf("irradiance %g at %g degrees, outside the cone", irradiance, degrees)
+		case irradiance > previous+1e-12:
+			t.Fatalf("irradiance rises from %g to %g at %g degrees", previous, irradiance, degrees)
+		}
+		previous = irradiance
+	}
+}
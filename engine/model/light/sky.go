@@ -0,0 +1,265 @@
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Daylight describes the sun and atmosphere shared by PreethamSky and Sun.
+// The sky is +z up; the sun azimuth turns from +x toward +y, so it matches
+// the azimuth of EnvironmentMap. Angles are in degrees.
+type Daylight struct {
+	SunElevation float64
+	SunAzimuth   float64
+	// Turbidity is the ratio of the atmosphere's optical thickness to that of
+	// pure air: 2 is a very clear sky, 10 a hazy one.
+	Turbidity float64
+	// GroundAlbedo is the reflectance of the Lambertian ground that fills the
+	// lower hemisphere, lit by both the sky and the sun.
+	GroundAlbedo float64
+	// SunAngularDiameter is the apparent size of the solar disc. A larger disc
+	// softens shadows; its radiance is lowered to keep the sun's irradiance.
+	SunAngularDiameter float64
+	// Scale multiplies the physical radiance, in W·m⁻²·sr⁻¹·nm⁻¹.
+	Scale float64
+}
+
+// Turbidity range fitted by the Preetham model.
+const (
+	MinTurbidity = 1.7
+	MaxTurbidity = 10
+
+	// DefaultSunAngularDiameter is the mean apparent diameter of the sun.
+	DefaultSunAngularDiameter = 0.53
+)
+
+// sunDirection is the unit vector toward the sun.
+func (d Daylight) sunDirection() [3]float64 {
+	elevation, azimuth := d.SunElevation*math.Pi/180, d.SunAzimuth*math.Pi/180
+	return [3]float64{
+		math.Cos(elevation) * math.Cos(azimuth),
+		math.Cos(elevation) * math.Sin(azimuth),
+		math.Sin(elevation),
+	}
+}
+
+// sunZenith is the sun's zenith angle, kept above the horizon where the
+// model is defined.
+func (d Daylight) sunZenith() float64 {
+	return math.Pi/2 - math.Max(0, math.Min(90, d.SunElevation))*math.Pi/180
+}
+
+// PreethamSky is the analytic clear-sky model of Preetham, Shirley and Smits,
+// "A Practical Analytic Model for Daylight" (1999). Perez functions fitted
+// to turbidity give the luminance and chromaticity of every direction of the
+// upper hemisphere, and the CIE daylight basis turns the chromaticity into a
+// spectrum. Below the horizon the sky shows its Lambertian ground. Sampling
+// follows a tabulated luminance image like EnvironmentMap.
+type PreethamSky struct {
+	sun    [3]float64
+	scale  float64
+	zenith [3]float64 // Y in cd/m², x, y at the zenith
+	perez  [3][5]float64
+	// perezSun holds the Perez functions toward the zenith, which normalize
+	// the distribution to the zenith values.
+	perezSun  [3]float64
+	ground    daylightGrid
+	groundRGB optics.Spectrum
+
+	distribution Distribution2D
+}
+
+const (
+	skyTableWidth  = 128
+	skyTableHeight = 64
+)
+
+// NewPreethamSky builds the sky for daylight.
+func NewPreethamSky(daylight Daylight) *PreethamSky {
+	s := &PreethamSky{sun: daylight.sunDirection(), scale: daylight.Scale}
+	turbidity := math.Max(MinTurbidity, math.Min(MaxTurbidity, daylight.Turbidity))
+	thetaS := daylight.sunZenith()
+
+	chi := (4.0/9 - turbidity/120) * (math.Pi - 2*thetaS)
+	s.zenith[0] = 1000 * math.Max(0, (4.0453*turbidity-4.9710)*math.Tan(chi)-0.2155*turbidity+2.4192)
+	t := [3]float64{turbidity * turbidity, turbidity, 1}
+	theta := [4]float64{thetaS * thetaS * thetaS, thetaS * thetaS, thetaS, 1}
+	s.zenith[1] = bilinearForm(t, zenithX, theta)
+	s.zenith[2] = bilinearForm(t, zenithY, theta)
+	for channel, coefficients := range perezCoefficients {
+		for i, c := range coefficients {
+			s.perez[channel][i] = c[0]*turbidity + c[1]
+		}
+		s.perezSun[channel] = perez(s.perez[channel], 1, thetaS)
+	}
+
+	s.ground = s.groundRadiance(daylight)
+	s.groundRGB = xyzToRGBRadiance(spectrumXYZ(s.ground.at)).MulScalar(s.scale)
+	s.distribution = s.luminanceDistribution()
+	return s
+}
+
+func (s *PreethamSky) Radiance(ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum {
+	x, y, z := direction.AtVec(0), direction.AtVec(1), direction.AtVec(2)
+	norm := math.Sqrt(x*x + y*y + z*z)
+	if norm <= 0 {
+		return optics.Spectrum{}
+	}
+	if z <= 0 {
+		return evalSpectrum(ctx, func(wavelength float64) float64 {
+			return s.scale * s.ground.at(wavelength)
+		}, func() optics.Spectrum { return s.groundRGB })
+	}
+	cosGamma := (x*s.sun[0] + y*s.sun[1] + z*s.sun[2]) / norm
+	c, m1, m2 := s.daylightCoefficients(z/norm, cosGamma)
+	c *= s.scale
+	return evalSpectrum(ctx, func(wavelength float64) float64 {
+		return c * (daylightS0.at(wavelength) +
+			m1*daylightS1.at(wavelength) +
+			m2*daylightS2.at(wavelength))
+	}, func() optics.Spectrum {
+		return xyzToRGBRadiance(daylightXYZ[0].Add(daylightXYZ[1].MulScalar(m1)).Add(daylightXYZ[2].MulScalar(m2)).MulScalar(c))
+	})
+}
+
+func (s *PreethamSky) Sample(ctx optics.WavelengthContext, sample maths.Sample2D) (Sample, bool) {
+	u, v, pdfUV := s.distribution.Sample(sample.U, sample.V)
+	theta, phi := math.Pi*v, 2*math.Pi*u
+	sinTheta := math.Sin(theta)
+	if pdfUV <= 0 || sinTheta <= 0 {
+		return Sample{}, false
+	}
+	direction := mat.NewVecDense(3, []float64{sinTheta * math.Cos(phi), sinTheta * math.Sin(phi), math.Cos(theta)})
+	return Sample{
+		Direction: direction,
+		Radiance:  s.Radiance(ctx, direction),
+		PDF:       pdfUV / (2 * math.Pi * math.Pi * sinTheta),
+	}, true
+}
+
+func (s *PreethamSky) PDF(direction *mat.VecDense) float64 {
+	u, v := equirectUV(direction)
+	sinTheta := math.Sin(math.Pi * v)
+	if sinTheta <= 0 {
+		return 0
+	}
+	return s.distribution.PDF(u, v) / (2 * math.Pi * math.Pi * sinTheta)
+}
+
+// daylightCoefficients returns the sky spectrum toward a direction with the
+// given cosines to the zenith and the sun as c (S0 + m1 S1 + m2 S2), before
+// the sky's scale.
+func (s *PreethamSky) daylightCoefficients(cosTheta, cosGamma float64) (c, m1, m2 float64) {
+	gamma := math.Acos(math.Max(-1, math.Min(1, cosGamma)))
+	var values [3]float64
+	for channel := range values {
+		values[channel] = s.zenith[channel] * perez(s.perez[channel], cosTheta, gamma) / s.perezSun[channel]
+	}
+	x, y := values[1], values[2]
+	m := 0.0241 + 0.2562*x - 0.7341*y
+	m1 = (-1.3515 - 1.7703*x + 5.9114*y) / m
+	m2 = (0.0300 - 31.4424*x + 30.0717*y) / m
+	denominator := daylightLuminance[0] + m1*daylightLuminance[1] + m2*daylightLuminance[2]
+	if values[0] <= 0 || denominator <= 0 {
+		return 0, 0, 0
+	}
+	return values[0] / denominator, m1, m2
+}
+
+// groundRadiance is the radiance of a Lambertian ground lit by the sky's
+// upper hemisphere and the sun, albedo E / π.
+func (s *PreethamSky) groundRadiance(daylight Daylight) daylightGrid {
+	albedo := math.Max(0, math.Min(1, daylight.GroundAlbedo))
+	var ground daylightGrid
+	if albedo == 0 {
+		return ground
+	}
+	// Midpoint quadrature of the sky irradiance on a horizontal plane.
+	const thetaSteps, phiSteps = 64, 128
+	var irradiance [3]float64
+	dTheta, dPhi := math.Pi/2/thetaSteps, 2*math.Pi/phiSteps
+	for i := 0; i < thetaSteps; i++ {
+		theta := (float64(i) + 0.5) * dTheta
+		weight := math.Cos(theta) * math.Sin(theta) * dTheta * dPhi
+		for j := 0; j < phiSteps; j++ {
+			phi := (float64(j) + 0.5) * dPhi
+			cosGamma := math.Sin(theta)*(math.Cos(phi)*s.sun[0]+math.Sin(phi)*s.sun[1]) + math.Cos(theta)*s.sun[2]
+			c, m1, m2 := s.daylightCoefficients(math.Cos(theta), cosGamma)
+			irradiance[0] += weight * c
+			irradiance[1] += weight * c * m1
+			irradiance[2] += weight * c * m2
+		}
+	}
+	sun := newSunRadiance(daylight)
+	sunIrradiance := sun.solidAngle * math.Max(0, s.sun[2])
+	for i := range ground {
+		sky := irradiance[0]*daylightS0[i] + irradiance[1]*daylightS1[i] + irradiance[2]*daylightS2[i]
+		ground[i] = albedo / math.Pi * (sky + sunIrradiance*sun.radiance[i])
+	}
+	return ground
+}
+
+// luminanceDistribution tabulates the sky's luminance over an equirectangular
+// grid for importance sampling.
+func (s *PreethamSky) luminanceDistribution() Distribution2D {
+	groundLuminance := luminance(s.ground.at)
+	weights := make([]float64, skyTableWidth*skyTableHeight)
+	for y := 0; y < skyTableHeight; y++ {
+		theta := math.Pi * (float64(y) + 0.5) / skyTableHeight
+		for x := 0; x < skyTableWidth; x++ {
+			value := groundLuminance
+			if theta < math.Pi/2 {
+				phi := 2 * math.Pi * (float64(x) + 0.5) / skyTableWidth
+				cosGamma := math.Sin(theta)*(math.Cos(phi)*s.sun[0]+math.Sin(phi)*s.sun[1]) + math.Cos(theta)*s.sun[2]
+				c, m1, m2 := s.daylightCoefficients(math.Cos(theta), cosGamma)
+				value = c * (daylightLuminance[0] + m1*daylightLuminance[1] + m2*daylightLuminance[2])
+			}
+			if weight := value * math.Sin(theta); weight > 0 && !math.IsInf(weight, 0) {
+				weights[y*skyTableWidth+x] = weight
+			}
+		}
+	}
+	return NewDistribution2D(weights, skyTableWidth, skyTableHeight)
+}
+
+// perez is the Perez sky distribution F(θ, γ) with coefficients A–E.
+func perez(coefficients [5]float64, cosTheta, gamma float64) float64 {
+	a, b, c, d, e := coefficients[0], coefficients[1], coefficients[2], coefficients[3], coefficients[4]
+	cosGamma := math.Cos(gamma)
+	return (1 + a*math.Exp(b/math.Max(cosTheta, 1e-3))) * (1 + c*math.Exp(d*gamma) + e*cosGamma*cosGamma)
+}
+
+func bilinearForm(t [3]float64, matrix [3][4]float64, theta [4]float64) float64 {
+	value := 0.0
+	for i := range t {
+		for j := range theta {
+			value += t[i] * matrix[i][j] * theta[j]
+		}
+	}
+	return value
+}
+
+// Zenith chromaticity fits of Preetham et al., appendix A.2.
+var (
+	zenithX = [3][4]float64{
+		{0.00166, -0.00375, 0.00209, 0},
+		{-0.02903, 0.06377, -0.03202, 0.00394},
+		{0.11693, -0.21196, 0.06052, 0.25886},
+	}
+	zenithY = [3][4]float64{
+		{0.00275, -0.00610, 0.00317, 0},
+		{-0.04214, 0.08970, -0.04153, 0.00516},
+		{0.15346, -0.26756, 0.06670, 0.26688},
+	}
+)
+
+// perezCoefficients are the linear turbidity fits of the Perez coefficients
+// A–E for Y, x and y, as {slope, intercept}.
+var perezCoefficients = [3][5][2]float64{
+	{{0.1787, -1.4630}, {-0.3554, 0.4275}, {-0.0227, 5.3251}, {0.1206, -2.5771}, {-0.0670, 0.3703}},
+	{{-0.0193, -0.2592}, {-0.0665, 0.0008}, {-0.0004, 0.2125}, {-0.0641, -0.8989}, {-0.0033, 0.0452}},
+	{{-0.0167, -0.2608}, {-0.0950, 0.0092}, {-0.0079, 0.2102}, {-0.0441, -1.6537}, {-0.0109, 0.0529}},
+}
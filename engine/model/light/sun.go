@@ -0,0 +1,124 @@
+package light
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Sun is the solar disc of a Daylight: a cone of constant spectral radiance
+// around the sun direction, sampled uniformly within the cone.
+type Sun struct {
+	direction *mat.VecDense
+	cosMax    float64
+	radiance  daylightGrid
+	rgb       optics.Spectrum
+}
+
+// NewSun builds the solar disc for daylight.
+func NewSun(daylight Daylight) *Sun {
+	sun := newSunRadiance(daylight)
+	direction := daylight.sunDirection()
+	s := &Sun{direction: mat.NewVecDense(3, direction[:]), cosMax: sun.cosMax}
+	for i, value := range sun.radiance {
+		s.radiance[i] = daylight.Scale * value
+	}
+	s.rgb = xyzToRGBRadiance(spectrumXYZ(s.radiance.at))
+	return s
+}
+
+func (s *Sun) Radiance(ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum {
+	if !s.covers(direction) {
+		return optics.Spectrum{}
+	}
+	return evalSpectrum(ctx, s.radiance.at, func() optics.Spectrum { return s.rgb })
+}
+
+func (s *Sun) Sample(ctx optics.WavelengthContext, u maths.Sample2D) (Sample, bool) {
+	if s.direction.AtVec(2) < 0 {
+		return Sample{}, false
+	}
+	frame, ok := maths.NewFrameFromNormal(s.direction)
+	if !ok {
+		return Sample{}, false
+	}
+	cosTheta := 1 - u.U*(1-s.cosMax)
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	phi := 2 * math.Pi * u.V
+	direction := frame.LocalToWorld(maths.NewDirection(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta))
+	return Sample{
+		Direction: direction,
+		Radiance:  evalSpectrum(ctx, s.radiance.at, func() optics.Spectrum { return s.rgb }),
+		PDF:       s.conePDF(),
+	}, true
+}
+
+func (s *Sun) PDF(direction *mat.VecDense) float64 {
+	if !s.covers(direction) {
+		return 0
+	}
+	return s.conePDF()
+}
+
+func (s *Sun) covers(direction *mat.VecDense) bool {
+	norm := mat.Norm(direction, 2)
+	return s.direction.AtVec(2) >= 0 && norm > 0 && mat.Dot(direction, s.direction) >= s.cosMax*norm
+}
+
+func (s *Sun) conePDF() float64 {
+	return 1 / (2 * math.Pi * (1 - s.cosMax))
+}
+
+// sunRadiance is the unscaled spectral radiance of the solar disc and the
+// solid angle it covers.
+type sunRadiance struct {
+	radiance   daylightGrid
+	cosMax     float64
+	solidAngle float64
+}
+
+// Apparent angular radius of the real sun, whose radiance extraterrestrialSun
+// tabulates.
+const sunAngularRadius = DefaultSunAngularDiameter / 2 * math.Pi / 180
+
+// newSunRadiance attenuates the extraterrestrial sun along the air mass of
+// its elevation by Rayleigh scattering, aerosols of the daylight's turbidity
+// and the Chappuis band of ozone, following Preetham et al., appendix A.1.
+// A disc larger than the real sun is dimmed so its irradiance is unchanged.
+func newSunRadiance(daylight Daylight) sunRadiance {
+	diameter := daylight.SunAngularDiameter
+	if diameter <= 0 {
+		diameter = DefaultSunAngularDiameter
+	}
+	sun := sunRadiance{cosMax: math.Cos(diameter / 2 * math.Pi / 180)}
+	sun.solidAngle = 2 * math.Pi * (1 - sun.cosMax)
+	if daylight.SunElevation < 0 {
+		return sun
+	}
+
+	turbidity := math.Max(MinTurbidity, math.Min(MaxTurbidity, daylight.Turbidity))
+	zenithDegrees := 90 - math.Min(90, daylight.SunElevation)
+	airMass := 1 / (math.Cos(zenithDegrees*math.Pi/180) + 0.15*math.Pow(93.885-zenithDegrees, -1.253))
+	beta := 0.04608365822050*turbidity - 0.04586025928522
+	const alpha, ozoneThicknessCM = 1.3, 0.35
+	dimming := (2 * math.Pi * (1 - math.Cos(sunAngularRadius))) / sun.solidAngle
+
+	for i := range sun.radiance {
+		micrometers := (daylightGridStart + float64(i)*daylightGridStep) / 1000
+		rayleigh := 0.008735 * math.Pow(micrometers, -4.08)
+		aerosol := beta * math.Pow(micrometers, -alpha)
+		ozone := ozoneAbsorption(1000*micrometers) * ozoneThicknessCM
+		transmittance := math.Exp(-airMass * (rayleigh + aerosol + ozone))
+		sun.radiance[i] = 100 * extraterrestrialSun[i] * transmittance * dimming
+	}
+	return sun
+}
+
+// ozoneAbsorption approximates the ozone absorption coefficient, in cm⁻¹,
+// across the Chappuis band that dominates the visible range.
+func ozoneAbsorption(wavelengthNM float64) float64 {
+	t := (wavelengthNM - 602) / 55
+	return 0.12 * math.Exp(-0.5*t*t)
+}
@@ -77,6 +77,22 @@ func (c CylindricalGridCutout) Sample(ctx bxdf.ShadingContext, wo maths.Directio
 	}
 }
 
+// Mueller is the line's on the grid lines. Light passes the gaps
+// unchanged.
+func (c CylindricalGridCutout) Mueller(ctx bxdf.ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if c.OnGridLine(ctx) && c.Line != nil {
+		polarizing, ok := c.Line.(bxdf.Polarizing)
+		if !ok {
+			return optics.Mueller{}, false
+		}
+		return polarizing.Mueller(ctx, wi, wo)
+	}
+	if wi.Dot(wo) > -1+1e-6 {
+		return optics.Mueller{}, false
+	}
+	return optics.IdentityMueller(), true
+}
+
 func (c CylindricalGridCutout) PDF(ctx bxdf.ShadingContext, wi, wo maths.Direction) float64 {
 	if !c.OnGridLine(ctx) || c.Line == nil {
 		return 0
@@ -54,7 +54,9 @@ func (m WeightedMixture) Sample(ctx bxdf.ShadingContext, wo maths.Direction, u m
 	}
 
 	selectedWeight := m.Components[index].Weight / total
-	if isDeltaSample(sample) {
+	// Like delta samples, wavelength-shifting samples are not described by
+	// Eval and PDF, so they keep their own value.
+	if isDeltaSample(sample) || sample.Flags&bxdf.WavelengthShift != 0 {
 		sample.F = sample.F.MulScalar(selectedWeight)
 		sample.PDF *= selectedWeight
 		return sample
@@ -65,6 +67,45 @@ func (m WeightedMixture) Sample(ctx bxdf.ShadingContext, wo maths.Direction, u m
 	return sample
 }
 
+// Mueller averages the Mueller matrices of the components that scatter wo
+// into wi, weighted by the intensity each contributes. A delta component
+// that scatters wo into wi outweighs every smooth one, and components that
+// are not Polarizing depolarize.
+func (m WeightedMixture) Mueller(ctx bxdf.ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	var sum optics.Mueller
+	var total float64
+	delta := false
+	for _, component := range m.Components {
+		if component.BxDF == nil || component.Weight <= 0 {
+			continue
+		}
+		isDelta := component.BxDF.RoughnessInfo(ctx).IsDelta
+		if delta && !isDelta {
+			continue
+		}
+		mueller, ok := optics.DepolarizerMueller(), !isDelta
+		if polarizing, is := component.BxDF.(bxdf.Polarizing); is {
+			mueller, ok = polarizing.Mueller(ctx, wi, wo)
+		}
+		weight := component.Weight
+		if !isDelta {
+			weight *= component.BxDF.Eval(ctx, wi, wo).Average()
+		}
+		if !ok || weight <= 0 {
+			continue
+		}
+		if isDelta && !delta {
+			sum, total, delta = optics.Mueller{}, 0, true
+		}
+		sum = sum.Add(mueller.MulScalar(weight))
+		total += weight
+	}
+	if total <= 0 {
+		return optics.Mueller{}, false
+	}
+	return sum.MulScalar(1 / total), true
+}
+
 func (m WeightedMixture) PDF(ctx bxdf.ShadingContext, wi, wo maths.Direction) float64 {
 	total := m.totalWeight()
 	if total <= 0 {
@@ -28,6 +28,14 @@ func (s Single) Sample(ctx bxdf.ShadingContext, wo maths.Direction, u maths.Samp
 	return s.BxDF.Sample(ctx, wo, u)
 }
 
+func (s Single) Mueller(ctx bxdf.ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	polarizing, ok := s.BxDF.(bxdf.Polarizing)
+	if !ok {
+		return optics.Mueller{}, false
+	}
+	return polarizing.Mueller(ctx, wi, wo)
+}
+
 func (s Single) PDF(ctx bxdf.ShadingContext, wi, wo maths.Direction) float64 {
 	if s.BxDF == nil {
 		return 0
@@ -19,6 +19,16 @@ type BxDF interface {
 	Scattering
 }
 
+// Polarizing is implemented by BxDFs that change the polarization of the
+// light they scatter. Mueller returns the Mueller matrix that scatters light
+// arriving along -wi into wo, normalized to Mueller[0][0] = 1 because Eval
+// and Sample already carry the intensity. Both Stokes vectors use the frame
+// whose x axis is StokesBasis(wi, wo). It reports false when the BxDF does
+// not scatter wo into wi. BxDFs that are not Polarizing depolarize.
+type Polarizing interface {
+	Mueller(ctx ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool)
+}
+
 type ParameterGradients struct {
 	Values map[string]optics.Spectrum
 }
@@ -42,6 +52,8 @@ const (
 	DeltaTransmission                        // Perfect specular transmission/refraction; the outgoing direction is deterministic.
 	NonReciprocal                            // Scattering is not reciprocal; swapping wi and wo may change the value or PDF.
 	TransmissionEvent                        // The sampled event crosses the surface and should update medium state.
+	Dispersive                               // The index of refraction varies with wavelength, so a sample at one wavelength says nothing about others.
+	WavelengthShift                          // Light may leave at another wavelength than it arrived; a sample with this flag changes the wavelength.
 )
 
 type RoughnessInfo struct {
@@ -57,6 +69,8 @@ type ShadingContext struct {
 	WavelengthNM     float64             // Selected wavelength in nanometers.
 	WavelengthsNM    []float64           // Sampled wavelengths in nanometers.
 	WavelengthPDF    float64             // Probability density of wavelength sampling.
+	WavelengthShifts bool                // The tracer follows samples that change the wavelength.
+	ShiftSample      float64             // Uniform sample in [0, 1) for the wavelength such a sample changes to.
 	EtaIncident      float64             // Incident-side index of refraction.
 	EtaTransmit      float64             // Transmitted-side index of refraction.
 	IncidentMedium   medium.MediumID     // Medium on the incident side.
@@ -84,5 +98,6 @@ type BxDFSample struct {
 	Flags          DeltaFlags      // Scattering event flags.
 	Eta            float64         // Relative index of refraction.
 	WavelengthNM   float64         // Sampled wavelength in nanometers.
+	WavelengthPDF  float64         // Density per nanometer of WavelengthNM for a WavelengthShift sample.
 	TransmitMedium medium.MediumID // Medium entered after transmission.
 }
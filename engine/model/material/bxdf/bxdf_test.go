@@ -295,3 +295,130 @@ func TestRoughDielectricTransmissionUsesDispersiveIOR(t *testing.T) {
 		t.Fatalf("expected sample wavelength to be propagated, got %f", sample.WavelengthNM)
 	}
 }
+
+func TestLinearPolarizerMuellerFollowsItsAxis(t *testing.T) {
+	polarizer := bxdf.NewLinearPolarizer(optics.ConstantSpectrum(1), math.Pi/2)
+	wo := maths.NewDirection(0, 0, 1)
+	wi := wo.MulScalar(-1)
+
+	mueller, ok := polarizer.Mueller(bxdf.ShadingContext{}, wi, wo)
+	if !ok {
+		t.Fatal("expected a Mueller matrix for light passing straight through")
+	}
+	// The axis is the local y axis. Mueller matrices are normalized to
+	// unpolarized light, of which Sample already passes half.
+	basis := bxdf.StokesBasis(wi, wo)
+	for _, c := range []struct {
+		axis maths.Direction
+		want float64
+	}{
+		{maths.NewDirection(0, 1, 0), 2},
+		{maths.NewDirection(1, 0, 0), 0},
+	} {
+		angle := 2 * bxdf.StokesAngle(basis, c.axis, wo)
+		polarized := optics.Stokes{1, math.Cos(angle), math.Sin(angle), 0}
+		if got := mueller.Apply(polarized)[0]; math.Abs(got-c.want) > 1e-9 {
+			t.Fatalf("light polarized along %v passes %g, want %g", c.axis, got, c.want)
+		}
+	}
+	if _, ok := polarizer.Mueller(bxdf.ShadingContext{}, wo, wo); ok {
+		t.Fatal("expected no Mueller matrix for a direction the polarizer does not scatter into")
+	}
+}
+
+func TestSpecularDielectricMuellerPolarizesAtBrewsterAngle(t *testing.T) {
+	dielectric := bxdf.NewSpecularDielectricConstant(
+		optics.ConstantSpectrum(1), optics.ConstantSpectrum(1), 1, 1.5,
+	)
+	brewster := math.Atan(1.5)
+	wo := maths.NewDirection(math.Sin(brewster), 0, math.Cos(brewster))
+	wi := maths.NewDirection(-math.Sin(brewster), 0, math.Cos(brewster))
+	ctx := bxdf.ShadingContext{WavelengthNM: 550}
+
+	mueller, ok := dielectric.Mueller(ctx, wi, wo)
+	if !ok {
+		t.Fatal("expected a Mueller matrix for the mirror direction")
+	}
+	if reflected := mueller.Apply(optics.Stokes{1, 0, 0, 0}); reflected.DegreeOfPolarization() < 1-1e-9 {
+		t.Fatalf("reflection at Brewster's angle gives Stokes vector %v, want fully polarized", reflected)
+	}
+}
+
+func newTestReradiationMatrix(t *testing.T) *bxdf.ReradiationMatrix {
+	t.Helper()
+	matrix, err := bxdf.NewReradiationMatrix(
+		[]float64{350, 400, 450},
+		[]float64{500, 600},
+		[][]float64{{0, 0.004}, {0.002, 0.01}, {0, 0}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matrix
+}
+
+func TestReradiationMatrixSamplesExcitationByColumn(t *testing.T) {
+	matrix := newTestReradiationMatrix(t)
+	const emission, n = 560.0, 20000
+	total := matrix.ColumnIntegral(emission)
+	// Histogram the samples in 10 nm cells and compare with the column.
+	var counts [10]float64
+	for i := range n {
+		excitation, pdf, ok := matrix.SampleExcitation(emission, (float64(i)+0.5)/n)
+		if !ok {
+			t.Fatalf("sample %d failed", i)
+		}
+		if want := matrix.Value(excitation, emission) / total; math.Abs(pdf-want) > 1e-9 {
+			t.Fatalf("pdf at %g nm = %g, want %g", excitation, pdf, want)
+		}
+		counts[min(int((excitation-350)/10), 9)]++
+	}
+	for cell, count := range counts {
+		low := 350 + 10*float64(cell)
+		want := 0.0
+		for k := range 100 {
+			want += matrix.Value(low+(float64(k)+0.5)/10, emission) / 10 / total
+		}
+		if got := count / n; math.Abs(got-want) > 2e-3 {
+			t.Fatalf("cell %g nm holds %g of the samples, want %g", low, got, want)
+		}
+	}
+	if _, _, ok := matrix.SampleExcitation(450, 0.5); ok {
+		t.Fatal("expected no excitation for an emission wavelength outside the matrix")
+	}
+}
+
+func TestFluorescentSampleWeightsMatchRadianceFactor(t *testing.T) {
+	matrix := newTestReradiationMatrix(t)
+	surface := bxdf.NewFluorescentParameter(spectrum_parameter.NewConstantParameter(0.3), matrix)
+	wo := maths.NewDirection(0.1, 0.2, 0.9).Normalize()
+	ctx := bxdf.ShadingContext{WavelengthNM: 560, WavelengthsNM: []float64{560}, WavelengthShifts: true}
+	want := 0.3 + matrix.ColumnIntegral(560)
+
+	shifted := 0
+	for i := range 64 {
+		ctx.ShiftSample = (float64(i) + 0.5) / 64
+		sample := surface.Sample(ctx, wo, maths.Sample2D{U: (float64(i) + 0.25) / 64, V: 0.3})
+		weight := sample.F.Sample(0) * maths.AbsCosTheta(sample.Wi) / sample.PDF
+		if sample.Flags&bxdf.WavelengthShift != 0 {
+			shifted++
+			weight /= sample.WavelengthPDF
+			if sample.WavelengthNM < 350 || sample.WavelengthNM > 450 {
+				t.Fatalf("excitation wavelength %g outside the matrix", sample.WavelengthNM)
+			}
+		}
+		if math.Abs(weight-want) > 1e-9 {
+			t.Fatalf("sample %d has weight %g, want reflectance plus fluorescence %g", i, weight, want)
+		}
+	}
+	if shifted == 0 || shifted == 64 {
+		t.Fatalf("%d of 64 samples shifted the wavelength, want a mix", shifted)
+	}
+
+	ctx.WavelengthShifts = false
+	for i := range 16 {
+		if sample := surface.Sample(ctx, wo, maths.Sample2D{U: (float64(i) + 0.5) / 16, V: 0.3}); sample.Flags&bxdf.WavelengthShift != 0 {
+			t.Fatal("expected no wavelength shift when the tracer cannot follow it")
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package bxdf
+
+import (
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
+)
+
+// Fluorescent is a diffuse surface that re-emits part of the light it
+// absorbs at other wavelengths. Light arriving at wavelength λi leaves at λo
+// with the Lambertian BSDF Reradiation.Value(λi, λo)/I_D per nanometer of
+// λi, on top of the diffuse Reflectance at the arriving wavelength.
+//
+// Eval and PDF describe the reflectance alone, since light sampling fixes
+// the wavelength. When the tracer follows wavelength shifts, Sample also
+// draws fluorescent samples, choosing between reflection and fluorescence in
+// proportion to the radiance factor each adds at the current wavelength.
+type Fluorescent struct {
+	Reflectance optics.SpectralParameter
+	Reradiation *ReradiationMatrix
+}
+
+func NewFluorescent(reflectance optics.Spectrum, reradiation *ReradiationMatrix) Fluorescent {
+	return NewFluorescentParameter(spectrum_parameter.NewRGBParameter(reflectance), reradiation)
+}
+
+func NewFluorescentParameter(reflectance optics.SpectralParameter, reradiation *ReradiationMatrix) Fluorescent {
+	if reflectance == nil {
+		reflectance = spectrum_parameter.NewConstantParameter(0)
+	}
+	return Fluorescent{Reflectance: reflectance, Reradiation: reradiation}
+}
+
+func (f Fluorescent) Eval(ctx ShadingContext, wi, wo maths.Direction) optics.Spectrum {
+	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
+		return optics.Spectrum{}
+	}
+	return f.Reflectance.Eval(ctx).MulScalar(1 / maths.CosineHemisphereIntegral(wi.Len()))
+}
+
+// Sample draws a fluorescent sample with the excitation wavelength in
+// WavelengthNM and its density in WavelengthPDF, or a reflection sample at
+// the current wavelength. F of a fluorescent sample is the matrix at the
+// two wavelengths, and its PDF the density of the direction alone.
+func (f Fluorescent) Sample(ctx ShadingContext, wo maths.Direction, u maths.Sample2D) BxDFSample {
+	if !maths.IsUpperHemisphere(wo) {
+		return BxDFSample{}
+	}
+	reflect := f.reflectProbability(ctx)
+	if u.U < reflect {
+		wi := maths.CosineSampleHemisphereND(maths.Sample2D{U: u.U / reflect, V: u.V}, wo.Len())
+		return BxDFSample{
+			Wi:    wi,
+			F:     f.Eval(ctx, wi, wo),
+			PDF:   reflect * maths.CosineHemispherePDF(wi),
+			Flags: DeltaNone,
+		}
+	}
+
+	excitation, wavelengthPDF, ok := f.Reradiation.SampleExcitation(ctx.WavelengthNM, ctx.ShiftSample)
+	if !ok {
+		return BxDFSample{}
+	}
+	wi := maths.CosineSampleHemisphereND(maths.Sample2D{U: (u.U - reflect) / (1 - reflect), V: u.V}, wo.Len())
+	value := f.Reradiation.Value(excitation, ctx.WavelengthNM) / maths.CosineHemisphereIntegral(wi.Len())
+	return BxDFSample{
+		Wi:            wi,
+		F:             optics.NewSampledSpectrum([]float64{value}),
+		PDF:           (1 - reflect) * maths.CosineHemispherePDF(wi),
+		Flags:         WavelengthShift,
+		WavelengthNM:  excitation,
+		WavelengthPDF: wavelengthPDF,
+	}
+}
+
+func (f Fluorescent) PDF(ctx ShadingContext, wi, wo maths.Direction) float64 {
+	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
+		return 0
+	}
+	return f.reflectProbability(ctx) * maths.CosineHemispherePDF(wi)
+}
+
+// reflectProbability is the probability that Sample reflects rather than
+// fluoresces.
+func (f Fluorescent) reflectProbability(ctx ShadingContext) float64 {
+	if !ctx.WavelengthShifts || ctx.WavelengthNM <= 0 || f.Reradiation == nil {
+		return 1
+	}
+	fluoresce := f.Reradiation.ColumnIntegral(ctx.WavelengthNM)
+	if fluoresce <= 0 {
+		return 1
+	}
+	reflectance := f.Reflectance.Eval(ctx)
+	reflect := reflectance.Sample(0)
+	if !reflectance.HasSamples() {
+		reflect = reflectance.Average()
+	}
+	if reflect <= 0 {
+		return 0
+	}
+	return reflect / (reflect + fluoresce)
+}
+
+func (f Fluorescent) AlbedoBound(ShadingContext) optics.Spectrum {
+	bound := f.Reflectance.Bounds().Max
+	if f.Reradiation != nil {
+		bound = bound.Add(optics.ConstantSpectrum(f.Reradiation.MaxColumnIntegral()))
+	}
+	return bound
+}
+
+func (f Fluorescent) RoughnessInfo(ShadingContext) RoughnessInfo {
+	return RoughnessInfo{
+		IsDelta: false,
+		AlphaX:  1,
+		AlphaY:  1,
+	}
+}
+
+func (f Fluorescent) DeltaFlags() DeltaFlags {
+	return WavelengthShift
+}
@@ -0,0 +1,82 @@
+package bxdf
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
+)
+
+// LinearPolarizer is an ideal sheet polarizer. Light passes straight through
+// it, keeping only the component polarized along the transmission axis,
+// which makes Angle radians with the local x axis of the shading frame.
+// Unpolarized light loses half its intensity; without polarized transport
+// that is all the polarizer does.
+type LinearPolarizer struct {
+	Transmittance optics.SpectralParameter
+	Angle         float64
+}
+
+func NewLinearPolarizer(transmittance optics.Spectrum, angle float64) LinearPolarizer {
+	return NewLinearPolarizerParameter(spectrum_parameter.NewRGBParameter(transmittance), angle)
+}
+
+func NewLinearPolarizerParameter(transmittance optics.SpectralParameter, angle float64) LinearPolarizer {
+	if transmittance == nil {
+		transmittance = spectrum_parameter.NewConstantParameter(1)
+	}
+	return LinearPolarizer{Transmittance: transmittance, Angle: angle}
+}
+
+func (p LinearPolarizer) Eval(ShadingContext, maths.Direction, maths.Direction) optics.Spectrum {
+	return optics.Spectrum{}
+}
+
+func (p LinearPolarizer) Sample(ctx ShadingContext, wo maths.Direction, _ maths.Sample2D) BxDFSample {
+	wi := wo.MulScalar(-1)
+	cos := maths.AbsCosTheta(wi)
+	if cos <= 0 {
+		return BxDFSample{}
+	}
+	return BxDFSample{
+		Wi:    wi,
+		F:     p.Transmittance.Eval(ctx).MulScalar(0.5).DivScalar(cos),
+		PDF:   1,
+		Flags: DeltaTransmission,
+	}
+}
+
+// Mueller is the ideal polarizer with its axis projected onto the plane
+// perpendicular to wo, scaled by two because the unpolarized intensity is
+// already halved by Sample.
+func (p LinearPolarizer) Mueller(_ ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if wo.Len() != 3 || !sameDirection(wi, wo.MulScalar(-1)) {
+		return optics.Mueller{}, false
+	}
+	wo = wo.Normalize()
+	sin, cos := math.Sincos(p.Angle)
+	axis := maths.NewDirection(cos, sin, 0)
+	axis = axis.Add(wo.MulScalar(-axis.Dot(wo)))
+	if axis.Length() == 0 {
+		return optics.Mueller{}, false
+	}
+	angle := StokesAngle(StokesBasis(wi, wo), axis.Normalize(), wo)
+	return optics.LinearPolarizerMueller(angle).MulScalar(2), true
+}
+
+func (p LinearPolarizer) PDF(ShadingContext, maths.Direction, maths.Direction) float64 {
+	return 0
+}
+
+func (p LinearPolarizer) AlbedoBound(ShadingContext) optics.Spectrum {
+	return p.Transmittance.Bounds().Max
+}
+
+func (p LinearPolarizer) RoughnessInfo(ShadingContext) RoughnessInfo {
+	return RoughnessInfo{IsDelta: true}
+}
+
+func (p LinearPolarizer) DeltaFlags() DeltaFlags {
+	return DeltaTransmission
+}
@@ -0,0 +1,51 @@
+package bxdf
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+)
+
+// StokesBasis is the x axis of the Stokes frames of light scattered between
+// the local directions wi and wo: the normal of their plane, which is the
+// s-polarization direction of every Fresnel event between them. When wi and
+// wo are parallel it is the local x axis, or else the y axis, made
+// perpendicular to wo. It is undefined outside three dimensions.
+func StokesBasis(wi, wo maths.Direction) maths.Direction {
+	if wi.Len() != 3 || wo.Len() != 3 {
+		return maths.Direction{}
+	}
+	if s := cross(wi, wo); s.Length() > 1e-6 {
+		return s.Normalize()
+	}
+	wo = wo.Normalize()
+	for axis := range 2 {
+		components := make([]float64, 3)
+		components[axis] = 1
+		x := maths.NewDirectionFromComponents(components)
+		if x = x.Add(wo.MulScalar(-wo.Component(axis))); x.Length() > 1e-6 {
+			return x.Normalize()
+		}
+	}
+	return maths.Direction{}
+}
+
+// StokesAngle is the angle, in radians, from the unit vector from to the
+// unit vector to about the propagation direction p, all perpendicular to p.
+func StokesAngle(from, to, p maths.Direction) float64 {
+	return math.Atan2(p.Dot(cross(from, to)), from.Dot(to))
+}
+
+// sameDirection reports whether the unit vectors a and b agree up to
+// rounding, which is how a delta BxDF recognizes its own direction pairs.
+func sameDirection(a, b maths.Direction) bool {
+	return a.Len() == b.Len() && a.Dot(b) >= 1-1e-6
+}
+
+func cross(a, b maths.Direction) maths.Direction {
+	return maths.NewDirection(
+		a.Component(1)*b.Component(2)-a.Component(2)*b.Component(1),
+		a.Component(2)*b.Component(0)-a.Component(0)*b.Component(2),
+		a.Component(0)*b.Component(1)-a.Component(1)*b.Component(0),
+	)
+}
@@ -0,0 +1,171 @@
+package bxdf
+
+import (
+	"fmt"
+	"math"
+)
+
+// ReradiationMatrix is the excitation-emission (Donaldson) matrix of a
+// fluorescent material: Value(λi, λo) is the spectral radiance factor at
+// emission wavelength λo per nanometer of excitation wavelength λi. Under
+// light of unit spectral radiance at every wavelength, a diffuse
+// fluorescent surface re-emits ∫ Value(λi, λo) dλi at λo.
+//
+// The matrix is sampled on a grid and interpolated bilinearly; it is zero
+// outside the grid.
+type ReradiationMatrix struct {
+	excitation []float64
+	emission   []float64
+	values     [][]float64
+	maxColumn  float64
+}
+
+// NewReradiationMatrix builds a matrix with one row of values per excitation
+// wavelength and one column per emission wavelength. Both wavelength lists
+// are in nanometers, strictly increasing, and at least two long.
+func NewReradiationMatrix(excitation, emission []float64, values [][]float64) (*ReradiationMatrix, error) {
+	if err := validateReradiationAxis("excitation", excitation); err != nil {
+		return nil, err
+	}
+	if err := validateReradiationAxis("emission", emission); err != nil {
+		return nil, err
+	}
+	if len(values) != len(excitation) {
+		return nil, fmt.Errorf("%d rows of values for %d excitation wavelengths", len(values), len(excitation))
+	}
+	m := &ReradiationMatrix{
+		excitation: append([]float64(nil), excitation...),
+		emission:   append([]float64(nil), emission...),
+		values:     make([][]float64, len(values)),
+	}
+	for i, row := range values {
+		if len(row) != len(emission) {
+			return nil, fmt.Errorf("row %d has %d values for %d emission wavelengths", i, len(row), len(emission))
+		}
+		for j, value := range row {
+			if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, fmt.Errorf("value at row %d, column %d must be finite and non-negative", i, j)
+			}
+		}
+		m.values[i] = append([]float64(nil), row...)
+	}
+	// The column integral is piecewise linear in λo, so it peaks at a grid
+	// wavelength.
+	for _, wavelength := range emission {
+		m.maxColumn = math.Max(m.maxColumn, m.ColumnIntegral(wavelength))
+	}
+	return m, nil
+}
+
+func validateReradiationAxis(name string, wavelengths []float64) error {
+	if len(wavelengths) < 2 {
+		return fmt.Errorf("%s needs at least two wavelengths", name)
+	}
+	for i, wavelength := range wavelengths {
+		if !(wavelength > 0) || math.IsInf(wavelength, 0) {
+			return fmt.Errorf("%s wavelengths must be finite and positive", name)
+		}
+		if i > 0 && wavelength <= wavelengths[i-1] {
+			return fmt.Errorf("%s wavelengths must be strictly increasing", name)
+		}
+	}
+	return nil
+}
+
+// Value is the matrix at excitation wavelength excitationNM and emission
+// wavelength emissionNM.
+func (m *ReradiationMatrix) Value(excitationNM, emissionNM float64) float64 {
+	i, s, ok := gridCell(m.excitation, excitationNM)
+	if !ok {
+		return 0
+	}
+	return (1-s)*m.rowAt(i, emissionNM) + s*m.rowAt(i+1, emissionNM)
+}
+
+// ColumnIntegral is ∫ Value(λi, emissionNM) dλi, the radiance factor that
+// fluorescence adds at emissionNM.
+func (m *ReradiationMatrix) ColumnIntegral(emissionNM float64) float64 {
+	total := 0.0
+	previous := m.rowAt(0, emissionNM)
+	for i := 1; i < len(m.excitation); i++ {
+		current := m.rowAt(i, emissionNM)
+		total += 0.5 * (previous + current) * (m.excitation[i] - m.excitation[i-1])
+		previous = current
+	}
+	return total
+}
+
+// MaxColumnIntegral is the largest ColumnIntegral over all emission
+// wavelengths.
+func (m *ReradiationMatrix) MaxColumnIntegral() float64 {
+	return m.maxColumn
+}
+
+// SampleExcitation draws an excitation wavelength with density proportional
+// to Value(·, emissionNM) from u in [0, 1). It returns the wavelength, its
+// density per nanometer, and false when nothing excites emissionNM.
+func (m *ReradiationMatrix) SampleExcitation(emissionNM, u float64) (float64, float64, bool) {
+	total := m.ColumnIntegral(emissionNM)
+	if !(total > 0) {
+		return 0, 0, false
+	}
+	target := math.Max(0, math.Min(u, 1)) * total
+	// Rounding may leave target just past the last cell with any area; it
+	// then takes that cell's end.
+	cell, a, b, fraction := -1, 0.0, 0.0, 1.0
+	previous := m.rowAt(0, emissionNM)
+	for i := 1; i < len(m.excitation); i++ {
+		current := m.rowAt(i, emissionNM)
+		if area := 0.5 * (previous + current) * (m.excitation[i] - m.excitation[i-1]); area > 0 {
+			cell, a, b, fraction = i-1, previous, current, 1
+			if target <= area {
+				fraction = target / area
+				break
+			}
+			target -= area
+		}
+		previous = current
+	}
+	if cell < 0 {
+		return 0, 0, false
+	}
+	s := sampleTrapezoid(a, b, fraction)
+	value := a + s*(b-a)
+	if !(value > 0) {
+		return 0, 0, false
+	}
+	return m.excitation[cell] + s*(m.excitation[cell+1]-m.excitation[cell]), value / total, true
+}
+
+// rowAt interpolates row i of the matrix at emissionNM.
+func (m *ReradiationMatrix) rowAt(i int, emissionNM float64) float64 {
+	j, s, ok := gridCell(m.emission, emissionNM)
+	if !ok {
+		return 0
+	}
+	return (1-s)*m.values[i][j] + s*m.values[i][j+1]
+}
+
+// gridCell finds the cell [grid[i], grid[i+1]] containing x and the
+// position of x within it.
+func gridCell(grid []float64, x float64) (int, float64, bool) {
+	last := len(grid) - 1
+	if !(x >= grid[0] && x <= grid[last]) {
+		return 0, 0, false
+	}
+	i := 0
+	for i < last-1 && x > grid[i+1] {
+		i++
+	}
+	return i, (x - grid[i]) / (grid[i+1] - grid[i]), true
+}
+
+// sampleTrapezoid inverts the CDF of the density on [0, 1] that is linear
+// from a to b at u in [0, 1].
+func sampleTrapezoid(a, b, u float64) float64 {
+	if math.Abs(a-b) <= 1e-12*math.Max(a, b) {
+		return u
+	}
+	// Solve (b-a)s²/2 + a s = u(a+b)/2 in the stable form.
+	return u * (a + b) / (a + math.Sqrt(math.Max(0, a*a+(b*b-a*a)*u)))
+}
@@ -72,6 +72,20 @@ func (r RoughConductor) Sample(ctx ShadingContext, wo maths.Direction, u maths.S
 	}
 }
 
+// Mueller is the Fresnel Mueller matrix of the microfacet that reflects wo
+// into wi.
+func (r RoughConductor) Mueller(ctx ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
+		return optics.Mueller{}, false
+	}
+	wh := wi.Add(wo).Normalize()
+	if maths.CosTheta(wh) <= 0 || wh.Length() == 0 {
+		return optics.Mueller{}, false
+	}
+	rs, rp := microfacet.FresnelConductorAmplitudes(math.Abs(wi.Dot(wh)), r.Eta.Eval(ctx).Average(), r.K.Eval(ctx).Average())
+	return optics.FresnelMueller(rs, rp).Normalized(), true
+}
+
 func (r RoughConductor) PDF(_ ShadingContext, wi, wo maths.Direction) float64 {
 	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
 		return 0
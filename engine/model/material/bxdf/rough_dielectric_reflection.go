@@ -97,6 +97,24 @@ func (r RoughDielectricReflection) Sample(ctx ShadingContext, wo maths.Direction
 	}
 }
 
+// Mueller is the Fresnel Mueller matrix of the microfacet that reflects wo
+// into wi.
+func (r RoughDielectricReflection) Mueller(ctx ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
+		return optics.Mueller{}, false
+	}
+	wh := wi.Add(wo).Normalize()
+	if maths.CosTheta(wh) <= 0 || wh.Length() == 0 {
+		return optics.Mueller{}, false
+	}
+	etaInside := r.InsideIOR.Evaluate(reflectionWavelength(ctx))
+	if !medium.IsValidEta(r.EtaOutside) || !medium.IsValidEta(etaInside) {
+		return optics.Mueller{}, false
+	}
+	rs, rp, _, _ := microfacet.FresnelDielectricAmplitudes(math.Abs(wi.Dot(wh)), r.EtaOutside, etaInside)
+	return optics.FresnelMueller(rs, rp).Normalized(), true
+}
+
 func (r RoughDielectricReflection) PDF(_ ShadingContext, wi, wo maths.Direction) float64 {
 	if !maths.IsUpperHemisphere(wi) || !maths.IsUpperHemisphere(wo) {
 		return 0
@@ -125,7 +143,12 @@ func (r RoughDielectricReflection) RoughnessInfo(ShadingContext) RoughnessInfo {
 	return RoughnessInfo{IsDelta: false, AlphaX: r.Alpha, AlphaY: r.Alpha}
 }
 
-func (r RoughDielectricReflection) DeltaFlags() DeltaFlags { return DeltaNone }
+func (r RoughDielectricReflection) DeltaFlags() DeltaFlags {
+	if r.InsideIOR != nil && r.InsideIOR.IsDispersive() {
+		return Dispersive
+	}
+	return DeltaNone
+}
 
 func reflectionWavelength(ctx ShadingContext) float64 {
 	if ctx.WavelengthNM > 0 && !math.IsNaN(ctx.WavelengthNM) && !math.IsInf(ctx.WavelengthNM, 0) {
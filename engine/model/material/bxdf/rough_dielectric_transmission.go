@@ -204,6 +204,31 @@ func (r RoughDielectricTransmission) Sample(ctx ShadingContext, wo maths.Directi
 	return sample
 }
 
+// Mueller is the Fresnel transmission Mueller matrix of the microfacet that
+// refracts wo into wi. Its normalized form is the same for both directions
+// of travel.
+func (r RoughDielectricTransmission) Mueller(ctx ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if maths.CosTheta(wi) == 0 || maths.CosTheta(wo) == 0 || maths.SameHemisphere(wi, wo) {
+		return optics.Mueller{}, false
+	}
+	wavelengthNM, _ := r.resolveWavelength(ctx)
+	etaInside := r.insideIOR().Evaluate(wavelengthNM)
+	if !medium.IsValidEta(r.EtaOutside) || !medium.IsValidEta(etaInside) {
+		return optics.Mueller{}, false
+	}
+	etaI, etaT := r.resolveOrientedEta(ctx, etaInside, wo)
+	owi, owo := orientTransmissionPair(wi, wo)
+	sum := owo.Add(owi.MulScalar(etaT / etaI))
+	if sum.Length() == 0 {
+		return optics.Mueller{}, false
+	}
+	_, _, ts, tp := microfacet.FresnelDielectricAmplitudes(math.Abs(owo.Dot(sum.Normalize())), etaI, etaT)
+	if ts == 0 && tp == 0 {
+		return optics.Mueller{}, false
+	}
+	return optics.FresnelMueller(ts, tp).Normalized(), true
+}
+
 func (r RoughDielectricTransmission) PDF(ctx ShadingContext, wi, wo maths.Direction) float64 {
 	if maths.CosTheta(wi) == 0 || maths.CosTheta(wo) == 0 {
 		return 0
@@ -273,7 +298,11 @@ func (r RoughDielectricTransmission) RoughnessInfo(ShadingContext) RoughnessInfo
 }
 
 func (r RoughDielectricTransmission) DeltaFlags() DeltaFlags {
-	return TransmissionEvent | NonReciprocal
+	flags := TransmissionEvent | NonReciprocal
+	if r.insideIOR().IsDispersive() {
+		flags |= Dispersive
+	}
+	return flags
 }
 
 func (r RoughDielectricTransmission) resolveWavelength(ctx ShadingContext) (float64, bool) {
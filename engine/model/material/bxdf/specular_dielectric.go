@@ -3,6 +3,7 @@ package bxdf
 import (
 	"github.com/Algo2147483647/ray/engine/maths"
 	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/material/microfacet"
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
 	"math"
@@ -44,17 +45,13 @@ func (s SpecularDielectric) Sample(ctx ShadingContext, wo maths.Direction, u mat
 		return BxDFSample{}
 	}
 
-	insideIOR := s.insideIOR()
 	wavelengthNM, spectralSample := s.resolveWavelength(ctx)
-	spectralSample = spectralSample && insideIOR.IsDispersive()
-	etaInside := insideIOR.Evaluate(wavelengthNM)
-
-	if !medium.IsValidEta(s.EtaOutside) || !medium.IsValidEta(etaInside) {
+	spectralSample = spectralSample && s.insideIOR().IsDispersive()
+	etaI, etaT, ok := s.resolveEtaAt(ctx, wavelengthNM)
+	if !ok {
 		return BxDFSample{}
 	}
 
-	etaI, etaT := s.resolveEta(ctx, etaInside)
-
 	fresnel := FresnelDielectric(math.Abs(maths.CosTheta(wo)), etaI, etaT)
 	if u.U < fresnel {
 		wi := reflectLocal(wo)
@@ -109,6 +106,29 @@ func (s SpecularDielectric) Sample(ctx ShadingContext, wo maths.Direction, u mat
 	return sample
 }
 
+// Mueller is the Fresnel reflection or transmission Mueller matrix of the
+// interface, whichever scatters wo into wi.
+func (s SpecularDielectric) Mueller(ctx ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	cosThetaO := maths.CosTheta(wo)
+	if cosThetaO == 0 {
+		return optics.Mueller{}, false
+	}
+	wavelengthNM, _ := s.resolveWavelength(ctx)
+	etaI, etaT, ok := s.resolveEtaAt(ctx, wavelengthNM)
+	if !ok {
+		return optics.Mueller{}, false
+	}
+
+	rs, rp, ts, tp := microfacet.FresnelDielectricAmplitudes(math.Abs(cosThetaO), etaI, etaT)
+	if sameDirection(wi, reflectLocal(wo)) {
+		return optics.FresnelMueller(rs, rp).Normalized(), true
+	}
+	if refracted, ok := refractLocal(wo, etaI/etaT); ok && sameDirection(wi, refracted) {
+		return optics.FresnelMueller(ts, tp).Normalized(), true
+	}
+	return optics.Mueller{}, false
+}
+
 func (s SpecularDielectric) PDF(ShadingContext, maths.Direction, maths.Direction) float64 {
 	return 0
 }
@@ -128,7 +148,11 @@ func (s SpecularDielectric) RoughnessInfo(ShadingContext) RoughnessInfo {
 }
 
 func (s SpecularDielectric) DeltaFlags() DeltaFlags {
-	return DeltaReflection | DeltaTransmission | TransmissionEvent
+	flags := DeltaReflection | DeltaTransmission | TransmissionEvent
+	if s.insideIOR().IsDispersive() {
+		flags |= Dispersive
+	}
+	return flags
 }
 
 func (s SpecularDielectric) resolveWavelength(ctx ShadingContext) (float64, bool) {
@@ -138,6 +162,17 @@ func (s SpecularDielectric) resolveWavelength(ctx ShadingContext) (float64, bool
 	return medium.DefaultWavelengthNM, false
 }
 
+// resolveEtaAt is resolveEta with the inside index evaluated at
+// wavelengthNM. It reports false when either index is invalid.
+func (s SpecularDielectric) resolveEtaAt(ctx ShadingContext, wavelengthNM float64) (float64, float64, bool) {
+	etaInside := s.insideIOR().Evaluate(wavelengthNM)
+	if !medium.IsValidEta(s.EtaOutside) || !medium.IsValidEta(etaInside) {
+		return 0, 0, false
+	}
+	etaI, etaT := s.resolveEta(ctx, etaInside)
+	return etaI, etaT, true
+}
+
 func (s SpecularDielectric) resolveEta(ctx ShadingContext, etaInside float64) (float64, float64) {
 	if medium.IsValidEta(ctx.EtaIncident) && medium.IsValidEta(ctx.EtaTransmit) {
 		return ctx.EtaIncident, ctx.EtaTransmit
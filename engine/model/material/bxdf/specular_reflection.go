@@ -37,6 +37,15 @@ func (s SpecularReflection) Sample(ctx ShadingContext, wo maths.Direction, _ mat
 	}
 }
 
+// Mueller is the Mueller matrix of an ideal mirror, which reverses the
+// handedness of the light it reflects.
+func (s SpecularReflection) Mueller(_ ShadingContext, wi, wo maths.Direction) (optics.Mueller, bool) {
+	if !maths.IsUpperHemisphere(wo) || !sameDirection(wi, reflectLocal(wo)) {
+		return optics.Mueller{}, false
+	}
+	return optics.FresnelMueller(-1, 1), true
+}
+
 func (s SpecularReflection) PDF(ShadingContext, maths.Direction, maths.Direction) float64 {
 	return 0
 }
@@ -102,3 +102,135 @@ func TestLegacyConstantRemainsTwoSidedUniformRadiance(t *testing.T) {
 		t.Fatalf("two-sided exitance = %g, want %g", got, want)
 	}
 }
+
+// testTabulated returns the same table as a radiance and as an intensity
+// distribution.
+func testTabulated(t *testing.T) []*Tabulated {
+	t.Helper()
+	polar := []float64{0, 0.3, 1.2, 2.0, 2.6}
+	azimuth := []float64{0, 1, 2.5, 4, 2 * math.Pi}
+	values := [][]float64{
+		{40, 35, 10, 2, 0},
+		{40, 20, 12, 6, 1},
+		{40, 30, 25, 0, 0},
+		{40, 50, 5, 3, 2},
+		{40, 35, 10, 2, 0},
+	}
+	radiance, err := NewTabulated(polar, azimuth, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intensity, err := NewTabulatedIntensity(polar, azimuth, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*Tabulated{radiance, intensity}
+}
+
+func TestTabulatedProjectedIntegralIsExact(t *testing.T) {
+	uniform, err := NewTabulated([]float64{0, math.Pi / 2}, []float64{0, 2 * math.Pi}, [][]float64{{3, 3}, {3, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uniform.ProjectedIntegral(3); math.Abs(got-math.Pi) > 1e-12 {
+		t.Fatalf("uniform hemisphere integral = %.15g, want π", got)
+	}
+
+	for k, distribution := range testTabulated(t) {
+		const thetaSteps, phiSteps = 2000, 1000
+		integral, pdfIntegral := 0.0, 0.0
+		for i := 0; i < thetaSteps; i++ {
+			theta := (float64(i) + 0.5) * math.Pi / thetaSteps
+			for j := 0; j < phiSteps; j++ {
+				phi := (float64(j) + 0.5) * 2 * math.Pi / phiSteps
+				wo := maths.NewDirection(math.Sin(theta)*math.Cos(phi), math.Sin(theta)*math.Sin(phi), math.Cos(theta))
+				area := math.Sin(theta) * (math.Pi / thetaSteps) * (2 * math.Pi / phiSteps)
+				integral += distribution.Eval(wo) * math.Abs(math.Cos(theta)) * area
+				pdfIntegral += distribution.PDF(wo) * area
+			}
+		}
+		if want := distribution.ProjectedIntegral(3); math.Abs(integral-want) > 1e-4*want {
+			t.Fatalf("table %d: integrated projected distribution = %.8f, want %.8f", k, integral, want)
+		}
+		if math.Abs(pdfIntegral-1) > 1e-4 {
+			t.Fatalf("table %d: integral(pdf) = %.8f, want 1", k, pdfIntegral)
+		}
+	}
+}
+
+func TestTabulatedSampleMatchesPDFAndStaysInTable(t *testing.T) {
+	for k, distribution := range testTabulated(t) {
+		for i := 0; i < 4096; i++ {
+			u := maths.Sample2D{
+				U: (float64(i) + 0.5) / 4096,
+				V: math.Mod(float64(i)*0.6180339887498949, 1),
+			}
+			sample := distribution.Sample(u, 3)
+			if sample.PDF <= 0 {
+				t.Fatalf("table %d: sample %d has no density", k, i)
+			}
+			if theta := math.Acos(sample.Wo.Component(2)); theta > 2.6+1e-9 {
+				t.Fatalf("table %d: sample left the table at θ = %g", k, theta)
+			}
+			if want := distribution.PDF(sample.Wo); math.Abs(sample.PDF-want) > 1e-9*want {
+				t.Fatalf("table %d: sample PDF %.12g != evaluated PDF %.12g", k, sample.PDF, want)
+			}
+			if distribution.Eval(sample.Wo) <= 0 {
+				t.Fatalf("table %d: sampled a direction with no emission: %+v", k, sample.Wo)
+			}
+		}
+	}
+	peak := maths.NewDirection(math.Sin(0.3)*math.Cos(4), math.Sin(0.3)*math.Sin(4), math.Cos(0.3))
+	if got := testTabulated(t)[0].Eval(peak); math.Abs(got-1) > 1e-9 {
+		t.Fatalf("peak = %g, want 1", got)
+	}
+}
+
+func TestLuminousIntensityReproducesTheTableIntensity(t *testing.T) {
+	// Candela falling linearly from I₀ at the nadir to the horizon.
+	candela := func(peak, theta float64) float64 { return peak * (1 - 2*theta/math.Pi) }
+	ctx := bxdf.ShadingContext{GeometricNormal: maths.NewDirection(0, 0, 1)}
+	const area = 0.5
+	for _, peak := range []float64{100, 10000} {
+		distribution, err := NewTabulatedIntensity([]float64{0, math.Pi / 2}, []float64{0, 2 * math.Pi}, [][]float64{{peak, 0}, {peak, 0}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitter := NewSurfaceEmitter(NewConstant(optics.ConstantSpectrum(1)), distribution, LuminousIntensity).WithArea(area)
+		for _, direction := range []struct{ theta, phi float64 }{{0, 0}, {0.3, 1}, {0.8, 2.5}, {1.2, 4}, {1.5, 5.5}} {
+			sinTheta, cosTheta := math.Sin(direction.theta), math.Cos(direction.theta)
+			wo := maths.NewDirection(sinTheta*math.Cos(direction.phi), sinTheta*math.Sin(direction.phi), cosTheta)
+			got := emitter.Eval(ctx, wo).MaxComponent() * area * cosTheta
+			if want := candela(peak, direction.theta); math.Abs(got-want) > 1e-9*peak {
+				t.Fatalf("I0 = %g: intensity at θ = %g is %.12g cd, want %.12g", peak, direction.theta, got, want)
+			}
+		}
+		// The floor at the horizon only trims the dim edge of the lobe, so
+		// the surface still sends out nearly the whole table flux.
+		flux := 2 * math.Pi * peak * (1 - 2/math.Pi)
+		if got := distribution.Flux(); math.Abs(got-flux) > 1e-9*flux {
+			t.Fatalf("flux = %.12g, want %.12g", got, flux)
+		}
+		if got := emitter.ExitanceEstimate(ctx).MaxComponent() * area; math.Abs(got-flux) > 1e-4*flux {
+			t.Fatalf("emitted flux = %g, want %g", got, flux)
+		}
+	}
+
+	horizon := maths.NewDirection(1, 0, 0)
+	distribution, err := NewTabulatedIntensity([]float64{0, math.Pi}, []float64{0, 2 * math.Pi}, [][]float64{{1, 1}, {1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := distribution.Eval(horizon), 1/intensityHorizonCosine; math.Abs(got-want) > 1e-9*want {
+		t.Fatalf("horizon radiance shape = %g, want the floored %g", got, want)
+	}
+
+	for _, emitter := range []SurfaceEmitter{
+		NewSurfaceEmitter(NewConstant(optics.ConstantSpectrum(1)), distribution, LuminousIntensity),
+		NewSurfaceEmitter(NewConstant(optics.ConstantSpectrum(1)), testTabulated(t)[0], LuminousIntensity).WithArea(area),
+	} {
+		if emitter.Eval(ctx, maths.NewDirection(0, 0, 1)).MaxComponent() != 0 {
+			t.Fatal("an emitter without an area or an intensity table must not emit")
+		}
+	}
+}
@@ -11,14 +11,29 @@ type StrengthQuantity uint8
 const (
 	PeakRadiance StrengthQuantity = iota
 	TotalExitance
+	// LuminousIntensity scales the absolute intensity of a Photometric
+	// distribution by the field: the object, whose surface has Area, sends
+	// the measured intensity toward every direction, L = I / (Area |cos θ|).
+	LuminousIntensity
 )
 
+// Photometric is an angular distribution measured in absolute intensity,
+// such as the candela table of a luminaire.
+type Photometric interface {
+	AngularDistribution
+	// PeakIntensity scales Eval·|cos θ| to the measured intensity.
+	PeakIntensity() float64
+}
+
 // SurfaceEmitter composes an authored spatial/spectral field with a normalized
 // and sampleable angular distribution.
 type SurfaceEmitter struct {
 	Field        RadianceField
 	Distribution AngularDistribution
 	Quantity     StrengthQuantity
+	// Area is the emitting area of the object a LuminousIntensity emitter
+	// belongs to.
+	Area float64
 }
 
 func NewSurfaceEmitter(field RadianceField, distribution AngularDistribution, quantity StrengthQuantity) SurfaceEmitter {
@@ -38,16 +53,35 @@ func (e SurfaceEmitter) Eval(ctx bxdf.ShadingContext, woLocal maths.Direction) o
 		return optics.Spectrum{}
 	}
 	value := e.Field.EvaluateRadiance(ctx)
-	if e.Quantity == TotalExitance {
+	switch e.Quantity {
+	case TotalExitance:
 		z := distribution.ProjectedIntegral(woLocal.Len())
 		if z <= 0 {
 			return optics.Spectrum{}
 		}
 		value = value.DivScalar(z)
+	case LuminousIntensity:
+		value = value.MulScalar(e.intensityScale())
 	}
 	return value.MulScalar(scale)
 }
 
+// WithArea returns the emitter for an object whose emitting area is area.
+func (e SurfaceEmitter) WithArea(area float64) SurfaceEmitter {
+	e.Area = area
+	return e
+}
+
+// intensityScale is the peak radiance per unit field of a LuminousIntensity
+// emitter: the peak intensity spread over Area.
+func (e SurfaceEmitter) intensityScale() float64 {
+	photometric, ok := e.angular().(Photometric)
+	if !ok || e.Area <= 0 {
+		return 0
+	}
+	return photometric.PeakIntensity() / e.Area
+}
+
 func (e SurfaceEmitter) SampleDirection(ctx bxdf.ShadingContext, u maths.Sample2D) DirectionSample {
 	dimension := ctx.GeometricNormal.Len()
 	if dimension == 0 {
@@ -71,8 +105,11 @@ func (e SurfaceEmitter) ExitanceEstimate(ctx bxdf.ShadingContext) optics.Spectru
 		return optics.Spectrum{}
 	}
 	value := e.Field.EvaluateRadiance(ctx)
-	if e.Quantity == TotalExitance {
+	switch e.Quantity {
+	case TotalExitance:
 		return value
+	case LuminousIntensity:
+		value = value.MulScalar(e.intensityScale())
 	}
 	dimension := ctx.GeometricNormal.Len()
 	if dimension == 0 {
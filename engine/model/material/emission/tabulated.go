@@ -0,0 +1,378 @@
+package emission
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/utils/iesio"
+)
+
+// Tabulated is a measured three-dimensional distribution, interpolated
+// bilinearly in the polar angle from the normal and the azimuth from the
+// local x axis. The table is normalized to a peak of one and is zero at polar
+// angles outside it; Peak keeps the scale of the measured values. A radiance
+// table is the radiance shape itself. An intensity table is the shape of
+// L·|cos θ|, so its radiance is the table over |cos θ|, floored at
+// intensityHorizonCosine.
+type Tabulated struct {
+	polar   []float64
+	azimuth []float64
+	// values[j][i] is the table at azimuth[j] and polar[i].
+	values    [][]float64
+	intensity bool
+	// cdf accumulates the projected integral of the cells, azimuth-major.
+	cdf      []float64
+	integral float64
+	peak     float64
+	// solidAngle is the integral of the table over the sphere.
+	solidAngle float64
+}
+
+// intensityHorizonCosine floors |cos θ| where an intensity table is divided
+// by it, so the radiance stays finite toward the horizon of the surface.
+const intensityHorizonCosine = 0.01
+
+// NewTabulated builds a radiance distribution from values sampled at strictly
+// increasing polar angles in [0, π] and azimuths that run from 0 to 2π.
+// values holds one row of len(polar) samples per azimuth.
+func NewTabulated(polar, azimuth []float64, values [][]float64) (*Tabulated, error) {
+	return newTabulated(polar, azimuth, values, false)
+}
+
+// NewTabulatedIntensity builds an intensity distribution from a table laid
+// out as for NewTabulated.
+func NewTabulatedIntensity(polar, azimuth []float64, values [][]float64) (*Tabulated, error) {
+	return newTabulated(polar, azimuth, values, true)
+}
+
+func newTabulated(polar, azimuth []float64, values [][]float64, intensity bool) (*Tabulated, error) {
+	if len(polar) < 2 || len(azimuth) < 2 {
+		return nil, fmt.Errorf("tabulated distribution needs at least two polar angles and two azimuths")
+	}
+	if polar[0] < 0 || polar[len(polar)-1] > math.Pi || !strictlyIncreasing(polar) {
+		return nil, fmt.Errorf("polar angles must increase strictly within [0, π]")
+	}
+	if azimuth[0] != 0 || math.Abs(azimuth[len(azimuth)-1]-2*math.Pi) > 1e-9 || !strictlyIncreasing(azimuth) {
+		return nil, fmt.Errorf("azimuths must increase strictly from 0 to 2π")
+	}
+	if len(values) != len(azimuth) {
+		return nil, fmt.Errorf("tabulated distribution has %d rows for %d azimuths", len(values), len(azimuth))
+	}
+	peak := 0.0
+	for _, row := range values {
+		if len(row) != len(polar) {
+			return nil, fmt.Errorf("tabulated distribution row has %d values for %d polar angles", len(row), len(polar))
+		}
+		for _, value := range row {
+			if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, fmt.Errorf("tabulated distribution values must be finite and >= 0")
+			}
+			peak = math.Max(peak, value)
+		}
+	}
+	if peak <= 0 {
+		return nil, fmt.Errorf("tabulated distribution is zero everywhere")
+	}
+
+	d := &Tabulated{
+		polar:     append([]float64(nil), polar...),
+		azimuth:   append([]float64(nil), azimuth...),
+		values:    make([][]float64, len(values)),
+		intensity: intensity,
+		peak:      peak,
+	}
+	for j, row := range values {
+		d.values[j] = make([]float64, len(row))
+		for i, value := range row {
+			d.values[j][i] = value / peak
+		}
+	}
+	// A node at the horizon keeps |cos θ| smooth inside every cell, and nodes
+	// where an intensity table meets its floor keep every cell on one side of
+	// it. Bilinear values are linear in the polar angle, so nodes change
+	// nothing.
+	d.splitPolar(math.Pi / 2)
+	if intensity {
+		d.splitPolar(math.Acos(intensityHorizonCosine))
+		d.splitPolar(math.Pi - math.Acos(intensityHorizonCosine))
+	}
+
+	d.cdf = make([]float64, (len(d.azimuth)-1)*(len(d.polar)-1))
+	for j := 0; j+1 < len(d.azimuth); j++ {
+		for i := 0; i+1 < len(d.polar); i++ {
+			d.integral += d.cellMass(i, j)
+			d.cdf[d.cell(i, j)] = d.integral
+			d.solidAngle += d.cellSolidAngleIntegral(i, j)
+		}
+	}
+	if d.integral <= 0 {
+		return nil, fmt.Errorf("tabulated distribution emits no flux")
+	}
+	return d, nil
+}
+
+// NewIESDistribution maps an IES profile onto the local frame as an intensity
+// table: the nadir of the luminaire points along the normal and the C0 plane
+// contains the local x axis. The candela table is normalized to its peak, so
+// Peak is the peak intensity in candela and Flux the luminous flux in lumens.
+func NewIESDistribution(profile *iesio.Profile) (*Tabulated, error) {
+	horizontal, candela := profile.FullCircle()
+	polar := make([]float64, len(profile.Vertical))
+	for i, angle := range profile.Vertical {
+		polar[i] = angle * math.Pi / 180
+	}
+	azimuth := make([]float64, len(horizontal))
+	for j, angle := range horizontal {
+		azimuth[j] = angle * math.Pi / 180
+	}
+	azimuth[len(azimuth)-1] = 2 * math.Pi
+	return NewTabulatedIntensity(polar, azimuth, candela)
+}
+
+func (d *Tabulated) Eval(wo maths.Direction) float64 {
+	theta, phi, ok := d.angles(wo)
+	if !ok {
+		return 0
+	}
+	i, j, ok := d.locate(theta, phi)
+	if !ok {
+		return 0
+	}
+	s := (theta - d.polar[i]) / (d.polar[i+1] - d.polar[i])
+	t := (phi - d.azimuth[j]) / (d.azimuth[j+1] - d.azimuth[j])
+	low := d.values[j][i]*(1-s) + d.values[j][i+1]*s
+	high := d.values[j+1][i]*(1-s) + d.values[j+1][i+1]*s
+	value := low*(1-t) + high*t
+	if d.intensity {
+		value /= math.Max(math.Abs(math.Cos(theta)), intensityHorizonCosine)
+	}
+	return value
+}
+
+// Sample picks a cell in proportion to its projected integral, then a
+// direction within it in proportion to |cos θ|, or uniformly in solid angle
+// in the cells of an intensity table above its floor, where Eval·|cos θ| is
+// the table itself.
+func (d *Tabulated) Sample(u maths.Sample2D, dimension int) AngularSample {
+	if dimension != 3 {
+		return AngularSample{}
+	}
+	target := clampUnit(u.U) * d.integral
+	index := sort.SearchFloat64s(d.cdf, target)
+	if index >= len(d.cdf) {
+		index = len(d.cdf) - 1
+	}
+	start := 0.0
+	if index > 0 {
+		start = d.cdf[index-1]
+	}
+	if d.cdf[index] <= start {
+		return AngularSample{}
+	}
+	uCell := clampUnit((target - start) / (d.cdf[index] - start))
+	i, j := index%(len(d.polar)-1), index/(len(d.polar)-1)
+
+	var theta float64
+	if d.projectedCell(i) {
+		sinA, sinB := math.Sin(d.polar[i]), math.Sin(d.polar[i+1])
+		sin2 := sinA*sinA + uCell*(sinB*sinB-sinA*sinA)
+		theta = math.Asin(math.Sqrt(math.Max(0, math.Min(1, sin2))))
+		if d.polar[i]+d.polar[i+1] > math.Pi {
+			theta = math.Pi - theta
+		}
+	} else {
+		cosA, cosB := math.Cos(d.polar[i]), math.Cos(d.polar[i+1])
+		theta = math.Acos(math.Max(-1, math.Min(1, cosA+uCell*(cosB-cosA))))
+	}
+	phi := d.azimuth[j] + clampUnit(u.V)*(d.azimuth[j+1]-d.azimuth[j])
+	sinTheta := math.Sin(theta)
+	wo := maths.NewDirection(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), math.Cos(theta))
+	pdf := d.PDF(wo)
+	if pdf <= 0 {
+		return AngularSample{}
+	}
+	return AngularSample{Wo: wo, PDF: pdf, Flags: DirectionContinuous}
+}
+
+func (d *Tabulated) PDF(wo maths.Direction) float64 {
+	theta, phi, ok := d.angles(wo)
+	if !ok {
+		return 0
+	}
+	i, j, ok := d.locate(theta, phi)
+	if !ok {
+		return 0
+	}
+	index := d.cell(i, j)
+	mass := d.cdf[index]
+	if index > 0 {
+		mass -= d.cdf[index-1]
+	}
+	if mass <= 0 {
+		return 0
+	}
+	if !d.projectedCell(i) {
+		return mass / d.integral / d.cellSolidAngle(i, j)
+	}
+	projected := d.cellProjectedSolidAngle(i, j)
+	if projected <= 0 {
+		return 0
+	}
+	return mass / d.integral / projected * math.Abs(math.Cos(theta))
+}
+
+// ProjectedIntegral is exact: the bilinear table integrates in closed form
+// against |cos θ| sin θ and sin θ.
+func (d *Tabulated) ProjectedIntegral(dimension int) float64 {
+	if dimension != 3 {
+		return 0
+	}
+	return d.integral
+}
+
+func (*Tabulated) Flags() DirectionFlags { return DirectionContinuous }
+
+// Peak is the largest measured value, which the table was divided by.
+func (d *Tabulated) Peak() float64 { return d.peak }
+
+// PeakIntensity is Peak for an intensity table and zero for a radiance
+// table, whose values have no absolute scale.
+func (d *Tabulated) PeakIntensity() float64 {
+	if !d.intensity {
+		return 0
+	}
+	return d.peak
+}
+
+// Flux integrates the measured values over the sphere. For a candela table it
+// is the luminous flux of the luminaire in lumens.
+func (d *Tabulated) Flux() float64 { return d.peak * d.solidAngle }
+
+func (d *Tabulated) angles(wo maths.Direction) (theta, phi float64, ok bool) {
+	if wo.Len() != 3 {
+		return 0, 0, false
+	}
+	x, y, z := wo.Component(0), wo.Component(1), wo.Component(2)
+	norm := math.Sqrt(x*x + y*y + z*z)
+	if norm == 0 || math.IsNaN(norm) {
+		return 0, 0, false
+	}
+	theta = math.Acos(math.Max(-1, math.Min(1, z/norm)))
+	phi = math.Atan2(y, x)
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return theta, phi, true
+}
+
+// locate returns the cell containing (theta, phi), if theta is in the table.
+func (d *Tabulated) locate(theta, phi float64) (i, j int, ok bool) {
+	if theta < d.polar[0] || theta > d.polar[len(d.polar)-1] {
+		return 0, 0, false
+	}
+	return intervalIndex(d.polar, theta), intervalIndex(d.azimuth, phi), true
+}
+
+func (d *Tabulated) cell(i, j int) int { return j*(len(d.polar)-1) + i }
+
+// splitPolar adds a polar node at angle, interpolating every row there,
+// unless angle lies outside the table or on a node.
+func (d *Tabulated) splitPolar(angle float64) {
+	split := sort.SearchFloat64s(d.polar, angle)
+	if split == 0 || split == len(d.polar) || d.polar[split] == angle {
+		return
+	}
+	t := (angle - d.polar[split-1]) / (d.polar[split] - d.polar[split-1])
+	for j, row := range d.values {
+		d.values[j] = insertAt(row, split, row[split-1]*(1-t)+row[split]*t)
+	}
+	d.polar = insertAt(d.polar, split, angle)
+}
+
+// projectedCell reports whether Eval·|cos θ| is the table times |cos θ| in
+// the cells of polar interval i, which holds everywhere except in the cells
+// of an intensity table above its floor.
+func (d *Tabulated) projectedCell(i int) bool {
+	if !d.intensity {
+		return true
+	}
+	return math.Abs(math.Cos((d.polar[i]+d.polar[i+1])/2)) < intensityHorizonCosine
+}
+
+// cellMass integrates Eval·|cos θ| over a cell.
+func (d *Tabulated) cellMass(i, j int) float64 {
+	switch {
+	case !d.intensity:
+		return d.cellIntegral(i, j)
+	case d.projectedCell(i):
+		return d.cellIntegral(i, j) / intensityHorizonCosine
+	default:
+		return d.cellSolidAngleIntegral(i, j)
+	}
+}
+
+// cellIntegral integrates the bilinear values of a cell against the
+// projected solid angle |cos θ| sin θ dθ dφ. Averaging over the azimuth
+// leaves a function linear in θ, and θ·sin θ cos θ has the antiderivative
+// sin 2θ / 8 - θ cos 2θ / 4.
+func (d *Tabulated) cellIntegral(i, j int) float64 {
+	a := (d.values[j][i] + d.values[j+1][i]) / 2
+	b := (d.values[j][i+1] + d.values[j+1][i+1]) / 2
+	thetaA, thetaB := d.polar[i], d.polar[i+1]
+	slope := (b - a) / (thetaB - thetaA)
+	f0 := func(theta float64) float64 { s := math.Sin(theta); return s * s / 2 }
+	f1 := func(theta float64) float64 { return math.Sin(2*theta)/8 - theta*math.Cos(2*theta)/4 }
+	integral := (a-slope*thetaA)*(f0(thetaB)-f0(thetaA)) + slope*(f1(thetaB)-f1(thetaA))
+	return math.Abs(integral) * (d.azimuth[j+1] - d.azimuth[j])
+}
+
+// cellSolidAngleIntegral integrates the bilinear values of a cell against
+// the solid angle sin θ dθ dφ, using the antiderivative sin θ - θ cos θ of
+// θ·sin θ.
+func (d *Tabulated) cellSolidAngleIntegral(i, j int) float64 {
+	a := (d.values[j][i] + d.values[j+1][i]) / 2
+	b := (d.values[j][i+1] + d.values[j+1][i+1]) / 2
+	thetaA, thetaB := d.polar[i], d.polar[i+1]
+	slope := (b - a) / (thetaB - thetaA)
+	f0 := func(theta float64) float64 { return -math.Cos(theta) }
+	f1 := func(theta float64) float64 { return math.Sin(theta) - theta*math.Cos(theta) }
+	integral := (a-slope*thetaA)*(f0(thetaB)-f0(thetaA)) + slope*(f1(thetaB)-f1(thetaA))
+	return integral * (d.azimuth[j+1] - d.azimuth[j])
+}
+
+func (d *Tabulated) cellSolidAngle(i, j int) float64 {
+	return math.Abs(math.Cos(d.polar[i])-math.Cos(d.polar[i+1])) * (d.azimuth[j+1] - d.azimuth[j])
+}
+
+func (d *Tabulated) cellProjectedSolidAngle(i, j int) float64 {
+	sinA, sinB := math.Sin(d.polar[i]), math.Sin(d.polar[i+1])
+	return math.Abs(sinB*sinB-sinA*sinA) / 2 * (d.azimuth[j+1] - d.azimuth[j])
+}
+
+// intervalIndex returns i with nodes[i] <= x <= nodes[i+1], clamped to the
+// table.
+func intervalIndex(nodes []float64, x float64) int {
+	i := sort.SearchFloat64s(nodes, x) - 1
+	return max(0, min(i, len(nodes)-2))
+}
+
+func strictlyIncreasing(values []float64) bool {
+	for i := 1; i < len(values); i++ {
+		if !(values[i] > values[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func insertAt(values []float64, index int, value float64) []float64 {
+	if index < 0 {
+		return append([]float64(nil), values...)
+	}
+	result := make([]float64, 0, len(values)+1)
+	result = append(result, values[:index]...)
+	result = append(result, value)
+	return append(result, values[index:]...)
+}
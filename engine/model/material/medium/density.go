@@ -0,0 +1,287 @@
+package medium
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DensityField scales a heterogeneous medium's unit-density coefficients in
+// world space. Density is zero outside the field's bounds, so tracking only
+// needs to visit the majorant segments a ray actually crosses.
+type DensityField interface {
+	Density(point *mat.VecDense) float64
+	// Majorants returns ordered, non-overlapping segments of the ray
+	// origin + t*direction, t in [0, tMax], with an upper bound on Density
+	// over each segment. Parts of the ray with zero density are omitted.
+	Majorants(origin, direction *mat.VecDense, tMax float64) []MajorantSegment
+}
+
+type MajorantSegment struct {
+	TMin, TMax float64
+	Density    float64
+}
+
+// Bounds is a world-space axis-aligned box.
+type Bounds struct {
+	Min, Max [3]float64
+}
+
+func (b Bounds) Valid() bool {
+	for axis := range 3 {
+		if math.IsNaN(b.Min[axis]) || math.IsNaN(b.Max[axis]) || math.IsInf(b.Min[axis], 0) ||
+			math.IsInf(b.Max[axis], 0) || b.Max[axis] <= b.Min[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Bounds) Contains(point *mat.VecDense) bool {
+	if point == nil || point.Len() < 3 {
+		return false
+	}
+	for axis := range 3 {
+		if value := point.AtVec(axis); value < b.Min[axis] || value > b.Max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clip returns the parameter range of the ray inside the box, restricted to
+// [0, tMax].
+func (b Bounds) Clip(origin, direction *mat.VecDense, tMax float64) (float64, float64, bool) {
+	if origin == nil || direction == nil || origin.Len() < 3 || direction.Len() < 3 {
+		return 0, 0, false
+	}
+	t0, t1 := 0.0, tMax
+	for axis := range 3 {
+		o, d := origin.AtVec(axis), direction.AtVec(axis)
+		if d == 0 {
+			if o < b.Min[axis] || o > b.Max[axis] {
+				return 0, 0, false
+			}
+			continue
+		}
+		near, far := (b.Min[axis]-o)/d, (b.Max[axis]-o)/d
+		if near > far {
+			near, far = far, near
+		}
+		t0, t1 = math.Max(t0, near), math.Min(t1, far)
+		if t0 >= t1 {
+			return 0, 0, false
+		}
+	}
+	return t0, t1, true
+}
+
+// ExpressionDensity evaluates a user function inside Bounds. The declared
+// maximum is the majorant; values are clamped to [0, maxDensity] so that
+// delta tracking stays unbiased even for a slightly optimistic bound.
+type ExpressionDensity struct {
+	evaluate   func(*mat.VecDense) float64
+	maxDensity float64
+	bounds     Bounds
+}
+
+func NewExpressionDensity(evaluate func(*mat.VecDense) float64, maxDensity float64, bounds Bounds) (*ExpressionDensity, error) {
+	if evaluate == nil {
+		return nil, fmt.Errorf("density expression is nil")
+	}
+	if math.IsNaN(maxDensity) || math.IsInf(maxDensity, 0) || maxDensity <= 0 {
+		return nil, fmt.Errorf("max_density must be finite and > 0")
+	}
+	if !bounds.Valid() {
+		return nil, fmt.Errorf("density bounds must be finite with max > min on every axis")
+	}
+	return &ExpressionDensity{evaluate: evaluate, maxDensity: maxDensity, bounds: bounds}, nil
+}
+
+func (e *ExpressionDensity) Density(point *mat.VecDense) float64 {
+	if !e.bounds.Contains(point) {
+		return 0
+	}
+	value := e.evaluate(point)
+	if math.IsNaN(value) || value <= 0 {
+		return 0
+	}
+	return math.Min(value, e.maxDensity)
+}
+
+func (e *ExpressionDensity) Majorants(origin, direction *mat.VecDense, tMax float64) []MajorantSegment {
+	t0, t1, ok := e.bounds.Clip(origin, direction, tMax)
+	if !ok {
+		return nil
+	}
+	return []MajorantSegment{{TMin: t0, TMax: t1, Density: e.maxDensity}}
+}
+
+// majorantBlockSize is the number of voxels per axis covered by one cell of
+// a GridDensity's coarse majorant grid.
+const majorantBlockSize = 8
+
+// GridDensity is a voxel grid stretched over Bounds with samples at voxel
+// centers and trilinear reconstruction. Values are stored x-fastest, then y,
+// then z. A coarse grid of per-block maxima serves as a spatially varying
+// majorant, so empty blocks are skipped entirely.
+type GridDensity struct {
+	resolution         [3]int
+	values             []float64
+	bounds             Bounds
+	majorantResolution [3]int
+	majorants          []float64
+}
+
+func NewGridDensity(resolution [3]int, values []float64, bounds Bounds) (*GridDensity, error) {
+	count := 1
+	for axis, n := range resolution {
+		if n <= 0 {
+			return nil, fmt.Errorf("density grid resolution[%d] must be > 0", axis)
+		}
+		count *= n
+	}
+	if len(values) != count {
+		return nil, fmt.Errorf("density grid has %d values, want %d", len(values), count)
+	}
+	if !bounds.Valid() {
+		return nil, fmt.Errorf("density bounds must be finite with max > min on every axis")
+	}
+	grid := &GridDensity{resolution: resolution, values: make([]float64, count), bounds: bounds}
+	for i, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+			return nil, fmt.Errorf("density grid value %d must be finite and >= 0", i)
+		}
+		grid.values[i] = value
+	}
+	grid.buildMajorants()
+	return grid, nil
+}
+
+func (g *GridDensity) Density(point *mat.VecDense) float64 {
+	if !g.bounds.Contains(point) {
+		return 0
+	}
+	var index [3]int
+	var fraction [3]float64
+	for axis := range 3 {
+		n := g.resolution[axis]
+		u := (point.AtVec(axis)-g.bounds.Min[axis])/(g.bounds.Max[axis]-g.bounds.Min[axis])*float64(n) - 0.5
+		i := math.Floor(u)
+		index[axis] = int(i)
+		fraction[axis] = u - i
+	}
+	value := 0.0
+	for corner := range 8 {
+		weight := 1.0
+		var sample [3]int
+		for axis := range 3 {
+			offset := (corner >> axis) & 1
+			sample[axis] = min(max(index[axis]+offset, 0), g.resolution[axis]-1)
+			if offset == 1 {
+				weight *= fraction[axis]
+			} else {
+				weight *= 1 - fraction[axis]
+			}
+		}
+		if weight > 0 {
+			value += weight * g.voxel(sample[0], sample[1], sample[2])
+		}
+	}
+	return value
+}
+
+func (g *GridDensity) voxel(x, y, z int) float64 {
+	return g.values[(z*g.resolution[1]+y)*g.resolution[0]+x]
+}
+
+// buildMajorants partitions Bounds into ceil(n/majorantBlockSize) cells per
+// axis. Each cell stores the maximum over every voxel sample that trilinear
+// reconstruction can reach from inside the cell.
+func (g *GridDensity) buildMajorants() {
+	for axis := range 3 {
+		g.majorantResolution[axis] = (g.resolution[axis] + majorantBlockSize - 1) / majorantBlockSize
+	}
+	m := g.majorantResolution
+	g.majorants = make([]float64, m[0]*m[1]*m[2])
+	var lo, hi [3][]int
+	for axis := range 3 {
+		n := g.resolution[axis]
+		lo[axis], hi[axis] = make([]int, m[axis]), make([]int, m[axis])
+		for cell := range m[axis] {
+			u0 := float64(cell) * float64(n) / float64(m[axis])
+			u1 := float64(cell+1) * float64(n) / float64(m[axis])
+			lo[axis][cell] = max(int(math.Floor(u0-0.5)), 0)
+			hi[axis][cell] = min(int(math.Floor(u1-0.5))+1, n-1)
+		}
+	}
+	for cz := range m[2] {
+		for cy := range m[1] {
+			for cx := range m[0] {
+				maximum := 0.0
+				for z := lo[2][cz]; z <= hi[2][cz]; z++ {
+					for y := lo[1][cy]; y <= hi[1][cy]; y++ {
+						for x := lo[0][cx]; x <= hi[0][cx]; x++ {
+							maximum = math.Max(maximum, g.voxel(x, y, z))
+						}
+					}
+				}
+				g.majorants[(cz*m[1]+cy)*m[0]+cx] = maximum
+			}
+		}
+	}
+}
+
+// Majorants walks the coarse majorant grid with a 3D DDA and reports every
+// non-empty cell the ray crosses.
+func (g *GridDensity) Majorants(origin, direction *mat.VecDense, tMax float64) []MajorantSegment {
+	t0, t1, ok := g.bounds.Clip(origin, direction, tMax)
+	if !ok {
+		return nil
+	}
+	m := g.majorantResolution
+	var cell, step [3]int
+	var nextT, deltaT [3]float64
+	for axis := range 3 {
+		cellSize := (g.bounds.Max[axis] - g.bounds.Min[axis]) / float64(m[axis])
+		d := direction.AtVec(axis)
+		offset := origin.AtVec(axis) + t0*d - g.bounds.Min[axis]
+		cell[axis] = min(max(int(offset/cellSize), 0), m[axis]-1)
+		switch {
+		case d > 0:
+			step[axis] = 1
+			nextT[axis] = t0 + (float64(cell[axis]+1)*cellSize-offset)/d
+			deltaT[axis] = cellSize / d
+		case d < 0:
+			step[axis] = -1
+			nextT[axis] = t0 + (float64(cell[axis])*cellSize-offset)/d
+			deltaT[axis] = -cellSize / d
+		default:
+			nextT[axis] = math.Inf(1)
+			deltaT[axis] = math.Inf(1)
+		}
+	}
+
+	var segments []MajorantSegment
+	for t := t0; t < t1; {
+		axis := 0
+		if nextT[1] < nextT[axis] {
+			axis = 1
+		}
+		if nextT[2] < nextT[axis] {
+			axis = 2
+		}
+		end := math.Min(math.Max(nextT[axis], t), t1)
+		if majorant := g.majorants[(cell[2]*m[1]+cell[1])*m[0]+cell[0]]; majorant > 0 && end > t {
+			segments = append(segments, MajorantSegment{TMin: t, TMax: end, Density: majorant})
+		}
+		t = end
+		cell[axis] += step[axis]
+		if cell[axis] < 0 || cell[axis] >= m[axis] {
+			break
+		}
+		nextT[axis] += deltaT[axis]
+	}
+	return segments
+}
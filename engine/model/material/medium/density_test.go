@@ -0,0 +1,103 @@
+package medium
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func unitBounds() Bounds {
+	return Bounds{Min: [3]float64{0, 0, 0}, Max: [3]float64{1, 1, 1}}
+}
+
+func TestGridDensityInterpolatesVoxelCenters(t *testing.T) {
+	values := make([]float64, 8)
+	values[7] = 8 // voxel (1, 1, 1)
+	grid, err := NewGridDensity([3]int{2, 2, 2}, values, unitBounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := grid.Density(mat.NewVecDense(3, []float64{0.75, 0.75, 0.75})); math.Abs(got-8) > 1e-12 {
+		t.Fatalf("density at voxel center = %g, want 8", got)
+	}
+	if got := grid.Density(mat.NewVecDense(3, []float64{0.5, 0.5, 0.5})); math.Abs(got-1) > 1e-12 {
+		t.Fatalf("density at grid center = %g, want 1", got)
+	}
+	if got := grid.Density(mat.NewVecDense(3, []float64{1.5, 0.5, 0.5})); got != 0 {
+		t.Fatalf("density outside bounds = %g, want 0", got)
+	}
+}
+
+func TestGridDensityMajorantsBoundDensityAndSkipEmptyBlocks(t *testing.T) {
+	const n = 32
+	values := make([]float64, n*n*n)
+	rng := rand.New(rand.NewPCG(7, 11))
+	for z := range n {
+		for y := range n {
+			for x := range n {
+				if x >= 20 && y < 12 {
+					values[(z*n+y)*n+x] = rng.Float64()
+				}
+			}
+		}
+	}
+	grid, err := NewGridDensity([3]int{n, n, n}, values, unitBounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for trial := range 200 {
+		origin := mat.NewVecDense(3, []float64{-0.5 + 2*rng.Float64(), -0.5 + 2*rng.Float64(), -0.5})
+		target := mat.NewVecDense(3, []float64{rng.Float64(), rng.Float64(), 1.5})
+		direction := mat.NewVecDense(3, nil)
+		direction.SubVec(target, origin)
+		direction.ScaleVec(1/mat.Norm(direction, 2), direction)
+
+		segments := grid.Majorants(origin, direction, 10)
+		point := mat.NewVecDense(3, nil)
+		for step := range 400 {
+			tValue := 10 * (float64(step) + 0.5) / 400
+			point.AddScaledVec(origin, tValue, direction)
+			density := grid.Density(point)
+			majorant := 0.0
+			for i, segment := range segments {
+				if i > 0 && segment.TMin < segments[i-1].TMax-1e-12 {
+					t.Fatalf("trial %d: overlapping majorant segments %+v", trial, segments)
+				}
+				if tValue >= segment.TMin && tValue <= segment.TMax {
+					majorant = segment.Density
+				}
+			}
+			if density > majorant+1e-12 {
+				t.Fatalf("trial %d: density %g at t=%g exceeds majorant %g", trial, density, tValue, majorant)
+			}
+		}
+	}
+
+	origin := mat.NewVecDense(3, []float64{0.1, 0.9, -1})
+	direction := mat.NewVecDense(3, []float64{0, 0, 1})
+	if segments := grid.Majorants(origin, direction, 10); len(segments) != 0 {
+		t.Fatalf("ray through empty blocks produced majorant segments %+v", segments)
+	}
+}
+
+func TestExpressionDensityClampsToDeclaredMajorant(t *testing.T) {
+	density, err := NewExpressionDensity(func(point *mat.VecDense) float64 {
+		return 4 * point.AtVec(0)
+	}, 2, unitBounds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := density.Density(mat.NewVecDense(3, []float64{0.9, 0.5, 0.5})); got != 2 {
+		t.Fatalf("density = %g, want clamp to 2", got)
+	}
+	segments := density.Majorants(mat.NewVecDense(3, []float64{-1, 0.5, 0.5}), mat.NewVecDense(3, []float64{1, 0, 0}), 10)
+	if len(segments) != 1 || math.Abs(segments[0].TMin-1) > 1e-12 || math.Abs(segments[0].TMax-2) > 1e-12 {
+		t.Fatalf("unexpected majorant segments %+v", segments)
+	}
+	if _, err := NewExpressionDensity(func(*mat.VecDense) float64 { return 1 }, 0, unitBounds()); err == nil {
+		t.Fatal("expected a non-positive max_density to be rejected")
+	}
+}
@@ -2,6 +2,7 @@ package medium
 
 import (
 	"fmt"
+	"slices"
 )
 
 type Medium interface {
@@ -10,6 +11,7 @@ type Medium interface {
 	IOR(ctx WavelengthContext) float64
 	SigmaA(ctx WavelengthContext) CoefficientSpectrum
 	SigmaS(ctx WavelengthContext) CoefficientSpectrum
+	Phase() PhaseFunction
 }
 
 type WavelengthContext interface {
@@ -30,6 +32,7 @@ type Homogeneous struct {
 	eta    Model
 	sigmaA Coefficient
 	sigmaS Coefficient
+	phase  PhaseFunction
 }
 
 func NewHomogeneous(id MediumID, name string, eta Model) Homogeneous {
@@ -37,6 +40,11 @@ func NewHomogeneous(id MediumID, name string, eta Model) Homogeneous {
 }
 
 func NewHomogeneousWithCoefficients(id MediumID, name string, eta Model, sigmaA, sigmaS Coefficient) Homogeneous {
+	return NewHomogeneousWithPhase(id, name, eta, sigmaA, sigmaS, nil)
+}
+
+// NewHomogeneousWithPhase defaults a nil phase function to isotropic scattering.
+func NewHomogeneousWithPhase(id MediumID, name string, eta Model, sigmaA, sigmaS Coefficient, phase PhaseFunction) Homogeneous {
 	if eta == nil {
 		eta = NewConstant(1)
 	}
@@ -46,12 +54,16 @@ func NewHomogeneousWithCoefficients(id MediumID, name string, eta Model, sigmaA,
 	if sigmaS == nil {
 		sigmaS = ConstantCoefficient(0)
 	}
+	if phase == nil {
+		phase = NewIsotropic()
+	}
 	return Homogeneous{
 		id:     id,
 		name:   name,
 		eta:    eta,
 		sigmaA: sigmaA,
 		sigmaS: sigmaS,
+		phase:  phase,
 	}
 }
 
@@ -95,6 +107,34 @@ func (h Homogeneous) SigmaS(ctx WavelengthContext) CoefficientSpectrum {
 	return h.sigmaS.Eval(ctx)
 }
 
+func (h Homogeneous) Phase() PhaseFunction {
+	if h.phase == nil {
+		return NewIsotropic()
+	}
+	return h.phase
+}
+
+// Heterogeneous is a Homogeneous medium whose absorption and scattering
+// coefficients are scaled by a spatial density: sigma(x, lambda) =
+// density(x) * sigma(lambda). SigmaA and SigmaS report the unit-density values.
+type Heterogeneous struct {
+	Homogeneous
+	density DensityField
+}
+
+func NewHeterogeneous(
+	id MediumID, name string, eta Model, sigmaA, sigmaS Coefficient, phase PhaseFunction, density DensityField,
+) Heterogeneous {
+	return Heterogeneous{
+		Homogeneous: NewHomogeneousWithPhase(id, name, eta, sigmaA, sigmaS, phase),
+		density:     density,
+	}
+}
+
+func (h Heterogeneous) Density() DensityField {
+	return h.density
+}
+
 type Registry struct {
 	mediaByID map[MediumID]Medium
 	idByName  map[string]MediumID
@@ -127,6 +167,10 @@ func (r *Registry) RegisterHomogeneous(name string, eta Model) (MediumID, error)
 }
 
 func (r *Registry) RegisterHomogeneousWithCoefficients(name string, eta Model, sigmaA, sigmaS Coefficient) (MediumID, error) {
+	return r.RegisterHomogeneousWithPhase(name, eta, sigmaA, sigmaS, nil)
+}
+
+func (r *Registry) RegisterHomogeneousWithPhase(name string, eta Model, sigmaA, sigmaS Coefficient, phase PhaseFunction) (MediumID, error) {
 	if r == nil {
 		return MediumNone, fmt.Errorf("medium registry is nil")
 	}
@@ -134,11 +178,31 @@ func (r *Registry) RegisterHomogeneousWithCoefficients(name string, eta Model, s
 		return MediumNone, fmt.Errorf("medium name must not be empty")
 	}
 	if existing, ok := r.idByName[name]; ok {
-		r.Set(existing, name, NewHomogeneousWithCoefficients(existing, name, eta, sigmaA, sigmaS))
+		r.Set(existing, name, NewHomogeneousWithPhase(existing, name, eta, sigmaA, sigmaS, phase))
 		return existing, nil
 	}
 	id := r.nextID
-	r.Set(id, name, NewHomogeneousWithCoefficients(id, name, eta, sigmaA, sigmaS))
+	r.Set(id, name, NewHomogeneousWithPhase(id, name, eta, sigmaA, sigmaS, phase))
+	return id, nil
+}
+
+func (r *Registry) RegisterHeterogeneous(
+	name string, eta Model, sigmaA, sigmaS Coefficient, phase PhaseFunction, density DensityField,
+) (MediumID, error) {
+	if r == nil {
+		return MediumNone, fmt.Errorf("medium registry is nil")
+	}
+	if name == "" {
+		return MediumNone, fmt.Errorf("medium name must not be empty")
+	}
+	if density == nil {
+		return MediumNone, fmt.Errorf("heterogeneous medium %q needs a density field", name)
+	}
+	id, ok := r.idByName[name]
+	if !ok {
+		id = r.nextID
+	}
+	r.Set(id, name, NewHeterogeneous(id, name, eta, sigmaA, sigmaS, phase, density))
 	return id, nil
 }
 
@@ -150,6 +214,19 @@ func (r *Registry) ID(name string) (MediumID, bool) {
 	return id, ok
 }
 
+// IDs returns every registered medium ID in ascending order.
+func (r *Registry) IDs() []MediumID {
+	if r == nil {
+		return nil
+	}
+	ids := make([]MediumID, 0, len(r.mediaByID))
+	for id := range r.mediaByID {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
 func (r *Registry) Get(id MediumID) Medium {
 	if r == nil {
 		return nil
@@ -187,6 +264,23 @@ func (r *Registry) SigmaS(id MediumID, ctx WavelengthContext) CoefficientSpectru
 	return m.SigmaS(ctx)
 }
 
+func (r *Registry) Phase(id MediumID) PhaseFunction {
+	m := r.mediumOrAir(id)
+	if m == nil {
+		return NewIsotropic()
+	}
+	return m.Phase()
+}
+
+// Density returns the density field of a heterogeneous medium, or nil for a
+// homogeneous one.
+func (r *Registry) Density(id MediumID) DensityField {
+	if m, ok := r.mediumOrAir(id).(Heterogeneous); ok {
+		return m.Density()
+	}
+	return nil
+}
+
 func (r *Registry) mediumOrAir(id MediumID) Medium {
 	if id == MediumNone {
 		id = MediumAir
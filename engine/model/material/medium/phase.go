@@ -0,0 +1,80 @@
+package medium
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+)
+
+// PhaseFunction describes angular scattering inside a participating medium.
+// cosTheta is measured between the propagation direction arriving at the
+// scattering point and the scattered direction. Sampled directions are local to
+// a frame whose last axis is the propagation direction.
+type PhaseFunction interface {
+	Eval(cosTheta float64) float64
+	Sample(u maths.Sample2D) (maths.Direction, float64)
+	PDF(cosTheta float64) float64
+}
+
+type Isotropic struct{}
+
+func NewIsotropic() Isotropic {
+	return Isotropic{}
+}
+
+func (Isotropic) Eval(float64) float64 {
+	return 1 / (4 * math.Pi)
+}
+
+func (p Isotropic) Sample(u maths.Sample2D) (maths.Direction, float64) {
+	cosTheta := 1 - 2*u.U
+	return sphericalDirection(cosTheta, 2*math.Pi*u.V), p.PDF(cosTheta)
+}
+
+func (p Isotropic) PDF(cosTheta float64) float64 {
+	return p.Eval(cosTheta)
+}
+
+// HenyeyGreenstein is the single-lobe HG phase function. Positive G favors
+// forward scattering, negative G back scattering.
+type HenyeyGreenstein struct {
+	G float64
+}
+
+func NewHenyeyGreenstein(g float64) HenyeyGreenstein {
+	return HenyeyGreenstein{G: math.Max(-maxHenyeyGreensteinG, math.Min(maxHenyeyGreensteinG, g))}
+}
+
+// maxHenyeyGreensteinG keeps the lobe finite; |g| = 1 is a delta distribution.
+const maxHenyeyGreensteinG = 0.999
+
+func (p HenyeyGreenstein) Eval(cosTheta float64) float64 {
+	g := p.G
+	denominator := 1 + g*g - 2*g*cosTheta
+	if denominator <= 0 {
+		return 0
+	}
+	return (1 - g*g) / (4 * math.Pi * denominator * math.Sqrt(denominator))
+}
+
+func (p HenyeyGreenstein) Sample(u maths.Sample2D) (maths.Direction, float64) {
+	g := p.G
+	var cosTheta float64
+	if math.Abs(g) < 1e-3 {
+		cosTheta = 1 - 2*u.U
+	} else {
+		s := (1 - g*g) / (1 - g + 2*g*u.U)
+		cosTheta = (1 + g*g - s*s) / (2 * g)
+	}
+	cosTheta = math.Max(-1, math.Min(1, cosTheta))
+	return sphericalDirection(cosTheta, 2*math.Pi*u.V), p.PDF(cosTheta)
+}
+
+func (p HenyeyGreenstein) PDF(cosTheta float64) float64 {
+	return p.Eval(cosTheta)
+}
+
+func sphericalDirection(cosTheta, phi float64) maths.Direction {
+	sinTheta := math.Sqrt(math.Max(0, 1-cosTheta*cosTheta))
+	return maths.NewDirection(sinTheta*math.Cos(phi), sinTheta*math.Sin(phi), cosTheta)
+}
@@ -0,0 +1,49 @@
+package medium
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+)
+
+func TestPhaseFunctionsIntegrateToOne(t *testing.T) {
+	const steps = 20000
+	for _, phase := range []PhaseFunction{NewIsotropic(), NewHenyeyGreenstein(0.7), NewHenyeyGreenstein(-0.4)} {
+		integral := 0.0
+		for i := range steps {
+			cosTheta := -1 + 2*(float64(i)+0.5)/steps
+			integral += 2 * math.Pi * phase.Eval(cosTheta) * 2 / steps
+		}
+		if math.Abs(integral-1) > 1e-3 {
+			t.Fatalf("%#v integrates to %g, want 1", phase, integral)
+		}
+	}
+}
+
+func TestHenyeyGreensteinSampleMatchesPDFAndMeanCosine(t *testing.T) {
+	phase := NewHenyeyGreenstein(0.5)
+	const n = 256
+	meanCosine := 0.0
+	for i := range n {
+		for j := range n {
+			u := maths.Sample2D{U: (float64(i) + 0.5) / n, V: (float64(j) + 0.5) / n}
+			direction, pdf := phase.Sample(u)
+			cosTheta := maths.CosTheta(direction)
+			if math.Abs(pdf-phase.PDF(cosTheta)) > 1e-9 {
+				t.Fatalf("sample pdf %g differs from PDF %g", pdf, phase.PDF(cosTheta))
+			}
+			meanCosine += cosTheta
+		}
+	}
+	meanCosine /= n * n
+	if math.Abs(meanCosine-0.5) > 1e-3 {
+		t.Fatalf("mean cosine %g, want g = 0.5", meanCosine)
+	}
+}
+
+func TestNewHenyeyGreensteinClampsAsymmetry(t *testing.T) {
+	if got := NewHenyeyGreenstein(2).G; got != maxHenyeyGreensteinG {
+		t.Fatalf("g = %g, want %g", got, maxHenyeyGreensteinG)
+	}
+}
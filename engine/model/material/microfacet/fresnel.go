@@ -3,6 +3,7 @@ package microfacet
 import (
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"math"
+	"math/cmplx"
 )
 
 func FresnelDielectric(cosThetaI, etaI, etaT float64) float64 {
@@ -75,6 +76,45 @@ func fresnelConductorChannel(cosThetaI, eta, k float64) float64 {
 	return clamp((rp+rs)*0.5, 0, 1)
 }
 
+// FresnelDielectricAmplitudes returns the complex amplitude coefficients of
+// the s- and p-polarized components reflected (rs, rp) and transmitted
+// (ts, tp) at a dielectric interface, with the same conventions as
+// FresnelDielectric. Beyond the critical angle the reflection is total: rs
+// and rp are unit phasors and nothing is transmitted.
+func FresnelDielectricAmplitudes(cosThetaI, etaI, etaT float64) (rs, rp, ts, tp complex128) {
+	cosThetaI = clamp(cosThetaI, -1, 1)
+	if cosThetaI < 0 {
+		etaI, etaT = etaT, etaI
+		cosThetaI = -cosThetaI
+	}
+	rs, rp, ts, tp = fresnelAmplitudes(cosThetaI, complex(etaT/etaI, 0))
+	if sinThetaT := etaI / etaT * math.Sqrt(math.Max(0, 1-cosThetaI*cosThetaI)); sinThetaT >= 1 {
+		ts, tp = 0, 0
+	}
+	return rs, rp, ts, tp
+}
+
+// FresnelConductorAmplitudes returns the complex reflection coefficients rs
+// and rp of a conductor with complex index of refraction eta + ik relative
+// to the incident medium. Their mean intensity is fresnelConductorChannel.
+func FresnelConductorAmplitudes(cosThetaI, eta, k float64) (rs, rp complex128) {
+	rs, rp, _, _ = fresnelAmplitudes(math.Abs(clamp(cosThetaI, -1, 1)), complex(eta, k))
+	return rs, rp
+}
+
+// fresnelAmplitudes evaluates the Fresnel equations for light arriving at
+// cosThetaI onto a medium of relative complex index eta.
+func fresnelAmplitudes(cosThetaI float64, eta complex128) (rs, rp, ts, tp complex128) {
+	cosI := complex(cosThetaI, 0)
+	sin2I := complex(1-cosThetaI*cosThetaI, 0)
+	cosT := cmplx.Sqrt(1 - sin2I/(eta*eta))
+	rs = (cosI - eta*cosT) / (cosI + eta*cosT)
+	rp = (eta*cosI - cosT) / (eta*cosI + cosT)
+	ts = 2 * cosI / (cosI + eta*cosT)
+	tp = 2 * cosI / (eta*cosI + cosT)
+	return rs, rp, ts, tp
+}
+
 func clamp(v, lo, hi float64) float64 {
 	if v < lo {
 		return lo
@@ -0,0 +1,41 @@
+package microfacet
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestFresnelDielectricAmplitudesMatchReflectance(t *testing.T) {
+	for _, cos := range []float64{1, 0.8, 0.3, -0.5, -0.95} {
+		rs, rp, _, _ := FresnelDielectricAmplitudes(cos, 1, 1.5)
+		got := 0.5 * (cmplx.Abs(rs)*cmplx.Abs(rs) + cmplx.Abs(rp)*cmplx.Abs(rp))
+		if want := FresnelDielectric(cos, 1, 1.5); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("cos %g: amplitudes reflect %g, want %g", cos, got, want)
+		}
+	}
+}
+
+func TestFresnelDielectricAmplitudesVanishForPAtBrewsterAngle(t *testing.T) {
+	rs, rp, _, _ := FresnelDielectricAmplitudes(math.Cos(math.Atan(1.5)), 1, 1.5)
+	if cmplx.Abs(rp) > 1e-9 || cmplx.Abs(rs) < 0.1 {
+		t.Fatalf("Brewster reflection rs = %v, rp = %v, want rp = 0", rs, rp)
+	}
+}
+
+func TestFresnelDielectricAmplitudesTransmitNothingUnderTotalInternalReflection(t *testing.T) {
+	rs, rp, ts, tp := FresnelDielectricAmplitudes(-0.2, 1, 1.5)
+	if ts != 0 || tp != 0 || math.Abs(cmplx.Abs(rs)-1) > 1e-9 || math.Abs(cmplx.Abs(rp)-1) > 1e-9 {
+		t.Fatalf("total internal reflection gives rs %v, rp %v, ts %v, tp %v", rs, rp, ts, tp)
+	}
+}
+
+func TestFresnelConductorAmplitudesMatchReflectance(t *testing.T) {
+	for _, cos := range []float64{1, 0.6, 0.1} {
+		rs, rp := FresnelConductorAmplitudes(cos, 0.2, 3)
+		got := 0.5 * (cmplx.Abs(rs)*cmplx.Abs(rs) + cmplx.Abs(rp)*cmplx.Abs(rp))
+		if want := fresnelConductorChannel(cos, 0.2, 3); math.Abs(got-want) > 1e-9 {
+			t.Fatalf("cos %g: amplitudes reflect %g, want %g", cos, got, want)
+		}
+	}
+}
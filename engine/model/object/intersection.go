@@ -22,9 +22,15 @@ type SurfaceHit struct {
 	Object          *Object
 }
 
+// TraversalStats counts the work of closest-hit queries.
+type TraversalStats struct {
+	NodeVisits int64 // BVH nodes whose bounds were tested
+	ShapeTests int64 // shape intersection calls
+}
+
 // GetIntersection finds the intersection between a ray and an object.
 func (t *ObjectTree) GetIntersection(raySt, rayDir *mat.VecDense, node *ObjectNode) (float64, *Object) {
-	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, node, shape.NewIntersectOptions(utils.EPS, math.MaxFloat64))
+	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, node, shape.NewIntersectOptions(utils.EPS, math.MaxFloat64), nil)
 	if !ok {
 		return math.MaxFloat64, nil
 	}
@@ -32,7 +38,7 @@ func (t *ObjectTree) GetIntersection(raySt, rayDir *mat.VecDense, node *ObjectNo
 }
 
 func (t *ObjectTree) GetSurfaceInteraction(raySt, rayDir *mat.VecDense, node *ObjectNode, tMin, tMax float64) (shape.SurfaceInteraction, *Object, bool) {
-	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, node, shape.NewIntersectOptions(tMin, tMax))
+	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, node, shape.NewIntersectOptions(tMin, tMax), nil)
 	if !ok {
 		return shape.SurfaceInteraction{}, nil, false
 	}
@@ -43,15 +49,19 @@ func (t *ObjectTree) GetSurfaceInteraction(raySt, rayDir *mat.VecDense, node *Ob
 	return interaction, obj, true
 }
 
-func (t *ObjectTree) getClosestInteraction(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions) (shape.SurfaceInteraction, *Object, bool) {
-	if _, ok := nodeOverlapNear(raySt, rayDir, node, options); !ok {
+// getClosestInteraction adds its work to stats unless stats is nil.
+func (t *ObjectTree) getClosestInteraction(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions, stats *TraversalStats) (shape.SurfaceInteraction, *Object, bool) {
+	if _, ok := nodeOverlapNear(raySt, rayDir, node, options, stats); !ok {
 		return shape.SurfaceInteraction{}, nil, false
 	}
-	return t.getClosestInteractionInOverlappedNode(raySt, rayDir, node, options)
+	return t.getClosestInteractionInOverlappedNode(raySt, rayDir, node, options, stats)
 }
 
-func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions) (shape.SurfaceInteraction, *Object, bool) {
+func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions, stats *TraversalStats) (shape.SurfaceInteraction, *Object, bool) {
 	if node.Obj != nil {
+		if stats != nil {
+			stats.ShapeTests++
+		}
 		interaction, ok := node.Obj.Shape.IntersectAffine(raySt, rayDir, options)
 		if !ok {
 			return shape.SurfaceInteraction{}, nil, false
@@ -62,8 +72,8 @@ func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.Ve
 
 	left := node.Children[0]
 	right := node.Children[1]
-	leftNear, leftOK := nodeOverlapNear(raySt, rayDir, left, options)
-	rightNear, rightOK := nodeOverlapNear(raySt, rayDir, right, options)
+	leftNear, leftOK := nodeOverlapNear(raySt, rayDir, left, options, stats)
+	rightNear, rightOK := nodeOverlapNear(raySt, rayDir, right, options, stats)
 	if !leftOK && !rightOK {
 		return shape.SurfaceInteraction{}, nil, false
 	}
@@ -79,7 +89,7 @@ func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.Ve
 		bestOK          bool
 	)
 	if leftOK && leftNear <= options.Range.Max {
-		interaction, obj, ok := t.getClosestInteractionInOverlappedNode(raySt, rayDir, left, options)
+		interaction, obj, ok := t.getClosestInteractionInOverlappedNode(raySt, rayDir, left, options, stats)
 		if ok {
 			bestInteraction = interaction
 			bestObj = obj
@@ -88,7 +98,7 @@ func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.Ve
 		}
 	}
 	if rightOK && rightNear <= options.Range.Max {
-		interaction, obj, ok := t.getClosestInteractionInOverlappedNode(raySt, rayDir, right, options)
+		interaction, obj, ok := t.getClosestInteractionInOverlappedNode(raySt, rayDir, right, options, stats)
 		if ok && (!bestOK || interaction.Distance < bestInteraction.Distance) {
 			bestInteraction = interaction
 			bestObj = obj
@@ -98,10 +108,13 @@ func (t *ObjectTree) getClosestInteractionInOverlappedNode(raySt, rayDir *mat.Ve
 	return bestInteraction, bestObj, bestOK
 }
 
-func nodeOverlapNear(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions) (float64, bool) {
+func nodeOverlapNear(raySt, rayDir *mat.VecDense, node *ObjectNode, options shape.IntersectOptions, stats *TraversalStats) (float64, bool) {
 	if node == nil {
 		return 0, false
 	}
+	if stats != nil {
+		stats.NodeVisits++
+	}
 	if node.BoundBox == nil {
 		return options.Range.Min, true
 	}
@@ -122,7 +135,18 @@ func (t *ObjectTree) GetSurfaceHitRangeInGeometry(
 	g geometry.Geometry,
 	tMin, tMax float64,
 ) (*SurfaceHit, bool) {
-	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, t.Root, shape.NewIntersectOptions(tMin, tMax))
+	return t.CountSurfaceHitRangeInGeometry(raySt, rayDir, g, tMin, tMax, nil)
+}
+
+// CountSurfaceHitRangeInGeometry is GetSurfaceHitRangeInGeometry that adds
+// its BVH node visits and shape tests to stats unless stats is nil.
+func (t *ObjectTree) CountSurfaceHitRangeInGeometry(
+	raySt, rayDir *mat.VecDense,
+	g geometry.Geometry,
+	tMin, tMax float64,
+	stats *TraversalStats,
+) (*SurfaceHit, bool) {
+	interaction, obj, ok := t.getClosestInteraction(raySt, rayDir, t.Root, shape.NewIntersectOptions(tMin, tMax), stats)
 	if !ok || obj == nil {
 		return nil, false
 	}
@@ -133,6 +157,18 @@ func (t *ObjectTree) GetGeodesicSurfaceHit(
 	raySt, rayDir *mat.VecDense,
 	g geometry.Geometry,
 	paramMin, paramMax float64,
+) (*SurfaceHit, bool) {
+	return t.CountGeodesicSurfaceHit(raySt, rayDir, g, paramMin, paramMax, nil)
+}
+
+// CountGeodesicSurfaceHit is GetGeodesicSurfaceHit that adds its shape tests
+// to stats unless stats is nil. Geodesic queries test every object without
+// the BVH, so they visit no nodes.
+func (t *ObjectTree) CountGeodesicSurfaceHit(
+	raySt, rayDir *mat.VecDense,
+	g geometry.Geometry,
+	paramMin, paramMax float64,
+	stats *TraversalStats,
 ) (*SurfaceHit, bool) {
 	if g == nil {
 		return nil, false
@@ -148,6 +184,9 @@ func (t *ObjectTree) GetGeodesicSurfaceHit(
 		if obj == nil || obj.Shape == nil {
 			continue
 		}
+		if stats != nil {
+			stats.ShapeTests++
+		}
 		interaction, ok := obj.Shape.IntersectGeodesic(
 			raySt,
 			rayDir,
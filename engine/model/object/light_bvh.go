@@ -0,0 +1,522 @@
+package object
+
+import (
+	"math"
+	"sort"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Light is an emissive surface sampled by area. Power is the emitted-power
+// estimate that weights it against the other lights.
+type Light struct {
+	Object  *Object
+	Sampler shape.SurfaceSampler
+	Area    float64
+	Power   float64
+}
+
+// LightTree is a bounding-volume hierarchy over the emissive surfaces of a
+// scene. Every node bounds the position, power and emitted directions of its
+// lights, so a shading point can select lights by their estimated
+// contribution instead of by power alone. Surface samplers are
+// three-dimensional, and so is the tree.
+//
+// The scene's infinite and delta lights are selected next to the tree; light
+// indices from len(Lights) on refer to Infinite and then to Delta.
+// SceneCenter and SceneRadius bound the finite scene, which infinite and
+// directional lights illuminate from outside.
+type LightTree struct {
+	Lights   []Light
+	Infinite []light.Infinite
+	Delta    []light.Delta
+	Power    float64
+
+	SceneCenter [3]float64
+	SceneRadius float64
+
+	nodes    []lightNode
+	leaves   []int // node of every light
+	byObject map[*Object]int
+}
+
+type lightNode struct {
+	Bounds   lightBounds
+	Children [2]int
+	Parent   int
+	Light    int // -1 for internal nodes
+}
+
+// lightBounds bounds a group of lights: their box, their total power, the
+// cone holding every surface normal (Axis, CosNormal) and the spread of
+// emission around those normals (CosEmission). TwoSided lights also emit
+// around the negated normals.
+type lightBounds struct {
+	Min, Max    [3]float64
+	Power       float64
+	Axis        [3]float64
+	CosNormal   float64
+	CosEmission float64
+	TwoSided    bool
+}
+
+// BuildLightTree collects every emissive object with a sampleable surface and
+// builds a LightTree over them.
+func (t *ObjectTree) BuildLightTree() *LightTree {
+	if t == nil {
+		return NewLightTree(nil)
+	}
+	lights := make([]Light, 0)
+	for _, obj := range t.Objects {
+		if obj == nil || obj.Material == nil || !obj.Material.HasEmission() || obj.Shape == nil {
+			continue
+		}
+		sampler, ok := obj.Shape.(shape.SurfaceSampler)
+		if !ok {
+			continue
+		}
+		area := sampler.SurfaceArea()
+		if area <= 0 || math.IsNaN(area) || math.IsInf(area, 0) {
+			continue
+		}
+		exitance := obj.Material.Emission.ExitanceEstimate(bxdf.ShadingContext{
+			SpectrumMode:    optics.SpectrumModeRGB,
+			GeometricNormal: maths.NewDirection(0, 0, 1),
+		})
+		powerEstimate := exitance.MaxComponent()
+		if powerEstimate <= 0 || math.IsNaN(powerEstimate) || math.IsInf(powerEstimate, 0) {
+			powerEstimate = 1
+		}
+		lights = append(lights, Light{Object: obj, Sampler: sampler, Area: area, Power: area * powerEstimate})
+	}
+	lightTree := NewLightTree(lights)
+	if len(t.InfiniteLights) > 0 || len(t.DeltaLights) > 0 {
+		lightTree.Infinite = append([]light.Infinite(nil), t.InfiniteLights...)
+		lightTree.Delta = append([]light.Delta(nil), t.DeltaLights...)
+		lightTree.SceneCenter, lightTree.SceneRadius = t.boundingSphere()
+	}
+	return lightTree
+}
+
+// NewLightTree builds a LightTree over lights, dropping those without
+// positive power or a three-dimensional bounding box.
+func NewLightTree(lights []Light) *LightTree {
+	t := &LightTree{byObject: make(map[*Object]int, len(lights))}
+	bounds := make([]lightBounds, 0, len(lights))
+	for _, light := range lights {
+		b, ok := boundLight(light)
+		if !ok {
+			continue
+		}
+		t.byObject[light.Object] = len(t.Lights)
+		t.Lights = append(t.Lights, light)
+		t.Power += light.Power
+		bounds = append(bounds, b)
+	}
+	if len(t.Lights) == 0 {
+		return t
+	}
+
+	t.leaves = make([]int, len(t.Lights))
+	order := make([]int, len(t.Lights))
+	for i := range order {
+		order[i] = i
+	}
+	t.nodes = make([]lightNode, 0, 2*len(t.Lights)-1)
+	t.build(order, bounds, -1)
+	return t
+}
+
+// Len returns the number of lights in the tree, infinite and delta ones
+// included.
+func (t *LightTree) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.Lights) + len(t.Infinite) + len(t.Delta)
+}
+
+// Index returns the light index of obj.
+func (t *LightTree) Index(obj *Object) (int, bool) {
+	if t == nil {
+		return 0, false
+	}
+	index, ok := t.byObject[obj]
+	return index, ok
+}
+
+// Sample chooses a light for the reference point p with the uniform u and
+// returns its index and probability. A nil p selects by power alone.
+func (t *LightTree) Sample(p *mat.VecDense, u float64) (int, float64, bool) {
+	if t.Len() == 0 {
+		return 0, 0, false
+	}
+	separatePMF, separate := t.separatePMF(), t.Len()-len(t.Lights)
+	if separateShare := separatePMF * float64(separate); u < separateShare {
+		index := min(int(u/separatePMF), separate-1)
+		return len(t.Lights) + index, separatePMF, true
+	} else if separateShare > 0 {
+		u = math.Min((u-separateShare)/(1-separateShare), math.Nextafter(1, 0))
+	}
+	if len(t.Lights) == 0 || t.Power <= 0 || math.IsNaN(t.Power) || math.IsInf(t.Power, 0) {
+		return 0, 0, false
+	}
+	point, spatial := referencePoint(p)
+	node, pmf := 0, t.areaShare()
+	for t.nodes[node].Light < 0 {
+		children := t.nodes[node].Children
+		left := t.importance(children[0], point, spatial)
+		right := t.importance(children[1], point, spatial)
+		total := left + right
+		if total <= 0 || math.IsNaN(total) || math.IsInf(total, 0) {
+			return 0, 0, false
+		}
+		probability := left / total
+		if u < probability {
+			node, pmf = children[0], pmf*probability
+			u /= probability
+		} else {
+			node, pmf = children[1], pmf*(1-probability)
+			u = (u - probability) / (1 - probability)
+		}
+		u = math.Min(u, math.Nextafter(1, 0))
+	}
+	index := t.nodes[node].Light
+	if !spatial {
+		pmf = t.areaShare() * t.Lights[index].Power / t.Power
+	}
+	return index, pmf, pmf > 0
+}
+
+// PMF returns the probability that Sample chooses light index for the
+// reference point p.
+func (t *LightTree) PMF(p *mat.VecDense, index int) float64 {
+	if index < 0 || index >= t.Len() {
+		return 0
+	}
+	if index >= len(t.Lights) {
+		return t.separatePMF()
+	}
+	if t.Power <= 0 {
+		return 0
+	}
+	point, spatial := referencePoint(p)
+	if !spatial {
+		return t.areaShare() * t.Lights[index].Power / t.Power
+	}
+	pmf := t.areaShare()
+	for node := t.leaves[index]; t.nodes[node].Parent >= 0; node = t.nodes[node].Parent {
+		children := t.nodes[t.nodes[node].Parent].Children
+		left := t.importance(children[0], point, spatial)
+		right := t.importance(children[1], point, spatial)
+		own := left
+		if children[1] == node {
+			own = right
+		}
+		if own <= 0 || math.IsNaN(left+right) || math.IsInf(left+right, 0) {
+			return 0
+		}
+		pmf *= own / (left + right)
+	}
+	return pmf
+}
+
+// build appends the subtree over the lights in order and returns its node.
+func (t *LightTree) build(order []int, bounds []lightBounds, parent int) int {
+	node := len(t.nodes)
+	t.nodes = append(t.nodes, lightNode{Parent: parent, Light: -1})
+	if len(order) == 1 {
+		t.nodes[node].Bounds = bounds[order[0]]
+		t.nodes[node].Light = order[0]
+		t.leaves[order[0]] = node
+		return node
+	}
+
+	mid := splitLights(order, bounds)
+	left := t.build(order[:mid], bounds, node)
+	right := t.build(order[mid:], bounds, node)
+	t.nodes[node].Children = [2]int{left, right}
+	t.nodes[node].Bounds = unionLightBounds(t.nodes[left].Bounds, t.nodes[right].Bounds)
+	return node
+}
+
+// splitLights partitions order at the binned split with the lowest
+// surface-area-orientation cost and returns the size of the first part.
+func splitLights(order []int, bounds []lightBounds) int {
+	var total lightBounds
+	minCenter := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	maxCenter := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, i := range order {
+		total = unionLightBounds(total, bounds[i])
+		center := bounds[i].center()
+		for dim := range center {
+			minCenter[dim] = math.Min(minCenter[dim], center[dim])
+			maxCenter[dim] = math.Max(maxCenter[dim], center[dim])
+		}
+	}
+
+	bestCost, bestDim, bestSplit := math.Inf(1), 0, 0
+	for dim := 0; dim < 3; dim++ {
+		if maxCenter[dim]-minCenter[dim] <= 1e-12 {
+			continue
+		}
+		var bins [binnedSAHBinCount]lightBounds
+		for _, i := range order {
+			b := lightBin(bounds[i], dim, minCenter[dim], maxCenter[dim])
+			bins[b] = unionLightBounds(bins[b], bounds[i])
+		}
+		for split := 0; split < binnedSAHBinCount-1; split++ {
+			var left, right lightBounds
+			for b := 0; b <= split; b++ {
+				left = unionLightBounds(left, bins[b])
+			}
+			for b := split + 1; b < binnedSAHBinCount; b++ {
+				right = unionLightBounds(right, bins[b])
+			}
+			if left.Power <= 0 || right.Power <= 0 {
+				continue
+			}
+			cost := total.splitWeight(dim) * (left.orientedCost() + right.orientedCost())
+			if cost < bestCost {
+				bestCost, bestDim, bestSplit = cost, dim, split
+			}
+		}
+	}
+
+	if math.IsInf(bestCost, 1) {
+		dim := 0
+		for i := 1; i < 3; i++ {
+			if maxCenter[i]-minCenter[i] > maxCenter[dim]-minCenter[dim] {
+				dim = i
+			}
+		}
+		sort.Slice(order, func(a, b int) bool {
+			return bounds[order[a]].center()[dim] < bounds[order[b]].center()[dim]
+		})
+		return len(order) / 2
+	}
+	left, right := 0, len(order)-1
+	for left <= right {
+		if lightBin(bounds[order[left]], bestDim, minCenter[bestDim], maxCenter[bestDim]) <= bestSplit {
+			left++
+			continue
+		}
+		order[left], order[right] = order[right], order[left]
+		right--
+	}
+	return left
+}
+
+func lightBin(b lightBounds, dim int, minCenter, maxCenter float64) int {
+	bin := int((b.center()[dim] - minCenter) / (maxCenter - minCenter) * binnedSAHBinCount)
+	return min(max(bin, 0), binnedSAHBinCount-1)
+}
+
+// importance estimates the contribution of a node's lights at point. It is
+// conservative: a light that can illuminate point never gets zero importance.
+func (t *LightTree) importance(node int, point [3]float64, spatial bool) float64 {
+	b := &t.nodes[node].Bounds
+	if !spatial {
+		return b.Power
+	}
+	center := b.center()
+	toPoint := sub3(point, center)
+	distance2 := dot3(toPoint, toPoint)
+	radius2 := dot3(sub3(b.Max, center), sub3(b.Max, center))
+	// Inside the bounding sphere every direction may reach point.
+	cosBounds := -1.0
+	if distance2 > radius2 {
+		cosBounds = math.Sqrt(math.Max(0, 1-radius2/distance2))
+	}
+	cosPoint := 1.0
+	if distance2 > radius2 {
+		cosAxis := dot3(b.Axis, toPoint) / math.Sqrt(distance2)
+		if b.TwoSided {
+			cosAxis = math.Abs(cosAxis)
+		}
+		// The smallest angle between an emitted direction in the bounds and
+		// the direction to point: theta_axis - theta_normal - theta_bounds.
+		sinAxis := safeSqrt(1 - cosAxis*cosAxis)
+		sinNormal := safeSqrt(1 - b.CosNormal*b.CosNormal)
+		cosRest, sinRest := subtractClamped(cosAxis, sinAxis, b.CosNormal, sinNormal)
+		cosPoint, _ = subtractClamped(cosRest, sinRest, cosBounds, safeSqrt(1-cosBounds*cosBounds))
+		if cosPoint <= b.CosEmission {
+			return 0
+		}
+	}
+	diagonal := sub3(b.Max, b.Min)
+	distance2 = math.Max(distance2, math.Sqrt(dot3(diagonal, diagonal))/2)
+	return b.Power * cosPoint / distance2
+}
+
+// subtractClamped returns the cosine and sine of max(0, a-b) for the angles
+// a and b given by their cosines and sines.
+func subtractClamped(cosA, sinA, cosB, sinB float64) (float64, float64) {
+	if cosA > cosB {
+		return 1, 0
+	}
+	return cosA*cosB + sinA*sinB, sinA*cosB - cosA*sinB
+}
+
+// boundLight returns the bounds of one light.
+func boundLight(light Light) (lightBounds, bool) {
+	if light.Object == nil || light.Object.Shape == nil || light.Sampler == nil ||
+		light.Power <= 0 || math.IsNaN(light.Power) || math.IsInf(light.Power, 0) {
+		return lightBounds{}, false
+	}
+	pmin, pmax := light.Object.Shape.BuildBoundingBox()
+	if pmin == nil || pmax == nil || pmin.Len() != 3 || pmax.Len() != 3 {
+		return lightBounds{}, false
+	}
+	b := lightBounds{
+		Min:       [3]float64{pmin.AtVec(0), pmin.AtVec(1), pmin.AtVec(2)},
+		Max:       [3]float64{pmax.AtVec(0), pmax.AtVec(1), pmax.AtVec(2)},
+		Power:     light.Power,
+		Axis:      [3]float64{0, 0, 1},
+		CosNormal: -1,
+		TwoSided:  true,
+	}
+	if normal, ok := planarNormal(light.Object.Shape); ok {
+		b.Axis, b.CosNormal = normal, 1
+		switch sidedness(light.Object) {
+		case emission.FrontSide:
+			b.TwoSided = false
+		case emission.BackSide:
+			b.Axis, b.TwoSided = scale3(normal, -1), false
+		}
+	}
+	return b, true
+}
+
+// planarNormal returns the unit normal of shapes that are flat everywhere.
+func planarNormal(s shape.Shape) ([3]float64, bool) {
+	var normal *mat.VecDense
+	switch s := s.(type) {
+	case *shape.Triangle:
+		normal = s.Mem.Normal
+	case *shape.Circle:
+		normal = s.Normal
+	case *shape.BoundedShape:
+		return planarNormal(s.Shape)
+	}
+	if normal == nil || normal.Len() != 3 {
+		return [3]float64{}, false
+	}
+	n := [3]float64{normal.AtVec(0), normal.AtVec(1), normal.AtVec(2)}
+	length := math.Sqrt(dot3(n, n))
+	if length <= 0 || math.IsNaN(length) || math.IsInf(length, 0) {
+		return [3]float64{}, false
+	}
+	return scale3(n, 1/length), true
+}
+
+// sidedness reports which side of its surface obj emits from. Emitters
+// without an angular distribution are treated as two-sided.
+func sidedness(obj *Object) emission.Sidedness {
+	if e, ok := obj.Material.Emission.(emission.SurfaceEmitter); ok {
+		if d, ok := e.Distribution.(emission.CosinePower); ok {
+			return d.Sidedness
+		}
+	}
+	return emission.TwoSided
+}
+
+func unionLightBounds(a, b lightBounds) lightBounds {
+	if a.Power <= 0 {
+		return b
+	}
+	if b.Power <= 0 {
+		return a
+	}
+	u := lightBounds{
+		Power:       a.Power + b.Power,
+		CosEmission: math.Min(a.CosEmission, b.CosEmission),
+		TwoSided:    a.TwoSided || b.TwoSided,
+	}
+	for i := range u.Min {
+		u.Min[i] = math.Min(a.Min[i], b.Min[i])
+		u.Max[i] = math.Max(a.Max[i], b.Max[i])
+	}
+	u.Axis, u.CosNormal = unionCones(a.Axis, a.CosNormal, b.Axis, b.CosNormal)
+	return u
+}
+
+// unionCones returns the smallest cone around two direction cones.
+func unionCones(axisA [3]float64, cosA float64, axisB [3]float64, cosB float64) ([3]float64, float64) {
+	thetaA, thetaB := math.Acos(clampCos(cosA)), math.Acos(clampCos(cosB))
+	thetaD := math.Acos(clampCos(dot3(axisA, axisB)))
+	if math.Min(thetaD+thetaB, math.Pi) <= thetaA {
+		return axisA, cosA
+	}
+	if math.Min(thetaD+thetaA, math.Pi) <= thetaB {
+		return axisB, cosB
+	}
+	thetaO := (thetaA + thetaD + thetaB) / 2
+	if thetaO >= math.Pi {
+		return axisA, -1
+	}
+	// Rotate axisA towards axisB about their common normal.
+	normal := cross3(axisA, axisB)
+	length := math.Sqrt(dot3(normal, normal))
+	if length == 0 {
+		return axisA, -1
+	}
+	toward := cross3(scale3(normal, 1/length), axisA)
+	rotation := thetaO - thetaA
+	axis := add3(scale3(axisA, math.Cos(rotation)), scale3(toward, math.Sin(rotation)))
+	return scale3(axis, 1/math.Sqrt(dot3(axis, axis))), math.Cos(thetaO)
+}
+
+// orientedCost is the surface-area-orientation measure of b used to choose
+// splits: power times box area times the solid angle of its emission.
+func (b lightBounds) orientedCost() float64 {
+	thetaO := math.Acos(clampCos(b.CosNormal))
+	thetaE := math.Acos(clampCos(b.CosEmission))
+	thetaW := math.Min(thetaO+thetaE, math.Pi)
+	sinO := safeSqrt(1 - b.CosNormal*b.CosNormal)
+	solidAngle := 2*math.Pi*(1-b.CosNormal) +
+		math.Pi/2*(2*thetaW*sinO-math.Cos(thetaO-2*thetaW)-2*thetaO*sinO+b.CosNormal)
+	d := sub3(b.Max, b.Min)
+	area := 2 * (d[0]*d[1] + d[1]*d[2] + d[2]*d[0])
+	return b.Power * solidAngle * area
+}
+
+// splitWeight penalizes splits across thin dimensions of b.
+func (b lightBounds) splitWeight(dim int) float64 {
+	d := sub3(b.Max, b.Min)
+	if d[dim] <= 0 {
+		return 1
+	}
+	return math.Max(d[0], math.Max(d[1], d[2])) / d[dim]
+}
+
+func (b lightBounds) center() [3]float64 {
+	return scale3(add3(b.Min, b.Max), 0.5)
+}
+
+func referencePoint(p *mat.VecDense) ([3]float64, bool) {
+	if p == nil || p.Len() != 3 {
+		return [3]float64{}, false
+	}
+	return [3]float64{p.AtVec(0), p.AtVec(1), p.AtVec(2)}, true
+}
+
+func add3(a, b [3]float64) [3]float64 { return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func sub3(a, b [3]float64) [3]float64 { return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func scale3(a [3]float64, s float64) [3]float64 {
+	return [3]float64{a[0] * s, a[1] * s, a[2] * s}
+}
+func dot3(a, b [3]float64) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func cross3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func safeSqrt(v float64) float64 { return math.Sqrt(math.Max(0, v)) }
+
+func clampCos(v float64) float64 { return math.Max(-1, math.Min(1, v)) }
@@ -0,0 +1,180 @@
+package object
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+func addTestLight(tree *ObjectTree, center, normal []float64, radiance float64, e emission.Emitter) *Object {
+	if e == nil {
+		e = emission.NewConstant(optics.ConstantSpectrum(radiance))
+	}
+	return tree.AddObject(&Object{
+		Shape:    shape.NewCircle(mat.NewVecDense(3, center), mat.NewVecDense(3, normal), 0.5),
+		Material: &material.Material{Emission: e},
+	})
+}
+
+func TestBuildLightTreeWeightsLightsByPower(t *testing.T) {
+	tree := &ObjectTree{}
+	for index, radiance := range []float64{1, 10} {
+		addTestLight(tree, []float64{float64(index), 0, 1}, []float64{0, 0, 1}, radiance, nil)
+	}
+	tree.AddObject(&Object{Shape: testBox(0, 0, 0, 1, 1, 1), Material: &material.Material{}})
+
+	lights := tree.BuildLightTree()
+	if lights.Len() != 2 || lights.Power <= 0 {
+		t.Fatalf("invalid light tree: count=%d power=%g", lights.Len(), lights.Power)
+	}
+	if ratio := lights.Lights[1].Power / lights.Lights[0].Power; math.Abs(ratio-10) > 1e-12 {
+		t.Fatalf("power ratio = %g, want 10", ratio)
+	}
+	if ratio := lights.PMF(nil, 1) / lights.PMF(nil, 0); math.Abs(ratio-10) > 1e-12 {
+		t.Fatalf("power-only PMF ratio = %g, want 10", ratio)
+	}
+}
+
+func TestLightTreeSamplesMatchTheirPMF(t *testing.T) {
+	tree := &ObjectTree{}
+	for i := 0; i < 40; i++ {
+		x, y := float64(i%8), float64(i/8)
+		normal := []float64{math.Sin(float64(i)), 0, math.Cos(float64(i))}
+		addTestLight(tree, []float64{x, y, 2 + 0.1*x}, normal, 1+float64(i%3), nil)
+	}
+	lights := tree.BuildLightTree()
+
+	for _, p := range []*mat.VecDense{nil, mat.NewVecDense(3, []float64{0, 0, 0}), mat.NewVecDense(3, []float64{7, 4, 2.5})} {
+		sum := 0.0
+		for index := range lights.Lights {
+			sum += lights.PMF(p, index)
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Fatalf("PMF at %v sums to %g, want 1", p, sum)
+		}
+		for i := 0; i < 200; i++ {
+			index, pmf, ok := lights.Sample(p, (float64(i)+0.5)/200)
+			if !ok {
+				t.Fatalf("sample %d at %v failed", i, p)
+			}
+			if want := lights.PMF(p, index); math.Abs(pmf-want) > 1e-12*want {
+				t.Fatalf("sample %d at %v has PMF %g, want %g", i, p, pmf, want)
+			}
+		}
+	}
+}
+
+func TestLightTreePrefersNearbyLights(t *testing.T) {
+	tree := &ObjectTree{}
+	near := addTestLight(tree, []float64{0, 0, 1}, []float64{0, 0, -1}, 1, nil)
+	addTestLight(tree, []float64{50, 0, 1}, []float64{0, 0, -1}, 1, nil)
+	lights := tree.BuildLightTree()
+
+	index, _ := lights.Index(near)
+	if pmf := lights.PMF(mat.NewVecDense(3, []float64{0, 0, 0}), index); pmf < 0.99 {
+		t.Fatalf("nearby light PMF = %g, want almost 1", pmf)
+	}
+	if pmf := lights.PMF(nil, index); pmf != 0.5 {
+		t.Fatalf("power-only PMF = %g, want 0.5", pmf)
+	}
+}
+
+func TestLightTreeSkipsOneSidedLightsFacingAway(t *testing.T) {
+	tree := &ObjectTree{}
+	front := emission.NewSurfaceEmitter(
+		emission.NewConstant(optics.ConstantSpectrum(1)), emission.NewUniform(emission.FrontSide), emission.PeakRadiance,
+	)
+	up := addTestLight(tree, []float64{0, 0, 1}, []float64{0, 0, 1}, 1, front)
+	down := addTestLight(tree, []float64{0, 0, 2}, []float64{0, 0, 1}, 1, nil)
+	lights := tree.BuildLightTree()
+
+	below := mat.NewVecDense(3, []float64{0, 0, 0})
+	upIndex, _ := lights.Index(up)
+	downIndex, _ := lights.Index(down)
+	if pmf := lights.PMF(below, upIndex); pmf != 0 {
+		t.Fatalf("light facing away has PMF %g, want 0", pmf)
+	}
+	if pmf := lights.PMF(below, downIndex); pmf != 1 {
+		t.Fatalf("two-sided light has PMF %g, want 1", pmf)
+	}
+}
+
+func TestLightTreeSelectsInfiniteLightsBesideTheTree(t *testing.T) {
+	tree := &ObjectTree{}
+	addTestLight(tree, []float64{0, 0, 1}, []float64{0, 0, -1}, 1, nil)
+	addTestLight(tree, []float64{3, 0, 1}, []float64{0, 0, -1}, 2, nil)
+	tree.InfiniteLights = []light.Infinite{
+		light.NewConstantSky(spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1))),
+	}
+	lights := tree.BuildLightTree()
+	if lights.Len() != 3 {
+		t.Fatalf("light count = %d, want 3", lights.Len())
+	}
+	if _, ok := lights.InfiniteLight(2); !ok {
+		t.Fatal("index 2 should refer to the sky")
+	}
+	if lights.SceneRadius <= 0 || math.IsInf(lights.SceneRadius, 0) {
+		t.Fatalf("scene radius = %g, want a finite bound", lights.SceneRadius)
+	}
+
+	p := mat.NewVecDense(3, []float64{1, 0, 0})
+	sum, skyHits := 0.0, 0
+	for index := 0; index < lights.Len(); index++ {
+		sum += lights.PMF(p, index)
+	}
+	for i := 0; i < 100; i++ {
+		index, pmf, ok := lights.Sample(p, (float64(i)+0.5)/100)
+		if !ok || math.Abs(pmf-lights.PMF(p, index)) > 1e-12 {
+			t.Fatalf("sample %d: index %d pmf %g ok %v", i, index, pmf, ok)
+		}
+		if index == 2 {
+			skyHits++
+		}
+	}
+	if math.Abs(sum-1) > 1e-12 || skyHits != 50 {
+		t.Fatalf("PMF sum = %g and sky chosen %d/100 times, want 1 and 50", sum, skyHits)
+	}
+	if pdf, want := lights.InfinitePDF(p), 0.5/(4*math.Pi); math.Abs(pdf-want) > 1e-15 {
+		t.Fatalf("infinite PDF = %g, want %g", pdf, want)
+	}
+}
+
+func TestLightTreeSelectsDeltaLightsAfterInfiniteLights(t *testing.T) {
+	tree := &ObjectTree{}
+	addTestLight(tree, []float64{0, 0, 1}, []float64{0, 0, -1}, 1, nil)
+	intensity := spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1))
+	tree.InfiniteLights = []light.Infinite{light.NewConstantSky(intensity)}
+	tree.DeltaLights = []light.Delta{light.NewPoint(mat.NewVecDense(3, []float64{0, 0, 2}), intensity)}
+	lights := tree.BuildLightTree()
+	if lights.Len() != 3 {
+		t.Fatalf("light count = %d, want 3", lights.Len())
+	}
+	if _, ok := lights.DeltaLight(1); ok {
+		t.Fatal("index 1 should refer to the sky, not a delta light")
+	}
+	if _, ok := lights.DeltaLight(2); !ok {
+		t.Fatal("index 2 should refer to the point light")
+	}
+
+	p := mat.NewVecDense(3, []float64{1, 0, 0})
+	hits := make([]int, lights.Len())
+	for i := 0; i < 99; i++ {
+		index, pmf, ok := lights.Sample(p, (float64(i)+0.5)/99)
+		if !ok || math.Abs(pmf-lights.PMF(p, index)) > 1e-12 {
+			t.Fatalf("sample %d: index %d pmf %g ok %v", i, index, pmf, ok)
+		}
+		hits[index]++
+	}
+	for index, count := range hits {
+		if count != 33 {
+			t.Fatalf("light %d chosen %d/99 times, want 33", index, count)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package object
+
+import "github.com/Algo2147483647/ray/engine/model/light"
+
+// DeltaLight returns the delta light behind a light index, if the index
+// refers to one.
+func (t *LightTree) DeltaLight(index int) (light.Delta, bool) {
+	if t == nil || index < len(t.Lights)+len(t.Infinite) || index >= t.Len() {
+		return nil, false
+	}
+	return t.Delta[index-len(t.Lights)-len(t.Infinite)], true
+}
+
+// Scene is the sphere bounding the finite scene.
+func (t *LightTree) Scene() light.Sphere {
+	return light.Sphere{Center: t.SceneCenter, Radius: t.SceneRadius}
+}
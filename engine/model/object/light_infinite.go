@@ -0,0 +1,89 @@
+package object
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// InfiniteLight returns the infinite light behind a light index, if the
+// index refers to one.
+func (t *LightTree) InfiniteLight(index int) (light.Infinite, bool) {
+	if t == nil || index < len(t.Lights) || index >= len(t.Lights)+len(t.Infinite) {
+		return nil, false
+	}
+	return t.Infinite[index-len(t.Lights)], true
+}
+
+// InfiniteRadiance is the radiance all infinite lights send along
+// -direction.
+func (t *LightTree) InfiniteRadiance(ctx optics.WavelengthContext, direction *mat.VecDense) optics.Spectrum {
+	if t == nil {
+		return optics.Spectrum{}
+	}
+	return light.SumRadiance(t.Infinite, ctx, direction)
+}
+
+// InfinitePDF is the solid-angle density with which Sample, followed by
+// sampling the chosen infinite light, produces direction. Estimators that
+// pair it with InfiniteRadiance treat all infinite lights as one.
+func (t *LightTree) InfinitePDF(direction *mat.VecDense) float64 {
+	if t == nil || len(t.Infinite) == 0 {
+		return 0
+	}
+	pdf := 0.0
+	for _, infinite := range t.Infinite {
+		pdf += infinite.PDF(direction)
+	}
+	return t.separatePMF() * pdf
+}
+
+// separatePMF is the probability of selecting one infinite or delta light.
+// Each of them is as likely as the area lights taken together.
+func (t *LightTree) separatePMF() float64 {
+	choices := len(t.Infinite) + len(t.Delta)
+	if choices == 0 {
+		return 0
+	}
+	if len(t.Lights) > 0 {
+		choices++
+	}
+	return 1 / float64(choices)
+}
+
+// areaShare is the probability of selecting any area light.
+func (t *LightTree) areaShare() float64 {
+	return 1 - t.separatePMF()*float64(len(t.Infinite)+len(t.Delta))
+}
+
+// boundingSphere encloses the bounding boxes of every object. It has zero
+// radius for an empty scene and infinite radius for an unbounded one.
+func (t *ObjectTree) boundingSphere() ([3]float64, float64) {
+	lower := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	upper := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, obj := range t.Objects {
+		if obj == nil || obj.Shape == nil {
+			continue
+		}
+		pmin, pmax := obj.Shape.BuildBoundingBox()
+		if pmin == nil || pmax == nil || pmin.Len() != 3 || pmax.Len() != 3 {
+			continue
+		}
+		for dim := range lower {
+			lower[dim] = math.Min(lower[dim], pmin.AtVec(dim))
+			upper[dim] = math.Max(upper[dim], pmax.AtVec(dim))
+		}
+	}
+	if lower[0] > upper[0] {
+		return [3]float64{}, 0
+	}
+	center := scale3(add3(lower, upper), 0.5)
+	extent := sub3(upper, center)
+	radius := math.Sqrt(dot3(extent, extent))
+	if math.IsNaN(radius) || math.IsInf(radius, 0) || math.IsNaN(dot3(center, center)) {
+		return [3]float64{}, math.Inf(1)
+	}
+	return center, radius
+}
@@ -7,6 +7,7 @@ import (
 )
 
 type Object struct {
+	ID             string // script id, shared by every shape of one script object; empty when unset
 	Shape          shape.Shape
 	Material       *material.Material
 	MediumBoundary medium.Boundary
@@ -1,6 +1,9 @@
 package object
 
-import "github.com/Algo2147483647/ray/engine/model/material/medium"
+import (
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+)
 
 type BVHUpdateStrategy string
 
@@ -15,6 +18,12 @@ type ObjectTree struct {
 	Objects     []*Object
 	ObjectNodes []*ObjectNode
 	Media       *medium.Registry
+
+	// InfiniteLights surround the scene and light every ray that escapes it.
+	InfiniteLights []light.Infinite
+	// DeltaLights are the point, spot, directional and beam lights, which
+	// only light sampling reaches.
+	DeltaLights []light.Delta
 }
 
 func (t *ObjectTree) AddObject(object *Object) *Object {
@@ -96,6 +96,35 @@ func TestSurfaceHitCarriesInteractionData(t *testing.T) {
 	}
 }
 
+func TestSurfaceHitCountsTraversalWork(t *testing.T) {
+	tree := &ObjectTree{}
+	tree.AddObject(&Object{Shape: testBox(0, 0, 0, 1, 1, 1)})
+	tree.AddObject(&Object{Shape: testBox(3, 0, 0, 4, 1, 1)})
+	tree.Build()
+
+	var stats TraversalStats
+	direction := mat.NewVecDense(3, []float64{1, 0, 0})
+	// The root and both leaves are tested, and the far leaf is culled once
+	// the near box is hit.
+	if _, ok := tree.CountSurfaceHitRangeInGeometry(
+		mat.NewVecDense(3, []float64{-1, 0.5, 0.5}), direction, geometry.Euclidean(), 1e-9, math.MaxFloat64, &stats,
+	); !ok {
+		t.Fatal("expected surface hit")
+	}
+	if stats != (TraversalStats{NodeVisits: 3, ShapeTests: 1}) {
+		t.Fatalf("hit stats = %+v, want 3 node visits and 1 shape test", stats)
+	}
+	// A miss stops at the root bounds.
+	if _, ok := tree.CountSurfaceHitRangeInGeometry(
+		mat.NewVecDense(3, []float64{-1, 5, 0.5}), direction, geometry.Euclidean(), 1e-9, math.MaxFloat64, &stats,
+	); ok {
+		t.Fatal("expected a miss")
+	}
+	if stats != (TraversalStats{NodeVisits: 4, ShapeTests: 1}) {
+		t.Fatalf("accumulated stats = %+v, want 4 node visits and 1 shape test", stats)
+	}
+}
+
 func TestSurfaceHitDoesNotMutateShapeOwnedNormal(t *testing.T) {
 	triangle := shape.NewTriangle(
 		mat.NewVecDense(3, []float64{0, 0, 0}),
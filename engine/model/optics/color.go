@@ -4,7 +4,35 @@ func SpectralRayToScalar(ray *Ray) float64 {
 	if ray == nil || ray.WaveLength <= 0 {
 		return 0
 	}
-	power := ray.SpectralPower
+	return spectralPowerToScalar(ray, ray.SpectralPower, ray.WaveLength)
+}
+
+// CompanionRayToScalar is SpectralRayToScalar for companion i of the ray's
+// hero bundle.
+func CompanionRayToScalar(ray *Ray, i int) float64 {
+	if ray == nil || ray.WaveLength <= 0 || i < 0 || i >= ray.CompanionCount {
+		return 0
+	}
+	companion := ray.Companions[i]
+	return spectralPowerToScalar(ray, companion.SpectralPower, companion.WaveLength)
+}
+
+// PolarizedRayToScalars is SpectralRayToScalar for the S1..S3 components of
+// the Stokes vector a polarized ray reports when it reaches unpolarized
+// light.
+func PolarizedRayToScalars(ray *Ray) [3]float64 {
+	if ray == nil || !ray.Polarized {
+		return [3]float64{}
+	}
+	intensity := SpectralRayToScalar(ray)
+	return [3]float64{
+		intensity * ray.Mueller[1][0],
+		intensity * ray.Mueller[2][0],
+		intensity * ray.Mueller[3][0],
+	}
+}
+
+func spectralPowerToScalar(ray *Ray, power, wavelength float64) float64 {
 	compatibility := ray.RGBCompatibility
 	if !ray.RGBCompatibilityPath {
 		return power
@@ -13,7 +41,7 @@ func SpectralRayToScalar(ray *Ray) float64 {
 		compatibility[0],
 		compatibility[1],
 		compatibility[2],
-	).RGBPowerAtWavelength(ray.WaveLength)
+	).RGBPowerAtWavelength(wavelength)
 }
 
 func XYZToLinearSRGB(x, y, z float64) (float64, float64, float64) {
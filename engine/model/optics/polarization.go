@@ -0,0 +1,123 @@
+package optics
+
+import "math"
+
+// Stokes is the polarization state of light: S0 is the intensity, S1 and S2
+// the linear polarization along the x axis of a reference frame and at 45°
+// to it, and S3 the circular polarization. The frame's x axis is a direction
+// perpendicular to the propagation direction p, its y axis is p × x, and
+// angles are measured from x towards y.
+type Stokes [4]float64
+
+// Mueller maps the Stokes vector of incident light to the Stokes vector of
+// the light it scatters.
+type Mueller [4][4]float64
+
+// IdentityMueller leaves polarization unchanged.
+func IdentityMueller() Mueller {
+	return Mueller{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}
+}
+
+// DepolarizerMueller keeps the intensity and discards the polarization.
+func DepolarizerMueller() Mueller {
+	return Mueller{{1, 0, 0, 0}}
+}
+
+// RotationMueller re-expresses a Stokes vector in a frame whose x axis is
+// rotated by angle, in radians, about the propagation direction.
+func RotationMueller(angle float64) Mueller {
+	sin, cos := math.Sincos(2 * angle)
+	return Mueller{{1, 0, 0, 0}, {0, cos, sin, 0}, {0, -sin, cos, 0}, {0, 0, 0, 1}}
+}
+
+// LinearPolarizerMueller is an ideal linear polarizer whose transmission
+// axis makes angle, in radians, with the frame's x axis.
+func LinearPolarizerMueller(angle float64) Mueller {
+	sin, cos := math.Sincos(2 * angle)
+	return Mueller{
+		{0.5, 0.5 * cos, 0.5 * sin, 0},
+		{0.5 * cos, 0.5 * cos * cos, 0.5 * cos * sin, 0},
+		{0.5 * sin, 0.5 * cos * sin, 0.5 * sin * sin, 0},
+		{0, 0, 0, 0},
+	}
+}
+
+// FresnelMueller is the Mueller matrix of an interface with complex
+// amplitude coefficients rs and rp for the s- and p-polarized components,
+// either both reflection or both transmission coefficients, in a frame whose
+// x axis is perpendicular to the plane of incidence.
+func FresnelMueller(rs, rp complex128) Mueller {
+	s2 := real(rs)*real(rs) + imag(rs)*imag(rs)
+	p2 := real(rp)*real(rp) + imag(rp)*imag(rp)
+	cross := rs * complex(real(rp), -imag(rp))
+	re, im := real(cross), imag(cross)
+	return Mueller{
+		{0.5 * (s2 + p2), 0.5 * (s2 - p2), 0, 0},
+		{0.5 * (s2 - p2), 0.5 * (s2 + p2), 0, 0},
+		{0, 0, re, im},
+		{0, 0, -im, re},
+	}
+}
+
+// Mul is the matrix product m·other: the effect of other followed by m.
+func (m Mueller) Mul(other Mueller) Mueller {
+	var res Mueller
+	for i := range 4 {
+		for j := range 4 {
+			for k := range 4 {
+				res[i][j] += m[i][k] * other[k][j]
+			}
+		}
+	}
+	return res
+}
+
+// Apply is the Stokes vector m·s.
+func (m Mueller) Apply(s Stokes) Stokes {
+	var res Stokes
+	for i := range 4 {
+		for j := range 4 {
+			res[i] += m[i][j] * s[j]
+		}
+	}
+	return res
+}
+
+// MulScalar scales every entry of m by v.
+func (m Mueller) MulScalar(v float64) Mueller {
+	for i := range 4 {
+		for j := range 4 {
+			m[i][j] *= v
+		}
+	}
+	return m
+}
+
+// Add is the entrywise sum of m and other.
+func (m Mueller) Add(other Mueller) Mueller {
+	for i := range 4 {
+		for j := range 4 {
+			m[i][j] += other[i][j]
+		}
+	}
+	return m
+}
+
+// Normalized divides m by its intensity transmittance for unpolarized light,
+// m[0][0], so that scattering scalars carry the intensity and m only the
+// change in polarization. A matrix that transmits nothing normalizes to the
+// depolarizer.
+func (m Mueller) Normalized() Mueller {
+	if m[0][0] <= 0 || math.IsNaN(m[0][0]) || math.IsInf(m[0][0], 0) {
+		return DepolarizerMueller()
+	}
+	return m.MulScalar(1 / m[0][0])
+}
+
+// DegreeOfPolarization is the polarized fraction of the intensity of s.
+func (s Stokes) DegreeOfPolarization() float64 {
+	if s[0] <= 0 {
+		return 0
+	}
+	return math.Min(1, math.Sqrt(s[1]*s[1]+s[2]*s[2]+s[3]*s[3])/s[0])
+}
@@ -0,0 +1,49 @@
+package optics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRotationMuellerComposesAngles(t *testing.T) {
+	got := RotationMueller(0.3).Mul(RotationMueller(0.5))
+	want := RotationMueller(0.8)
+	for i := range 4 {
+		for j := range 4 {
+			if math.Abs(got[i][j]-want[i][j]) > 1e-12 {
+				t.Fatalf("R(0.3)·R(0.5) = %v, want R(0.8) = %v", got, want)
+			}
+		}
+	}
+}
+
+func TestLinearPolarizersFollowMalusLaw(t *testing.T) {
+	unpolarized := Stokes{1, 0, 0, 0}
+	first := LinearPolarizerMueller(0).Apply(unpolarized)
+	for _, angle := range []float64{0, math.Pi / 6, math.Pi / 4, math.Pi / 2} {
+		got := LinearPolarizerMueller(angle).Apply(first)[0] / first[0]
+		if want := math.Cos(angle) * math.Cos(angle); math.Abs(got-want) > 1e-12 {
+			t.Fatalf("polarizer at %g passes %g of polarized light, want %g", angle, got, want)
+		}
+	}
+	if degree := first.DegreeOfPolarization(); math.Abs(degree-1) > 1e-12 {
+		t.Fatalf("polarizer output has degree of polarization %g, want 1", degree)
+	}
+}
+
+func TestFresnelMuellerWithoutPReflectionIsSPolarizing(t *testing.T) {
+	reflected := FresnelMueller(-0.4, 0).Apply(Stokes{1, 0, 0, 0})
+	if math.Abs(reflected[0]-0.08) > 1e-12 || math.Abs(reflected[1]-reflected[0]) > 1e-12 {
+		t.Fatalf("reflection without p component gives %v, want S1 = S0 = 0.08", reflected)
+	}
+}
+
+func TestNormalizedMuellerKeepsPolarizationOnly(t *testing.T) {
+	m := LinearPolarizerMueller(0.2).MulScalar(0.3).Normalized()
+	if m[0][0] != 1 {
+		t.Fatalf("normalized m00 = %g, want 1", m[0][0])
+	}
+	if got := (Mueller{}).Normalized(); got != DepolarizerMueller() {
+		t.Fatalf("normalizing an opaque matrix gives %v, want the depolarizer", got)
+	}
+}
@@ -10,6 +10,20 @@ import (
 	"gonum.org/v1/gonum/mat"
 )
 
+// HeroBundleSize is the number of wavelengths a hero-wavelength path carries:
+// the hero wavelength, which drives every sampling decision, and the
+// companions that follow its path.
+const HeroBundleSize = 4
+
+// Companion is a wavelength that follows the path of the hero wavelength,
+// with its own throughput and next-event radiance.
+type Companion struct {
+	WaveLength    float64
+	WavelengthPDF float64
+	SpectralPower float64
+	Radiance      float64
+}
+
 type Ray struct {
 	Origin               *mat.VecDense     `json:"origin"`
 	Direction            *mat.VecDense     `json:"direction"`
@@ -20,10 +34,29 @@ type Ray struct {
 	RGBCompatibilityPath bool              `json:"rgb_compatibility_path"`
 	WaveLength           float64           `json:"wave_length"` // (nm)
 	WavelengthPDF        float64           `json:"wavelength_pdf"`
+	Radiance             float64           `json:"radiance"` // spectral radiance already gathered by next-event estimation
 	RefractionIndex      float64           `json:"refraction_index"`
 	MediumStack          medium.Stack      `json:"-"`
 	Geometry             geometry.Geometry `json:"-"` // nil ⇒ Euclidean (back-compat default)
 	ArcTraveled          float64           `json:"-"` // geodesic arc length traveled so far (S^3 wrap)
+	// Companions[:CompanionCount] are the other wavelengths of a hero bundle.
+	// They follow the hero until BundleSplit, when a dispersive event leaves
+	// the hero to carry the path alone.
+	Companions     [HeroBundleSize - 1]Companion `json:"-"`
+	CompanionCount int                           `json:"-"`
+	BundleSplit    bool                          `json:"-"`
+	// A Polarized ray carries Mueller, which maps the Stokes vector of the
+	// light arriving along the current segment, in the frame whose x axis
+	// is StokesFrame, to the Stokes vector at the camera. SpectralPower
+	// holds its intensity row, so Mueller[0][0] stays 1.
+	Polarized      bool       `json:"-"`
+	Mueller        Mueller    `json:"-"`
+	StokesFrame    [3]float64 `json:"-"`
+	StokesRadiance [3]float64 `json:"-"` // S1..S3 of the radiance already gathered by next-event estimation
+	// WavelengthShifts lets fluorescent surfaces move WaveLength to the
+	// wavelength that excites them. WavelengthPDF stays the density of the
+	// wavelength the path started with.
+	WavelengthShifts bool `json:"-"`
 }
 
 func (r *Ray) Init() {
@@ -49,6 +82,13 @@ func (r *Ray) Init() {
 	r.MediumStack.Reset(0)
 	r.WaveLength = 0
 	r.WavelengthPDF = 0
+	r.Radiance = 0
+	r.CompanionCount = 0
+	r.BundleSplit = false
+	r.Polarized = false
+	r.Mueller = IdentityMueller()
+	r.StokesRadiance = [3]float64{}
+	r.WavelengthShifts = false
 
 	r.ArcTraveled = 0
 	// Geometry is intentionally NOT reset: it is set per-render by the
@@ -78,21 +118,85 @@ func (r *Ray) SetSpectralWavelength(wavelength float64) {
 }
 
 func (r *Ray) SetSpectralSample(sample WavelengthSample) {
-	wavelength := sample.LambdaNM
-	wavelength = math.Max(WavelengthMin+1e-6, math.Min(WavelengthMax-1e-6, wavelength))
+	sample = clampWavelengthSample(sample)
 	if r.SpectralPower == 0 {
 		r.SpectralPower = 1
 	}
-	r.WaveLength = wavelength
+	r.WaveLength = sample.LambdaNM
 	r.WavelengthPDF = sample.PDF
-	if r.WavelengthPDF <= 0 || math.IsNaN(r.WavelengthPDF) || math.IsInf(r.WavelengthPDF, 0) {
-		r.WavelengthPDF = UniformWavelengthPDF()
+	r.CompanionCount = 0
+	r.BundleSplit = false
+}
+
+// SetHeroBundle makes bundle[0] the hero wavelength and the rest, up to
+// HeroBundleSize in all, its companions.
+func (r *Ray) SetHeroBundle(bundle []WavelengthSample) {
+	if len(bundle) == 0 {
+		return
+	}
+	r.SetSpectralSample(bundle[0])
+	for _, sample := range bundle[1:min(len(bundle), HeroBundleSize)] {
+		sample = clampWavelengthSample(sample)
+		r.Companions[r.CompanionCount] = Companion{
+			WaveLength:    sample.LambdaNM,
+			WavelengthPDF: sample.PDF,
+			SpectralPower: r.SpectralPower,
+		}
+		r.CompanionCount++
+	}
+}
+
+// clampWavelengthSample keeps the wavelength inside the visible range and
+// falls back to the uniform density for an invalid PDF.
+func clampWavelengthSample(sample WavelengthSample) WavelengthSample {
+	sample.LambdaNM = math.Max(WavelengthMin+1e-6, math.Min(WavelengthMax-1e-6, sample.LambdaNM))
+	if sample.PDF <= 0 || math.IsNaN(sample.PDF) || math.IsInf(sample.PDF, 0) {
+		sample.PDF = UniformWavelengthPDF()
+	}
+	return sample
+}
+
+// FollowingCompanions returns the companions that still follow the hero. They
+// alias the ray, so updating them updates it.
+func (r *Ray) FollowingCompanions() []Companion {
+	if r.BundleSplit {
+		return nil
+	}
+	return r.Companions[:r.CompanionCount]
+}
+
+// BundleWavelengthsNM lists the hero wavelength and its following companions.
+func (r *Ray) BundleWavelengthsNM() []float64 {
+	companions := r.FollowingCompanions()
+	wavelengths := make([]float64, 0, len(companions)+1)
+	wavelengths = append(wavelengths, r.WaveLength)
+	for _, companion := range companions {
+		wavelengths = append(wavelengths, companion.WaveLength)
+	}
+	return wavelengths
+}
+
+// SplitBundle leaves the hero to carry the path alone. From here on the path
+// could only have been sampled by its hero wavelength, so by the balance
+// heuristic over the bundle the hero takes the weight of every member. The
+// radiance the companions have already gathered is kept.
+func (r *Ray) SplitBundle() {
+	companions := r.FollowingCompanions()
+	if len(companions) == 0 {
+		return
+	}
+	r.SpectralPower *= float64(len(companions) + 1)
+	for i := range companions {
+		companions[i].SpectralPower = 0
 	}
+	r.BundleSplit = true
 }
 
 func (r *Ray) DisableSpectralSampling() {
 	r.WaveLength = 0
 	r.WavelengthPDF = 0
+	r.CompanionCount = 0
+	r.BundleSplit = false
 	r.SpectralPower = 1
 	r.SpectralPath = false
 	r.RGBCompatibilityPath = false
@@ -0,0 +1,130 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+
+	rendercamera "github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+// defaultAdaptiveMinSamples is the camera-sample count every pixel takes
+// before its error estimate is trusted, unless adaptive_min_samples is set.
+const defaultAdaptiveMinSamples = 16
+
+// adaptiveSampling bounds the camera samples of a pixel. A pixel stops once
+// the standard error of its mean falls below relativeError times the mean,
+// tested after every minSamples samples, or when it reaches maxSamples.
+type adaptiveSampling struct {
+	relativeError float64
+	minSamples    int64
+	maxSamples    int64
+}
+
+// resolveAdaptiveSampling returns the adaptive bounds for a render of samples
+// camera samples per pixel, or false when adaptive sampling is disabled.
+func (h *Handler) resolveAdaptiveSampling(samples int64) (adaptiveSampling, bool, error) {
+	if h.AdaptiveRelativeError < 0 || math.IsNaN(h.AdaptiveRelativeError) || math.IsInf(h.AdaptiveRelativeError, 0) {
+		return adaptiveSampling{}, false, fmt.Errorf("adaptive relative error must be finite and non-negative")
+	}
+	if h.AdaptiveMinSamples < 0 || h.AdaptiveMaxSamples < 0 {
+		return adaptiveSampling{}, false, fmt.Errorf("adaptive sample bounds must be non-negative")
+	}
+	if h.AdaptiveRelativeError == 0 {
+		return adaptiveSampling{}, false, nil
+	}
+	bounds := adaptiveSampling{
+		relativeError: h.AdaptiveRelativeError,
+		minSamples:    h.AdaptiveMinSamples,
+		maxSamples:    h.AdaptiveMaxSamples,
+	}
+	if bounds.maxSamples == 0 {
+		bounds.maxSamples = samples
+	}
+	if bounds.minSamples == 0 {
+		bounds.minSamples = min(defaultAdaptiveMinSamples, bounds.maxSamples)
+	}
+	if bounds.minSamples > bounds.maxSamples {
+		return adaptiveSampling{}, false, fmt.Errorf(
+			"adaptive min samples %d exceed max samples %d", bounds.minSamples, bounds.maxSamples,
+		)
+	}
+	return bounds, true, nil
+}
+
+// runningVariance is Welford's online mean and variance.
+type runningVariance struct {
+	count int64
+	mean  float64
+	m2    float64
+}
+
+func (v *runningVariance) add(value float64) {
+	v.count++
+	delta := value - v.mean
+	v.mean += delta / float64(v.count)
+	v.m2 += delta * (value - v.mean)
+}
+
+// converged reports whether the standard error of the mean is within
+// relativeError of the mean. A pixel whose samples are all zero converges.
+func (v *runningVariance) converged(relativeError float64) bool {
+	if v.count < 2 {
+		return false
+	}
+	variance := v.m2 / float64(v.count-1)
+	return math.Sqrt(variance/float64(v.count)) <= relativeError*math.Abs(v.mean)
+}
+
+// traceAdaptivePixel traces camera samples of pixel until it converges and
+// records the number of spectral samples averaged into it, counting a hero
+// bundle once. The error is
+// measured on the sum of a camera sample's spectral values, so every
+// wavelength stratum of a sampled-mode sample counts toward one estimate.
+func (h *Handler) traceAdaptivePixel(
+	kernel pixelKernel,
+	context *RenderContext,
+	pixel int,
+	index ...int,
+) {
+	bounds := *context.adaptive
+	film := context.Camera.GetFilm()
+	pixelSampler := h.newSampler(samplerDomainCamera, filmWidth(film), h.EffectiveSampleCount(bounds.maxSamples))
+	ray := h.RayPool.Get().(*optics.Ray)
+	ray.Geometry = h.SceneGeometry
+	defer h.RayPool.Put(ray)
+
+	aovs := context.aovs.pixel(pixel)
+	spectralSamples := make([]rendercamera.SpectralSample, 0, h.estimatedSpectralSampleCount(bounds.minSamples))
+	var estimate runningVariance
+	cameraSamples := int64(0)
+	for s := int64(0); s < bounds.maxSamples; s++ {
+		cameraSamples++
+		first := len(spectralSamples)
+		spectralSamples = h.traceCameraSample(
+			kernel, pixelSampler, pixel, context.Camera, context.ObjectTree, ray, s, aovs, spectralSamples, index...,
+		)
+		value := 0.0
+		for _, sample := range spectralSamples[first:] {
+			value += sample.Value * sample.Weight
+		}
+		estimate.add(value)
+		if (s+1)%bounds.minSamples == 0 && estimate.converged(bounds.relativeError) {
+			break
+		}
+	}
+
+	weightSum := normalizeSpectralSamples(spectralSamples)
+	for _, sample := range spectralSamples {
+		context.Accumulator.AddSpectral(pixel, sample.WavelengthNM, sample.Value)
+	}
+	film.PixelSamples[pixel] = int64(len(spectralSamples))
+	if h.SpectrumMode == optics.SpectrumModeHeroWavelength {
+		// A hero bundle is one sample, however many wavelengths it carries.
+		film.PixelSamples[pixel] = cameraSamples
+	}
+	if film.FilterWeights != nil {
+		film.FilterWeights[pixel] = weightSum
+	}
+	aovs.finish(cameraSamples, spectralSamples)
+}
@@ -0,0 +1,132 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestResolveAdaptiveSamplingDefaults(t *testing.T) {
+	h := NewHandler()
+	if _, adaptive, err := h.resolveAdaptiveSampling(64); err != nil || adaptive {
+		t.Fatalf("zero relative error: adaptive %v, err %v", adaptive, err)
+	}
+	h.AdaptiveRelativeError = 0.05
+	bounds, adaptive, err := h.resolveAdaptiveSampling(64)
+	if err != nil || !adaptive || bounds.minSamples != defaultAdaptiveMinSamples || bounds.maxSamples != 64 {
+		t.Fatalf("defaults = %+v, %v, %v", bounds, adaptive, err)
+	}
+	if bounds, _, _ := h.resolveAdaptiveSampling(4); bounds.minSamples != 4 {
+		t.Fatalf("min samples %d exceed a max of 4", bounds.minSamples)
+	}
+	h.AdaptiveMinSamples, h.AdaptiveMaxSamples = 32, 8
+	if _, _, err := h.resolveAdaptiveSampling(64); err == nil {
+		t.Fatal("expected min samples above max samples to fail")
+	}
+	h.AdaptiveMinSamples, h.AdaptiveMaxSamples = 0, 0
+	h.AdaptiveRelativeError = -1
+	if _, _, err := h.resolveAdaptiveSampling(64); err == nil {
+		t.Fatal("expected a negative relative error to fail")
+	}
+}
+
+// newAdaptiveTestScene puts a small diffuse disk lit by the SPPM test light in
+// the middle of an otherwise empty view, so edge pixels see only black.
+func newAdaptiveTestScene() *object.ObjectTree {
+	tree := (&object.ObjectTree{}).Build()
+	tree.AddObject(&object.Object{
+		Shape: shape.NewCircle(
+			mat.NewVecDense(3, []float64{0, 0, 3}),
+			mat.NewVecDense(3, []float64{0, 0, -1}),
+			0.5,
+		),
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.6)))},
+	})
+	addTestAreaLight(tree, []float64{0.3, 0, -0.5})
+	tree.Build()
+	return tree
+}
+
+func TestAdaptiveSamplingSpendsSamplesWhereNoiseIs(t *testing.T) {
+	tree := newAdaptiveTestScene()
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.AdaptiveRelativeError = 0.1
+	h.AdaptiveMinSamples = 8
+	adaptive := newBDPTTestCamera(t, 4, 4)
+	if err := h.TraceScene(adaptive, tree, 512); err != nil {
+		t.Fatal(err)
+	}
+	film := adaptive.Film
+	if film.Samples != 512 || len(film.PixelSamples) != film.ElementCount() {
+		t.Fatalf("Film samples %d with %d pixel counts", film.Samples, len(film.PixelSamples))
+	}
+
+	h.AdaptiveRelativeError = 0
+	reference := newBDPTTestCamera(t, 4, 4)
+	if err := h.TraceScene(reference, tree, 512); err != nil {
+		t.Fatal(err)
+	}
+	if reference.Film.PixelSamples != nil {
+		t.Fatal("a fixed-count render recorded per-pixel counts")
+	}
+
+	lit := 0
+	for pixel, count := range film.PixelSamples {
+		if count%8 != 0 || count < 8 || count > 512 {
+			t.Fatalf("pixel %d took %d samples, want a multiple of 8 in [8, 512]", pixel, count)
+		}
+		got, want := 0.0, 0.0
+		for bin := range film.SpectralBins {
+			got += film.SpectralBins[bin].Data[pixel]
+			want += reference.Film.SpectralBins[bin].Data[pixel]
+		}
+		if want == 0 {
+			// Black pixels have no variance and stop at the minimum.
+			if count != 8 || got != 0 {
+				t.Fatalf("black pixel %d took %d samples and reads %g", pixel, count, got)
+			}
+			continue
+		}
+		lit++
+		if count == 8 {
+			t.Fatalf("noisy pixel %d stopped at the minimum", pixel)
+		}
+		if relative := math.Abs(got-want) / want; relative > 0.3 {
+			t.Fatalf("pixel %d reads %g after %d samples, reference %g", pixel, got, count, want)
+		}
+	}
+	if lit == 0 {
+		t.Fatal("the disk covers no pixel")
+	}
+}
+
+func TestAdaptiveSamplingCountsWavelengthSamples(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeSampledWavelengths
+	h.WavelengthSamples = 3
+	h.AdaptiveRelativeError = 0.1
+	h.AdaptiveMinSamples = 4
+	h.AdaptiveMaxSamples = 16
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	if err := h.TraceScene(renderCamera, newAdaptiveTestScene(), 64); err != nil {
+		t.Fatal(err)
+	}
+	if renderCamera.Film.Samples != 48 {
+		t.Fatalf("Film samples = %d, want 16 camera samples of 3 wavelengths", renderCamera.Film.Samples)
+	}
+	for pixel, count := range renderCamera.Film.PixelSamples {
+		if count%12 != 0 || count < 12 || count > 48 {
+			t.Fatalf("pixel %d recorded %d samples, want a multiple of 12 in [12, 48]", pixel, count)
+		}
+	}
+}
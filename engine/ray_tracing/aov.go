@@ -0,0 +1,388 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/utils"
+	"gonum.org/v1/gonum/mat"
+)
+
+// aovRecorder writes the arbitrary output variables of a pixel render from
+// the radiance paths themselves, which draw no extra numbers for them, so
+// recording AOVs leaves the radiance bit-identical. A nil channel is not
+// recorded.
+type aovRecorder struct {
+	film            *camera.Film
+	depth           *camera.AOV
+	geometricNormal *camera.AOV
+	shadingNormal   *camera.AOV
+	uv              *camera.AOV
+	albedo          *camera.AOV
+	objectID        *camera.AOV
+	materialID      *camera.AOV
+	sampleCount     *camera.AOV
+	variance        *camera.AOV
+	stokes          *camera.AOV
+	objectIDs       map[*object.Object]int
+	materialIDs     map[*material.Material]int
+}
+
+// validateAOVs rejects unknown and repeated channel names.
+func (h *Handler) validateAOVs() error {
+	seen := make(map[camera.AOVKind]bool, len(h.AOVs))
+	for _, kind := range h.AOVs {
+		if _, err := camera.ParseAOVKind(string(kind)); err != nil {
+			return err
+		}
+		if seen[kind] {
+			return fmt.Errorf("duplicate AOV %q", kind)
+		}
+		seen[kind] = true
+	}
+	return nil
+}
+
+// newAOVRecorder allocates the configured channels on the Film and numbers
+// the script ids of the scene, or returns nil when no AOV is configured.
+func (h *Handler) newAOVRecorder(context *RenderContext) *aovRecorder {
+	if len(h.AOVs) == 0 {
+		return nil
+	}
+	film := context.Camera.GetFilm()
+	for _, kind := range h.AOVs {
+		film.AddAOV(kind, camera.AOVComponents(kind, utils.Dimension, len(film.SpectralBins)))
+	}
+	r := &aovRecorder{
+		film:            film,
+		depth:           film.AOV(camera.AOVDepth),
+		geometricNormal: film.AOV(camera.AOVGeometricNormal),
+		shadingNormal:   film.AOV(camera.AOVShadingNormal),
+		uv:              film.AOV(camera.AOVUV),
+		albedo:          film.AOV(camera.AOVAlbedo),
+		objectID:        film.AOV(camera.AOVObjectID),
+		materialID:      film.AOV(camera.AOVMaterialID),
+		sampleCount:     film.AOV(camera.AOVSampleCount),
+		variance:        film.AOV(camera.AOVVariance),
+		stokes:          film.AOV(camera.AOVStokes),
+	}
+	var objects []*object.Object
+	if context.ObjectTree != nil {
+		objects = context.ObjectTree.Objects
+	}
+	if r.objectID != nil {
+		r.objectIDs, film.ObjectIDs = scriptIDTable(objects, func(obj *object.Object) (*object.Object, string) {
+			return obj, obj.ID
+		})
+	}
+	if r.materialID != nil {
+		r.materialIDs, film.MaterialIDs = scriptIDTable(objects, func(obj *object.Object) (*material.Material, string) {
+			if obj.Material == nil {
+				return nil, ""
+			}
+			return obj.Material, obj.Material.Metadata.Name
+		})
+	}
+	// The background and objects without an id keep -1 in pixels outside
+	// the pixel windows too.
+	for _, aov := range []*camera.AOV{r.objectID, r.materialID} {
+		if aov != nil {
+			for i := range aov.Data {
+				aov.Data[i] = -1
+			}
+		}
+	}
+	return r
+}
+
+// scriptIDTable numbers the distinct non-empty ids of objects in scene order
+// and maps the key of every object to the number of its id, or to -1.
+func scriptIDTable[K comparable](objects []*object.Object, key func(*object.Object) (K, string)) (map[K]int, []string) {
+	indices := make(map[K]int)
+	numbers := make(map[string]int)
+	var ids []string
+	for _, obj := range objects {
+		k, id := key(obj)
+		if _, seen := indices[k]; seen {
+			continue
+		}
+		if id == "" {
+			indices[k] = -1
+			continue
+		}
+		number, ok := numbers[id]
+		if !ok {
+			number = len(ids)
+			numbers[id] = number
+			ids = append(ids, id)
+		}
+		indices[k] = number
+	}
+	return indices, ids
+}
+
+// idTally counts the radiance paths of a pixel that hit each ID.
+type idTally struct {
+	ids    []int
+	counts []int64
+}
+
+func (t *idTally) add(id int) {
+	for i, seen := range t.ids {
+		if seen == id {
+			t.counts[i]++
+			return
+		}
+	}
+	t.ids = append(t.ids, id)
+	t.counts = append(t.counts, 1)
+}
+
+// majority is the ID hit most often; ties go to the ID hit first.
+func (t *idTally) majority() int {
+	best := -1
+	for i := range t.ids {
+		if best < 0 || t.counts[i] > t.counts[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return -1
+	}
+	return t.ids[best]
+}
+
+// aovPixel accumulates the AOVs of one pixel from the radiance paths that
+// render it: the first segment of a path records the surface its camera ray
+// hits, and the first non-specular BSDF sample along it the albedo. A nil
+// aovPixel records nothing, so kernels report to it unconditionally.
+type aovPixel struct {
+	r                  *aovRecorder
+	pixel              int
+	paths              int64
+	objects, materials idTally
+	// hitDone and albedoDone mark what the current path has recorded.
+	hitDone, albedoDone bool
+}
+
+// pixel starts the AOV record of pixel, or returns nil when r is nil.
+func (r *aovRecorder) pixel(pixel int) *aovPixel {
+	if r == nil {
+		return nil
+	}
+	return &aovPixel{r: r, pixel: pixel}
+}
+
+// startPath begins the record of the pixel's next radiance path.
+func (a *aovPixel) startPath() {
+	if a == nil {
+		return
+	}
+	a.paths++
+	a.hitDone, a.albedoDone = false, false
+}
+
+// surfaceHit records hit, the first surface the path's camera ray meets, or a
+// miss when ok is false. Later segments of the path are ignored.
+func (a *aovPixel) surfaceHit(g geometry.Geometry, ray *optics.Ray, hit *object.SurfaceHit, ok bool) {
+	if a == nil || a.hitDone {
+		return
+	}
+	a.hitDone = true
+	r, pixel := a.r, a.pixel
+	if !ok {
+		a.objects.add(-1)
+		a.materials.add(-1)
+		return
+	}
+	if r.depth != nil {
+		r.depth.Data[pixel] += hitArcLength(g, ray, hit)
+	}
+	addAOVVector(r.geometricNormal, pixel, hit.GeometricNormal)
+	addAOVVector(r.shadingNormal, pixel, hit.ShadingNormal)
+	if r.uv != nil {
+		uv := r.uv.Pixel(pixel)
+		uv[0] += hit.UV[0]
+		uv[1] += hit.UV[1]
+	}
+	a.objects.add(aovIDIndex(r.objectIDs, hit.Object))
+	if hit.Object != nil {
+		a.materials.add(aovIDIndex(r.materialIDs, hit.Object.Material))
+	} else {
+		a.materials.add(-1)
+	}
+}
+
+// recordsAlbedo reports whether the current path still owes the albedo.
+func (a *aovPixel) recordsAlbedo() bool {
+	return a != nil && a.r.albedo != nil && !a.albedoDone
+}
+
+// scattered records the albedo at the path's first vertex whose BSDF sample
+// is not specular, or at the vertex where the path reaches its last bounce.
+func (a *aovPixel) scattered(ray *optics.Ray, sample bxdf.BxDFSample, last bool) {
+	if !a.recordsAlbedo() || (sample.Flags&(bxdf.DeltaReflection|bxdf.DeltaTransmission) != 0 && !last) {
+		return
+	}
+	a.addAlbedo(ray, sampledAlbedo(ray, sample))
+}
+
+// scatteredInMedium records zero albedo for a path that scatters in a medium
+// before it reaches a non-specular surface.
+func (a *aovPixel) scatteredInMedium() {
+	if a != nil {
+		a.albedoDone = true
+	}
+}
+
+// addAlbedo stores albedo in the bin of the ray's wavelength, normalized like
+// radiance.
+func (a *aovPixel) addAlbedo(ray *optics.Ray, albedo float64) {
+	a.albedoDone = true
+	if bin := a.r.film.SpectralBinIndex(ray.WaveLength); bin >= 0 && !math.IsNaN(albedo) && !math.IsInf(albedo, 0) {
+		a.r.albedo.Pixel(a.pixel)[bin] += optics.SpectralSampleRadiance(albedo, ray.WavelengthPDF)
+	}
+}
+
+// finish turns the sums of the pixel's paths into the channel means and
+// majority IDs. The variance and Stokes vectors come from spectralSamples,
+// the pixel's normalized radiance samples of samples camera samples.
+func (a *aovPixel) finish(samples int64, spectralSamples []camera.SpectralSample) {
+	if a == nil || samples <= 0 {
+		return
+	}
+	r, pixel := a.r, a.pixel
+	if r.variance != nil {
+		r.variance.Data[pixel] = pixelVariance(spectralSamples, samples)
+	}
+	if r.stokes != nil {
+		recordPixelStokes(r.film, r.stokes.Pixel(pixel), spectralSamples)
+	}
+	if a.paths > 0 {
+		scale := 1 / float64(a.paths)
+		for _, aov := range []*camera.AOV{r.depth, r.geometricNormal, r.shadingNormal, r.uv, r.albedo} {
+			if aov != nil {
+				values := aov.Pixel(pixel)
+				for i := range values {
+					values[i] *= scale
+				}
+			}
+		}
+	}
+	if r.objectID != nil {
+		r.objectID.Data[pixel] = float64(a.objects.majority())
+	}
+	if r.materialID != nil {
+		r.materialID.Data[pixel] = float64(a.materials.majority())
+	}
+	if r.sampleCount != nil {
+		r.sampleCount.Data[pixel] = float64(samples)
+	}
+}
+
+// pixelVariance estimates the variance of a pixel value, summed over its
+// spectral bins, from its normalized spectral samples, which split evenly
+// into cameraSamples camera samples. The pixel value is the sum of the
+// camera samples' shares, so its variance is cameraSamples times theirs.
+func pixelVariance(spectralSamples []camera.SpectralSample, cameraSamples int64) float64 {
+	if cameraSamples < 2 || int64(len(spectralSamples))%cameraSamples != 0 {
+		return 0
+	}
+	perCameraSample := len(spectralSamples) / int(cameraSamples)
+	if perCameraSample == 0 {
+		return 0
+	}
+	var shares runningVariance
+	for first := 0; first < len(spectralSamples); first += perCameraSample {
+		share := 0.0
+		for _, sample := range spectralSamples[first : first+perCameraSample] {
+			share += sample.Value
+		}
+		shares.add(share)
+	}
+	return float64(cameraSamples) * shares.m2 / float64(shares.count-1)
+}
+
+// recordPixelStokes sums normalized spectral samples into the Stokes vectors
+// of their bins, the way the Film sums their values.
+func recordPixelStokes(film *camera.Film, stokes []float64, spectralSamples []camera.SpectralSample) {
+	for _, sample := range spectralSamples {
+		bin := film.SpectralBinIndex(sample.WavelengthNM)
+		if bin < 0 || math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		stokes[4*bin] += sample.Value
+		for k, value := range sample.Polarization {
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				stokes[4*bin+1+k] += value
+			}
+		}
+	}
+}
+
+func addAOVVector(aov *camera.AOV, pixel int, v *mat.VecDense) {
+	if aov == nil || v == nil {
+		return
+	}
+	values := aov.Pixel(pixel)
+	for i := range min(len(values), v.Len()) {
+		values[i] += v.AtVec(i)
+	}
+}
+
+func aovIDIndex[K comparable](indices map[K]int, key K) int {
+	if index, ok := indices[key]; ok {
+		return index
+	}
+	return -1
+}
+
+// sampledAlbedo is the one-sample estimate f·|cos|/pdf of a BSDF's
+// directional albedo at the ray's wavelength from sample.
+func sampledAlbedo(ray *optics.Ray, sample bxdf.BxDFSample) float64 {
+	probe := &optics.Ray{
+		WaveLength:       ray.WaveLength,
+		WavelengthPDF:    ray.WavelengthPDF,
+		SpectralPower:    1,
+		RGBCompatibility: optics.RGB{1, 1, 1},
+	}
+	applySpectrum(probe, sample.F.MulScalar(maths.AbsCosTheta(sample.Wi)/sample.PDF))
+	return optics.SpectralRayToScalar(probe)
+}
+
+// firstNonSpecularAlbedo follows sampled delta lobes from hit to the first
+// surface event that is not specular and returns sampledAlbedo there.
+// Emitters without a surface have zero albedo.
+func (h *Handler) firstNonSpecularAlbedo(rng uniformSource, objTree *object.ObjectTree, ray *optics.Ray, hit *object.SurfaceHit) float64 {
+	media := getMediumRegistry(objTree)
+	for level := int64(0); ; level++ {
+		si, ok := h.prepareSurfaceInteraction(media, ray, hit)
+		if !ok || !si.Object.Material.HasSurface() {
+			return 0
+		}
+		sample, ok := sampleSurface(rng, si.Object, si.Context, si.WoLocal)
+		if !ok {
+			return 0
+		}
+		if sample.Flags&(bxdf.DeltaReflection|bxdf.DeltaTransmission) == 0 || level >= h.MaxRayLevel {
+			return sampledAlbedo(ray, sample)
+		}
+
+		g := ray.G()
+		si.Frame.LocalToWorldInto(ray.Direction, sample.Wi)
+		g.ProjectTangent(ray.Origin, ray.Direction, ray.Direction)
+		if !normalizeDirectionInGeometry(g, ray.Origin, ray.Direction) {
+			return 0
+		}
+		if hit, ok = surfaceHitInGeometry(objTree, ray, g); !ok {
+			return 0
+		}
+	}
+}
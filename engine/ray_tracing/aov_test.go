@@ -0,0 +1,134 @@
+package ray_tracing
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+func TestPixelRenderRecordsAOVsWithoutChangingRadiance(t *testing.T) {
+	tree := newAdaptiveTestScene()
+	disk := tree.Objects[0]
+	disk.ID = "disk"
+	// A sampled reflectance is flat in wavelength, so every albedo sample of a
+	// covered pixel is exact.
+	disk.Material = &material.Material{
+		Surface:  bsdf.NewSingle(bxdf.NewLambert(optics.NewSampledSpectrum([]float64{0.6}))),
+		Metadata: material.MaterialMetadata{Name: "matte"},
+	}
+
+	render := func(aovs ...camera.AOVKind) *camera.Film {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = IntegratorPathTracing
+		h.SpectrumMode = optics.SpectrumModeHeroWavelength
+		h.ThreadNum = 3
+		h.AOVs = aovs
+		renderCamera := newBDPTTestCamera(t, 8, 8)
+		renderCamera.Film.InitSpectralBins(1, optics.WavelengthMin, optics.WavelengthMax)
+		if err := h.TraceScene(renderCamera, tree, 16); err != nil {
+			t.Fatal(err)
+		}
+		return renderCamera.Film
+	}
+	plain := render()
+	film := render(
+		camera.AOVDepth, camera.AOVGeometricNormal, camera.AOVAlbedo,
+		camera.AOVObjectID, camera.AOVMaterialID, camera.AOVSampleCount, camera.AOVVariance,
+	)
+	if plain.AOVs != nil {
+		t.Fatalf("render without AOVs recorded %d channels", len(plain.AOVs))
+	}
+	if !slices.Equal(plain.SpectralBins[0].Data, film.SpectralBins[0].Data) {
+		t.Fatal("recording AOVs changed the radiance")
+	}
+	if !slices.Equal(film.ObjectIDs, []string{"disk"}) || !slices.Equal(film.MaterialIDs, []string{"matte"}) {
+		t.Fatalf("ID tables = %v, %v", film.ObjectIDs, film.MaterialIDs)
+	}
+
+	center, corner := 4*8+4, 0
+	if depth := film.AOV(camera.AOVDepth).Data[center]; depth < 3 || depth > 3.05 {
+		t.Fatalf("center depth = %g, want the disk distance of about 3", depth)
+	}
+	if normal := film.AOV(camera.AOVGeometricNormal).Pixel(center); math.Abs(normal[2]+1) > 1e-9 {
+		t.Fatalf("center normal = %v, want (0, 0, -1)", normal)
+	}
+	if albedo := film.AOV(camera.AOVAlbedo).Data[center]; math.Abs(albedo-0.6) > 1e-9 {
+		t.Fatalf("center albedo = %g, want the Lambert albedo 0.6", albedo)
+	}
+	if variance := film.AOV(camera.AOVVariance).Data; variance[center] < 0 || variance[corner] != 0 {
+		t.Fatalf("center, corner variance = %g, %g; want non-negative and 0", variance[center], variance[corner])
+	}
+	for _, test := range []struct {
+		kind           camera.AOVKind
+		center, corner float64
+	}{
+		{camera.AOVObjectID, 0, -1},
+		{camera.AOVMaterialID, 0, -1},
+		{camera.AOVSampleCount, 16, 16},
+		{camera.AOVDepth, film.AOV(camera.AOVDepth).Data[center], 0},
+	} {
+		data := film.AOV(test.kind).Data
+		if data[center] != test.center || data[corner] != test.corner {
+			t.Fatalf("%s center, corner = %g, %g; want %g, %g", test.kind, data[center], data[corner], test.center, test.corner)
+		}
+	}
+}
+
+// In sampled mode every camera sample traces one path per wavelength stratum,
+// and the AOV means are taken over those paths.
+func TestSampledModeAOVsAverageEveryRadiancePath(t *testing.T) {
+	tree := newAdaptiveTestScene()
+	tree.Objects[0].Material = &material.Material{
+		Surface: bsdf.NewSingle(bxdf.NewLambert(optics.NewSampledSpectrum([]float64{0.6}))),
+	}
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeSampledWavelengths
+	h.WavelengthSamples = 4
+	h.AOVs = []camera.AOVKind{camera.AOVDepth, camera.AOVAlbedo, camera.AOVSampleCount}
+	renderCamera := newBDPTTestCamera(t, 8, 8)
+	renderCamera.Film.InitSpectralBins(1, optics.WavelengthMin, optics.WavelengthMax)
+	if err := h.TraceScene(renderCamera, tree, 8); err != nil {
+		t.Fatal(err)
+	}
+	film := renderCamera.Film
+
+	center := 4*8 + 4
+	if depth := film.AOV(camera.AOVDepth).Data[center]; depth < 3 || depth > 3.05 {
+		t.Fatalf("center depth = %g, want the disk distance of about 3", depth)
+	}
+	if albedo := film.AOV(camera.AOVAlbedo).Data[center]; math.Abs(albedo-0.6) > 1e-9 {
+		t.Fatalf("center albedo = %g, want the Lambert albedo 0.6", albedo)
+	}
+	if count := film.AOV(camera.AOVSampleCount).Data[center]; count != 8 {
+		t.Fatalf("center sample count = %g, want the 8 camera samples", count)
+	}
+}
+
+func TestPixelVarianceScalesCameraSampleSpread(t *testing.T) {
+	// Two sampled-mode camera samples of two wavelengths each, normalized
+	// so that the four values sum to the pixel value 0.4.
+	samples := []camera.SpectralSample{{Value: 0.05}, {Value: 0.05}, {Value: 0.1}, {Value: 0.2}}
+	// The camera-sample shares 0.1 and 0.3 have variance 0.02.
+	if got := pixelVariance(samples, 2); math.Abs(got-0.04) > 1e-15 {
+		t.Fatalf("variance = %g, want 0.04", got)
+	}
+	if got := pixelVariance(samples[:1], 1); got != 0 {
+		t.Fatalf("variance of one camera sample = %g, want 0", got)
+	}
+}
+
+func TestTraceSceneRejectsRepeatedAOVs(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.AOVs = []camera.AOVKind{camera.AOVDepth, camera.AOVDepth}
+	if err := h.TraceScene(newBDPTTestCamera(t, 2, 2), newAdaptiveTestScene(), 1); err == nil {
+		t.Fatal("expected a repeated AOV to be rejected")
+	}
+}
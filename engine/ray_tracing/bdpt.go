@@ -3,11 +3,11 @@ package ray_tracing
 import (
 	"fmt"
 	"math"
-	"math/rand/v2"
 
 	"github.com/Algo2147483647/ray/engine/maths"
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
 	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/light"
 	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
 	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
 	"github.com/Algo2147483647/ray/engine/model/material/emission"
@@ -25,11 +25,21 @@ const (
 	bdptVertexCamera bdptVertexKind = iota
 	bdptVertexLight
 	bdptVertexSurface
+	bdptVertexMedium
+	bdptVertexInfinite
+	bdptVertexDelta
 )
 
 // bdptVertex stores densities in area measure at this vertex. Delta describes
 // the sampled outgoing edge; Connectible describes whether the vertex has a
 // continuous component that a deterministic connection strategy may evaluate.
+// Medium vertices have no normal: their densities carry no cosine factor and
+// Phase with the arriving propagation direction Incoming replaces the BSDF.
+// Infinite vertices stand for the infinite lights in LightDirection: densities
+// toward them stay in solid angle, and their Point only marks that direction.
+// Delta vertices start light subpaths on the delta light DeltaLight; no
+// strategy other than sampling that light can produce them, and Scene is the
+// bound that lights without a position aim at.
 type bdptVertex struct {
 	Kind            bdptVertexKind
 	Point           *mat.VecDense
@@ -47,18 +57,15 @@ type bdptVertex struct {
 	Connectible     bool
 	MediumStack     medium.Stack
 	Camera          camera.BidirectionalCamera
-}
-
-type areaLight struct {
-	Object  *object.Object
-	Sampler shape.SurfaceSampler
-	Area    float64
-	Weight  float64
+	Phase           medium.PhaseFunction
+	Incoming        *mat.VecDense
+	LightDirection  *mat.VecDense
+	DeltaLight      light.Delta
+	Scene           light.Sphere
 }
 
 type bdptSceneState struct {
-	Lights           []areaLight
-	TotalLightWeight float64
+	Lights *object.LightTree
 }
 
 func (v *bdptVertex) emissionLocal(world *mat.VecDense) maths.Direction {
@@ -105,7 +112,6 @@ func (h *Handler) prepareBDPT(renderCamera camera.RayCamera, tree *object.Object
 	}
 
 	if tree != nil {
-		checkedMedia := make(map[medium.MediumID]bool)
 		for _, obj := range tree.Objects {
 			if obj == nil {
 				continue
@@ -126,19 +132,8 @@ func (h *Handler) prepareBDPT(renderCamera camera.RayCamera, tree *object.Object
 				if obj.MediumBoundary.Active() && obj.Material.Surface.DeltaFlags()&bxdf.TransmissionEvent == 0 {
 					return nil, fmt.Errorf("object %q: BDPT medium boundary requires a supported transmission surface", obj.Material.Metadata.Name)
 				}
-				if obj.MediumBoundary.Active() {
-					if obj.MediumBoundary.Thin {
-						return nil, fmt.Errorf("object %q: BDPT thin medium boundaries are not implemented", obj.Material.Metadata.Name)
-					}
-					for _, mediumID := range []medium.MediumID{obj.MediumBoundary.Outside, obj.MediumBoundary.Inside} {
-						if checkedMedia[mediumID] {
-							continue
-						}
-						checkedMedia[mediumID] = true
-						if bdptMediumHasScattering(getMediumRegistry(tree), mediumID) {
-							return nil, fmt.Errorf("object %q: BDPT participating-medium scattering is not implemented", obj.Material.Metadata.Name)
-						}
-					}
+				if obj.MediumBoundary.Active() && obj.MediumBoundary.Thin {
+					return nil, fmt.Errorf("object %q: BDPT thin medium boundaries are not implemented", obj.Material.Metadata.Name)
 				}
 			} else if obj.MediumBoundary.Active() {
 				return nil, fmt.Errorf("object %q: BDPT medium boundary requires a material surface", obj.Material.Metadata.Name)
@@ -155,35 +150,13 @@ func (h *Handler) prepareBDPT(renderCamera camera.RayCamera, tree *object.Object
 	}
 
 	state := prepareBDPTScene(tree)
-	if len(state.Lights) == 0 || state.TotalLightWeight <= 0 {
-		return nil, fmt.Errorf("BDPT scene has no sampleable finite area light")
+	if state.Lights.Len() == 0 {
+		return nil, fmt.Errorf("BDPT scene has no sampleable light")
 	}
-	return state, nil
-}
-
-func bdptMediumHasScattering(registry *medium.Registry, mediumID medium.MediumID) bool {
-	if registry == nil {
-		return false
+	if err := checkInfiniteLightBounds(state.Lights); err != nil {
+		return nil, fmt.Errorf("BDPT %w", err)
 	}
-	for _, wavelength := range []float64{medium.WavelengthMinNM, medium.DefaultWavelengthNM, medium.WavelengthMaxNM} {
-		ctx := bxdf.ShadingContext{
-			SpectrumMode:  optics.SpectrumModeSampledWavelengths,
-			WavelengthNM:  wavelength,
-			WavelengthsNM: []float64{wavelength},
-		}
-		coefficient := registry.SigmaS(mediumID, ctx)
-		for _, value := range coefficient.Samples {
-			if value != 0 {
-				return true
-			}
-		}
-		for channel := 0; channel < 3; channel++ {
-			if coefficient.RGBChannel(channel) != 0 {
-				return true
-			}
-		}
-	}
-	return false
+	return state, nil
 }
 
 func validateBDPTSurface(surface bsdf.BSDF) error {
@@ -251,8 +224,7 @@ func isBDPTBxDF(scattering bxdf.BxDF) bool {
 }
 
 func prepareBDPTScene(tree *object.ObjectTree) *bdptSceneState {
-	lights, total := collectAreaLights(tree)
-	return &bdptSceneState{Lights: lights, TotalLightWeight: total}
+	return &bdptSceneState{Lights: tree.BuildLightTree()}
 }
 
 func (h *Handler) traceBidirectionalSample(
@@ -265,23 +237,48 @@ func (h *Handler) traceBidirectionalSample(
 	if err != nil {
 		return zeroSpectrum(wavelengthNM)
 	}
-	result, _ := h.traceBidirectionalPrepared(state, renderCamera, objTree, wavelengthNM, wavelengthPDF, index...)
-	return result
+	random := h.newBDPTSamplers(filmWidth(renderCamera.GetFilm()), 1).start(0, 0)
+	raster, weight := filteredRaster(h.pixelFilter(), random.Camera, index...)
+	result, _ := h.traceBidirectionalPrepared(
+		state, random, renderCamera, objTree, wavelengthNM, wavelengthPDF, raster,
+	)
+	return result.MulScalar(weight)
 }
 
+// traceBidirectionalPrepared traces one camera subpath through the continuous
+// raster position and one light subpath, and evaluates every connection
+// strategy between them.
 func (h *Handler) traceBidirectionalPrepared(
 	state *bdptSceneState,
+	random bdptRandom,
 	renderCamera camera.RayCamera,
 	objTree *object.ObjectTree,
 	wavelengthNM, wavelengthPDF float64,
-	index ...int,
+	raster []float64,
 ) (optics.Spectrum, []FilmSplat) {
 	bdCamera, ok := renderCamera.(camera.BidirectionalCamera)
 	if state == nil || !ok {
 		return zeroSpectrum(wavelengthNM), nil
 	}
-	cameraPath := h.buildCameraSubpath(renderCamera, objTree, wavelengthNM, wavelengthPDF, index...)
-	lightPath := h.buildLightSubpath(objTree, state.Lights, state.TotalLightWeight, wavelengthNM, wavelengthPDF)
+	cameraPath := h.buildCameraSubpath(random.Camera, renderCamera, objTree, wavelengthNM, wavelengthPDF, raster)
+	lightPath := h.buildLightSubpath(random.Light, objTree, state.Lights, wavelengthNM, wavelengthPDF)
+	return h.connectBidirectionalPaths(
+		random.Connection, state, bdCamera, objTree, wavelengthNM, wavelengthPDF, lightPath, cameraPath, 0,
+	)
+}
+
+// connectBidirectionalPaths evaluates every connection strategy between a
+// camera subpath and a light subpath. A positive eta weighs the connections
+// against vertex merging as well; see bidirectionalMISWeight.
+func (h *Handler) connectBidirectionalPaths(
+	rng uniformSource,
+	state *bdptSceneState,
+	bdCamera camera.BidirectionalCamera,
+	objTree *object.ObjectTree,
+	wavelengthNM, wavelengthPDF float64,
+	lightPath, cameraPath []bdptVertex,
+	eta float64,
+) (optics.Spectrum, []FilmSplat) {
 	result := zeroSpectrum(wavelengthNM)
 	splats := make([]FilmSplat, 0, len(lightPath))
 
@@ -292,12 +289,12 @@ func (h *Handler) traceBidirectionalPrepared(
 				continue
 			}
 			value, projection, isSplat, valid := h.connectBDPTStrategy(
-				state, bdCamera, objTree, lightPath, cameraPath, s, t,
+				rng, state, bdCamera, objTree, lightPath, cameraPath, s, t,
 			)
 			if !valid {
 				continue
 			}
-			weight := bdptMISWeight(state, bdCamera, lightPath, cameraPath, s, t)
+			weight := bidirectionalMISWeight(state, bdCamera, lightPath, cameraPath, s, t, eta, false)
 			if weight <= 0 {
 				continue
 			}
@@ -315,51 +312,19 @@ func (h *Handler) traceBidirectionalPrepared(
 	return result, splats
 }
 
-func collectAreaLights(tree *object.ObjectTree) ([]areaLight, float64) {
-	if tree == nil {
-		return nil, 0
-	}
-	lights := make([]areaLight, 0)
-	totalWeight := 0.0
-	for _, obj := range tree.Objects {
-		if obj == nil || obj.Material == nil || !obj.Material.HasEmission() || obj.Shape == nil {
-			continue
-		}
-		sampler, ok := obj.Shape.(shape.SurfaceSampler)
-		if !ok {
-			continue
-		}
-		area := sampler.SurfaceArea()
-		if area <= 0 || math.IsNaN(area) || math.IsInf(area, 0) {
-			continue
-		}
-		exitance := obj.Material.Emission.ExitanceEstimate(bxdf.ShadingContext{
-			SpectrumMode:    optics.SpectrumModeRGB,
-			GeometricNormal: maths.NewDirection(0, 0, 1),
-		})
-		powerEstimate := exitance.MaxComponent()
-		if powerEstimate <= 0 || math.IsNaN(powerEstimate) || math.IsInf(powerEstimate, 0) {
-			powerEstimate = 1
-		}
-		weight := area * powerEstimate
-		lights = append(lights, areaLight{Object: obj, Sampler: sampler, Area: area, Weight: weight})
-		totalWeight += weight
-	}
-	return lights, totalWeight
-}
-
 func (h *Handler) buildCameraSubpath(
+	rng uniformSource,
 	renderCamera camera.RayCamera,
 	tree *object.ObjectTree,
 	wavelengthNM, wavelengthPDF float64,
-	index ...int,
+	raster []float64,
 ) []bdptVertex {
 	bdCamera, ok := renderCamera.(camera.BidirectionalCamera)
 	if !ok || bdCamera.Endpoint() == nil {
 		return nil
 	}
 	ray := &optics.Ray{Geometry: h.SceneGeometry}
-	renderCamera.GenerateRay(ray, index...)
+	bdCamera.GenerateRayAt(ray, raster)
 	setBDPTWavelength(ray, wavelengthNM, wavelengthPDF)
 	directionPDF := bdCamera.PDFDirection(ray.Direction)
 	if directionPDF <= 0 {
@@ -371,45 +336,47 @@ func (h *Handler) buildCameraSubpath(
 		MediumStack: medium.NewStack(medium.MediumAir),
 	}}
 	return h.randomWalk(
-		tree, ray, unitSpectrum(wavelengthNM), directionPDF,
+		rng, tree, ray, unitSpectrum(wavelengthNM), directionPDF,
 		bxdf.TransportRadiance, int(h.MaxRayLevel)+2, path,
 	)
 }
 
+// sampleLightEndpoint starts a light subpath at an emitter selected by power
+// alone; bdptKernel explains why light subpaths ignore the spatial selector.
 func (h *Handler) sampleLightEndpoint(
-	lights []areaLight,
-	totalWeight, wavelengthNM, wavelengthPDF float64,
+	rng uniformSource,
+	lights *object.LightTree,
+	wavelengthNM, wavelengthPDF float64,
 ) (bdptVertex, bool) {
-	selected, selectionPDF, ok := selectAreaLight(lights, totalWeight)
+	index, selectionPDF, ok := sampleLight(rng, lights, nil)
 	if !ok {
 		return bdptVertex{}, false
 	}
-	ss, ok := selected.Sampler.SampleSurface(maths.Sample2D{U: rand.Float64(), V: rand.Float64()})
+	if infinite, ok := lights.InfiniteLight(index); ok {
+		return h.makeInfiniteLightEndpoint(rng, lights, infinite, wavelengthNM, wavelengthPDF)
+	}
+	if delta, ok := lights.DeltaLight(index); ok {
+		return h.makeDeltaLightEndpoint(lights, delta, selectionPDF, wavelengthNM, wavelengthPDF), true
+	}
+	selected := lights.Lights[index]
+	ss, ok := selected.Sampler.SampleSurface(maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
 	if !ok {
 		return bdptVertex{}, false
 	}
 	return h.makeLightEndpoint(selected, selectionPDF, ss, wavelengthNM, wavelengthPDF)
 }
 
-func selectAreaLight(lights []areaLight, totalWeight float64) (areaLight, float64, bool) {
-	if len(lights) == 0 || totalWeight <= 0 || math.IsNaN(totalWeight) || math.IsInf(totalWeight, 0) {
-		return areaLight{}, 0, false
-	}
-	target := rand.Float64() * totalWeight
-	selected := lights[len(lights)-1]
-	for _, light := range lights {
-		if target < light.Weight {
-			selected = light
-			break
-		}
-		target -= light.Weight
-	}
-	selectionPDF := selected.Weight / totalWeight
-	return selected, selectionPDF, selectionPDF > 0 && isFinitePDF(selectionPDF)
+// sampleLight chooses an emitter from the light tree and returns its index.
+// Light subpaths pass a nil reference point and select by power alone;
+// next-event estimation passes the shading point so nearby, well-oriented
+// emitters are preferred.
+func sampleLight(rng uniformSource, lights *object.LightTree, reference *mat.VecDense) (int, float64, bool) {
+	index, selectionPDF, ok := lights.Sample(reference, rng.Float64())
+	return index, selectionPDF, ok && isFinitePDF(selectionPDF)
 }
 
 func (h *Handler) makeLightEndpoint(
-	selected areaLight,
+	selected object.Light,
 	selectionPDF float64,
 	ss shape.SurfaceSample,
 	wavelengthNM, wavelengthPDF float64,
@@ -443,17 +410,119 @@ func (h *Handler) makeLightEndpoint(
 	}, true
 }
 
+// makeInfiniteLightEndpoint starts a light subpath at an infinite light. The
+// light's direction is sampled first, then a point on the disk of the scene's
+// bounding sphere that faces it; the vertex sits one radius behind that disk.
+// PDFFwdArea is the solid-angle density of the direction over all infinite
+// lights, and the positional density belongs to the first scattering vertex.
+func (h *Handler) makeInfiniteLightEndpoint(
+	rng uniformSource,
+	lights *object.LightTree,
+	infinite light.Infinite,
+	wavelengthNM, wavelengthPDF float64,
+) (bdptVertex, bool) {
+	ctx := h.emitterContext(wavelengthNM, wavelengthPDF)
+	sample, ok := infinite.Sample(ctx, maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
+	if !ok || sample.PDF <= 0 {
+		return bdptVertex{}, false
+	}
+	directionPDF := lights.InfinitePDF(sample.Direction)
+	positionPDF := infinitePositionPDF(lights)
+	if directionPDF <= 0 || !isFinitePDF(directionPDF) || positionPDF <= 0 || !isFinitePDF(positionPDF) {
+		return bdptVertex{}, false
+	}
+	frame, ok := maths.NewFrameFromNormal(sample.Direction)
+	if !ok {
+		return bdptVertex{}, false
+	}
+	radius := lights.SceneRadius
+	r, phi := math.Sqrt(rng.Float64()), 2*math.Pi*rng.Float64()
+	point := frame.LocalToWorld(maths.NewDirection(radius*r*math.Cos(phi), radius*r*math.Sin(phi), radius))
+	point.AddVec(point, mat.NewVecDense(3, lights.SceneCenter[:]))
+	return bdptVertex{
+		Kind: bdptVertexInfinite, Point: point, LightDirection: sample.Direction,
+		Context:     ctx,
+		Beta:        unitSpectrum(wavelengthNM).MulScalar(1 / (directionPDF * positionPDF)),
+		PDFFwdArea:  directionPDF,
+		SampledPDF:  directionPDF,
+		MediumStack: medium.NewStack(medium.MediumAir),
+	}, true
+}
+
+// makeDeltaLightEndpoint starts a light subpath at a delta light. Its
+// position is sampled together with the emitted direction, in
+// buildDeltaLightSubpath; the endpoint's density is the selection
+// probability alone.
+func (h *Handler) makeDeltaLightEndpoint(
+	lights *object.LightTree,
+	delta light.Delta,
+	selectionPDF float64,
+	wavelengthNM, wavelengthPDF float64,
+) bdptVertex {
+	return bdptVertex{
+		Kind: bdptVertexDelta, DeltaLight: delta, Scene: lights.Scene(),
+		Context:     h.emitterContext(wavelengthNM, wavelengthPDF),
+		Beta:        unitSpectrum(wavelengthNM).MulScalar(1 / selectionPDF),
+		PDFFwdArea:  selectionPDF,
+		MediumStack: medium.NewStack(medium.MediumAir),
+	}
+}
+
+// emitterContext is the shading context of a light subpath's endpoint that
+// has no surface.
+func (h *Handler) emitterContext(wavelengthNM, wavelengthPDF float64) bxdf.ShadingContext {
+	ctx := bxdf.ShadingContext{
+		TransportMode: bxdf.TransportImportance, SpectrumMode: h.SpectrumMode,
+		WavelengthNM: wavelengthNM, WavelengthPDF: wavelengthPDF, CurrentIOR: 1,
+	}
+	if wavelengthNM > 0 {
+		ctx.WavelengthsNM = []float64{wavelengthNM}
+	}
+	return ctx
+}
+
+// infinitePositionPDF is the area density of the point on the bounding disk
+// where a light subpath from an infinite light enters the scene.
+func infinitePositionPDF(lights *object.LightTree) float64 {
+	return 1 / (math.Pi * lights.SceneRadius * lights.SceneRadius)
+}
+
+// checkInfiniteLightBounds rejects infinite and directional lights around a
+// scene without a finite bounding sphere, which light subpaths could not
+// start from.
+func checkInfiniteLightBounds(lights *object.LightTree) error {
+	if lights.Scene().Valid() {
+		return nil
+	}
+	if len(lights.Infinite) > 0 {
+		return fmt.Errorf("infinite lights require a bounded, non-empty scene")
+	}
+	for _, delta := range lights.Delta {
+		if _, ok := delta.(*light.Directional); ok {
+			return fmt.Errorf("directional lights require a bounded, non-empty scene")
+		}
+	}
+	return nil
+}
+
 func (h *Handler) buildLightSubpath(
+	rng uniformSource,
 	tree *object.ObjectTree,
-	lights []areaLight,
-	totalWeight, wavelengthNM, wavelengthPDF float64,
+	lights *object.LightTree,
+	wavelengthNM, wavelengthPDF float64,
 ) []bdptVertex {
-	root, ok := h.sampleLightEndpoint(lights, totalWeight, wavelengthNM, wavelengthPDF)
+	root, ok := h.sampleLightEndpoint(rng, lights, wavelengthNM, wavelengthPDF)
 	if !ok {
 		return nil
 	}
+	if root.Kind == bdptVertexInfinite {
+		return h.buildInfiniteLightSubpath(rng, tree, lights, root, wavelengthNM, wavelengthPDF)
+	}
+	if root.Kind == bdptVertexDelta {
+		return h.buildDeltaLightSubpath(rng, tree, root, wavelengthNM, wavelengthPDF)
+	}
 	directionSample := root.Object.Material.Emission.SampleDirection(root.Context, maths.Sample2D{
-		U: rand.Float64(), V: rand.Float64(),
+		U: rng.Float64(), V: rng.Float64(),
 	})
 	if directionSample.PDF <= 0 || directionSample.Wo.Len() != root.GeometricNormal.Len() ||
 		!directionSample.Le.IsFinite() || !directionSample.Le.IsNonNegative() {
@@ -475,15 +544,82 @@ func (h *Handler) buildLightSubpath(
 	ray.Direction.CopyVec(worldDirection)
 	setBDPTWavelength(ray, wavelengthNM, wavelengthPDF)
 	return h.randomWalk(
-		tree, ray, beta, directionSample.PDF,
+		rng, tree, ray, beta, directionSample.PDF,
 		bxdf.TransportImportance, int(h.MaxRayLevel)+1, path,
 	)
 }
 
+// buildInfiniteLightSubpath continues a light subpath from an infinite root
+// along the parallel beam that enters the scene through the bounding disk.
+func (h *Handler) buildInfiniteLightSubpath(
+	rng uniformSource,
+	tree *object.ObjectTree,
+	lights *object.LightTree,
+	root bdptVertex,
+	wavelengthNM, wavelengthPDF float64,
+) []bdptVertex {
+	travel := negated(root.LightDirection)
+	beta := root.Beta.Mul(lights.InfiniteRadiance(root.Context, root.LightDirection))
+	if !validSpectrum(beta) {
+		return nil
+	}
+	ray := &optics.Ray{Origin: mat.VecDenseCopyOf(root.Point), Direction: mat.VecDenseCopyOf(travel), Geometry: h.SceneGeometry}
+	ray.Init()
+	ray.Origin.CopyVec(root.Point)
+	ray.Direction.CopyVec(travel)
+	setBDPTWavelength(ray, wavelengthNM, wavelengthPDF)
+	path := h.randomWalk(
+		rng, tree, ray, beta, root.PDFFwdArea,
+		bxdf.TransportImportance, int(h.MaxRayLevel)+1, []bdptVertex{root},
+	)
+	if len(path) > 1 {
+		// The beam reaches its first vertex without a distance falloff.
+		path[1].PDFFwdArea = infinitePositionPDF(lights)
+		if path[1].Kind == bdptVertexSurface {
+			path[1].PDFFwdArea *= absDot(path[1].GeometricNormal, travel)
+		}
+	}
+	return path
+}
+
+// buildDeltaLightSubpath continues a light subpath from a delta root along a
+// ray sampled from the light. The ray's origin becomes the root's Point, so
+// later vertices see the light in the direction the ray arrived from.
+func (h *Handler) buildDeltaLightSubpath(
+	rng uniformSource,
+	tree *object.ObjectTree,
+	root bdptVertex,
+	wavelengthNM, wavelengthPDF float64,
+) []bdptVertex {
+	emitted, ok := root.DeltaLight.SampleEmission(root.Context, maths.Sample2D{U: rng.Float64(), V: rng.Float64()}, root.Scene)
+	if !ok || emitted.Origin.Len() != 3 {
+		return nil
+	}
+	beta := root.Beta.Mul(emitted.Weight)
+	if !validSpectrum(beta) {
+		return nil
+	}
+	root.Point = emitted.Origin
+	ray := &optics.Ray{Origin: mat.VecDenseCopyOf(emitted.Origin), Direction: mat.VecDenseCopyOf(emitted.Direction), Geometry: h.SceneGeometry}
+	ray.Init()
+	ray.Origin.CopyVec(emitted.Origin)
+	ray.Direction.CopyVec(emitted.Direction)
+	setBDPTWavelength(ray, wavelengthNM, wavelengthPDF)
+	path := h.randomWalk(
+		rng, tree, ray, beta, root.PDFFwdArea,
+		bxdf.TransportImportance, int(h.MaxRayLevel)+1, []bdptVertex{root},
+	)
+	if len(path) > 1 {
+		path[1].PDFFwdArea = bdptDeltaEmissionPDF(&path[0], &path[1])
+	}
+	return path
+}
+
 // randomWalk is shared by camera and light subpaths. It records the forward
 // area density of every generated vertex and the reverse area density of the
 // preceding vertex at the moment the outgoing edge is sampled.
 func (h *Handler) randomWalk(
+	rng uniformSource,
 	tree *object.ObjectTree,
 	ray *optics.Ray,
 	beta optics.Spectrum,
@@ -492,26 +628,54 @@ func (h *Handler) randomWalk(
 	maxVertices int,
 	path []bdptVertex,
 ) []bdptVertex {
+	registry := getMediumRegistry(tree)
 	for len(path) < maxVertices {
 		origin := mat.VecDenseCopyOf(ray.Origin)
 		direction := mat.VecDenseCopyOf(ray.Direction)
 		hit, ok := surfaceHitInGeometry(tree, ray, ray.G())
-		if !ok {
-			break
+		mediumCtx := h.newShadingContext(ray)
+		maxDistance := math.Inf(1)
+		if ok {
+			maxDistance = hit.Distance
 		}
-		segmentLength := hit.ArcLength
-		if segmentLength <= 0 {
-			segmentLength = ray.G().ArcLengthFromEmbedT(ray.Origin, ray.Direction, hit.Distance)
+		event, tracked := sampleMediumSegment(rng, registry, ray, mediumCtx, maxDistance)
+		if tracked {
+			beta = beta.Mul(event.Weight)
+			if !validSpectrum(beta) {
+				break
+			}
+			if event.Scattered {
+				var continued bool
+				beta, pendingDirectionPDF, continued = h.scatterInMedium(
+					rng, registry, ray, mediumCtx, mode, event.Distance, beta, pendingDirectionPDF, &path,
+				)
+				if !continued {
+					break
+				}
+				continue
+			}
 		}
-		beta = evaluateSegmentTransmittance(
-			getMediumRegistry(tree), ray.MediumStack.Current(), segmentLength, h.newShadingContext(ray),
-		).ApplyToSpectrum(beta)
-		if !validSpectrum(beta) {
+		if !ok {
+			if mode == bxdf.TransportRadiance {
+				h.appendInfiniteVertex(tree, registry, ray, mediumCtx, beta, pendingDirectionPDF, &path)
+			}
 			break
 		}
+		if !tracked {
+			segmentLength := hit.ArcLength
+			if segmentLength <= 0 {
+				segmentLength = ray.G().ArcLengthFromEmbedT(ray.Origin, ray.Direction, hit.Distance)
+			}
+			beta = evaluateSegmentTransmittance(
+				registry, ray.MediumStack.Current(), segmentLength, mediumCtx,
+			).ApplyToSpectrum(beta)
+			if !validSpectrum(beta) {
+				break
+			}
+		}
 		distance2 := squaredDistance(origin, hit.Point)
 		pdfArea := pendingDirectionPDF * absDot(hit.GeometricNormal, negated(direction)) / math.Max(distance2, utils.EPS)
-		si, ok := h.prepareSurfaceInteraction(getMediumRegistry(tree), ray, hit)
+		si, ok := h.prepareSurfaceInteraction(registry, ray, hit)
 		if !ok {
 			break
 		}
@@ -530,7 +694,7 @@ func (h *Handler) randomWalk(
 		if si.Object.Material == nil || !si.Object.Material.HasSurface() {
 			break
 		}
-		sample, ok := sampleSurface(si.Object, si.Context, si.WoLocal)
+		sample, ok := sampleSurface(rng, si.Object, si.Context, si.WoLocal)
 		if !ok {
 			break
 		}
@@ -556,7 +720,7 @@ func (h *Handler) randomWalk(
 			break
 		}
 		if sample.Flags&bxdf.TransmissionEvent != 0 {
-			applyMediumTransmission(getMediumRegistry(tree), ray, si.Context, si.Object.MediumBoundary, sample)
+			applyMediumTransmission(registry, ray, si.Context, si.Object.MediumBoundary, sample)
 		}
 		si.Frame.LocalToWorldInto(ray.Direction, sample.Wi)
 		ray.Origin.CopyVec(hit.Point)
@@ -565,7 +729,101 @@ func (h *Handler) randomWalk(
 	return path
 }
 
+// appendInfiniteVertex ends a camera subpath that escaped the scene on the
+// infinite lights, if there are any and the escape medium lets light through.
+func (h *Handler) appendInfiniteVertex(
+	tree *object.ObjectTree,
+	registry *medium.Registry,
+	ray *optics.Ray,
+	ctx bxdf.ShadingContext,
+	beta optics.Spectrum,
+	pendingDirectionPDF float64,
+	path *[]bdptVertex,
+) {
+	if tree == nil || len(tree.InfiniteLights) == 0 || ray.Direction.Len() != 3 ||
+		!reachesInfinity(registry, ray.MediumStack.Current(), ctx) {
+		return
+	}
+	point := mat.VecDenseCopyOf(ray.Origin)
+	point.AddVec(point, ray.Direction)
+	*path = append(*path, bdptVertex{
+		Kind: bdptVertexInfinite, Point: point, LightDirection: mat.VecDenseCopyOf(ray.Direction),
+		Context: ctx, Beta: beta, PDFFwdArea: pendingDirectionPDF, MediumStack: ray.MediumStack.Clone(),
+	})
+}
+
+// scatterInMedium appends a medium vertex at distance along the current ray and
+// samples the phase function for the next edge. It returns the updated
+// throughput and forward solid-angle density, or false if the walk must stop.
+func (h *Handler) scatterInMedium(
+	rng uniformSource,
+	registry *medium.Registry,
+	ray *optics.Ray,
+	ctx bxdf.ShadingContext,
+	mode bxdf.TransportMode,
+	distance float64,
+	beta optics.Spectrum,
+	pendingDirectionPDF float64,
+	path *[]bdptVertex,
+) (optics.Spectrum, float64, bool) {
+	incoming := mat.VecDenseCopyOf(ray.Direction)
+	point := mat.VecDenseCopyOf(ray.Origin)
+	point.AddScaledVec(point, distance, incoming)
+	ctx.TransportMode = mode
+	phase := registry.Phase(ray.MediumStack.Current())
+	*path = append(*path, bdptVertex{
+		Kind: bdptVertexMedium, Point: point, Incoming: incoming, Phase: phase,
+		Context: ctx, Beta: beta, Connectible: true, MediumStack: ray.MediumStack.Clone(),
+		PDFFwdArea: pendingDirectionPDF / math.Max(distance*distance, utils.EPS),
+	})
+	currentIndex := len(*path) - 1
+
+	frame, ok := maths.NewFrameFromNormal(incoming)
+	if !ok {
+		return beta, 0, false
+	}
+	local, pdf := phase.Sample(maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
+	if pdf <= 0 || !isFinitePDF(pdf) {
+		return beta, 0, false
+	}
+	(*path)[currentIndex].SampledPDF = pdf
+	// Phase functions depend only on the scattering angle, so the reverse
+	// density equals the forward one.
+	(*path)[currentIndex-1].PDFRevArea = convertBDPTDensity(pdf, &(*path)[currentIndex], &(*path)[currentIndex-1])
+
+	beta = beta.MulScalar(phase.Eval(maths.CosTheta(local)) / pdf)
+	if !validSpectrum(beta) {
+		return beta, 0, false
+	}
+	ray.Origin.CopyVec(point)
+	frame.LocalToWorldInto(ray.Direction, local)
+	return beta, pdf, true
+}
+
+// scatterToward evaluates the continuous scattering function of a surface or
+// medium vertex toward a connection direction, together with the cosine that
+// converts the connection into area measure at this vertex.
+func (v *bdptVertex) scatterToward(direction *mat.VecDense) (optics.Spectrum, float64, bool) {
+	switch v.Kind {
+	case bdptVertexSurface:
+		if !v.Connectible || v.Object == nil || v.Object.Material == nil || !v.Object.Material.HasSurface() {
+			return optics.Spectrum{}, 0, false
+		}
+		f := v.Object.Material.Surface.Eval(v.Context, v.Frame.WorldToLocal(direction), v.WoLocal)
+		return f, absDot(v.GeometricNormal, direction), !f.IsZero()
+	case bdptVertexMedium:
+		if v.Phase == nil || v.Incoming == nil {
+			return optics.Spectrum{}, 0, false
+		}
+		value := v.Phase.Eval(mat.Dot(v.Incoming, direction))
+		return unitSpectrum(v.Context.WavelengthNM).MulScalar(value), 1, value > 0
+	default:
+		return optics.Spectrum{}, 0, false
+	}
+}
+
 func (h *Handler) connectBDPTStrategy(
+	rng uniformSource,
 	state *bdptSceneState,
 	renderCamera camera.BidirectionalCamera,
 	tree *object.ObjectTree,
@@ -577,6 +835,10 @@ func (h *Handler) connectBDPTStrategy(
 	}
 	if s == 0 {
 		pt := &cameraPath[t-1]
+		if pt.Kind == bdptVertexInfinite {
+			value := pt.Beta.Mul(state.Lights.InfiniteRadiance(pt.Context, pt.LightDirection))
+			return value, camera.FilmProjection{}, false, validSpectrum(value)
+		}
 		if pt.Kind != bdptVertexSurface || pt.Object == nil || pt.Object.Material == nil || !pt.Object.Material.HasEmission() {
 			return optics.Spectrum{}, camera.FilmProjection{}, false, false
 		}
@@ -596,16 +858,23 @@ func (h *Handler) connectBDPTStrategy(
 		if s < 2 {
 			return optics.Spectrum{}, camera.FilmProjection{}, true, false
 		}
-		value, projection, ok := projectLightVertex(renderCamera, tree, &lightPath[s-1])
+		value, projection, ok := projectLightVertex(rng, renderCamera, tree, &lightPath[s-1])
 		return value, projection, true, ok
 	}
-	value, ok := h.connectBDPTVertices(tree, &lightPath[s-1], &cameraPath[t-1])
+	if s == 1 && lightPath[0].Kind == bdptVertexInfinite {
+		// Camera vertices are not connected to infinite lights directly.
+		return optics.Spectrum{}, camera.FilmProjection{}, false, false
+	}
+	if s == 1 && lightPath[0].Kind == bdptVertexDelta {
+		value, ok := connectDeltaLight(rng, tree, &lightPath[0], &cameraPath[t-1])
+		return value, camera.FilmProjection{}, false, ok
+	}
+	value, ok := h.connectBDPTVertices(rng, tree, &lightPath[s-1], &cameraPath[t-1])
 	return value, camera.FilmProjection{}, false, ok
 }
 
-func (h *Handler) connectBDPTVertices(tree *object.ObjectTree, lv, cv *bdptVertex) (optics.Spectrum, bool) {
-	if lv == nil || cv == nil || cv.Kind != bdptVertexSurface || !cv.Connectible ||
-		cv.Object == nil || cv.Object.Material == nil || !cv.Object.Material.HasSurface() {
+func (h *Handler) connectBDPTVertices(rng uniformSource, tree *object.ObjectTree, lv, cv *bdptVertex) (optics.Spectrum, bool) {
+	if lv == nil || cv == nil || (cv.Kind != bdptVertexSurface && cv.Kind != bdptVertexMedium) {
 		return optics.Spectrum{}, false
 	}
 	toCamera := directionBetween(lv.Point, cv.Point)
@@ -618,40 +887,63 @@ func (h *Handler) connectBDPTVertices(tree *object.ObjectTree, lv, cv *bdptVerte
 		return optics.Spectrum{}, false
 	}
 	toLight := negated(toCamera)
-	wiCamera := cv.Frame.WorldToLocal(toLight)
-	fCamera := cv.Object.Material.Surface.Eval(cv.Context, wiCamera, cv.WoLocal)
-	if fCamera.IsZero() {
-		return optics.Spectrum{}, false
-	}
-	cosLight := absDot(lv.GeometricNormal, toCamera)
-	cosCamera := absDot(cv.GeometricNormal, toLight)
-	if cosLight <= 0 || cosCamera <= 0 {
+	fCamera, cosCamera, ok := cv.scatterToward(toLight)
+	if !ok {
 		return optics.Spectrum{}, false
 	}
-	geometryTerm := cosLight * cosCamera / distance2
 
 	var lightFactor optics.Spectrum
+	var cosLight float64
 	if lv.Kind == bdptVertexLight {
 		woLight := lv.emissionLocal(toCamera)
 		lightFactor = lv.Object.Material.Emission.Eval(lv.Context, woLight).Mul(lv.Beta)
+		cosLight = absDot(lv.GeometricNormal, toCamera)
 	} else {
-		if lv.Kind != bdptVertexSurface || !lv.Connectible || lv.Object == nil ||
-			lv.Object.Material == nil || !lv.Object.Material.HasSurface() {
-			return optics.Spectrum{}, false
-		}
-		wiLight := lv.Frame.WorldToLocal(toCamera)
-		fLight := lv.Object.Material.Surface.Eval(lv.Context, wiLight, lv.WoLocal)
-		if fLight.IsZero() {
+		fLight, cosine, ok := lv.scatterToward(toCamera)
+		if !ok {
 			return optics.Spectrum{}, false
 		}
 		lightFactor = lv.Beta.Mul(fLight)
+		cosLight = cosine
 	}
+	if cosLight <= 0 || cosCamera <= 0 {
+		return optics.Spectrum{}, false
+	}
+	geometryTerm := cosLight * cosCamera / distance2
 	mediumID := bdptSegmentMedium(lv, toCamera)
-	transmittance := evaluateSegmentTransmittance(getMediumRegistry(tree), mediumID, distance, lv.Context)
+	transmittance := segmentTransmittance(rng, getMediumRegistry(tree), mediumID, lv.Point, toCamera, distance, lv.Context)
 	contribution := transmittance.ApplyToSpectrum(lightFactor.Mul(cv.Beta).Mul(fCamera)).MulScalar(geometryTerm)
 	return contribution, validSpectrum(contribution)
 }
 
+// connectDeltaLight is the s=1 strategy for a delta light. The light is
+// sampled again toward the camera vertex: a light without a position reaches
+// it only along its own direction, whatever point the subpath started from.
+func connectDeltaLight(rng uniformSource, tree *object.ObjectTree, lv, cv *bdptVertex) (optics.Spectrum, bool) {
+	if lv == nil || cv == nil || lv.DeltaLight == nil || (cv.Kind != bdptVertexSurface && cv.Kind != bdptVertexMedium) {
+		return optics.Spectrum{}, false
+	}
+	incident, ok := lv.DeltaLight.Incident(lv.Context, cv.Point)
+	if !ok {
+		return optics.Spectrum{}, false
+	}
+	fCamera, cosCamera, ok := cv.scatterToward(incident.Direction)
+	if !ok || cosCamera <= 0 {
+		return optics.Spectrum{}, false
+	}
+	registry := getMediumRegistry(tree)
+	mediumID := bdptSegmentMedium(cv, incident.Direction)
+	if math.IsInf(incident.Distance, 1) && !reachesInfinity(registry, mediumID, lv.Context) {
+		return optics.Spectrum{}, false
+	}
+	if !visibleSegment(tree, cv.Point, nil, incident.Direction, incident.Distance) {
+		return optics.Spectrum{}, false
+	}
+	transmittance := segmentTransmittance(rng, registry, mediumID, cv.Point, incident.Direction, incident.Distance, lv.Context)
+	contribution := transmittance.ApplyToSpectrum(lv.Beta.Mul(incident.Irradiance).Mul(cv.Beta).Mul(fCamera)).MulScalar(cosCamera)
+	return contribution, validSpectrum(contribution)
+}
+
 func bdptSegmentMedium(vertex *bdptVertex, outgoing *mat.VecDense) medium.MediumID {
 	if vertex == nil {
 		return medium.MediumAir
@@ -683,14 +975,50 @@ func bdptMISWeight(
 	lightPath, cameraPath []bdptVertex,
 	s, t int,
 ) float64 {
+	return bidirectionalMISWeight(state, renderCamera, lightPath, cameraPath, s, t, 0, false)
+}
+
+// bidirectionalMISWeight adds vertex merging to the BDPT strategies when eta,
+// the number of merged light subpaths times the merge disk area, is positive.
+// Merging at a continuous surface vertex has the density of the connection
+// that reaches the vertex from the camera side, times the vertex's light-side
+// area density and eta. With merge set, the weight is that of merging light
+// vertex s with camera vertex t-1 rather than of the (s,t) connection.
+func bidirectionalMISWeight(
+	state *bdptSceneState,
+	renderCamera camera.BidirectionalCamera,
+	lightPath, cameraPath []bdptVertex,
+	s, t int,
+	eta float64,
+	merge bool,
+) float64 {
+	if merge && (s < 1 || t < 2 || eta <= 0) {
+		return 0
+	}
 	if s < 0 || t <= 0 || s > len(lightPath) || t > len(cameraPath) || s+t < 2 {
 		return 0
 	}
 	if s+t == 2 {
 		return 1
 	}
+	// Paths that end on an infinite light have no s = 1 strategy, and paths
+	// that end on a delta light no s = 0 strategy.
+	infiniteEnd := (s > 0 && lightPath[0].Kind == bdptVertexInfinite) ||
+		(s == 0 && cameraPath[t-1].Kind == bdptVertexInfinite)
+	deltaEnd := s > 0 && lightPath[0].Kind == bdptVertexDelta
+	strategyValid := func(s, t int) bool {
+		return bdptStrategyValid(s, t) && !(infiniteEnd && s == 1) && !(deltaEnd && s == 0)
+	}
 	lights := append([]bdptVertex(nil), lightPath[:s]...)
 	cameras := append([]bdptVertex(nil), cameraPath[:t]...)
+	if s == 1 && deltaEnd && lights[0].DeltaLight.FixedDirection() {
+		// connectDeltaLight reached the camera vertex along the light's
+		// direction, not from the point the light subpath started at.
+		if incident, ok := lights[0].DeltaLight.Incident(lights[0].Context, cameras[t-1].Point); ok {
+			lights[0].Point = mat.VecDenseCopyOf(cameras[t-1].Point)
+			lights[0].Point.AddVec(lights[0].Point, incident.Direction)
+		}
+	}
 	var qs, qsMinus, pt, ptMinus *bdptVertex
 	if s > 0 {
 		qs = &lights[s-1]
@@ -718,7 +1046,7 @@ func bdptMISWeight(
 		if s > 0 {
 			ptMinus.PDFRevArea = bdptVertexPDF(pt, qs, ptMinus, renderCamera)
 		} else {
-			ptMinus.PDFRevArea = bdptLightEmissionPDF(pt, ptMinus)
+			ptMinus.PDFRevArea = bdptLightEmissionPDF(state, pt, ptMinus)
 		}
 	}
 	if qs != nil {
@@ -728,7 +1056,25 @@ func bdptMISWeight(
 		qsMinus.PDFRevArea = bdptVertexPDF(qs, pt, qsMinus, renderCamera)
 	}
 
+	mergeTerm := func(vertex *bdptVertex, lightPDF float64) float64 {
+		if eta <= 0 || vertex.Kind != bdptVertexSurface || !vertex.Connectible {
+			return 0
+		}
+		term := remapBDPTPDF(lightPDF) * eta
+		return term * term
+	}
+
 	sum := 0.0
+	current := 1.0
+	if merge {
+		current = mergeTerm(pt, pt.PDFRevArea)
+		if current <= 0 {
+			return 0
+		}
+	}
+	if s >= 1 && t >= 2 {
+		sum += mergeTerm(pt, pt.PDFRevArea)
+	}
 	ratioSquared := 1.0
 	currentS, currentT := s, t
 	for i := t - 1; i > 0; i-- {
@@ -736,9 +1082,12 @@ func bdptMISWeight(
 		ratio := remapBDPTPDF(cameras[i].PDFRevArea) / remapBDPTPDF(cameras[i].PDFFwdArea)
 		ratio *= bdptStrategySampleCount(alternativeS, alternativeT) / bdptStrategySampleCount(currentS, currentT)
 		ratioSquared *= ratio * ratio
-		if !cameras[i].SampledDelta && !cameras[i-1].SampledDelta && bdptStrategyValid(alternativeS, alternativeT) {
+		if !cameras[i].SampledDelta && !cameras[i-1].SampledDelta && strategyValid(alternativeS, alternativeT) {
 			sum += ratioSquared
 		}
+		if i > 1 {
+			sum += ratioSquared * mergeTerm(&cameras[i-1], cameras[i-1].PDFRevArea)
+		}
 		currentS, currentT = alternativeS, alternativeT
 	}
 
@@ -750,15 +1099,18 @@ func bdptMISWeight(
 		ratio *= bdptStrategySampleCount(alternativeS, alternativeT) / bdptStrategySampleCount(currentS, currentT)
 		ratioSquared *= ratio * ratio
 		deltaPrevious := i > 0 && lights[i-1].SampledDelta
-		if !lights[i].SampledDelta && !deltaPrevious && bdptStrategyValid(alternativeS, alternativeT) {
+		if !lights[i].SampledDelta && !deltaPrevious && strategyValid(alternativeS, alternativeT) {
 			sum += ratioSquared
 		}
+		if i > 0 {
+			sum += ratioSquared * mergeTerm(&lights[i], lights[i].PDFFwdArea)
+		}
 		currentS, currentT = alternativeS, alternativeT
 	}
 	if math.IsNaN(sum) || math.IsInf(sum, 0) || sum < 0 {
 		return 0
 	}
-	return 1 / (1 + sum)
+	return current / (1 + sum)
 }
 
 func bdptStrategyValid(s, t int) bool {
@@ -804,6 +1156,17 @@ func bdptVertexPDF(source, previous, next *bdptVertex, renderCamera camera.Bidir
 		}
 		wo := source.emissionLocal(toNext)
 		pdfDirection = source.Object.Material.Emission.PDFDirection(source.Context, wo)
+	case bdptVertexDelta:
+		return bdptDeltaEmissionPDF(source, next)
+	case bdptVertexMedium:
+		if source.Phase == nil || previous == nil {
+			return 0
+		}
+		toPrevious := directionBetween(source.Point, previous.Point)
+		if toPrevious == nil {
+			return 0
+		}
+		pdfDirection = source.Phase.PDF(-mat.Dot(toPrevious, toNext))
 	case bdptVertexSurface:
 		if source.Object == nil || source.Object.Material == nil || !source.Object.Material.HasSurface() || previous == nil {
 			return 0
@@ -822,18 +1185,27 @@ func bdptVertexPDF(source, previous, next *bdptVertex, renderCamera camera.Bidir
 }
 
 func bdptLightOriginPDF(state *bdptSceneState, lightVertex *bdptVertex) float64 {
-	if state == nil || lightVertex == nil || lightVertex.Object == nil || state.TotalLightWeight <= 0 {
+	if state != nil && lightVertex != nil && lightVertex.Kind == bdptVertexInfinite {
+		return state.Lights.InfinitePDF(lightVertex.LightDirection)
+	}
+	if state == nil || lightVertex == nil || lightVertex.Object == nil {
 		return 0
 	}
-	for _, light := range state.Lights {
-		if light.Object == lightVertex.Object && light.Area > 0 {
-			return (light.Weight / state.TotalLightWeight) / light.Area
-		}
+	index, ok := state.Lights.Index(lightVertex.Object)
+	if !ok || state.Lights.Lights[index].Area <= 0 {
+		return 0
 	}
-	return 0
+	return state.Lights.PMF(nil, index) / state.Lights.Lights[index].Area
 }
 
-func bdptLightEmissionPDF(lightVertex, next *bdptVertex) float64 {
+func bdptLightEmissionPDF(state *bdptSceneState, lightVertex, next *bdptVertex) float64 {
+	if state != nil && lightVertex != nil && next != nil && lightVertex.Kind == bdptVertexInfinite {
+		pdf := infinitePositionPDF(state.Lights)
+		if next.Kind == bdptVertexSurface {
+			pdf *= absDot(next.GeometricNormal, lightVertex.LightDirection)
+		}
+		return pdf
+	}
 	if lightVertex == nil || next == nil || lightVertex.GeometricNormal == nil ||
 		lightVertex.Object == nil || lightVertex.Object.Material == nil ||
 		!lightVertex.Object.Material.HasEmission() {
@@ -848,10 +1220,31 @@ func bdptLightEmissionPDF(lightVertex, next *bdptVertex) float64 {
 	return convertBDPTDensity(pdfDirection, lightVertex, next)
 }
 
+// bdptDeltaEmissionPDF is the area density with which the delta light of
+// root sends a light subpath to next.
+func bdptDeltaEmissionPDF(root, next *bdptVertex) float64 {
+	if root.DeltaLight == nil || next == nil {
+		return 0
+	}
+	pdf := root.DeltaLight.EmissionPDF(next.Point, root.Scene)
+	if next.Kind == bdptVertexSurface {
+		toNext := directionBetween(root.Point, next.Point)
+		if toNext == nil {
+			return 0
+		}
+		pdf *= absDot(next.GeometricNormal, toNext)
+	}
+	return pdf
+}
+
 func convertBDPTDensity(pdfDirection float64, source, destination *bdptVertex) float64 {
-	if pdfDirection <= 0 || !isFinitePDF(pdfDirection) || source == nil || destination == nil {
+	if pdfDirection <= 0 || !isFinitePDF(pdfDirection) || source == nil || destination == nil ||
+		destination.Kind == bdptVertexDelta {
 		return 0
 	}
+	if destination.Kind == bdptVertexInfinite {
+		return pdfDirection
+	}
 	direction := directionBetween(source.Point, destination.Point)
 	if direction == nil {
 		return 0
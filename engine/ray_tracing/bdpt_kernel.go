@@ -2,7 +2,6 @@ package ray_tracing
 
 import (
 	"fmt"
-	"math/rand/v2"
 
 	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/optics"
@@ -12,6 +11,7 @@ import (
 // pixel other than the camera pixel selected for the remaining strategies.
 type bdptPreparedState struct {
 	scene        *bdptSceneState
+	filter       *camera.Filter
 	activeMask   []bool
 	activePixels []int
 	width        int
@@ -20,6 +20,12 @@ type bdptPreparedState struct {
 	totalWork    int64
 }
 
+// bdptKernel traces one camera and one light subpath per work item and
+// connects them. The light subpath starts at an emitter selected by power
+// alone: it is shared by every connection strategy, so there is no single
+// shading point to select from, and the MIS weights need the endpoint's
+// density for strategies that reach the emitter from the camera side, where
+// the light subpath was never traced.
 type bdptKernel struct {
 	prepared *bdptPreparedState
 }
@@ -28,10 +34,21 @@ func (k *bdptKernel) Prepare(context *RenderContext) error {
 	if k == nil || context == nil {
 		return fmt.Errorf("BDPT kernel or render context is nil")
 	}
-	scene, err := context.Handler.prepareBDPT(context.Camera, context.ObjectTree)
+	state, err := prepareBDPTWork(context)
 	if err != nil {
 		return err
 	}
+	k.prepared = state
+	return nil
+}
+
+// prepareBDPTWork validates the scene and resolves the active pixels and the
+// global work count shared by the BDPT and PSSMLT kernels.
+func prepareBDPTWork(context *RenderContext) (*bdptPreparedState, error) {
+	scene, err := context.Handler.prepareBDPT(context.Camera, context.ObjectTree)
+	if err != nil {
+		return nil, err
+	}
 	film := context.Camera.GetFilm()
 	shape := film.Shape
 	mask := make([]bool, shapeElementCount(shape))
@@ -51,6 +68,7 @@ func (k *bdptKernel) Prepare(context *RenderContext) error {
 
 	state := &bdptPreparedState{
 		scene:        scene,
+		filter:       context.Handler.pixelFilter(),
 		activeMask:   mask,
 		activePixels: activePixels,
 		width:        shape[0],
@@ -61,8 +79,7 @@ func (k *bdptKernel) Prepare(context *RenderContext) error {
 		state.wavelengths = int64(context.Handler.wavelengthSampleCount())
 	}
 	state.totalWork = context.Samples * int64(len(activePixels)) * state.wavelengths
-	k.prepared = state
-	return nil
+	return state, nil
 }
 
 func (k *bdptKernel) WorkCount(*RenderContext) int64 {
@@ -80,20 +97,27 @@ func (k *bdptKernel) TraceSample(context *RenderContext, workIndex int64) []Film
 	pixel := k.prepared.activePixels[int(workIndex%int64(activeCount))]
 	coords := context.Camera.GetFilm().SpectralBins[0].GetCoordinates(pixel)
 
-	u := rand.Float64()
+	// Work walks all active pixels before the next sample, so the quotient is
+	// the pixel's sample index.
+	sampleIndex := workIndex / int64(activeCount)
+	samples := k.prepared.totalWork / int64(activeCount)
+	random := context.Handler.newBDPTSamplers(filmWidth(context.Camera.GetFilm()), samples).start(pixel, sampleIndex)
+	u := wavelengthUniform(random.Camera)
 	if context.Handler.SpectrumMode == optics.SpectrumModeSampledWavelengths {
-		stratum := (workIndex / int64(activeCount)) % k.prepared.wavelengths
+		stratum := sampleIndex % k.prepared.wavelengths
 		u = (float64(stratum) + u) / float64(k.prepared.wavelengths)
 	}
 	wavelength := context.Handler.wavelengthSampler().Sample(u)
 	wavelengthNM, wavelengthPDF := wavelength.LambdaNM, wavelength.PDF
+	raster, weight := filteredRaster(k.prepared.filter, random.Camera, coords...)
 	local, remoteSplats := context.Handler.traceBidirectionalPrepared(
 		k.prepared.scene,
+		random,
 		context.Camera,
 		context.ObjectTree,
 		wavelengthNM,
 		wavelengthPDF,
-		coords...,
+		raster,
 	)
 
 	splats := make([]FilmSplat, 0, 1+len(remoteSplats))
@@ -103,31 +127,34 @@ func (k *bdptKernel) TraceSample(context *RenderContext, workIndex int64) []Film
 			// Global work samples camera pixels uniformly. Multiplying the local
 			// estimator by the active pixel count restores per-pixel spp after
 			// splatSceneIntegrator divides by totalWork.
-			Value: local.MulScalar(float64(activeCount)),
+			Value: local.MulScalar(float64(activeCount) * weight),
 		})
 	}
 
 	for _, splat := range remoteSplats {
-		splats = append(splats, filterBDPTSplat(
-			splat, k.prepared.width, k.prepared.height, k.prepared.activeMask,
+		splats = append(splats, filterSplat(
+			k.prepared.filter, splat, splat.projection.Position,
+			k.prepared.width, k.prepared.height, k.prepared.activeMask,
 		)...)
 	}
 	return splats
 }
 
-func filterBDPTSplat(splat FilmSplat, width, height int, activeMask []bool) []FilmSplat {
-	if width <= 0 || height <= 0 || len(activeMask) != width*height {
-		return nil
-	}
-	if len(splat.projection.Position) < 2 {
-		return nil
-	}
-	pixel, ok := camera.PixelIndex(
-		splat.projection.Position[0], splat.projection.Position[1], width, height,
-	)
-	if !ok || !activeMask[pixel] {
+// filterSplat spreads a splat at a continuous raster position over the active
+// pixels whose reconstruction filter covers it, scaled by each pixel's filter
+// weight. The box filter keeps the splat whole on the nearest pixel.
+func filterSplat(filter *camera.Filter, splat FilmSplat, raster []float64, width, height int, activeMask []bool) []FilmSplat {
+	if width <= 0 || height <= 0 || len(activeMask) != width*height || len(raster) < 2 {
 		return nil
 	}
-	splat.Pixel = pixel
-	return []FilmSplat{splat}
+	var splats []FilmSplat
+	filter.Splat(raster[0], raster[1], width, height, func(pixel int, weight float64) {
+		if activeMask[pixel] {
+			kept := splat
+			kept.Pixel = pixel
+			kept.Value = splat.Value.MulScalar(weight)
+			splats = append(splats, kept)
+		}
+	})
+	return splats
 }
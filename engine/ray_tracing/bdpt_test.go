@@ -3,11 +3,15 @@ package ray_tracing
 import (
 	"math"
 	randv2 "math/rand/v2"
+	"sync"
 	"testing"
 
+	"github.com/Algo2147483647/ray/engine/event"
 	"github.com/Algo2147483647/ray/engine/maths"
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/light"
 	"github.com/Algo2147483647/ray/engine/model/material"
 	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
 	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
@@ -15,13 +19,18 @@ import (
 	"github.com/Algo2147483647/ray/engine/model/material/medium"
 	"github.com/Algo2147483647/ray/engine/model/object"
 	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
 	"github.com/Algo2147483647/ray/engine/model/shape"
 	"gonum.org/v1/gonum/mat"
 )
 
 type nonBidirectionalCamera struct{ camera.Camera }
 
-func (nonBidirectionalCamera) GenerateRay(ray *optics.Ray, _ ...int) *optics.Ray {
+func (c nonBidirectionalCamera) GenerateRay(ray *optics.Ray, _ sampler.Sampler, _ ...int) *optics.Ray {
+	return c.GenerateRayAt(ray, nil)
+}
+
+func (nonBidirectionalCamera) GenerateRayAt(ray *optics.Ray, _ []float64) *optics.Ray {
 	ray.Init()
 	ray.Origin.CloneFromVec(mat.NewVecDense(3, []float64{0, 0, 0}))
 	ray.Direction.CloneFromVec(mat.NewVecDense(3, []float64{0, 0, 1}))
@@ -101,7 +110,7 @@ func TestBDPTPreflightAcceptsFiniteCylinderAreaLight(t *testing.T) {
 	if err != nil {
 		t.Fatalf("finite cylinder area light should pass BDPT preflight: %v", err)
 	}
-	if len(state.Lights) != 1 || state.TotalLightWeight <= 0 {
+	if state.Lights.Len() != 1 || state.Lights.Power <= 0 {
 		t.Fatalf("finite cylinder was not collected as an area light: %+v", state)
 	}
 }
@@ -122,9 +131,20 @@ func TestBDPTFallbackUsesPathDriverOnlyWhenExplicit(t *testing.T) {
 
 	camera3D.Film.Reset()
 	h.BDPTFallbackPolicy = BDPTFallbackPath
+	var lock sync.Mutex
+	var events []event.Event
+	h.Events = event.SinkFunc(func(e event.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+	})
 	if err := h.TraceScene(camera3D, tree, 1); err != nil {
 		t.Fatalf("explicit path fallback failed: %v", err)
 	}
+	if len(events) == 0 || events[0].Kind != event.KindFallback || events[0].Message != h.LastFallbackReason ||
+		events[len(events)-1].Kind != event.KindProgressEnd || events[len(events)-1].Completed != 1 {
+		t.Fatalf("fallback render reported %+v", events)
+	}
 	if h.LastRequestedIntegrator != IntegratorBDPT || h.LastEffectiveIntegrator != IntegratorPathTracing || h.LastFallbackReason == "" {
 		t.Fatalf("incorrect fallback metadata: requested=%q effective=%q reason=%q",
 			h.LastRequestedIntegrator, h.LastEffectiveIntegrator, h.LastFallbackReason)
@@ -155,7 +175,7 @@ func TestBDPTPreflightAcceptsIdealTransmissionAndMediumBoundary(t *testing.T) {
 	}
 }
 
-func TestBDPTPreflightRejectsParticipatingMediumScattering(t *testing.T) {
+func TestBDPTPreflightAcceptsParticipatingMediumScattering(t *testing.T) {
 	registry := medium.NewRegistry()
 	fogID, err := registry.RegisterHomogeneousWithCoefficients(
 		"fog", medium.NewConstant(1.1), nil, medium.ConstantCoefficient(0.1),
@@ -173,8 +193,8 @@ func TestBDPTPreflightRejectsParticipatingMediumScattering(t *testing.T) {
 		MediumBoundary: medium.NewBoundary(medium.MediumAir, fogID),
 	})
 	tree.Build()
-	if _, err := newBDPTTestHandler().prepareBDPT(newBDPTTestCamera(t, 1, 1), tree); err == nil {
-		t.Fatal("participating-medium scattering must remain behind the capability gate")
+	if _, err := newBDPTTestHandler().prepareBDPT(newBDPTTestCamera(t, 1, 1), tree); err != nil {
+		t.Fatalf("participating-medium scattering should be supported: %v", err)
 	}
 }
 
@@ -238,7 +258,7 @@ func TestBDPTRandomWalkTransmitsAndAbsorbsInsideMedium(t *testing.T) {
 		Beta: optics.ConstantSpectrum(1), PDFFwdArea: 1, Connectible: true,
 		MediumStack: medium.NewStack(medium.MediumAir),
 	}}
-	path = h.randomWalk(tree, ray, optics.ConstantSpectrum(1), 1, bxdf.TransportRadiance, 3, path)
+	path = h.randomWalk(globalUniform{}, tree, ray, optics.ConstantSpectrum(1), 1, bxdf.TransportRadiance, 3, path)
 	if len(path) < 3 {
 		t.Fatalf("camera path did not cross both interfaces: %d vertices", len(path))
 	}
@@ -255,6 +275,53 @@ func TestBDPTRandomWalkTransmitsAndAbsorbsInsideMedium(t *testing.T) {
 	}
 }
 
+func TestBDPTRandomWalkScattersInsideFog(t *testing.T) {
+	registry := medium.NewRegistry()
+	fogID, err := registry.RegisterHomogeneousWithPhase(
+		"fog", medium.NewConstant(1), nil, medium.ConstantCoefficient(6), medium.NewHenyeyGreenstein(0.3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := (&object.ObjectTree{Media: registry}).Build()
+	lightObject := addTestAreaLight(tree, []float64{0, 0, 3})
+	tree.Build()
+
+	h := newBDPTTestHandler()
+	ray := &optics.Ray{Geometry: h.SceneGeometry}
+	ray.Init()
+	ray.MediumStack.Reset(fogID)
+	ray.Direction.CopyVec(mat.NewVecDense(3, []float64{0, 0, 1}))
+	path := []bdptVertex{{
+		Kind: bdptVertexCamera, Point: mat.NewVecDense(3, []float64{0, 0, 0}),
+		Beta: optics.ConstantSpectrum(1), PDFFwdArea: 1, Connectible: true,
+		MediumStack: medium.NewStack(fogID),
+	}}
+	path = h.randomWalk(globalUniform{}, tree, ray, optics.ConstantSpectrum(1), 1, bxdf.TransportRadiance, 3, path)
+	if len(path) < 2 || path[1].Kind != bdptVertexMedium {
+		t.Fatalf("expected a medium vertex inside unbounded fog, got %d vertices", len(path))
+	}
+	vertex := &path[1]
+	if vertex.PDFFwdArea <= 0 || vertex.Phase == nil || !vertex.Connectible {
+		t.Fatalf("medium vertex is not connectible: pdf=%g phase=%v", vertex.PDFFwdArea, vertex.Phase)
+	}
+	if len(path) > 2 && path[0].PDFRevArea <= 0 {
+		t.Fatalf("reverse density toward the camera was not recorded")
+	}
+
+	lightNormal := mat.NewVecDense(3, []float64{0, 0, -1})
+	lightFrame, _ := maths.NewFrameFromNormal(lightNormal)
+	light := bdptVertex{
+		Kind: bdptVertexLight, Point: mat.NewVecDense(3, []float64{0, 0, 3}), GeometricNormal: lightNormal,
+		Frame: lightFrame, Object: lightObject, Beta: optics.ConstantSpectrum(1), PDFFwdArea: 1,
+		Connectible: true, MediumStack: medium.NewStack(fogID),
+	}
+	contribution, ok := h.connectBDPTVertices(globalUniform{}, tree, &light, vertex)
+	if !ok || contribution.RGBChannel(0) <= 0 {
+		t.Fatalf("light connection to medium vertex failed: ok=%v value=%+v", ok, contribution)
+	}
+}
+
 func TestBDPTBuildsRealCameraAndLightEndpoints(t *testing.T) {
 	tree := (&object.ObjectTree{}).Build()
 	tree.AddObject(&object.Object{
@@ -273,8 +340,8 @@ func TestBDPTBuildsRealCameraAndLightEndpoints(t *testing.T) {
 	if err != nil {
 		t.Fatalf("preflight: %v", err)
 	}
-	cameraPath := h.buildCameraSubpath(cam, tree, 0, 0, 0, 0)
-	lightPath := h.buildLightSubpath(tree, state.Lights, state.TotalLightWeight, 0, 0)
+	cameraPath := h.buildCameraSubpath(globalUniform{}, cam, tree, 0, 0, []float64{0, 0})
+	lightPath := h.buildLightSubpath(globalUniform{}, tree, state.Lights, 0, 0)
 	if len(cameraPath) < 2 || cameraPath[0].Kind != bdptVertexCamera || cameraPath[0].Camera == nil {
 		t.Fatalf("camera path has no real endpoint: %+v", cameraPath)
 	}
@@ -396,10 +463,9 @@ func TestBDPTCachedMISWeightsSamePathAsPartition(t *testing.T) {
 	cameraSurface := surface
 	lightSurface.PDFFwdArea = bdptVertexPDF(&lightRoot, nil, &lightSurface, cam)
 	cameraSurface.PDFFwdArea = bdptVertexPDF(&cameraRoot, nil, &cameraSurface, cam)
-	state := &bdptSceneState{
-		Lights:           []areaLight{{Object: lightObject, Sampler: lightObject.Shape.(shape.SurfaceSampler), Area: math.Pi, Weight: math.Pi}},
-		TotalLightWeight: math.Pi,
-	}
+	state := &bdptSceneState{Lights: object.NewLightTree([]object.Light{
+		{Object: lightObject, Sampler: lightObject.Shape.(shape.SurfaceSampler), Area: math.Pi, Power: math.Pi},
+	})}
 	w12 := bdptMISWeight(state, cam, []bdptVertex{lightRoot}, []bdptVertex{cameraRoot, cameraSurface}, 1, 2)
 	w21 := bdptMISWeight(state, cam, []bdptVertex{lightRoot, lightSurface}, []bdptVertex{cameraRoot}, 2, 1)
 	cameraLight := lightRoot
@@ -477,10 +543,9 @@ func TestBDPTMISPartitionAcrossRandomizedDirectPaths(t *testing.T) {
 		cameraLight := lightRoot
 		cameraLight.Kind = bdptVertexSurface
 		cameraLight.PDFFwdArea = bdptVertexPDF(&cameraSurface, &cameraRoot, &cameraLight, cam)
-		state := &bdptSceneState{
-			Lights:           []areaLight{{Object: lightObject, Sampler: lightShape, Area: area, Weight: area}},
-			TotalLightWeight: area,
-		}
+		state := &bdptSceneState{Lights: object.NewLightTree([]object.Light{
+			{Object: lightObject, Sampler: lightShape, Area: area, Power: area},
+		})}
 
 		weights := []float64{
 			bdptMISWeight(state, cam, nil, []bdptVertex{cameraRoot, cameraSurface, cameraLight}, 0, 3),
@@ -548,7 +613,7 @@ func TestBDPTUnifiedT1ProjectsPathAfterDeltaEvent(t *testing.T) {
 	lightPath := []bdptVertex{root, delta, screen}
 	cameraPath := []bdptVertex{cameraRoot}
 	value, _, isSplat, ok := newBDPTTestHandler().connectBDPTStrategy(
-		&bdptSceneState{}, cam, nil, lightPath, cameraPath, 3, 1,
+		globalUniform{}, &bdptSceneState{}, cam, nil, lightPath, cameraPath, 3, 1,
 	)
 	if !ok || !isSplat || !validSpectrum(value) {
 		t.Fatalf("unified t=1 strategy failed after Delta event: value=%+v splat=%v ok=%v", value, isSplat, ok)
@@ -583,7 +648,7 @@ func TestBDPTReconstructionFilterDoesNotRenormalizeAtCrop(t *testing.T) {
 	for i := range fullMask {
 		fullMask[i] = true
 	}
-	full := filterBDPTSplat(splat, 4, 4, fullMask)
+	full := filterSplat(camera.BoxFilter(), splat, splat.projection.Position, 4, 4, fullMask)
 	if len(full) != 1 {
 		t.Fatalf("box-filtered splat count = %d, want 1", len(full))
 	}
@@ -597,7 +662,7 @@ func TestBDPTReconstructionFilterDoesNotRenormalizeAtCrop(t *testing.T) {
 
 	cropMask := make([]bool, 16)
 	cropMask[2*4+1] = true
-	cropped := filterBDPTSplat(splat, 4, 4, cropMask)
+	cropped := filterSplat(camera.BoxFilter(), splat, splat.projection.Position, 4, 4, cropMask)
 	if len(cropped) != 1 {
 		t.Fatalf("cropped splat count = %d, want 1", len(cropped))
 	}
@@ -606,28 +671,205 @@ func TestBDPTReconstructionFilterDoesNotRenormalizeAtCrop(t *testing.T) {
 	}
 	cropMask[2*4+1] = false
 	cropMask[1*4+1] = true
-	if got := filterBDPTSplat(splat, 4, 4, cropMask); len(got) != 0 {
+	if got := filterSplat(camera.BoxFilter(), splat, splat.projection.Position, 4, 4, cropMask); len(got) != 0 {
 		t.Fatalf("splat outside active crop was redistributed: %+v", got)
 	}
+
+	// A wider filter spreads the splat, and a crop keeps only the share of
+	// its active pixels.
+	gaussian, err := camera.NewFilter(camera.FilterGaussian, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spread := filterSplat(gaussian, splat, splat.projection.Position, 4, 4, fullMask)
+	if len(spread) < 4 {
+		t.Fatalf("Gaussian splat reached %d pixels, want a neighborhood", len(spread))
+	}
+	want := 8 * gaussian.Evaluate(1.25-1, 1.75-1)
+	cropped = filterSplat(gaussian, splat, splat.projection.Position, 4, 4, cropMask)
+	if len(cropped) != 1 || math.Abs(cropped[0].Value.RGBChannel(0)-want) > 1e-12 {
+		t.Fatalf("Gaussian crop = %+v, want one splat of %g", cropped, want)
+	}
 }
 
-func TestCollectAreaLightsUsesPowerWeightedDistribution(t *testing.T) {
+func TestBDPTMISPartitionForInfiniteLightPath(t *testing.T) {
+	cam := newBDPTTestCamera(t, 4, 4)
+	state := &bdptSceneState{Lights: object.NewLightTree(nil)}
+	state.Lights.Infinite = []light.Infinite{
+		light.NewConstantSky(spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1))),
+	}
+	state.Lights.SceneRadius = 3
+
+	surfaceObject := &object.Object{Material: &material.Material{
+		Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.8))),
+	}}
+	surfaceNormal := mat.NewVecDense(3, []float64{0, 0, -1})
+	surfaceFrame, _ := maths.NewFrameFromNormal(surfaceNormal)
+	surface := bdptVertex{
+		Kind: bdptVertexSurface, Point: mat.NewVecDense(3, []float64{0.1, 0, 2}),
+		GeometricNormal: surfaceNormal, Frame: surfaceFrame, Object: surfaceObject, Connectible: true,
+	}
+	surface.WoLocal = surfaceFrame.WorldToLocal(directionBetween(surface.Point, cam.Endpoint()))
+	toLight := mat.NewVecDense(3, []float64{0.3, -0.2, -1})
+	toLight.ScaleVec(1/mat.Norm(toLight, 2), toLight)
+	lightPoint := mat.VecDenseCopyOf(surface.Point)
+	lightPoint.AddScaledVec(lightPoint, 10, toLight)
+
+	cameraRoot := bdptVertex{Kind: bdptVertexCamera, Point: cam.Endpoint(), PDFFwdArea: 1, Connectible: true, Camera: cam}
+	cameraSurface := surface
+	cameraSurface.PDFFwdArea = bdptVertexPDF(&cameraRoot, nil, &cameraSurface, cam)
+	escaped := bdptVertex{
+		Kind: bdptVertexInfinite, Point: lightPoint, LightDirection: toLight,
+		PDFFwdArea: bdptVertexPDF(&cameraSurface, &cameraRoot, &bdptVertex{Kind: bdptVertexInfinite, Point: lightPoint}, cam),
+	}
+	lightRoot := escaped
+	lightRoot.PDFFwdArea = state.Lights.InfinitePDF(toLight)
+	lightSurface := surface
+	lightSurface.PDFFwdArea = infinitePositionPDF(state.Lights) * absDot(surfaceNormal, toLight)
+
+	w03 := bdptMISWeight(state, cam, nil, []bdptVertex{cameraRoot, cameraSurface, escaped}, 0, 3)
+	w21 := bdptMISWeight(state, cam, []bdptVertex{lightRoot, lightSurface}, []bdptVertex{cameraRoot}, 2, 1)
+	if w03 <= 0 || w21 <= 0 || math.Abs(w03+w21-1) > 1e-10 {
+		t.Fatalf("infinite-light MIS weights = [%g %g], sum=%g", w03, w21, w03+w21)
+	}
+}
+
+// renderLitPlane renders a Lambert triangle lit by the lights addLights puts
+// in the scene, seen from above, and returns the film's total spectral energy.
+func renderLitPlane(t *testing.T, kind IntegratorKind, samples int64, nextEvent bool, addLights func(*object.ObjectTree)) float64 {
+	t.Helper()
 	tree := &object.ObjectTree{}
-	for index, radiance := range []float64{1, 10} {
-		tree.AddObject(&object.Object{
-			Shape: shape.NewCircle(
-				mat.NewVecDense(3, []float64{float64(index), 0, 1}),
-				mat.NewVecDense(3, []float64{0, 0, 1}),
-				1,
-			),
-			Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(radiance))},
-		})
+	tree.AddObject(&object.Object{
+		Shape: shape.NewTriangle(
+			mat.NewVecDense(3, []float64{-1, -1, 0}),
+			mat.NewVecDense(3, []float64{1, -1, 0}),
+			mat.NewVecDense(3, []float64{0, 1.2, 0}),
+		),
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.5)))},
+	})
+	addLights(tree)
+	tree.Build()
+
+	renderCamera := newBDPTTestCamera(t, 2, 2)
+	renderCamera.Position = mat.NewVecDense(3, []float64{0, 0, 1})
+	renderCamera.Coordinates = []*mat.VecDense{
+		mat.NewVecDense(3, []float64{0, 0, -1}),
+		mat.NewVecDense(3, []float64{1, 0, 0}),
+		mat.NewVecDense(3, []float64{0, 1, 0}),
+	}
+	renderCamera.FieldOfViews = []float64{30, 30}
+	renderCamera.Film.InitSpectralBins(8, optics.WavelengthMin, optics.WavelengthMax)
+	if err := renderCamera.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	h := newBDPTTestHandler()
+	h.IntegratorKind = kind
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.MaxRayLevel = 1
+	h.ThreadNum = 1
+	h.NextEventEstimation = nextEvent
+	if err := h.TraceScene(renderCamera, tree, samples); err != nil {
+		t.Fatalf("%s render: %v", kind, err)
+	}
+	energy := 0.0
+	for _, plane := range renderCamera.Film.SpectralBins {
+		for _, value := range plane.Data {
+			energy += value
+		}
 	}
-	lights, totalWeight := collectAreaLights(tree)
-	if len(lights) != 2 || totalWeight <= 0 {
-		t.Fatalf("invalid light distribution: count=%d weight=%g", len(lights), totalWeight)
+	return energy
+}
+
+func TestBDPTAndLightTracingMatchPathTracingUnderSky(t *testing.T) {
+	addSky := func(tree *object.ObjectTree) {
+		tree.InfiniteLights = []light.Infinite{
+			light.NewConstantSky(spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1))),
+		}
+	}
+	path := renderLitPlane(t, IntegratorPathTracing, 1024, true, addSky)
+	if path <= 0 {
+		t.Fatal("path tracing gathered no sky light")
+	}
+	for _, kind := range []IntegratorKind{IntegratorBDPT, IntegratorLightTracing} {
+		got := renderLitPlane(t, kind, 4096, true, addSky)
+		if relative := math.Abs(got-path) / path; relative > 0.08 {
+			t.Fatalf("%s energy %g differs from path tracing %g by %.1f%%", kind, got, path, 100*relative)
+		}
 	}
-	if ratio := lights[1].Weight / lights[0].Weight; math.Abs(ratio-10) > 1e-12 {
-		t.Fatalf("power weight ratio = %g, want 10", ratio)
+}
+
+func TestBDPTAndLightTracingMatchPathTracingUnderDeltaLights(t *testing.T) {
+	value := spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1))
+	down := mat.NewVecDense(3, []float64{0, 0, -1})
+	for _, test := range []struct {
+		name  string
+		light light.Delta
+	}{
+		{"point", light.NewPoint(mat.NewVecDense(3, []float64{0.4, 0, 0.5}), value)},
+		{"spot", light.NewSpot(mat.NewVecDense(3, []float64{0, 0, 0.8}), down, value, 35, 20)},
+		{"directional", light.NewDirectional(mat.NewVecDense(3, []float64{0.3, 0, -1}), value)},
+		{"beam", light.NewBeam(mat.NewVecDense(3, []float64{0, 0, 0.9}), down, 0.25, value)},
+	} {
+		addLight := func(tree *object.ObjectTree) { tree.DeltaLights = []light.Delta{test.light} }
+		path := renderLitPlane(t, IntegratorPathTracing, 256, true, addLight)
+		if path <= 0 {
+			t.Fatalf("%s: path tracing gathered no light", test.name)
+		}
+		for _, run := range []struct {
+			kind      IntegratorKind
+			nextEvent bool
+		}{
+			{IntegratorPathTracing, false},
+			{IntegratorBDPT, true},
+			{IntegratorLightTracing, true},
+			{IntegratorVCM, true},
+		} {
+			got := renderLitPlane(t, run.kind, 4096, run.nextEvent, addLight)
+			if relative := math.Abs(got-path) / path; relative > 0.08 {
+				t.Fatalf("%s: %s energy %g differs from path tracing %g by %.1f%%", test.name, run.kind, got, path, 100*relative)
+			}
+		}
+	}
+}
+
+func TestBDPTMISPartitionForDirectionalLightPath(t *testing.T) {
+	cam := newBDPTTestCamera(t, 4, 4)
+	directional := light.NewDirectional(
+		mat.NewVecDense(3, []float64{-0.3, 0.2, 1}), spectrum_parameter.NewRGBParameter(optics.ConstantSpectrum(1)),
+	)
+	state := &bdptSceneState{Lights: object.NewLightTree(nil)}
+	state.Lights.Delta = []light.Delta{directional}
+	state.Lights.SceneRadius = 3
+
+	surfaceObject := &object.Object{Material: &material.Material{
+		Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.8))),
+	}}
+	surfaceNormal := mat.NewVecDense(3, []float64{0, 0, -1})
+	surfaceFrame, _ := maths.NewFrameFromNormal(surfaceNormal)
+	surface := bdptVertex{
+		Kind: bdptVertexSurface, Point: mat.NewVecDense(3, []float64{0.1, 0, 2}),
+		GeometricNormal: surfaceNormal, Frame: surfaceFrame, Object: surfaceObject, Connectible: true,
+	}
+	surface.WoLocal = surfaceFrame.WorldToLocal(directionBetween(surface.Point, cam.Endpoint()))
+
+	cameraRoot := bdptVertex{Kind: bdptVertexCamera, Point: cam.Endpoint(), PDFFwdArea: 1, Connectible: true, Camera: cam}
+	cameraSurface := surface
+	cameraSurface.PDFFwdArea = bdptVertexPDF(&cameraRoot, nil, &cameraSurface, cam)
+	// The light subpath started somewhere on the scene's disk, off the line
+	// that s = 1 connects along.
+	lightRoot := bdptVertex{
+		Kind: bdptVertexDelta, DeltaLight: directional, Scene: state.Lights.Scene(),
+		Point: mat.NewVecDense(3, []float64{1, 1, -1}), PDFFwdArea: 1,
+	}
+	lightSurface := surface
+	lightSurface.PDFFwdArea = bdptDeltaEmissionPDF(&lightRoot, &lightSurface)
+
+	w12 := bdptMISWeight(state, cam, []bdptVertex{lightRoot}, []bdptVertex{cameraRoot, cameraSurface}, 1, 2)
+	lightRoot.Point = mat.VecDenseCopyOf(surface.Point)
+	lightRoot.Point.AddScaledVec(lightRoot.Point, -5, directional.Direction)
+	lightSurface.PDFFwdArea = bdptDeltaEmissionPDF(&lightRoot, &lightSurface)
+	w21 := bdptMISWeight(state, cam, []bdptVertex{lightRoot, lightSurface}, []bdptVertex{cameraRoot}, 2, 1)
+	if w12 <= 0 || w21 <= 0 || math.Abs(w12+w21-1) > 1e-10 {
+		t.Fatalf("directional-light MIS weights = [%g %g], sum=%g", w12, w21, w12+w21)
 	}
 }
@@ -0,0 +1,136 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	rendercamera "github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// diagnosticKernel renders one property of the first surface a camera ray
+// hits instead of light transport. Rays that hit nothing are black. Scalar
+// properties are stored as flat spectra, so Studio shows the raw value as a
+// grey level; colors are uplifted from linear sRGB.
+type diagnosticKernel struct {
+	kind   IntegratorKind
+	filter *rendercamera.Filter
+}
+
+func (k *diagnosticKernel) prepare(context *RenderContext) error {
+	radius := context.Handler.AORadius
+	if radius < 0 || math.IsNaN(radius) || math.IsInf(radius, 0) {
+		return fmt.Errorf("ao radius must be finite and non-negative")
+	}
+	k.filter = context.Handler.pixelFilter()
+	return nil
+}
+
+func (k *diagnosticKernel) sampleSpectral(
+	h *Handler,
+	pixelSampler sampler.Sampler,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	wavelength optics.WavelengthSample,
+	aovs *aovPixel,
+	index ...int,
+) rendercamera.SpectralSample {
+	aovs.startPath()
+	raster, weight := filteredRaster(k.filter, pixelSampler, index...)
+	renderCamera.GenerateRayAt(ray, raster)
+	ray.SetSpectralSample(wavelength)
+	rgb := k.evaluate(h, pixelSampler, objTree, ray, aovs)
+	if aovs.recordsAlbedo() {
+		// The property may have moved the ray, so the albedo restarts from the
+		// same camera ray.
+		renderCamera.GenerateRayAt(ray, raster)
+		ray.SetSpectralSample(wavelength)
+		albedo := 0.0
+		if hit, ok := surfaceHitInGeometry(objTree, ray, ray.G()); ok {
+			albedo = h.firstNonSpecularAlbedo(pixelSampler, objTree, ray, hit)
+		}
+		aovs.addAlbedo(ray, albedo)
+	}
+	value := rgb[0]
+	if rgb[0] != rgb[1] || rgb[1] != rgb[2] {
+		value = optics.NewRGBSpectrum(rgb[0], rgb[1], rgb[2]).RGBPowerAtWavelength(wavelength.LambdaNM)
+	}
+	return rendercamera.SpectralSample{
+		WavelengthNM: wavelength.LambdaNM,
+		Value:        optics.SpectralSampleRadiance(value, ray.WavelengthPDF),
+		Weight:       weight,
+	}
+}
+
+// evaluate is the linear sRGB color of the property along ray. It reports
+// the surface ray hits to aovs.
+func (k *diagnosticKernel) evaluate(h *Handler, rng uniformSource, objTree *object.ObjectTree, ray *optics.Ray, aovs *aovPixel) optics.RGB {
+	g := ray.G()
+	if k.kind == IntegratorBVHHeatmap {
+		var stats object.TraversalStats
+		hit, ok := countSurfaceHitInGeometry(objTree, ray, g, &stats)
+		aovs.surfaceHit(g, ray, hit, ok)
+		return optics.RGB{float64(stats.NodeVisits), float64(stats.ShapeTests), 0}
+	}
+	hit, ok := surfaceHitInGeometry(objTree, ray, g)
+	aovs.surfaceHit(g, ray, hit, ok)
+	if !ok {
+		return optics.RGB{}
+	}
+	switch k.kind {
+	case IntegratorNormals:
+		return normalColor(hit.ShadingNormal)
+	case IntegratorGeometricNormals:
+		return normalColor(hit.GeometricNormal)
+	case IntegratorDepth:
+		depth := hitArcLength(g, ray, hit)
+		return optics.RGB{depth, depth, depth}
+	case IntegratorUV:
+		return optics.RGB{hit.UV[0], hit.UV[1], 0}
+	case IntegratorAO:
+		if h.occludedAround(rng, objTree, ray, hit) {
+			return optics.RGB{}
+		}
+		return optics.RGB{1, 1, 1}
+	default:
+		return optics.RGB{}
+	}
+}
+
+// normalColor maps the first three components of a unit normal from [-1, 1]
+// to [0, 1].
+func normalColor(normal *mat.VecDense) optics.RGB {
+	var rgb optics.RGB
+	if normal == nil {
+		return rgb
+	}
+	for i := range min(len(rgb), normal.Len()) {
+		rgb[i] = (normal.AtVec(i) + 1) / 2
+	}
+	return rgb
+}
+
+// occludedAround traces one cosine-distributed ray from hit into the
+// hemisphere facing the camera ray and reports whether it hits a surface
+// within Handler.AORadius of arc length, or at all when the radius is 0.
+func (h *Handler) occludedAround(rng uniformSource, objTree *object.ObjectTree, ray *optics.Ray, hit *object.SurfaceHit) bool {
+	g := ray.G()
+	frame, ok := maths.NewFrameFromNormalInGeometry(g, hit.Point, hit.ShadingNormal)
+	if !ok {
+		return false
+	}
+	wi := maths.CosineSampleHemisphereND(maths.Sample2D{U: rng.Float64(), V: rng.Float64()}, len(frame.Tangents)+1)
+	ray.Origin.CopyVec(hit.Point)
+	frame.LocalToWorldInto(ray.Direction, wi)
+	g.ProjectTangent(ray.Origin, ray.Direction, ray.Direction)
+	if !normalizeDirectionInGeometry(g, ray.Origin, ray.Direction) {
+		return false
+	}
+	occluder, ok := surfaceHitInGeometry(objTree, ray, g)
+	return ok && (h.AORadius == 0 || hitArcLength(g, ray, occluder) <= h.AORadius)
+}
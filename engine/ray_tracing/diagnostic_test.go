@@ -0,0 +1,67 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+func renderDiagnostic(t *testing.T, kind IntegratorKind, configure func(*Handler)) (*camera.Film, error) {
+	t.Helper()
+	h := newBDPTTestHandler()
+	h.IntegratorKind = kind
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.ThreadNum = 2
+	if configure != nil {
+		configure(h)
+	}
+	renderCamera := newBDPTTestCamera(t, 8, 8)
+	renderCamera.Film.InitSpectralBins(1, optics.WavelengthMin, optics.WavelengthMax)
+	if err := h.TraceScene(renderCamera, newAdaptiveTestScene(), 4); err != nil {
+		return nil, err
+	}
+	return renderCamera.Film, nil
+}
+
+func TestDiagnosticIntegratorsRenderFirstHitProperties(t *testing.T) {
+	center, corner := 4*8+4, 0
+	depth, err := renderDiagnostic(t, IntegratorDepth, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := depth.SpectralBins[0].Data[center]; got < 3 || got > 3.05 {
+		t.Fatalf("center depth = %g, want the disk distance of about 3", got)
+	}
+	if got := depth.SpectralBins[0].Data[corner]; got != 0 {
+		t.Fatalf("corner depth = %g, want 0 for a miss", got)
+	}
+
+	heatmap, err := renderDiagnostic(t, IntegratorBVHHeatmap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := heatmap.SpectralBins[0].Data; got[center] <= 0 || got[center] <= got[corner] {
+		t.Fatalf("heatmap center, corner = %g, %g; want more work where the disk is hit", got[center], got[corner])
+	}
+
+	ao, err := renderDiagnostic(t, IntegratorAO, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pixel, got := range ao.SpectralBins[0].Data {
+		if got < 0 || got > 1+1e-12 || math.IsNaN(got) {
+			t.Fatalf("ao pixel %d = %g, want a visibility in [0, 1]", pixel, got)
+		}
+	}
+	if got := ao.SpectralBins[0].Data[center]; got == 0 {
+		t.Fatal("the open disk should not be fully occluded")
+	}
+}
+
+func TestDiagnosticIntegratorRejectsNegativeAORadius(t *testing.T) {
+	if _, err := renderDiagnostic(t, IntegratorAO, func(h *Handler) { h.AORadius = -1 }); err == nil {
+		t.Fatal("expected a negative ao radius to be rejected")
+	}
+}
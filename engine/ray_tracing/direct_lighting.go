@@ -0,0 +1,337 @@
+package ray_tracing
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// directLighting is the scene-level state used by next-event estimation. It
+// builds the same light tree as BDPT, but selects emitters from it spatially:
+// the selection density depends on the shading point.
+type directLighting struct {
+	Lights *object.LightTree
+}
+
+// pathScatterState describes how the current path segment was generated. An
+// emitter hit is only MIS-weighted when the previous vertex also sampled a
+// light; otherwise the BSDF strategy is the sole estimator of that path.
+type pathScatterState struct {
+	Origin       *mat.VecDense
+	PDF          float64
+	Delta        bool
+	LightSampled bool
+}
+
+// prepareDirectLighting returns nil when next-event estimation is disabled or
+// unsupported. Shadow rays are straight Euclidean segments, so curved scene
+// geometries fall back to pure BSDF sampling.
+func (h *Handler) prepareDirectLighting(tree *object.ObjectTree) *directLighting {
+	if h == nil || !h.NextEventEstimation {
+		return nil
+	}
+	if geometry.Get(h.SceneGeometry).Kind() != geometry.EuclideanKind {
+		return nil
+	}
+	lights := tree.BuildLightTree()
+	if lights.Len() == 0 {
+		return nil
+	}
+	return &directLighting{Lights: lights}
+}
+
+// preparePathLighting is prepareDirectLighting for the path tracer. Paths
+// cannot hit delta lights, so with next-event estimation disabled it still
+// samples them, and only them.
+func (h *Handler) preparePathLighting(tree *object.ObjectTree) *directLighting {
+	if direct := h.prepareDirectLighting(tree); direct != nil || h == nil {
+		return direct
+	}
+	if geometry.Get(h.SceneGeometry).Kind() != geometry.EuclideanKind || tree == nil || len(tree.DeltaLights) == 0 {
+		return nil
+	}
+	lights := object.NewLightTree(nil)
+	lights.Delta = append([]light.Delta(nil), tree.DeltaLights...)
+	return &directLighting{Lights: lights}
+}
+
+func (d *directLighting) shouldSample(ray *optics.Ray, si SurfaceInteraction) bool {
+	if d == nil || ray == nil || ray.WaveLength <= 0 {
+		return false
+	}
+	return !si.Object.Material.Surface.RoughnessInfo(si.Context).IsDelta
+}
+
+// estimate adds one light-sampled contribution at the current surface vertex to
+// ray.Radiance. The ray throughput itself is left untouched. At a guided
+// vertex the path continues with the guided mixture, whose density weighs the
+// light sample against it.
+func (d *directLighting) estimate(rng uniformSource, tree *object.ObjectTree, h *Handler, ray *optics.Ray, si SurfaceInteraction, guided guidedVertex) {
+	d.estimateWith(rng, tree, h, ray, si.Context, func(toLight *mat.VecDense) (optics.Spectrum, float64, medium.MediumID) {
+		f, pdf, mediumID := surfaceLightScatter(ray, si, toLight)
+		return f, guided.mixturePDF(pdf, toLight), mediumID
+	}, func(contribution *optics.Ray, toLight *mat.VecDense) {
+		polarizeAtSurface(contribution, &si, si.Frame.WorldToLocal(toLight))
+	})
+}
+
+// surfaceLightScatter is the lightScatter of a surface vertex.
+func surfaceLightScatter(ray *optics.Ray, si SurfaceInteraction, toLight *mat.VecDense) (optics.Spectrum, float64, medium.MediumID) {
+	wi := si.Frame.WorldToLocal(toLight)
+	f := si.Object.Material.Surface.Eval(si.Context, wi, si.WoLocal)
+	if f.IsZero() {
+		return optics.Spectrum{}, 0, medium.MediumNone
+	}
+	pdf := si.Object.Material.Surface.PDF(si.Context, wi, si.WoLocal)
+	return f.MulScalar(maths.AbsCosTheta(wi)), pdf, directLightingMedium(ray, si, toLight)
+}
+
+// estimateMedium is the in-medium counterpart of estimate: the phase function
+// replaces the BSDF and there is no cosine factor at the scattering point.
+func (d *directLighting) estimateMedium(rng uniformSource, tree *object.ObjectTree, h *Handler, ray *optics.Ray, phase medium.PhaseFunction) {
+	ctx := h.newShadingContext(ray)
+	d.estimateWith(rng, tree, h, ray, ctx, func(toLight *mat.VecDense) (optics.Spectrum, float64, medium.MediumID) {
+		cosTheta := mat.Dot(ray.Direction, toLight)
+		value := phase.Eval(cosTheta)
+		if value <= 0 {
+			return optics.Spectrum{}, 0, medium.MediumNone
+		}
+		return bundleSpectrum(ctx, value), phase.PDF(cosTheta), ray.MediumStack.Current()
+	}, depolarizeInMedium)
+}
+
+// lightScatter evaluates the vertex side of a shadow connection: the
+// cosine-weighted scattering value, the density of sampling the same direction
+// by continuing the path, and the medium the shadow segment travels through.
+type lightScatter func(toLight *mat.VecDense) (optics.Spectrum, float64, medium.MediumID)
+
+// lightPolarization carries contribution, a polarized copy of the path's ray,
+// across the vertex side of a shadow connection towards toLight. A nil
+// lightPolarization leaves the copy as it is.
+type lightPolarization func(contribution *optics.Ray, toLight *mat.VecDense)
+
+func (p lightPolarization) apply(contribution *optics.Ray, toLight *mat.VecDense) {
+	if p != nil && contribution.Polarized {
+		p(contribution, toLight)
+	}
+}
+
+func (d *directLighting) estimateWith(
+	rng uniformSource,
+	tree *object.ObjectTree,
+	h *Handler,
+	ray *optics.Ray,
+	ctx bxdf.ShadingContext,
+	scatter lightScatter,
+	polarization lightPolarization,
+) {
+	index, selectionPDF, ok := sampleLight(rng, d.Lights, ray.Origin)
+	if !ok {
+		return
+	}
+	if infinite, ok := d.Lights.InfiniteLight(index); ok {
+		d.estimateInfinite(rng, tree, ray, ctx, scatter, polarization, infinite)
+		return
+	}
+	if delta, ok := d.Lights.DeltaLight(index); ok {
+		d.estimateDelta(rng, tree, ray, ctx, scatter, polarization, delta, selectionPDF)
+		return
+	}
+	selected := d.Lights.Lights[index]
+	ss, ok := selected.Sampler.SampleSurface(maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
+	if !ok || ss.Point == nil || ss.Point.Len() != ray.Origin.Len() {
+		return
+	}
+	light, ok := h.makeLightEndpoint(selected, selectionPDF, ss, ray.WaveLength, ray.WavelengthPDF)
+	if !ok {
+		return
+	}
+	light.Context.TransportMode = bxdf.TransportRadiance
+	light.Context.WavelengthsNM = ctx.WavelengthsNM
+
+	toLight := directionBetween(ray.Origin, light.Point)
+	if toLight == nil {
+		return
+	}
+	distance2 := squaredDistance(ray.Origin, light.Point)
+	woLight := light.emissionLocal(negated(toLight))
+	cosLight := maths.AbsCosTheta(woLight)
+	if cosLight <= 0 {
+		return
+	}
+	lightPDF := light.PDFFwdArea * distance2 / cosLight
+	if lightPDF <= 0 || !isFinitePDF(lightPDF) {
+		return
+	}
+	emitted := selected.Object.Material.Emission.Eval(light.Context, woLight)
+	if emitted.IsZero() {
+		return
+	}
+	f, scatterPDF, mediumID := scatter(toLight)
+	if f.IsZero() {
+		return
+	}
+	distance := math.Sqrt(distance2)
+	if !visibleSegment(tree, ray.Origin, light.Point, toLight, distance) {
+		return
+	}
+
+	weight := powerHeuristic(lightPDF, scatterPDF)
+	transmittance := segmentTransmittance(rng, getMediumRegistry(tree), mediumID, ray.Origin, toLight, distance, ctx)
+
+	contribution := *ray
+	polarization.apply(&contribution, toLight)
+	applySpectrum(&contribution, f)
+	applySpectrum(&contribution, emitted)
+	transmittance.ApplyToRay(&contribution)
+	scaleRayThroughput(&contribution, weight/lightPDF)
+	gatherRadiance(ray, &contribution)
+}
+
+// estimateInfinite is estimateWith for a selected infinite light. The
+// sampled direction is weighted as if drawn from all infinite lights at once,
+// which matches the radiance that escapeToInfiniteLights collects.
+func (d *directLighting) estimateInfinite(
+	rng uniformSource,
+	tree *object.ObjectTree,
+	ray *optics.Ray,
+	ctx bxdf.ShadingContext,
+	scatter lightScatter,
+	polarization lightPolarization,
+	infinite light.Infinite,
+) {
+	if ray.Origin.Len() != 3 {
+		return
+	}
+	sample, ok := infinite.Sample(ctx, maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
+	if !ok || sample.PDF <= 0 {
+		return
+	}
+	lightPDF := d.Lights.InfinitePDF(sample.Direction)
+	if lightPDF <= 0 || !isFinitePDF(lightPDF) {
+		return
+	}
+	radiance := d.Lights.InfiniteRadiance(ctx, sample.Direction)
+	if radiance.IsZero() {
+		return
+	}
+	f, scatterPDF, mediumID := scatter(sample.Direction)
+	if f.IsZero() || !reachesInfinity(getMediumRegistry(tree), mediumID, ctx) {
+		return
+	}
+	if !visibleSegment(tree, ray.Origin, nil, sample.Direction, math.Inf(1)) {
+		return
+	}
+
+	weight := powerHeuristic(lightPDF, scatterPDF)
+	transmittance := segmentTransmittance(rng, getMediumRegistry(tree), mediumID, ray.Origin, sample.Direction, math.Inf(1), ctx)
+
+	contribution := *ray
+	polarization.apply(&contribution, sample.Direction)
+	applySpectrum(&contribution, f)
+	applySpectrum(&contribution, radiance)
+	transmittance.ApplyToRay(&contribution)
+	scaleRayThroughput(&contribution, weight/lightPDF)
+	gatherRadiance(ray, &contribution)
+}
+
+// estimateDelta is estimateWith for a selected delta light. Light sampling
+// is the only strategy that reaches it, so the contribution is not weighted.
+func (d *directLighting) estimateDelta(
+	rng uniformSource,
+	tree *object.ObjectTree,
+	ray *optics.Ray,
+	ctx bxdf.ShadingContext,
+	scatter lightScatter,
+	polarization lightPolarization,
+	delta light.Delta,
+	selectionPDF float64,
+) {
+	if ray.Origin.Len() != 3 {
+		return
+	}
+	incident, ok := delta.Incident(ctx, ray.Origin)
+	if !ok || incident.Irradiance.IsZero() {
+		return
+	}
+	f, _, mediumID := scatter(incident.Direction)
+	if f.IsZero() {
+		return
+	}
+	registry := getMediumRegistry(tree)
+	if math.IsInf(incident.Distance, 1) && !reachesInfinity(registry, mediumID, ctx) {
+		return
+	}
+	if !visibleSegment(tree, ray.Origin, nil, incident.Direction, incident.Distance) {
+		return
+	}
+	transmittance := segmentTransmittance(rng, registry, mediumID, ray.Origin, incident.Direction, incident.Distance, ctx)
+
+	contribution := *ray
+	polarization.apply(&contribution, incident.Direction)
+	applySpectrum(&contribution, f)
+	applySpectrum(&contribution, incident.Irradiance)
+	transmittance.ApplyToRay(&contribution)
+	scaleRayThroughput(&contribution, 1/selectionPDF)
+	gatherRadiance(ray, &contribution)
+}
+
+// emissionWeight is the BSDF-strategy MIS weight of an emitter reached from
+// the vertex described by previous.
+func (d *directLighting) emissionWeight(previous pathScatterState, si SurfaceInteraction) float64 {
+	if d == nil || !previous.LightSampled || previous.Delta || previous.Origin == nil || si.Hit == nil {
+		return 1
+	}
+	index, ok := d.Lights.Index(si.Object)
+	if !ok {
+		return 1
+	}
+	light := d.Lights.Lights[index]
+	cosLight := maths.AbsCosTheta(si.WoEmission)
+	distance2 := squaredDistance(previous.Origin, si.Hit.Point)
+	if light.Area <= 0 || cosLight <= 0 || distance2 <= 0 {
+		return 1
+	}
+	lightPDF := d.Lights.PMF(previous.Origin, index) / light.Area * distance2 / cosLight
+	return powerHeuristic(previous.PDF, lightPDF)
+}
+
+// infiniteWeight is the BSDF-strategy MIS weight of infinite-light radiance
+// collected by a path that escaped in direction after leaving previous.
+func (d *directLighting) infiniteWeight(previous pathScatterState, direction *mat.VecDense) float64 {
+	if d == nil || !previous.LightSampled || previous.Delta {
+		return 1
+	}
+	return powerHeuristic(previous.PDF, d.Lights.InfinitePDF(direction))
+}
+
+// directLightingMedium picks the side of a medium boundary the shadow ray
+// leaves through. Crossing the surface is only possible for transmissive
+// BSDFs; the shadow ray itself never changes the ray's medium stack.
+func directLightingMedium(ray *optics.Ray, si SurfaceInteraction, toLight *mat.VecDense) medium.MediumID {
+	if si.Hit == nil || si.Hit.GeometricNormal == nil || !si.Object.MediumBoundary.Active() {
+		return ray.MediumStack.Current()
+	}
+	if mat.Dot(ray.Direction, si.Hit.GeometricNormal)*mat.Dot(toLight, si.Hit.GeometricNormal) > 0 {
+		return si.Context.TransmitMedium
+	}
+	return si.Context.IncidentMedium
+}
+
+func powerHeuristic(pdf, otherPDF float64) float64 {
+	if pdf <= 0 || !isFinitePDF(pdf) {
+		return 0
+	}
+	if otherPDF <= 0 || !isFinitePDF(otherPDF) {
+		return 1
+	}
+	a, b := pdf*pdf, otherPDF*otherPDF
+	return a / (a + b)
+}
@@ -0,0 +1,166 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"github.com/Algo2147483647/ray/engine/utils/hdrio"
+	"gonum.org/v1/gonum/mat"
+)
+
+func newDirectLightingTestScene() *object.ObjectTree {
+	tree := (&object.ObjectTree{}).Build()
+	tree.AddObject(&object.Object{
+		Shape: shape.NewTriangle(
+			mat.NewVecDense(3, []float64{-20, -20, 0}),
+			mat.NewVecDense(3, []float64{20, -20, 0}),
+			mat.NewVecDense(3, []float64{0, 20, 0}),
+		),
+		Material: &material.Material{
+			Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.5))),
+		},
+	})
+	addTestAreaLight(tree, []float64{0, 0, 1})
+	tree.Build()
+	return tree
+}
+
+func meanDirectLightingRadiance(h *Handler, tree *object.ObjectTree, samples int) float64 {
+	return meanDirectLightingRadianceIn(h, tree, medium.MediumAir, samples)
+}
+
+func meanDirectLightingRadianceIn(h *Handler, tree *object.ObjectTree, mediumID medium.MediumID, samples int) float64 {
+	kernel := newPathTracingKernel(h, tree)
+	sum := 0.0
+	for range samples {
+		ray := &optics.Ray{Geometry: h.SceneGeometry}
+		ray.Init()
+		ray.MediumStack.Reset(mediumID)
+		ray.Origin.CopyVec(mat.NewVecDense(3, []float64{0.1, 0, 0.5}))
+		ray.Direction.CopyVec(mat.NewVecDense(3, []float64{0, 0, -1}))
+		ray.SetSpectralWavelength(550)
+		h.traceRay(globalUniform{}, tree, ray, 0, kernel.direct, pathScatterState{})
+		sum += ray.Radiance + optics.SpectralRayToScalar(ray)
+	}
+	return sum / float64(samples)
+}
+
+func TestNextEventEstimationMatchesBSDFSamplingMean(t *testing.T) {
+	tree := newDirectLightingTestScene()
+	h := NewHandler()
+	h.SceneGeometry = geometry.Euclidean()
+	h.MaxRayLevel = 2
+
+	withLightSampling := meanDirectLightingRadiance(h, tree, 20000)
+	h.NextEventEstimation = false
+	bsdfOnly := meanDirectLightingRadiance(h, tree, 200000)
+
+	if withLightSampling <= 0 {
+		t.Fatalf("next-event estimation gathered no radiance")
+	}
+	if relative := math.Abs(withLightSampling-bsdfOnly) / bsdfOnly; relative > 0.05 {
+		t.Fatalf("NEE mean %g differs from BSDF-only mean %g by %.1f%%", withLightSampling, bsdfOnly, 100*relative)
+	}
+}
+
+func TestNextEventEstimationWithLightTreeMatchesBSDFSamplingMean(t *testing.T) {
+	tree := newDirectLightingTestScene()
+	for _, center := range [][]float64{{1.5, 0, 1}, {-1, 1, 0.8}, {0, -2, 1.5}, {6, 6, 1}} {
+		addTestAreaLight(tree, center)
+	}
+	tree.Build()
+	h := NewHandler()
+	h.SceneGeometry = geometry.Euclidean()
+	h.MaxRayLevel = 2
+
+	withLightSampling := meanDirectLightingRadiance(h, tree, 20000)
+	h.NextEventEstimation = false
+	bsdfOnly := meanDirectLightingRadiance(h, tree, 200000)
+
+	if relative := math.Abs(withLightSampling-bsdfOnly) / bsdfOnly; relative > 0.05 {
+		t.Fatalf("NEE mean %g differs from BSDF-only mean %g by %.1f%%", withLightSampling, bsdfOnly, 100*relative)
+	}
+}
+
+func TestNextEventEstimationWithEnvironmentMatchesBSDFSamplingMean(t *testing.T) {
+	tree := newDirectLightingTestScene()
+	image := &hdrio.Image{Width: 16, Height: 8, Pixels: make([]float32, 3*16*8)}
+	for i := range image.Pixels {
+		image.Pixels[i] = 0.2
+	}
+	for _, texel := range []int{2*16 + 5, 2*16 + 6, 3*16 + 5} {
+		copy(image.Pixels[3*texel:], []float32{8, 6, 4})
+	}
+	tree.InfiniteLights = []light.Infinite{light.NewEnvironmentMap(image, 1)}
+	h := NewHandler()
+	h.SceneGeometry = geometry.Euclidean()
+	h.MaxRayLevel = 2
+
+	withLightSampling := meanDirectLightingRadiance(h, tree, 20000)
+	h.NextEventEstimation = false
+	bsdfOnly := meanDirectLightingRadiance(h, tree, 200000)
+
+	if relative := math.Abs(withLightSampling-bsdfOnly) / bsdfOnly; relative > 0.05 {
+		t.Fatalf("NEE mean %g differs from BSDF-only mean %g by %.1f%%", withLightSampling, bsdfOnly, 100*relative)
+	}
+}
+
+func TestNextEventEstimationInFogMatchesPhaseSamplingMean(t *testing.T) {
+	tree := newDirectLightingTestScene()
+	registry := medium.NewRegistry()
+	fogID, err := registry.RegisterHomogeneousWithPhase(
+		"fog", medium.NewConstant(1), nil, medium.ConstantCoefficient(0.8), medium.NewHenyeyGreenstein(0.4),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Media = registry
+	h := NewHandler()
+	h.SceneGeometry = geometry.Euclidean()
+	h.MaxRayLevel = 2
+
+	withLightSampling := meanDirectLightingRadianceIn(h, tree, fogID, 20000)
+	h.NextEventEstimation = false
+	phaseOnly := meanDirectLightingRadianceIn(h, tree, fogID, 200000)
+
+	if withLightSampling <= 0 {
+		t.Fatalf("next-event estimation in fog gathered no radiance")
+	}
+	if relative := math.Abs(withLightSampling-phaseOnly) / phaseOnly; relative > 0.05 {
+		t.Fatalf("NEE mean %g differs from phase-sampling mean %g by %.1f%%", withLightSampling, phaseOnly, 100*relative)
+	}
+}
+
+func TestDirectLightingDisabledOutsideEuclideanGeometry(t *testing.T) {
+	tree := newDirectLightingTestScene()
+	h := NewHandler()
+	h.SceneGeometry = geometry.Klein()
+	if h.prepareDirectLighting(tree) != nil {
+		t.Fatal("expected Klein geometry to fall back to BSDF sampling")
+	}
+	h.SceneGeometry = geometry.Euclidean()
+	if h.prepareDirectLighting(tree) == nil {
+		t.Fatal("expected Euclidean scene with an area light to enable next-event estimation")
+	}
+}
+
+func TestPowerHeuristicBalancesStrategies(t *testing.T) {
+	if got := powerHeuristic(1, 1); math.Abs(got-0.5) > 1e-12 {
+		t.Fatalf("equal densities weight = %g, want 0.5", got)
+	}
+	if got := powerHeuristic(2, 0); got != 1 {
+		t.Fatalf("weight against an impossible strategy = %g, want 1", got)
+	}
+	if got := powerHeuristic(1, 3) + powerHeuristic(3, 1); math.Abs(got-1) > 1e-12 {
+		t.Fatalf("power heuristic weights sum to %g, want 1", got)
+	}
+}
@@ -0,0 +1,89 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/light"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/optics/spectrum_parameter"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+// renderPlaneUnderSky renders a plane of surface facing the camera under a
+// sky of radiance sky and returns the Film's spectral bins summed over its
+// pixels.
+func renderPlaneUnderSky(t *testing.T, mode optics.SpectrumMode, surface bsdf.BSDF, sky optics.SpectralParameter) []float64 {
+	t.Helper()
+	tree := (&object.ObjectTree{}).Build()
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, -1}), B: 2},
+		Material: &material.Material{Surface: surface},
+	})
+	tree.InfiniteLights = []light.Infinite{light.NewConstantSky(sky)}
+	tree.Build()
+
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = mode
+	h.MaxRayLevel = 2
+	renderCamera := newBDPTTestCamera(t, 2, 2)
+	renderCamera.Film.InitSpectralBins(6, 400, 700)
+	if err := h.TraceScene(renderCamera, tree, 4096); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	bins := make([]float64, len(renderCamera.Film.SpectralBins))
+	for i, bin := range renderCamera.Film.SpectralBins {
+		for _, value := range bin.Data {
+			bins[i] += value
+		}
+	}
+	return bins
+}
+
+func TestFluorescentSurfaceGlowsAtLongerWavelengthsUnderShortWavelengthLight(t *testing.T) {
+	// Excitation between 400 and 450 nm re-emits 0.5 between 550 and 650 nm.
+	matrix, err := bxdf.NewReradiationMatrix([]float64{400, 450}, []float64{550, 650}, [][]float64{{0.01, 0.01}, {0.01, 0.01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fluorescent := bsdf.NewSingle(bxdf.NewFluorescentParameter(nil, matrix))
+	violet := spectrum_parameter.NewSampledParameter([]float64{380, 460, 460.001, 750}, []float64{1, 1, 0, 0})
+	// A white sky on a diffuse surface reflecting 0.5 in the same band gives
+	// the same spectrum.
+	band := spectrum_parameter.NewSampledParameter([]float64{549.999, 550, 650, 650.001}, []float64{0, 0.5, 0.5, 0})
+	diffuse := bsdf.NewSingle(bxdf.NewLambertParameter(band))
+	white := spectrum_parameter.NewConstantParameter(1)
+
+	for _, mode := range []optics.SpectrumMode{optics.SpectrumModeHeroWavelength, optics.SpectrumModeSampledWavelengths} {
+		got := renderPlaneUnderSky(t, mode, fluorescent, violet)
+		want := renderPlaneUnderSky(t, mode, diffuse, white)
+		total := 0.0
+		for _, value := range want {
+			total += value
+		}
+		if total <= 0 {
+			t.Fatalf("mode %d: reference render is black", mode)
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 0.03*total {
+				t.Fatalf("mode %d: fluorescent bins %v, want %v", mode, got, want)
+			}
+		}
+	}
+}
+
+func TestBDPTRejectsFluorescentSurface(t *testing.T) {
+	matrix, err := bxdf.NewReradiationMatrix([]float64{400, 450}, []float64{550, 650}, [][]float64{{0.01, 0.01}, {0.01, 0.01}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateBDPTSurface(bsdf.NewSingle(bxdf.NewFluorescentParameter(nil, matrix))); err == nil {
+		t.Fatal("expected BDPT to reject a wavelength-shifting surface")
+	}
+}
@@ -1,7 +1,10 @@
 package ray_tracing
 
 import (
+	"github.com/Algo2147483647/ray/engine/event"
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	"github.com/Algo2147483647/ray/engine/utils"
 	"gonum.org/v1/gonum/mat"
@@ -10,22 +13,44 @@ import (
 )
 
 type Handler struct {
-	IntegratorKind          IntegratorKind           `json:"integrator"`
-	MaxRayLevel             int64                    `json:"max_ray_level"`
-	RussianRouletteDepth    int64                    `json:"russian_roulette_depth"`
-	MaxArc                  float64                  `json:"max_arc"` // total geodesic distance budget per ray (0 ⇒ unbounded)
-	SceneGeometry           geometry.Geometry        `json:"-"`
-	ThreadNum               int                      `json:"thread_num"`
-	BlockCols               int                      `json:"block_cols"`
-	BlockRows               int                      `json:"block_rows"`
-	SpectrumMode            optics.SpectrumMode      `json:"spectrum_mode"`
-	WavelengthSamples       int                      `json:"wavelength_samples"`
-	WavelengthSampler       optics.WavelengthSampler `json:"-"`
-	BDPTFallbackPolicy      BDPTFallbackPolicy       `json:"bdpt_fallback_policy,omitempty"`
-	LastRequestedIntegrator IntegratorKind           `json:"-"`
-	LastEffectiveIntegrator IntegratorKind           `json:"-"`
-	LastFallbackReason      string                   `json:"-"`
-	RayPool                 sync.Pool                `json:"ray_pool"`
+	IntegratorKind             IntegratorKind           `json:"integrator"`
+	MaxRayLevel                int64                    `json:"max_ray_level"`
+	RussianRouletteDepth       int64                    `json:"russian_roulette_depth"`
+	MaxArc                     float64                  `json:"max_arc"` // total geodesic distance budget per ray (0 ⇒ unbounded)
+	Seed                       uint64                   `json:"seed"`
+	SamplerKind                sampler.Kind             `json:"sampler,omitempty"`       // "" ⇒ independent
+	Filter                     camera.FilterKind        `json:"filter,omitempty"`        // "" ⇒ box
+	FilterRadius               float64                  `json:"filter_radius,omitempty"` // 0 ⇒ the filter's default
+	AOVs                       []camera.AOVKind         `json:"aovs,omitempty"`          // channels the pixel driver records next to radiance
+	AORadius                   float64                  `json:"ao_radius,omitempty"`     // ambient-occlusion reach in arc length (0 ⇒ unbounded)
+	NextEventEstimation        bool                     `json:"next_event_estimation"`
+	AdaptiveRelativeError      float64                  `json:"adaptive_relative_error"` // 0 ⇒ every pixel takes the camera samples
+	AdaptiveMinSamples         int64                    `json:"adaptive_min_samples"`    // 0 ⇒ min(16, max)
+	AdaptiveMaxSamples         int64                    `json:"adaptive_max_samples"`    // 0 ⇒ the camera samples
+	PathGuiding                bool                     `json:"path_guiding,omitempty"`
+	PathGuidingTrainingSamples int64                    `json:"path_guiding_training_samples,omitempty"` // 0 ⇒ a quarter of the camera samples, at least 1
+	Polarized                  bool                     `json:"polarized,omitempty"`
+	SceneGeometry              geometry.Geometry        `json:"-"`
+	ThreadNum                  int                      `json:"thread_num"`
+	BlockCols                  int                      `json:"block_cols"`
+	BlockRows                  int                      `json:"block_rows"`
+	SpectrumMode               optics.SpectrumMode      `json:"spectrum_mode"`
+	WavelengthSamples          int                      `json:"wavelength_samples"`
+	WavelengthSampler          optics.WavelengthSampler `json:"-"`
+	BDPTFallbackPolicy         BDPTFallbackPolicy       `json:"bdpt_fallback_policy,omitempty"`
+	SPPMPhotonsPerPass         int64                    `json:"sppm_photons_per_pass"` // 0 ⇒ one photon per active pixel
+	SPPMInitialRadius          float64                  `json:"sppm_initial_radius"`   // 0 ⇒ derived from the first pass
+	PSSMLTSeed                 uint64                   `json:"pssmlt_seed"`
+	PSSMLTChains               int64                    `json:"pssmlt_chains"`                 // 0 ⇒ 1000, capped at the mutation count
+	PSSMLTBootstrapSamples     int64                    `json:"pssmlt_bootstrap_samples"`      // 0 ⇒ 100000
+	PSSMLTLargeStepProbability float64                  `json:"pssmlt_large_step_probability"` // 0 ⇒ 0.3
+	VCMInitialRadius           float64                  `json:"vcm_initial_radius"`            // 0 ⇒ derived from the first iteration
+	TimeBudget                 float64                  `json:"time_budget,omitempty"`         // seconds to keep adding sample passes (0 ⇒ one pass)
+	Events                     event.Sink               `json:"-"`                             // progress, fallbacks and warnings (nil ⇒ none)
+	LastRequestedIntegrator    IntegratorKind           `json:"-"`
+	LastEffectiveIntegrator    IntegratorKind           `json:"-"`
+	LastFallbackReason         string                   `json:"-"`
+	RayPool                    sync.Pool                `json:"ray_pool"`
 }
 
 func NewHandler() *Handler {
@@ -34,6 +59,7 @@ func NewHandler() *Handler {
 		MaxRayLevel:          64,
 		RussianRouletteDepth: 3,
 		MaxArc:               0, // 0 means unbounded; set by scene factory for spherical scenes.
+		NextEventEstimation:  true,
 		ThreadNum:            runtime.NumCPU(),
 		BlockCols:            8,
 		BlockRows:            8,
@@ -57,6 +83,17 @@ func (h *Handler) wavelengthSampler() optics.WavelengthSampler {
 	return optics.NewUniformWavelengthSampler()
 }
 
+// pixelFilter is the configured reconstruction filter. Settings TraceScene
+// rejects fall back to the box filter, so the single-sample entry points
+// stay usable.
+func (h *Handler) pixelFilter() *camera.Filter {
+	filter, err := camera.NewFilter(h.Filter, h.FilterRadius)
+	if err != nil {
+		return camera.BoxFilter()
+	}
+	return filter
+}
+
 func (h *Handler) EffectiveSampleCount(cameraSamples int64) int64 {
 	if cameraSamples <= 0 {
 		return 0
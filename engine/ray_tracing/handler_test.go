@@ -36,3 +36,9 @@ func TestNewHandlerUsesRussianRouletteFriendlyDefaults(t *testing.T) {
 		t.Fatalf("expected hard max ray level to be a safety cap, got %d", handler.MaxRayLevel)
 	}
 }
+
+func TestNewHandlerReportsNothingUntilGivenASink(t *testing.T) {
+	if handler := NewHandler(); handler.Events != nil {
+		t.Fatalf("expected no default event sink, got %T", handler.Events)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/optics"
+	"slices"
 	"sync"
 	"sync/atomic"
 )
@@ -15,6 +16,17 @@ const (
 	IntegratorPathTracing  IntegratorKind = "path"
 	IntegratorBDPT         IntegratorKind = "bdpt"
 	IntegratorLightTracing IntegratorKind = "light_tracing"
+	IntegratorSPPM         IntegratorKind = "sppm"
+	IntegratorPSSMLT       IntegratorKind = "pssmlt"
+	IntegratorVCM          IntegratorKind = "vcm"
+
+	// Diagnostic integrators render a property of the first surface hit.
+	IntegratorNormals          IntegratorKind = "normals"
+	IntegratorGeometricNormals IntegratorKind = "geometric_normals"
+	IntegratorDepth            IntegratorKind = "depth"
+	IntegratorUV               IntegratorKind = "uv"
+	IntegratorAO               IntegratorKind = "ao"
+	IntegratorBVHHeatmap       IntegratorKind = "bvh_heatmap"
 )
 
 // ParseIntegratorKind accepts canonical names and compatibility aliases at the
@@ -26,6 +38,15 @@ func ParseIntegratorKind(value string) (IntegratorKind, error) {
 		return IntegratorBDPT, nil
 	case string(IntegratorLightTracing), "light_trace":
 		return IntegratorLightTracing, nil
+	case string(IntegratorSPPM):
+		return IntegratorSPPM, nil
+	case string(IntegratorPSSMLT):
+		return IntegratorPSSMLT, nil
+	case string(IntegratorVCM):
+		return IntegratorVCM, nil
+	case string(IntegratorNormals), string(IntegratorGeometricNormals), string(IntegratorDepth),
+		string(IntegratorUV), string(IntegratorAO), string(IntegratorBVHHeatmap):
+		return IntegratorKind(value), nil
 	default:
 		return "", fmt.Errorf("unsupported integrator %q", value)
 	}
@@ -48,11 +69,20 @@ func NewSceneIntegrator(kind IntegratorKind, handler *Handler) (SceneIntegrator,
 
 	switch kind {
 	case IntegratorPathTracing:
-		return &pixelSceneIntegrator{kernel: pathTracingKernel{}}, nil
+		return &pixelSceneIntegrator{kernel: &pathTracingKernel{}}, nil
 	case IntegratorBDPT:
 		return &splatSceneIntegrator{kernel: &bdptKernel{}}, nil
 	case IntegratorLightTracing:
 		return &splatSceneIntegrator{kernel: &lightTracingKernel{}}, nil
+	case IntegratorSPPM:
+		return &sppmSceneIntegrator{}, nil
+	case IntegratorPSSMLT:
+		return &splatSceneIntegrator{kernel: &pssmltKernel{}}, nil
+	case IntegratorVCM:
+		return &vcmSceneIntegrator{}, nil
+	case IntegratorNormals, IntegratorGeometricNormals, IntegratorDepth, IntegratorUV,
+		IntegratorAO, IntegratorBVHHeatmap:
+		return &pixelSceneIntegrator{kernel: &diagnosticKernel{kind: kind}}, nil
 	default:
 		return nil, fmt.Errorf("unsupported integrator %q", kind)
 	}
@@ -64,7 +94,12 @@ type pixelSceneIntegrator struct {
 
 func (d *pixelSceneIntegrator) ConcurrentFilmWrites() bool { return false }
 
+// EffectiveSampleCount is the per-pixel maximum under adaptive sampling; the
+// Film then records the actual count of every pixel in PixelSamples.
 func (d *pixelSceneIntegrator) EffectiveSampleCount(context *RenderContext) int64 {
+	if context.adaptive != nil {
+		return context.Handler.EffectiveSampleCount(context.adaptive.maxSamples)
+	}
 	return context.Handler.EffectiveSampleCount(context.Samples)
 }
 
@@ -75,6 +110,22 @@ func (d *pixelSceneIntegrator) Run(context *RenderContext) error {
 	if context.Samples == 0 {
 		return nil
 	}
+	if err := d.kernel.prepare(context); err != nil {
+		return err
+	}
+	bounds, adaptive, err := context.Handler.resolveAdaptiveSampling(context.Samples)
+	if err != nil {
+		return err
+	}
+	if adaptive {
+		context.adaptive = &bounds
+		// Pixels outside the windows keep a zero count.
+		context.Camera.GetFilm().PixelSamples = make([]int64, context.Camera.GetFilm().ElementCount())
+	}
+	if !context.Handler.pixelFilter().UnitWeights() {
+		context.Camera.GetFilm().FilterWeights = make([]float64, context.Camera.GetFilm().ElementCount())
+	}
+	context.aovs = context.Handler.newAOVRecorder(context)
 
 	tiles, totalPixels := buildTileCoordinatesForWindows(
 		context.Camera.GetFilm().Shape,
@@ -82,7 +133,7 @@ func (d *pixelSceneIntegrator) Run(context *RenderContext) error {
 		context.Handler.BlockCols,
 		context.Handler.BlockRows,
 	)
-	progress := newProgressReporter("Rendering", "pixels", totalPixels)
+	progress := context.Handler.newProgressReporter("Rendering", "pixels", totalPixels)
 	defer progress.Close()
 
 	workerCount := context.Handler.ThreadNum
@@ -90,24 +141,52 @@ func (d *pixelSceneIntegrator) Run(context *RenderContext) error {
 		workerCount = 1
 	}
 	var nextTile atomic.Int64
+	traced := make([]bool, len(tiles))
 	var workers sync.WaitGroup
 	workers.Add(workerCount)
 	for range workerCount {
 		go func() {
 			defer workers.Done()
-			for {
+			for !context.done() {
 				index := int(nextTile.Add(1) - 1)
 				if index >= len(tiles) {
 					return
 				}
 				progress.Add(context.Handler.traceTile(d.kernel, context, tiles[index]))
+				traced[index] = true
 			}
 		}()
 	}
 	workers.Wait()
+	if slices.Contains(traced, false) {
+		d.stop(context, tiles, traced)
+	}
 	return nil
 }
 
+// stop keeps the tiles traced before the render was stopped. Their pixels
+// took every sample, so the Film records a per-pixel count that is zero
+// elsewhere; adaptive Films already count the samples of every pixel. The
+// Film sample count is then the largest count of any pixel.
+func (d *pixelSceneIntegrator) stop(context *RenderContext, tiles []TileCoordinate, traced []bool) {
+	film := context.Camera.GetFilm()
+	if film.PixelSamples == nil {
+		samples := d.EffectiveSampleCount(context)
+		film.PixelSamples = make([]int64, film.ElementCount())
+		for index, tile := range tiles {
+			if !traced[index] {
+				continue
+			}
+			for y := tile.Y0; y < tile.Y1; y++ {
+				for x := tile.X0; x < tile.X1; x++ {
+					film.PixelSamples[tile.pixelIndex(x, y, film.Shape)] = samples
+				}
+			}
+		}
+	}
+	context.stop(slices.Max(film.PixelSamples))
+}
+
 // FilmSplat is an unnormalized contribution produced by a global path sample.
 type FilmSplat struct {
 	Pixel         int
@@ -123,13 +202,20 @@ type splatKernel interface {
 	TraceSample(*RenderContext, int64) []FilmSplat
 }
 
+// splatRoundKernel is a splatKernel whose work items build on earlier ones.
+// RoundSize consecutive work items are independent of each other, and the
+// driver finishes every earlier item before it starts a round.
+type splatRoundKernel interface {
+	RoundSize(*RenderContext) int64
+}
+
 type splatSceneIntegrator struct {
 	kernel splatKernel
 }
 
 const splatWorkBatchSize int64 = 64
 
-func (d *splatSceneIntegrator) ConcurrentFilmWrites() bool { return true }
+func (d *splatSceneIntegrator) ConcurrentFilmWrites() bool { return false }
 
 func (d *splatSceneIntegrator) EffectiveSampleCount(context *RenderContext) int64 {
 	return context.Samples
@@ -147,39 +233,125 @@ func (d *splatSceneIntegrator) Run(context *RenderContext) error {
 		return nil
 	}
 
-	progress := newProgressReporter("Splat tracing", "paths", totalWork)
+	progress := context.Handler.newProgressReporter("Splat tracing", "paths", totalWork)
 	defer progress.Close()
-	workerCount := context.Handler.ThreadNum
+	// Kernels walk their work one camera sample at a time, so every pass of
+	// passWork items is a complete sample of the image and a render stopped
+	// between passes is a valid render of fewer samples.
+	passes := context.Samples
+	if passes <= 0 || totalWork%passes != 0 {
+		passes = 1
+	}
+	passWork := totalWork / passes
+	round := d.roundSize(context, passWork)
+	for pass := range passes {
+		if context.done() {
+			d.stop(context, pass, passes)
+			return nil
+		}
+		for start, end := pass*passWork, (pass+1)*passWork; start < end; start += round {
+			runOrderedParallelWork(context.Handler.ThreadNum, min(round, end-start), splatWorkBatchSize,
+				func(workIndex int64) []FilmSplat {
+					return d.kernel.TraceSample(context, start+workIndex)
+				},
+				func(splats []FilmSplat) {
+					for _, splat := range splats {
+						d.accumulate(context, splat, totalWork)
+					}
+					progress.Add(1)
+				},
+			)
+		}
+	}
+	return nil
+}
+
+// roundSize is the number of work items the kernel lets run at once.
+func (d *splatSceneIntegrator) roundSize(context *RenderContext, passWork int64) int64 {
+	if kernel, ok := d.kernel.(splatRoundKernel); ok {
+		if round := kernel.RoundSize(context); round > 0 {
+			return min(round, passWork)
+		}
+	}
+	return passWork
+}
+
+// stop rescales the Film of a render stopped after traced of passes sample
+// passes, whose splats were weighted for all of them.
+func (d *splatSceneIntegrator) stop(context *RenderContext, traced, passes int64) {
+	samples := context.Samples * traced / passes
+	scale := 0.0
+	if traced > 0 {
+		scale = float64(passes) / float64(traced)
+	}
+	for _, bin := range context.Camera.GetFilm().SpectralBins {
+		for i := range bin.Data {
+			bin.Data[i] *= scale
+		}
+	}
+	context.stop(samples)
+}
+
+func (d *splatSceneIntegrator) accumulate(context *RenderContext, splat FilmSplat, totalWork int64) {
+	scale := 1 / float64(totalWork)
+	value := optics.SpectralSampleRadiance(splat.Value.Sample(0), splat.WavelengthPDF) * scale
+	context.Accumulator.AddSpectral(splat.Pixel, splat.WavelengthNM, value)
+}
+
+// runParallelWork calls work for every index below total, handing out
+// batches of consecutive indices to workerCount goroutines.
+func runParallelWork(workerCount int, total, batchSize int64, work func(int64)) {
+	runParallelBatches(workerCount, total, batchSize, func(start, end int64) {
+		for i := start; i < end; i++ {
+			work(i)
+		}
+	})
+}
+
+// runOrderedParallelWork is runParallelWork for results that are summed in
+// floating point. commit receives the result of every index in index order,
+// one call at a time, so the sums do not depend on the worker count or on
+// which batch finished first.
+func runOrderedParallelWork[T any](workerCount int, total, batchSize int64, work func(int64) T, commit func(T)) {
+	var lock sync.Mutex
+	pending := make(map[int64][]T)
+	next := int64(0)
+	runParallelBatches(workerCount, total, batchSize, func(start, end int64) {
+		results := make([]T, 0, end-start)
+		for i := start; i < end; i++ {
+			results = append(results, work(i))
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		pending[start] = results
+		for batch, ok := pending[next]; ok; batch, ok = pending[next] {
+			delete(pending, next)
+			for _, result := range batch {
+				commit(result)
+			}
+			next += int64(len(batch))
+		}
+	})
+}
+
+func runParallelBatches(workerCount int, total, batchSize int64, batch func(start, end int64)) {
 	if workerCount <= 0 {
 		workerCount = 1
 	}
-	var nextWork atomic.Int64
+	var next atomic.Int64
 	var workers sync.WaitGroup
 	workers.Add(workerCount)
 	for range workerCount {
 		go func() {
 			defer workers.Done()
 			for {
-				batchStart := nextWork.Add(splatWorkBatchSize) - splatWorkBatchSize
-				if batchStart >= totalWork {
+				start := next.Add(batchSize) - batchSize
+				if start >= total {
 					return
 				}
-				batchEnd := min(batchStart+splatWorkBatchSize, totalWork)
-				for workIndex := batchStart; workIndex < batchEnd; workIndex++ {
-					for _, splat := range d.kernel.TraceSample(context, workIndex) {
-						d.accumulate(context, splat, totalWork)
-					}
-				}
-				progress.Add(batchEnd - batchStart)
+				batch(start, min(start+batchSize, total))
 			}
 		}()
 	}
 	workers.Wait()
-	return nil
-}
-
-func (d *splatSceneIntegrator) accumulate(context *RenderContext, splat FilmSplat, totalWork int64) {
-	scale := 1 / float64(totalWork)
-	value := optics.SpectralSampleRadiance(splat.Value.Sample(0), splat.WavelengthPDF) * scale
-	context.Accumulator.AddSpectral(splat.Pixel, splat.WavelengthNM, value)
 }
@@ -2,7 +2,6 @@ package ray_tracing
 
 import (
 	"fmt"
-	"math/rand/v2"
 
 	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/object"
@@ -13,14 +12,14 @@ import (
 // lightTracingKernel implements the t=1 algorithm while splatSceneIntegrator owns
 // scheduling, synchronization, normalization and progress reporting.
 type lightTracingKernel struct {
-	projective  camera.ProjectiveCamera
-	lights      []areaLight
-	totalWeight float64
-	activeMask  []bool
-	pixelCount  int
-	width       int
-	height      int
-	totalPaths  int64
+	projective camera.ProjectiveCamera
+	filter     *camera.Filter
+	lights     *object.LightTree
+	activeMask []bool
+	pixelCount int
+	width      int
+	height     int
+	totalPaths int64
 }
 
 func (k *lightTracingKernel) Prepare(context *RenderContext) error {
@@ -29,7 +28,11 @@ func (k *lightTracingKernel) Prepare(context *RenderContext) error {
 		return fmt.Errorf("light tracing requires a projective camera, got %T", context.Camera)
 	}
 	k.projective = projective
-	k.lights, k.totalWeight = collectAreaLights(context.ObjectTree)
+	k.filter = context.Handler.pixelFilter()
+	k.lights = context.ObjectTree.BuildLightTree()
+	if err := checkInfiniteLightBounds(k.lights); err != nil {
+		return fmt.Errorf("light tracing %w", err)
+	}
 	film := context.Camera.GetFilm()
 	if len(film.Shape) != 2 {
 		return fmt.Errorf("light tracing requires a 2D Film")
@@ -49,7 +52,7 @@ func (k *lightTracingKernel) Prepare(context *RenderContext) error {
 			film.PixelWindows,
 		)
 	}
-	if len(k.lights) == 0 || k.totalWeight <= 0 || activePixels <= 0 {
+	if k.lights.Len() == 0 || activePixels <= 0 {
 		k.totalPaths = 0
 		return nil
 	}
@@ -61,19 +64,23 @@ func (k *lightTracingKernel) WorkCount(*RenderContext) int64 {
 	return k.totalPaths
 }
 
-func (k *lightTracingKernel) TraceSample(context *RenderContext, _ int64) []FilmSplat {
-	wavelength := context.Handler.wavelengthSampler().Sample(rand.Float64())
+func (k *lightTracingKernel) TraceSample(context *RenderContext, workIndex int64) []FilmSplat {
+	// Light paths belong to no pixel; the work index alone keys the stream.
+	rng := context.Handler.newSampler(samplerDomainLight, 0, k.totalPaths)
+	rng.StartPixelSample(0, workIndex)
+	wavelength := context.Handler.wavelengthSampler().Sample(rng.Float64())
 	wavelengthNM, wavelengthPDF := wavelength.LambdaNM, wavelength.PDF
 	path := context.Handler.buildLightSubpath(
+		rng,
 		context.ObjectTree,
 		k.lights,
-		k.totalWeight,
 		wavelengthNM,
 		wavelengthPDF,
 	)
 	splats := make([]FilmSplat, 0, len(path))
 	for vertexIndex := range path {
 		value, projection, valid := projectLightVertex(
+			rng,
 			k.projective,
 			context.ObjectTree,
 			&path[vertexIndex],
@@ -81,24 +88,24 @@ func (k *lightTracingKernel) TraceSample(context *RenderContext, _ int64) []Film
 		if !valid {
 			continue
 		}
-		pixel, ok := camera.PixelIndex(projection.Position[0], projection.Position[1], k.width, k.height)
-		if !ok || !k.activeMask[pixel] {
-			continue
-		}
-		splats = append(splats, FilmSplat{
-			Pixel: pixel, WavelengthNM: wavelengthNM,
-			WavelengthPDF: wavelengthPDF, Value: value,
-		})
+		splats = append(splats, filterSplat(k.filter, FilmSplat{
+			WavelengthNM: wavelengthNM, WavelengthPDF: wavelengthPDF, Value: value,
+		}, projection.Position, k.width, k.height, k.activeMask)...)
 	}
 	return splats
 }
 
 func projectLightVertex(
+	rng uniformSource,
 	renderCamera camera.ProjectiveCamera,
 	tree *object.ObjectTree,
 	vertex *bdptVertex,
 ) (optics.Spectrum, camera.FilmProjection, bool) {
-	if vertex == nil || vertex.Point == nil || vertex.GeometricNormal == nil || vertex.Object == nil || vertex.Object.Material == nil {
+	if vertex == nil || vertex.Point == nil {
+		return optics.Spectrum{}, camera.FilmProjection{}, false
+	}
+	if vertex.Kind != bdptVertexMedium &&
+		(vertex.GeometricNormal == nil || vertex.Object == nil || vertex.Object.Material == nil) {
 		return optics.Spectrum{}, camera.FilmProjection{}, false
 	}
 	projection, ok := renderCamera.ProjectPoint(vertex.Point)
@@ -111,34 +118,32 @@ func projectLightVertex(
 		return optics.Spectrum{}, camera.FilmProjection{}, false
 	}
 
-	cosCamera := absDot(vertex.GeometricNormal, projection.ToCamera)
-	if cosCamera <= 0 {
-		return optics.Spectrum{}, camera.FilmProjection{}, false
-	}
-	factor := projection.Jacobian * cosCamera
-	transmittance := evaluateSegmentTransmittance(
+	transmittance := segmentTransmittance(
+		rng,
 		getMediumRegistry(tree),
 		bdptSegmentMedium(vertex, projection.ToCamera),
+		vertex.Point,
+		projection.ToCamera,
 		projection.Distance,
 		vertex.Context,
 	)
 
 	if vertex.Kind == bdptVertexLight {
+		cosCamera := absDot(vertex.GeometricNormal, projection.ToCamera)
+		if cosCamera <= 0 {
+			return optics.Spectrum{}, camera.FilmProjection{}, false
+		}
 		wo := vertex.emissionLocal(projection.ToCamera)
 		value := transmittance.ApplyToSpectrum(
 			vertex.Object.Material.Emission.Eval(vertex.Context, wo).Mul(vertex.Beta),
-		).MulScalar(factor)
+		).MulScalar(projection.Jacobian * cosCamera)
 		return value, projection, validSpectrum(value)
 	}
-	if !vertex.Object.Material.HasSurface() || !vertex.Connectible {
-		return optics.Spectrum{}, camera.FilmProjection{}, false
-	}
 
-	wi := vertex.Frame.WorldToLocal(projection.ToCamera)
-	f := vertex.Object.Material.Surface.Eval(vertex.Context, wi, vertex.WoLocal)
-	if f.IsZero() {
+	f, cosCamera, ok := vertex.scatterToward(projection.ToCamera)
+	if !ok || cosCamera <= 0 {
 		return optics.Spectrum{}, camera.FilmProjection{}, false
 	}
-	value := transmittance.ApplyToSpectrum(vertex.Beta.Mul(f)).MulScalar(factor)
+	value := transmittance.ApplyToSpectrum(vertex.Beta.Mul(f)).MulScalar(projection.Jacobian * cosCamera)
 	return value, projection, validSpectrum(value)
 }
@@ -94,13 +94,13 @@ func TestBuildLightSubpathAppliesHomogeneousAbsorptionBeforeVertex(t *testing.T)
 	handler.SceneGeometry = geometry.Euclidean()
 	handler.SpectrumMode = optics.SpectrumModeRGB
 	handler.MaxRayLevel = 1
-	lights, totalArea := collectAreaLights(tree)
-	if len(lights) != 1 {
-		t.Fatalf("area light count = %d, want 1", len(lights))
+	lights := tree.BuildLightTree()
+	if lights.Len() != 1 {
+		t.Fatalf("area light count = %d, want 1", lights.Len())
 	}
 
 	for sample := 0; sample < 32; sample++ {
-		path := handler.buildLightSubpath(tree, lights, totalArea, 0, 0)
+		path := handler.buildLightSubpath(globalUniform{}, tree, lights, 0, 0)
 		if len(path) != 2 {
 			t.Fatalf("light path vertex count = %d, want 2", len(path))
 		}
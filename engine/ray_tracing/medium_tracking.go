@@ -0,0 +1,142 @@
+package ray_tracing
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Heterogeneous media scale unit-density coefficients by a density field.
+// Both estimators below place tentative collisions at one rate shared by every
+// channel: the field's majorant times the largest unit-density extinction, so
+// the null coefficient rate - density*sigma_t is non-negative in all channels.
+
+// deltaTrackMedium samples the first real collision before maxDistance with
+// null-collision delta tracking. The hero channel chooses between absorption,
+// scattering, and null events; every channel is then weighted by the ratio of
+// its path contribution to the density averaged over hero choices, as in the
+// homogeneous sampleMediumEvent. An absorption event returns a zero weight.
+func deltaTrackMedium(
+	rng uniformSource,
+	coefficients mediumCoefficients,
+	density medium.DensityField,
+	origin, direction *mat.VecDense,
+	maxDistance float64,
+) mediumEvent {
+	count := len(coefficients.SigmaT)
+	maxSigmaT := maxChannel(coefficients.SigmaT)
+	weights := make([]float64, count)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if count == 0 || maxSigmaT <= 0 {
+		return mediumEvent{Distance: maxDistance, Weight: coefficients.spectrum(weights)}
+	}
+	hero := 0
+	if !coefficients.Spectral {
+		hero = min(int(rng.Float64()*float64(count)), count-1)
+	}
+
+	point := mat.NewVecDense(origin.Len(), nil)
+	for _, segment := range density.Majorants(origin, direction, maxDistance) {
+		rate := segment.Density * maxSigmaT
+		if rate <= 0 {
+			continue
+		}
+		for t := segment.TMin; ; {
+			t -= math.Log(1-rng.Float64()) / rate
+			if t >= segment.TMax {
+				break
+			}
+			point.AddScaledVec(origin, t, direction)
+			d := density.Density(point)
+			scattering := d * coefficients.SigmaS[hero]
+			absorption := d*coefficients.SigmaT[hero] - scattering
+			u := rng.Float64() * rate
+			switch {
+			case u < scattering:
+				for i := range weights {
+					weights[i] *= d * coefficients.SigmaS[i]
+				}
+				if !normalizeTrackingWeights(weights) {
+					return mediumEvent{Distance: t, Weight: coefficients.spectrum(make([]float64, count))}
+				}
+				return mediumEvent{Scattered: true, Distance: t, Weight: coefficients.spectrum(weights)}
+			case u < scattering+absorption:
+				return mediumEvent{Distance: t, Weight: coefficients.spectrum(make([]float64, count))}
+			}
+			for i := range weights {
+				weights[i] *= rate - d*coefficients.SigmaT[i]
+			}
+			if !normalizeTrackingWeights(weights) {
+				return mediumEvent{Distance: t, Weight: coefficients.spectrum(make([]float64, count))}
+			}
+		}
+	}
+	return mediumEvent{Distance: maxDistance, Weight: coefficients.spectrum(weights)}
+}
+
+// ratioTrackTransmittance is an unbiased per-channel estimate of
+// exp(-integral of density*sigma_t) over [0, distance].
+func ratioTrackTransmittance(
+	rng uniformSource,
+	coefficients mediumCoefficients,
+	density medium.DensityField,
+	origin, direction *mat.VecDense,
+	distance float64,
+) optics.Spectrum {
+	values := make([]float64, len(coefficients.SigmaT))
+	for i := range values {
+		values[i] = 1
+	}
+	maxSigmaT := maxChannel(coefficients.SigmaT)
+	if maxSigmaT <= 0 {
+		return coefficients.spectrum(values)
+	}
+	point := mat.NewVecDense(origin.Len(), nil)
+	for _, segment := range density.Majorants(origin, direction, distance) {
+		rate := segment.Density * maxSigmaT
+		if rate <= 0 {
+			continue
+		}
+		for t := segment.TMin; ; {
+			t -= math.Log(1-rng.Float64()) / rate
+			if t >= segment.TMax {
+				break
+			}
+			point.AddScaledVec(origin, t, direction)
+			d := density.Density(point)
+			for i := range values {
+				values[i] *= 1 - d*coefficients.SigmaT[i]/rate
+			}
+		}
+	}
+	return coefficients.spectrum(values)
+}
+
+// normalizeTrackingWeights rescales the per-channel path contributions to
+// their mean, which is the hero-averaged path density up to a common factor.
+func normalizeTrackingWeights(weights []float64) bool {
+	mean := 0.0
+	for _, weight := range weights {
+		mean += weight
+	}
+	mean /= float64(len(weights))
+	if mean <= 0 || !isFinitePDF(mean) {
+		return false
+	}
+	for i := range weights {
+		weights[i] /= mean
+	}
+	return true
+}
+
+func maxChannel(values []float64) float64 {
+	result := 0.0
+	for _, value := range values {
+		result = math.Max(result, value)
+	}
+	return result
+}
@@ -5,14 +5,19 @@ import (
 
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
 	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
 	"github.com/Algo2147483647/ray/engine/model/material/medium"
 	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
 )
 
 // SegmentTransmittance is the attenuation accumulated while travelling through
 // one homogeneous medium segment. Keeping it as a spectrum lets camera paths,
 // light paths, and shadow connections share the same Beer-Lambert evaluation.
+// The exponent is the extinction sigma_a + sigma_s, so scattering media also
+// attenuate explicit connections by out-scattering.
 type SegmentTransmittance struct {
 	Value    optics.Spectrum
 	Identity bool
@@ -28,37 +33,173 @@ func evaluateSegmentTransmittance(
 		return SegmentTransmittance{Identity: true}
 	}
 
-	sigmaA := media.SigmaA(mediumID, ctx)
-	if sigmaA.HasSamples() {
-		allZero := true
-		values := make([]float64, len(sigmaA.Samples))
-		for i, coefficient := range sigmaA.Samples {
-			allZero = allZero && coefficient == 0
-			values[i] = math.Exp(-coefficient * distance)
+	coefficients := resolveMediumCoefficients(media, mediumID, ctx)
+	allZero := true
+	values := make([]float64, len(coefficients.SigmaT))
+	for i, coefficient := range coefficients.SigmaT {
+		allZero = allZero && coefficient == 0
+		values[i] = math.Exp(-coefficient * distance)
+	}
+	if allZero {
+		return SegmentTransmittance{Identity: true}
+	}
+	return SegmentTransmittance{Value: coefficients.spectrum(values)}
+}
+
+// mediumCoefficients holds sigma_s and sigma_t resolved to transport channels:
+// one value per path wavelength in spectral transport, or three RGB channels.
+// The first spectral channel is the hero wavelength.
+type mediumCoefficients struct {
+	SigmaS   []float64
+	SigmaT   []float64
+	Spectral bool
+}
+
+func resolveMediumCoefficients(media *medium.Registry, mediumID medium.MediumID, ctx bxdf.ShadingContext) mediumCoefficients {
+	sigmaA, spectralA := mediumChannels(media.SigmaA(mediumID, ctx), ctx)
+	sigmaS, spectralS := mediumChannels(media.SigmaS(mediumID, ctx), ctx)
+	if spectralA != spectralS {
+		// Only reachable without path wavelengths: a sampled coefficient next to
+		// an RGB one. Collapse the RGB side to its neutral average.
+		if spectralA {
+			sigmaS = neutralChannels(sigmaS, len(sigmaA))
+		} else {
+			sigmaA = neutralChannels(sigmaA, len(sigmaS))
 		}
-		if allZero {
-			return SegmentTransmittance{Identity: true}
+	}
+	count := max(len(sigmaA), len(sigmaS))
+	result := mediumCoefficients{
+		SigmaS:   make([]float64, count),
+		SigmaT:   make([]float64, count),
+		Spectral: spectralA || spectralS,
+	}
+	for i := range count {
+		a := finiteNonNegative(sampleOrZero(sigmaA, i))
+		s := finiteNonNegative(sampleOrZero(sigmaS, i))
+		result.SigmaS[i] = s
+		result.SigmaT[i] = a + s
+	}
+	return result
+}
+
+func (c mediumCoefficients) Scatters() bool {
+	for _, value := range c.SigmaS {
+		if value > 0 {
+			return true
 		}
-		return SegmentTransmittance{Value: optics.NewSampledSpectrum(values)}
 	}
-	if sigmaA.RGBChannel(0) == 0 && sigmaA.RGBChannel(1) == 0 && sigmaA.RGBChannel(2) == 0 {
-		return SegmentTransmittance{Identity: true}
+	return false
+}
+
+func (c mediumCoefficients) spectrum(values []float64) optics.Spectrum {
+	if c.Spectral {
+		return optics.NewSampledSpectrum(values)
+	}
+	return optics.NewRGBSpectrum(sampleOrZero(values, 0), sampleOrZero(values, 1), sampleOrZero(values, 2))
+}
+
+func mediumChannels(coefficient medium.CoefficientSpectrum, ctx bxdf.ShadingContext) ([]float64, bool) {
+	if coefficient.HasSamples() {
+		return append([]float64(nil), coefficient.Samples...), true
 	}
 	if wavelengths := segmentWavelengths(ctx); len(wavelengths) > 0 {
 		values := make([]float64, len(wavelengths))
 		for i, wavelength := range wavelengths {
-			coefficient := rgbCoefficientAtWavelength(sigmaA, wavelength)
-			values[i] = math.Exp(-coefficient * distance)
+			values[i] = rgbCoefficientAtWavelength(coefficient, wavelength)
 		}
-		return SegmentTransmittance{Value: optics.NewSampledSpectrum(values)}
+		return values, true
+	}
+	return []float64{coefficient.RGBChannel(0), coefficient.RGBChannel(1), coefficient.RGBChannel(2)}, false
+}
+
+func neutralChannels(values []float64, count int) []float64 {
+	average := 0.0
+	for _, value := range values {
+		average += value
+	}
+	if len(values) > 0 {
+		average /= float64(len(values))
+	}
+	result := make([]float64, count)
+	for i := range result {
+		result[i] = average
+	}
+	return result
+}
+
+func sampleOrZero(values []float64, i int) float64 {
+	if i < 0 || i >= len(values) {
+		return 0
 	}
+	return values[i]
+}
 
-	value := optics.NewRGBSpectrum(
-		math.Exp(-sigmaA.RGBChannel(0)*distance),
-		math.Exp(-sigmaA.RGBChannel(1)*distance),
-		math.Exp(-sigmaA.RGBChannel(2)*distance),
-	)
-	return SegmentTransmittance{Value: value}
+// mediumEvent is the outcome of free-flight sampling along one segment. Weight
+// already contains the ratio of transmittance (times sigma_s for a scattering
+// event) to the sampling density, so it multiplies the path throughput as-is.
+type mediumEvent struct {
+	Scattered bool
+	Distance  float64
+	Weight    optics.Spectrum
+}
+
+// sampleMediumEvent samples a free-flight distance from the extinction of one
+// channel and weights every channel with the single-sample MIS density
+// averaged over all channels. With spectral transport the sampling channel is
+// the hero wavelength; RGB transport picks a channel uniformly. maxDistance is
+// the distance to the next surface and may be +Inf for an escaping ray.
+func sampleMediumEvent(
+	coefficients mediumCoefficients,
+	maxDistance float64,
+	uChannel, uDistance float64,
+) mediumEvent {
+	count := len(coefficients.SigmaT)
+	if count == 0 {
+		return mediumEvent{Distance: maxDistance, Weight: optics.ConstantSpectrum(1)}
+	}
+	channel := 0
+	if !coefficients.Spectral {
+		channel = min(int(uChannel*float64(count)), count-1)
+	}
+
+	distance := math.Inf(1)
+	if sigmaT := coefficients.SigmaT[channel]; sigmaT > 0 {
+		distance = -math.Log(1-uDistance) / sigmaT
+	}
+	scattered := distance < maxDistance
+	if !scattered {
+		distance = maxDistance
+	}
+
+	transmittance := make([]float64, count)
+	pdf := 0.0
+	for i, sigmaT := range coefficients.SigmaT {
+		if math.IsInf(distance, 1) {
+			if sigmaT == 0 {
+				transmittance[i] = 1
+			}
+		} else {
+			transmittance[i] = math.Exp(-sigmaT * distance)
+		}
+		if scattered {
+			pdf += sigmaT * transmittance[i]
+		} else {
+			pdf += transmittance[i]
+		}
+	}
+	pdf /= float64(count)
+
+	weights := make([]float64, count)
+	if pdf > 0 && isFinitePDF(pdf) {
+		for i := range weights {
+			if scattered {
+				weights[i] = coefficients.SigmaS[i] * transmittance[i] / pdf
+			} else {
+				weights[i] = transmittance[i] / pdf
+			}
+		}
+	}
+	return mediumEvent{Scattered: scattered, Distance: distance, Weight: coefficients.spectrum(weights)}
 }
 
 func segmentWavelengths(ctx bxdf.ShadingContext) []float64 {
@@ -136,9 +277,119 @@ func applyMediumTransmission(media *medium.Registry, ray *renderray.Ray, ctx bxd
 	}
 }
 
+// applyMediumAbsorption attenuates segments that sampleMediumSegment left to
+// deterministic extinction. A heterogeneous medium only reaches this point on
+// curved or non-3D rays, where it uses the density at the segment start.
 func applyMediumAbsorption(media *medium.Registry, ray *renderray.Ray, distance float64, ctx bxdf.ShadingContext) {
 	if ray == nil {
 		return
 	}
+	if density := media.Density(ray.MediumStack.Current()); density != nil {
+		distance *= density.Density(ray.Origin)
+	}
 	evaluateSegmentTransmittance(media, ray.MediumStack.Current(), distance, ctx).ApplyToRay(ray)
 }
+
+// reachesInfinity reports whether light crosses an unbounded segment through
+// mediumID: homogeneous media must be free of extinction, while a density
+// field is bounded and tracked like any finite segment.
+func reachesInfinity(media *medium.Registry, mediumID medium.MediumID, ctx bxdf.ShadingContext) bool {
+	if media.Density(mediumID) != nil {
+		return true
+	}
+	for _, sigmaT := range resolveMediumCoefficients(media, mediumID, ctx).SigmaT {
+		if sigmaT > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentTransmittance is the transmittance of a straight explicit connection
+// of the given length. Heterogeneous media use ratio tracking, so the result
+// is an unbiased estimate rather than the exact value.
+func segmentTransmittance(
+	rng uniformSource,
+	media *medium.Registry,
+	mediumID medium.MediumID,
+	origin, direction *mat.VecDense,
+	distance float64,
+	ctx bxdf.ShadingContext,
+) SegmentTransmittance {
+	density := media.Density(mediumID)
+	if density == nil || origin == nil || direction == nil || origin.Len() != 3 {
+		return evaluateSegmentTransmittance(media, mediumID, distance, ctx)
+	}
+	coefficients := resolveMediumCoefficients(media, mediumID, ctx)
+	return SegmentTransmittance{Value: ratioTrackTransmittance(rng, coefficients, density, origin, direction, distance)}
+}
+
+// sampleMediumSegment handles the ray's next segment, up to maxDistance (+Inf
+// on a miss), when it needs stochastic transport: free-flight sampling in a
+// scattering medium, or tracking through a heterogeneous one. Phase functions
+// and straight in-medium segments are three-dimensional Euclidean constructs;
+// false leaves the segment to deterministic extinction without in-scattering.
+func sampleMediumSegment(
+	rng uniformSource,
+	media *medium.Registry,
+	ray *renderray.Ray,
+	ctx bxdf.ShadingContext,
+	maxDistance float64,
+) (mediumEvent, bool) {
+	if ray == nil || ray.G().Kind() != geometry.EuclideanKind || ray.Direction.Len() != 3 {
+		return mediumEvent{}, false
+	}
+	mediumID := ray.MediumStack.Current()
+	coefficients := resolveMediumCoefficients(media, mediumID, ctx)
+	if density := media.Density(mediumID); density != nil {
+		if coefficients.Scatters() {
+			return deltaTrackMedium(rng, coefficients, density, ray.Origin, ray.Direction, maxDistance), true
+		}
+		weight := ratioTrackTransmittance(rng, coefficients, density, ray.Origin, ray.Direction, maxDistance)
+		return mediumEvent{Distance: maxDistance, Weight: weight}, true
+	}
+	if !coefficients.Scatters() {
+		return mediumEvent{}, false
+	}
+	return sampleMediumEvent(coefficients, maxDistance, rng.Float64(), rng.Float64()), true
+}
+
+// scatterPathInMedium moves a camera path to a sampled point distance along its
+// ray inside the current medium and samples the next direction there. The
+// phase function takes the role of the BSDF, including next-event estimation
+// and the MIS state for the following segment. It reports whether the path
+// continues.
+func (h *Handler) scatterPathInMedium(path *pathState, distance float64) bool {
+	rng, ray := path.rng, path.ray
+	ray.ArcTraveled += distance
+	if h.MaxArc > 0 && ray.ArcTraveled >= h.MaxArc {
+		terminateRay(ray)
+		return false
+	}
+	ray.Origin.AddScaledVec(ray.Origin, distance, ray.Direction)
+
+	phase := path.media.Phase(ray.MediumStack.Current())
+	frame, ok := maths.NewFrameFromNormal(ray.Direction)
+	if !ok {
+		terminateRay(ray)
+		return false
+	}
+	lightSampled := path.direct != nil && ray.WaveLength > 0 && path.level < h.MaxRayLevel
+	if lightSampled {
+		path.direct.estimateMedium(rng, path.objTree, h, ray, phase)
+	}
+
+	local, pdf := phase.Sample(maths.Sample2D{U: rng.Float64(), V: rng.Float64()})
+	if pdf <= 0 || !isFinitePDF(pdf) {
+		terminateRay(ray)
+		return false
+	}
+	scaleRayThroughput(ray, phase.Eval(maths.CosTheta(local))/pdf)
+	path.scatteredFrom(pdf, false, lightSampled)
+	wi := frame.LocalToWorld(local)
+	if ray.Polarized {
+		depolarizeInMedium(ray, wi)
+	}
+	ray.Direction.CopyVec(wi)
+	return true
+}
@@ -0,0 +1,567 @@
+package ray_tracing
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	rendercamera "github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Path guiding follows Müller et al., "Practical Path Guiding for Efficient
+// Light-Transport Simulation" (2017). A binary spatial tree over the scene
+// holds one directional quadtree per leaf, which learns the incident radiance
+// of the vertices inside the leaf.
+const (
+	// guideSamplingFraction is the probability of drawing a direction from
+	// the guide rather than from the BSDF at a guided vertex.
+	guideSamplingFraction = 0.5
+	// guideSpatialSplit scales the number of vertices, √(samples per pixel)
+	// times this, beyond which a spatial leaf splits after a pass.
+	guideSpatialSplit = 12000
+	// guideDirectionalSplit is the share of a quadtree's energy above which
+	// one of its quadrants is subdivided for the next pass.
+	guideDirectionalSplit    = 0.01
+	guideMaxDirectionalDepth = 20
+)
+
+// dTree is a quadtree over the square [0, 1)² that stores the energy recorded
+// in each quadrant. Directions map onto the square with the equal-area
+// cylindrical map u = (cos θ + 1) / 2, v = φ / 2π, so a density on the square
+// is 4π times the solid-angle density.
+type dTree struct {
+	nodes []dTreeNode
+}
+
+// dTreeNode holds its quadrants x + 2y, where x and y select the upper half
+// of u and v. A zero child marks a leaf quadrant; the root is never a child.
+type dTreeNode struct {
+	sum   [4]float64
+	child [4]int
+}
+
+func newDTree() *dTree {
+	return &dTree{nodes: make([]dTreeNode, 1)}
+}
+
+func (t *dTree) clone() *dTree {
+	return &dTree{nodes: append([]dTreeNode(nil), t.nodes...)}
+}
+
+func (t *dTree) total() float64 {
+	sum := t.nodes[0].sum
+	return sum[0] + sum[1] + sum[2] + sum[3]
+}
+
+// quadrant returns the quadrant of the node that contains (u, v) and the
+// point rescaled into that quadrant.
+func quadrant(u, v float64) (int, float64, float64) {
+	q := 0
+	if u *= 2; u >= 1 {
+		q, u = 1, u-1
+	}
+	if v *= 2; v >= 1 {
+		q, v = q+2, v-1
+	}
+	return q, u, v
+}
+
+// record adds value to every quadrant on the way to the leaf holding (u, v).
+func (t *dTree) record(u, v, value float64) {
+	for node := 0; ; {
+		var q int
+		q, u, v = quadrant(u, v)
+		t.nodes[node].sum[q] += value
+		if node = t.nodes[node].child[q]; node == 0 {
+			return
+		}
+	}
+}
+
+// pdf is the density of sample at (u, v) over the square.
+func (t *dTree) pdf(u, v float64) float64 {
+	density := 1.0
+	for node := 0; ; {
+		sum := t.nodes[node].sum
+		total := sum[0] + sum[1] + sum[2] + sum[3]
+		if total <= 0 {
+			return 0
+		}
+		var q int
+		q, u, v = quadrant(u, v)
+		density *= 4 * sum[q] / total
+		if node = t.nodes[node].child[q]; node == 0 || density == 0 {
+			return density
+		}
+	}
+}
+
+// sample descends by choosing the half of u from the marginal energy and then
+// the half of v given u, and draws uniformly inside the leaf quadrant.
+func (t *dTree) sample(u, v float64) (float64, float64, bool) {
+	x0, y0, size := 0.0, 0.0, 1.0
+	for node := 0; ; {
+		sum := t.nodes[node].sum
+		var x, y int
+		var ok bool
+		if x, u, ok = pickHalf(sum[0]+sum[2], sum[1]+sum[3], u); !ok {
+			return 0, 0, false
+		}
+		if y, v, ok = pickHalf(sum[x], sum[x+2], v); !ok {
+			return 0, 0, false
+		}
+		size /= 2
+		x0 += float64(x) * size
+		y0 += float64(y) * size
+		if node = t.nodes[node].child[x+2*y]; node == 0 {
+			return x0 + u*size, y0 + v*size, true
+		}
+	}
+}
+
+// pickHalf chooses the upper half with probability high / (low + high) and
+// returns u rescaled to [0, 1) within the chosen half.
+func pickHalf(low, high, u float64) (int, float64, bool) {
+	if !(low+high > 0) {
+		return 0, 0, false
+	}
+	pLow := low / (low + high)
+	if u < pLow {
+		return 0, u / pLow, true
+	}
+	return 1, math.Min((u-pLow)/(1-pLow), math.Nextafter(1, 0)), true
+}
+
+// refined returns an empty quadtree that resolves the energy of t: every
+// quadrant holding more than guideDirectionalSplit of the total is
+// subdivided, and quadrants below it are merged.
+func (t *dTree) refined() *dTree {
+	out := newDTree()
+	total := t.total()
+	if total <= 0 {
+		return out
+	}
+	var refine func(outNode, node int, sum [4]float64, depth int)
+	refine = func(outNode, node int, sum [4]float64, depth int) {
+		for q := range sum {
+			if depth >= guideMaxDirectionalDepth || sum[q]/total <= guideDirectionalSplit {
+				continue
+			}
+			child := len(out.nodes)
+			out.nodes = append(out.nodes, dTreeNode{})
+			out.nodes[outNode].child[q] = child
+			// A leaf quadrant spreads its energy evenly over its children.
+			childNode, childSum := -1, [4]float64{sum[q] / 4, sum[q] / 4, sum[q] / 4, sum[q] / 4}
+			if node >= 0 && t.nodes[node].child[q] != 0 {
+				childNode = t.nodes[node].child[q]
+				childSum = t.nodes[childNode].sum
+			}
+			refine(child, childNode, childSum, depth+1)
+		}
+	}
+	refine(0, 0, t.nodes[0].sum, 1)
+	return out
+}
+
+// guideSquare maps a unit direction onto the square of a dTree.
+func guideSquare(d *mat.VecDense) (float64, float64) {
+	u := (math.Max(-1, math.Min(1, d.AtVec(2))) + 1) / 2
+	phi := math.Atan2(d.AtVec(1), d.AtVec(0))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return math.Min(u, math.Nextafter(1, 0)), math.Min(phi/(2*math.Pi), math.Nextafter(1, 0))
+}
+
+// guideDirection is the inverse of guideSquare.
+func guideDirection(u, v float64) *mat.VecDense {
+	z := 2*u - 1
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * v
+	return mat.NewVecDense(3, []float64{r * math.Cos(phi), r * math.Sin(phi), z})
+}
+
+// pathGuide is the spatial tree. Its cube covers the finite objects of the
+// scene; vertices outside it fall into the nearest leaf.
+type pathGuide struct {
+	lower  [3]float64
+	extent float64
+	nodes  []guideNode
+}
+
+// guideNode splits its cell in half along axis, or is a leaf when children is
+// zero. A leaf guides with the quadtree of the finished passes, sampling, and
+// records the current pass into building.
+type guideNode struct {
+	axis     int
+	children [2]int
+	samples  int64
+	sampling *dTree
+	building *dTree
+}
+
+// newPathGuide returns nil for a scene without finite three-dimensional
+// objects.
+func newPathGuide(tree *object.ObjectTree) *pathGuide {
+	if tree == nil {
+		return nil
+	}
+	lower := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	upper := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, obj := range tree.Objects {
+		if obj == nil || obj.Shape == nil {
+			continue
+		}
+		pmin, pmax := obj.Shape.BuildBoundingBox()
+		if pmin == nil || pmax == nil || pmin.Len() != 3 || pmax.Len() != 3 {
+			continue
+		}
+		finite := true
+		for dim := range 3 {
+			finite = finite && !math.IsInf(pmin.AtVec(dim), 0) && !math.IsInf(pmax.AtVec(dim), 0) &&
+				!math.IsNaN(pmin.AtVec(dim)) && !math.IsNaN(pmax.AtVec(dim))
+		}
+		if !finite {
+			continue
+		}
+		for dim := range 3 {
+			lower[dim] = math.Min(lower[dim], pmin.AtVec(dim))
+			upper[dim] = math.Max(upper[dim], pmax.AtVec(dim))
+		}
+	}
+	if lower[0] > upper[0] {
+		return nil
+	}
+	extent := 0.0
+	for dim := range 3 {
+		extent = math.Max(extent, upper[dim]-lower[dim])
+	}
+	return &pathGuide{
+		lower:  lower,
+		extent: math.Max(extent, 1e-6) * (1 + 1e-6),
+		nodes:  []guideNode{{sampling: newDTree(), building: newDTree()}},
+	}
+}
+
+// leaf returns the index of the leaf whose cell contains point.
+func (g *pathGuide) leaf(point *mat.VecDense) int {
+	var p [3]float64
+	for dim := range p {
+		p[dim] = math.Max(0, math.Min(1, (point.AtVec(dim)-g.lower[dim])/g.extent))
+	}
+	index := 0
+	for g.nodes[index].children[0] != 0 {
+		node := &g.nodes[index]
+		if p[node.axis] *= 2; p[node.axis] < 1 {
+			index = node.children[0]
+		} else {
+			p[node.axis]--
+			index = node.children[1]
+		}
+	}
+	return index
+}
+
+// deposit adds the records of a pass to the building quadtrees.
+func (g *pathGuide) deposit(records []guideRecord) {
+	for _, record := range records {
+		node := &g.nodes[g.leaf(record.point)]
+		node.samples++
+		if record.value > 0 {
+			u, v := guideSquare(record.direction)
+			node.building.record(u, v, record.value)
+		}
+	}
+}
+
+// refine ends a pass of samples per pixel. Leaves that saw too many vertices
+// split in half, both halves keeping the energy learned so far; then every
+// leaf starts guiding with what it learned and records the next pass into a
+// fresh quadtree refined from it.
+func (g *pathGuide) refine(samples int64) {
+	threshold := guideSpatialSplit * math.Sqrt(float64(samples))
+	for index := 0; index < len(g.nodes); index++ {
+		node := g.nodes[index]
+		if node.children[0] != 0 || float64(node.samples) <= threshold {
+			continue
+		}
+		first := len(g.nodes)
+		for range 2 {
+			g.nodes = append(g.nodes, guideNode{
+				axis:     (node.axis + 1) % 3,
+				samples:  node.samples / 2,
+				building: node.building.clone(),
+			})
+		}
+		g.nodes[index] = guideNode{axis: node.axis, children: [2]int{first, first + 1}}
+	}
+	for index := range g.nodes {
+		node := &g.nodes[index]
+		if node.children[0] != 0 {
+			continue
+		}
+		node.sampling, node.building = node.building, node.building.refined()
+		node.samples = 0
+	}
+}
+
+// guidedVertex mixes BSDF sampling at a surface vertex with the learned
+// incident radiance of its leaf by one-sample MIS. The zero value stands for
+// a vertex the guide does not cover.
+type guidedVertex struct {
+	tree *dTree
+}
+
+// vertex returns the guided vertex at the ray origin. Only BSDFs without
+// delta lobes or transmission are guided, so the guided direction never
+// changes the medium the path travels in.
+func (g *pathGuide) vertex(ray *optics.Ray, si *SurfaceInteraction) guidedVertex {
+	if g == nil || ray.Origin.Len() != 3 {
+		return guidedVertex{}
+	}
+	surface := si.Object.Material.Surface
+	if surface.DeltaFlags()&^bxdf.Dispersive != bxdf.DeltaNone || surface.RoughnessInfo(si.Context).IsDelta {
+		return guidedVertex{}
+	}
+	return guidedVertex{tree: g.nodes[g.leaf(ray.Origin)].sampling}
+}
+
+// active reports whether the vertex has learned any radiance to guide with.
+func (v guidedVertex) active() bool {
+	return v.tree != nil && v.tree.total() > 0
+}
+
+// pdf is the solid-angle density of drawing the world direction from the
+// guide.
+func (v guidedVertex) pdf(direction *mat.VecDense) float64 {
+	u, w := guideSquare(direction)
+	return v.tree.pdf(u, w) / (4 * math.Pi)
+}
+
+// mixturePDF is the density of the one-sample mixture given the BSDF density
+// of the world direction.
+func (v guidedVertex) mixturePDF(bsdfPDF float64, direction *mat.VecDense) float64 {
+	if !v.active() {
+		return bsdfPDF
+	}
+	return (1-guideSamplingFraction)*bsdfPDF + guideSamplingFraction*v.pdf(direction)
+}
+
+// sample draws the next direction from the guide or the BSDF. Either way the
+// sample carries the mixture density. An inactive vertex samples the BSDF
+// alone with the same numbers as sampleSurface.
+func (v guidedVertex) sample(rng uniformSource, si *SurfaceInteraction) (bxdf.BxDFSample, bool) {
+	if !v.active() {
+		return sampleSurface(rng, si.Object, si.Context, si.WoLocal)
+	}
+	if rng.Float64() >= guideSamplingFraction {
+		sample, ok := sampleSurface(rng, si.Object, si.Context, si.WoLocal)
+		if ok {
+			sample.PDF = v.mixturePDF(sample.PDF, si.Frame.LocalToWorld(sample.Wi))
+		}
+		return sample, ok
+	}
+
+	u, w, ok := v.tree.sample(rng.Float64(), rng.Float64())
+	if !ok {
+		return bxdf.BxDFSample{}, false
+	}
+	direction := guideDirection(u, w)
+	surface := si.Object.Material.Surface
+	wi := si.Frame.WorldToLocal(direction)
+	sample := bxdf.BxDFSample{
+		Wi:  wi,
+		F:   surface.Eval(si.Context, wi, si.WoLocal),
+		PDF: v.mixturePDF(surface.PDF(si.Context, wi, si.WoLocal), direction),
+	}
+	if sample.PDF <= 0 || sample.F.IsZero() || !sample.F.IsFinite() || !sample.F.IsNonNegative() {
+		return sample, false
+	}
+	return sample, true
+}
+
+// guideRecord is the incident radiance estimate of one guided vertex,
+// divided by the density of its direction.
+type guideRecord struct {
+	point     *mat.VecDense
+	direction *mat.VecDense
+	value     float64
+}
+
+// guideRecorder collects the guided vertices of training paths.
+type guideRecorder struct {
+	records []guideRecord
+	path    []guidePathVertex
+}
+
+// guidePathVertex is a guided vertex of the current path, kept until the path
+// ends and its incident radiance is known.
+type guidePathVertex struct {
+	point, direction *mat.VecDense
+	radiance         float64 // ray.Radiance once the vertex scattered
+	throughput       float64 // the throughput of the outgoing segment
+	pdf              float64
+}
+
+// scattered notes a guided vertex whose outgoing segment starts at the ray.
+func (r *guideRecorder) scattered(ray *optics.Ray, pdf float64) {
+	if r == nil {
+		return
+	}
+	r.path = append(r.path, guidePathVertex{
+		point:      mat.VecDenseCopyOf(ray.Origin),
+		direction:  mat.VecDenseCopyOf(ray.Direction),
+		radiance:   ray.Radiance,
+		throughput: optics.SpectralRayToScalar(ray),
+		pdf:        pdf,
+	})
+}
+
+// finish records the vertices of the path that ended at ray. Everything the
+// path gathered after a vertex, divided by the throughput that reached it,
+// estimates the radiance arriving there along the outgoing direction.
+func (r *guideRecorder) finish(ray *optics.Ray) {
+	if r == nil {
+		return
+	}
+	total := ray.Radiance + optics.SpectralRayToScalar(ray)
+	for _, vertex := range r.path {
+		value := 0.0
+		if vertex.throughput > 0 && vertex.pdf > 0 {
+			value = (total - vertex.radiance) / vertex.throughput / vertex.pdf
+		}
+		if !(value > 0) || math.IsInf(value, 0) {
+			value = 0
+		}
+		r.records = append(r.records, guideRecord{point: vertex.point, direction: vertex.direction, value: value})
+	}
+	r.path = r.path[:0]
+}
+
+// guideTrainingKernel traces the paths of a training pass, recording their
+// guided vertices.
+type guideTrainingKernel struct {
+	*pathTracingKernel
+	recorder *guideRecorder
+}
+
+func (k guideTrainingKernel) sampleSpectral(
+	h *Handler,
+	pixelSampler sampler.Sampler,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	wavelength optics.WavelengthSample,
+	aovs *aovPixel,
+	index ...int,
+) rendercamera.SpectralSample {
+	var sample [1]rendercamera.SpectralSample
+	return k.trace(h, pixelSampler, renderCamera, objTree, ray, []optics.WavelengthSample{wavelength}, k.recorder, aovs, sample[:0], index...)[0]
+}
+
+func (k guideTrainingKernel) sampleBundle(
+	h *Handler,
+	pixelSampler sampler.Sampler,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	bundle []optics.WavelengthSample,
+	aovs *aovPixel,
+	spectralSamples []rendercamera.SpectralSample,
+	index ...int,
+) []rendercamera.SpectralSample {
+	return k.trace(h, pixelSampler, renderCamera, objTree, ray, bundle, k.recorder, aovs, spectralSamples, index...)
+}
+
+// pathGuidingTrainingSamples is the number of samples per pixel spent on
+// training the guide of a render of samples camera samples.
+func (h *Handler) pathGuidingTrainingSamples(samples int64) int64 {
+	if h.PathGuidingTrainingSamples > 0 {
+		return h.PathGuidingTrainingSamples
+	}
+	return max(1, samples/4)
+}
+
+// trainGuide learns the guide of a path render over passes of 1, 2, 4, …
+// samples per pixel, each guided by what the passes before it learned.
+// Training samples only teach the guide and never reach the Film, so the
+// render that follows is guided by a fixed distribution. The guide stays nil
+// unless path guiding is on and the scene supports it.
+func (k *pathTracingKernel) trainGuide(context *RenderContext) {
+	h := context.Handler
+	k.guide = nil
+	if !h.PathGuiding {
+		return
+	}
+	if h.SpectrumMode == optics.SpectrumModeRGB {
+		h.warn("path guiding needs a spectral mode; rendering without it")
+		return
+	}
+	if geometry.Get(h.SceneGeometry).Kind() != geometry.EuclideanKind {
+		h.warn("path guiding needs Euclidean scene geometry; rendering without it")
+		return
+	}
+	guide := newPathGuide(context.ObjectTree)
+	if guide == nil {
+		return
+	}
+	k.guide = guide
+
+	film := context.Camera.GetFilm()
+	tiles, _ := buildTileCoordinatesForWindows(film.Shape, film.PixelWindows, h.BlockCols, h.BlockRows)
+	budget := h.pathGuidingTrainingSamples(context.Samples)
+	progress := h.newProgressReporter("Training path guide", "samples", budget)
+	defer progress.Close()
+	trained := int64(0)
+	for pass := int64(0); trained < budget && !context.done(); pass++ {
+		samples := min(int64(1)<<min(pass, 62), budget-trained)
+		runOrderedParallelWork(h.ThreadNum, int64(len(tiles)), 1,
+			func(index int64) []guideRecord {
+				return h.traceGuideTile(k, context, tiles[index], pass, samples)
+			},
+			guide.deposit,
+		)
+		guide.refine(samples)
+		trained += samples
+		progress.Add(samples)
+	}
+}
+
+// traceGuideTile traces samples training paths through every pixel of tile
+// and returns their records. Each pass draws from its own stream of the
+// guide domain.
+func (h *Handler) traceGuideTile(
+	k *pathTracingKernel,
+	context *RenderContext,
+	tile TileCoordinate,
+	pass, samples int64,
+) []guideRecord {
+	film := context.Camera.GetFilm()
+	trainer := guideTrainingKernel{pathTracingKernel: k, recorder: &guideRecorder{}}
+	pixelSampler := sampler.New(h.SamplerKind, sampler.Options{
+		Seed:            sampler.Hash(h.Seed, uint64(samplerDomainGuide), uint64(pass)),
+		SamplesPerPixel: h.EffectiveSampleCount(samples),
+		Width:           filmWidth(film),
+	})
+	ray := h.RayPool.Get().(*optics.Ray)
+	ray.Geometry = h.SceneGeometry
+	defer h.RayPool.Put(ray)
+
+	var discarded []rendercamera.SpectralSample
+	for y := tile.Y0; y < tile.Y1; y++ {
+		for x := tile.X0; x < tile.X1; x++ {
+			pixel := tile.pixelIndex(x, y, film.Shape)
+			coords := film.SpectralBins[0].GetCoordinates(pixel)
+			for s := int64(0); s < samples; s++ {
+				discarded = h.traceCameraSample(
+					trainer, pixelSampler, pixel, context.Camera, context.ObjectTree, ray, s, nil, discarded[:0], coords...,
+				)
+			}
+		}
+	}
+	return trainer.recorder.records
+}
@@ -0,0 +1,143 @@
+package ray_tracing
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/event"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+func newGuideTestTree() *dTree {
+	rng := rand.New(rand.NewPCG(1, 2))
+	fill := func(tree *dTree) {
+		for range 4000 {
+			tree.record(rng.Float64(), rng.Float64(), 1)
+			tree.record(0.7+0.01*rng.Float64(), 0.2+0.02*rng.Float64(), 20)
+		}
+	}
+	tree := newDTree()
+	fill(tree)
+	for range 3 {
+		tree = tree.refined()
+		fill(tree)
+	}
+	return tree
+}
+
+func TestDTreeSamplesItsDensity(t *testing.T) {
+	tree := newGuideTestTree()
+	if len(tree.nodes) < 8 {
+		t.Fatalf("refined tree has %d nodes, want the hot spot subdivided", len(tree.nodes))
+	}
+
+	const grid = 1024
+	integral := 0.0
+	for i := range grid {
+		for j := range grid {
+			integral += tree.pdf((float64(i)+0.5)/grid, (float64(j)+0.5)/grid)
+		}
+	}
+	if integral /= grid * grid; math.Abs(integral-1) > 1e-9 {
+		t.Fatalf("density integrates to %g, want 1", integral)
+	}
+	if hot, cold := tree.pdf(0.705, 0.21), tree.pdf(0.2, 0.7); hot < 10*cold {
+		t.Fatalf("hot spot density %g is not well above background %g", hot, cold)
+	}
+
+	// The density covers the whole square, so E[1 / pdf] is its area.
+	rng := rand.New(rand.NewPCG(3, 4))
+	const samples = 200000
+	inverse := 0.0
+	for range samples {
+		u, v, ok := tree.sample(rng.Float64(), rng.Float64())
+		if !ok || u < 0 || u >= 1 || v < 0 || v >= 1 {
+			t.Fatalf("sample (%g, %g, %v) is outside the square", u, v, ok)
+		}
+		inverse += 1 / tree.pdf(u, v)
+	}
+	if mean := inverse / samples; math.Abs(mean-1) > 0.02 {
+		t.Fatalf("mean inverse density %g, want 1", mean)
+	}
+}
+
+func TestGuideDirectionRoundTrips(t *testing.T) {
+	for _, square := range [][2]float64{{0.1, 0.2}, {0.5, 0.75}, {0.99, 0.01}} {
+		u, v := guideSquare(guideDirection(square[0], square[1]))
+		if math.Abs(u-square[0]) > 1e-12 || math.Abs(v-square[1]) > 1e-12 {
+			t.Fatalf("(%g, %g) maps back to (%g, %g)", square[0], square[1], u, v)
+		}
+	}
+}
+
+func TestPathGuidingMatchesUnguidedRender(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.MaxRayLevel = 4
+	reference := renderTestFilmEnergy(t, h, tree, 2048)
+
+	h.PathGuiding = true
+	h.PathGuidingTrainingSamples = 63
+	guided := renderTestFilmEnergy(t, h, tree, 512)
+	if relative := math.Abs(guided-reference) / reference; relative > 0.05 {
+		t.Fatalf("guided energy %g differs from unguided %g by %.1f%%", guided, reference, 100*relative)
+	}
+	h.ThreadNum = 4
+	if threaded := renderTestFilmEnergy(t, h, tree, 512); threaded != guided {
+		t.Fatalf("guided energy %g with 4 workers, %g with 1", threaded, guided)
+	}
+}
+
+func TestPathGuidingLearnsOnlyInSpectralEuclideanRenders(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.SpectrumMode = optics.SpectrumModeSampledWavelengths
+	h.PathGuiding = true
+	h.PathGuidingTrainingSamples = 7
+	context := &RenderContext{Handler: h, Camera: newBDPTTestCamera(t, 4, 4), ObjectTree: tree, Samples: 8}
+	kernel := newPathTracingKernel(h, tree)
+	if err := kernel.prepare(context); err != nil {
+		t.Fatal(err)
+	}
+	if kernel.guide == nil {
+		t.Fatal("expected a Euclidean scene to train a guide")
+	}
+	learned := false
+	for _, node := range kernel.guide.nodes {
+		learned = learned || (node.sampling != nil && node.sampling.total() > 0)
+	}
+	if !learned {
+		t.Fatal("training recorded no radiance")
+	}
+
+	var warnings []string
+	h.Events = event.SinkFunc(func(e event.Event) {
+		if e.Kind == event.KindWarning {
+			warnings = append(warnings, e.Message)
+		}
+	})
+	h.SceneGeometry = geometry.Klein()
+	if err := kernel.prepare(context); err != nil {
+		t.Fatal(err)
+	}
+	if kernel.guide != nil {
+		t.Fatal("expected Klein geometry to render without path guiding")
+	}
+
+	h.SceneGeometry = geometry.Euclidean()
+	h.SpectrumMode = optics.SpectrumModeRGB
+	if err := kernel.prepare(context); err != nil {
+		t.Fatal(err)
+	}
+	if kernel.guide != nil {
+		t.Fatal("expected RGB mode to render without path guiding")
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "spectral mode") {
+		t.Fatalf("warnings = %q, want one for the geometry and one for RGB mode", warnings)
+	}
+}
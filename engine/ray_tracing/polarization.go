@@ -0,0 +1,135 @@
+package ray_tracing
+
+import (
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/utils"
+	"gonum.org/v1/gonum/mat"
+)
+
+// polarizedPaths reports whether the path tracer carries polarization. Stokes
+// frames need wavelengths and three-dimensional Euclidean space; otherwise
+// the render goes on unpolarized.
+func (h *Handler) polarizedPaths() bool {
+	if !h.Polarized {
+		return false
+	}
+	if h.SpectrumMode == optics.SpectrumModeRGB {
+		h.warn("polarized transport needs a spectral mode; rendering without it")
+		return false
+	}
+	if geometry.Get(h.SceneGeometry).Kind() != geometry.EuclideanKind || utils.Dimension != 3 {
+		h.warn("polarized transport needs three-dimensional Euclidean scene geometry; rendering without it")
+		return false
+	}
+	return true
+}
+
+// startPolarizedRay makes a camera ray polarized. Its Stokes frame follows
+// the horizontal axis of the film when the camera has one.
+func startPolarizedRay(ray *optics.Ray, renderCamera camera.RayCamera) {
+	ray.Polarized = true
+	ray.Mueller = optics.IdentityMueller()
+	ray.StokesRadiance = [3]float64{}
+	var horizontal [3]float64
+	if polarizing, ok := renderCamera.(camera.PolarizingCamera); ok {
+		horizontal = vec3(polarizing.FilmHorizontal())
+	}
+	ray.StokesFrame = perpendicularBasis(horizontal, vec3(ray.Direction))
+}
+
+// polarizeAtSurface updates a polarized ray that scatters at the surface of
+// si into the local direction wi. Call it before the ray takes direction wi.
+func polarizeAtSurface(ray *optics.Ray, si *SurfaceInteraction, wi maths.Direction) {
+	mueller := optics.DepolarizerMueller()
+	if polarizing, ok := si.Object.Material.Surface.(bxdf.Polarizing); ok {
+		if m, ok := polarizing.Mueller(si.Context, wi, si.WoLocal); ok {
+			mueller = m
+		}
+	}
+	polarize(ray, vec3(si.Frame.LocalToWorld(bxdf.StokesBasis(wi, si.WoLocal))), mueller)
+}
+
+// depolarizeInMedium updates a polarized ray that scatters in a medium into
+// the world direction wi. Phase functions depolarize.
+func depolarizeInMedium(ray *optics.Ray, wi *mat.VecDense) {
+	wo := scale3(vec3(ray.Direction), -1)
+	basis := cross3(vec3(wi), wo)
+	if norm3(basis) <= 1e-6 {
+		basis = perpendicularBasis([3]float64{1, 0, 0}, wo)
+	}
+	polarize(ray, scale3(basis, 1/norm3(basis)), optics.DepolarizerMueller())
+}
+
+// polarize carries the Mueller matrix of a polarized ray across a vertex
+// whose normalized Mueller matrix mueller uses the Stokes frame with x axis
+// basis, a unit vector perpendicular to the ray's directions before and
+// after the vertex. The intensity the vertex passes for the ray's
+// polarization goes into the throughput, and basis becomes the ray's frame.
+func polarize(ray *optics.Ray, basis [3]float64, mueller optics.Mueller) {
+	if !ray.Polarized {
+		return
+	}
+	wo := scale3(vec3(ray.Direction), -1)
+	angle := math.Atan2(dot3(wo, cross3(basis, ray.StokesFrame)), dot3(basis, ray.StokesFrame))
+	transport := ray.Mueller.Mul(optics.RotationMueller(angle)).Mul(mueller)
+	intensity := transport[0][0]
+	if intensity <= 0 || math.IsNaN(intensity) || math.IsInf(intensity, 0) {
+		terminateRay(ray)
+		return
+	}
+	scaleRayThroughput(ray, intensity)
+	ray.Mueller = transport.Normalized()
+	ray.StokesFrame = basis
+}
+
+// perpendicularBasis is x made a unit vector perpendicular to the unit vector
+// p, or another unit vector perpendicular to p when x is parallel to it.
+func perpendicularBasis(x, p [3]float64) [3]float64 {
+	for _, candidate := range [][3]float64{x, {1, 0, 0}, {0, 1, 0}} {
+		projected := sub3(candidate, scale3(p, dot3(candidate, p)))
+		if length := norm3(projected); length > 1e-6 {
+			return scale3(projected, 1/length)
+		}
+	}
+	return [3]float64{}
+}
+
+func vec3(v *mat.VecDense) [3]float64 {
+	var res [3]float64
+	if v != nil {
+		for i := range min(3, v.Len()) {
+			res[i] = v.AtVec(i)
+		}
+	}
+	return res
+}
+
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross3(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func sub3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func scale3(a [3]float64, s float64) [3]float64 {
+	return [3]float64{a[0] * s, a[1] * s, a[2] * s}
+}
+
+func norm3(a [3]float64) float64 {
+	return math.Sqrt(dot3(a, a))
+}
@@ -0,0 +1,191 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+// newPolarizedTestHandler renders polarized hero-wavelength paths without
+// next-event estimation, so that emitting planes need no light sampling.
+func newPolarizedTestHandler() *Handler {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.NextEventEstimation = false
+	h.Polarized = true
+	h.AOVs = []camera.AOVKind{camera.AOVStokes}
+	return h
+}
+
+// addPolarizerPlane puts a linear polarizer across the z axis at z.
+func addPolarizerPlane(tree *object.ObjectTree, z, angle float64) {
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, 1}), B: -z},
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewLinearPolarizer(optics.ConstantSpectrum(1), angle))},
+	})
+}
+
+// renderStokes renders tree and returns the Film's Stokes vector summed over
+// its pixels and bins.
+func renderStokes(t *testing.T, h *Handler, renderCamera *camera.Camera3D, tree *object.ObjectTree, samples int64) optics.Stokes {
+	t.Helper()
+	if err := h.TraceScene(renderCamera, tree, samples); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	var stokes optics.Stokes
+	values := renderCamera.Film.AOV(camera.AOVStokes).Data
+	for i, value := range values {
+		stokes[i%4] += value
+	}
+	return stokes
+}
+
+func TestPolarizedPathsFollowMalusLaw(t *testing.T) {
+	render := func(second float64) optics.Stokes {
+		tree := (&object.ObjectTree{}).Build()
+		addPolarizerPlane(tree, 1, 0)
+		addPolarizerPlane(tree, 2, second)
+		tree.AddObject(&object.Object{
+			Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, -1}), B: 3},
+			Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))},
+		})
+		tree.Build()
+		// Oblique rays see the polarizer axes foreshortened, so the camera
+		// looks almost straight through them.
+		renderCamera := newBDPTTestCamera(t, 2, 2)
+		renderCamera.FieldOfViews = []float64{0.5, 0.5}
+		if err := renderCamera.Prepare(); err != nil {
+			t.Fatalf("prepare camera: %v", err)
+		}
+		return renderStokes(t, newPolarizedTestHandler(), renderCamera, tree, 16)
+	}
+
+	aligned := render(0)
+	if aligned[0] <= 0 {
+		t.Fatalf("aligned polarizers passed no light: %v", aligned)
+	}
+	for _, angle := range []float64{math.Pi / 6, math.Pi / 4, math.Pi / 3, math.Pi / 2} {
+		crossed := render(angle)
+		want := math.Cos(angle) * math.Cos(angle)
+		if got := crossed[0] / aligned[0]; math.Abs(got-want) > 1e-4 {
+			t.Errorf("polarizers %.0f° apart pass %g of the aligned intensity, want cos² = %g", angle*180/math.Pi, got, want)
+		}
+	}
+	// The polarizer nearest the camera has its axis along the film's
+	// horizontal, the x axis of the camera's Stokes frame.
+	if degree := aligned[1] / aligned[0]; math.Abs(degree-1) > 1e-4 || math.Abs(aligned[2]) > 1e-4*aligned[0] {
+		t.Fatalf("light behind a horizontal polarizer has Stokes vector %v, want S1 = S0", aligned)
+	}
+}
+
+func TestPolarizedPathsReflectSPolarizedLightAtBrewsterAngle(t *testing.T) {
+	brewster := math.Atan(1.5)
+	renderCamera := camera.NewCamera3D()
+	renderCamera.Position = mat.NewVecDense(3, nil)
+	renderCamera.Coordinates = []*mat.VecDense{
+		mat.NewVecDense(3, []float64{0, -math.Cos(brewster), math.Sin(brewster)}),
+		mat.NewVecDense(3, []float64{1, 0, 0}),
+		mat.NewVecDense(3, []float64{0, math.Sin(brewster), math.Cos(brewster)}),
+	}
+	renderCamera.FieldOfViews = []float64{0.5, 0.5}
+	renderCamera.Film = camera.NewFilm(1, 1)
+	renderCamera.Film.InitSpectralBins(3, 400, 700)
+	if err := renderCamera.Prepare(); err != nil {
+		t.Fatalf("prepare camera: %v", err)
+	}
+
+	tree := (&object.ObjectTree{}).Build()
+	tree.AddObject(&object.Object{
+		Shape: &shape.Plane{A: mat.NewVecDense(3, []float64{0, 1, 0}), B: 1},
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewSpecularDielectricConstant(
+			optics.ConstantSpectrum(1), optics.ConstantSpectrum(1), 1, 1.5,
+		))},
+	})
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, -1, 0}), B: 5},
+		Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))},
+	})
+	tree.Build()
+
+	stokes := renderStokes(t, newPolarizedTestHandler(), renderCamera, tree, 256)
+	if stokes[0] <= 0 {
+		t.Fatal("no light reflected towards the camera")
+	}
+	// The plane of incidence is vertical, so s-polarized light oscillates
+	// along the film's horizontal.
+	if degree := stokes[1] / stokes[0]; degree < 0.999 {
+		t.Fatalf("reflection at Brewster's angle has S1/S0 = %g, want 1 (Stokes vector %v)", degree, stokes)
+	}
+}
+
+func TestUnpolarizedRendersRecordZeroStokesPolarization(t *testing.T) {
+	tree := (&object.ObjectTree{}).Build()
+	addPolarizerPlane(tree, 1, 0)
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, -1}), B: 3},
+		Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))},
+	})
+	tree.Build()
+	h := newPolarizedTestHandler()
+	h.Polarized = false
+	renderCamera := newBDPTTestCamera(t, 2, 2)
+	stokes := renderStokes(t, h, renderCamera, tree, 4)
+
+	energy := 0.0
+	for _, bin := range renderCamera.Film.SpectralBins {
+		for _, value := range bin.Data {
+			energy += value
+		}
+	}
+	if math.Abs(stokes[0]-energy) > 1e-9*energy || stokes[1] != 0 || stokes[2] != 0 || stokes[3] != 0 {
+		t.Fatalf("unpolarized render recorded Stokes vector %v, want S0 = %g and no polarization", stokes, energy)
+	}
+}
+
+func TestPolarizedLightSamplingMatchesBSDFSampling(t *testing.T) {
+	tree := (&object.ObjectTree{}).Build()
+	tree.AddObject(&object.Object{
+		Shape: &shape.Plane{A: mat.NewVecDense(3, []float64{0, 1, 0}), B: 1},
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewRoughConductor(
+			optics.ConstantSpectrum(1.5), optics.ConstantSpectrum(0.1), 0.3,
+		))},
+	})
+	tree.AddObject(&object.Object{
+		Shape: shape.NewCircle(
+			mat.NewVecDense(3, []float64{0, 0.5, 8}),
+			mat.NewVecDense(3, []float64{0, -1, 0}),
+			1,
+		),
+		Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))},
+	})
+	tree.Build()
+
+	// The camera sees the light reflected off the floor at grazing incidence,
+	// where the glossy lobe polarizes it along the film's horizontal.
+	render := func(nee bool) optics.Stokes {
+		h := newPolarizedTestHandler()
+		h.NextEventEstimation = nee
+		h.MaxRayLevel = 1
+		return renderStokes(t, h, newBDPTTestCamera(t, 4, 4), tree, 2048)
+	}
+	sampled, hit := render(true), render(false)
+	t.Logf("light sampling %v, BSDF sampling %v", sampled, hit)
+	for k := range sampled {
+		if math.Abs(sampled[k]-hit[k]) > 0.05*sampled[0] {
+			t.Fatalf("light sampling gives Stokes vector %v, BSDF sampling %v", sampled, hit)
+		}
+	}
+	if math.Abs(sampled[1]) < 0.05*sampled[0] {
+		t.Fatalf("conductor reflection left the light almost unpolarized: %v", sampled)
+	}
+}
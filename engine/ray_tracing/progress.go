@@ -5,11 +5,14 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/Algo2147483647/ray/engine/event"
 )
 
 const progressInterval = 100 * time.Millisecond
 
 type progressReporter struct {
+	sink      event.Sink
 	label     string
 	unit      string
 	total     int64
@@ -19,9 +22,14 @@ type progressReporter struct {
 	closeOnce sync.Once
 }
 
-func newProgressReporter(label, unit string, total int64) *progressReporter {
+// newProgressReporter reports the progress of one render stage to the
+// Handler's event sink, or returns nil, which reports nothing, without one.
+func (h *Handler) newProgressReporter(label, unit string, total int64) *progressReporter {
+	if h.Events == nil {
+		return nil
+	}
 	reporter := &progressReporter{
-		label: label, unit: unit, total: total,
+		sink: h.Events, label: label, unit: unit, total: total,
 		done: make(chan struct{}), finished: make(chan struct{}),
 	}
 	go reporter.run()
@@ -47,24 +55,35 @@ func (r *progressReporter) run() {
 	start := time.Now()
 	ticker := time.NewTicker(progressInterval)
 	defer ticker.Stop()
-	print := func(current int64, complete bool) {
-		percent := 100.0
-		if r.total > 0 {
-			percent = 100 * float64(current) / float64(r.total)
-		}
-		if complete {
-			fmt.Printf("\r%s complete: %d/%d %s (100%%) Time: %v\n", r.label, r.total, r.total, r.unit, time.Since(start).Round(time.Second))
-			return
-		}
-		fmt.Printf("\r%s: %d/%d %s (%.2f%%) Time: %v", r.label, current, r.total, r.unit, percent, time.Since(start).Round(time.Second))
+	emit := func(kind event.Kind) {
+		r.sink.Emit(event.Event{
+			Kind:      kind,
+			Stage:     r.label,
+			Unit:      r.unit,
+			Completed: r.completed.Load(),
+			Total:     r.total,
+			Elapsed:   time.Since(start),
+		})
 	}
 	for {
 		select {
 		case <-r.done:
-			print(r.total, true)
+			emit(event.KindProgressEnd)
 			return
 		case <-ticker.C:
-			print(r.completed.Load(), false)
+			emit(event.KindProgress)
 		}
 	}
 }
+
+// emit hands e to the Handler's event sink, if it has one.
+func (h *Handler) emit(e event.Event) {
+	if h.Events != nil {
+		h.Events.Emit(e)
+	}
+}
+
+// warn emits a warning Event with a formatted message.
+func (h *Handler) warn(format string, args ...any) {
+	h.emit(event.Event{Kind: event.KindWarning, Message: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,316 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+)
+
+// Primary-sample-space Metropolis light transport (Kelemen et al.) treats the
+// uniform numbers consumed by one BDPT sample as a point in the unit
+// hypercube and explores that space with a Markov chain whose stationary
+// density is proportional to the sample's scalar image contribution I(u).
+// Each mutation splats both the current and the proposed state, weighted by
+// their acceptance probabilities and by b/I, where the bootstrap estimate b of
+// the mean of I restores absolute image brightness.
+const (
+	pssmltDefaultChains               = 1000
+	pssmltDefaultBootstrapSamples     = 100000
+	pssmltDefaultLargeStepProbability = 0.3
+	// pssmltSigma is the standard deviation of a small-step perturbation of
+	// one primary sample.
+	pssmltSigma = 0.01
+	// The camera, light, and connection streams are interleaved in one
+	// primary sample vector.
+	pssmltStreamCount = 3
+)
+
+type pssmltPrimarySample struct {
+	value          float64
+	backup         float64
+	modified       int64
+	backupModified int64
+}
+
+// pssmltSampler owns the primary sample vector of one chain. Samples are
+// mutated lazily when a path first reads them in an iteration, so a path
+// that grows longer sees fresh values beyond the previous length.
+type pssmltSampler struct {
+	rng                  *rand.Rand
+	largeStepProbability float64
+	samples              []pssmltPrimarySample
+	iteration            int64
+	lastLargeStep        int64
+	largeStep            bool
+}
+
+func newPSSMLTSampler(rng *rand.Rand, largeStepProbability float64) *pssmltSampler {
+	// The first evaluation draws every sample from scratch.
+	return &pssmltSampler{rng: rng, largeStepProbability: largeStepProbability, largeStep: true}
+}
+
+func (s *pssmltSampler) startIteration() {
+	s.iteration++
+	s.largeStep = s.rng.Float64() < s.largeStepProbability
+}
+
+func (s *pssmltSampler) accept() {
+	if s.largeStep {
+		s.lastLargeStep = s.iteration
+	}
+}
+
+func (s *pssmltSampler) reject() {
+	for i := range s.samples {
+		if s.samples[i].modified == s.iteration {
+			s.samples[i].value = s.samples[i].backup
+			s.samples[i].modified = s.samples[i].backupModified
+		}
+	}
+	s.iteration--
+}
+
+func (s *pssmltSampler) get(index int) float64 {
+	for len(s.samples) <= index {
+		s.samples = append(s.samples, pssmltPrimarySample{})
+	}
+	sample := &s.samples[index]
+	if sample.modified < s.lastLargeStep {
+		// The sample was not read since the last accepted large step, which
+		// replaced it along with every other coordinate.
+		sample.value = s.rng.Float64()
+		sample.modified = s.lastLargeStep
+	}
+	sample.backup = sample.value
+	sample.backupModified = sample.modified
+	if s.largeStep {
+		sample.value = s.rng.Float64()
+	} else if steps := s.iteration - sample.modified; steps > 0 {
+		// Skipped iterations compose into one Gaussian with summed variance.
+		sample.value += s.rng.NormFloat64() * pssmltSigma * math.Sqrt(float64(steps))
+		sample.value -= math.Floor(sample.value)
+		if sample.value >= 1 {
+			sample.value = 0
+		}
+	}
+	sample.modified = s.iteration
+	return sample.value
+}
+
+// streams returns fresh readers for the current iteration.
+func (s *pssmltSampler) streams() bdptRandom {
+	return bdptRandom{
+		Camera:     &pssmltStream{sampler: s, stream: 0},
+		Light:      &pssmltStream{sampler: s, stream: 1},
+		Connection: &pssmltStream{sampler: s, stream: 2},
+	}
+}
+
+type pssmltStream struct {
+	sampler *pssmltSampler
+	stream  int
+	next    int
+}
+
+func (s *pssmltStream) Float64() float64 {
+	index := s.stream + pssmltStreamCount*s.next
+	s.next++
+	return s.sampler.get(index)
+}
+
+type pssmltChain struct {
+	sampler      *pssmltSampler
+	current      []FilmSplat
+	contribution float64
+}
+
+// pssmltKernel runs one mutation per work item. Work items are assigned to
+// chains round-robin, and every mutation draws from a generator keyed by its
+// work index. The kernel runs in rounds of one mutation per chain, so each
+// chain advances in work-index order while the chains mutate in parallel, and
+// every work item sees the same chain state regardless of worker scheduling.
+type pssmltKernel struct {
+	prepared             *bdptPreparedState
+	seed                 uint64
+	mutationSeed         uint64
+	largeStepProbability float64
+	normalization        float64
+	chains               []pssmltChain
+}
+
+func (k *pssmltKernel) Prepare(context *RenderContext) error {
+	if k == nil || context == nil {
+		return fmt.Errorf("PSSMLT kernel or render context is nil")
+	}
+	h := context.Handler
+	if h.PSSMLTChains < 0 || h.PSSMLTBootstrapSamples < 0 {
+		return fmt.Errorf("PSSMLT chain and bootstrap counts must be non-negative")
+	}
+	if h.PSSMLTLargeStepProbability < 0 || h.PSSMLTLargeStepProbability > 1 {
+		return fmt.Errorf("PSSMLT large step probability must be in [0, 1]")
+	}
+	state, err := prepareBDPTWork(context)
+	if err != nil {
+		return err
+	}
+	k.prepared = state
+	// The scene seed varies every chain; pssmlt_seed varies them alone.
+	k.seed = sampler.Hash(h.Seed, h.PSSMLTSeed)
+	k.mutationSeed = sampler.Hash(k.seed)
+	k.largeStepProbability = h.PSSMLTLargeStepProbability
+	if k.largeStepProbability == 0 {
+		k.largeStepProbability = pssmltDefaultLargeStepProbability
+	}
+	k.normalization = 0
+	k.chains = nil
+	if state.totalWork <= 0 || len(state.activePixels) == 0 {
+		return nil
+	}
+
+	bootstrapCount := h.PSSMLTBootstrapSamples
+	if bootstrapCount == 0 {
+		bootstrapCount = pssmltDefaultBootstrapSamples
+	}
+	cumulative := make([]float64, bootstrapCount)
+	runParallelWork(h.ThreadNum, bootstrapCount, splatWorkBatchSize, func(i int64) {
+		_, cumulative[i] = k.evaluate(context, k.bootstrapSampler(i))
+	})
+	for i := 1; i < len(cumulative); i++ {
+		cumulative[i] += cumulative[i-1]
+	}
+	total := cumulative[len(cumulative)-1]
+	if total <= 0 || math.IsNaN(total) || math.IsInf(total, 0) {
+		// Every bootstrap path missed the lights; the image is black.
+		h.warn("PSSMLT found no light in %d bootstrap samples; the image is black", bootstrapCount)
+		return nil
+	}
+	k.normalization = total / float64(bootstrapCount)
+
+	chainCount := h.PSSMLTChains
+	if chainCount == 0 {
+		chainCount = pssmltDefaultChains
+	}
+	k.chains = make([]pssmltChain, min(chainCount, state.totalWork))
+	runParallelWork(h.ThreadNum, int64(len(k.chains)), 1, func(c int64) {
+		// Chains start from bootstrap states chosen in proportion to their
+		// contribution, which is already the stationary distribution.
+		rng := rand.New(rand.NewPCG(k.seed, uint64(c)<<1|1))
+		target := rng.Float64() * total
+		index := sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > target })
+		index = min(index, len(cumulative)-1)
+		chain := &k.chains[c]
+		chain.sampler = k.bootstrapSampler(int64(index))
+		chain.current, chain.contribution = k.evaluate(context, chain.sampler)
+	})
+	return nil
+}
+
+// bootstrapSampler reproduces the independent sample a bootstrap index refers
+// to, which lets chains start from it without storing every bootstrap path.
+func (k *pssmltKernel) bootstrapSampler(index int64) *pssmltSampler {
+	return newPSSMLTSampler(rand.New(rand.NewPCG(k.seed, uint64(index)<<1)), k.largeStepProbability)
+}
+
+func (k *pssmltKernel) WorkCount(*RenderContext) int64 {
+	if k == nil || k.prepared == nil || len(k.chains) == 0 {
+		return 0
+	}
+	return k.prepared.totalWork
+}
+
+// RoundSize lets every chain run one mutation at a time: any chain-count
+// consecutive work items belong to distinct chains.
+func (k *pssmltKernel) RoundSize(*RenderContext) int64 {
+	return int64(len(k.chains))
+}
+
+func (k *pssmltKernel) TraceSample(context *RenderContext, workIndex int64) []FilmSplat {
+	if k == nil || len(k.chains) == 0 {
+		return nil
+	}
+	chain := &k.chains[workIndex%int64(len(k.chains))]
+	// The mutation continues from the chain's state with a stream of its own,
+	// so chains starting from one bootstrap state do not coincide.
+	chain.sampler.rng = rand.New(rand.NewPCG(k.mutationSeed, uint64(workIndex)))
+	chain.sampler.startIteration()
+	proposed, contribution := k.evaluate(context, chain.sampler)
+	acceptance := 1.0
+	if chain.contribution > 0 {
+		acceptance = min(1, contribution/chain.contribution)
+	}
+	// Expected-value splatting records both states, so rejected proposals
+	// still contribute.
+	splats := make([]FilmSplat, 0, len(proposed)+len(chain.current))
+	if contribution > 0 && acceptance > 0 {
+		splats = appendScaledSplats(splats, proposed, acceptance*k.normalization/contribution)
+	}
+	if chain.contribution > 0 && acceptance < 1 {
+		splats = appendScaledSplats(splats, chain.current, (1-acceptance)*k.normalization/chain.contribution)
+	}
+	if chain.sampler.rng.Float64() < acceptance {
+		chain.current, chain.contribution = proposed, contribution
+		chain.sampler.accept()
+	} else {
+		chain.sampler.reject()
+	}
+	return splats
+}
+
+// evaluate traces the BDPT sample the primary samples describe. The first
+// camera samples choose a raster position on the whole film and a
+// wavelength, so the chain can move between pixels; contributions outside
+// the active pixel windows are dropped and do not attract the chain.
+func (k *pssmltKernel) evaluate(context *RenderContext, sampler *pssmltSampler) ([]FilmSplat, float64) {
+	state := k.prepared
+	random := sampler.streams()
+	raster := []float64{
+		random.Camera.Float64()*float64(state.width) - 0.5,
+		random.Camera.Float64()*float64(state.height) - 0.5,
+	}
+	wavelength := context.Handler.wavelengthSampler().Sample(random.Camera.Float64())
+	wavelengthNM, wavelengthPDF := wavelength.LambdaNM, wavelength.PDF
+	local, remoteSplats := context.Handler.traceBidirectionalPrepared(
+		state.scene,
+		random,
+		context.Camera,
+		context.ObjectTree,
+		wavelengthNM,
+		wavelengthPDF,
+		raster,
+	)
+
+	splats := make([]FilmSplat, 0, 1+len(remoteSplats))
+	if validSpectrum(local) {
+		splats = append(splats, filterSplat(state.filter, FilmSplat{
+			WavelengthNM: wavelengthNM, WavelengthPDF: wavelengthPDF,
+			// The raster position is uniform over the whole film.
+			Value: local.MulScalar(float64(state.width * state.height)),
+		}, raster, state.width, state.height, state.activeMask)...)
+	}
+	for _, splat := range remoteSplats {
+		splats = append(splats, filterSplat(
+			state.filter, splat, splat.projection.Position, state.width, state.height, state.activeMask,
+		)...)
+	}
+
+	contribution := 0.0
+	for _, splat := range splats {
+		contribution += math.Abs(optics.SpectralSampleRadiance(splat.Value.Sample(0), splat.WavelengthPDF))
+	}
+	if math.IsNaN(contribution) || math.IsInf(contribution, 0) {
+		return nil, 0
+	}
+	return splats, contribution
+}
+
+func appendScaledSplats(dst, splats []FilmSplat, scale float64) []FilmSplat {
+	for _, splat := range splats {
+		splat.Value = splat.Value.MulScalar(scale)
+		dst = append(dst, splat)
+	}
+	return dst
+}
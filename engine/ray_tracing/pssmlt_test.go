@@ -0,0 +1,88 @@
+package ray_tracing
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func newPSSMLTTestHandler() *Handler {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPSSMLT
+	h.MaxRayLevel = 2
+	h.ThreadNum = 4
+	h.PSSMLTChains = 64
+	h.PSSMLTBootstrapSamples = 4096
+	return h
+}
+
+func TestPSSMLTSamplerRejectRestoresPrimarySamples(t *testing.T) {
+	sampler := newPSSMLTSampler(rand.New(rand.NewPCG(1, 2)), 0)
+	random := sampler.streams()
+	initial := []float64{random.Camera.Float64(), random.Light.Float64(), random.Camera.Float64()}
+
+	sampler.startIteration()
+	random = sampler.streams()
+	mutated := []float64{random.Camera.Float64(), random.Light.Float64(), random.Camera.Float64()}
+	for i := range initial {
+		if mutated[i] == initial[i] || mutated[i] < 0 || mutated[i] >= 1 {
+			t.Fatalf("sample %d = %g after a small step from %g", i, mutated[i], initial[i])
+		}
+		if distance := math.Abs(mutated[i] - initial[i]); math.Min(distance, 1-distance) > 10*pssmltSigma {
+			t.Fatalf("small step moved sample %d by %g", i, distance)
+		}
+	}
+	sampler.reject()
+
+	random = sampler.streams()
+	restored := []float64{random.Camera.Float64(), random.Light.Float64(), random.Camera.Float64()}
+	for i := range initial {
+		if restored[i] == mutated[i] {
+			t.Fatalf("sample %d kept rejected value %g", i, mutated[i])
+		}
+	}
+	if sampler.iteration != 0 {
+		t.Fatalf("iteration = %d after a rejected first mutation, want 0", sampler.iteration)
+	}
+}
+
+func TestPSSMLTMatchesBDPTOnDiffuseScene(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newPSSMLTTestHandler()
+	got := renderTestFilmEnergy(t, h, tree, 256)
+
+	h.IntegratorKind = IntegratorBDPT
+	reference := renderTestFilmEnergy(t, h, tree, 512)
+	if relative := math.Abs(got-reference) / reference; relative > 0.05 {
+		t.Fatalf("PSSMLT energy %g differs from BDPT %g by %.1f%%", got, reference, 100*relative)
+	}
+}
+
+func TestPSSMLTIsReproducibleForSeed(t *testing.T) {
+	tree := newSPPMTestScene()
+	render := func(seed uint64) []float64 {
+		h := newPSSMLTTestHandler()
+		h.PSSMLTSeed = seed
+		renderCamera := newBDPTTestCamera(t, 4, 4)
+		if err := h.TraceScene(renderCamera, tree, 16); err != nil {
+			t.Fatal(err)
+		}
+		values := make([]float64, 0)
+		for _, bin := range renderCamera.Film.SpectralBins {
+			values = append(values, bin.Data...)
+		}
+		return values
+	}
+
+	first, second, other := render(7), render(7), render(8)
+	differs := false
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("value %d = %g and %g for the same seed", i, first[i], second[i])
+		}
+		differs = differs || first[i] != other[i]
+	}
+	if !differs {
+		t.Fatal("a different seed rendered the same image")
+	}
+}
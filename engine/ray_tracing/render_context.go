@@ -1,6 +1,7 @@
 package ray_tracing
 
 import (
+	"context"
 	"github.com/Algo2147483647/ray/engine/model/object"
 	"math"
 	"sync"
@@ -15,6 +16,30 @@ type RenderContext struct {
 	Samples     int64
 	Handler     *Handler
 	Accumulator FilmAccumulator
+	// Ctx stops the render at the next tile or pass boundary once it is
+	// done; nil never stops it.
+	Ctx context.Context
+	// stopped records that the integrator ended early on Ctx and left a
+	// partial Film of stoppedSamples samples.
+	stopped        bool
+	stoppedSamples int64
+	// adaptive holds the per-pixel sample bounds while the pixel driver runs
+	// with adaptive sampling; nil otherwise.
+	adaptive *adaptiveSampling
+	// aovs records the configured AOVs while the pixel driver runs; nil
+	// otherwise.
+	aovs *aovRecorder
+}
+
+// done reports whether Ctx asks the render to stop.
+func (c *RenderContext) done() bool {
+	return c.Ctx != nil && c.Ctx.Err() != nil
+}
+
+// stop records that the render ended early with a Film of samples samples.
+func (c *RenderContext) stop(samples int64) {
+	c.stopped = true
+	c.stoppedSamples = samples
 }
 
 // FilmAccumulator hides the distinct synchronization requirements of
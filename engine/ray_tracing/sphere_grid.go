@@ -0,0 +1,49 @@
+package ray_tracing
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// sphereGrid hashes spheres by cell. Each sphere is stored in every cell it
+// overlaps, so a point query only checks its own cell. The cell size is the
+// largest sphere diameter, which bounds the cells per sphere at eight.
+type sphereGrid struct {
+	cellSize float64
+	cells    map[[3]int][]int32
+}
+
+func newSphereGrid(maxRadius float64) sphereGrid {
+	return sphereGrid{cellSize: 2 * maxRadius, cells: make(map[[3]int][]int32)}
+}
+
+func (g sphereGrid) insert(center *mat.VecDense, radius float64, index int32) {
+	if g.cellSize <= 0 || center == nil || center.Len() != 3 {
+		return
+	}
+	var lo, hi [3]int
+	for axis := range 3 {
+		lo[axis] = g.cell(center.AtVec(axis) - radius)
+		hi[axis] = g.cell(center.AtVec(axis) + radius)
+	}
+	for x := lo[0]; x <= hi[0]; x++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for z := lo[2]; z <= hi[2]; z++ {
+				key := [3]int{x, y, z}
+				g.cells[key] = append(g.cells[key], index)
+			}
+		}
+	}
+}
+
+func (g sphereGrid) cell(value float64) int {
+	return int(math.Floor(value / g.cellSize))
+}
+
+func (g sphereGrid) lookup(point *mat.VecDense) []int32 {
+	if g.cellSize <= 0 || point == nil || point.Len() != 3 {
+		return nil
+	}
+	return g.cells[[3]int{g.cell(point.AtVec(0)), g.cell(point.AtVec(1)), g.cell(point.AtVec(2))}]
+}
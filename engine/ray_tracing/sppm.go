@@ -0,0 +1,472 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// sppmAlpha is the fraction of newly gathered photons kept by each progressive
+// radius update. Smaller values shrink radii faster but converge more slowly.
+const sppmAlpha = 2.0 / 3.0
+
+// sppmRadiusPixels sets the default initial gather radius in pixel footprints,
+// measured on the bounds of the first pass's visible points.
+const sppmRadiusPixels = 2.0
+
+const sppmPhotonBatchSize int64 = 256
+
+// sppmSceneIntegrator runs stochastic progressive photon mapping. Every pass
+// shares one sampled wavelength between its camera and photon passes, so a
+// photon can always be gathered by a visible point. Progressive statistics are
+// shared by all wavelengths while the accumulated flux is kept per Film bin;
+// the Film receives one normalized estimate after the final pass.
+type sppmSceneIntegrator struct {
+	direct        *directLighting
+	filter        *camera.Filter
+	lights        *object.LightTree
+	activePixels  []int
+	pixels        []sppmPixel
+	passes        int64
+	photons       int64
+	initialRadius float64
+}
+
+type sppmPixel struct {
+	radius  float64
+	count   float64
+	tau     []float64
+	emitted []float64
+
+	visible sppmVisiblePoint
+	flux    float64
+	photons int64
+}
+
+// sppmGather is one photon's contribution to the visible point of a pixel.
+type sppmGather struct {
+	pixel int32
+	value float64
+}
+
+// sppmVisiblePoint is the first non-delta surface vertex of a camera path.
+// throughput keeps the camera-path weight in ray form, so photon contributions
+// use the same spectral/RGB conversion as next-event estimation; weight is
+// the reconstruction-filter weight of the camera sample.
+type sppmVisiblePoint struct {
+	valid      bool
+	level      int64
+	si         SurfaceInteraction
+	throughput optics.Ray
+	weight     float64
+}
+
+func (d *sppmSceneIntegrator) ConcurrentFilmWrites() bool { return false }
+
+func (d *sppmSceneIntegrator) EffectiveSampleCount(context *RenderContext) int64 {
+	return context.Handler.EffectiveSampleCount(context.Samples)
+}
+
+func (d *sppmSceneIntegrator) Run(context *RenderContext) error {
+	if d == nil {
+		return fmt.Errorf("SPPM integrator is nil")
+	}
+	if err := d.prepare(context); err != nil {
+		return err
+	}
+	if d.passes <= 0 || len(d.activePixels) == 0 || d.photons <= 0 {
+		return nil
+	}
+
+	progress := context.Handler.newProgressReporter("SPPM", "passes", d.passes)
+	defer progress.Close()
+	wavelengthSampler := context.Handler.wavelengthSampler()
+	passSampler := context.Handler.newSampler(samplerDomainPass, 0, d.passes)
+	for pass := range d.passes {
+		if context.done() {
+			// The wavelengths are stratified over every pass, so fewer
+			// passes would leave part of the spectrum unsampled.
+			context.stop(0)
+			return nil
+		}
+		passSampler.StartPixelSample(0, pass)
+		wavelength := wavelengthSampler.Sample((float64(pass) + passSampler.Float64()) / float64(d.passes))
+		d.traceVisiblePoints(context, pass, wavelength)
+		grid := d.buildGrid()
+		d.tracePhotons(context, grid, pass, wavelength)
+		d.update(context.Camera.GetFilm(), wavelength)
+		progress.Add(1)
+	}
+	d.writeFilm(context)
+	return nil
+}
+
+func (d *sppmSceneIntegrator) prepare(context *RenderContext) error {
+	h := context.Handler
+	if geometry.Get(h.SceneGeometry).Kind() != geometry.EuclideanKind {
+		return fmt.Errorf("SPPM requires three-dimensional Euclidean geometry")
+	}
+	film := context.Camera.GetFilm()
+	if !film.HasSpectralBins() {
+		return fmt.Errorf("SPPM Film spectral bins are not initialized")
+	}
+	if _, err := camera.NormalizePixelWindows(film.PixelWindows, film.Shape); err != nil {
+		return fmt.Errorf("SPPM pixel windows: %w", err)
+	}
+	if err := validateSPPMMedia(h, context.ObjectTree, film); err != nil {
+		return err
+	}
+	d.lights = context.ObjectTree.BuildLightTree()
+	if len(d.lights.Infinite) > 0 {
+		return fmt.Errorf("SPPM infinite lights are not implemented")
+	}
+	if err := checkInfiniteLightBounds(d.lights); err != nil {
+		return fmt.Errorf("SPPM %w", err)
+	}
+	if d.lights.Len() == 0 {
+		return fmt.Errorf("SPPM scene has no sampleable light")
+	}
+	d.direct = h.prepareDirectLighting(context.ObjectTree)
+	d.filter = h.pixelFilter()
+
+	mask := make([]bool, film.ElementCount())
+	if len(film.PixelWindows) == 0 {
+		for pixel := range mask {
+			mask[pixel] = true
+		}
+	} else {
+		mask, _ = buildPixelWindowMask(film.Shape, film.PixelWindows)
+	}
+	d.activePixels = d.activePixels[:0]
+	for pixel, active := range mask {
+		if active {
+			d.activePixels = append(d.activePixels, pixel)
+		}
+	}
+	d.pixels = make([]sppmPixel, len(d.activePixels))
+	for i := range d.pixels {
+		d.pixels[i].tau = make([]float64, len(film.SpectralBins))
+		d.pixels[i].emitted = make([]float64, len(film.SpectralBins))
+	}
+	d.passes = h.EffectiveSampleCount(context.Samples)
+	d.photons = h.SPPMPhotonsPerPass
+	if d.photons <= 0 {
+		d.photons = int64(len(d.activePixels))
+	}
+	d.initialRadius = h.SPPMInitialRadius
+	return nil
+}
+
+// validateSPPMMedia rejects volume scattering: visible points and photons are
+// surface records, so in-scattered radiance would silently go missing.
+func validateSPPMMedia(h *Handler, tree *object.ObjectTree, film *camera.Film) error {
+	media := getMediumRegistry(tree)
+	ctx := bxdf.ShadingContext{SpectrumMode: h.SpectrumMode}
+	for bin := range film.SpectralBins {
+		ctx.WavelengthsNM = append(ctx.WavelengthsNM, film.SpectralBinCenterNM(bin))
+	}
+	for _, id := range media.IDs() {
+		if resolveMediumCoefficients(media, id, ctx).Scatters() {
+			return fmt.Errorf("SPPM does not support participating-medium scattering")
+		}
+	}
+	return nil
+}
+
+func (d *sppmSceneIntegrator) traceVisiblePoints(context *RenderContext, pass int64, wavelength optics.WavelengthSample) {
+	film := context.Camera.GetFilm()
+	bin := film.SpectralBinIndex(wavelength.LambdaNM)
+	runParallelWork(context.Handler.ThreadNum, int64(len(d.pixels)), 1, func(i int64) {
+		pixel := &d.pixels[i]
+		coords := film.SpectralBins[0].GetCoordinates(d.activePixels[i])
+		rng := context.Handler.newSampler(samplerDomainCamera, filmWidth(film), d.passes)
+		rng.StartPixelSample(d.activePixels[i], pass)
+		raster, weight := filteredRaster(d.filter, rng, coords...)
+		visible, emitted := context.Handler.traceSPPMCameraPath(
+			rng, context.ObjectTree, context.Camera, d.direct, wavelength, raster,
+		)
+		visible.weight = weight
+		pixel.visible = visible
+		if bin >= 0 && emitted > 0 && isFinitePDF(emitted) {
+			pixel.emitted[bin] += optics.SpectralSampleRadiance(emitted, wavelength.PDF) * weight
+		}
+	})
+
+	if d.initialRadius <= 0 {
+		d.initialRadius = d.defaultRadius(film)
+	}
+	for i := range d.pixels {
+		if d.pixels[i].visible.valid && d.pixels[i].radius <= 0 {
+			d.pixels[i].radius = d.initialRadius
+		}
+	}
+}
+
+// defaultRadius spans sppmRadiusPixels pixel footprints of the visible-point
+// bounds. It stays zero until some camera path finds a visible point.
+func (d *sppmSceneIntegrator) defaultRadius(film *camera.Film) float64 {
+	points := make([]*mat.VecDense, 0, len(d.pixels))
+	for i := range d.pixels {
+		if d.pixels[i].visible.valid {
+			points = append(points, d.pixels[i].visible.si.Hit.Point)
+		}
+	}
+	return pixelFootprintRadius(points, film, sppmRadiusPixels)
+}
+
+// pixelFootprintRadius spans the given number of pixel footprints of the
+// bounding box of points, measured along its diagonal. It returns zero for no
+// points and one for a degenerate box.
+func pixelFootprintRadius(points []*mat.VecDense, film *camera.Film, pixels float64) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	var lo, hi [3]float64
+	for i, point := range points {
+		for axis := range 3 {
+			value := point.AtVec(axis)
+			if i == 0 || value < lo[axis] {
+				lo[axis] = value
+			}
+			if i == 0 || value > hi[axis] {
+				hi[axis] = value
+			}
+		}
+	}
+	diagonal := math.Sqrt((hi[0]-lo[0])*(hi[0]-lo[0]) + (hi[1]-lo[1])*(hi[1]-lo[1]) + (hi[2]-lo[2])*(hi[2]-lo[2]))
+	resolution := 1
+	for _, n := range film.Shape {
+		resolution = max(resolution, n)
+	}
+	radius := pixels * diagonal / float64(resolution)
+	if radius <= 0 || !isFinitePDF(radius) {
+		return 1
+	}
+	return radius
+}
+
+// traceSPPMCameraPath follows delta scattering from the camera to the first
+// surface with a continuous BSDF. Emission found on the way, and next-event
+// estimation at the visible point, are returned as directly estimated
+// radiance; photons provide every other contribution.
+func (h *Handler) traceSPPMCameraPath(
+	rng sampler.Sampler,
+	tree *object.ObjectTree,
+	renderCamera camera.RayCamera,
+	direct *directLighting,
+	wavelength optics.WavelengthSample,
+	raster []float64,
+) (sppmVisiblePoint, float64) {
+	ray := &optics.Ray{Geometry: h.SceneGeometry}
+	renderCamera.GenerateRayAt(ray, raster)
+	ray.SetSpectralSample(wavelength)
+	media := getMediumRegistry(tree)
+	emitted := 0.0
+
+	for level := int64(0); level <= h.MaxRayLevel; level++ {
+		hit, ok := surfaceHitInGeometry(tree, ray, ray.G())
+		maxDistance := math.Inf(1)
+		if ok {
+			maxDistance = hit.Distance
+		}
+		// validateSPPMMedia excludes scattering, so tracking only attenuates.
+		event, tracked := sampleMediumSegment(rng, media, ray, h.newShadingContext(ray), maxDistance)
+		if tracked {
+			applySpectrum(ray, event.Weight)
+			if event.Weight.IsZero() || event.Scattered {
+				break
+			}
+		}
+		if !ok {
+			break
+		}
+		if !tracked {
+			segmentLength := hit.ArcLength
+			if segmentLength <= 0 {
+				segmentLength = ray.G().ArcLengthFromEmbedT(ray.Origin, ray.Direction, hit.Distance)
+			}
+			applyMediumAbsorption(media, ray, segmentLength, h.newShadingContext(ray))
+		}
+
+		si, ok := h.prepareSurfaceInteraction(media, ray, hit)
+		if !ok {
+			break
+		}
+		if si.Object.Material.HasEmission() {
+			if le := si.Object.Material.Emission.Eval(si.Context, si.WoEmission); !le.IsZero() {
+				emitted += sppmRayScalar(*ray, le)
+			}
+		}
+		if !si.Object.Material.HasSurface() {
+			break
+		}
+		if !si.Object.Material.Surface.RoughnessInfo(si.Context).IsDelta {
+			if direct != nil && level < h.MaxRayLevel {
+				// Photons skip their first bounce when light sampling is
+				// available, so this estimate is the only direct strategy.
+				radiance := ray.Radiance
+				direct.estimateWith(rng, tree, h, ray, si.Context, func(toLight *mat.VecDense) (optics.Spectrum, float64, medium.MediumID) {
+					f, _, mediumID := surfaceLightScatter(ray, si, toLight)
+					return f, 0, mediumID
+				}, nil)
+				emitted += ray.Radiance - radiance
+			}
+			return sppmVisiblePoint{valid: true, level: level, si: si, throughput: *ray}, emitted
+		}
+
+		sample, ok := sampleSurface(rng, si.Object, si.Context, si.WoLocal)
+		if !ok {
+			break
+		}
+		applySurfaceSample(media, ray, si.Context, si.Object, sample)
+		si.Frame.LocalToWorldInto(ray.Direction, sample.Wi)
+		if !normalizeDirectionInGeometry(ray.G(), ray.Origin, ray.Direction) {
+			break
+		}
+	}
+	return sppmVisiblePoint{}, emitted
+}
+
+func (d *sppmSceneIntegrator) buildGrid() sphereGrid {
+	maxRadius := 0.0
+	for i := range d.pixels {
+		if d.pixels[i].visible.valid {
+			maxRadius = math.Max(maxRadius, d.pixels[i].radius)
+		}
+	}
+	grid := newSphereGrid(maxRadius)
+	for i := range d.pixels {
+		if pixel := &d.pixels[i]; pixel.visible.valid {
+			grid.insert(pixel.visible.si.Hit.Point, pixel.radius, int32(i))
+		}
+	}
+	return grid
+}
+
+// tracePhotons shoots light subpaths and gathers every continuous surface
+// vertex at the visible points within range. A photon's Beta is the flux it
+// carries into the vertex, so the visible point's BSDF completes the path.
+// Gathers are added in photon order to keep the flux sums reproducible.
+func (d *sppmSceneIntegrator) tracePhotons(context *RenderContext, grid sphereGrid, pass int64, wavelength optics.WavelengthSample) {
+	if len(grid.cells) == 0 {
+		return
+	}
+	firstVertex := 1
+	if d.direct != nil {
+		firstVertex = 2
+	}
+	runOrderedParallelWork(context.Handler.ThreadNum, d.photons, sppmPhotonBatchSize, func(j int64) []sppmGather {
+		rng := context.Handler.newSampler(samplerDomainLight, 0, d.passes)
+		rng.StartPixelSample(int(j), pass)
+		path := context.Handler.buildLightSubpath(
+			rng, context.ObjectTree, d.lights, wavelength.LambdaNM, wavelength.PDF,
+		)
+		var gathers []sppmGather
+		for i := firstVertex; i < len(path); i++ {
+			photon := &path[i]
+			if photon.Kind != bdptVertexSurface || !photon.Connectible {
+				continue
+			}
+			candidates := grid.lookup(photon.Point)
+			if len(candidates) == 0 {
+				continue
+			}
+			wi := directionBetween(photon.Point, path[i-1].Point)
+			if wi == nil {
+				continue
+			}
+			for _, index := range candidates {
+				// The merged path has i+level bounces; the visible point
+				// counts as the photon's vertex.
+				if pixel := &d.pixels[index]; int64(i)+pixel.visible.level <= context.Handler.MaxRayLevel {
+					if value, ok := d.gather(pixel, photon, wi); ok {
+						gathers = append(gathers, sppmGather{pixel: index, value: value})
+					}
+				}
+			}
+		}
+		return gathers
+	}, func(gathers []sppmGather) {
+		for _, gather := range gathers {
+			pixel := &d.pixels[gather.pixel]
+			pixel.flux += gather.value
+			pixel.photons++
+		}
+	})
+}
+
+func (d *sppmSceneIntegrator) gather(pixel *sppmPixel, photon *bdptVertex, wi *mat.VecDense) (float64, bool) {
+	visible := &pixel.visible
+	if squaredDistance(visible.si.Hit.Point, photon.Point) > pixel.radius*pixel.radius {
+		return 0, false
+	}
+	surface := visible.si.Object.Material.Surface
+	f := surface.Eval(visible.si.Context, visible.si.Frame.WorldToLocal(wi), visible.si.WoLocal)
+	if f.IsZero() {
+		return 0, false
+	}
+	value := sppmRayScalar(visible.throughput, f, photon.Beta)
+	if value <= 0 || !isFinitePDF(value) {
+		return 0, false
+	}
+	return value * visible.weight, true
+}
+
+// update applies the progressive radius reduction. The pass's flux enters the
+// bin of its wavelength; every bin is then rescaled by the same area ratio.
+func (d *sppmSceneIntegrator) update(film *camera.Film, wavelength optics.WavelengthSample) {
+	bin := film.SpectralBinIndex(wavelength.LambdaNM)
+	for i := range d.pixels {
+		pixel := &d.pixels[i]
+		if pixel.photons > 0 {
+			count := pixel.count + sppmAlpha*float64(pixel.photons)
+			ratio := count / (pixel.count + float64(pixel.photons))
+			if bin >= 0 {
+				pixel.tau[bin] += optics.SpectralSampleRadiance(pixel.flux, wavelength.PDF)
+			}
+			for b := range pixel.tau {
+				pixel.tau[b] *= ratio
+			}
+			pixel.count = count
+			pixel.radius *= math.Sqrt(ratio)
+		}
+		pixel.visible = sppmVisiblePoint{}
+		pixel.flux = 0
+		pixel.photons = 0
+	}
+}
+
+func (d *sppmSceneIntegrator) writeFilm(context *RenderContext) {
+	film := context.Camera.GetFilm()
+	passes := float64(d.passes)
+	for i := range d.pixels {
+		pixel := &d.pixels[i]
+		area := math.Pi * pixel.radius * pixel.radius
+		for bin := range pixel.tau {
+			value := pixel.emitted[bin] / passes
+			if area > 0 {
+				value += pixel.tau[bin] / (passes * float64(d.photons) * area)
+			}
+			if value != 0 {
+				context.Accumulator.AddSpectral(d.activePixels[i], film.SpectralBinCenterNM(bin), value)
+			}
+		}
+	}
+}
+
+// sppmRayScalar applies spectra to a copy of a path throughput and converts
+// the result to the ray's scalar wavelength sample.
+func sppmRayScalar(throughput optics.Ray, spectra ...optics.Spectrum) float64 {
+	for _, spectrum := range spectra {
+		applySpectrum(&throughput, spectrum)
+	}
+	return optics.SpectralRayToScalar(&throughput)
+}
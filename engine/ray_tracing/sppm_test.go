@@ -0,0 +1,119 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+// newSPPMTestScene places a diffuse screen in front of the BDPT test camera
+// and a diffuse wall behind it, lit by a small disk behind the camera, so the
+// image has direct and indirect illumination but no directly visible emitter.
+func newSPPMTestScene() *object.ObjectTree {
+	tree := (&object.ObjectTree{}).Build()
+	lambert := &material.Material{Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.6)))}
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, 1}), B: -3},
+		Material: lambert,
+	})
+	tree.AddObject(&object.Object{
+		Shape:    &shape.Plane{A: mat.NewVecDense(3, []float64{0, 0, 1}), B: 1},
+		Material: lambert,
+	})
+	tree.AddObject(&object.Object{
+		Shape: shape.NewCircle(
+			mat.NewVecDense(3, []float64{0.3, 0, -0.5}),
+			mat.NewVecDense(3, []float64{0, 0, 1}),
+			0.2,
+		),
+		Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(4))},
+	})
+	tree.Build()
+	return tree
+}
+
+func renderTestFilmEnergy(t *testing.T, h *Handler, tree *object.ObjectTree, samples int64) float64 {
+	t.Helper()
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	if err := h.TraceScene(renderCamera, tree, samples); err != nil {
+		t.Fatalf("%s render: %v", h.IntegratorKind, err)
+	}
+	energy := 0.0
+	for _, bin := range renderCamera.Film.SpectralBins {
+		for _, value := range bin.Data {
+			energy += value
+		}
+	}
+	return energy
+}
+
+func TestSPPMMatchesBDPTOnDiffuseScene(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.MaxRayLevel = 2
+	h.ThreadNum = 4
+	reference := renderTestFilmEnergy(t, h, tree, 512)
+
+	h.IntegratorKind = IntegratorSPPM
+	h.SPPMPhotonsPerPass = 1024
+	h.SPPMInitialRadius = 0.2
+	// Without light sampling every direct contribution comes from photons;
+	// the looser bound still catches a missing or doubled first bounce.
+	for _, test := range []struct {
+		nee       bool
+		tolerance float64
+	}{{true, 0.06}, {false, 0.2}} {
+		h.NextEventEstimation = test.nee
+		got := renderTestFilmEnergy(t, h, tree, 64)
+		if relative := math.Abs(got-reference) / reference; relative > test.tolerance {
+			t.Fatalf("SPPM (NEE %v) energy %g differs from BDPT %g by %.1f%%", test.nee, got, reference, 100*relative)
+		}
+	}
+}
+
+func TestSPPMShrinksGatherRadius(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.ThreadNum = 2
+	h.SPPMPhotonsPerPass = 1024
+	h.SPPMInitialRadius = 0.5
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	integrator := &sppmSceneIntegrator{}
+	context := &RenderContext{
+		Handler: h, Camera: renderCamera, ObjectTree: tree, Samples: 8,
+		Accumulator: newFilmAccumulator(renderCamera.Film, false),
+	}
+	if err := integrator.Run(context); err != nil {
+		t.Fatal(err)
+	}
+	for i := range integrator.pixels {
+		if radius := integrator.pixels[i].radius; radius <= 0 || radius >= 0.5 {
+			t.Fatalf("pixel %d radius = %g, want in (0, 0.5)", i, radius)
+		}
+	}
+}
+
+func TestSPPMRejectsParticipatingMediumScattering(t *testing.T) {
+	tree := newSPPMTestScene()
+	registry := medium.NewRegistry()
+	if _, err := registry.RegisterHomogeneousWithCoefficients(
+		"fog", medium.NewConstant(1), nil, medium.ConstantCoefficient(0.1),
+	); err != nil {
+		t.Fatal(err)
+	}
+	tree.Media = registry
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorSPPM
+	if err := h.TraceScene(newBDPTTestCamera(t, 2, 2), tree, 1); err == nil {
+		t.Fatal("expected SPPM to reject a scattering medium")
+	}
+}
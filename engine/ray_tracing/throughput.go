@@ -1,6 +1,7 @@
 package ray_tracing
 
 import (
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
 	"github.com/Algo2147483647/ray/engine/model/optics"
 	renderray "github.com/Algo2147483647/ray/engine/model/optics"
 	"math"
@@ -13,6 +14,16 @@ func applySpectrum(ray *renderray.Ray, spectrum optics.Spectrum) {
 		if spectrum.HasSamples() {
 			ray.SpectralPower *= spectrum.Sample(0)
 			ray.SpectralPath = true
+			companions := ray.FollowingCompanions()
+			if spectrum.SampleCount() != len(companions)+1 {
+				// Evaluated at the hero wavelength alone, the spectrum says
+				// nothing about the companions.
+				ray.SplitBundle()
+				return
+			}
+			for i := range companions {
+				companions[i].SpectralPower *= spectrum.Sample(i + 1)
+			}
 			return
 		}
 		ray.RGBCompatibility = ray.RGBCompatibility.Mul(spectrum.RGB)
@@ -27,12 +38,31 @@ func applySpectrum(ray *renderray.Ray, spectrum optics.Spectrum) {
 	ray.Color = ray.Color.Mul(spectrum.RGB)
 }
 
+// shiftWavelength moves the wavelength of ray, which carries no companions,
+// to wavelengthNM. RGB compatibility factors gathered so far are settled at
+// the old wavelength first.
+func shiftWavelength(ray *renderray.Ray, wavelengthNM float64) {
+	if ray.RGBCompatibilityPath {
+		ray.SpectralPower *= optics.NewRGBSpectrum(
+			ray.RGBCompatibility[0],
+			ray.RGBCompatibility[1],
+			ray.RGBCompatibility[2],
+		).RGBPowerAtWavelength(ray.WaveLength)
+		ray.RGBCompatibility = optics.RGB{1, 1, 1}
+		ray.RGBCompatibilityPath = false
+	}
+	ray.WaveLength = wavelengthNM
+}
+
 func terminateRay(ray *renderray.Ray) {
 	if ray == nil {
 		return
 	}
 	ray.Color = optics.RGB{}
 	ray.SpectralPower = 0
+	for i := range ray.Companions[:ray.CompanionCount] {
+		ray.Companions[i].SpectralPower = 0
+	}
 	ray.SpectralPath = false
 	ray.RGBCompatibilityPath = false
 	ray.RGBCompatibility = optics.RGB{}
@@ -45,6 +75,9 @@ func russianRouletteSurvivalProbability(ray *renderray.Ray) float64 {
 	}
 	if ray.WaveLength > 0 {
 		throughput := finiteNonNegative(ray.SpectralPower)
+		for _, companion := range ray.FollowingCompanions() {
+			throughput = math.Max(throughput, finiteNonNegative(companion.SpectralPower))
+		}
 		if ray.RGBCompatibilityPath {
 			throughput *= maxRGBChannel(ray.RGBCompatibility)
 		}
@@ -59,11 +92,46 @@ func scaleRayThroughput(ray *renderray.Ray, scale float64) {
 	}
 	if ray.WaveLength > 0 {
 		ray.SpectralPower *= scale
+		companions := ray.FollowingCompanions()
+		for i := range companions {
+			companions[i].SpectralPower *= scale
+		}
 		return
 	}
 	ray.Color = ray.Color.MulScalar(scale)
 }
 
+// gatherRadiance adds to ray.Radiance, and to the radiance of each of its
+// companions, the throughput of contribution: a copy of ray weighted for one
+// light connection. A polarized contribution also adds its S1..S3 to
+// ray.StokesRadiance.
+func gatherRadiance(ray, contribution *renderray.Ray) {
+	if value := optics.SpectralRayToScalar(contribution); value > 0 && isFinitePDF(value) {
+		ray.Radiance += value
+		stokes := optics.PolarizedRayToScalars(contribution)
+		for k := range stokes {
+			ray.StokesRadiance[k] += stokes[k]
+		}
+	}
+	for i := range ray.Companions[:ray.CompanionCount] {
+		if value := optics.CompanionRayToScalar(contribution, i); value > 0 && isFinitePDF(value) {
+			ray.Companions[i].Radiance += value
+		}
+	}
+}
+
+// bundleSpectrum is value at every wavelength ctx samples.
+func bundleSpectrum(ctx bxdf.ShadingContext, value float64) optics.Spectrum {
+	if len(ctx.WavelengthsNM) == 0 {
+		return optics.ConstantSpectrum(value)
+	}
+	samples := make([]float64, len(ctx.WavelengthsNM))
+	for i := range samples {
+		samples[i] = value
+	}
+	return optics.NewSampledSpectrum(samples)
+}
+
 func maxRGBChannel(v optics.RGB) float64 {
 	maxValue := 0.0
 	for i := 0; i < 3; i++ {
@@ -1,8 +1,7 @@
 package ray_tracing
 
 import (
-	"math/rand/v2"
-
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	rendercamera "github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/object"
 	"github.com/Algo2147483647/ray/engine/model/optics"
@@ -11,29 +10,121 @@ import (
 const defaultWavelengthSamples = 4
 
 type pixelKernel interface {
-	sampleSpectral(*Handler, rendercamera.RayCamera, *object.ObjectTree, *optics.Ray, optics.WavelengthSample, ...int) rendercamera.SpectralSample
+	prepare(*RenderContext) error
+	sampleSpectral(*Handler, sampler.Sampler, rendercamera.RayCamera, *object.ObjectTree, *optics.Ray, optics.WavelengthSample, *aovPixel, ...int) rendercamera.SpectralSample
 }
 
-type pathTracingKernel struct{}
+// bundleKernel is a pixelKernel whose paths carry hero-wavelength bundles. In
+// hero-wavelength mode each camera sample follows a hero wavelength with its
+// companions and reports a sample for every wavelength of the bundle.
+type bundleKernel interface {
+	sampleBundle(*Handler, sampler.Sampler, rendercamera.RayCamera, *object.ObjectTree, *optics.Ray, []optics.WavelengthSample, *aovPixel, []rendercamera.SpectralSample, ...int) []rendercamera.SpectralSample
+}
 
-func (pathTracingKernel) sampleSpectral(
+type pathTracingKernel struct {
+	direct *directLighting
+	filter *rendercamera.Filter
+	// guide is learned in prepare when path guiding is on; nil otherwise.
+	guide *pathGuide
+	// polarized paths carry Stokes vectors and report their S1..S3.
+	polarized bool
+}
+
+func newPathTracingKernel(h *Handler, objTree *object.ObjectTree) *pathTracingKernel {
+	return &pathTracingKernel{direct: h.preparePathLighting(objTree), filter: h.pixelFilter(), polarized: h.polarizedPaths()}
+}
+
+func (k *pathTracingKernel) prepare(context *RenderContext) error {
+	k.direct = context.Handler.preparePathLighting(context.ObjectTree)
+	k.filter = context.Handler.pixelFilter()
+	k.polarized = context.Handler.polarizedPaths()
+	k.trainGuide(context)
+	return nil
+}
+
+func (k *pathTracingKernel) sampleSpectral(
 	h *Handler,
+	pixelSampler sampler.Sampler,
 	renderCamera rendercamera.RayCamera,
 	objTree *object.ObjectTree,
 	ray *optics.Ray,
 	wavelength optics.WavelengthSample,
+	aovs *aovPixel,
 	index ...int,
 ) rendercamera.SpectralSample {
-	renderCamera.GenerateRay(ray, index...)
-	ray.SetSpectralSample(wavelength)
-	h.TraceRay(objTree, ray, 0)
-	return rendercamera.SpectralSample{
-		WavelengthNM: wavelength.LambdaNM,
+	var sample [1]rendercamera.SpectralSample
+	return k.trace(h, pixelSampler, renderCamera, objTree, ray, []optics.WavelengthSample{wavelength}, nil, aovs, sample[:0], index...)[0]
+}
+
+func (k *pathTracingKernel) sampleBundle(
+	h *Handler,
+	pixelSampler sampler.Sampler,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	bundle []optics.WavelengthSample,
+	aovs *aovPixel,
+	spectralSamples []rendercamera.SpectralSample,
+	index ...int,
+) []rendercamera.SpectralSample {
+	return k.trace(h, pixelSampler, renderCamera, objTree, ray, bundle, nil, aovs, spectralSamples, index...)
+}
+
+// trace follows one camera ray carrying bundle, a hero wavelength and its
+// companions, and appends a sample for each wavelength of the bundle. It
+// records the guided vertices of the path into recorder and its first hit and
+// albedo into aovs unless they are nil.
+// Mueller matrices depend on the wavelength, so polarized paths carry the
+// hero alone. Fluorescent surfaces may shift the path to another wavelength;
+// its samples still land at the wavelengths it started from.
+func (k *pathTracingKernel) trace(
+	h *Handler,
+	pixelSampler sampler.Sampler,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	bundle []optics.WavelengthSample,
+	recorder *guideRecorder,
+	aovs *aovPixel,
+	spectralSamples []rendercamera.SpectralSample,
+	index ...int,
+) []rendercamera.SpectralSample {
+	aovs.startPath()
+	raster, weight := filteredRaster(k.filter, pixelSampler, index...)
+	renderCamera.GenerateRayAt(ray, raster)
+	if k.polarized {
+		bundle = bundle[:1]
+		startPolarizedRay(ray, renderCamera)
+	}
+	ray.SetHeroBundle(bundle)
+	ray.WavelengthShifts = true
+	h.traceGuidedRay(pixelSampler, objTree, ray, 0, k.direct, pathScatterState{}, k.guide, recorder, aovs)
+	hero := rendercamera.SpectralSample{
+		WavelengthNM: bundle[0].LambdaNM,
 		Value: optics.SpectralSampleRadiance(
-			optics.SpectralRayToScalar(ray),
+			ray.Radiance+optics.SpectralRayToScalar(ray),
 			ray.WavelengthPDF,
 		),
+		Weight: weight,
+	}
+	if ray.Polarized {
+		stokes := optics.PolarizedRayToScalars(ray)
+		for i := range stokes {
+			hero.Polarization[i] = optics.SpectralSampleRadiance(ray.StokesRadiance[i]+stokes[i], ray.WavelengthPDF)
+		}
 	}
+	spectralSamples = append(spectralSamples, hero)
+	for i, companion := range ray.Companions[:ray.CompanionCount] {
+		spectralSamples = append(spectralSamples, rendercamera.SpectralSample{
+			WavelengthNM: bundle[i+1].LambdaNM,
+			Value: optics.SpectralSampleRadiance(
+				companion.Radiance+optics.CompanionRayToScalar(ray, i),
+				companion.WavelengthPDF,
+			),
+			Weight: weight,
+		})
+	}
+	return spectralSamples
 }
 
 func (h *Handler) tracePixel(
@@ -42,15 +133,28 @@ func (h *Handler) tracePixel(
 	pixel int,
 	index ...int,
 ) {
-	for _, sample := range h.traceSpectral(
+	if context.adaptive != nil {
+		h.traceAdaptivePixel(kernel, context, pixel, index...)
+		return
+	}
+	aovs := context.aovs.pixel(pixel)
+	samples, weightSum := h.traceSpectral(
 		kernel,
+		h.newSampler(samplerDomainCamera, filmWidth(context.Camera.GetFilm()), h.EffectiveSampleCount(context.Samples)),
+		pixel,
 		context.Camera,
 		context.ObjectTree,
 		context.Samples,
+		aovs,
 		index...,
-	) {
+	)
+	for _, sample := range samples {
 		context.Accumulator.AddSpectral(pixel, sample.WavelengthNM, sample.Value)
 	}
+	if weights := context.Camera.GetFilm().FilterWeights; weights != nil {
+		weights[pixel] = weightSum
+	}
+	aovs.finish(context.Samples, samples)
 }
 
 func (h *Handler) TraceSpectral(
@@ -59,55 +163,103 @@ func (h *Handler) TraceSpectral(
 	samples int64,
 	index ...int,
 ) []rendercamera.SpectralSample {
-	return h.traceSpectral(pathTracingKernel{}, renderCamera, objTree, samples, index...)
+	spectralSamples, _ := h.traceSpectral(
+		newPathTracingKernel(h, objTree),
+		h.newSampler(samplerDomainCamera, filmWidth(renderCamera.GetFilm()), h.EffectiveSampleCount(samples)),
+		pixelOffset(renderCamera.GetFilm().Shape, index),
+		renderCamera, objTree, samples, nil, index...,
+	)
+	return spectralSamples
 }
 
+// traceSpectral restarts pixelSampler for every camera sample of the pixel,
+// so each sample's numbers are fixed by the seed, the pixel, and its index.
+// It returns the pixel's filter-weighted samples and their weight sum, and
+// reports the pixel's paths to aovs unless it is nil.
 func (h *Handler) traceSpectral(
 	kernel pixelKernel,
+	pixelSampler sampler.Sampler,
+	pixel int,
 	renderCamera rendercamera.RayCamera,
 	objTree *object.ObjectTree,
 	samples int64,
+	aovs *aovPixel,
 	index ...int,
-) []rendercamera.SpectralSample {
+) ([]rendercamera.SpectralSample, float64) {
 	ray := h.RayPool.Get().(*optics.Ray)
 	ray.Geometry = h.SceneGeometry
 	defer h.RayPool.Put(ray)
 
-	wavelengthSampler := h.wavelengthSampler()
 	spectralSamples := make([]rendercamera.SpectralSample, 0, h.estimatedSpectralSampleCount(samples))
+	for s := int64(0); s < samples; s++ {
+		spectralSamples = h.traceCameraSample(
+			kernel, pixelSampler, pixel, renderCamera, objTree, ray, s, aovs, spectralSamples, index...,
+		)
+	}
 
+	return spectralSamples, normalizeSpectralSamples(spectralSamples)
+}
+
+// traceCameraSample appends the unnormalized spectral samples of camera
+// sample s of pixel: one stratified wavelength per stratum in sampled mode,
+// or in hero-wavelength mode the hero wavelength, followed by its companions
+// when the kernel carries bundles.
+func (h *Handler) traceCameraSample(
+	kernel pixelKernel,
+	pixelSampler sampler.Sampler,
+	pixel int,
+	renderCamera rendercamera.RayCamera,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	s int64,
+	aovs *aovPixel,
+	spectralSamples []rendercamera.SpectralSample,
+	index ...int,
+) []rendercamera.SpectralSample {
+	wavelengthSampler := h.wavelengthSampler()
 	switch h.SpectrumMode {
 	case optics.SpectrumModeSampledWavelengths:
 		wavelengthSamples := h.wavelengthSampleCount()
-
-		for s := int64(0); s < samples; s++ {
-			wavelengthBatch := make([]rendercamera.SpectralSample, 0, wavelengthSamples)
-
-			for w := 0; w < wavelengthSamples; w++ {
-				u := (float64(w) + rand.Float64()) / float64(wavelengthSamples)
-
-				wavelengthBatch = append(wavelengthBatch, kernel.sampleSpectral(
-					h, renderCamera, objTree, ray, wavelengthSampler.Sample(u), index...,
-				))
-			}
-
-			spectralSamples = append(spectralSamples, wavelengthBatch...)
+		for w := 0; w < wavelengthSamples; w++ {
+			pixelSampler.StartPixelSample(pixel, s*int64(wavelengthSamples)+int64(w))
+			u := (float64(w) + wavelengthUniform(pixelSampler)) / float64(wavelengthSamples)
+			spectralSamples = append(spectralSamples, kernel.sampleSpectral(
+				h, pixelSampler, renderCamera, objTree, ray, wavelengthSampler.Sample(u), aovs, index...,
+			))
 		}
 
 	case optics.SpectrumModeHeroWavelength:
-		for s := int64(0); s < samples; s++ {
-			spectralSamples = append(spectralSamples, kernel.sampleSpectral(
-				h, renderCamera, objTree, ray, wavelengthSampler.Sample(rand.Float64()), index...,
-			))
+		pixelSampler.StartPixelSample(pixel, s)
+		u := wavelengthUniform(pixelSampler)
+		if bundled, ok := kernel.(bundleKernel); ok {
+			spectralSamples = bundled.sampleBundle(
+				h, pixelSampler, renderCamera, objTree, ray, heroBundle(wavelengthSampler, u), aovs, spectralSamples, index...,
+			)
+			break
 		}
+		spectralSamples = append(spectralSamples, kernel.sampleSpectral(
+			h, pixelSampler, renderCamera, objTree, ray, wavelengthSampler.Sample(u), aovs, index...,
+		))
 
 	default:
 	}
-
-	normalizeSpectralSamples(spectralSamples)
 	return spectralSamples
 }
 
+// heroBundle stratifies optics.HeroBundleSize wavelengths by rotating u, the
+// sample of the hero wavelength, in steps of 1 / optics.HeroBundleSize.
+func heroBundle(wavelengthSampler optics.WavelengthSampler, u float64) []optics.WavelengthSample {
+	bundle := make([]optics.WavelengthSample, optics.HeroBundleSize)
+	for i := range bundle {
+		ui := u + float64(i)/float64(len(bundle))
+		if ui >= 1 {
+			ui--
+		}
+		bundle[i] = wavelengthSampler.Sample(ui)
+	}
+	return bundle
+}
+
 func (h *Handler) TraceSpectralSample(
 	renderCamera rendercamera.RayCamera,
 	objTree *object.ObjectTree,
@@ -116,8 +268,10 @@ func (h *Handler) TraceSpectralSample(
 	u float64,
 	index ...int,
 ) rendercamera.SpectralSample {
-	return pathTracingKernel{}.sampleSpectral(
-		h, renderCamera, objTree, ray, wavelengthSampler.Sample(u), index...,
+	pixelSampler := h.newSampler(samplerDomainCamera, filmWidth(renderCamera.GetFilm()), 1)
+	pixelSampler.StartPixelSample(pixelOffset(renderCamera.GetFilm().Shape, index), 0)
+	return newPathTracingKernel(h, objTree).sampleSpectral(
+		h, pixelSampler, renderCamera, objTree, ray, wavelengthSampler.Sample(u), nil, index...,
 	)
 }
 
@@ -135,16 +289,39 @@ func (h *Handler) estimatedSpectralSampleCount(samples int64) int {
 	} else if h.SpectrumMode == optics.SpectrumModeSampledWavelengths {
 		return int(samples) * h.wavelengthSampleCount()
 	}
-	return int(samples)
+	return int(samples) * optics.HeroBundleSize
 }
 
-func normalizeSpectralSamples(samples []rendercamera.SpectralSample) {
-	if len(samples) == 0 {
-		return
+// normalizeSpectralSamples turns the samples of a pixel into terms of their
+// filter-weighted mean and returns the weight sum. With unit weights this is
+// the plain mean. Negative filter lobes can cancel the sum, which leaves the
+// pixel black.
+func normalizeSpectralSamples(samples []rendercamera.SpectralSample) float64 {
+	weightSum := 0.0
+	for _, sample := range samples {
+		weightSum += sample.Weight
+	}
+	scale := 0.0
+	if weightSum != 0 {
+		scale = 1 / weightSum
 	}
-
-	scale := 1.0 / float64(len(samples))
 	for i := range samples {
-		samples[i].Value *= scale
+		samples[i].Value *= samples[i].Weight * scale
+		for k := range samples[i].Polarization {
+			samples[i].Polarization[k] *= samples[i].Weight * scale
+		}
+	}
+	return weightSum
+}
+
+// pixelOffset is the Film element index of pixel coordinates, the inverse of
+// Tensor.GetCoordinates.
+func pixelOffset(shape []int, index []int) int {
+	offset := 0
+	for i, stride := range pixelStrides(shape) {
+		if i < len(index) {
+			offset += index[i] * stride
+		}
 	}
+	return offset
 }
@@ -3,6 +3,7 @@ package ray_tracing
 import (
 	"github.com/Algo2147483647/ray/engine/maths"
 	"github.com/Algo2147483647/ray/engine/maths/geometry"
+	"github.com/Algo2147483647/ray/engine/model/light"
 	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
 	"github.com/Algo2147483647/ray/engine/model/material/medium"
 	"github.com/Algo2147483647/ray/engine/model/object"
@@ -10,7 +11,7 @@ import (
 	"github.com/Algo2147483647/ray/engine/utils"
 	"gonum.org/v1/gonum/mat"
 	"math"
-	"math/rand/v2"
+	"sync"
 )
 
 type SurfaceInteraction struct {
@@ -23,46 +24,151 @@ type SurfaceInteraction struct {
 	Context       bxdf.ShadingContext
 }
 
+// TraceRay follows a path by BSDF sampling alone. The path integrator kernel
+// additionally enables next-event estimation through traceRay.
 func (h *Handler) TraceRay(objTree *object.ObjectTree, ray *optics.Ray, level int64) {
-	if h.terminateBeforeBounce(ray, level) {
-		return
+	h.traceRay(globalUniform{}, objTree, ray, level, nil, pathScatterState{})
+}
+
+// pathState is a camera path between two segments. The scratch interaction
+// and scatter origin are overwritten at every vertex and, through
+// pathStatePool, reused by later paths.
+type pathState struct {
+	rng           uniformSource
+	objTree       *object.ObjectTree
+	media         *medium.Registry
+	ray           *optics.Ray
+	level         int64
+	direct        *directLighting
+	previous      pathScatterState
+	guide         *pathGuide
+	recorder      *guideRecorder
+	aovs          *aovPixel
+	si            SurfaceInteraction // interaction at the current surface vertex
+	scatterOrigin *mat.VecDense      // backs previous.Origin once the path scatters
+}
+
+var pathStatePool = sync.Pool{
+	New: func() interface{} { return &pathState{} },
+}
+
+// scatteredFrom records that the next segment leaves the current ray origin
+// in a direction sampled with pdf.
+func (p *pathState) scatteredFrom(pdf float64, delta, lightSampled bool) {
+	if p.scatterOrigin == nil || p.scatterOrigin.Len() != p.ray.Origin.Len() {
+		p.scatterOrigin = mat.NewVecDense(p.ray.Origin.Len(), nil)
+	}
+	p.scatterOrigin.CopyVec(p.ray.Origin)
+	p.previous = pathScatterState{
+		Origin:       p.scatterOrigin,
+		PDF:          pdf,
+		Delta:        delta,
+		LightSampled: lightSampled,
 	}
+}
+
+// release returns p to pathStatePool, keeping only its scratch buffers.
+func (p *pathState) release() {
+	*p = pathState{
+		si:            SurfaceInteraction{Frame: p.si.Frame, EmissionFrame: p.si.EmissionFrame},
+		scatterOrigin: p.scatterOrigin,
+	}
+	pathStatePool.Put(p)
+}
 
+// traceRay follows ray from bounce level until the path terminates, one
+// segment per iteration.
+func (h *Handler) traceRay(
+	rng uniformSource,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	level int64,
+	direct *directLighting,
+	previous pathScatterState,
+) {
+	h.traceGuidedRay(rng, objTree, ray, level, direct, previous, nil, nil, nil)
+}
+
+// traceGuidedRay is traceRay that mixes BSDF sampling with guide, records the
+// guided vertices of the path into recorder, and reports the path's first hit
+// and albedo to aovs; any of them may be nil.
+func (h *Handler) traceGuidedRay(
+	rng uniformSource,
+	objTree *object.ObjectTree,
+	ray *optics.Ray,
+	level int64,
+	direct *directLighting,
+	previous pathScatterState,
+	guide *pathGuide,
+	recorder *guideRecorder,
+	aovs *aovPixel,
+) {
+	path := pathStatePool.Get().(*pathState)
+	defer path.release()
+	path.rng = rng
+	path.objTree = objTree
+	path.media = getMediumRegistry(objTree)
+	path.ray = ray
+	path.direct = direct
+	path.previous = previous
+	path.guide = guide
+	path.recorder = recorder
+	path.aovs = aovs
+
+	for path.level = level; !h.terminateBeforeBounce(rng, ray, path.level); path.level++ {
+		if !h.tracePathSegment(path) {
+			break
+		}
+	}
+	recorder.finish(ray)
+}
+
+// tracePathSegment traces the path's ray to its next vertex and scatters it
+// there. It reports whether the path continues with another segment.
+func (h *Handler) tracePathSegment(path *pathState) bool {
+	rng, ray := path.rng, path.ray
 	g := ray.G()
 
 	// Find the closest surface intersection along the current ray.
-	hit, ok := surfaceHitInGeometry(objTree, ray, g)
+	hit, ok := surfaceHitInGeometry(path.objTree, ray, g)
+	path.aovs.surfaceHit(g, ray, hit, ok)
+
+	// In a scattering or heterogeneous medium, sample the segment before the
+	// surface. A scattering event replaces the surface interaction entirely.
+	maxDistance := math.Inf(1)
+	if ok {
+		maxDistance = hit.Distance
+	}
+	event, tracked := sampleMediumSegment(rng, path.media, ray, h.newShadingContext(ray), maxDistance)
+	if tracked {
+		applySpectrum(ray, event.Weight)
+		if event.Weight.IsZero() {
+			terminateRay(ray)
+			return false
+		}
+		if event.Scattered {
+			path.aovs.scatteredInMedium()
+			return h.scatterPathInMedium(path, event.Distance)
+		}
+	}
+
 	if !ok {
-		// Spherical: the current half-great-circle reached the antipode without
-		// hitting anything; wrap and continue tracing if we still have arc budget.
-		if newO, newD, wrapped := g.WrapBeyond(ray.Origin, ray.Direction, math.Pi); wrapped {
-			advance := math.Pi
-			if h.MaxArc > 0 && ray.ArcTraveled+advance > h.MaxArc {
-				terminateRay(ray)
-				return
-			}
-			ray.Origin.CopyVec(newO)
-			ray.Direction.CopyVec(newD)
-			ray.ArcTraveled += advance
-			h.TraceRay(objTree, ray, level+1)
-			return
+		if h.escapeToInfiniteLights(path, g) {
+			return false
 		}
-		terminateRay(ray)
-		return
+		return h.wrapAtAntipode(ray, g)
 	}
 
 	// Translate the embedded-domain ray parameter into geodesic arc length
 	// before doing anything physical with it (absorption, direction update,
 	// arc-budget bookkeeping).
-	arcLen := hit.ArcLength
-	if arcLen <= 0 {
-		arcLen = g.ArcLengthFromEmbedT(ray.Origin, ray.Direction, hit.Distance)
-	}
+	arcLen := hitArcLength(g, ray, hit)
 
-	// Apply medium absorption accumulated along the segment before the hit point.
-	media := getMediumRegistry(objTree)
-	mediumCtx := h.newShadingContext(ray)
-	applyMediumAbsorption(media, ray, arcLen, mediumCtx)
+	// Apply medium absorption accumulated along the segment before the hit
+	// point, unless medium sampling already weighted the segment.
+	if !tracked {
+		applyMediumAbsorption(path.media, ray, arcLen, h.newShadingContext(ray))
+	}
 
 	// Track total geodesic distance traveled (used by the S^3 wrap loop and
 	// as a fail-safe even on flat geometries).
@@ -71,7 +177,7 @@ func (h *Handler) TraceRay(objTree *object.ObjectTree, ray *optics.Ray, level in
 	// Geodesic-budget kill (used primarily by S^3 to bound the wrap loop).
 	if h.MaxArc > 0 && ray.ArcTraveled >= h.MaxArc {
 		terminateRay(ray)
-		return
+		return false
 	}
 
 	if g.Kind() == geometry.SphericalKind {
@@ -82,29 +188,57 @@ func (h *Handler) TraceRay(objTree *object.ObjectTree, ray *optics.Ray, level in
 	}
 
 	// Prepare all surface-local interaction data for this hit.
-	si, ok := h.prepareSurfaceInteraction(media, ray, hit)
-	if !ok {
+	si := &path.si
+	if !h.prepareSurfaceInteractionInto(path.media, ray, hit, si) {
 		terminateRay(ray)
-		return
+		return false
 	}
 
 	// Handle emissive surfaces directly; terminate if there is no BSDF to sample.
 	if h.traceEmission(ray, si.Object, si.Context, si.WoEmission) {
-		return
+		scaleRayThroughput(ray, path.direct.emissionWeight(path.previous, *si))
+		return false
 	} else if !si.Object.Material.HasSurface() {
 		terminateRay(ray)
-		return
+		return false
+	}
+
+	// A dispersive vertex sends every wavelength its own way, so the hero
+	// carries the path on alone.
+	if len(ray.FollowingCompanions()) > 0 && dispersiveVertex(path.media, si) {
+		ray.SplitBundle()
+		si.Context.WavelengthsNM = si.Context.WavelengthsNM[:1]
+	}
+
+	// Next-event estimation: connect non-delta vertices to a sampled emitter.
+	// The connection adds one segment, so it is skipped on the last bounce.
+	guided := path.guide.vertex(ray, si)
+	lightSampled := path.level < h.MaxRayLevel && path.direct.shouldSample(ray, *si)
+	if lightSampled {
+		path.direct.estimate(rng, path.objTree, h, ray, *si, guided)
 	}
 
-	// Sample the surface BSDF to choose the next path direction.
-	sample, ok := sampleSurface(si.Object, si.Context, si.WoLocal)
+	// Sample the surface BSDF, mixed with the guide where it applies, to
+	// choose the next path direction.
+	sample, ok := guided.sample(rng, si)
 	if !ok {
 		terminateRay(ray)
-		return
+		return false
+	}
+	path.aovs.scattered(ray, sample, path.level >= h.MaxRayLevel)
+
+	// Light sampling at the vertex saw only the light that keeps its
+	// wavelength, so light reached by a wavelength shift is weighted like
+	// light reached through a delta lobe.
+	if path.direct != nil {
+		path.scatteredFrom(sample.PDF, sample.Flags&(bxdf.DeltaReflection|bxdf.DeltaTransmission|bxdf.WavelengthShift) != 0, lightSampled)
 	}
 
 	// Apply the BSDF weight, spectral update, and medium transmission if needed.
-	applySurfaceSample(media, ray, si.Context, si.Object, sample)
+	applySurfaceSample(path.media, ray, si.Context, si.Object, sample)
+	if ray.Polarized {
+		polarizeAtSurface(ray, si, sample.Wi)
+	}
 
 	// Transform the sampled local direction back to world space.
 	si.Frame.LocalToWorldInto(ray.Direction, sample.Wi)
@@ -115,31 +249,88 @@ func (h *Handler) TraceRay(objTree *object.ObjectTree, ray *optics.Ray, level in
 	g.ProjectTangent(ray.Origin, ray.Direction, ray.Direction)
 	if !normalizeDirectionInGeometry(g, ray.Origin, ray.Direction) {
 		terminateRay(ray)
-		return
+		return false
 	}
+	if guided.tree != nil {
+		path.recorder.scattered(ray, sample.PDF)
+	}
+	return true
+}
 
-	// Continue tracing the next bounce.
-	h.TraceRay(objTree, ray, level+1)
+// escapeToInfiniteLights ends a Euclidean path that left the scene on the
+// radiance of the infinite lights, weighted against next-event estimation.
+// It reports false when the scene has no infinite lights, leaving the ray to
+// wrapAtAntipode. A ray escaping through an extinguishing medium never
+// arrives and is terminated.
+func (h *Handler) escapeToInfiniteLights(path *pathState, g geometry.Geometry) bool {
+	ray := path.ray
+	if path.objTree == nil || len(path.objTree.InfiniteLights) == 0 ||
+		g.Kind() != geometry.EuclideanKind || ray.Direction.Len() != 3 {
+		return false
+	}
+	ctx := h.newShadingContext(ray)
+	if !reachesInfinity(path.media, ray.MediumStack.Current(), ctx) {
+		terminateRay(ray)
+		return true
+	}
+	applySpectrum(ray, light.SumRadiance(path.objTree.InfiniteLights, ctx, ray.Direction))
+	scaleRayThroughput(ray, path.direct.infiniteWeight(path.previous, ray.Direction))
+	return true
+}
+
+// wrapAtAntipode continues a ray that missed every surface. In spherical
+// geometry the ray has only searched the half great circle up to the antipode
+// of its origin, so it moves there and keeps tracing if the arc budget allows;
+// everywhere else the path ends.
+func (h *Handler) wrapAtAntipode(ray *optics.Ray, g geometry.Geometry) bool {
+	newO, newD, wrapped := g.WrapBeyond(ray.Origin, ray.Direction, math.Pi)
+	if !wrapped {
+		terminateRay(ray)
+		return false
+	}
+	advance := math.Pi
+	if h.MaxArc > 0 && ray.ArcTraveled+advance > h.MaxArc {
+		terminateRay(ray)
+		return false
+	}
+	ray.Origin.CopyVec(newO)
+	ray.Direction.CopyVec(newD)
+	ray.ArcTraveled += advance
+	return true
 }
 
 func surfaceHitInGeometry(objTree *object.ObjectTree, ray *optics.Ray, g geometry.Geometry) (*object.SurfaceHit, bool) {
+	return countSurfaceHitInGeometry(objTree, ray, g, nil)
+}
+
+// countSurfaceHitInGeometry is surfaceHitInGeometry that adds its traversal
+// work to stats unless stats is nil.
+func countSurfaceHitInGeometry(objTree *object.ObjectTree, ray *optics.Ray, g geometry.Geometry, stats *object.TraversalStats) (*object.SurfaceHit, bool) {
 	if g.Kind() == geometry.SphericalKind {
-		return objTree.GetGeodesicSurfaceHit(ray.Origin, ray.Direction, g, utils.EPS, math.Pi)
+		return objTree.CountGeodesicSurfaceHit(ray.Origin, ray.Direction, g, utils.EPS, math.Pi, stats)
 	}
 	embeddedOrigin, embeddedDirection, tMax := g.EmbeddedRay(ray.Origin, ray.Direction)
 	if tMax <= 0 {
 		return nil, false
 	}
-	return objTree.GetSurfaceHitRangeInGeometry(embeddedOrigin, embeddedDirection, g, utils.EPS, tMax)
+	return objTree.CountSurfaceHitRangeInGeometry(embeddedOrigin, embeddedDirection, g, utils.EPS, tMax, stats)
+}
+
+// hitArcLength is the geodesic distance from the ray origin to hit.
+func hitArcLength(g geometry.Geometry, ray *optics.Ray, hit *object.SurfaceHit) float64 {
+	if hit.ArcLength > 0 {
+		return hit.ArcLength
+	}
+	return g.ArcLengthFromEmbedT(ray.Origin, ray.Direction, hit.Distance)
 }
 
-func (h *Handler) terminateBeforeBounce(ray *optics.Ray, level int64) bool {
+func (h *Handler) terminateBeforeBounce(rng uniformSource, ray *optics.Ray, level int64) bool {
 	if level > h.MaxRayLevel {
 		terminateRay(ray)
 		return true
 	}
 
-	if h.killByRussianRoulette(ray, level) {
+	if h.killByRussianRoulette(rng, ray, level) {
 		terminateRay(ray)
 		return true
 	}
@@ -152,6 +343,21 @@ func (h *Handler) prepareSurfaceInteraction(
 	ray *optics.Ray,
 	hit *object.SurfaceHit,
 ) (SurfaceInteraction, bool) {
+	var si SurfaceInteraction
+	if !h.prepareSurfaceInteractionInto(media, ray, hit, &si) {
+		return SurfaceInteraction{}, false
+	}
+	return si, true
+}
+
+// prepareSurfaceInteractionInto is prepareSurfaceInteraction that rebuilds
+// si in place, reusing the vectors of its frames.
+func (h *Handler) prepareSurfaceInteractionInto(
+	media *medium.Registry,
+	ray *optics.Ray,
+	hit *object.SurfaceHit,
+	si *SurfaceInteraction,
+) bool {
 	// Move the ray origin to the hit point for the next bounce.
 	ray.Origin.CopyVec(hit.Point)
 	// A Klein geodesic is an affine chord, so its embedded direction stays
@@ -159,12 +365,12 @@ func (h *Handler) prepareSurfaceInteraction(
 	// the hit before converting the incident direction into the local BSDF
 	// frame. This is a no-op in direction for Euclidean and Spherical rays.
 	if !normalizeDirectionInGeometry(ray.G(), ray.Origin, ray.Direction) {
-		return SurfaceInteraction{}, false
+		return false
 	}
 
 	obj := hit.Object
 	if obj == nil || obj.Material == nil {
-		return SurfaceInteraction{}, false
+		return false
 	}
 
 	ctx := h.newShadingContext(ray)
@@ -188,31 +394,45 @@ func (h *Handler) prepareSurfaceInteraction(
 
 	prepareMediumContext(&ctx, media, ray, obj.MediumBoundary, hit.FrontFace)
 
-	frame, ok := maths.NewFrameFromNormalInGeometry(ray.G(), hit.Point, hit.ShadingNormal)
-	if !ok {
-		return SurfaceInteraction{}, false
+	if !si.Frame.SetFromNormalInGeometry(ray.G(), hit.Point, hit.ShadingNormal) {
+		return false
 	}
 	emissionNormal := hit.GeometricNormal
 	if emissionNormal == nil {
 		emissionNormal = hit.ShadingNormal
 	}
-	emissionFrame, ok := maths.NewFrameFromNormalInGeometry(ray.G(), hit.Point, emissionNormal)
-	if !ok {
-		return SurfaceInteraction{}, false
+	if !si.EmissionFrame.SetFromNormalInGeometry(ray.G(), hit.Point, emissionNormal) {
+		return false
 	}
 
-	woLocal := frame.WorldToLocalNegated(ray.Direction)
-	woEmission := emissionFrame.WorldToLocalNegated(ray.Direction)
+	si.Hit = hit
+	si.Object = obj
+	si.WoLocal = si.Frame.WorldToLocalNegated(ray.Direction)
+	si.WoEmission = si.EmissionFrame.WorldToLocalNegated(ray.Direction)
+	si.Context = ctx
+	return true
+}
 
-	return SurfaceInteraction{
-		Hit:           hit,
-		Object:        obj,
-		Frame:         frame,
-		EmissionFrame: emissionFrame,
-		WoLocal:       woLocal,
-		WoEmission:    woEmission,
-		Context:       ctx,
-	}, true
+// dispersiveVertex reports whether the wavelengths of a hero bundle see the
+// surface of si differently: through a BSDF with a dispersive index of
+// refraction or one that shifts wavelengths, or across a boundary between
+// media whose indices vary with wavelength.
+func dispersiveVertex(media *medium.Registry, si *SurfaceInteraction) bool {
+	if si.Object.Material.Surface.DeltaFlags()&(bxdf.Dispersive|bxdf.WavelengthShift) != 0 {
+		return true
+	}
+	if !si.Object.MediumBoundary.Active() {
+		return false
+	}
+	ctx := si.Context
+	for _, wavelength := range ctx.WavelengthsNM[1:] {
+		companion := bxdf.ShadingContext{WavelengthNM: wavelength, WavelengthsNM: []float64{wavelength}}
+		if media.IOR(ctx.IncidentMedium, companion) != ctx.EtaIncident ||
+			media.IOR(ctx.TransmitMedium, companion) != ctx.EtaTransmit {
+			return true
+		}
+	}
+	return false
 }
 
 func getMediumRegistry(objTree *object.ObjectTree) *medium.Registry {
@@ -228,9 +448,10 @@ func (h *Handler) newShadingContext(ray *optics.Ray) bxdf.ShadingContext {
 		WavelengthNM:  ray.WaveLength,
 		WavelengthPDF: ray.WavelengthPDF,
 	}
+	ctx.WavelengthShifts = ray.WavelengthShifts
 
 	if h.SpectrumMode != optics.SpectrumModeRGB && ray.WaveLength > 0 {
-		ctx.WavelengthsNM = []float64{ray.WaveLength}
+		ctx.WavelengthsNM = ray.BundleWavelengthsNM()
 	}
 
 	return ctx
@@ -256,14 +477,16 @@ func (h *Handler) traceEmission(
 }
 
 func sampleSurface(
+	rng uniformSource,
 	obj *object.Object,
 	ctx bxdf.ShadingContext,
 	woLocal maths.Direction,
 ) (bxdf.BxDFSample, bool) {
-	sample := obj.Material.Surface.Sample(ctx, woLocal, maths.Sample2D{
-		U: rand.Float64(),
-		V: rand.Float64(),
-	})
+	u := maths.Sample2D{U: rng.Float64(), V: rng.Float64()}
+	if ctx.WavelengthShifts && obj.Material.Surface.DeltaFlags()&bxdf.WavelengthShift != 0 {
+		ctx.ShiftSample = rng.Float64()
+	}
+	sample := obj.Material.Surface.Sample(ctx, woLocal, u)
 
 	if sample.PDF <= 0 {
 		return sample, false
@@ -284,11 +507,18 @@ func applySurfaceSample(
 	sample bxdf.BxDFSample,
 ) {
 	weight := maths.AbsCosTheta(sample.Wi) / sample.PDF
+	shifted := sample.Flags&bxdf.WavelengthShift != 0
+	if shifted {
+		weight /= sample.WavelengthPDF
+	}
 	applySpectrum(ray, sample.F.MulScalar(weight))
 
 	if sample.WavelengthNM > 0 {
 		ray.SpectralPath = true
 	}
+	if shifted {
+		shiftWavelength(ray, sample.WavelengthNM)
+	}
 
 	if sample.Flags&bxdf.TransmissionEvent != 0 {
 		applyMediumTransmission(media, ray, ctx, obj.MediumBoundary, sample)
@@ -304,13 +534,13 @@ func normalizeDirectionInGeometry(g geometry.Geometry, p, v *mat.VecDense) bool
 	return true
 }
 
-func (h *Handler) killByRussianRoulette(ray *optics.Ray, nextLevel int64) bool {
+func (h *Handler) killByRussianRoulette(rng uniformSource, ray *optics.Ray, nextLevel int64) bool {
 	if !h.shouldApplyRussianRoulette(nextLevel) {
 		return false
 	}
 
 	survival := russianRouletteSurvivalProbability(ray)
-	if survival <= 0 || rand.Float64() >= survival {
+	if survival <= 0 || rng.Float64() >= survival {
 		return true
 	}
 
@@ -168,7 +168,7 @@ func TestPrepareSurfaceInteractionSamplesLambertIn4D(t *testing.T) {
 	if si.WoLocal.Len() != 4 {
 		t.Fatalf("expected 4D local outgoing direction, got %dD", si.WoLocal.Len())
 	}
-	sample, ok := sampleSurface(obj, si.Context, si.WoLocal)
+	sample, ok := sampleSurface(globalUniform{}, obj, si.Context, si.WoLocal)
 	if !ok {
 		t.Fatal("expected 4D Lambert sample")
 	}
@@ -261,7 +261,7 @@ func TestKleinSurfaceInteractionNormalizesIncidentDirectionAndReflectsMetricAngl
 		t.Fatalf("incident direction Klein length squared=%g want 1", got)
 	}
 
-	sample, ok := sampleSurface(obj, si.Context, si.WoLocal)
+	sample, ok := sampleSurface(globalUniform{}, obj, si.Context, si.WoLocal)
 	if !ok {
 		t.Fatal("expected specular reflection sample")
 	}
@@ -363,6 +363,54 @@ func TestApplySpectrumRejectsSampledSpectrumWithoutWavelength(t *testing.T) {
 	}
 }
 
+func TestApplySpectrumWeightsEveryBundleWavelength(t *testing.T) {
+	ray := &renderray.Ray{}
+	ray.Init()
+	ray.SetHeroBundle([]renderray.WavelengthSample{
+		{LambdaNM: 500, PDF: 1}, {LambdaNM: 550, PDF: 1}, {LambdaNM: 600, PDF: 1}, {LambdaNM: 650, PDF: 1},
+	})
+
+	applySpectrum(ray, renderray.NewSampledSpectrum([]float64{0.1, 0.2, 0.3, 0.4}))
+	scaleRayThroughput(ray, 2)
+	if math.Abs(ray.SpectralPower-0.2) > 1e-12 {
+		t.Fatalf("hero power %g, want 0.2", ray.SpectralPower)
+	}
+	for i, companion := range ray.FollowingCompanions() {
+		if want := 0.2 * float64(i+2); math.Abs(companion.SpectralPower-want) > 1e-12 {
+			t.Fatalf("companion %d power %g, want %g", i, companion.SpectralPower, want)
+		}
+	}
+
+	// A spectrum of the hero wavelength alone leaves the hero to carry the
+	// weight of the whole bundle.
+	applySpectrum(ray, renderray.NewSampledSpectrum([]float64{0.5}))
+	if math.Abs(ray.SpectralPower-0.4) > 1e-12 {
+		t.Fatalf("hero power %g after the split, want 0.4", ray.SpectralPower)
+	}
+	if len(ray.FollowingCompanions()) != 0 || ray.CompanionCount != 3 {
+		t.Fatalf("%d companions follow after the split, want none of 3", len(ray.FollowingCompanions()))
+	}
+	if got := ray.BundleWavelengthsNM(); len(got) != 1 || got[0] != 500 {
+		t.Fatalf("bundle wavelengths %v after the split, want [500]", got)
+	}
+}
+
+func TestDispersiveVertexSplitsOnlyDispersiveSurfaces(t *testing.T) {
+	for _, test := range []struct {
+		ior  medium.Model
+		want bool
+	}{{medium.NewConstant(1.5), false}, {medium.NewCauchy(1.5, 0.02, 0), true}} {
+		glass := bxdf.NewSpecularDielectric(renderray.ConstantSpectrum(1), renderray.ConstantSpectrum(1), 1, test.ior)
+		si := &SurfaceInteraction{
+			Object:  &object.Object{Material: &material.Material{Surface: bsdf.NewSingle(glass)}},
+			Context: bxdf.ShadingContext{WavelengthNM: 500, WavelengthsNM: []float64{500, 600}},
+		}
+		if got := dispersiveVertex(medium.NewRegistry(), si); got != test.want {
+			t.Fatalf("%T: dispersive %v, want %v", test.ior, got, test.want)
+		}
+	}
+}
+
 func TestRussianRouletteSurvivalUsesRGBThroughputMax(t *testing.T) {
 	ray := &renderray.Ray{Color: renderray.RGB{0.2, 0.8, 0.4}}
 
@@ -419,7 +467,7 @@ func TestTerminateBeforeBounceStopsPastMaxDepth(t *testing.T) {
 	handler := &Handler{MaxRayLevel: 2}
 	ray := &renderray.Ray{Color: renderray.RGB{1, 1, 1}}
 
-	if !handler.terminateBeforeBounce(ray, 3) {
+	if !handler.terminateBeforeBounce(globalUniform{}, ray, 3) {
 		t.Fatal("expected path to terminate beyond max depth")
 	}
 	if ray.Color != (renderray.RGB{}) {
@@ -431,7 +479,7 @@ func TestTerminateBeforeBounceAllowsFullSurvivalRoulette(t *testing.T) {
 	handler := &Handler{MaxRayLevel: 8, RussianRouletteDepth: 3}
 	ray := &renderray.Ray{Color: renderray.RGB{1, 1, 1}}
 
-	if handler.terminateBeforeBounce(ray, 3) {
+	if handler.terminateBeforeBounce(globalUniform{}, ray, 3) {
 		t.Fatal("did not expect roulette to terminate a unit-throughput RGB path")
 	}
 	if ray.Color != (renderray.RGB{1, 1, 1}) {
@@ -446,3 +494,118 @@ type sampledCoefficient struct {
 func (c sampledCoefficient) Eval(medium.WavelengthContext) medium.CoefficientSpectrum {
 	return medium.NewSampledCoefficientSpectrum([]float64{c.value})
 }
+
+func TestSampleMediumEventIsUnbiasedPerChannel(t *testing.T) {
+	coefficients := mediumCoefficients{
+		SigmaS: []float64{0.2, 0.5, 1.0},
+		SigmaT: []float64{0.4, 1.0, 3.0},
+	}
+	const maxDistance = 1.0
+	const n = 400
+	scattered := make([]float64, 3)
+	passed := make([]float64, 3)
+	for i := range 3 * n {
+		uChannel := (float64(i/n) + 0.5) / 3
+		uDistance := (float64(i%n) + 0.5) / n
+		event := sampleMediumEvent(coefficients, maxDistance, uChannel, uDistance)
+		for ch := range 3 {
+			if event.Scattered {
+				scattered[ch] += event.Weight.RGBChannel(ch)
+			} else {
+				passed[ch] += event.Weight.RGBChannel(ch)
+			}
+		}
+	}
+	for ch := range 3 {
+		sigmaT := coefficients.SigmaT[ch]
+		transmittance := math.Exp(-sigmaT * maxDistance)
+		wantScattered := coefficients.SigmaS[ch] / sigmaT * (1 - transmittance)
+		if got := scattered[ch] / (3 * n); math.Abs(got-wantScattered) > 0.01 {
+			t.Fatalf("channel %d scattered estimate %g, want %g", ch, got, wantScattered)
+		}
+		if got := passed[ch] / (3 * n); math.Abs(got-transmittance) > 0.01 {
+			t.Fatalf("channel %d transmitted estimate %g, want %g", ch, got, transmittance)
+		}
+	}
+}
+
+func newRampDensity(t *testing.T) medium.DensityField {
+	t.Helper()
+	density, err := medium.NewExpressionDensity(func(point *mat.VecDense) float64 {
+		return point.AtVec(2)
+	}, 1, medium.Bounds{Min: [3]float64{-1, -1, 0}, Max: [3]float64{1, 1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return density
+}
+
+func TestHeterogeneousTrackingMatchesAnalyticRamp(t *testing.T) {
+	density := newRampDensity(t)
+	coefficients := mediumCoefficients{
+		SigmaS: []float64{0.5, 1.0, 0},
+		SigmaT: []float64{1.0, 3.0, 2.0},
+	}
+	origin := mat.NewVecDense(3, []float64{0, 0, -0.5})
+	direction := mat.NewVecDense(3, []float64{0, 0, 1})
+	const maxDistance, n = 1.5, 40000
+
+	ratio := make([]float64, 3)
+	scattered := make([]float64, 3)
+	passed := make([]float64, 3)
+	for range n {
+		transmittance := ratioTrackTransmittance(globalUniform{}, coefficients, density, origin, direction, maxDistance)
+		event := deltaTrackMedium(globalUniform{}, coefficients, density, origin, direction, maxDistance)
+		for ch := range 3 {
+			ratio[ch] += transmittance.RGBChannel(ch)
+			if event.Scattered {
+				scattered[ch] += event.Weight.RGBChannel(ch)
+			} else {
+				passed[ch] += event.Weight.RGBChannel(ch)
+			}
+		}
+	}
+	for ch := range 3 {
+		sigmaT := coefficients.SigmaT[ch]
+		// density(z) = z on [0, 1], so the optical depth is sigma_t / 2.
+		transmittance := math.Exp(-sigmaT / 2)
+		wantScattered := coefficients.SigmaS[ch] / sigmaT * (1 - transmittance)
+		if got := ratio[ch] / n; math.Abs(got-transmittance) > 0.01 {
+			t.Fatalf("channel %d ratio tracking %g, want %g", ch, got, transmittance)
+		}
+		if got := passed[ch] / n; math.Abs(got-transmittance) > 0.015 {
+			t.Fatalf("channel %d delta-tracked transmission %g, want %g", ch, got, transmittance)
+		}
+		if got := scattered[ch] / n; math.Abs(got-wantScattered) > 0.015 {
+			t.Fatalf("channel %d delta-tracked scattering %g, want %g", ch, got, wantScattered)
+		}
+	}
+}
+
+func TestSampleMediumSegmentTracksHeterogeneousAbsorber(t *testing.T) {
+	registry := medium.NewRegistry()
+	smokeID, err := registry.RegisterHeterogeneous(
+		"smoke", medium.NewConstant(1), medium.ConstantCoefficient(2), nil, nil, newRampDensity(t),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ray := &renderray.Ray{Geometry: geometry.Euclidean(), Color: renderray.RGB{1, 1, 1}}
+	ray.Init()
+	ray.MediumStack.Reset(smokeID)
+	ray.Origin.CopyVec(mat.NewVecDense(3, []float64{0, 0, -0.5}))
+	ray.Direction.CopyVec(mat.NewVecDense(3, []float64{0, 0, 1}))
+
+	const n = 20000
+	sum := 0.0
+	for range n {
+		event, tracked := sampleMediumSegment(globalUniform{}, registry, ray, bxdf.ShadingContext{}, math.Inf(1))
+		if !tracked || event.Scattered {
+			t.Fatalf("absorbing heterogeneous segment: tracked=%v scattered=%v", tracked, event.Scattered)
+		}
+		sum += event.Weight.RGBChannel(0)
+	}
+	if got, want := sum/n, math.Exp(-1); math.Abs(got-want) > 0.01 {
+		t.Fatalf("tracked transmittance %g, want %g", got, want)
+	}
+}
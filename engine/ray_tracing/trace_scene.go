@@ -1,8 +1,13 @@
 package ray_tracing
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"time"
 
+	"github.com/Algo2147483647/ray/engine/event"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	"github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/model/object"
 )
@@ -22,13 +27,87 @@ func (h *Handler) TraceScene(
 	renderCamera camera.RayCamera,
 	objectTree *object.ObjectTree,
 	samples int64,
+) error {
+	return h.TraceSceneContext(context.Background(), renderCamera, objectTree, samples)
+}
+
+// TraceSceneContext is TraceScene stopped by ctx. The integrators stop at the
+// next tile or pass boundary and leave a normalized partial Film whose sample
+// counts cover only the work they finished, and the error of ctx is returned
+// with it. With a TimeBudget, passes of samples under fresh seeds are merged
+// into the Film until the budget runs out.
+func (h *Handler) TraceSceneContext(
+	ctx context.Context,
+	renderCamera camera.RayCamera,
+	objectTree *object.ObjectTree,
+	samples int64,
 ) error {
 	if h == nil {
 		return fmt.Errorf("render handler is nil")
 	}
+	if h.TimeBudget < 0 || math.IsNaN(h.TimeBudget) || math.IsInf(h.TimeBudget, 0) {
+		return fmt.Errorf("time budget must be finite and non-negative")
+	}
+	if h.TimeBudget > 0 {
+		return h.traceSceneWithinBudget(ctx, renderCamera, objectTree, samples)
+	}
+	return h.traceScene(ctx, renderCamera, objectTree, samples)
+}
+
+// traceSceneWithinBudget renders passes of samples until TimeBudget seconds
+// have passed since the start. Every pass, the first included, stops at the
+// deadline and keeps the work it finished, like a stopped render.
+func (h *Handler) traceSceneWithinBudget(
+	ctx context.Context,
+	renderCamera camera.RayCamera,
+	objectTree *object.ObjectTree,
+	samples int64,
+) error {
+	budget, cancel := context.WithDeadline(ctx, time.Now().Add(time.Duration(h.TimeBudget*float64(time.Second))))
+	defer cancel()
+	if err := h.traceScene(budget, renderCamera, objectTree, samples); err != nil && budget.Err() == nil {
+		return err
+	}
+
+	film := renderCamera.GetFilm()
+	total := film.Clone()
+	seed := h.Seed
+	defer func() { h.Seed = seed }()
+	for pass := uint64(1); budget.Err() == nil; pass++ {
+		h.Seed = sampler.Hash(seed, pass)
+		film.Reset()
+		if err := h.traceScene(budget, renderCamera, objectTree, samples); err != nil && budget.Err() == nil {
+			return err
+		}
+		if err := total.Merge(film); err != nil {
+			return err
+		}
+		h.emit(event.Event{Kind: event.KindPassEnd, Pass: int(pass), Samples: total.Samples})
+	}
+	*film = *total
+	// The budget running out is the expected end; only the caller's
+	// cancellation is an error.
+	return ctx.Err()
+}
+
+func (h *Handler) traceScene(
+	ctx context.Context,
+	renderCamera camera.RayCamera,
+	objectTree *object.ObjectTree,
+	samples int64,
+) error {
 	if renderCamera == nil || renderCamera.GetFilm() == nil {
 		return fmt.Errorf("render camera or Film is nil")
 	}
+	if _, err := sampler.ParseKind(string(h.SamplerKind)); err != nil {
+		return err
+	}
+	if _, err := camera.NewFilter(h.Filter, h.FilterRadius); err != nil {
+		return err
+	}
+	if err := h.validateAOVs(); err != nil {
+		return err
+	}
 
 	requested := h.IntegratorKind
 	effective := requested
@@ -45,6 +124,12 @@ func (h *Handler) TraceScene(
 				effective = IntegratorPathTracing
 				h.LastEffectiveIntegrator = effective
 				h.LastFallbackReason = err.Error()
+				h.emit(event.Event{
+					Kind:       event.KindFallback,
+					Requested:  string(requested),
+					Integrator: string(effective),
+					Message:    h.LastFallbackReason,
+				})
 			case BDPTFallbackError:
 				return err
 			}
@@ -62,12 +147,25 @@ func (h *Handler) TraceScene(
 		ObjectTree:  objectTree,
 		Samples:     samples,
 		Accumulator: newFilmAccumulator(renderCamera.GetFilm(), integrator.ConcurrentFilmWrites()),
+		Ctx:         ctx,
 	}
 
+	// Only an adaptive pixel render fills per-pixel counts, only a pixel
+	// render with a non-unit-weight filter fills weight sums, and only a
+	// pixel render records AOVs.
+	renderCamera.GetFilm().PixelSamples = nil
+	renderCamera.GetFilm().FilterWeights = nil
+	renderCamera.GetFilm().AOVs = nil
+	renderCamera.GetFilm().ObjectIDs = nil
+	renderCamera.GetFilm().MaterialIDs = nil
 	err = integrator.Run(context)
 	if err != nil {
 		return err
 	}
+	if context.stopped {
+		context.Camera.GetFilm().Samples = context.stoppedSamples
+		return ctx.Err()
+	}
 
 	context.Camera.GetFilm().Samples = integrator.EffectiveSampleCount(context)
 	return nil
@@ -0,0 +1,485 @@
+package ray_tracing
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/material/medium"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestTraceSceneIsReproducibleAcrossThreadCounts(t *testing.T) {
+	tree := newSPPMTestScene()
+	render := func(kind IntegratorKind, seed uint64, threads int) []float64 {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = kind
+		h.SpectrumMode = optics.SpectrumModeHeroWavelength
+		h.Seed = seed
+		h.ThreadNum = threads
+		h.BlockCols, h.BlockRows = threads, 1
+		h.PSSMLTChains = 8
+		h.PSSMLTBootstrapSamples = 256
+		renderCamera := newBDPTTestCamera(t, 4, 4)
+		if err := h.TraceScene(renderCamera, tree, 8); err != nil {
+			t.Fatalf("%s render: %v", kind, err)
+		}
+		values := make([]float64, 0)
+		for _, bin := range renderCamera.Film.SpectralBins {
+			values = append(values, bin.Data...)
+		}
+		return values
+	}
+
+	for _, kind := range []IntegratorKind{
+		IntegratorPathTracing, IntegratorBDPT, IntegratorLightTracing,
+		IntegratorSPPM, IntegratorPSSMLT, IntegratorVCM,
+	} {
+		reference, threaded, reseeded := render(kind, 7, 1), render(kind, 7, 4), render(kind, 8, 4)
+		differs := false
+		for i := range reference {
+			if threaded[i] != reference[i] {
+				t.Fatalf("%s: value %d = %g with 4 workers, %g with 1", kind, i, threaded[i], reference[i])
+			}
+			differs = differs || reseeded[i] != reference[i]
+		}
+		if !differs {
+			t.Fatalf("%s: a different seed rendered the same image", kind)
+		}
+	}
+}
+
+func TestLowDiscrepancySamplersReduceDirectLightingError(t *testing.T) {
+	tree := newSPPMTestScene()
+	render := func(kind sampler.Kind, seed uint64, samples int64) []float64 {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = IntegratorPathTracing
+		h.SpectrumMode = optics.SpectrumModeHeroWavelength
+		h.MaxRayLevel = 1
+		h.SamplerKind = kind
+		h.Seed = seed
+		renderCamera := newBDPTTestCamera(t, 4, 4)
+		if err := h.TraceScene(renderCamera, tree, samples); err != nil {
+			t.Fatalf("%s render: %v", kind, err)
+		}
+		values := make([]float64, 0)
+		for _, bin := range renderCamera.Film.SpectralBins {
+			values = append(values, bin.Data...)
+		}
+		return values
+	}
+
+	reference := render(sampler.KindIndependent, 1, 4096)
+	meanSquaredError := func(kind sampler.Kind) float64 {
+		sum := 0.0
+		for seed := range uint64(8) {
+			for i, value := range render(kind, 100+seed, 16) {
+				sum += (value - reference[i]) * (value - reference[i])
+			}
+		}
+		return sum
+	}
+	// Hero bundles already stratify the wavelengths of the independent
+	// sampler, which leaves the low-discrepancy samplers a smaller margin.
+	independent := meanSquaredError(sampler.KindIndependent)
+	for _, kind := range []sampler.Kind{sampler.KindStratified, sampler.KindHalton, sampler.KindSobol, sampler.KindBlueNoiseSobol} {
+		if mse := meanSquaredError(kind); mse >= 0.75*independent {
+			t.Errorf("%s: squared error %g, want below three quarters of independent %g", kind, mse, independent)
+		} else {
+			t.Logf("%s: squared error %.3g of independent", kind, mse/independent)
+		}
+	}
+}
+
+// rasterRecordingKernel records the raster offsets its camera samples draw
+// from the pixel center.
+type rasterRecordingKernel struct {
+	offsets [][]float64
+}
+
+func (k *rasterRecordingKernel) prepare(*RenderContext) error { return nil }
+
+func (k *rasterRecordingKernel) sampleSpectral(
+	_ *Handler,
+	pixelSampler sampler.Sampler,
+	_ camera.RayCamera,
+	_ *object.ObjectTree,
+	_ *optics.Ray,
+	wavelength optics.WavelengthSample,
+	_ *aovPixel,
+	index ...int,
+) camera.SpectralSample {
+	raster, weight := filteredRaster(camera.BoxFilter(), pixelSampler, index...)
+	for i := range raster {
+		raster[i] -= float64(index[i])
+	}
+	k.offsets = append(k.offsets, raster)
+	return camera.SpectralSample{WavelengthNM: wavelength.LambdaNM, Weight: weight}
+}
+
+// The wavelength precedes the raster position, so the raster axes must still
+// share a Sobol dimension pair: the first four samples of a pixel then cover
+// all four quadrants of it.
+func TestCameraSamplesStratifyTheRasterPlane(t *testing.T) {
+	tree := newSPPMTestScene()
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	film := renderCamera.GetFilm()
+	h := newBDPTTestHandler()
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.SamplerKind = sampler.KindSobol
+	kernel := &rasterRecordingKernel{}
+	pixel := pixelOffset(film.Shape, []int{1, 2})
+	h.traceSpectral(kernel, h.newSampler(samplerDomainCamera, filmWidth(film), 4), pixel, renderCamera, tree, 4, nil, 1, 2)
+
+	var quadrants [4]bool
+	for _, offset := range kernel.offsets {
+		quadrant := 0
+		if offset[0] >= 0 {
+			quadrant |= 1
+		}
+		if offset[1] >= 0 {
+			quadrant |= 2
+		}
+		if quadrants[quadrant] {
+			t.Fatalf("raster offsets %v share a quadrant", kernel.offsets)
+		}
+		quadrants[quadrant] = true
+	}
+}
+
+// renderTestBins renders the spectral bins of a 4x4 test Film with kernel,
+// bypassing TraceScene so that the test chooses the kernel.
+func renderTestBins(t *testing.T, h *Handler, kernel pixelKernel, tree *object.ObjectTree, samples int64) []float64 {
+	t.Helper()
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	film := renderCamera.GetFilm()
+	values := make([]float64, len(film.SpectralBins)*film.ElementCount())
+	for y := range 4 {
+		for x := range 4 {
+			pixel := pixelOffset(film.Shape, []int{x, y})
+			pixelSampler := h.newSampler(samplerDomainCamera, filmWidth(film), samples)
+			spectralSamples, _ := h.traceSpectral(kernel, pixelSampler, pixel, renderCamera, tree, samples, nil, x, y)
+			for _, sample := range spectralSamples {
+				if bin := film.SpectralBinIndex(sample.WavelengthNM); bin >= 0 {
+					values[bin*film.ElementCount()+pixel] += sample.Value
+				}
+			}
+		}
+	}
+	return values
+}
+
+// singleWavelengthKernel hides the bundles of the path tracer, so that every
+// hero wavelength travels alone.
+type singleWavelengthKernel struct {
+	pixelKernel
+}
+
+func TestHeroBundlesReduceColorNoise(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.MaxRayLevel = 2
+	bundled := newPathTracingKernel(h, tree)
+	reference := renderTestBins(t, h, bundled, tree, 4096)
+
+	squaredError := func(kernel pixelKernel) float64 {
+		sum := 0.0
+		for seed := range uint64(8) {
+			h.Seed = 100 + seed
+			for i, value := range renderTestBins(t, h, kernel, tree, 16) {
+				sum += (value - reference[i]) * (value - reference[i])
+			}
+		}
+		return sum
+	}
+	single, bundle := squaredError(singleWavelengthKernel{bundled}), squaredError(bundled)
+	if bundle > single/3 {
+		t.Fatalf("bundled squared error %g, want below a third of single-wavelength %g", bundle, single)
+	}
+	t.Logf("bundled squared error %.3g of single-wavelength", bundle/single)
+}
+
+func TestHeroBundlesMatchSingleWavelengthsThroughDispersiveGlass(t *testing.T) {
+	tree := newSPPMTestScene()
+	tree.AddObject(&object.Object{
+		Shape: shape.NewSphere(mat.NewVecDense(3, []float64{0, 0, 1.5}), 0.6),
+		Material: &material.Material{Surface: bsdf.NewSingle(bxdf.NewSpecularDielectric(
+			optics.ConstantSpectrum(1), optics.ConstantSpectrum(1), 1, medium.NewCauchy(1.5, 0.02, 0),
+		))},
+	})
+	tree.Build()
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.MaxRayLevel = 4
+	bundled := newPathTracingKernel(h, tree)
+
+	energy := func(kernel pixelKernel) float64 {
+		sum := 0.0
+		for _, value := range renderTestBins(t, h, kernel, tree, 2048) {
+			sum += value
+		}
+		return sum
+	}
+	single, bundle := energy(singleWavelengthKernel{bundled}), energy(bundled)
+	if relative := math.Abs(bundle-single) / single; relative > 0.02 {
+		t.Fatalf("bundled energy %g differs from single-wavelength %g by %.1f%%", bundle, single, 100*relative)
+	}
+}
+
+// newFilterEdgeTestScene puts an emitter in front of the left half of the
+// BDPT test camera's view, so the 8x8 image has a vertical edge on the
+// boundary between raster columns 3 and 4.
+func newFilterEdgeTestScene() *object.ObjectTree {
+	tree := (&object.ObjectTree{}).Build()
+	light := &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))}
+	corners := [][]float64{{-0.8, -0.8, 1}, {0, -0.8, 1}, {0, 0.8, 1}, {-0.8, 0.8, 1}}
+	for _, triangle := range [][3]int{{0, 1, 2}, {0, 2, 3}} {
+		tree.AddObject(&object.Object{
+			Shape: shape.NewTriangle(
+				mat.NewVecDense(3, corners[triangle[0]]),
+				mat.NewVecDense(3, corners[triangle[1]]),
+				mat.NewVecDense(3, corners[triangle[2]]),
+			),
+			Material: light,
+		})
+	}
+	tree.Build()
+	return tree
+}
+
+// The filtered edge profile must match the filter's cumulative mass, and
+// camera samples and splats must reconstruct the same image. Columns are
+// averaged over the interior rows to tame noise; border pixels are skipped
+// because splats from points outside the film never reach them.
+func TestReconstructionFiltersAgreeAcrossDrivers(t *testing.T) {
+	tree := newFilterEdgeTestScene()
+	render := func(kind IntegratorKind, filter camera.FilterKind, samples int64) *camera.Film {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = kind
+		h.SpectrumMode = optics.SpectrumModeHeroWavelength
+		h.SamplerKind = sampler.KindSobol
+		h.Filter = filter
+		h.ThreadNum = 4
+		renderCamera := newBDPTTestCamera(t, 8, 8)
+		// One bin over the sampled range keeps wavelength noise out of the
+		// pixel values.
+		renderCamera.Film.InitSpectralBins(1, optics.WavelengthMin, optics.WavelengthMax)
+		if err := h.TraceScene(renderCamera, tree, samples); err != nil {
+			t.Fatalf("%s render: %v", kind, err)
+		}
+		return renderCamera.Film
+	}
+	column := func(film *camera.Film, x int) float64 {
+		value := 0.0
+		for y := 1; y < 7; y++ {
+			value += film.SpectralBins[0].Data[y*8+x]
+		}
+		return value / 6
+	}
+	radiance := column(render(IntegratorPathTracing, camera.FilterBox, 256), 1)
+	if radiance <= 0 {
+		t.Fatal("edge emitter is not visible")
+	}
+
+	for _, test := range []struct {
+		kind      IntegratorKind
+		filter    camera.FilterKind
+		samples   int64
+		tolerance float64
+	}{
+		{IntegratorPathTracing, camera.FilterBox, 64, 0.01},
+		{IntegratorPathTracing, camera.FilterTriangle, 256, 0.02},
+		{IntegratorPathTracing, camera.FilterMitchell, 1024, 0.02},
+		{IntegratorLightTracing, camera.FilterTriangle, 512, 0.04},
+		{IntegratorBDPT, camera.FilterGaussian, 256, 0.04},
+	} {
+		filter, err := camera.NewFilter(test.filter, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		film := render(test.kind, test.filter, test.samples)
+		if (film.FilterWeights != nil) != (test.kind == IntegratorPathTracing && !filter.UnitWeights()) {
+			t.Fatalf("%s/%s recorded filter weights %v", test.kind, test.filter, film.FilterWeights != nil)
+		}
+		for x := 1; x < 7; x++ {
+			// The share of the filter around column x left of the edge.
+			want, steps := 0.0, 4000
+			step := 2 * filter.Radius() / float64(steps)
+			for i := range steps {
+				if offset := -filter.Radius() + (float64(i)+0.5)*step; float64(x)+offset < 3.5 {
+					want += filter.Evaluate(offset) * step
+				}
+			}
+			want *= radiance
+			if got := column(film, x); math.Abs(got-want) > test.tolerance*radiance {
+				t.Fatalf("%s/%s column %d = %g, want %g", test.kind, test.filter, x, got, want)
+			}
+		}
+	}
+}
+
+// stopAfterContext is cancelled once Err has been asked checks times, which
+// stops a single-threaded render at a chosen tile or pass boundary.
+type stopAfterContext struct {
+	context.Context
+	checks atomic.Int64
+}
+
+func (c *stopAfterContext) Err() error {
+	if c.checks.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func newStopAfterContext(checks int64) *stopAfterContext {
+	ctx := &stopAfterContext{Context: context.Background()}
+	ctx.checks.Store(checks)
+	return ctx
+}
+
+func TestStoppedPixelRenderCountsOnlyTracedTiles(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.ThreadNum = 1
+	h.BlockCols, h.BlockRows = 4, 4
+	renderCamera := newBDPTTestCamera(t, 8, 8)
+	err := h.TraceSceneContext(newStopAfterContext(2), renderCamera, newSPPMTestScene(), 4)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("stopped render returned %v, want context.Canceled", err)
+	}
+	film := renderCamera.Film
+	if film.Samples != 4 || film.PixelSamples == nil {
+		t.Fatalf("stopped Film has %d samples and counts %v", film.Samples, film.PixelSamples)
+	}
+	for pixel, count := range film.PixelSamples {
+		// The first two tiles are the top half of the image.
+		if want := int64(4) * int64(1-pixel/32); count != want {
+			t.Fatalf("pixel %d counts %d samples, want %d", pixel, count, want)
+		}
+	}
+}
+
+func TestStoppedSplatRenderKeepsWholeSamplePasses(t *testing.T) {
+	tree := newSPPMTestScene()
+	render := func(ctx context.Context, samples int64) (*camera.Film, error) {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = IntegratorBDPT
+		h.SpectrumMode = optics.SpectrumModeHeroWavelength
+		h.ThreadNum = 1
+		renderCamera := newBDPTTestCamera(t, 4, 4)
+		err := h.TraceSceneContext(ctx, renderCamera, tree, samples)
+		return renderCamera.Film, err
+	}
+	energy := func(film *camera.Film) float64 {
+		sum := 0.0
+		for _, bin := range film.SpectralBins {
+			for _, value := range bin.Data {
+				sum += value
+			}
+		}
+		return sum
+	}
+
+	stopped, err := render(newStopAfterContext(16), 64)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("stopped render returned %v, want context.Canceled", err)
+	}
+	if stopped.Samples != 16 {
+		t.Fatalf("stopped Film has %d samples, want the 16 traced passes", stopped.Samples)
+	}
+	reference, err := render(context.Background(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := energy(stopped), energy(reference); math.Abs(got-want) > 0.2*want {
+		t.Fatalf("stopped Film energy = %g, want about %g of the full render", got, want)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, kind := range []IntegratorKind{IntegratorBDPT, IntegratorSPPM, IntegratorVCM} {
+		h := newBDPTTestHandler()
+		h.IntegratorKind = kind
+		renderCamera := newBDPTTestCamera(t, 4, 4)
+		if err := h.TraceSceneContext(cancelled, renderCamera, tree, 4); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: cancelled render returned %v", kind, err)
+		}
+		if renderCamera.Film.Samples != 0 || energy(renderCamera.Film) != 0 {
+			t.Fatalf("%s: cancelled render left %d samples", kind, renderCamera.Film.Samples)
+		}
+	}
+}
+
+func TestTimeBudgetAddsSamplePasses(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.TimeBudget = 0.2
+	h.Seed = 5
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	if err := h.TraceScene(renderCamera, newSPPMTestScene(), 4); err != nil {
+		t.Fatal(err)
+	}
+	film := renderCamera.Film
+	if film.Samples <= 4 {
+		t.Fatalf("budgeted Film has %d samples, want more than one pass of 4", film.Samples)
+	}
+	for pixel := range film.ElementCount() {
+		if count := film.PixelSampleCount(pixel); count < 4 {
+			t.Fatalf("pixel %d counts %d samples, want at least one pass", pixel, count)
+		}
+	}
+	if h.Seed != 5 {
+		t.Fatalf("budgeted render left seed %d", h.Seed)
+	}
+
+	h.TimeBudget = -1
+	if err := h.TraceScene(renderCamera, newSPPMTestScene(), 4); err == nil {
+		t.Fatal("expected a negative time budget to be rejected")
+	}
+}
+
+func TestTimeBudgetStopsTheFirstPass(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.IntegratorKind = IntegratorPathTracing
+	h.SpectrumMode = optics.SpectrumModeHeroWavelength
+	h.TimeBudget = 0.05
+	// The driver stops at tile boundaries, so small tiles let the deadline
+	// land well inside a pass far longer than the budget.
+	h.BlockCols, h.BlockRows = 1, 1
+	renderCamera := newBDPTTestCamera(t, 16, 16)
+	start := time.Now()
+	if err := h.TraceScene(renderCamera, newSPPMTestScene(), 4096); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("a 50 ms budget rendered for %v", elapsed)
+	}
+	film := renderCamera.Film
+	unrendered := 0
+	for pixel := range film.ElementCount() {
+		if film.PixelSampleCount(pixel) == 0 {
+			unrendered++
+		}
+	}
+	if unrendered == 0 {
+		t.Fatal("the budget let the first pass finish every pixel")
+	}
+}
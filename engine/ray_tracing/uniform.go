@@ -0,0 +1,111 @@
+package ray_tracing
+
+import (
+	"math/rand/v2"
+
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+)
+
+// uniformSource supplies the uniform numbers in [0, 1) consumed while
+// sampling a path. Render drivers pass a sampler positioned at the current
+// pixel sample; PSSMLT replays and mutates the same numbers across paths.
+type uniformSource interface {
+	Float64() float64
+}
+
+// globalUniform serves the public single-ray entry points, which have no
+// pixel sample to key a deterministic stream on.
+type globalUniform struct{}
+
+func (globalUniform) Float64() float64 { return rand.Float64() }
+
+// samplerDomain keys the independent streams a render draws for one pixel
+// sample, such as the camera and light subpaths of a bidirectional path or
+// the wavelength of a progressive pass.
+type samplerDomain uint64
+
+const (
+	samplerDomainCamera samplerDomain = iota
+	samplerDomainLight
+	samplerDomainConnection
+	samplerDomainPass
+	samplerDomainGuide
+)
+
+// newSampler returns a sampler of domain and the configured kind under the
+// scene seed. Its numbers depend only on the seed, the domain, and the pixel
+// sample it is started at, so a render is reproducible for any worker count or
+// tile order. Width places pixel indices on the Film plane and samples is the
+// number of sample indices each pixel of the stream receives; both only shape
+// how a low-discrepancy sampler spreads its points.
+func (h *Handler) newSampler(domain samplerDomain, width int, samples int64) sampler.Sampler {
+	return sampler.New(h.SamplerKind, sampler.Options{
+		Seed:            sampler.Hash(h.Seed, uint64(domain)),
+		SamplesPerPixel: samples,
+		Width:           width,
+	})
+}
+
+// filmWidth is the extent of the fastest-varying Film axis, along which
+// consecutive pixel indices advance.
+func filmWidth(film *camera.Film) int {
+	if film == nil || len(film.Shape) == 0 {
+		return 0
+	}
+	return film.Shape[0]
+}
+
+// bdptRandom separates the numbers consumed by the camera subpath, the light
+// subpath, and the connection strategies, so a change in one subpath's length
+// does not shift the numbers the others see.
+type bdptRandom struct {
+	Camera     uniformSource
+	Light      uniformSource
+	Connection uniformSource
+}
+
+// bdptSamplers holds one sampler per bdptRandom stream.
+type bdptSamplers struct {
+	camera, light, connection sampler.Sampler
+}
+
+func (h *Handler) newBDPTSamplers(width int, samples int64) bdptSamplers {
+	return bdptSamplers{
+		camera:     h.newSampler(samplerDomainCamera, width, samples),
+		light:      h.newSampler(samplerDomainLight, width, samples),
+		connection: h.newSampler(samplerDomainConnection, width, samples),
+	}
+}
+
+// start positions all three streams at sample index of pixel.
+func (s bdptSamplers) start(pixel int, index int64) bdptRandom {
+	s.camera.StartPixelSample(pixel, index)
+	s.light.StartPixelSample(pixel, index)
+	s.connection.StartPixelSample(pixel, index)
+	return bdptRandom{Camera: s.camera, Light: s.light, Connection: s.connection}
+}
+
+// wavelengthUniform draws the uniform of a camera sample's wavelength, which
+// precedes the raster position. It spends a whole dimension pair, so the
+// raster axes drawn next start on a pair and are stratified jointly.
+func wavelengthUniform(rng uniformSource) float64 {
+	u := rng.Float64()
+	rng.Float64()
+	return u
+}
+
+// filteredRaster draws a continuous raster position around the pixel at
+// index by importance sampling the reconstruction filter along every axis,
+// and returns the filter weight the camera sample carries. Pixel centers lie
+// on integer coordinates.
+func filteredRaster(filter *camera.Filter, rng uniformSource, index ...int) ([]float64, float64) {
+	raster := make([]float64, len(index))
+	weight := 1.0
+	for i, value := range index {
+		offset, axisWeight := filter.Sample(rng.Float64())
+		raster[i] = float64(value) + offset
+		weight *= axisWeight
+	}
+	return raster, weight
+}
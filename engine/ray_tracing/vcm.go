@@ -0,0 +1,265 @@
+package ray_tracing
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"gonum.org/v1/gonum/mat"
+)
+
+// vcmAlpha controls the merge radius reduction r_i = r_0 * i^((alpha-1)/2)
+// of iteration i, which keeps the merging bias vanishing while its variance
+// grows slowly enough for the estimator to stay consistent.
+const vcmAlpha = 0.75
+
+// vcmRadiusPixels sets the default initial merge radius in pixel footprints,
+// measured on the bounds of the first iteration's primary hits.
+const vcmRadiusPixels = 1.0
+
+const vcmPixelBatchSize int64 = 16
+
+// vcmSceneIntegrator runs vertex connection and merging (Georgiev et al.).
+// Every iteration traces one camera subpath per active pixel and as many light
+// subpaths, all at one shared wavelength. Each camera subpath is connected to
+// one light subpath with the BDPT strategies, and every continuous surface
+// vertex on it additionally merges with the light vertices of all light
+// subpaths that lie within the iteration's radius. The merged strategies enter
+// the BDPT balance heuristic, so caustics seen through specular surfaces come
+// from merging while diffuse transport keeps the connection estimators.
+type vcmSceneIntegrator struct {
+	prepared      *bdptPreparedState
+	iterations    int64
+	initialRadius float64
+}
+
+// vcmPhoton refers to a mergeable vertex of a stored light subpath.
+type vcmPhoton struct {
+	path   int32
+	vertex int32
+}
+
+// vcmIteration holds the subpaths and merge state shared by all pixels of one
+// iteration.
+type vcmIteration struct {
+	index         int64
+	wavelength    optics.WavelengthSample
+	cameraPaths   [][]bdptVertex
+	filterWeights []float64 // reconstruction-filter weight of each camera path
+	lightPaths    [][]bdptVertex
+	photons       []vcmPhoton
+	grid          sphereGrid
+	radius        float64
+	eta           float64
+}
+
+func (d *vcmSceneIntegrator) ConcurrentFilmWrites() bool { return false }
+
+func (d *vcmSceneIntegrator) EffectiveSampleCount(context *RenderContext) int64 {
+	return context.Handler.EffectiveSampleCount(context.Samples)
+}
+
+func (d *vcmSceneIntegrator) Run(context *RenderContext) error {
+	if d == nil || context == nil {
+		return fmt.Errorf("VCM integrator or render context is nil")
+	}
+	if context.Handler.VCMInitialRadius < 0 {
+		return fmt.Errorf("VCM initial radius must be non-negative")
+	}
+	if context.ObjectTree != nil && len(context.ObjectTree.InfiniteLights) > 0 {
+		return fmt.Errorf("VCM infinite lights are not implemented")
+	}
+	state, err := prepareBDPTWork(context)
+	if err != nil {
+		return err
+	}
+	d.prepared = state
+	d.iterations = context.Handler.EffectiveSampleCount(context.Samples)
+	d.initialRadius = context.Handler.VCMInitialRadius
+	if d.iterations <= 0 || len(state.activePixels) == 0 {
+		return nil
+	}
+
+	progress := context.Handler.newProgressReporter("VCM", "iterations", d.iterations)
+	defer progress.Close()
+	wavelengthSampler := context.Handler.wavelengthSampler()
+	passSampler := context.Handler.newSampler(samplerDomainPass, 0, d.iterations)
+	for it := range d.iterations {
+		if context.done() {
+			// As in SPPM, the wavelengths are stratified over every
+			// iteration, so the iterations already added are discarded.
+			for _, bin := range context.Camera.GetFilm().SpectralBins {
+				clear(bin.Data)
+			}
+			context.stop(0)
+			return nil
+		}
+		passSampler.StartPixelSample(0, it)
+		iteration := &vcmIteration{
+			index:      it,
+			wavelength: wavelengthSampler.Sample((float64(it) + passSampler.Float64()) / float64(d.iterations)),
+		}
+		d.traceCameraPaths(context, iteration)
+		if d.initialRadius == 0 {
+			// Stays zero, and merging disabled, until a camera path hits.
+			d.initialRadius = d.defaultRadius(context.Camera.GetFilm(), iteration.cameraPaths)
+		}
+		iteration.radius = d.initialRadius * math.Pow(float64(it+1), (vcmAlpha-1)/2)
+		d.traceLightPaths(context, iteration)
+		d.evaluate(context, iteration)
+		progress.Add(1)
+	}
+	return nil
+}
+
+func (d *vcmSceneIntegrator) traceCameraPaths(context *RenderContext, iteration *vcmIteration) {
+	film := context.Camera.GetFilm()
+	iteration.cameraPaths = make([][]bdptVertex, len(d.prepared.activePixels))
+	iteration.filterWeights = make([]float64, len(d.prepared.activePixels))
+	runParallelWork(context.Handler.ThreadNum, int64(len(iteration.cameraPaths)), vcmPixelBatchSize, func(i int64) {
+		pixel := d.prepared.activePixels[i]
+		coords := film.SpectralBins[0].GetCoordinates(pixel)
+		rng := context.Handler.newSampler(samplerDomainCamera, filmWidth(film), d.iterations)
+		rng.StartPixelSample(pixel, iteration.index)
+		raster, weight := filteredRaster(d.prepared.filter, rng, coords...)
+		iteration.filterWeights[i] = weight
+		iteration.cameraPaths[i] = context.Handler.buildCameraSubpath(
+			rng, context.Camera, context.ObjectTree,
+			iteration.wavelength.LambdaNM, iteration.wavelength.PDF,
+			raster,
+		)
+	})
+}
+
+func (d *vcmSceneIntegrator) defaultRadius(film *camera.Film, cameraPaths [][]bdptVertex) float64 {
+	points := make([]*mat.VecDense, 0, len(cameraPaths))
+	for _, path := range cameraPaths {
+		if len(path) > 1 && path[1].Kind == bdptVertexSurface {
+			points = append(points, path[1].Point)
+		}
+	}
+	return pixelFootprintRadius(points, film, vcmRadiusPixels)
+}
+
+// traceLightPaths traces one light subpath per camera subpath and hashes
+// their mergeable vertices. The light endpoints are left out: merging there
+// would duplicate the camera subpath hitting the emitter.
+func (d *vcmSceneIntegrator) traceLightPaths(context *RenderContext, iteration *vcmIteration) {
+	state := d.prepared.scene
+	iteration.lightPaths = make([][]bdptVertex, len(iteration.cameraPaths))
+	runParallelWork(context.Handler.ThreadNum, int64(len(iteration.lightPaths)), vcmPixelBatchSize, func(i int64) {
+		rng := context.Handler.newSampler(samplerDomainLight, 0, d.iterations)
+		rng.StartPixelSample(int(i), iteration.index)
+		iteration.lightPaths[i] = context.Handler.buildLightSubpath(
+			rng, context.ObjectTree, state.Lights,
+			iteration.wavelength.LambdaNM, iteration.wavelength.PDF,
+		)
+	})
+	if iteration.radius <= 0 {
+		return
+	}
+	iteration.grid = newSphereGrid(iteration.radius)
+	for p, path := range iteration.lightPaths {
+		for v := 1; v < len(path); v++ {
+			if path[v].Kind != bdptVertexSurface || !path[v].Connectible {
+				continue
+			}
+			iteration.grid.insert(path[v].Point, iteration.radius, int32(len(iteration.photons)))
+			iteration.photons = append(iteration.photons, vcmPhoton{path: int32(p), vertex: int32(v)})
+		}
+	}
+	iteration.eta = float64(len(iteration.lightPaths)) * math.Pi * iteration.radius * iteration.radius
+}
+
+// evaluate connects and merges the camera subpath of every active pixel.
+// Local estimates and merges are one sample of the pixel; the t=1 splats of
+// all light subpaths together form one light-tracing sample of the film.
+// Results reach the film in pixel order, as the splat driver's do.
+func (d *vcmSceneIntegrator) evaluate(context *RenderContext, iteration *vcmIteration) {
+	bdCamera := context.Camera.(camera.BidirectionalCamera)
+	wavelengthNM, wavelengthPDF := iteration.wavelength.LambdaNM, iteration.wavelength.PDF
+	iterations := float64(d.iterations)
+	lightPathCount := float64(len(iteration.lightPaths))
+	runOrderedParallelWork(context.Handler.ThreadNum, int64(len(iteration.cameraPaths)), vcmPixelBatchSize, func(i int64) []FilmSplat {
+		pixel := d.prepared.activePixels[i]
+		rng := context.Handler.newSampler(samplerDomainConnection, filmWidth(context.Camera.GetFilm()), d.iterations)
+		rng.StartPixelSample(pixel, iteration.index)
+		cameraPath := iteration.cameraPaths[i]
+		local, splats := context.Handler.connectBidirectionalPaths(
+			rng, d.prepared.scene, bdCamera, context.ObjectTree,
+			wavelengthNM, wavelengthPDF, iteration.lightPaths[i], cameraPath, iteration.eta,
+		)
+		local = local.Add(d.merge(context, bdCamera, iteration, cameraPath))
+		results := make([]FilmSplat, 0, 1+len(splats))
+		if validSpectrum(local) {
+			results = append(results, FilmSplat{
+				Pixel: pixel, WavelengthNM: wavelengthNM, WavelengthPDF: wavelengthPDF,
+				Value: local.MulScalar(iteration.filterWeights[i] / iterations),
+			})
+		}
+		for _, splat := range splats {
+			for _, kept := range filterSplat(d.prepared.filter, splat, splat.projection.Position, d.prepared.width, d.prepared.height, d.prepared.activeMask) {
+				kept.Value = kept.Value.MulScalar(1 / (iterations * lightPathCount))
+				results = append(results, kept)
+			}
+		}
+		return results
+	}, func(results []FilmSplat) {
+		for _, result := range results {
+			value := optics.SpectralSampleRadiance(result.Value.Sample(0), result.WavelengthPDF)
+			context.Accumulator.AddSpectral(result.Pixel, result.WavelengthNM, value)
+		}
+	})
+}
+
+// merge gathers the light vertices around each continuous surface vertex of a
+// camera subpath. A light vertex's Beta is the flux it carries into the
+// vertex, so the camera vertex's BSDF toward the light vertex's predecessor
+// completes the path.
+func (d *vcmSceneIntegrator) merge(
+	context *RenderContext,
+	bdCamera camera.BidirectionalCamera,
+	iteration *vcmIteration,
+	cameraPath []bdptVertex,
+) optics.Spectrum {
+	result := zeroSpectrum(iteration.wavelength.LambdaNM)
+	if iteration.eta <= 0 {
+		return result
+	}
+	radius2 := iteration.radius * iteration.radius
+	normalization := 1 / (math.Pi * radius2 * float64(len(iteration.lightPaths)))
+	for t := 2; t <= len(cameraPath); t++ {
+		pt := &cameraPath[t-1]
+		if pt.Kind != bdptVertexSurface || !pt.Connectible {
+			continue
+		}
+		for _, index := range iteration.grid.lookup(pt.Point) {
+			photon := iteration.photons[index]
+			lightPath := iteration.lightPaths[photon.path]
+			s := int(photon.vertex)
+			// The camera vertex takes the place of the light vertex, so the
+			// merged path has the length of the (s,t) connection.
+			if int64(s+t-2) > context.Handler.MaxRayLevel || squaredDistance(pt.Point, lightPath[s].Point) > radius2 {
+				continue
+			}
+			wi := directionBetween(pt.Point, lightPath[s-1].Point)
+			if wi == nil {
+				continue
+			}
+			f, _, ok := pt.scatterToward(wi)
+			if !ok {
+				continue
+			}
+			weight := bidirectionalMISWeight(d.prepared.scene, bdCamera, lightPath, cameraPath, s, t, iteration.eta, true)
+			if weight <= 0 {
+				continue
+			}
+			value := pt.Beta.Mul(f).Mul(lightPath[s].Beta).MulScalar(weight * normalization)
+			if validSpectrum(value) {
+				result = result.Add(value)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package ray_tracing
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Algo2147483647/ray/engine/maths"
+	"github.com/Algo2147483647/ray/engine/model/camera"
+	"github.com/Algo2147483647/ray/engine/model/material"
+	"github.com/Algo2147483647/ray/engine/model/material/bsdf"
+	"github.com/Algo2147483647/ray/engine/model/material/bxdf"
+	"github.com/Algo2147483647/ray/engine/model/material/emission"
+	"github.com/Algo2147483647/ray/engine/model/object"
+	"github.com/Algo2147483647/ray/engine/model/optics"
+	"github.com/Algo2147483647/ray/engine/model/shape"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestVCMMISPartitionIncludesMerging(t *testing.T) {
+	lightPoint := mat.NewVecDense(3, []float64{0.3, 0.1, 2})
+	cameraPoint := mat.NewVecDense(3, []float64{1, -0.2, 1})
+	surfacePoint := mat.NewVecDense(3, []float64{0, 0, 0})
+	toLight := directionBetween(surfacePoint, lightPoint)
+	toCamera := directionBetween(surfacePoint, cameraPoint)
+	surfaceNormal := mat.NewVecDense(3, []float64{0, 0, 1})
+	lightNormal := negated(toLight)
+	surfaceFrame, _ := maths.NewFrameFromNormal(surfaceNormal)
+	lightFrame, _ := maths.NewFrameFromNormal(lightNormal)
+
+	cam := camera.NewCamera3D()
+	cam.Position = cameraPoint
+	cam.Coordinates = []*mat.VecDense{
+		directionBetween(cameraPoint, surfacePoint),
+		mat.NewVecDense(3, []float64{0, 1, 0}),
+		mat.NewVecDense(3, []float64{1, 0, -1}),
+	}
+	cam.FieldOfViews = []float64{45, 45}
+	cam.Film = camera.NewFilm(4, 4)
+	if err := cam.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	lightShape := shape.NewCircle(lightPoint, lightNormal, 0.3)
+	lightObject := &object.Object{
+		Shape:    lightShape,
+		Material: &material.Material{Emission: emission.NewConstant(optics.ConstantSpectrum(1))},
+	}
+	area := lightShape.SurfaceArea()
+	lightRoot := bdptVertex{
+		Kind: bdptVertexLight, Point: lightPoint, GeometricNormal: lightNormal,
+		Frame: lightFrame, Object: lightObject, PDFFwdArea: 1 / area, Connectible: true,
+	}
+	cameraRoot := bdptVertex{
+		Kind: bdptVertexCamera, Point: cameraPoint, PDFFwdArea: 1, Connectible: true, Camera: cam,
+	}
+	surface := bdptVertex{
+		Kind: bdptVertexSurface, Point: surfacePoint, GeometricNormal: surfaceNormal,
+		Frame: surfaceFrame, WoLocal: surfaceFrame.WorldToLocal(toCamera),
+		Object: &object.Object{Material: &material.Material{
+			Surface: bsdf.NewSingle(bxdf.NewLambert(optics.ConstantSpectrum(0.8))),
+		}},
+		Connectible: true,
+	}
+	lightSurface, cameraSurface := surface, surface
+	lightSurface.PDFFwdArea = bdptVertexPDF(&lightRoot, nil, &lightSurface, cam)
+	cameraSurface.PDFFwdArea = bdptVertexPDF(&cameraRoot, nil, &cameraSurface, cam)
+	cameraLight := lightRoot
+	cameraLight.Kind = bdptVertexSurface
+	cameraLight.PDFFwdArea = bdptVertexPDF(&cameraSurface, &cameraRoot, &cameraLight, cam)
+	state := &bdptSceneState{Lights: object.NewLightTree([]object.Light{
+		{Object: lightObject, Sampler: lightShape, Area: area, Power: area},
+	})}
+
+	lightPath := []bdptVertex{lightRoot, lightSurface}
+	cameraPath := []bdptVertex{cameraRoot, cameraSurface, cameraLight}
+	for _, eta := range []float64{1e-3, 0.1, 10} {
+		weights := []float64{
+			bidirectionalMISWeight(state, cam, nil, cameraPath, 0, 3, eta, false),
+			bidirectionalMISWeight(state, cam, lightPath[:1], cameraPath[:2], 1, 2, eta, false),
+			bidirectionalMISWeight(state, cam, lightPath, cameraPath[:1], 2, 1, eta, false),
+			bidirectionalMISWeight(state, cam, lightPath, cameraPath[:2], 1, 2, eta, true),
+		}
+		sum := 0.0
+		for _, weight := range weights {
+			sum += weight
+		}
+		if weights[3] <= 0 || math.Abs(sum-1) > 1e-10 {
+			t.Fatalf("eta %g: MIS weights with merging = %v, sum=%g", eta, weights, sum)
+		}
+	}
+	if weight := bidirectionalMISWeight(state, cam, lightPath, cameraPath[:2], 1, 2, 0, true); weight != 0 {
+		t.Fatalf("merge weight without a merge radius = %g, want 0", weight)
+	}
+}
+
+func TestVCMMatchesBDPTOnDiffuseScene(t *testing.T) {
+	tree := newSPPMTestScene()
+	h := newBDPTTestHandler()
+	h.MaxRayLevel = 2
+	h.ThreadNum = 4
+	reference := renderTestFilmEnergy(t, h, tree, 512)
+
+	h.IntegratorKind = IntegratorVCM
+	h.VCMInitialRadius = 0.2
+	got := renderTestFilmEnergy(t, h, tree, 512)
+	if relative := math.Abs(got-reference) / reference; relative > 0.05 {
+		t.Fatalf("VCM energy %g differs from BDPT %g by %.1f%%", got, reference, 100*relative)
+	}
+}
+
+func TestVCMDerivesInitialRadiusFromPrimaryHits(t *testing.T) {
+	h := newBDPTTestHandler()
+	h.ThreadNum = 2
+	renderCamera := newBDPTTestCamera(t, 4, 4)
+	integrator := &vcmSceneIntegrator{}
+	context := &RenderContext{
+		Handler: h, Camera: renderCamera, ObjectTree: newSPPMTestScene(), Samples: 2,
+		Accumulator: newFilmAccumulator(renderCamera.Film, true),
+	}
+	if err := integrator.Run(context); err != nil {
+		t.Fatal(err)
+	}
+	// Every primary ray hits the screen at z = 3 inside the 45 degree view.
+	if radius := integrator.initialRadius; radius <= 0 || radius > 3*math.Tan(math.Pi/8) {
+		t.Fatalf("derived radius = %g, want a fraction of the visible screen", radius)
+	}
+}
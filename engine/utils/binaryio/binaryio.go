@@ -7,19 +7,49 @@ import (
 	"math"
 )
 
-const float64Bytes = 8
+const wordBytes = 8
 
 // WriteFloat64s writes values with a reusable scratch buffer.
 func WriteFloat64s(w io.Writer, order binary.ByteOrder, values []float64, scratch []byte) error {
-	valuesPerChunk, err := float64ValuesPerChunk(scratch)
+	return writeWords(w, order, len(values), func(i int) uint64 { return math.Float64bits(values[i]) }, scratch)
+}
+
+// ReadFloat64s reads values with a reusable scratch buffer.
+func ReadFloat64s(r io.Reader, order binary.ByteOrder, values []float64, scratch []byte) error {
+	return readWords(r, order, len(values), func(i int, word uint64) { values[i] = math.Float64frombits(word) }, scratch)
+}
+
+// WriteInt64s writes values with a reusable scratch buffer.
+func WriteInt64s(w io.Writer, order binary.ByteOrder, values []int64, scratch []byte) error {
+	return writeWords(w, order, len(values), func(i int) uint64 { return uint64(values[i]) }, scratch)
+}
+
+// ReadInt64s reads values with a reusable scratch buffer.
+func ReadInt64s(r io.Reader, order binary.ByteOrder, values []int64, scratch []byte) error {
+	return readWords(r, order, len(values), func(i int, word uint64) { values[i] = int64(word) }, scratch)
+}
+
+// RequireEOF rejects trailing bytes after a fully decoded payload.
+func RequireEOF(r io.Reader) error {
+	var extra [1]byte
+	if _, err := io.ReadFull(r, extra[:]); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected trailing data")
+}
+
+func writeWords(w io.Writer, order binary.ByteOrder, count int, word func(int) uint64, scratch []byte) error {
+	wordsPerChunk, err := wordsPerChunk(scratch)
 	if err != nil {
 		return err
 	}
-	for start := 0; start < len(values); start += valuesPerChunk {
-		end := min(start+valuesPerChunk, len(values))
-		chunk := scratch[:(end-start)*float64Bytes]
-		for i, value := range values[start:end] {
-			order.PutUint64(chunk[i*float64Bytes:], math.Float64bits(value))
+	for start := 0; start < count; start += wordsPerChunk {
+		end := min(start+wordsPerChunk, count)
+		chunk := scratch[:(end-start)*wordBytes]
+		for i := start; i < end; i++ {
+			order.PutUint64(chunk[(i-start)*wordBytes:], word(i))
 		}
 		written, err := w.Write(chunk)
 		if err != nil {
@@ -32,39 +62,27 @@ func WriteFloat64s(w io.Writer, order binary.ByteOrder, values []float64, scratc
 	return nil
 }
 
-// ReadFloat64s reads values with a reusable scratch buffer.
-func ReadFloat64s(r io.Reader, order binary.ByteOrder, values []float64, scratch []byte) error {
-	valuesPerChunk, err := float64ValuesPerChunk(scratch)
+func readWords(r io.Reader, order binary.ByteOrder, count int, store func(int, uint64), scratch []byte) error {
+	wordsPerChunk, err := wordsPerChunk(scratch)
 	if err != nil {
 		return err
 	}
-	for start := 0; start < len(values); start += valuesPerChunk {
-		end := min(start+valuesPerChunk, len(values))
-		chunk := scratch[:(end-start)*float64Bytes]
+	for start := 0; start < count; start += wordsPerChunk {
+		end := min(start+wordsPerChunk, count)
+		chunk := scratch[:(end-start)*wordBytes]
 		if _, err := io.ReadFull(r, chunk); err != nil {
 			return err
 		}
-		for i := range values[start:end] {
-			values[start+i] = math.Float64frombits(order.Uint64(chunk[i*float64Bytes:]))
+		for i := start; i < end; i++ {
+			store(i, order.Uint64(chunk[(i-start)*wordBytes:]))
 		}
 	}
 	return nil
 }
 
-// RequireEOF rejects trailing bytes after a fully decoded payload.
-func RequireEOF(r io.Reader) error {
-	var extra [1]byte
-	if _, err := io.ReadFull(r, extra[:]); err == io.EOF {
-		return nil
-	} else if err != nil {
-		return err
-	}
-	return fmt.Errorf("unexpected trailing data")
-}
-
-func float64ValuesPerChunk(scratch []byte) (int, error) {
-	if len(scratch) < float64Bytes {
-		return 0, fmt.Errorf("float64 scratch buffer must contain at least %d bytes", float64Bytes)
+func wordsPerChunk(scratch []byte) (int, error) {
+	if len(scratch) < wordBytes {
+		return 0, fmt.Errorf("scratch buffer must contain at least %d bytes", wordBytes)
 	}
-	return len(scratch) / float64Bytes, nil
+	return len(scratch) / wordBytes, nil
 }
@@ -24,6 +24,21 @@ func TestFloat64sRoundTripAcrossChunks(t *testing.T) {
 	}
 }
 
+func TestInt64sRoundTripAcrossChunks(t *testing.T) {
+	want := []int64{1, -2, 1 << 40, 0, -1 << 62}
+	var encoded bytes.Buffer
+	if err := WriteInt64s(&encoded, binary.LittleEndian, want, make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int64, len(want))
+	if err := ReadInt64s(&encoded, binary.LittleEndian, got, make([]byte, 24)); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
 func TestWriteFloat64sRejectsShortWrite(t *testing.T) {
 	err := WriteFloat64s(shortWriter{}, binary.LittleEndian, []float64{1}, make([]byte, 8))
 	if !errors.Is(err, io.ErrShortWrite) {
@@ -0,0 +1,123 @@
+// Package eemio decodes excitation-emission matrices, the tables that
+// fluorimeters measure for fluorescent samples, from CSV or JSON files.
+package eemio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Matrix holds one row of Values per excitation wavelength and one column
+// per emission wavelength, both in nanometers.
+type Matrix struct {
+	Excitation []float64   `json:"excitation_nm"`
+	Emission   []float64   `json:"emission_nm"`
+	Values     [][]float64 `json:"values"`
+}
+
+// ReadFile decodes the matrix at path: JSON when it ends in .json, CSV
+// otherwise.
+func ReadFile(path string) (*Matrix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decode := DecodeCSV
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decode = DecodeJSON
+	}
+	matrix, err := decode(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	return matrix, nil
+}
+
+// DecodeCSV reads a table whose first row lists the emission wavelengths
+// after a label cell, and whose other rows each start with an excitation
+// wavelength followed by the values at every emission wavelength. Lines
+// starting with # are comments.
+func DecodeCSV(r io.Reader) (*Matrix, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty matrix")
+	}
+
+	matrix := &Matrix{}
+	if matrix.Emission, err = parseNumbers(records[0][1:], 1, 1); err != nil {
+		return nil, err
+	}
+	for i, record := range records[1:] {
+		row, err := parseNumbers(record, i+2, 0)
+		if err != nil {
+			return nil, err
+		}
+		matrix.Excitation = append(matrix.Excitation, row[0])
+		matrix.Values = append(matrix.Values, row[1:])
+	}
+	if err := matrix.validate(); err != nil {
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// DecodeJSON reads an object with the fields excitation_nm, emission_nm and
+// values, one row of values per excitation wavelength.
+func DecodeJSON(r io.Reader) (*Matrix, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	matrix := &Matrix{}
+	if err := decoder.Decode(matrix); err != nil {
+		return nil, err
+	}
+	if err := matrix.validate(); err != nil {
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// validate checks that the matrix is rectangular. Wavelength order and value
+// ranges are left to the material that uses it.
+func (m *Matrix) validate() error {
+	if len(m.Excitation) == 0 || len(m.Emission) == 0 {
+		return fmt.Errorf("matrix needs excitation and emission wavelengths")
+	}
+	if len(m.Values) != len(m.Excitation) {
+		return fmt.Errorf("%d rows of values for %d excitation wavelengths", len(m.Values), len(m.Excitation))
+	}
+	for i, row := range m.Values {
+		if len(row) != len(m.Emission) {
+			return fmt.Errorf("row %d has %d values for %d emission wavelengths", i, len(row), len(m.Emission))
+		}
+	}
+	return nil
+}
+
+// parseNumbers parses the cells of CSV line line, whose first column is
+// column; empty cells are errors.
+func parseNumbers(cells []string, line, column int) ([]float64, error) {
+	values := make([]float64, len(cells))
+	for i, cell := range cells {
+		value, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d, column %d: invalid number %q", line, column+i+1, cell)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
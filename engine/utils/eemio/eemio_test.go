@@ -0,0 +1,63 @@
+package eemio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeCSVReadsRowsPerExcitation(t *testing.T) {
+	matrix, err := DecodeCSV(strings.NewReader("# comment\nex\\em, 500, 550, 600\n350, 0, 0.1, 0.2\n400, 0.3, 0.4, 0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Matrix{
+		Excitation: []float64{350, 400},
+		Emission:   []float64{500, 550, 600},
+		Values:     [][]float64{{0, 0.1, 0.2}, {0.3, 0.4, 0.5}},
+	}
+	if !reflect.DeepEqual(matrix, want) {
+		t.Fatalf("matrix = %+v, want %+v", matrix, want)
+	}
+}
+
+func TestDecodeRejectsMalformedTables(t *testing.T) {
+	for name, table := range map[string]string{
+		"ragged":  "nm, 500, 600\n400, 0.1\n",
+		"number":  "nm, 500, 600\n400, 0.1, x\n",
+		"no-rows": "nm, 500, 600\n",
+		"empty":   "",
+	} {
+		if _, err := DecodeCSV(strings.NewReader(table)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := DecodeJSON(strings.NewReader(`{"excitation_nm": [400], "emission_nm": [500, 600], "values": [[1]]}`)); err == nil {
+		t.Error("expected an error for a short JSON row")
+	}
+}
+
+func TestReadFileChoosesDecoderByExtension(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "matrix.json")
+	csvPath := filepath.Join(dir, "matrix.csv")
+	if err := os.WriteFile(jsonPath, []byte(`{"excitation_nm": [400, 450], "emission_nm": [500, 600], "values": [[0, 1], [2, 3]]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(csvPath, []byte("nm, 500, 600\n400, 0, 1\n450, 2, 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromCSV, err := ReadFile(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromCSV) {
+		t.Fatalf("JSON %+v and CSV %+v differ", fromJSON, fromCSV)
+	}
+}
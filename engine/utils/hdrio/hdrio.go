@@ -0,0 +1,62 @@
+// Package hdrio decodes the high-dynamic-range image formats used for
+// environment maps: Radiance RGBE (.hdr) and portable float maps (.pfm).
+package hdrio
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Image is a linear RGB raster stored row-major from the top row down,
+// three float32 channels per pixel.
+type Image struct {
+	Width  int
+	Height int
+	Pixels []float32
+}
+
+// At returns the RGB value of pixel (x, y), with y = 0 at the top.
+func (img *Image) At(x, y int) [3]float64 {
+	i := 3 * (y*img.Width + x)
+	return [3]float64{float64(img.Pixels[i]), float64(img.Pixels[i+1]), float64(img.Pixels[i+2])}
+}
+
+func newImage(width, height int) (*Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	if width > maxDimension || height > maxDimension {
+		return nil, fmt.Errorf("image size %dx%d exceeds %d pixels per side", width, height, maxDimension)
+	}
+	return &Image{Width: width, Height: height, Pixels: make([]float32, 3*width*height)}, nil
+}
+
+const maxDimension = 1 << 15
+
+// ReadFile decodes path by its extension: .hdr and .pic as Radiance RGBE,
+// .pfm as a portable float map.
+func ReadFile(path string) (*Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var img *Image
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".hdr", ".pic":
+		img, err = DecodeRGBE(reader)
+	case ".pfm":
+		img, err = DecodePFM(reader)
+	default:
+		return nil, fmt.Errorf("unsupported HDR image extension %q (want .hdr or .pfm)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	return img, nil
+}
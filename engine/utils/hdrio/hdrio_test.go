@@ -0,0 +1,140 @@
+package hdrio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func rgbeValue(mantissa, exponent byte) float64 {
+	return (float64(mantissa) + 0.5) * math.Ldexp(1, int(exponent)-136)
+}
+
+func TestDecodeRGBEReadsRunLengthScanlines(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\nEXPOSURE=1.0\n\n-Y 2 +X 8\n")
+	// Row 0: new-style RLE, red as one run, green as literals, blue and
+	// exponent as runs.
+	data.Write([]byte{2, 2, 0, 8})
+	data.Write([]byte{128 + 8, 200})
+	data.Write([]byte{8, 0, 10, 20, 30, 40, 50, 60, 70})
+	data.Write([]byte{128 + 8, 0})
+	data.Write([]byte{128 + 8, 129})
+	// Row 1: new-style RLE, everything black.
+	data.Write([]byte{2, 2, 0, 8})
+	for channel := 0; channel < 4; channel++ {
+		data.Write([]byte{128 + 8, 0})
+	}
+
+	img, err := DecodeRGBE(bufio.NewReader(&data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Width != 8 || img.Height != 2 {
+		t.Fatalf("size = %dx%d, want 8x2", img.Width, img.Height)
+	}
+	for x := 0; x < 8; x++ {
+		got := img.At(x, 0)
+		want := [3]float64{rgbeValue(200, 129), rgbeValue(byte(10*x), 129), rgbeValue(0, 129)}
+		for c := range got {
+			if math.Abs(got[c]-want[c]) > 1e-6 {
+				t.Fatalf("pixel (%d, 0) = %v, want %v", x, got, want)
+			}
+		}
+		if got := img.At(x, 1); got != [3]float64{} {
+			t.Fatalf("pixel (%d, 1) = %v, want black", x, got)
+		}
+	}
+}
+
+func TestDecodeRGBEReadsFlatScanlinesWithRepeats(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("#?RGBE\n\n+Y 2 +X 3\n")
+	// Stored bottom row first because of +Y.
+	data.Write([]byte{10, 20, 30, 128, 1, 1, 1, 2})
+	data.Write([]byte{0, 0, 0, 0, 5, 5, 5, 130, 6, 6, 6, 130})
+
+	img, err := DecodeRGBE(bufio.NewReader(&data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 3; x++ {
+		if got, want := img.At(x, 1)[2], rgbeValue(30, 128); math.Abs(got-want) > 1e-6 {
+			t.Fatalf("bottom pixel %d blue = %g, want %g", x, got, want)
+		}
+	}
+	if got := img.At(0, 0); got != [3]float64{} {
+		t.Fatalf("top-left pixel = %v, want black", got)
+	}
+	if got, want := img.At(2, 0)[0], rgbeValue(6, 130); math.Abs(got-want) > 1e-6 {
+		t.Fatalf("top-right red = %g, want %g", got, want)
+	}
+}
+
+func TestDecodeRGBERejectsUnsupportedFormat(t *testing.T) {
+	data := bytes.NewBufferString("#?RADIANCE\nFORMAT=32-bit_rle_xyze\n\n-Y 1 +X 1\n\x00\x00\x00\x00")
+	if _, err := DecodeRGBE(bufio.NewReader(data)); err == nil {
+		t.Fatal("expected XYZE pictures to be rejected")
+	}
+}
+
+func TestDecodePFMFlipsRowsAndHonorsByteOrder(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("PF\n2 2\n-1.0\n")
+	// Bottom row first, little-endian.
+	values := []float32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if err := binary.Write(&data, binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := DecodePFM(bufio.NewReader(&data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.At(0, 1); got != [3]float64{1, 2, 3} {
+		t.Fatalf("bottom-left = %v, want [1 2 3]", got)
+	}
+	if got := img.At(1, 0); got != [3]float64{10, 11, 12} {
+		t.Fatalf("top-right = %v, want [10 11 12]", got)
+	}
+}
+
+func TestDecodePFMExpandsGreyscale(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("Pf\n1 1\n1.0\n")
+	if err := binary.Write(&data, binary.BigEndian, float32(0.25)); err != nil {
+		t.Fatal(err)
+	}
+	img, err := DecodePFM(bufio.NewReader(&data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.At(0, 0); got != [3]float64{0.25, 0.25, 0.25} {
+		t.Fatalf("pixel = %v, want grey 0.25", got)
+	}
+}
+
+func TestReadFileDispatchesOnExtension(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sky.pfm")
+	var data bytes.Buffer
+	data.WriteString("Pf\n1 1\n-1\n")
+	binary.Write(&data, binary.LittleEndian, float32(2))
+	if err := os.WriteFile(path, data.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.At(0, 0)[1]; got != 2 {
+		t.Fatalf("pixel = %g, want 2", got)
+	}
+	if _, err := ReadFile(filepath.Join(dir, "sky.exr")); err == nil {
+		t.Fatal("expected an unsupported extension to be rejected")
+	}
+}
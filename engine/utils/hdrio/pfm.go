@@ -0,0 +1,94 @@
+package hdrio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// DecodePFM reads a portable float map: "PF" for RGB or "Pf" for greyscale,
+// the width and height, then a scale whose sign selects the byte order
+// (negative means little-endian). Rows are stored bottom to top.
+func DecodePFM(r *bufio.Reader) (*Image, error) {
+	magic, err := readPFMToken(r)
+	if err != nil {
+		return nil, err
+	}
+	var channels int
+	switch magic {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, fmt.Errorf("invalid PFM signature %q", magic)
+	}
+
+	var header [3]float64
+	for i := range header {
+		token, err := readPFMToken(r)
+		if err != nil {
+			return nil, err
+		}
+		if header[i], err = strconv.ParseFloat(token, 64); err != nil {
+			return nil, fmt.Errorf("invalid PFM header value %q", token)
+		}
+	}
+	width, height, scale := int(header[0]), int(header[1]), header[2]
+	if float64(width) != header[0] || float64(height) != header[1] {
+		return nil, fmt.Errorf("invalid PFM size %gx%g", header[0], header[1])
+	}
+	if scale == 0 || math.IsNaN(scale) {
+		return nil, fmt.Errorf("invalid PFM scale %g", scale)
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	img, err := newImage(width, height)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]byte, 4*channels*width)
+	for stored := 0; stored < height; stored++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return nil, fmt.Errorf("row %d: %w", stored, err)
+		}
+		y := height - 1 - stored
+		out := img.Pixels[3*y*width : 3*(y+1)*width]
+		for x := 0; x < width; x++ {
+			for c := 0; c < 3; c++ {
+				offset := 4 * (channels*x + c%channels)
+				out[3*x+c] = math.Float32frombits(order.Uint32(row[offset:]))
+			}
+		}
+	}
+	return img, nil
+}
+
+// readPFMToken returns the next whitespace-delimited header token and
+// consumes exactly one whitespace byte after it, so the raster that follows
+// the scale is not touched.
+func readPFMToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", fmt.Errorf("read PFM header: %w", err)
+		}
+		if b == ' ' || b == '\t' || b == '\n' || b == '\r' {
+			if len(token) > 0 {
+				return string(token), nil
+			}
+			continue
+		}
+		token = append(token, b)
+	}
+}
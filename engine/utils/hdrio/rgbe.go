@@ -0,0 +1,175 @@
+package hdrio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// DecodeRGBE reads a Radiance picture in 32-bit_rle_rgbe format. Scanlines
+// may be flat, old-style run-length encoded or new-style per-channel RLE.
+// The EXPOSURE header is ignored, as most HDR tools do.
+func DecodeRGBE(r *bufio.Reader) (*Image, error) {
+	width, height, flipY, err := readRGBEHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	img, err := newImage(width, height)
+	if err != nil {
+		return nil, err
+	}
+	scanline := make([]byte, 4*width)
+	for row := 0; row < height; row++ {
+		if err := readRGBEScanline(r, scanline); err != nil {
+			return nil, fmt.Errorf("scanline %d: %w", row, err)
+		}
+		y := row
+		if flipY {
+			y = height - 1 - row
+		}
+		out := img.Pixels[3*y*width : 3*(y+1)*width]
+		for x := 0; x < width; x++ {
+			rgbeToFloat(scanline[4*x:4*x+4], out[3*x:3*x+3])
+		}
+	}
+	return img, nil
+}
+
+func readRGBEHeader(r *bufio.Reader) (width, height int, flipY bool, err error) {
+	line, err := readHeaderLine(r)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !strings.HasPrefix(line, "#?") {
+		return 0, 0, false, fmt.Errorf("missing Radiance signature")
+	}
+	for {
+		line, err = readHeaderLine(r)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if line == "" {
+			break
+		}
+		if format, ok := strings.CutPrefix(line, "FORMAT="); ok && format != "32-bit_rle_rgbe" {
+			return 0, 0, false, fmt.Errorf("unsupported pixel format %q", format)
+		}
+	}
+
+	line, err = readHeaderLine(r)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	var yAxis, xAxis string
+	if _, err := fmt.Sscanf(line, "%s %d %s %d", &yAxis, &height, &xAxis, &width); err != nil {
+		return 0, 0, false, fmt.Errorf("invalid resolution line %q", line)
+	}
+	if xAxis != "+X" || (yAxis != "-Y" && yAxis != "+Y") {
+		return 0, 0, false, fmt.Errorf("unsupported image orientation %q", line)
+	}
+	return width, height, yAxis == "+Y", nil
+}
+
+func readHeaderLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("read header: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func readRGBEScanline(r *bufio.Reader, scanline []byte) error {
+	width := len(scanline) / 4
+	if _, err := io.ReadFull(r, scanline[:4]); err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || scanline[0] != 2 || scanline[1] != 2 || scanline[2]&0x80 != 0 {
+		return readFlatScanline(r, scanline)
+	}
+	if encoded := int(scanline[2])<<8 | int(scanline[3]); encoded != width {
+		return fmt.Errorf("run-length scanline width %d, want %d", encoded, width)
+	}
+
+	// New-style RLE stores each channel separately as runs and literals.
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				run := int(count - 128)
+				if x+run > width {
+					return fmt.Errorf("run overflows scanline")
+				}
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; run > 0; run-- {
+					scanline[4*x+channel] = value
+					x++
+				}
+				continue
+			}
+			literal := int(count)
+			if literal == 0 || x+literal > width {
+				return fmt.Errorf("invalid literal run of %d", literal)
+			}
+			for ; literal > 0; literal-- {
+				value, err := r.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[4*x+channel] = value
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+// readFlatScanline finishes a scanline whose first pixel is already in
+// scanline[:4]. Pixels of (1, 1, 1, n) repeat the previous pixel, with
+// consecutive repeat markers shifting the count left by eight bits.
+func readFlatScanline(r *bufio.Reader, scanline []byte) error {
+	width := len(scanline) / 4
+	shift := uint(0)
+	for x := 1; x < width; {
+		pixel := scanline[4*x : 4*x+4]
+		if _, err := io.ReadFull(r, pixel); err != nil {
+			return err
+		}
+		if pixel[0] != 1 || pixel[1] != 1 || pixel[2] != 1 {
+			shift = 0
+			x++
+			continue
+		}
+		repeat := int(pixel[3]) << shift
+		if x+repeat > width {
+			return fmt.Errorf("repeat overflows scanline")
+		}
+		for ; repeat > 0; repeat-- {
+			copy(scanline[4*x:4*x+4], scanline[4*x-4:4*x])
+			x++
+		}
+		shift += 8
+	}
+	return nil
+}
+
+func rgbeToFloat(rgbe []byte, out []float32) {
+	if rgbe[3] == 0 {
+		out[0], out[1], out[2] = 0, 0, 0
+		return
+	}
+	scale := math.Ldexp(1, int(rgbe[3])-(128+8))
+	for i := 0; i < 3; i++ {
+		out[i] = float32((float64(rgbe[i]) + 0.5) * scale)
+	}
+}
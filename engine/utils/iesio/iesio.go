@@ -0,0 +1,262 @@
+// Package iesio decodes IES LM-63 photometric files, the measured luminous
+// intensity distributions that luminaire manufacturers publish.
+package iesio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Profile is the candela distribution of a type C photometric file. Vertical
+// angles are measured in degrees from the nadir (0) to the zenith (180), and
+// horizontal angles in degrees around the vertical axis from the C0 plane.
+// Candela holds one row of len(Vertical) values per horizontal angle, already
+// scaled by the candela multiplier and the ballast factors, which are kept
+// for reference.
+type Profile struct {
+	Vertical          []float64
+	Horizontal        []float64
+	Candela           [][]float64
+	Multiplier        float64
+	BallastFactor     float64
+	BallastLampFactor float64
+}
+
+// Photometric types defined by LM-63. Only type C, used for architectural
+// luminaires, is supported.
+const (
+	photometricTypeC = 1
+	photometricTypeB = 2
+	photometricTypeA = 3
+)
+
+const maxAngles = 1 << 12
+
+// ReadFile decodes the LM-63 file at path.
+func ReadFile(path string) (*Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	profile, err := Decode(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	return profile, nil
+}
+
+// Decode reads an LM-63 file of any revision from 1986 to 2019. Keyword lines
+// are skipped, and TILT data, which only matters for lamps mounted at an
+// angle, is read and ignored.
+func Decode(r *bufio.Reader) (*Profile, error) {
+	tilt, err := readTiltLine(r)
+	if err != nil {
+		return nil, err
+	}
+	numbers := &numberReader{r: r}
+	switch tilt {
+	case "NONE":
+	case "INCLUDE":
+		if _, err := numbers.next(); err != nil { // lamp-to-luminaire geometry
+			return nil, err
+		}
+		count, err := numbers.count("tilt angle count")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := numbers.slice(2 * count); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("external TILT file %q is not supported", tilt)
+	}
+
+	// Lamps, lumens per lamp, candela multiplier, angle counts, photometric
+	// and unit types, luminous opening size; then ballast factor,
+	// ballast-lamp factor and input watts.
+	header, err := numbers.slice(13)
+	if err != nil {
+		return nil, err
+	}
+	multiplier := header[2]
+	verticalCount, horizontalCount := int(header[3]), int(header[4])
+	if float64(verticalCount) != header[3] || float64(horizontalCount) != header[4] ||
+		verticalCount < 1 || horizontalCount < 1 || verticalCount > maxAngles || horizontalCount > maxAngles {
+		return nil, fmt.Errorf("invalid angle counts %g and %g", header[3], header[4])
+	}
+	switch int(header[5]) {
+	case photometricTypeC:
+	case photometricTypeB, photometricTypeA:
+		return nil, fmt.Errorf("photometric type %g is not supported (want type C)", header[5])
+	default:
+		return nil, fmt.Errorf("invalid photometric type %g", header[5])
+	}
+	ballastFactor, ballastLampFactor := header[10], header[11]
+	scale := multiplier * ballastFactor * ballastLampFactor
+	if !(scale > 0) || math.IsInf(scale, 0) {
+		return nil, fmt.Errorf("candela multiplier and ballast factors must be positive")
+	}
+
+	profile := &Profile{Multiplier: multiplier, BallastFactor: ballastFactor, BallastLampFactor: ballastLampFactor}
+	if profile.Vertical, err = numbers.slice(verticalCount); err != nil {
+		return nil, err
+	}
+	if profile.Horizontal, err = numbers.slice(horizontalCount); err != nil {
+		return nil, err
+	}
+	profile.Candela = make([][]float64, horizontalCount)
+	for h := range profile.Candela {
+		row, err := numbers.slice(verticalCount)
+		if err != nil {
+			return nil, err
+		}
+		for v, value := range row {
+			if value < 0 {
+				return nil, fmt.Errorf("negative candela value %g", value)
+			}
+			row[v] = value * scale
+		}
+		profile.Candela[h] = row
+	}
+	if err := profile.validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func (p *Profile) validate() error {
+	if err := increasing(p.Vertical, "vertical"); err != nil {
+		return err
+	}
+	if err := increasing(p.Horizontal, "horizontal"); err != nil {
+		return err
+	}
+	if first, last := p.Vertical[0], p.Vertical[len(p.Vertical)-1]; first < 0 || last > 180 {
+		return fmt.Errorf("vertical angles must lie in [0, 180], got [%g, %g]", first, last)
+	}
+	if first := p.Horizontal[0]; first != 0 {
+		return fmt.Errorf("horizontal angles must start at 0, got %g", first)
+	}
+	switch last := p.Horizontal[len(p.Horizontal)-1]; last {
+	case 0, 90, 180, 360:
+	default:
+		return fmt.Errorf("horizontal angles must end at 0, 90, 180 or 360, got %g", last)
+	}
+	return nil
+}
+
+func increasing(angles []float64, name string) error {
+	for i, angle := range angles {
+		if i > 0 && angle <= angles[i-1] {
+			return fmt.Errorf("%s angles must increase strictly", name)
+		}
+	}
+	return nil
+}
+
+// FullCircle expands the horizontal symmetry of the file: a single C0 plane
+// is rotationally symmetric, planes up to 90 mirror into every quadrant, and
+// planes up to 180 mirror across the C0-C180 plane. The result covers [0, 360]
+// and its last row repeats the first.
+func (p *Profile) FullCircle() (horizontal []float64, candela [][]float64) {
+	last := p.Horizontal[len(p.Horizontal)-1]
+	switch last {
+	case 0:
+		return []float64{0, 360}, [][]float64{p.Candela[0], p.Candela[0]}
+	case 360:
+		return append([]float64(nil), p.Horizontal...), append([][]float64(nil), p.Candela...)
+	}
+	horizontal = append([]float64(nil), p.Horizontal...)
+	candela = append([][]float64(nil), p.Candela...)
+	// Mirroring about 90 covers [0, 180]; mirroring about 180 covers [0, 360].
+	for ; last < 360; last *= 2 {
+		for i := len(horizontal) - 2; i >= 0; i-- {
+			horizontal = append(horizontal, 2*last-horizontal[i])
+			candela = append(candela, candela[i])
+		}
+	}
+	return horizontal, candela
+}
+
+// readTiltLine skips the version and keyword lines and returns the value of
+// the TILT line.
+func readTiltLine(r *bufio.Reader) (string, error) {
+	for {
+		line, err := r.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(trimmed, "TILT="); ok {
+			return strings.TrimSpace(value), nil
+		}
+		if err == io.EOF {
+			return "", fmt.Errorf("missing TILT line")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// numberReader reads the whitespace- or comma-separated numbers that follow
+// the TILT line; LM-63 lets them wrap across lines freely.
+type numberReader struct {
+	r *bufio.Reader
+}
+
+func (n *numberReader) next() (float64, error) {
+	var token strings.Builder
+	for {
+		c, err := n.r.ReadByte()
+		if err == io.EOF && token.Len() > 0 {
+			break
+		}
+		if err == io.EOF {
+			return 0, fmt.Errorf("unexpected end of photometric data")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',' {
+			if token.Len() > 0 {
+				break
+			}
+			continue
+		}
+		token.WriteByte(c)
+	}
+	value, err := strconv.ParseFloat(token.String(), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid number %q", token.String())
+	}
+	return value, nil
+}
+
+func (n *numberReader) slice(count int) ([]float64, error) {
+	values := make([]float64, count)
+	for i := range values {
+		value, err := n.next()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func (n *numberReader) count(name string) (int, error) {
+	value, err := n.next()
+	if err != nil {
+		return 0, err
+	}
+	count := int(value)
+	if float64(count) != value || count < 0 || count > maxAngles {
+		return 0, fmt.Errorf("invalid %s %g", name, value)
+	}
+	return count, nil
+}
@@ -0,0 +1,97 @@
+package iesio
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const quadrantProfile = `IESNA:LM-63-2002
+[TEST] quadrant test
+[MANUFAC] none
+TILT=INCLUDE
+1
+2
+0 90
+1 0.5
+1 1000 2 3 2 1 2 0.1 0.1 0
+0.5 1 40
+0 45 90
+0 90
+100, 50 0
+80 40
+10
+`
+
+func TestDecodeScalesCandelaAndSkipsTilt(t *testing.T) {
+	profile, err := Decode(bufio.NewReader(strings.NewReader(quadrantProfile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(profile.Vertical, []float64{0, 45, 90}) || !reflect.DeepEqual(profile.Horizontal, []float64{0, 90}) {
+		t.Fatalf("angles = %v, %v", profile.Vertical, profile.Horizontal)
+	}
+	// Multiplier 2 times ballast factor 0.5.
+	want := [][]float64{{100, 50, 0}, {80, 40, 10}}
+	if !reflect.DeepEqual(profile.Candela, want) {
+		t.Fatalf("candela = %v, want %v", profile.Candela, want)
+	}
+	if profile.Multiplier != 2 || profile.BallastFactor != 0.5 || profile.BallastLampFactor != 1 {
+		t.Fatalf("scale factors = %g, %g, %g", profile.Multiplier, profile.BallastFactor, profile.BallastLampFactor)
+	}
+}
+
+func TestFullCircleMirrorsSymmetricProfiles(t *testing.T) {
+	profile := &Profile{
+		Vertical:   []float64{0, 90},
+		Horizontal: []float64{0, 30, 90},
+		Candela:    [][]float64{{1, 0}, {2, 0}, {3, 0}},
+	}
+	horizontal, candela := profile.FullCircle()
+	if want := []float64{0, 30, 90, 150, 180, 210, 270, 330, 360}; !reflect.DeepEqual(horizontal, want) {
+		t.Fatalf("horizontal = %v, want %v", horizontal, want)
+	}
+	var first []float64
+	for _, row := range candela {
+		first = append(first, row[0])
+	}
+	if want := []float64{1, 2, 3, 2, 1, 2, 3, 2, 1}; !reflect.DeepEqual(first, want) {
+		t.Fatalf("candela = %v, want %v", first, want)
+	}
+
+	profile.Horizontal, profile.Candela = []float64{0}, [][]float64{{1, 0}}
+	if horizontal, candela := profile.FullCircle(); !reflect.DeepEqual(horizontal, []float64{0, 360}) || len(candela) != 2 {
+		t.Fatalf("rotational profile = %v, %v", horizontal, candela)
+	}
+}
+
+func TestDecodeRejectsUnsupportedProfiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"type B":        "TILT=NONE\n1 1000 1 2 1 2 1 0 0 0\n1 1 0\n0 90\n0\n1 1\n",
+		"tilt file":     "TILT=lamp.tlt\n",
+		"no tilt":       "IESNA:LM-63-2002\n",
+		"short":         "TILT=NONE\n1 1000 1 2 1 1 1 0 0 0\n1 1 0\n0 90\n0\n1\n",
+		"odd azimuth":   "TILT=NONE\n1 1000 1 2 2 1 1 0 0 0\n1 1 0\n0 90\n0 45\n1 1 1 1\n",
+		"unsorted":      "TILT=NONE\n1 1000 1 2 1 1 1 0 0 0\n1 1 0\n90 0\n0\n1 1\n",
+		"negative":      "TILT=NONE\n1 1000 1 2 1 1 1 0 0 0\n1 1 0\n0 90\n0\n-1 1\n",
+		"not a number":  "TILT=NONE\n1 1000 x 2 1 1 1 0 0 0\n1 1 0\n0 90\n0\n1 1\n",
+		"zero multiply": "TILT=NONE\n1 1000 0 2 1 1 1 0 0 0\n1 1 0\n0 90\n0\n1 1\n",
+	} {
+		if _, err := Decode(bufio.NewReader(strings.NewReader(data))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReadFileNamesThePath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.ies")
+	if err := os.WriteFile(path, []byte("TILT=NONE\n1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(path); err == nil || !strings.Contains(err.Error(), "broken.ies") {
+		t.Fatalf("error = %v, want the path", err)
+	}
+}
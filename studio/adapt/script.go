@@ -41,6 +41,7 @@ func AdaptScript(script *schema.StudioScript, source []string, dimension int) (*
 		Materials: cloneMapSlice(script.Materials),
 		Media:     cloneNestedStringMap(script.Media),
 		Objects:   objects,
+		Lights:    cloneMapSlice(script.Lights),
 		Cameras:   cameras,
 		Geometry:  cloneMap(script.Geometry),
 		Renders:   renders,
@@ -65,6 +66,36 @@ func renderToMap(script *schema.StudioScript, render schema.StudioRenderScript,
 	if render.Samples > 0 {
 		result["samples"] = render.Samples
 	}
+	if render.Seed > 0 {
+		result["seed"] = render.Seed
+	}
+	if render.Sampler != "" {
+		result["sampler"] = render.Sampler
+	}
+	if render.Filter != "" {
+		result["filter"] = render.Filter
+	}
+	if render.FilterRadius > 0 {
+		result["filter_radius"] = render.FilterRadius
+	}
+	if render.AdaptiveRelativeError > 0 {
+		result["adaptive_relative_error"] = render.AdaptiveRelativeError
+	}
+	if render.AdaptiveMinSamples > 0 {
+		result["adaptive_min_samples"] = render.AdaptiveMinSamples
+	}
+	if render.AdaptiveMaxSamples > 0 {
+		result["adaptive_max_samples"] = render.AdaptiveMaxSamples
+	}
+	if render.PathGuiding {
+		result["path_guiding"] = true
+	}
+	if render.PathGuidingTrainingSamples > 0 {
+		result["path_guiding_training_samples"] = render.PathGuidingTrainingSamples
+	}
+	if render.Polarized {
+		result["polarized"] = true
+	}
 	if render.ThreadNum > 0 {
 		result["thread_num"] = render.ThreadNum
 	}
@@ -80,6 +111,36 @@ func renderToMap(script *schema.StudioScript, render schema.StudioRenderScript,
 	if wavelengthSamples > 0 {
 		result["wavelength_samples"] = wavelengthSamples
 	}
+	if render.SPPMPhotonsPerPass > 0 {
+		result["sppm_photons_per_pass"] = render.SPPMPhotonsPerPass
+	}
+	if render.SPPMInitialRadius > 0 {
+		result["sppm_initial_radius"] = render.SPPMInitialRadius
+	}
+	if render.PSSMLTSeed > 0 {
+		result["pssmlt_seed"] = render.PSSMLTSeed
+	}
+	if render.PSSMLTChains > 0 {
+		result["pssmlt_chains"] = render.PSSMLTChains
+	}
+	if render.PSSMLTBootstrapSamples > 0 {
+		result["pssmlt_bootstrap_samples"] = render.PSSMLTBootstrapSamples
+	}
+	if render.PSSMLTLargeStepProbability > 0 {
+		result["pssmlt_large_step_probability"] = render.PSSMLTLargeStepProbability
+	}
+	if render.VCMInitialRadius > 0 {
+		result["vcm_initial_radius"] = render.VCMInitialRadius
+	}
+	if render.AORadius > 0 {
+		result["ao_radius"] = render.AORadius
+	}
+	if render.TimeBudget > 0 {
+		result["time_budget"] = render.TimeBudget
+	}
+	if len(render.AOVs) > 0 {
+		result["aovs"] = append([]string(nil), render.AOVs...)
+	}
 	return result, nil
 }
 
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/Algo2147483647/ray/engine/event"
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
+	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/ray_tracing"
 	"github.com/Algo2147483647/ray/studio/schema"
 )
@@ -33,6 +37,8 @@ type studioConfig struct {
 	height             int
 	widths             []int
 	samples            int64
+	seed               uint64
+	sampler            string
 	outputImage        string
 	outputFilm         string
 	resumeFilm         string
@@ -47,7 +53,10 @@ type studioConfig struct {
 	spectrumMode       string
 	wavelengthSamples  int
 	colorSpace         string
+	aov                string
+	denoise            bool
 	pixelWindows       []schema.PixelWindowScript
+	events             event.Sink
 }
 
 type stringListFlag []string
@@ -73,7 +82,7 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 	flagSet.Var(&scriptPaths, "script", "path to a scene script; repeat to merge multiple scripts")
 	flagSet.StringVar(&config.inputFilm, "input-film", "", "existing binary Film to convert to PNG without rendering")
 	flagSet.Var(&pixelWindowFlags, "pixel-window", "pixel render window, for example 100:150,600:650; repeat for multiple windows")
-	flagSet.StringVar(&config.integrator, "integrator", "", "light transport integrator: path, bdpt, light_tracing")
+	flagSet.StringVar(&config.integrator, "integrator", "", "integrator: path, bdpt, light_tracing, sppm, pssmlt, vcm, or a diagnostic normals, geometric_normals, depth, uv, ao, bvh_heatmap")
 	flagSet.StringVar(&config.cameraID, "camera-id", "", "canonical Engine camera ID override")
 	flagSet.IntVar(&config.dimension, "dimension", 0, "scene dimension")
 	flagSet.IntVar(&config.threadNum, "threads", 0, "worker thread count")
@@ -87,6 +96,8 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 		return err
 	})
 	flagSet.Int64Var(&config.samples, "samples", 0, "samples per pixel")
+	flagSet.Uint64Var(&config.seed, "seed", 0, "sample seed; renders with equal seeds produce identical Films")
+	flagSet.StringVar(&config.sampler, "sampler", "", "sample generator: independent, stratified, halton, sobol, blue_noise_sobol")
 	flagSet.StringVar(&config.outputImage, "output-image", "", "output image path")
 	flagSet.StringVar(&config.outputFilm, "output-film", "", "output film path")
 	flagSet.StringVar(&config.resumeFilm, "resume-film", "", "existing film path to merge before saving outputs")
@@ -101,6 +112,9 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 	flagSet.StringVar(&config.spectrumMode, "spectrum-mode", "", "spectrum mode: hero_wavelength, sampled")
 	flagSet.IntVar(&config.wavelengthSamples, "wavelength-samples", 0, "wavelength samples per camera sample in sampled mode")
 	flagSet.StringVar(&config.colorSpace, "color-space", "", "Studio output color space: linear_srgb, acescg, xyz")
+	flagSet.BoolVar(&config.denoise, "denoise", false, "denoise the radiance of output images, guided by the Film's AOVs")
+	flagSet.StringVar(&config.aov, "aov", "", "write this Film AOV to the image instead of the radiance, for example depth or object_id")
+	events := flagSet.String("events", event.FormatText, "Studio and Engine event output: text, json, or silent")
 
 	if err := flagSet.Parse(args); err != nil {
 		return studioConfig{}, err
@@ -108,6 +122,11 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 	flagSet.Visit(func(f *flag.Flag) {
 		config.provided[f.Name] = true
 	})
+	sink, err := event.NewSink(*events, os.Stdout)
+	if err != nil {
+		return studioConfig{}, err
+	}
+	config.events = sink
 	if len(pixelWindowFlags) > 0 {
 		windows, err := parseStudioPixelWindowFlags(pixelWindowFlags)
 		if err != nil {
@@ -125,6 +144,9 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 	if config.threadNum < 0 {
 		return studioConfig{}, fmt.Errorf("threads must be >= 0")
 	}
+	if _, err := sampler.ParseKind(config.sampler); err != nil {
+		return studioConfig{}, err
+	}
 	if config.width < 0 || config.height < 0 {
 		return studioConfig{}, fmt.Errorf("width and height must be >= 0")
 	}
@@ -177,6 +199,11 @@ func parseStudioConfig(args []string) (studioConfig, error) {
 	if config.colorSpace != "" && config.colorSpace != "linear_srgb" && config.colorSpace != "acescg" && config.colorSpace != "xyz" {
 		return studioConfig{}, fmt.Errorf("color-space must be linear_srgb, acescg, or xyz")
 	}
+	if config.aov != "" {
+		if _, err := modelcamera.ParseAOVKind(config.aov); err != nil {
+			return studioConfig{}, err
+		}
+	}
 	if config.provided["input-film"] {
 		if config.inputFilm == "" {
 			return studioConfig{}, fmt.Errorf("input-film cannot be empty")
@@ -201,7 +228,7 @@ func validateFilmConversionConfig(config studioConfig) error {
 	}
 	for _, name := range []string{
 		"integrator", "camera-id", "dimension", "threads", "width", "height", "widths",
-		"samples", "output-film", "resume-film", "endless", "checkpoint-interval",
+		"samples", "seed", "sampler", "output-film", "resume-film", "endless", "checkpoint-interval",
 		"checkpoint-dir", "start-iteration", "spectrum-mode", "wavelength-samples", "pixel-window",
 	} {
 		if config.provided[name] {
@@ -245,6 +272,12 @@ func (c studioConfig) applyEngineOverrides(script *schema.IntermediateScript, ou
 		} else if c.provided["samples"] {
 			render["samples"] = c.samples
 		}
+		if c.provided["seed"] {
+			render["seed"] = c.seed
+		}
+		if c.provided["sampler"] {
+			render["sampler"] = c.sampler
+		}
 		if c.provided["spectrum-mode"] {
 			render["spectrum_mode"] = c.spectrumMode
 		}
@@ -271,6 +304,23 @@ func (c studioConfig) applyEngineOverrides(script *schema.IntermediateScript, ou
 	}
 }
 
+func renderSeeds(script *schema.IntermediateScript) []uint64 {
+	seeds := make([]uint64, len(script.Renders))
+	for i, render := range script.Renders {
+		seeds[i], _ = render["seed"].(uint64)
+	}
+	return seeds
+}
+
+// reseedRenders keys each render's samples by the sample iteration it starts
+// at. A render merged into an existing Film would otherwise repeat the
+// samples already in it.
+func reseedRenders(script *schema.IntermediateScript, seeds []uint64, iteration int64) {
+	for i, render := range script.Renders {
+		render["seed"] = sampler.Hash(seeds[i], uint64(iteration))
+	}
+}
+
 func normalizeIntermediateRender(render map[string]interface{}) {
 	if render["spectrum_mode"] != "sampled" {
 		return
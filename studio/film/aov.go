@@ -0,0 +1,117 @@
+package film
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
+)
+
+// aovImage renders one AOV of a Film as a false-color image in the atlas
+// layout of the radiance. Depth and sample counts are scaled by their maximum,
+// normals map [-1, 1] to [0, 1] on their first three axes, UVs are clamped,
+// albedo goes through the radiance pipeline without exposure or tone mapping,
+// Stokes vectors show their degree of linear polarization over all bins, and
+// IDs get a color hashed from their name, with black for -1.
+func aovImage(film *modelcamera.Film, options ImageOptions) (*image.RGBA, error) {
+	aov := film.AOV(options.AOV)
+	if aov == nil {
+		return nil, fmt.Errorf("Film has no %q AOV", options.AOV)
+	}
+	if options.AOV == modelcamera.AOVAlbedo {
+		albedo := modelcamera.NewFilm(film.Shape...)
+		albedo.InitSpectralBins(len(film.SpectralBins), film.SpectralMinNM, film.SpectralMaxNM)
+		for pixel := range film.ElementCount() {
+			for bin, value := range aov.Pixel(pixel) {
+				albedo.SpectralBins[bin].Data[pixel] = value
+			}
+		}
+		options.AOV = ""
+		options.Exposure = 1
+		options.ToneMapping = ToneMappingLinear
+		return ToImage(albedo, options)
+	}
+
+	output, set, err := newFilmAtlas(film)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	switch options.AOV {
+	case modelcamera.AOVObjectID:
+		ids = film.ObjectIDs
+	case modelcamera.AOVMaterialID:
+		ids = film.MaterialIDs
+	}
+	scale := 1.0
+	if options.AOV == modelcamera.AOVDepth || options.AOV == modelcamera.AOVSampleCount {
+		if peak := slices.Max(aov.Data); peak > 0 {
+			scale = 1 / peak
+		}
+	}
+	for pixel := range film.ElementCount() {
+		values := aov.Pixel(pixel)
+		var rgb [3]float64
+		switch {
+		case modelcamera.IsIDAOV(options.AOV):
+			rgb = idColor(ids, int(values[0]))
+		case options.AOV == modelcamera.AOVGeometricNormal || options.AOV == modelcamera.AOVShadingNormal:
+			for i := range min(len(values), 3) {
+				rgb[i] = (values[i] + 1) / 2
+			}
+		case options.AOV == modelcamera.AOVUV:
+			rgb[0], rgb[1] = values[0], values[1]
+		case options.AOV == modelcamera.AOVStokes:
+			dolp := linearPolarization(values)
+			rgb = [3]float64{dolp, dolp, dolp}
+		default:
+			rgb = [3]float64{values[0] * scale, values[0] * scale, values[0] * scale}
+		}
+		set(pixel, color.RGBA{R: unitByte(rgb[0]), G: unitByte(rgb[1]), B: unitByte(rgb[2]), A: 255})
+	}
+	return output, nil
+}
+
+// linearPolarization is the degree of linear polarization of the sum of the
+// per-bin Stokes vectors S0..S3 in values.
+func linearPolarization(values []float64) float64 {
+	var s0, s1, s2 float64
+	for bin := 0; bin+3 < len(values); bin += 4 {
+		s0 += values[bin]
+		s1 += values[bin+1]
+		s2 += values[bin+2]
+	}
+	if s0 <= 0 {
+		return 0
+	}
+	return math.Min(1, math.Hypot(s1, s2)/s0)
+}
+
+// idColor is a stable color for the ID at index of ids, the same across
+// Films that share the ID name.
+func idColor(ids []string, index int) [3]float64 {
+	if index < 0 || index >= len(ids) {
+		return [3]float64{}
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(ids[index]))
+	sum := hash.Sum32()
+	// Keep every channel above a floor so no ID is confused with the
+	// background.
+	return [3]float64{
+		0.25 + 0.75*float64(sum&0xff)/255,
+		0.25 + 0.75*float64(sum>>8&0xff)/255,
+		0.25 + 0.75*float64(sum>>16&0xff)/255,
+	}
+}
+
+func unitByte(value float64) uint8 {
+	if math.IsNaN(value) {
+		return 0
+	}
+	return uint8(math.Round(math.Max(0, math.Min(1, value)) * 255))
+}
@@ -32,6 +32,8 @@ type ImageOptions struct {
 	TanhOmega   float64
 	Gamma       float64
 	ColorSpace  ColorSpace
+	AOV         modelcamera.AOVKind // "" ⇒ the spectral radiance
+	Denoise     bool                // denoise the radiance before imaging it
 }
 
 func ToImage(film *modelcamera.Film, options ImageOptions) (*image.RGBA, error) {
@@ -42,21 +44,20 @@ func ToImage(film *modelcamera.Film, options ImageOptions) (*image.RGBA, error)
 	if err := validateImageOptions(options); err != nil {
 		return nil, err
 	}
-	shape := film.Shape
-	if len(shape) < 2 {
-		return nil, fmt.Errorf("image output requires a Film rank of at least 2")
+	if options.AOV != "" {
+		return aovImage(film, options)
 	}
-	width, height := shape[0], shape[1]
-	slices := 1
-	for _, extent := range shape[2:] {
-		slices *= extent
+	if options.Denoise {
+		denoised, err := Denoise(film, DenoiseOptions{})
+		if err != nil {
+			return nil, err
+		}
+		film = denoised
 	}
-	atlasCols := 1
-	if slices > 1 {
-		atlasCols = int(math.Ceil(math.Sqrt(float64(slices))))
+	output, set, err := newFilmAtlas(film)
+	if err != nil {
+		return nil, err
 	}
-	atlasRows := (slices + atlasCols - 1) / atlasCols
-	output := image.NewRGBA(image.Rect(0, 0, width*atlasCols, height*atlasRows))
 	whiteY := filmSpectralWhiteY(film)
 	if whiteY <= 0 {
 		return nil, fmt.Errorf("Film wavelength range has no visible CIE Y response")
@@ -86,20 +87,41 @@ func ToImage(film *modelcamera.Film, options ImageOptions) (*image.RGBA, error)
 		if options.ToneMapping == ToneMappingSpectralTanh {
 			r, g, b = fitRGBWithoutChannelClipping(r, g, b)
 		}
+		set(pixel, color.RGBA{
+			R: encodeOutputChannel(r, encodeOptions),
+			G: encodeOutputChannel(g, encodeOptions),
+			B: encodeOutputChannel(b, encodeOptions),
+			A: 255,
+		})
+	}
+	return output, nil
+}
+
+// newFilmAtlas returns an image that lays the two-dimensional slices of a
+// Film of rank 2 or more side by side in a near-square grid, and a function
+// that sets the image pixel of a Film pixel.
+func newFilmAtlas(film *modelcamera.Film) (*image.RGBA, func(int, color.RGBA), error) {
+	shape := film.Shape
+	if len(shape) < 2 {
+		return nil, nil, fmt.Errorf("image output requires a Film rank of at least 2")
+	}
+	width, height := shape[0], shape[1]
+	slices := 1
+	for _, extent := range shape[2:] {
+		slices *= extent
+	}
+	atlasCols := 1
+	if slices > 1 {
+		atlasCols = int(math.Ceil(math.Sqrt(float64(slices))))
+	}
+	atlasRows := (slices + atlasCols - 1) / atlasCols
+	output := image.NewRGBA(image.Rect(0, 0, width*atlasCols, height*atlasRows))
+	set := func(pixel int, c color.RGBA) {
 		coords := film.SpectralBins[0].GetCoordinates(pixel)
 		slice := flattenedSliceIndex(coords[2:], shape[2:])
-		output.Set(
-			coords[0]+(slice%atlasCols)*width,
-			coords[1]+(slice/atlasCols)*height,
-			color.RGBA{
-				R: encodeOutputChannel(r, encodeOptions),
-				G: encodeOutputChannel(g, encodeOptions),
-				B: encodeOutputChannel(b, encodeOptions),
-				A: 255,
-			},
-		)
+		output.Set(coords[0]+(slice%atlasCols)*width, coords[1]+(slice/atlasCols)*height, c)
 	}
-	return output, nil
+	return output, set, nil
 }
 
 func validateImageOptions(options ImageOptions) error {
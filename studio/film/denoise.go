@@ -0,0 +1,333 @@
+package film
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
+)
+
+const (
+	defaultDenoiseIterations     = 5
+	defaultDenoiseSigmaLuminance = 4
+	maxDenoiseIterations         = 16
+
+	// Edge-stopping scales of the feature buffers: the exponent of the
+	// normal cosine, the relative depth change per pixel, and the albedo
+	// difference.
+	denoiseSigmaNormal = 128
+	denoiseSigmaDepth  = 0.1
+	denoiseSigmaAlbedo = 0.2
+)
+
+// denoiseKernel is the B3-spline à-trous kernel along one axis.
+var denoiseKernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// DenoiseOptions configures Denoise. Zero values select the defaults.
+type DenoiseOptions struct {
+	Iterations     int     // à-trous passes with steps 1, 2, 4, …; 0 ⇒ 5
+	SigmaLuminance float64 // luminance edge stop in standard deviations; 0 ⇒ 4
+}
+
+// denoiseGuide holds the per-pixel features that stop the filter at edges.
+// A nil feature is not used.
+type denoiseGuide struct {
+	normals    []float64 // unit normals, normalDims per pixel; zero on misses
+	normalDims int
+	depth      []float64
+	albedo     []float64 // albedo summed over the spectral bins
+}
+
+// Denoise filters the spectral radiance of film with an edge-avoiding
+// à-trous wavelet. Each pass weights its 5^rank taps by the kernel, by the
+// luminance difference relative to the filtered standard deviation, and by
+// the shading or geometric normal, depth, and albedo AOVs when the Film
+// records them. The variance AOV gives the per-pixel variance; without it the
+// variance of the 3^rank neighborhood stands in. Luminance here is the
+// radiance summed over the spectral bins, the quantity the variance AOV
+// measures, and every bin of a pixel gets the same weights, so the filter
+// never shifts a spectrum.
+//
+// The result is a new Film for display. It carries no per-pixel counts,
+// filter weights, or AOVs, since these describe the samples rather than the
+// filtered image, and must not be merged into further renders.
+func Denoise(film *modelcamera.Film, options DenoiseOptions) (*modelcamera.Film, error) {
+	if film == nil || !film.HasSpectralBins() || film.ElementCount() == 0 {
+		return nil, fmt.Errorf("cannot denoise an empty spectral Film")
+	}
+	if options.Iterations == 0 {
+		options.Iterations = defaultDenoiseIterations
+	}
+	if options.SigmaLuminance == 0 {
+		options.SigmaLuminance = defaultDenoiseSigmaLuminance
+	}
+	if options.Iterations < 0 || options.Iterations > maxDenoiseIterations {
+		return nil, fmt.Errorf("denoise iterations must be between 1 and %d", maxDenoiseIterations)
+	}
+	if options.SigmaLuminance < 0 || math.IsNaN(options.SigmaLuminance) || math.IsInf(options.SigmaLuminance, 0) {
+		return nil, fmt.Errorf("denoise luminance sigma must be finite and > 0")
+	}
+
+	pixels, bins := film.ElementCount(), len(film.SpectralBins)
+	radiance := make([]float64, pixels*bins)
+	for bin := range film.SpectralBins {
+		for pixel, value := range film.SpectralBins[bin].Data {
+			radiance[pixel*bins+bin] = value
+		}
+	}
+	grid := newDenoiseGrid(film.Shape)
+	guide := newDenoiseGuide(film)
+	variance := denoiseVariance(film, grid, radiance, bins)
+	variance = grid.convolve(variance, gaussian3Kernel[:])
+
+	next := make([]float64, len(radiance))
+	nextVariance := make([]float64, pixels)
+	for iteration := range options.Iterations {
+		taps := grid.taps(1<<iteration, denoiseKernel[:])
+		luminance := sumBins(radiance, bins)
+		grid.parallel(func(pixel int, coords []int) {
+			lp := luminance[pixel]
+			scale := options.SigmaLuminance*math.Sqrt(max(variance[pixel], 0)) + 1e-10
+			out := next[pixel*bins : (pixel+1)*bins]
+			clear(out)
+			weightSum, varianceSum := 0.0, 0.0
+			grid.visitTaps(coords, taps, func(q int, tap denoiseTap) {
+				w := tap.weight * math.Exp(-math.Abs(lp-luminance[q])/scale) * guide.weight(pixel, q, tap.distance)
+				if w == 0 {
+					return
+				}
+				for bin, value := range radiance[q*bins : (q+1)*bins] {
+					out[bin] += w * value
+				}
+				weightSum += w
+				varianceSum += w * w * variance[q]
+			})
+			for bin := range out {
+				out[bin] /= weightSum
+			}
+			nextVariance[pixel] = varianceSum / (weightSum * weightSum)
+		})
+		radiance, next = next, radiance
+		variance, nextVariance = nextVariance, variance
+	}
+
+	denoised := modelcamera.NewFilm(film.Shape...)
+	denoised.Samples = film.Samples
+	denoised.InitSpectralBins(bins, film.SpectralMinNM, film.SpectralMaxNM)
+	for bin := range denoised.SpectralBins {
+		for pixel := range denoised.SpectralBins[bin].Data {
+			denoised.SpectralBins[bin].Data[pixel] = radiance[pixel*bins+bin]
+		}
+	}
+	return denoised, nil
+}
+
+func newDenoiseGuide(film *modelcamera.Film) denoiseGuide {
+	var guide denoiseGuide
+	normal := film.AOV(modelcamera.AOVShadingNormal)
+	if normal == nil {
+		normal = film.AOV(modelcamera.AOVGeometricNormal)
+	}
+	if normal != nil {
+		guide.normalDims = normal.Components
+		guide.normals = append([]float64(nil), normal.Data...)
+		for pixel := range film.ElementCount() {
+			n := guide.normals[pixel*guide.normalDims : (pixel+1)*guide.normalDims]
+			length := 0.0
+			for _, v := range n {
+				length += v * v
+			}
+			if length > 0 {
+				length = math.Sqrt(length)
+				for i := range n {
+					n[i] /= length
+				}
+			}
+		}
+	}
+	if depth := film.AOV(modelcamera.AOVDepth); depth != nil {
+		guide.depth = depth.Data
+	}
+	if albedo := film.AOV(modelcamera.AOVAlbedo); albedo != nil {
+		guide.albedo = sumBins(albedo.Data, albedo.Components)
+	}
+	return guide
+}
+
+// weight is the product of the feature edge stops between pixels p and q,
+// distance pixels apart. Two misses match; a miss never matches a hit.
+func (g denoiseGuide) weight(p, q int, distance float64) float64 {
+	w := 1.0
+	if g.normals != nil {
+		np := g.normals[p*g.normalDims : (p+1)*g.normalDims]
+		nq := g.normals[q*g.normalDims : (q+1)*g.normalDims]
+		cos, missP, missQ := 0.0, true, true
+		for i := range np {
+			cos += np[i] * nq[i]
+			missP = missP && np[i] == 0
+			missQ = missQ && nq[i] == 0
+		}
+		if !missP || !missQ {
+			w *= math.Pow(max(cos, 0), denoiseSigmaNormal)
+		}
+	}
+	if g.depth != nil {
+		zp, zq := g.depth[p], g.depth[q]
+		if zp != zq {
+			w *= math.Exp(-math.Abs(zp-zq) / (denoiseSigmaDepth * max(zp, zq) * distance))
+		}
+	}
+	if g.albedo != nil {
+		w *= math.Exp(-math.Abs(g.albedo[p]-g.albedo[q]) / denoiseSigmaAlbedo)
+	}
+	return w
+}
+
+// denoiseVariance is the variance AOV of film, or the variance of the
+// luminance over the 3^rank neighborhood of each pixel when the Film has none.
+func denoiseVariance(film *modelcamera.Film, grid denoiseGrid, radiance []float64, bins int) []float64 {
+	if aov := film.AOV(modelcamera.AOVVariance); aov != nil {
+		return append([]float64(nil), aov.Data...)
+	}
+	luminance := sumBins(radiance, bins)
+	variance := make([]float64, len(luminance))
+	taps := grid.taps(1, boxKernel3[:])
+	grid.parallel(func(pixel int, coords []int) {
+		var count, mean, m2 float64
+		grid.visitTaps(coords, taps, func(q int, _ denoiseTap) {
+			count++
+			delta := luminance[q] - mean
+			mean += delta / count
+			m2 += delta * (luminance[q] - mean)
+		})
+		if count > 1 {
+			variance[pixel] = m2 / (count - 1)
+		}
+	})
+	return variance
+}
+
+var (
+	gaussian3Kernel = [3]float64{1.0 / 4, 1.0 / 2, 1.0 / 4}
+	boxKernel3      = [3]float64{1, 1, 1}
+)
+
+// sumBins sums each pixel's components of pixel-major data.
+func sumBins(data []float64, components int) []float64 {
+	sums := make([]float64, len(data)/components)
+	for pixel := range sums {
+		for _, value := range data[pixel*components : (pixel+1)*components] {
+			sums[pixel] += value
+		}
+	}
+	return sums
+}
+
+// denoiseGrid walks the pixels of a Film of any rank.
+type denoiseGrid struct {
+	shape   []int
+	strides []int
+	pixels  int
+}
+
+func newDenoiseGrid(shape []int) denoiseGrid {
+	grid := denoiseGrid{shape: shape, strides: make([]int, len(shape)), pixels: 1}
+	for axis, extent := range shape {
+		grid.strides[axis] = grid.pixels
+		grid.pixels *= extent
+	}
+	return grid
+}
+
+// parallel calls visit for every pixel and its coordinates, splitting the
+// pixels among one worker per CPU. Workers write only their own pixels.
+func (g denoiseGrid) parallel(visit func(pixel int, coords []int)) {
+	workers := min(runtime.NumCPU(), g.pixels)
+	chunk := (g.pixels + workers - 1) / workers
+	var wg sync.WaitGroup
+	for first := 0; first < g.pixels; first += chunk {
+		wg.Add(1)
+		go func(first, last int) {
+			defer wg.Done()
+			coords := make([]int, len(g.shape))
+			for pixel := first; pixel < last; pixel++ {
+				rest := pixel
+				for axis := len(g.shape) - 1; axis >= 0; axis-- {
+					coords[axis] = rest / g.strides[axis]
+					rest %= g.strides[axis]
+				}
+				visit(pixel, coords)
+			}
+		}(first, min(first+chunk, g.pixels))
+	}
+	wg.Wait()
+}
+
+// denoiseTap is one offset of a separable kernel, with its product weight
+// and its length in pixels.
+type denoiseTap struct {
+	offset   []int
+	weight   float64
+	distance float64
+}
+
+// taps lists the offsets step·o with o ranging over the odd-length kernel
+// along every axis.
+func (g denoiseGrid) taps(step int, kernel []float64) []denoiseTap {
+	radius := len(kernel) / 2
+	taps := []denoiseTap{{weight: 1}}
+	for range g.shape {
+		extended := make([]denoiseTap, 0, len(taps)*len(kernel))
+		for _, tap := range taps {
+			for o := -radius; o <= radius; o++ {
+				extended = append(extended, denoiseTap{
+					offset:   append(append([]int(nil), tap.offset...), o*step),
+					weight:   tap.weight * kernel[o+radius],
+					distance: tap.distance + float64(o*o*step*step),
+				})
+			}
+		}
+		taps = extended
+	}
+	for i := range taps {
+		taps[i].distance = math.Sqrt(taps[i].distance)
+	}
+	return taps
+}
+
+// visitTaps calls visit for the pixel at every tap from coords that lies
+// inside the Film.
+func (g denoiseGrid) visitTaps(coords []int, taps []denoiseTap, visit func(q int, tap denoiseTap)) {
+	for _, tap := range taps {
+		q, inside := 0, true
+		for axis, o := range tap.offset {
+			c := coords[axis] + o
+			if c < 0 || c >= g.shape[axis] {
+				inside = false
+				break
+			}
+			q += c * g.strides[axis]
+		}
+		if inside {
+			visit(q, tap)
+		}
+	}
+}
+
+// convolve filters data with kernel along every axis, renormalizing at the
+// Film border.
+func (g denoiseGrid) convolve(data []float64, kernel []float64) []float64 {
+	taps := g.taps(1, kernel)
+	out := make([]float64, len(data))
+	g.parallel(func(pixel int, coords []int) {
+		sum, weightSum := 0.0, 0.0
+		g.visitTaps(coords, taps, func(q int, tap denoiseTap) {
+			sum += tap.weight * data[q]
+			weightSum += tap.weight
+		})
+		out[pixel] = sum / weightSum
+	})
+	return out
+}
@@ -5,7 +5,6 @@ import (
 	"image/png"
 	"os"
 	"path/filepath"
-	"slices"
 
 	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
 )
@@ -111,7 +110,7 @@ func MergeFilms(base, update *modelcamera.Film) error {
 	if base == nil || update == nil {
 		return fmt.Errorf("merge films: nil film")
 	}
-	return mergeFilmsAtPixelWindows(base, update, nil)
+	return base.Merge(update)
 }
 
 func MergeFilmsWithPixelWindows(base, update *modelcamera.Film, windows []modelcamera.PixelWindow) error {
@@ -125,43 +124,7 @@ func MergeFilmsWithPixelWindows(base, update *modelcamera.Film, windows []modelc
 	if err != nil {
 		return err
 	}
-	return mergeFilmsAtPixelWindows(base, update, normalized)
-}
-
-func mergeFilmsAtPixelWindows(base, update *modelcamera.Film, windows []modelcamera.PixelWindow) error {
-	if !slices.Equal(base.Shape, update.Shape) {
-		return fmt.Errorf("merge films: dimension of a and b is not matched")
-	}
-	if !compatibleSpectralBins(base, update) {
-		return fmt.Errorf("merge films: spectral layouts do not match")
-	}
-
-	totalSamples := base.Samples + update.Samples
-	if totalSamples == 0 {
-		return nil
-	}
-
-	pixels := pixelWindowIndices(base.Shape, windows)
-	if len(windows) == 0 {
-		pixels = make([]int, base.ElementCount())
-		for pixel := range pixels {
-			pixels[pixel] = pixel
-		}
-	}
-	for _, pixel := range pixels {
-		for bin := range base.SpectralBins {
-			base.SpectralBins[bin].Data[pixel] = (base.SpectralBins[bin].Data[pixel]*float64(base.Samples) + update.SpectralBins[bin].Data[pixel]*float64(update.Samples)) / float64(totalSamples)
-		}
-	}
-	base.Samples = totalSamples
-	return nil
-}
-
-func compatibleSpectralBins(base, update *modelcamera.Film) bool {
-	return len(base.SpectralBins) > 0 &&
-		len(base.SpectralBins) == len(update.SpectralBins) &&
-		base.SpectralMinNM == update.SpectralMinNM &&
-		base.SpectralMaxNM == update.SpectralMaxNM
+	return base.MergePixels(update, pixelWindowIndices(base.Shape, normalized))
 }
 
 func pixelWindowIndices(shape []int, windows []modelcamera.PixelWindow) []int {
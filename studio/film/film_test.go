@@ -88,6 +88,72 @@ func TestMergeFilmFilesWithPixelWindowsLeavesOutsidePixelsUntouched(t *testing.T
 	}
 }
 
+func TestMergeFilmsWeightsAdaptivePixelsByTheirCounts(t *testing.T) {
+	base := spectralFilm([]int{2, 1}, 2, 4, 0.5)
+	base.PixelSamples = []int64{4, 1}
+	update := spectralFilm([]int{2, 1}, 2, 3, 1)
+
+	if err := MergeFilms(base, update); err != nil {
+		t.Fatalf("merge films: %v", err)
+	}
+	if base.Samples != 7 || base.PixelSamples[0] != 7 || base.PixelSamples[1] != 4 {
+		t.Fatalf("samples = %d, pixel counts = %v; want 7 and [7 4]", base.Samples, base.PixelSamples)
+	}
+	for bin := range base.SpectralBins {
+		assertClose(t, base.SpectralBins[bin].Data[0], (4*0.5+3)/7)
+		assertClose(t, base.SpectralBins[bin].Data[1], (0.5+3)/4)
+	}
+}
+
+func TestMergeFilmsWeightsFilteredPixelsByTheirWeightSums(t *testing.T) {
+	base := spectralFilm([]int{2, 1}, 2, 4, 0.5)
+	base.FilterWeights = []float64{2, 6}
+	update := spectralFilm([]int{2, 1}, 2, 3, 1)
+
+	if err := MergeFilms(base, update); err != nil {
+		t.Fatalf("merge films: %v", err)
+	}
+	if base.FilterWeights[0] != 5 || base.FilterWeights[1] != 9 {
+		t.Fatalf("filter weights = %v, want [5 9]", base.FilterWeights)
+	}
+	for bin := range base.SpectralBins {
+		assertClose(t, base.SpectralBins[bin].Data[0], (2*0.5+3)/5)
+		assertClose(t, base.SpectralBins[bin].Data[1], (6*0.5+3)/9)
+	}
+}
+
+func TestMergeFilmsWeightsAOVsByCameraSamples(t *testing.T) {
+	films := make([]*modelcamera.Film, 2)
+	for i, samples := range []int64{1, 3} {
+		films[i] = spectralFilm([]int{1, 1}, 2, samples, 0)
+		films[i].AddAOV(modelcamera.AOVDepth, 1).Data[0] = float64(2 * (i + 1))
+		films[i].AddAOV(modelcamera.AOVObjectID, 1).Data[0] = float64(i)
+		films[i].AddAOV(modelcamera.AOVSampleCount, 1).Data[0] = float64(samples)
+		films[i].AddAOV(modelcamera.AOVVariance, 1).Data[0] = 0.5 / float64(samples*samples)
+		films[i].ObjectIDs = []string{"floor", "teapot"}
+	}
+	base, update := films[0], films[1]
+
+	if err := MergeFilms(base, update); err != nil {
+		t.Fatalf("merge films: %v", err)
+	}
+	assertClose(t, base.AOV(modelcamera.AOVDepth).Data[0], (1*2+3*4)/4.0)
+	assertClose(t, base.AOV(modelcamera.AOVObjectID).Data[0], 1)
+	assertClose(t, base.AOV(modelcamera.AOVSampleCount).Data[0], 4)
+	assertClose(t, base.AOV(modelcamera.AOVVariance).Data[0], 2*0.5/16)
+	if _, err := ToImage(base, ImageOptions{AOV: modelcamera.AOVObjectID}); err != nil {
+		t.Fatalf("image object IDs: %v", err)
+	}
+
+	update.ObjectIDs = []string{"teapot", "floor"}
+	if err := MergeFilms(base, update); err == nil {
+		t.Fatal("expected Films with different ID tables to be rejected")
+	}
+	if err := MergeFilms(base, spectralFilm([]int{1, 1}, 2, 1, 0)); err == nil {
+		t.Fatal("expected a Film without the AOVs to be rejected")
+	}
+}
+
 func TestSaveFilmImageFromFilmDoesNotRequireFilmFile(t *testing.T) {
 	film := spectralFilm([]int{1, 1}, 64, 1, 1.0/64)
 	imagePath := filepath.Join(t.TempDir(), "direct.png")
@@ -183,3 +249,63 @@ func assertClose(t *testing.T, got, expected float64) {
 		t.Fatalf("expected %f, got %f", expected, got)
 	}
 }
+
+func TestDenoiseSmoothsNoiseWithoutCrossingNormalEdges(t *testing.T) {
+	const width, height = 16, 8
+	film := spectralFilm([]int{width, height}, 2, 16, 0)
+	normal := film.AddAOV(modelcamera.AOVShadingNormal, 3)
+	variance := film.AddAOV(modelcamera.AOVVariance, 1)
+	// The left half faces the camera at radiance 1 per bin and the right
+	// half is a perpendicular wall at radiance 3; both carry ±0.2 noise.
+	for pixel := range film.ElementCount() {
+		x := pixel % width
+		value, axis := 1.0, 2
+		if x >= width/2 {
+			value, axis = 3, 0
+		}
+		if (pixel*7919)%5 < 2 {
+			value += 0.2
+		} else {
+			value -= 0.2
+		}
+		for bin := range film.SpectralBins {
+			film.SpectralBins[bin].Data[pixel] = value
+		}
+		normal.Pixel(pixel)[axis] = 1
+		variance.Data[pixel] = 4 * 0.04
+	}
+
+	denoised, err := Denoise(film, DenoiseOptions{})
+	if err != nil {
+		t.Fatalf("denoise: %v", err)
+	}
+	if denoised.AOVs != nil || denoised.Samples != film.Samples {
+		t.Fatalf("denoised Film = %+v, want the sample count without AOVs", denoised)
+	}
+	for pixel := range denoised.ElementCount() {
+		want := 1.0
+		if pixel%width >= width/2 {
+			want = 3
+		}
+		for bin := range denoised.SpectralBins {
+			if got := denoised.SpectralBins[bin].Data[pixel]; math.Abs(got-want) > 0.1 {
+				t.Fatalf("pixel %d bin %d = %g, want about %g", pixel, bin, got, want)
+			}
+		}
+	}
+
+	// Without feature AOVs the neighborhood variance guides the filter, for
+	// Films of any rank.
+	volume := spectralFilm([]int{4, 4, 4}, 1, 1, 0.5)
+	volume.SpectralBins[0].Data[21] = 0.7
+	denoisedVolume, err := Denoise(volume, DenoiseOptions{Iterations: 2})
+	if err != nil {
+		t.Fatalf("denoise volume: %v", err)
+	}
+	if got := denoisedVolume.SpectralBins[0].Data[21]; got >= 0.7 || got < 0.5 {
+		t.Fatalf("volume outlier = %g, want it pulled toward 0.5", got)
+	}
+	if _, err := Denoise(volume, DenoiseOptions{Iterations: -1}); err == nil {
+		t.Fatal("expected negative iterations to be rejected")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/Algo2147483647/ray/engine/controller"
+	"github.com/Algo2147483647/ray/engine/event"
 	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/studio/adapt"
 	studiofilm "github.com/Algo2147483647/ray/studio/film"
@@ -16,12 +17,12 @@ import (
 func run(args []string) int {
 	config, err := parseStudioConfig(args)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(event.NewTextSink(os.Stdout), err)
 		return 1
 	}
 	if config.inputFilm != "" {
 		if err := runFilmConversion(config); err != nil {
-			fmt.Printf("Error: %v\n", err)
+			event.Error(config.events, err)
 			return 1
 		}
 		return 0
@@ -29,49 +30,50 @@ func run(args []string) int {
 
 	script, err := storage.ReadStudioScriptFiles(config.scriptPaths)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 
 	dimension := resolveDimension(script, config)
 	adapted, err := adapt.AdaptScript(script, config.scriptPaths, dimension)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 	config.applyEngineOverrides(adapted, "", 0)
+	seeds := renderSeeds(adapted)
 
 	outputPath, err := storage.WriteIntermediateScript(adapted, config.scriptPaths)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
-	fmt.Printf("Studio wrote intermediate script: %s\n", outputPath)
+	event.Infof(config.events, "Studio wrote intermediate script: %s", outputPath)
 
 	root, err := storage.RepoRoot()
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 	if err := os.Chdir(filepath.Join(root, "engine")); err != nil {
-		fmt.Printf("Error: enter engine directory: %v\n", err)
+		event.Error(config.events, fmt.Errorf("enter engine directory: %w", err))
 		return 1
 	}
 	if config.endless {
-		if err := runEndless(adapted, script, config); err != nil {
-			fmt.Printf("Error: %v\n", err)
+		if err := runEndless(adapted, script, config, seeds); err != nil {
+			event.Error(config.events, err)
 			return 1
 		}
 		return 0
 	}
 	resumeFilm := resolveResumeFilm(script, config)
 	if resumeFilm == "" {
-		code := controller.Run(config.engineArgs(outputPath))
+		code := controller.RunWithEvents(config.engineArgs(outputPath), config.events)
 		if code != 0 {
 			return code
 		}
 		if err := writeStudioImages(resolveRenderOutputs(script, config, "")); err != nil {
-			fmt.Printf("Error: %v\n", err)
+			event.Error(config.events, err)
 			return 1
 		}
 		return 0
@@ -79,30 +81,31 @@ func run(args []string) int {
 
 	tempFilmPath, err := createTempFilmPath()
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 	defer os.Remove(tempFilmPath)
 
 	config.applyEngineOverrides(adapted, tempFilmPath, 0)
+	reseedRenders(adapted, seeds, config.startIteration)
 	outputPath, err = storage.WriteIntermediateScript(adapted, config.scriptPaths)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
-	code := controller.Run(config.engineArgs(outputPath))
+	code := controller.RunWithEvents(config.engineArgs(outputPath), config.events)
 	if code != 0 {
 		return code
 	}
 
 	outputFilm := resolveOutputFilm(script, config)
-	fmt.Printf("Studio merging film: %s + %s -> %s\n", resumeFilm, tempFilmPath, outputFilm)
+	event.Infof(config.events, "Studio merging film: %s + %s -> %s", resumeFilm, tempFilmPath, outputFilm)
 	if err := studiofilm.MergeFilmFilesWithPixelWindows(resumeFilm, tempFilmPath, outputFilm, resolvePixelWindows(script, config)); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 	if err := writeStudioImages(resolveRenderOutputs(script, config, outputFilm)); err != nil {
-		fmt.Printf("Error: %v\n", err)
+		event.Error(config.events, err)
 		return 1
 	}
 	return 0
@@ -114,11 +117,11 @@ func runFilmConversion(config studioConfig) error {
 	if err := writeStudioImages([]studioRenderOutput{output}); err != nil {
 		return fmt.Errorf("convert Film %q to PNG %q: %w", config.inputFilm, output.ImagePath, err)
 	}
-	fmt.Printf("Studio converted Film to PNG: %s -> %s\n", config.inputFilm, output.ImagePath)
+	event.Infof(config.events, "Studio converted Film to PNG: %s -> %s", config.inputFilm, output.ImagePath)
 	return nil
 }
 
-func runEndless(adapted *schema.IntermediateScript, script *schema.StudioScript, config studioConfig) error {
+func runEndless(adapted *schema.IntermediateScript, script *schema.StudioScript, config studioConfig, seeds []uint64) error {
 	if script != nil && len(script.Renders) > 0 {
 		return fmt.Errorf("endless mode supports a single render; remove renders or run them separately")
 	}
@@ -128,9 +131,9 @@ func runEndless(adapted *schema.IntermediateScript, script *schema.StudioScript,
 
 	currentIteration := config.startIteration
 	currentFilm := resolveResumeFilm(script, config)
-	fmt.Printf("Studio endless mode: +%d samples per checkpoint -> %s\n", config.checkpointInterval, config.checkpointDir)
+	event.Infof(config.events, "Studio endless mode: +%d samples per checkpoint -> %s", config.checkpointInterval, config.checkpointDir)
 	if currentFilm != "" {
-		fmt.Printf("Studio resuming endless mode from iteration %d: %s\n", currentIteration, currentFilm)
+		event.Infof(config.events, "Studio resuming endless mode from iteration %d: %s", currentIteration, currentFilm)
 	}
 
 	for {
@@ -141,14 +144,15 @@ func runEndless(adapted *schema.IntermediateScript, script *schema.StudioScript,
 			return err
 		}
 
-		fmt.Printf("Studio endless checkpoint %d: rendering %d samples\n", nextIteration, config.checkpointInterval)
+		event.Infof(config.events, "Studio endless checkpoint %d: rendering %d samples", nextIteration, config.checkpointInterval)
 		config.applyEngineOverrides(adapted, tempFilmPath, config.checkpointInterval)
+		reseedRenders(adapted, seeds, currentIteration)
 		scriptPath, err := storage.WriteIntermediateScript(adapted, config.scriptPaths)
 		if err != nil {
 			os.Remove(tempFilmPath)
 			return err
 		}
-		code := controller.Run(config.engineArgs(scriptPath))
+		code := controller.RunWithEvents(config.engineArgs(scriptPath), config.events)
 		if code != 0 {
 			os.Remove(tempFilmPath)
 			return fmt.Errorf("engine render failed with exit code %d", code)
@@ -169,7 +173,7 @@ func runEndless(adapted *schema.IntermediateScript, script *schema.StudioScript,
 		if err := writeStudioImages([]studioRenderOutput{output}); err != nil {
 			return err
 		}
-		fmt.Printf("Studio saved checkpoint: %s and %s\n", checkpointFilm, checkpointImage)
+		event.Infof(config.events, "Studio saved checkpoint: %s and %s", checkpointFilm, checkpointImage)
 
 		currentIteration = nextIteration
 		currentFilm = checkpointFilm
@@ -321,6 +325,7 @@ func studioRenderOutputFromFilm(film schema.StudioFilmScript, config studioConfi
 	if film.ColorSpace != "" {
 		options.ColorSpace = studiofilm.ColorSpace(film.ColorSpace)
 	}
+	options.Denoise = film.Denoise
 	if config.provided["exposure"] {
 		options.Exposure = config.exposure
 	}
@@ -336,6 +341,12 @@ func studioRenderOutputFromFilm(film schema.StudioFilmScript, config studioConfi
 	if config.provided["color-space"] {
 		options.ColorSpace = studiofilm.ColorSpace(config.colorSpace)
 	}
+	if config.provided["denoise"] {
+		options.Denoise = config.denoise
+	}
+	if config.aov != "" {
+		options.AOV = modelcamera.AOVKind(config.aov)
+	}
 
 	return studioRenderOutput{
 		FilmPath:  filmPath,
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/Algo2147483647/ray/engine/maths/sampler"
 	modelcamera "github.com/Algo2147483647/ray/engine/model/camera"
 	"github.com/Algo2147483647/ray/engine/ray_tracing"
 )
@@ -14,6 +15,7 @@ type StudioScript struct {
 	Materials []map[string]interface{}          `json:"materials"`
 	Media     map[string]map[string]interface{} `json:"media"`
 	Objects   []map[string]interface{}          `json:"objects"`
+	Lights    []map[string]interface{}          `json:"lights"`
 	Cameras   []StudioCameraScript              `json:"cameras"`
 	Films     []StudioFilmScript                `json:"films"`
 	Render    StudioRenderScript                `json:"render"`
@@ -22,14 +24,34 @@ type StudioScript struct {
 }
 
 type StudioRenderScript struct {
-	Integrator         string `json:"integrator"`
-	BDPTFallbackPolicy string `json:"bdpt_fallback_policy,omitempty"`
-	Dimension          int    `json:"dimension"`
-	Samples            int64  `json:"samples"`
-	ThreadNum          int    `json:"thread_num"`
-	FilmID             string `json:"film_id"`
-	SpectrumMode       string `json:"spectrum_mode"`
-	WavelengthSamples  int    `json:"wavelength_samples"`
+	Integrator                 string   `json:"integrator"`
+	BDPTFallbackPolicy         string   `json:"bdpt_fallback_policy,omitempty"`
+	Dimension                  int      `json:"dimension"`
+	Samples                    int64    `json:"samples"`
+	Seed                       uint64   `json:"seed,omitempty"`
+	Sampler                    string   `json:"sampler,omitempty"`
+	Filter                     string   `json:"filter,omitempty"`
+	FilterRadius               float64  `json:"filter_radius,omitempty"`
+	AdaptiveRelativeError      float64  `json:"adaptive_relative_error,omitempty"`
+	AdaptiveMinSamples         int64    `json:"adaptive_min_samples,omitempty"`
+	AdaptiveMaxSamples         int64    `json:"adaptive_max_samples,omitempty"`
+	PathGuiding                bool     `json:"path_guiding,omitempty"`
+	PathGuidingTrainingSamples int64    `json:"path_guiding_training_samples,omitempty"`
+	Polarized                  bool     `json:"polarized,omitempty"`
+	ThreadNum                  int      `json:"thread_num"`
+	FilmID                     string   `json:"film_id"`
+	SpectrumMode               string   `json:"spectrum_mode"`
+	WavelengthSamples          int      `json:"wavelength_samples"`
+	SPPMPhotonsPerPass         int64    `json:"sppm_photons_per_pass,omitempty"`
+	SPPMInitialRadius          float64  `json:"sppm_initial_radius,omitempty"`
+	PSSMLTSeed                 uint64   `json:"pssmlt_seed,omitempty"`
+	PSSMLTChains               int64    `json:"pssmlt_chains,omitempty"`
+	PSSMLTBootstrapSamples     int64    `json:"pssmlt_bootstrap_samples,omitempty"`
+	PSSMLTLargeStepProbability float64  `json:"pssmlt_large_step_probability,omitempty"`
+	VCMInitialRadius           float64  `json:"vcm_initial_radius,omitempty"`
+	AORadius                   float64  `json:"ao_radius,omitempty"`
+	TimeBudget                 float64  `json:"time_budget,omitempty"`
+	AOVs                       []string `json:"aovs,omitempty"`
 }
 
 const DefaultSampledWavelengthCount = 4
@@ -54,6 +76,36 @@ func MergeRenderScripts(base, override StudioRenderScript) StudioRenderScript {
 	if override.Samples > 0 {
 		base.Samples = override.Samples
 	}
+	if override.Seed > 0 {
+		base.Seed = override.Seed
+	}
+	if override.Sampler != "" {
+		base.Sampler = override.Sampler
+	}
+	if override.Filter != "" {
+		base.Filter = override.Filter
+	}
+	if override.FilterRadius > 0 {
+		base.FilterRadius = override.FilterRadius
+	}
+	if override.AdaptiveRelativeError > 0 {
+		base.AdaptiveRelativeError = override.AdaptiveRelativeError
+	}
+	if override.AdaptiveMinSamples > 0 {
+		base.AdaptiveMinSamples = override.AdaptiveMinSamples
+	}
+	if override.AdaptiveMaxSamples > 0 {
+		base.AdaptiveMaxSamples = override.AdaptiveMaxSamples
+	}
+	if override.PathGuiding {
+		base.PathGuiding = true
+	}
+	if override.PathGuidingTrainingSamples > 0 {
+		base.PathGuidingTrainingSamples = override.PathGuidingTrainingSamples
+	}
+	if override.Polarized {
+		base.Polarized = true
+	}
 	if override.ThreadNum > 0 {
 		base.ThreadNum = override.ThreadNum
 	}
@@ -66,12 +118,42 @@ func MergeRenderScripts(base, override StudioRenderScript) StudioRenderScript {
 	if override.WavelengthSamples > 0 {
 		base.WavelengthSamples = override.WavelengthSamples
 	}
+	if override.SPPMPhotonsPerPass > 0 {
+		base.SPPMPhotonsPerPass = override.SPPMPhotonsPerPass
+	}
+	if override.SPPMInitialRadius > 0 {
+		base.SPPMInitialRadius = override.SPPMInitialRadius
+	}
+	if override.PSSMLTSeed > 0 {
+		base.PSSMLTSeed = override.PSSMLTSeed
+	}
+	if override.PSSMLTChains > 0 {
+		base.PSSMLTChains = override.PSSMLTChains
+	}
+	if override.PSSMLTBootstrapSamples > 0 {
+		base.PSSMLTBootstrapSamples = override.PSSMLTBootstrapSamples
+	}
+	if override.PSSMLTLargeStepProbability > 0 {
+		base.PSSMLTLargeStepProbability = override.PSSMLTLargeStepProbability
+	}
+	if override.VCMInitialRadius > 0 {
+		base.VCMInitialRadius = override.VCMInitialRadius
+	}
+	if override.AORadius > 0 {
+		base.AORadius = override.AORadius
+	}
+	if override.TimeBudget > 0 {
+		base.TimeBudget = override.TimeBudget
+	}
+	if len(override.AOVs) > 0 {
+		base.AOVs = append([]string(nil), override.AOVs...)
+	}
 	return base
 }
 
 func (r *StudioRenderScript) UnmarshalJSON(data []byte) error {
 	type plain StudioRenderScript
-	if err := rejectUnknownFields(data, "render", "integrator", "bdpt_fallback_policy", "dimension", "samples", "thread_num", "film_id", "spectrum_mode", "wavelength_samples"); err != nil {
+	if err := rejectUnknownFields(data, "render", "integrator", "bdpt_fallback_policy", "dimension", "samples", "seed", "sampler", "filter", "filter_radius", "adaptive_relative_error", "adaptive_min_samples", "adaptive_max_samples", "path_guiding", "path_guiding_training_samples", "polarized", "thread_num", "film_id", "spectrum_mode", "wavelength_samples", "sppm_photons_per_pass", "sppm_initial_radius", "pssmlt_seed", "pssmlt_chains", "pssmlt_bootstrap_samples", "pssmlt_large_step_probability", "vcm_initial_radius", "ao_radius", "time_budget", "aovs"); err != nil {
 		return err
 	}
 	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
@@ -89,6 +171,12 @@ func (r *StudioRenderScript) UnmarshalJSON(data []byte) error {
 	if _, err := ray_tracing.ParseIntegratorKind(r.Integrator); err != nil {
 		return err
 	}
+	if _, err := sampler.ParseKind(r.Sampler); err != nil {
+		return err
+	}
+	if _, err := modelcamera.NewFilter(modelcamera.FilterKind(r.Filter), r.FilterRadius); err != nil {
+		return err
+	}
 	if r.BDPTFallbackPolicy != "" && r.BDPTFallbackPolicy != string(ray_tracing.BDPTFallbackPath) {
 		return fmt.Errorf("unsupported bdpt_fallback_policy %q", r.BDPTFallbackPolicy)
 	}
@@ -97,9 +185,55 @@ func (r *StudioRenderScript) UnmarshalJSON(data []byte) error {
 	} else if r.SpectrumMode != "" && r.SpectrumMode != "hero_wavelength" && r.SpectrumMode != "sampled" {
 		return fmt.Errorf("unsupported spectrum_mode %q", r.SpectrumMode)
 	}
+	if r.AdaptiveRelativeError < 0 {
+		return fmt.Errorf("render adaptive_relative_error must be >= 0")
+	}
+	if r.AdaptiveMinSamples < 0 || r.AdaptiveMaxSamples < 0 {
+		return fmt.Errorf("render adaptive_min_samples and adaptive_max_samples must be >= 0")
+	}
+	if r.AdaptiveMaxSamples > 0 && r.AdaptiveMinSamples > r.AdaptiveMaxSamples {
+		return fmt.Errorf("render adaptive_min_samples must not exceed adaptive_max_samples")
+	}
+	if r.PathGuidingTrainingSamples < 0 {
+		return fmt.Errorf("render path_guiding_training_samples must be >= 0")
+	}
 	if r.WavelengthSamples < 0 {
 		return fmt.Errorf("render wavelength_samples must be >= 0")
 	}
+	if r.SPPMPhotonsPerPass < 0 {
+		return fmt.Errorf("render sppm_photons_per_pass must be >= 0")
+	}
+	if r.SPPMInitialRadius < 0 {
+		return fmt.Errorf("render sppm_initial_radius must be >= 0")
+	}
+	if r.PSSMLTChains < 0 {
+		return fmt.Errorf("render pssmlt_chains must be >= 0")
+	}
+	if r.PSSMLTBootstrapSamples < 0 {
+		return fmt.Errorf("render pssmlt_bootstrap_samples must be >= 0")
+	}
+	if r.PSSMLTLargeStepProbability < 0 || r.PSSMLTLargeStepProbability > 1 {
+		return fmt.Errorf("render pssmlt_large_step_probability must be in [0, 1]")
+	}
+	if r.VCMInitialRadius < 0 {
+		return fmt.Errorf("render vcm_initial_radius must be >= 0")
+	}
+	if r.AORadius < 0 {
+		return fmt.Errorf("render ao_radius must be >= 0")
+	}
+	if r.TimeBudget < 0 {
+		return fmt.Errorf("render time_budget must be >= 0")
+	}
+	seenAOVs := make(map[string]bool, len(r.AOVs))
+	for _, name := range r.AOVs {
+		if _, err := modelcamera.ParseAOVKind(name); err != nil {
+			return err
+		}
+		if seenAOVs[name] {
+			return fmt.Errorf("render aovs repeats %q", name)
+		}
+		seenAOVs[name] = true
+	}
 	return nil
 }
 
@@ -118,12 +252,13 @@ type StudioFilmScript struct {
 	TanhOmega        float64             `json:"tanh_omega"`
 	Gamma            float64             `json:"gamma"`
 	ColorSpace       string              `json:"color_space"`
+	Denoise          bool                `json:"denoise,omitempty"`
 	PixelWindows     []PixelWindowScript `json:"pixel_windows"`
 }
 
 func (f *StudioFilmScript) UnmarshalJSON(data []byte) error {
 	type plain StudioFilmScript
-	if err := rejectUnknownFields(data, "film", "id", "camera_id", "shape", "spectral_bin_count", "output_image", "output_film", "resume_film", "exposure", "tone_mapping", "tanh_omega", "gamma", "color_space", "pixel_windows"); err != nil {
+	if err := rejectUnknownFields(data, "film", "id", "camera_id", "shape", "spectral_bin_count", "output_image", "output_film", "resume_film", "exposure", "tone_mapping", "tanh_omega", "gamma", "color_space", "denoise", "pixel_windows"); err != nil {
 		return err
 	}
 	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
@@ -187,6 +322,7 @@ type IntermediateScript struct {
 	Materials []map[string]interface{}          `json:"materials,omitempty"`
 	Media     map[string]map[string]interface{} `json:"media,omitempty"`
 	Objects   []map[string]interface{}          `json:"objects,omitempty"`
+	Lights    []map[string]interface{}          `json:"lights,omitempty"`
 	Cameras   []EngineCameraScript              `json:"cameras,omitempty"`
 	Geometry  map[string]interface{}            `json:"geometry,omitempty"`
 	Renders   []map[string]interface{}          `json:"renders,omitempty"`
@@ -50,6 +50,10 @@ func readStudioScriptFileRecursive(path string, stack map[string]bool) (*schema.
 	if err != nil {
 		return nil, err
 	}
+	resolveStudioLightFiles(script, path)
+	resolveStudioEmissionFiles(script, path)
+	resolveStudioSurfaceFiles(script, path)
+	resolveStudioMediaFiles(script, path)
 
 	merged := &schema.StudioScript{}
 	for _, include := range script.Includes {
@@ -125,6 +129,9 @@ func mergeStudioScripts(dst, src *schema.StudioScript, source string) error {
 	if err := appendOrMergeStudioObjects(&dst.Objects, incomingObjects, source); err != nil {
 		return err
 	}
+	for _, light := range src.Lights {
+		dst.Lights = append(dst.Lights, cloneMap(light))
+	}
 	if err := appendUniqueStudioCameras(&dst.Cameras, src.Cameras, source); err != nil {
 		return err
 	}
@@ -160,6 +167,85 @@ func appendUniqueStudioFilms(dst *[]schema.StudioFilmScript, src []schema.Studio
 	return nil
 }
 
+// resolveStudioLightFiles makes light image paths relative to the script that
+// names them, since engine runs from its own directory.
+func resolveStudioLightFiles(script *schema.StudioScript, path string) {
+	for _, light := range script.Lights {
+		file, ok := stringField(light, "file")
+		if ok && !filepath.IsAbs(file) {
+			light["file"] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+}
+
+// resolveStudioEmissionFiles does the same for the photometric profiles of
+// emission distributions.
+func resolveStudioEmissionFiles(script *schema.StudioScript, path string) {
+	for _, material := range script.Materials {
+		emission, ok := material["emission"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		distribution, ok := emission["distribution"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		file, ok := stringField(distribution, "file")
+		if ok && !filepath.IsAbs(file) {
+			distribution["file"] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+}
+
+// resolveStudioSurfaceFiles does the same for the excitation-emission
+// matrices of fluorescent surfaces, including those nested in mixtures and
+// grid lines.
+func resolveStudioSurfaceFiles(script *schema.StudioScript, path string) {
+	for _, material := range script.Materials {
+		if surface, ok := material["surface"].(map[string]interface{}); ok {
+			resolveStudioSurfaceFile(surface, path)
+		}
+	}
+}
+
+func resolveStudioSurfaceFile(surface map[string]interface{}, path string) {
+	if reradiation, ok := surface["reradiation"].(map[string]interface{}); ok {
+		file, ok := stringField(reradiation, "file")
+		if ok && !filepath.IsAbs(file) {
+			reradiation["file"] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+	if components, ok := surface["components"].([]interface{}); ok {
+		for _, rawComponent := range components {
+			component, ok := rawComponent.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if nested, ok := component["surface"].(map[string]interface{}); ok {
+				resolveStudioSurfaceFile(nested, path)
+			}
+		}
+	}
+	if lineSurface, ok := surface["line_surface"].(map[string]interface{}); ok {
+		resolveStudioSurfaceFile(lineSurface, path)
+	}
+}
+
+// resolveStudioMediaFiles does the same for the density grids of
+// heterogeneous media.
+func resolveStudioMediaFiles(script *schema.StudioScript, path string) {
+	for _, medium := range script.Media {
+		density, ok := medium["density"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		file, ok := stringField(density, "file")
+		if ok && !filepath.IsAbs(file) {
+			density["file"] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+}
+
 func mergeStudioMedia(dst, src *schema.StudioScript, source string) error {
 	if len(src.Media) == 0 {
 		return nil
@@ -45,6 +45,11 @@ func TestStudioSchemaValidatesRenderConfiguration(t *testing.T) {
 		"integrator":         `{"renders":[{"integrator":"magic"}]}`,
 		"spectrum mode":      `{"renders":[{"spectrum_mode":"magic"}]}`,
 		"wavelength samples": `{"renders":[{"wavelength_samples":-1}]}`,
+		"aov":                `{"renders":[{"aovs":["magic"]}]}`,
+		"repeated aov":       `{"renders":[{"aovs":["depth","depth"]}]}`,
+		"ao radius":          `{"renders":[{"integrator":"ao","ao_radius":-1}]}`,
+		"time budget":        `{"renders":[{"time_budget":-1}]}`,
+		"guide training":     `{"renders":[{"path_guiding":true,"path_guiding_training_samples":-1}]}`,
 	} {
 		t.Run(name, func(t *testing.T) {
 			var script schema.StudioScript
@@ -566,6 +571,44 @@ func TestStudioMergesArrayObjectsAcrossFiles(t *testing.T) {
 	assertFloatSlice(t, adapted.Objects[1]["center"], []float64{1, 0, 0})
 }
 
+func TestStudioResolvesLightFilesAgainstDeclaringScript(t *testing.T) {
+	dir := t.TempDir()
+	scenePath := filepath.Join(dir, "scene.json")
+	skyDir := filepath.Join(dir, "sky")
+	if err := os.Mkdir(skyDir, 0o755); err != nil {
+		t.Fatalf("create sky dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(skyDir, "sky.json"), []byte(`{
+	  "lights": [{ "type": "environment_map", "file": "studio.hdr", "scale": 0.5 }]
+	}`), 0o644); err != nil {
+		t.Fatalf("write sky script: %v", err)
+	}
+	if err := os.WriteFile(scenePath, []byte(`{
+	  "includes": ["sky/sky.json"],
+	  "lights": [{ "type": "constant_sky", "radiance": [0.1, 0.1, 0.1] }]
+	}`), 0o644); err != nil {
+		t.Fatalf("write scene script: %v", err)
+	}
+
+	script, err := storage.ReadStudioScriptFiles([]string{scenePath})
+	if err != nil {
+		t.Fatalf("read studio scripts: %v", err)
+	}
+	adapted, err := adaptTestScript(script, []string{scenePath}, 3)
+	if err != nil {
+		t.Fatalf("adapt lights: %v", err)
+	}
+	if len(adapted.Lights) != 2 {
+		t.Fatalf("expected two lights, got %d", len(adapted.Lights))
+	}
+	if got, want := adapted.Lights[0]["file"], filepath.Join(skyDir, "studio.hdr"); got != want {
+		t.Fatalf("environment map file = %v, want %q", got, want)
+	}
+	if adapted.Lights[1]["type"] != "constant_sky" {
+		t.Fatalf("unexpected second light: %v", adapted.Lights[1])
+	}
+}
+
 func TestStudioMergesGroupObjectsAcrossFiles(t *testing.T) {
 	dir := t.TempDir()
 	firstPath := filepath.Join(dir, "group-a.json")
@@ -1298,6 +1341,26 @@ func TestStudioEmbedsRenderOverridesInIntermediateScript(t *testing.T) {
 	}
 }
 
+func TestStudioReseedsRendersMergedIntoExistingFilm(t *testing.T) {
+	config, err := parseStudioConfig([]string{"--seed", "7"})
+	if err != nil {
+		t.Fatalf("parse seed: %v", err)
+	}
+	intermediate := &schema.IntermediateScript{Renders: []map[string]interface{}{{"seed": uint64(3)}}}
+	config.applyEngineOverrides(intermediate, "", 0)
+	seeds := renderSeeds(intermediate)
+	if len(seeds) != 1 || seeds[0] != 7 {
+		t.Fatalf("seed override = %v, want [7]", seeds)
+	}
+
+	reseedRenders(intermediate, seeds, 100)
+	first := intermediate.Renders[0]["seed"]
+	reseedRenders(intermediate, seeds, 200)
+	if first == uint64(7) || first == intermediate.Renders[0]["seed"] {
+		t.Fatalf("checkpoint seeds %v and %v repeat samples", first, intermediate.Renders[0]["seed"])
+	}
+}
+
 func TestStudioAcceptsLegacyEngineRenderFlags(t *testing.T) {
 	config, err := parseStudioConfig([]string{
 		"--integrator", "bdpt",
@@ -1421,6 +1484,19 @@ func TestStudioParsesSpectralTanhFilmConversion(t *testing.T) {
 	}
 }
 
+func TestStudioParsesAOVFilmConversion(t *testing.T) {
+	config, err := parseStudioConfig([]string{"--input-film", "render.bin", "--aov", "shading_normal", "--denoise"})
+	if err != nil {
+		t.Fatalf("parse AOV conversion: %v", err)
+	}
+	if output := studioRenderOutputFromFilm(schema.StudioFilmScript{}, config, config.inputFilm); output.Options.AOV != "shading_normal" || !output.Options.Denoise {
+		t.Fatalf("image options = %+v, want the shading_normal AOV and denoising", output.Options)
+	}
+	if _, err := parseStudioConfig([]string{"--input-film", "render.bin", "--aov", "normal"}); err == nil {
+		t.Fatal("expected an unknown AOV to fail")
+	}
+}
+
 func TestRunFilmConversionWritesConfiguredPNG(t *testing.T) {
 	dir := t.TempDir()
 	filmPath := filepath.Join(dir, "render.bin")
@@ -1839,3 +1915,99 @@ func copyDirectory(source, destination string) error {
 	}
 	return nil
 }
+
+func TestStudioResolvesEmissionProfilesAgainstDeclaringScript(t *testing.T) {
+	dir := t.TempDir()
+	scenePath := filepath.Join(dir, "scene.json")
+	if err := os.WriteFile(scenePath, []byte(`{
+	  "materials": [{
+	    "id": "downlight",
+	    "emission": {
+	      "type": "constant",
+	      "radiance": [1, 1, 1],
+	      "distribution": { "type": "ies", "file": "profiles/downlight.ies" }
+	    }
+	  }]
+	}`), 0o644); err != nil {
+		t.Fatalf("write scene script: %v", err)
+	}
+
+	script, err := storage.ReadStudioScriptFiles([]string{scenePath})
+	if err != nil {
+		t.Fatalf("read studio scripts: %v", err)
+	}
+	adapted, err := adaptTestScript(script, []string{scenePath}, 3)
+	if err != nil {
+		t.Fatalf("adapt materials: %v", err)
+	}
+	distribution := adapted.Materials[0]["emission"].(map[string]interface{})["distribution"].(map[string]interface{})
+	if got, want := distribution["file"], filepath.Join(dir, "profiles", "downlight.ies"); got != want {
+		t.Fatalf("profile file = %v, want %q", got, want)
+	}
+}
+
+func TestStudioResolvesDensityGridsAgainstDeclaringScript(t *testing.T) {
+	dir := t.TempDir()
+	scenePath := filepath.Join(dir, "scene.json")
+	if err := os.WriteFile(scenePath, []byte(`{
+	  "media": {
+	    "cloud": {
+	      "type": "heterogeneous",
+	      "density": {
+	        "type": "grid",
+	        "file": "volumes/cloud.raw",
+	        "resolution": [2, 2, 2],
+	        "bounds": { "min": [0, 0, 0], "max": [1, 1, 1] }
+	      }
+	    }
+	  }
+	}`), 0o644); err != nil {
+		t.Fatalf("write scene script: %v", err)
+	}
+
+	script, err := storage.ReadStudioScriptFiles([]string{scenePath})
+	if err != nil {
+		t.Fatalf("read studio scripts: %v", err)
+	}
+	adapted, err := adaptTestScript(script, []string{scenePath}, 3)
+	if err != nil {
+		t.Fatalf("adapt media: %v", err)
+	}
+	density := adapted.Media["cloud"]["density"].(map[string]interface{})
+	if got, want := density["file"], filepath.Join(dir, "volumes", "cloud.raw"); got != want {
+		t.Fatalf("density grid file = %v, want %q", got, want)
+	}
+}
+
+func TestStudioResolvesReradiationMatricesAgainstDeclaringScript(t *testing.T) {
+	dir := t.TempDir()
+	scenePath := filepath.Join(dir, "scene.json")
+	if err := os.WriteFile(scenePath, []byte(`{
+	  "materials": [{
+	    "id": "highlighter",
+	    "surface": {
+	      "type": "weighted_mixture",
+	      "components": [
+	        { "weight": 0.5, "surface": { "type": "fluorescent", "reradiation": { "file": "eem/ink.csv" } } },
+	        { "weight": 0.5, "surface": { "type": "lambert", "albedo": [0.8, 0.8, 0.8] } }
+	      ]
+	    }
+	  }]
+	}`), 0o644); err != nil {
+		t.Fatalf("write scene script: %v", err)
+	}
+
+	script, err := storage.ReadStudioScriptFiles([]string{scenePath})
+	if err != nil {
+		t.Fatalf("read studio scripts: %v", err)
+	}
+	adapted, err := adaptTestScript(script, []string{scenePath}, 3)
+	if err != nil {
+		t.Fatalf("adapt materials: %v", err)
+	}
+	component := adapted.Materials[0]["surface"].(map[string]interface{})["components"].([]interface{})[0].(map[string]interface{})
+	reradiation := component["surface"].(map[string]interface{})["reradiation"].(map[string]interface{})
+	if got, want := reradiation["file"], filepath.Join(dir, "eem", "ink.csv"); got != want {
+		t.Fatalf("matrix file = %v, want %q", got, want)
+	}
+}